@@ -1,6 +1,7 @@
 package candle_binding
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"sync"
@@ -39,28 +40,73 @@ typedef struct {
     bool error;
 } TokenizationResult;
 
-// Classification result structure
+// Classification result structure; runner_up_class is -1 with a single class
 typedef struct {
     int class;
     float confidence;
+    int runner_up_class;
+    float runner_up_confidence;
 } ClassificationResult;
 
+// Embeddings of several texts, one row of cols values per text
+typedef struct {
+    float* data;
+    int rows;
+    int cols;
+    bool error;
+} EmbeddingMatrixResult;
+
 extern SimilarityResult find_most_similar(const char* query, const char** candidates, int num_candidates, int max_length);
+extern SimilarityResult find_most_similar_embedding(const char* query, const float* candidate_embeddings, int num_candidates, int dim, int max_length);
 extern EmbeddingResult get_text_embedding(const char* text, int max_length);
+extern EmbeddingMatrixResult get_text_embeddings(const char** texts, int num_texts, int max_length);
+extern bool init_pool_similarity_model(const char* name, const char* model_id, bool use_cpu);
+extern bool init_pool_classifier(const char* name, const char* model_id, int num_classes, bool use_cpu);
+extern EmbeddingMatrixResult get_pool_text_embeddings(const char* name, const char** texts, int num_texts, int max_length);
+extern SimilarityResult find_most_similar_pool(const char* name, const char* query, const char** candidates, int num_candidates, int max_length);
+extern SimilarityResult find_most_similar_embedding_pool(const char* name, const char* query, const float* candidate_embeddings, int num_candidates, int dim, int max_length);
+extern ClassificationResult classify_pool_text(const char* name, const char* text);
 extern TokenizationResult tokenize_text(const char* text, int max_length);
 extern void free_cstring(char* s);
 extern void free_embedding(float* data, int length);
 extern void free_tokenization_result(TokenizationResult result);
 extern ClassificationResult classify_text(const char* text);
+extern bool init_jailbreak_classifier(const char* model_id, int num_classes, bool use_cpu);
+extern ClassificationResult classify_jailbreak_text(const char* text);
+
+// Token label structure, with the token's byte offsets in the text
+typedef struct {
+    char* label;
+    int start;
+    int end;
+    float confidence;
+} TokenLabel;
+
+// Token classification result structure
+typedef struct {
+    TokenLabel* labels;
+    int count;
+    bool error;
+} TokenClassificationResult;
+
+extern bool init_token_classifier(const char* model_id, bool use_cpu);
+extern TokenClassificationResult classify_tokens(const char* text, int max_length);
+extern void free_token_classification_result(TokenClassificationResult result);
 */
 import "C"
 
 var (
-	initOnce           sync.Once
-	initErr            error
-	modelInitialized   bool
-	classifierInitOnce sync.Once
-	classifierInitErr  error
+	initOnce                sync.Once
+	initErr                 error
+	modelInitialized        bool
+	classifierInitOnce      sync.Once
+	classifierInitErr       error
+	tokenClassifierInitOnce sync.Once
+	jailbreakInitOnce       sync.Once
+
+	// Names of the loaded models of the model pool
+	poolMu     sync.RWMutex
+	poolLoaded = make(map[string]bool)
 )
 
 // TokenizeResult represents the result of tokenization
@@ -79,6 +125,17 @@ type SimResult struct {
 type ClassResult struct {
 	Class      int     // Class index
 	Confidence float32 // Confidence score
+	// Second most likely class and its confidence, RunnerUpClass is -1 when unknown
+	RunnerUpClass      int
+	RunnerUpConfidence float32
+}
+
+// TokenLabel represents the label predicted for a token of a text
+type TokenLabel struct {
+	Label      string  // Label of the token, e.g. B-EMAIL; tokens labelled O are omitted
+	Start      int     // Byte offset of the token's start in the text
+	End        int     // Byte offset of the token's end in the text
+	Confidence float32 // Confidence score
 }
 
 // InitModel initializes the BERT model with the specified model ID
@@ -212,6 +269,125 @@ func GetEmbeddingDefault(text string) ([]float32, error) {
 	return GetEmbedding(text, 512)
 }
 
+// GetEmbeddings gets the embedding vectors for several texts, embedded
+// together in a single batch
+func GetEmbeddings(texts []string, maxLength int) ([][]float32, error) {
+	if !modelInitialized {
+		return nil, fmt.Errorf("BERT model not initialized")
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	cTexts := make([]*C.char, len(texts))
+	for i, text := range texts {
+		cTexts[i] = C.CString(text)
+		defer C.free(unsafe.Pointer(cTexts[i]))
+	}
+
+	result := C.get_text_embeddings((**C.char)(unsafe.Pointer(&cTexts[0])), C.int(len(texts)), C.int(maxLength))
+	return embeddingMatrix(result)
+}
+
+// embeddingMatrix copies an embedding matrix returned by the library into Go
+// memory and frees it
+func embeddingMatrix(result C.EmbeddingMatrixResult) ([][]float32, error) {
+	if bool(result.error) {
+		return nil, fmt.Errorf("failed to generate embeddings")
+	}
+	defer C.free_embedding(result.data, result.rows*result.cols)
+
+	rows, cols := int(result.rows), int(result.cols)
+	cFloats := unsafe.Slice((*C.float)(unsafe.Pointer(result.data)), rows*cols)
+	embeddings := make([][]float32, rows)
+	for i := range embeddings {
+		embeddings[i] = make([]float32, cols)
+		for j := range embeddings[i] {
+			embeddings[i][j] = float32(cFloats[i*cols+j])
+		}
+	}
+	return embeddings, nil
+}
+
+// CandidateEmbeddings holds the embeddings of a list of candidate texts,
+// computed once so finding the candidate most similar to a query only embeds
+// the query
+type CandidateEmbeddings struct {
+	// Name of the pool model the candidates were embedded with, empty for the
+	// default BERT model
+	model string
+	// Row-major matrix of one embedding per candidate
+	data  []float32
+	count int
+	dim   int
+}
+
+// NewCandidateEmbeddings embeds the candidates in a single batch
+func NewCandidateEmbeddings(candidates []string, maxLength int) (*CandidateEmbeddings, error) {
+	embeddings, err := GetEmbeddings(candidates, maxLength)
+	if err != nil {
+		return nil, err
+	}
+	return newCandidateEmbeddings("", embeddings)
+}
+
+// NewPoolCandidateEmbeddings embeds the candidates in a single batch with the
+// named model of the model pool
+func NewPoolCandidateEmbeddings(model string, candidates []string, maxLength int) (*CandidateEmbeddings, error) {
+	embeddings, err := GetPoolEmbeddings(model, candidates, maxLength)
+	if err != nil {
+		return nil, err
+	}
+	return newCandidateEmbeddings(model, embeddings)
+}
+
+func newCandidateEmbeddings(model string, embeddings [][]float32) (*CandidateEmbeddings, error) {
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no candidates")
+	}
+	c := &CandidateEmbeddings{model: model, count: len(embeddings), dim: len(embeddings[0])}
+	c.data = make([]float32, 0, c.count*c.dim)
+	for _, embedding := range embeddings {
+		c.data = append(c.data, embedding...)
+	}
+	return c, nil
+}
+
+// Len returns the number of candidates
+func (c *CandidateEmbeddings) Len() int {
+	return c.count
+}
+
+// FindMostSimilarEmbedded finds the candidate most similar to the query with a
+// single matrix product against the candidates' embeddings. The query is
+// embedded with the model the candidates were embedded with.
+func FindMostSimilarEmbedded(query string, candidates *CandidateEmbeddings, maxLength int) SimResult {
+	if candidates == nil || candidates.count == 0 {
+		return SimResult{Index: -1, Score: -1.0}
+	}
+	if candidates.model == "" && !modelInitialized || candidates.model != "" && !IsPoolModelInitialized(candidates.model) {
+		fmt.Println("BERT model not initialized")
+		return SimResult{Index: -1, Score: -1.0}
+	}
+
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+
+	data := (*C.float)(unsafe.Pointer(&candidates.data[0]))
+	var result C.SimilarityResult
+	if candidates.model == "" {
+		result = C.find_most_similar_embedding(cQuery, data, C.int(candidates.count), C.int(candidates.dim), C.int(maxLength))
+	} else {
+		cModel := C.CString(candidates.model)
+		defer C.free(unsafe.Pointer(cModel))
+		result = C.find_most_similar_embedding_pool(cModel, cQuery, data, C.int(candidates.count), C.int(candidates.dim), C.int(maxLength))
+	}
+	return SimResult{
+		Index: int(result.index),
+		Score: float32(result.score),
+	}
+}
+
 // CalculateSimilarity calculates the similarity between two texts with maxLength parameter
 func CalculateSimilarity(text1, text2 string, maxLength int) float32 {
 	if !modelInitialized {
@@ -321,7 +497,264 @@ func ClassifyText(text string) (ClassResult, error) {
 	}
 
 	return ClassResult{
-		Class:      int(result.class),
-		Confidence: float32(result.confidence),
+		Class:              int(result.class),
+		Confidence:         float32(result.confidence),
+		RunnerUpClass:      int(result.runner_up_class),
+		RunnerUpConfidence: float32(result.runner_up_confidence),
+	}, nil
+}
+
+// InitJailbreakClassifier initializes the classifier detecting jailbreak and
+// prompt injection attempts, loaded alongside the category classifier
+func InitJailbreakClassifier(modelPath string, numClasses int, useCPU bool) error {
+	var err error
+	jailbreakInitOnce.Do(func() {
+		if modelPath == "" {
+			err = fmt.Errorf("jailbreak classifier model path is empty")
+			return
+		}
+
+		if numClasses < 2 {
+			err = fmt.Errorf("number of classes must be at least 2, got %d", numClasses)
+			return
+		}
+
+		fmt.Println("Initializing jailbreak classifier model:", modelPath)
+
+		cModelID := C.CString(modelPath)
+		defer C.free(unsafe.Pointer(cModelID))
+
+		success := C.init_jailbreak_classifier(cModelID, C.int(numClasses), C.bool(useCPU))
+		if !bool(success) {
+			err = fmt.Errorf("failed to initialize jailbreak classifier model")
+		}
+	})
+
+	// Reset the once so loading can be retried
+	if err != nil {
+		jailbreakInitOnce = sync.Once{}
+	}
+	return err
+}
+
+// ClassifyJailbreakText classifies the provided text with the jailbreak classifier
+func ClassifyJailbreakText(text string) (ClassResult, error) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	result := C.classify_jailbreak_text(cText)
+
+	if result.class < 0 {
+		return ClassResult{}, fmt.Errorf("failed to classify text for jailbreaks")
+	}
+
+	return ClassResult{
+		Class:              int(result.class),
+		Confidence:         float32(result.confidence),
+		RunnerUpClass:      int(result.runner_up_class),
+		RunnerUpConfidence: float32(result.runner_up_confidence),
+	}, nil
+}
+
+// InitTokenClassifier initializes the BERT token classifier with the specified
+// model path; the labels are read from the model's config
+func InitTokenClassifier(modelPath string, useCPU bool) error {
+	var err error
+	tokenClassifierInitOnce.Do(func() {
+		if modelPath == "" {
+			err = fmt.Errorf("token classifier model path is empty")
+			return
+		}
+
+		fmt.Println("Initializing token classifier model:", modelPath)
+
+		cModelID := C.CString(modelPath)
+		defer C.free(unsafe.Pointer(cModelID))
+
+		success := C.init_token_classifier(cModelID, C.bool(useCPU))
+		if !bool(success) {
+			err = fmt.Errorf("failed to initialize token classifier model")
+		}
+	})
+
+	// Reset the once so loading can be retried
+	if err != nil {
+		tokenClassifierInitOnce = sync.Once{}
+	}
+	return err
+}
+
+// ClassifyTokens labels the tokens of the provided text, classifying texts
+// longer than maxLength tokens in overlapping windows
+func ClassifyTokens(text string, maxLength int) ([]TokenLabel, error) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	result := C.classify_tokens(cText, C.int(maxLength))
+	defer C.free_token_classification_result(result)
+
+	if result.error {
+		return nil, fmt.Errorf("failed to classify tokens")
+	}
+
+	count := int(result.count)
+	labels := make([]TokenLabel, count)
+	if count > 0 {
+		cLabels := (*[1 << 30]C.TokenLabel)(unsafe.Pointer(result.labels))[:count:count]
+		for i, l := range cLabels {
+			labels[i] = TokenLabel{
+				Label:      C.GoString(l.label),
+				Start:      int(l.start),
+				End:        int(l.end),
+				Confidence: float32(l.confidence),
+			}
+		}
+	}
+	return labels, nil
+}
+
+// ClassifyTokensDefault labels the tokens of the provided text in windows of 512 tokens
+func ClassifyTokensDefault(text string) ([]TokenLabel, error) {
+	return ClassifyTokens(text, 512)
+}
+
+// PoolModel is a model of the model pool, loaded alongside the default BERT
+// model and addressed by its name, e.g. a similarity model for a language
+type PoolModel struct {
+	Name    string
+	ModelID string
+	// Number of classes of a classifier, 0 for a similarity model
+	NumClasses int
+	UseCPU     bool
+}
+
+// InitModelPool loads the models of the pool concurrently, replacing models
+// loaded before under the same names. The models that loaded stay usable when
+// others fail, whose errors are returned joined.
+func InitModelPool(models []PoolModel) error {
+	errs := make([]error, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = initPoolModel(model)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func initPoolModel(model PoolModel) error {
+	if model.Name == "" || model.ModelID == "" {
+		return fmt.Errorf("pool model needs a name and a model ID")
+	}
+	if model.NumClasses == 1 || model.NumClasses < 0 {
+		return fmt.Errorf("pool model %s: number of classes must be at least 2, got %d", model.Name, model.NumClasses)
+	}
+
+	fmt.Printf("Initializing pool model %s: %s\n", model.Name, model.ModelID)
+
+	cName := C.CString(model.Name)
+	defer C.free(unsafe.Pointer(cName))
+	cModelID := C.CString(model.ModelID)
+	defer C.free(unsafe.Pointer(cModelID))
+
+	var success C.bool
+	if model.NumClasses == 0 {
+		success = C.init_pool_similarity_model(cName, cModelID, C.bool(model.UseCPU))
+	} else {
+		success = C.init_pool_classifier(cName, cModelID, C.int(model.NumClasses), C.bool(model.UseCPU))
+	}
+	if !bool(success) {
+		return fmt.Errorf("failed to initialize pool model %s", model.Name)
+	}
+
+	poolMu.Lock()
+	poolLoaded[model.Name] = true
+	poolMu.Unlock()
+	return nil
+}
+
+// IsPoolModelInitialized returns whether the named model of the pool has been
+// successfully initialized
+func IsPoolModelInitialized(name string) bool {
+	poolMu.RLock()
+	defer poolMu.RUnlock()
+	return poolLoaded[name]
+}
+
+// GetPoolEmbeddings gets the embedding vectors for several texts with the
+// named similarity model of the pool, embedded together in a single batch
+func GetPoolEmbeddings(name string, texts []string, maxLength int) ([][]float32, error) {
+	if !IsPoolModelInitialized(name) {
+		return nil, fmt.Errorf("pool model %s not initialized", name)
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cTexts := make([]*C.char, len(texts))
+	for i, text := range texts {
+		cTexts[i] = C.CString(text)
+		defer C.free(unsafe.Pointer(cTexts[i]))
+	}
+
+	result := C.get_pool_text_embeddings(cName, (**C.char)(unsafe.Pointer(&cTexts[0])), C.int(len(texts)), C.int(maxLength))
+	return embeddingMatrix(result)
+}
+
+// FindMostSimilarInPool finds the most similar text from a list of candidates
+// with the named similarity model of the pool
+func FindMostSimilarInPool(name, query string, candidates []string, maxLength int) SimResult {
+	if !IsPoolModelInitialized(name) {
+		fmt.Printf("Pool model %s not initialized\n", name)
+		return SimResult{Index: -1, Score: -1.0}
+	}
+	if len(candidates) == 0 {
+		return SimResult{Index: -1, Score: -1.0}
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+	cCandidates := make([]*C.char, len(candidates))
+	for i, candidate := range candidates {
+		cCandidates[i] = C.CString(candidate)
+		defer C.free(unsafe.Pointer(cCandidates[i]))
+	}
+
+	result := C.find_most_similar_pool(cName, cQuery, (**C.char)(unsafe.Pointer(&cCandidates[0])),
+		C.int(len(candidates)), C.int(maxLength))
+	return SimResult{
+		Index: int(result.index),
+		Score: float32(result.score),
+	}
+}
+
+// ClassifyPoolText classifies the text with the named classifier of the pool
+func ClassifyPoolText(name, text string) (ClassResult, error) {
+	if !IsPoolModelInitialized(name) {
+		return ClassResult{}, fmt.Errorf("pool model %s not initialized", name)
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	result := C.classify_pool_text(cName, cText)
+	if result.class < 0 {
+		return ClassResult{}, fmt.Errorf("failed to classify text with pool model %s", name)
+	}
+
+	return ClassResult{
+		Class:              int(result.class),
+		Confidence:         float32(result.confidence),
+		RunnerUpClass:      int(result.runner_up_class),
+		RunnerUpConfidence: float32(result.runner_up_confidence),
 	}, nil
 }
@@ -415,3 +415,107 @@ func TestClassifyText(t *testing.T) {
 		}
 	})
 }
+
+// taskDescriptions stand in for the category descriptions the router matches queries against
+var taskDescriptions = []string{
+	"mathematics questions, calculus, algebra and arithmetic",
+	"legal questions about contracts, liability and regulations",
+	"medical questions about symptoms, treatments and medications",
+	"programming questions about code, debugging and software design",
+	"history questions about events, people and civilizations",
+	"physics questions about mechanics, energy and relativity",
+	"business questions about strategy, marketing and finance",
+	"chemistry questions about reactions, elements and compounds",
+	"psychology questions about behavior, emotions and cognition",
+	"philosophy questions about ethics, logic and metaphysics",
+	"biology questions about cells, genetics and evolution",
+	"economics questions about markets, inflation and policy",
+}
+
+func TestFindMostSimilarEmbedded(t *testing.T) {
+	if !initBERTModel(t, "sentence-transformers/all-MiniLM-L6-v2", true) {
+		t.Skip("BERT model not available")
+	}
+	candidates, err := NewCandidateEmbeddings(taskDescriptions, 512)
+	if err != nil {
+		t.Fatalf("NewCandidateEmbeddings: %v", err)
+	}
+	if candidates.Len() != len(taskDescriptions) {
+		t.Fatalf("got %d candidate embeddings, want %d", candidates.Len(), len(taskDescriptions))
+	}
+
+	// Batched candidates are padded, which must not change their embeddings
+	single, err := GetEmbeddingDefault(taskDescriptions[0])
+	if err != nil {
+		t.Fatalf("GetEmbedding: %v", err)
+	}
+	for i, value := range single {
+		if math.Abs(float64(value-candidates.data[i])) > 1e-4 {
+			t.Fatalf("batched embedding differs at %d: %f vs %f", i, candidates.data[i], value)
+		}
+	}
+
+	for _, query := range []string{"What is the derivative of x squared?", "Is a verbal contract legally binding?"} {
+		want := FindMostSimilarDefault(query, taskDescriptions)
+		got := FindMostSimilarEmbedded(query, candidates, 512)
+		if got.Index != want.Index || math.Abs(float64(got.Score-want.Score)) > 1e-4 {
+			t.Errorf("query %q: embedded search found %+v, per-call search %+v", query, got, want)
+		}
+	}
+}
+
+func TestInitModelPool(t *testing.T) {
+	err := InitModelPool([]PoolModel{
+		{Name: "en", ModelID: "sentence-transformers/all-MiniLM-L6-v2", UseCPU: true},
+		{Name: "multilingual", ModelID: "sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2", UseCPU: true},
+	})
+	if err != nil {
+		t.Skipf("pool models not available: %v", err)
+	}
+
+	candidates, err := NewPoolCandidateEmbeddings("multilingual", taskDescriptions, 512)
+	if err != nil {
+		t.Fatalf("NewPoolCandidateEmbeddings: %v", err)
+	}
+	for _, query := range []string{"Was ist die Ableitung von x zum Quadrat?", "¿Es vinculante un contrato verbal?"} {
+		want := FindMostSimilarInPool("multilingual", query, taskDescriptions, 512)
+		got := FindMostSimilarEmbedded(query, candidates, 512)
+		if got.Index != want.Index || math.Abs(float64(got.Score-want.Score)) > 1e-4 {
+			t.Errorf("query %q: embedded search found %+v, per-call search %+v", query, got, want)
+		}
+	}
+
+	// Each pool model scores with its own embeddings
+	english := FindMostSimilarInPool("en", "What is the derivative of x squared?", taskDescriptions, 512)
+	if english.Index < 0 {
+		t.Errorf("English pool model found no candidate: %+v", english)
+	}
+	if _, err := GetPoolEmbeddings("fr", taskDescriptions, 512); err == nil {
+		t.Error("embedding with a model not in the pool succeeded")
+	}
+}
+
+// BenchmarkFindMostSimilar compares embedding the candidates on every call
+// with embedding them once and scoring them with a single matrix product
+func BenchmarkFindMostSimilar(b *testing.B) {
+	if err := InitModel("sentence-transformers/all-MiniLM-L6-v2", true); err != nil {
+		b.Skipf("BERT model not available: %v", err)
+	}
+	query := "What is the derivative of x squared?"
+
+	b.Run("PerCall", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			FindMostSimilarDefault(query, taskDescriptions)
+		}
+	})
+	b.Run("Precomputed", func(b *testing.B) {
+		candidates, err := NewCandidateEmbeddings(taskDescriptions, 512)
+		if err != nil {
+			b.Fatalf("NewCandidateEmbeddings: %v", err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			FindMostSimilarEmbedded(query, candidates, 512)
+		}
+	})
+}
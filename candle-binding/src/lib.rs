@@ -1,5 +1,6 @@
 // This file is a binding for the candle-core and candle-transformers libraries.
 // It is based on https://github.com/huggingface/candle/tree/main/candle-examples/examples/bert
+use std::collections::HashMap;
 use std::ffi::{c_char, CStr, CString};
 use std::sync::Arc;
 use std::sync::Mutex;
@@ -7,10 +8,11 @@ use std::path::Path;
 
 use anyhow::{Error as E, Result};
 use candle_core::{DType, Device, Tensor};
-use candle_nn::{VarBuilder, Linear};
+use candle_nn::{Module, VarBuilder, Linear};
 use candle_transformers::models::bert::{BertModel, Config, HiddenAct, DTYPE};
 use hf_hub::{api::sync::Api, Repo, RepoType};
 use tokenizers::Tokenizer;
+use tokenizers::{PaddingParams, PaddingStrategy};
 use tokenizers::TruncationParams;
 use tokenizers::TruncationStrategy;
 use tokenizers::TruncationDirection;
@@ -31,9 +33,24 @@ pub struct BertClassifier {
     device: Device,
 }
 
+// Structure to hold BERT model, tokenizer, and per-token classification head for entity detection
+pub struct BertTokenClassifier {
+    model: BertModel,
+    tokenizer: Tokenizer,
+    classification_head: Linear,
+    labels: Vec<String>,
+    device: Device,
+}
+
 lazy_static::lazy_static! {
     static ref BERT_SIMILARITY: Arc<Mutex<Option<BertSimilarity>>> = Arc::new(Mutex::new(None));
     static ref BERT_CLASSIFIER: Arc<Mutex<Option<BertClassifier>>> = Arc::new(Mutex::new(None));
+    static ref BERT_TOKEN_CLASSIFIER: Arc<Mutex<Option<BertTokenClassifier>>> = Arc::new(Mutex::new(None));
+    static ref JAILBREAK_CLASSIFIER: Arc<Mutex<Option<BertClassifier>>> = Arc::new(Mutex::new(None));
+    // Named models of the model pool, e.g. a similarity model per language.
+    // Models are cloned out of the map, so pool models run concurrently.
+    static ref SIMILARITY_POOL: Mutex<HashMap<String, Arc<BertSimilarity>>> = Mutex::new(HashMap::new());
+    static ref CLASSIFIER_POOL: Mutex<HashMap<String, Arc<BertClassifier>>> = Mutex::new(HashMap::new());
 }
 
 // Structure to hold tokenization result
@@ -212,31 +229,79 @@ impl BertSimilarity {
         Ok(sim_value)
     }
 
+    // Get the embeddings of several texts in a single forward pass, one row per text
+    pub fn get_embeddings(&self, texts: &[&str], max_length: Option<usize>) -> Result<Tensor> {
+        if texts.is_empty() {
+            return Err(E::msg("Empty text list"));
+        }
+
+        // Pad the texts to the longest one, padding is masked out below
+        let mut tokenizer = self.tokenizer.clone();
+        tokenizer.with_truncation(Some(TruncationParams {
+            max_length: max_length.unwrap_or(512),
+            strategy: TruncationStrategy::LongestFirst,
+            stride: 0,
+            direction: TruncationDirection::Right,
+        })).map_err(E::msg)?;
+        tokenizer.with_padding(Some(PaddingParams {
+            strategy: PaddingStrategy::BatchLongest,
+            ..Default::default()
+        }));
+
+        let encodings = tokenizer.encode_batch(texts.to_vec(), true)
+            .map_err(E::msg)?;
+
+        let token_ids = encodings.iter()
+            .map(|encoding| Tensor::new(encoding.get_ids(), &self.device))
+            .collect::<candle_core::Result<Vec<_>>>()?;
+        let attention_mask = encodings.iter()
+            .map(|encoding| Tensor::new(encoding.get_attention_mask(), &self.device))
+            .collect::<candle_core::Result<Vec<_>>>()?;
+        let token_ids_tensor = Tensor::stack(&token_ids, 0)?;
+        let attention_mask_tensor = Tensor::stack(&attention_mask, 0)?;
+        let token_type_ids = token_ids_tensor.zeros_like()?;
+
+        let embeddings = self.model.forward(&token_ids_tensor, &token_type_ids, Some(&attention_mask_tensor))?;
+
+        // Mean pooling over the tokens of each text, excluding the padding
+        let mask = attention_mask_tensor.to_dtype(embeddings.dtype())?.unsqueeze(2)?;
+        let sum_embeddings = embeddings.broadcast_mul(&mask)?.sum(1)?;
+        let attention_sum = mask.sum(1)?;
+        let pooled = sum_embeddings.broadcast_div(&attention_sum)?;
+
+        normalize_l2(&pooled.to_dtype(DType::F32)?)
+    }
+
     // Find most similar text from a list
     pub fn find_most_similar(&self, query_text: &str, candidates: &[&str], max_length: Option<usize>) -> Result<(usize, f32)> {
         if candidates.is_empty() {
             return Err(E::msg("Empty candidate list"));
         }
-        
+
+        let candidate_embeddings = self.get_embeddings(candidates, max_length)?;
+        self.find_most_similar_embedding(query_text, &candidate_embeddings, max_length)
+    }
+
+    // Find the most similar of candidates already embedded, one row per
+    // candidate, so only the query is embedded
+    pub fn find_most_similar_embedding(&self, query_text: &str, candidate_embeddings: &Tensor, max_length: Option<usize>) -> Result<(usize, f32)> {
         let query_embedding = self.get_embedding(query_text, max_length)?;
-        
-        // Calculate similarity for each candidate individually
+
+        // A single matrix product scores every candidate (dot product of
+        // normalized vectors = cosine similarity)
+        let scores = candidate_embeddings.matmul(&query_embedding.transpose(0, 1)?)?
+            .squeeze(1)?
+            .to_vec1::<f32>()?;
+
         let mut best_idx = 0;
         let mut best_score = -1.0;
-        
-        for (idx, candidate) in candidates.iter().enumerate() {
-            let candidate_embedding = self.get_embedding(candidate, max_length)?;
-            
-            // Calculate similarity (dot product of normalized vectors = cosine similarity)
-            let sim = query_embedding.matmul(&candidate_embedding.transpose(0, 1)?)?;
-            let score = sim.squeeze(0)?.squeeze(0)?.to_scalar::<f32>()?;
-            
+        for (idx, &score) in scores.iter().enumerate() {
             if score > best_score {
                 best_score = score;
                 best_idx = idx;
             }
         }
-        
+
         Ok((best_idx, best_score))
     }
 }
@@ -429,7 +494,8 @@ impl BertClassifier {
         })
     }
 
-    pub fn classify_text(&self, text: &str) -> Result<(usize, f32)> {
+    // Returns the predicted class and its probability, followed by the runner-up class and its probability
+    pub fn classify_text(&self, text: &str) -> Result<(usize, f32, Option<(usize, f32)>)> {
         // Encode the text with the tokenizer
         let encoding = self.tokenizer
             .encode(text, true)
@@ -492,7 +558,14 @@ impl BertClassifier {
             )));
         }
         
-        Ok((predicted_idx, max_prob))
+        // Find the runner-up class, used to detect categories that are often confused
+        let runner_up = probabilities.iter()
+            .enumerate()
+            .filter(|(idx, _)| *idx != predicted_idx)
+            .max_by(|(_, a), (_, b)| a.partial_cmp(b).unwrap_or(std::cmp::Ordering::Equal))
+            .map(|(idx, &prob)| (idx, prob));
+
+        Ok((predicted_idx, max_prob, runner_up))
     }
 }
 
@@ -769,8 +842,13 @@ pub extern "C" fn find_most_similar(
         }
     };
 
+    most_similar_with(bert, query, &candidates, max_length)
+}
+
+// Find the most similar text from a list with the given model
+fn most_similar_with(bert: &BertSimilarity, query: &str, candidates: &[&str], max_length: i32) -> SimilarityResult {
     let max_length_opt = if max_length <= 0 { None } else { Some(max_length as usize) };
-    match bert.find_most_similar(query, &candidates, max_length_opt) {
+    match bert.find_most_similar(query, candidates, max_length_opt) {
         Ok((idx, score)) => SimilarityResult { 
             index: idx as i32, 
             score 
@@ -782,6 +860,139 @@ pub extern "C" fn find_most_similar(
     }
 }
 
+// Structure to hold the embeddings of several texts, one row per text
+#[repr(C)]
+pub struct EmbeddingMatrixResult {
+    pub data: *mut f32,
+    pub rows: i32,
+    pub cols: i32,
+    pub error: bool,
+}
+
+// Get the embeddings of several texts in a single batch (called from Go).
+// The data is freed with free_embedding(data, rows * cols).
+#[no_mangle]
+pub extern "C" fn get_text_embeddings(
+    texts_ptr: *const *const c_char,
+    num_texts: i32,
+    max_length: i32
+) -> EmbeddingMatrixResult {
+    let failed = EmbeddingMatrixResult { data: std::ptr::null_mut(), rows: 0, cols: 0, error: true };
+    if texts_ptr.is_null() || num_texts <= 0 {
+        return failed;
+    }
+
+    let texts: Vec<&str> = unsafe {
+        let mut result = Vec::with_capacity(num_texts as usize);
+        for &cstr in std::slice::from_raw_parts(texts_ptr, num_texts as usize) {
+            match CStr::from_ptr(cstr).to_str() {
+                Ok(s) => result.push(s),
+                Err(_) => return failed,
+            }
+        }
+        result
+    };
+
+    let bert_opt = BERT_SIMILARITY.lock().unwrap();
+    let bert = match &*bert_opt {
+        Some(b) => b,
+        None => {
+            eprintln!("BERT model not initialized");
+            return failed;
+        }
+    };
+
+    embeddings_with(bert, &texts, max_length)
+}
+
+// Get the embeddings of several texts in a single batch with the given model
+fn embeddings_with(bert: &BertSimilarity, texts: &[&str], max_length: i32) -> EmbeddingMatrixResult {
+    let failed = EmbeddingMatrixResult { data: std::ptr::null_mut(), rows: 0, cols: 0, error: true };
+    let max_length_opt = if max_length <= 0 { None } else { Some(max_length as usize) };
+    let embeddings = match bert.get_embeddings(texts, max_length_opt) {
+        Ok(embeddings) => embeddings,
+        Err(e) => {
+            eprintln!("Error getting embeddings: {}", e);
+            return failed;
+        }
+    };
+    let (rows, cols) = match embeddings.dims2() {
+        Ok(dims) => dims,
+        Err(_) => return failed,
+    };
+    match embeddings.flatten_all().and_then(|flat| flat.to_vec1::<f32>()) {
+        Ok(mut vec) => {
+            // Go frees the data by its length, so capacity must match
+            vec.shrink_to_fit();
+            let data = vec.as_mut_ptr();
+            std::mem::forget(vec);
+            EmbeddingMatrixResult { data, rows: rows as i32, cols: cols as i32, error: false }
+        }
+        Err(_) => failed,
+    }
+}
+
+// Find the most similar of candidates embedded beforehand, given as a
+// row-major num_candidates x dim matrix (called from Go)
+#[no_mangle]
+pub extern "C" fn find_most_similar_embedding(
+    query: *const c_char,
+    candidate_embeddings: *const f32,
+    num_candidates: i32,
+    dim: i32,
+    max_length: i32
+) -> SimilarityResult {
+    let failed = SimilarityResult { index: -1, score: -1.0 };
+    if candidate_embeddings.is_null() || num_candidates <= 0 || dim <= 0 {
+        return failed;
+    }
+    let query = unsafe {
+        match CStr::from_ptr(query).to_str() {
+            Ok(s) => s,
+            Err(_) => return failed,
+        }
+    };
+    let data = unsafe { std::slice::from_raw_parts(candidate_embeddings, (num_candidates * dim) as usize) };
+
+    let bert_opt = BERT_SIMILARITY.lock().unwrap();
+    let bert = match &*bert_opt {
+        Some(b) => b,
+        None => {
+            eprintln!("BERT model not initialized");
+            return failed;
+        }
+    };
+
+    most_similar_embedding_with(bert, query, data, num_candidates, dim, max_length)
+}
+
+// Find the most similar of candidates embedded beforehand with the given model
+fn most_similar_embedding_with(
+    bert: &BertSimilarity,
+    query: &str,
+    data: &[f32],
+    num_candidates: i32,
+    dim: i32,
+    max_length: i32
+) -> SimilarityResult {
+    let failed = SimilarityResult { index: -1, score: -1.0 };
+    let candidates = match Tensor::from_slice(data, (num_candidates as usize, dim as usize), &bert.device) {
+        Ok(tensor) => tensor,
+        Err(e) => {
+            eprintln!("Error loading candidate embeddings: {}", e);
+            return failed;
+        }
+    };
+    let max_length_opt = if max_length <= 0 { None } else { Some(max_length as usize) };
+    match bert.find_most_similar_embedding(query, &candidates, max_length_opt) {
+        Ok((idx, score)) => SimilarityResult { index: idx as i32, score },
+        Err(e) => {
+            eprintln!("Error finding most similar: {}", e);
+            failed
+        }
+    }
+}
+
 // Free a C string allocated by Rust
 #[no_mangle]
 pub extern "C" fn free_cstring(s: *mut c_char) {
@@ -815,6 +1026,8 @@ fn normalize_l2(v: &Tensor) -> Result<Tensor> {
 pub struct ClassificationResult {
     pub class: i32,
     pub confidence: f32,
+    pub runner_up_class: i32,
+    pub runner_up_confidence: f32,
 }
 
 // Initialize the BERT classifier model (called from Go)
@@ -849,9 +1062,51 @@ pub extern "C" fn init_classifier(model_id: *const c_char, num_classes: i32, use
 // Classify text using BERT (called from Go)
 #[no_mangle]
 pub extern "C" fn classify_text(text: *const c_char) -> ClassificationResult {
+    classify_with(&BERT_CLASSIFIER, text)
+}
+
+// Initialize the jailbreak classifier model, a second classifier alongside the
+// category classifier (called from Go)
+#[no_mangle]
+pub extern "C" fn init_jailbreak_classifier(model_id: *const c_char, num_classes: i32, use_cpu: bool) -> bool {
+    let model_id = unsafe {
+        match CStr::from_ptr(model_id).to_str() {
+            Ok(s) => s,
+            Err(_) => return false,
+        }
+    };
+
+    if num_classes < 2 {
+        eprintln!("Number of classes must be at least 2, got {}", num_classes);
+        return false;
+    }
+
+    match BertClassifier::new(model_id, num_classes as usize, use_cpu) {
+        Ok(classifier) => {
+            let mut bert_opt = JAILBREAK_CLASSIFIER.lock().unwrap();
+            *bert_opt = Some(classifier);
+            true
+        }
+        Err(e) => {
+            eprintln!("Failed to initialize jailbreak classifier: {}", e);
+            false
+        }
+    }
+}
+
+// Classify text using the jailbreak classifier (called from Go)
+#[no_mangle]
+pub extern "C" fn classify_jailbreak_text(text: *const c_char) -> ClassificationResult {
+    classify_with(&JAILBREAK_CLASSIFIER, text)
+}
+
+// Classify text with the given classifier
+fn classify_with(classifier: &Mutex<Option<BertClassifier>>, text: *const c_char) -> ClassificationResult {
     let default_result = ClassificationResult {
         class: -1,
         confidence: 0.0,
+        runner_up_class: -1,
+        runner_up_confidence: 0.0,
     };
 
     let text = unsafe {
@@ -861,21 +1116,468 @@ pub extern "C" fn classify_text(text: *const c_char) -> ClassificationResult {
         }
     };
 
-    let bert_opt = BERT_CLASSIFIER.lock().unwrap();
+    let bert_opt = classifier.lock().unwrap();
     match &*bert_opt {
-        Some(classifier) => match classifier.classify_text(text) {
-            Ok((class_idx, confidence)) => ClassificationResult {
+        Some(classifier) => classify_text_with(classifier, text),
+        None => {
+            eprintln!("BERT classifier not initialized");
+            default_result
+        }
+    }
+}
+
+// Classify text with the given classifier model
+fn classify_text_with(classifier: &BertClassifier, text: &str) -> ClassificationResult {
+    match classifier.classify_text(text) {
+        Ok((class_idx, confidence, runner_up)) => {
+            let (runner_up_class, runner_up_confidence) = match runner_up {
+                Some((idx, prob)) => (idx as i32, prob),
+                None => (-1, 0.0),
+            };
+            ClassificationResult {
                 class: class_idx as i32,
                 confidence,
-            },
-            Err(e) => {
-                eprintln!("Error classifying text: {}", e);
-                default_result
+                runner_up_class,
+                runner_up_confidence,
             }
-        },
+        }
+        Err(e) => {
+            eprintln!("Error classifying text: {}", e);
+            ClassificationResult {
+                class: -1,
+                confidence: 0.0,
+                runner_up_class: -1,
+                runner_up_confidence: 0.0,
+            }
+        }
+    }
+} 
+
+// Read a C string argument, None when it is null or not UTF-8
+fn c_str<'a>(s: *const c_char) -> Option<&'a str> {
+    if s.is_null() {
+        return None;
+    }
+    unsafe { CStr::from_ptr(s).to_str().ok() }
+}
+
+// Read an array of C string arguments, None when any is invalid
+fn c_strs<'a>(ptr: *const *const c_char, count: i32) -> Option<Vec<&'a str>> {
+    if ptr.is_null() || count <= 0 {
+        return None;
+    }
+    let slice = unsafe { std::slice::from_raw_parts(ptr, count as usize) };
+    slice.iter().map(|&s| c_str(s)).collect()
+}
+
+// Look up a similarity model of the pool by name
+fn pool_similarity_model(name: *const c_char) -> Option<Arc<BertSimilarity>> {
+    let name = c_str(name)?;
+    let model = SIMILARITY_POOL.lock().unwrap().get(name).cloned();
+    if model.is_none() {
+        eprintln!("Similarity model {} not in the model pool", name);
+    }
+    model
+}
+
+// Load a similarity model into the pool under a name, replacing the model of
+// that name (called from Go). Models load outside the pool's lock, so several
+// can load at once.
+#[no_mangle]
+pub extern "C" fn init_pool_similarity_model(name: *const c_char, model_id: *const c_char, use_cpu: bool) -> bool {
+    let (name, model_id) = match (c_str(name), c_str(model_id)) {
+        (Some(name), Some(model_id)) => (name, model_id),
+        _ => return false,
+    };
+
+    match BertSimilarity::new(model_id, use_cpu) {
+        Ok(model) => {
+            SIMILARITY_POOL.lock().unwrap().insert(name.to_string(), Arc::new(model));
+            true
+        }
+        Err(e) => {
+            eprintln!("Failed to initialize pool model {}: {}", name, e);
+            false
+        }
+    }
+}
+
+// Load a classifier into the pool under a name, replacing the classifier of
+// that name (called from Go)
+#[no_mangle]
+pub extern "C" fn init_pool_classifier(name: *const c_char, model_id: *const c_char, num_classes: i32, use_cpu: bool) -> bool {
+    let (name, model_id) = match (c_str(name), c_str(model_id)) {
+        (Some(name), Some(model_id)) => (name, model_id),
+        _ => return false,
+    };
+
+    if num_classes < 2 {
+        eprintln!("Number of classes must be at least 2, got {}", num_classes);
+        return false;
+    }
+
+    match BertClassifier::new(model_id, num_classes as usize, use_cpu) {
+        Ok(classifier) => {
+            CLASSIFIER_POOL.lock().unwrap().insert(name.to_string(), Arc::new(classifier));
+            true
+        }
+        Err(e) => {
+            eprintln!("Failed to initialize pool classifier {}: {}", name, e);
+            false
+        }
+    }
+}
+
+// Get the embeddings of several texts with a model of the pool (called from
+// Go). The data is freed with free_embedding(data, rows * cols).
+#[no_mangle]
+pub extern "C" fn get_pool_text_embeddings(
+    name: *const c_char,
+    texts_ptr: *const *const c_char,
+    num_texts: i32,
+    max_length: i32
+) -> EmbeddingMatrixResult {
+    let failed = EmbeddingMatrixResult { data: std::ptr::null_mut(), rows: 0, cols: 0, error: true };
+    let texts = match c_strs(texts_ptr, num_texts) {
+        Some(texts) => texts,
+        None => return failed,
+    };
+    match pool_similarity_model(name) {
+        Some(bert) => embeddings_with(&bert, &texts, max_length),
+        None => failed,
+    }
+}
+
+// Find the most similar text from a list with a model of the pool (called from Go)
+#[no_mangle]
+pub extern "C" fn find_most_similar_pool(
+    name: *const c_char,
+    query: *const c_char,
+    candidates_ptr: *const *const c_char,
+    num_candidates: i32,
+    max_length: i32
+) -> SimilarityResult {
+    let failed = SimilarityResult { index: -1, score: -1.0 };
+    let (query, candidates) = match (c_str(query), c_strs(candidates_ptr, num_candidates)) {
+        (Some(query), Some(candidates)) => (query, candidates),
+        _ => return failed,
+    };
+    match pool_similarity_model(name) {
+        Some(bert) => most_similar_with(&bert, query, &candidates, max_length),
+        None => failed,
+    }
+}
+
+// Find the most similar of candidates embedded beforehand by a model of the
+// pool, given as a row-major num_candidates x dim matrix (called from Go)
+#[no_mangle]
+pub extern "C" fn find_most_similar_embedding_pool(
+    name: *const c_char,
+    query: *const c_char,
+    candidate_embeddings: *const f32,
+    num_candidates: i32,
+    dim: i32,
+    max_length: i32
+) -> SimilarityResult {
+    let failed = SimilarityResult { index: -1, score: -1.0 };
+    if candidate_embeddings.is_null() || num_candidates <= 0 || dim <= 0 {
+        return failed;
+    }
+    let query = match c_str(query) {
+        Some(query) => query,
+        None => return failed,
+    };
+    let data = unsafe { std::slice::from_raw_parts(candidate_embeddings, (num_candidates * dim) as usize) };
+    match pool_similarity_model(name) {
+        Some(bert) => most_similar_embedding_with(&bert, query, data, num_candidates, dim, max_length),
+        None => failed,
+    }
+}
+
+// Classify text with a classifier of the pool (called from Go)
+#[no_mangle]
+pub extern "C" fn classify_pool_text(name: *const c_char, text: *const c_char) -> ClassificationResult {
+    let failed = ClassificationResult {
+        class: -1,
+        confidence: 0.0,
+        runner_up_class: -1,
+        runner_up_confidence: 0.0,
+    };
+    let (name, text) = match (c_str(name), c_str(text)) {
+        (Some(name), Some(text)) => (name, text),
+        _ => return failed,
+    };
+    let classifier = CLASSIFIER_POOL.lock().unwrap().get(name).cloned();
+    match classifier {
+        Some(classifier) => classify_text_with(&classifier, text),
         None => {
-            eprintln!("BERT classifier not initialized");
-            default_result
+            eprintln!("Classifier {} not in the model pool", name);
+            failed
         }
     }
-} 
\ No newline at end of file
+}
+
+impl BertTokenClassifier {
+    // Loads a BertForTokenClassification model, whose config.json names the label of each class in id2label
+    pub fn new(model_id: &str, use_cpu: bool) -> Result<Self> {
+        let device = if use_cpu {
+            Device::Cpu
+        } else {
+            Device::cuda_if_available(0)?
+        };
+
+        println!("Initializing token classifier model: {}", model_id);
+
+        let (config_filename, tokenizer_filename, weights_filename, use_pth) = if Path::new(model_id).exists() {
+            // Local model path
+            println!("Loading model from local directory: {}", model_id);
+            let weights_path = if Path::new(model_id).join("model.safetensors").exists() {
+                (Path::new(model_id).join("model.safetensors").to_string_lossy().to_string(), false)
+            } else if Path::new(model_id).join("pytorch_model.bin").exists() {
+                (Path::new(model_id).join("pytorch_model.bin").to_string_lossy().to_string(), true)
+            } else {
+                return Err(E::msg(format!("No model weights found in {}", model_id)));
+            };
+
+            (
+                Path::new(model_id).join("config.json").to_string_lossy().to_string(),
+                Path::new(model_id).join("tokenizer.json").to_string_lossy().to_string(),
+                weights_path.0,
+                weights_path.1
+            )
+        } else {
+            // HuggingFace Hub model
+            println!("Loading model from HuggingFace Hub: {}", model_id);
+            let repo = Repo::with_revision(
+                model_id.to_string(),
+                RepoType::Model,
+                "main".to_string(),
+            );
+
+            let api = Api::new()?;
+            let api = api.repo(repo);
+            let config = api.get("config.json")?;
+            let tokenizer = api.get("tokenizer.json")?;
+
+            // Try safetensors first, fall back to PyTorch
+            let (weights, use_pth) = match api.get("model.safetensors") {
+                Ok(weights) => (weights, false),
+                Err(_) => {
+                    println!("Safetensors model not found, trying PyTorch model instead...");
+                    (api.get("pytorch_model.bin")?, true)
+                }
+            };
+
+            (
+                config.to_string_lossy().to_string(),
+                tokenizer.to_string_lossy().to_string(),
+                weights.to_string_lossy().to_string(),
+                use_pth
+            )
+        };
+
+        let config_json = std::fs::read_to_string(config_filename)?;
+        let mut config: Config = serde_json::from_str(&config_json)?;
+        let tokenizer = Tokenizer::from_file(tokenizer_filename).map_err(E::msg)?;
+
+        // The labels of the classes, indexed by class
+        let raw_config: serde_json::Value = serde_json::from_str(&config_json)?;
+        let id2label = raw_config["id2label"]
+            .as_object()
+            .ok_or_else(|| E::msg("Token classifier config has no id2label"))?;
+        let mut labels = vec![String::new(); id2label.len()];
+        for (id, label) in id2label {
+            let idx: usize = id.parse().map_err(|_| E::msg(format!("Invalid class index in id2label: {}", id)))?;
+            if idx >= labels.len() {
+                return Err(E::msg(format!("Class index {} out of range in id2label", idx)));
+            }
+            labels[idx] = label.as_str().unwrap_or_default().to_string();
+        }
+        if labels.len() < 2 {
+            return Err(E::msg(format!("Number of labels must be at least 2, got {}", labels.len())));
+        }
+
+        // Use approximate GELU for better performance
+        config.hidden_act = HiddenAct::GeluApproximate;
+
+        let vb = if use_pth {
+            VarBuilder::from_pth(&weights_filename, DTYPE, &device)?
+        } else {
+            unsafe { VarBuilder::from_mmaped_safetensors(&[weights_filename], DTYPE, &device)? }
+        };
+
+        // The encoder weights are under "bert.", which BertModel falls back to by model_type
+        let model = BertModel::load(vb.clone(), &config)?;
+        let classification_head = candle_nn::linear(config.hidden_size, labels.len(), vb.pp("classifier"))?;
+        println!("Successfully loaded token classifier with {} labels", labels.len());
+
+        Ok(Self {
+            model,
+            tokenizer,
+            classification_head,
+            labels,
+            device,
+        })
+    }
+
+    // Returns the label, byte offsets and probability of each token not labelled outside ("O").
+    // Texts longer than max_length tokens are classified in overlapping windows, so tokens
+    // in the overlap are returned once per window.
+    pub fn classify_tokens(&self, text: &str, max_length: usize) -> Result<Vec<(String, usize, usize, f32)>> {
+        let mut tokenizer = self.tokenizer.clone();
+        tokenizer.with_truncation(Some(TruncationParams {
+            max_length,
+            strategy: TruncationStrategy::LongestFirst,
+            stride: max_length / 4,
+            direction: TruncationDirection::Right,
+        })).map_err(E::msg)?;
+
+        let encoding = tokenizer.encode(text, true).map_err(E::msg)?;
+        let mut windows = vec![encoding.clone()];
+        windows.extend(encoding.get_overflowing().iter().cloned());
+
+        let mut results = Vec::new();
+        for window in windows {
+            let token_ids = window.get_ids().to_vec();
+            let attention_mask = window.get_attention_mask().to_vec();
+            let token_ids_tensor = Tensor::new(&token_ids[..], &self.device)?.unsqueeze(0)?;
+            let token_type_ids = token_ids_tensor.zeros_like()?;
+            let attention_mask_tensor = Tensor::new(&attention_mask[..], &self.device)?.unsqueeze(0)?;
+
+            // Run the text through BERT and classify every token
+            let hidden_states = self.model.forward(&token_ids_tensor, &token_type_ids, Some(&attention_mask_tensor))?;
+            let logits = self.classification_head.forward(&hidden_states)?;
+            let probabilities = candle_nn::ops::softmax_last_dim(&logits.to_dtype(DType::F32)?)?
+                .squeeze(0)?
+                .to_vec2::<f32>()?;
+
+            let offsets = window.get_offsets();
+            let special_tokens = window.get_special_tokens_mask();
+            for (idx, token_probabilities) in probabilities.iter().enumerate() {
+                if special_tokens[idx] == 1 || attention_mask[idx] == 0 {
+                    continue;
+                }
+                let (class, &probability) = token_probabilities.iter()
+                    .enumerate()
+                    .max_by(|(_, a), (_, b)| a.partial_cmp(b).unwrap_or(std::cmp::Ordering::Equal))
+                    .unwrap_or((0, &0.0));
+                let label = &self.labels[class];
+                if label == "O" {
+                    continue;
+                }
+                let (start, end) = offsets[idx];
+                results.push((label.clone(), start, end, probability));
+            }
+        }
+        Ok(results)
+    }
+}
+
+// Label predicted for one token of a text, with its byte offsets in the text
+#[repr(C)]
+pub struct TokenLabel {
+    pub label: *mut c_char,
+    pub start: i32,
+    pub end: i32,
+    pub confidence: f32,
+}
+
+// Labels of the tokens of a text not labelled outside
+#[repr(C)]
+pub struct TokenClassificationResult {
+    pub labels: *mut TokenLabel,
+    pub count: i32,
+    pub error: bool,
+}
+
+// Initialize the BERT token classifier model (called from Go)
+#[no_mangle]
+pub extern "C" fn init_token_classifier(model_id: *const c_char, use_cpu: bool) -> bool {
+    let model_id = unsafe {
+        match CStr::from_ptr(model_id).to_str() {
+            Ok(s) => s,
+            Err(_) => return false,
+        }
+    };
+
+    match BertTokenClassifier::new(model_id, use_cpu) {
+        Ok(classifier) => {
+            let mut bert_opt = BERT_TOKEN_CLASSIFIER.lock().unwrap();
+            *bert_opt = Some(classifier);
+            true
+        }
+        Err(e) => {
+            eprintln!("Failed to initialize BERT token classifier: {}", e);
+            false
+        }
+    }
+}
+
+// Classify the tokens of a text using BERT (called from Go)
+#[no_mangle]
+pub extern "C" fn classify_tokens(text: *const c_char, max_length: i32) -> TokenClassificationResult {
+    let error_result = TokenClassificationResult {
+        labels: std::ptr::null_mut(),
+        count: 0,
+        error: true,
+    };
+
+    let text = unsafe {
+        match CStr::from_ptr(text).to_str() {
+            Ok(s) => s,
+            Err(_) => return error_result,
+        }
+    };
+
+    let bert_opt = BERT_TOKEN_CLASSIFIER.lock().unwrap();
+    let classifier = match &*bert_opt {
+        Some(classifier) => classifier,
+        None => {
+            eprintln!("BERT token classifier not initialized");
+            return error_result;
+        }
+    };
+
+    match classifier.classify_tokens(text, max_length.max(16) as usize) {
+        Ok(tokens) => {
+            let mut labels: Vec<TokenLabel> = tokens
+                .into_iter()
+                .map(|(label, start, end, confidence)| TokenLabel {
+                    label: CString::new(label).unwrap_or_default().into_raw(),
+                    start: start as i32,
+                    end: end as i32,
+                    confidence,
+                })
+                .collect();
+            labels.shrink_to_fit();
+            let count = labels.len() as i32;
+            let ptr = labels.as_mut_ptr();
+            std::mem::forget(labels);
+            TokenClassificationResult {
+                labels: ptr,
+                count,
+                error: false,
+            }
+        }
+        Err(e) => {
+            eprintln!("Error classifying tokens: {}", e);
+            error_result
+        }
+    }
+}
+
+// Free the memory allocated for a token classification result (called from Go)
+#[no_mangle]
+pub extern "C" fn free_token_classification_result(result: TokenClassificationResult) {
+    if result.labels.is_null() || result.count <= 0 {
+        return;
+    }
+    unsafe {
+        let labels = Vec::from_raw_parts(result.labels, result.count as usize, result.count as usize);
+        for label in labels {
+            if !label.label.is_null() {
+                let _ = CString::from_raw(label.label);
+            }
+        }
+    }
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/receipt"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s verify|receipt [flags] [args...]\n\n"+
+			"Commands:\n"+
+			"  verify   Check the signatures of sealed decision records and decrypt them\n"+
+			"  receipt  Check the signatures of routing receipts and print them\n", os.Args[0])
+	}
+	flag.Parse()
+	switch flag.Arg(0) {
+	case "verify":
+		os.Exit(verify(flag.Args()[1:]))
+	case "receipt":
+		os.Exit(verifyReceipts(flag.Args()[1:]))
+	}
+	flag.Usage()
+	os.Exit(2)
+}
+
+// verifyReceipts checks routing receipts with the key named in the config,
+// printing each as a JSON line, and returns the exit code
+func verifyReceipts(args []string) int {
+	fs := flag.NewFlagSet("receipt", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "Router config naming the environment variable holding the key")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: receipt [flags] receipts...\n\nExits non-zero if any receipt fails to verify.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.RoutingReceipts.SigningKeyEnv == "" {
+		log.Fatalf("routing_receipts.signing_key_env is not set in %s", *configPath)
+	}
+	key, err := receipt.LoadKey(cfg.RoutingReceipts.SigningKeyEnv)
+	if err != nil {
+		log.Fatalf("Failed to load key: %v", err)
+	}
+	code := 0
+	for _, encoded := range fs.Args() {
+		r, err := receipt.Verify(encoded, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", encoded, err)
+			code = 1
+			continue
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			log.Fatalf("Failed to encode receipt: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+	}
+	return code
+}
+
+// verify checks every sealed record in the logs with the keys named in the
+// config, returning the exit code
+func verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		configPath   = fs.String("config", "config/config.yaml", "Router config naming the environment variables holding the keys")
+		printRecords = fs.Bool("print", false, "Print the opened records as JSON lines, e.g. for the confusion tool")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: verify [flags] [router log files...]\n\nReads stdin when no files are given. "+
+			"Exits non-zero if any record fails to verify or decrypt.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	keys, err := decision.LoadKeys(cfg.DecisionRecords.EncryptionKeyEnv, cfg.DecisionRecords.SigningKeyEnv)
+	if err != nil {
+		log.Fatalf("Failed to load keys: %v", err)
+	}
+	sealer, err := decision.NewSealer(keys)
+	if err != nil {
+		log.Fatalf("Invalid keys (decision_records.encryption_key_env and signing_key_env in %s): %v", *configPath, err)
+	}
+
+	v := verifier{sealer: sealer, print: *printRecords}
+	if fs.NArg() == 0 {
+		v.read(os.Stdin, "stdin")
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", path, err)
+		}
+		v.read(f, path)
+		f.Close()
+	}
+
+	fmt.Fprintf(os.Stderr, "%d records verified, %d failed, %d unsealed\n", v.verified, v.failed, v.unsealed)
+	if v.failed > 0 || (keys.Signing != nil && v.unsealed > 0) {
+		return 1
+	}
+	return 0
+}
+
+// verifier opens the sealed records of router logs, counting the outcomes
+type verifier struct {
+	sealer                     *decision.Sealer
+	print                      bool
+	verified, failed, unsealed int
+}
+
+// read opens the sealed records of a log. Records logged unsealed are
+// counted, as they are unsigned.
+func (v *verifier) read(r io.Reader, name string) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.Contains(line, decision.LogPrefix) {
+			v.unsealed++
+			continue
+		}
+		i := strings.Index(line, decision.SealedLogPrefix)
+		if i < 0 {
+			continue
+		}
+		record, err := v.open(line[i+len(decision.SealedLogPrefix):])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", name, n, err)
+			v.failed++
+			continue
+		}
+		v.verified++
+		if v.print {
+			data, err := decision.MarshalJSON(record)
+			if err != nil {
+				log.Fatalf("Failed to encode record: %v", err)
+			}
+			fmt.Printf("%s\n", data)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read %s: %v", name, err)
+	}
+}
+
+func (v *verifier) open(data string) (*decision.DecisionRecord, error) {
+	var sealed decision.SealedRecord
+	if err := json.Unmarshal([]byte(data), &sealed); err != nil {
+		return nil, fmt.Errorf("invalid sealed record: %w", err)
+	}
+	return v.sealer.Open(&sealed)
+}
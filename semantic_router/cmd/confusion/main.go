@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+)
+
+// recordPrefix precedes decision records in the router log
+const recordPrefix = "decision_record "
+
+func main() {
+	var (
+		feedback = flag.String("feedback", "", "JSON lines file of feedback corrections, {\"request_id\":...,\"category\":...}")
+		margin   = flag.Float64("margin", 0.1, "Confidence margin over the runner-up below which a request counts as confused")
+		examples = flag.Int("examples", 3, "Example requests shown per pair")
+		top      = flag.Int("top", 20, "Number of pairs shown, 0 for all")
+		asJSON   = flag.Bool("json", false, "Print the pairs as JSON instead of a report")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [decision record log files...]\n\nReads stdin when no files are given.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var records []*decision.DecisionRecord
+	if flag.NArg() == 0 {
+		records = readRecords(os.Stdin, "stdin")
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", path, err)
+		}
+		records = append(records, readRecords(f, path)...)
+		f.Close()
+	}
+
+	var corrections []decision.Correction
+	if *feedback != "" {
+		var err error
+		corrections, err = readCorrections(*feedback)
+		if err != nil {
+			log.Fatalf("Failed to read feedback: %v", err)
+		}
+	}
+
+	pairs := decision.AnalyzeConfusion(records, corrections, decision.ConfusionOptions{
+		MarginThreshold: float32(*margin),
+		MaxExamples:     *examples,
+	})
+	if *top > 0 && len(pairs) > *top {
+		pairs = pairs[:*top]
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(pairs); err != nil {
+			log.Fatalf("Failed to encode pairs: %v", err)
+		}
+		return
+	}
+	report(pairs, len(records), len(corrections))
+}
+
+// readRecords reads decision records from JSON lines, either bare or in router
+// log lines, skipping anything else
+func readRecords(r io.Reader, name string) []*decision.DecisionRecord {
+	var records []*decision.DecisionRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	skipped := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, recordPrefix); i >= 0 {
+			line = line[i+len(recordPrefix):]
+		}
+		if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+			continue
+		}
+		record, err := decision.UnmarshalJSON([]byte(line))
+		if err != nil {
+			skipped++
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read %s: %v", name, err)
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d invalid decision records in %s", skipped, name)
+	}
+	return records
+}
+
+// readCorrections reads feedback corrections from a JSON lines file
+func readCorrections(path string) ([]decision.Correction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var corrections []decision.Correction
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var correction decision.Correction
+		if err := json.Unmarshal([]byte(line), &correction); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		corrections = append(corrections, correction)
+	}
+	return corrections, scanner.Err()
+}
+
+func report(pairs []decision.ConfusionPair, records, corrections int) {
+	fmt.Printf("\n%d decision records, %d feedback corrections\n\n", records, corrections)
+	if len(pairs) == 0 {
+		fmt.Println("No confused category pairs found")
+		return
+	}
+	fmt.Printf("%-40s %8s %10s %11s %11s\n", "categories", "total", "low margin", "corrections", "mean margin")
+	for _, pair := range pairs {
+		fmt.Printf("%-40s %8d %10d %11d %11.3f\n",
+			pair.Categories[0]+" / "+pair.Categories[1], pair.Total(), pair.LowMargin, pair.Corrections, pair.MeanMargin)
+	}
+
+	for _, pair := range pairs {
+		if len(pair.Examples) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s / %s\n", pair.Categories[0], pair.Categories[1])
+		for _, example := range pair.Examples {
+			prompt := example.Prompt
+			if prompt == "" {
+				prompt = "(no prompt excerpt recorded)"
+			}
+			fmt.Printf("  %s [%s] routed %s, confused with %s, margin %.3f: %q\n",
+				example.RequestID, example.Source, example.Routed, example.Alternative, example.Margin, prompt)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Command coordinator runs the optional fleet coordinator that router replicas
+// sync quota consumption and endpoint health with (coordinator.address in config.yaml).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/coordinator"
+)
+
+func main() {
+	var (
+		port              = flag.Int("port", 50061, "Port to listen on")
+		window            = flag.Duration("window", time.Minute, "Length of the fixed quota windows")
+		replicaTTL        = flag.Duration("replica-ttl", 30*time.Second, "How long a replica counts as live after its last sync")
+		unhealthyReplicas = flag.Int("unhealthy-replicas", 1, "Replicas that must report an endpoint unhealthy before the fleet avoids it")
+	)
+	flag.Parse()
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Fatalf("Failed to listen on port %d: %v", *port, err)
+	}
+
+	server := grpc.NewServer()
+	coordinator.RegisterCoordinatorServer(server, coordinator.NewServer(coordinator.ServerOptions{
+		Window:            *window,
+		ReplicaTTL:        *replicaTTL,
+		UnhealthyReplicas: *unhealthyReplicas,
+	}))
+
+	go func() {
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		<-signalChan
+		log.Println("Received shutdown signal, stopping coordinator...")
+		server.GracefulStop()
+	}()
+
+	log.Printf("Starting fleet coordinator on port %d (window %s, replica TTL %s)", *port, *window, *replicaTTL)
+	if err := server.Serve(lis); err != nil {
+		log.Fatalf("Coordinator error: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Scenario names, each a realistic Envoy message sequence
+const (
+	scenarioRouted      = "routed"
+	scenarioPassthrough = "passthrough"
+	scenarioStreaming   = "streaming"
+)
+
+// prompts are sampled for request bodies so classification and cache lookups see varied input
+var prompts = []struct {
+	system string
+	user   string
+}{
+	{"You are a professional math teacher.", "What is the derivative of f(x) = x^3 + 2x^2 - 5x + 7?"},
+	{"You are a story writer.", "Write a short story about a space cat."},
+	{"You are a helpful assistant.", "What is the capital of France?"},
+	{"You are a legal assistant.", "Is a verbal agreement legally binding?"},
+	{"You are a chemistry tutor.", "Balance the equation H2 + O2 -> H2O."},
+	{"You are a history expert.", "What caused the fall of the Roman Empire?"},
+}
+
+const responseBody = `{"id":"chatcmpl-loadgen","object":"chat.completion","created":1,"model":"loadgen","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":24,"completion_tokens":8,"total_tokens":32}}`
+
+// result is the outcome of a single simulated request
+type result struct {
+	scenario string
+	latency  time.Duration
+	err      error
+	cacheHit bool
+}
+
+func main() {
+	var (
+		addr        = flag.String("addr", "localhost:50051", "Address of the ext_proc server")
+		concurrency = flag.Int("concurrency", 200, "Number of concurrent streams")
+		requests    = flag.Int("requests", 10000, "Total requests to send; ignored when -duration is set")
+		duration    = flag.Duration("duration", 0, "Run for this long instead of a fixed number of requests")
+		mix         = flag.String("mix", "routed=6,passthrough=3,streaming=1", "Weighted scenario mix")
+		timeout     = flag.Duration("timeout", 10*time.Second, "Per-request timeout")
+		seed        = flag.Int64("seed", 1, "Random seed, fixed so runs are reproducible")
+	)
+	flag.Parse()
+
+	scenarios, err := parseMix(*mix)
+	if err != nil {
+		log.Fatalf("Invalid scenario mix: %v", err)
+	}
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to connect to %s: %v", *addr, err)
+	}
+	defer conn.Close()
+	client := ext_proc.NewExternalProcessorClient(conn)
+
+	log.Printf("Running load against %s with %d concurrent streams", *addr, *concurrency)
+
+	var issued int64
+	deadline := time.Time{}
+	if *duration > 0 {
+		deadline = time.Now().Add(*duration)
+	}
+	next := func() bool {
+		if !deadline.IsZero() {
+			return time.Now().Before(deadline)
+		}
+		return atomic.AddInt64(&issued, 1) <= int64(*requests)
+	}
+
+	results := make(chan result, *concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(*seed + int64(worker)))
+			for n := 0; next(); n++ {
+				scenario := scenarios[rng.Intn(len(scenarios))]
+				ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+				requestID := fmt.Sprintf("loadgen-%d-%d", worker, n)
+				res := runScenario(ctx, client, scenario, requestID, rng)
+				cancel()
+				results <- res
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	report(results, start)
+}
+
+// parseMix expands a weighted mix such as "routed=6,passthrough=3" into a list to sample from
+func parseMix(mix string) ([]string, error) {
+	var scenarios []string
+	for _, part := range strings.Split(mix, ",") {
+		name, weightStr, found := strings.Cut(strings.TrimSpace(part), "=")
+		weight := 1
+		if found {
+			if _, err := fmt.Sscanf(weightStr, "%d", &weight); err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight for %s: %q", name, weightStr)
+			}
+		}
+		switch name {
+		case scenarioRouted, scenarioPassthrough, scenarioStreaming:
+		default:
+			return nil, fmt.Errorf("unknown scenario %q", name)
+		}
+		for i := 0; i < weight; i++ {
+			scenarios = append(scenarios, name)
+		}
+	}
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("no scenarios selected")
+	}
+	return scenarios, nil
+}
+
+// runScenario plays one request through the message sequence Envoy would send,
+// stopping early if the server answers with an immediate response
+func runScenario(ctx context.Context, client ext_proc.ExternalProcessorClient, scenario, requestID string, rng *rand.Rand) (res result) {
+	res.scenario = scenario
+	start := time.Now()
+	defer func() { res.latency = time.Since(start) }()
+
+	stream, err := client.Process(ctx)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer stream.CloseSend()
+
+	model := "auto"
+	if scenario == scenarioPassthrough {
+		model = "loadgen-model"
+	}
+	prompt := prompts[rng.Intn(len(prompts))]
+	body, _ := json.Marshal(map[string]interface{}{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": prompt.system},
+			{"role": "user", "content": prompt.user},
+		},
+		"temperature": 0.7,
+		"stream":      scenario == scenarioStreaming,
+	})
+
+	sequence := []*ext_proc.ProcessingRequest{
+		headersMessage(true, map[string]string{
+			":method":      "POST",
+			":path":        "/v1/chat/completions",
+			"content-type": "application/json",
+			"x-request-id": requestID,
+		}),
+		bodyMessage(true, body, true),
+		headersMessage(false, map[string]string{":status": "200", "content-type": "application/json"}),
+	}
+	if scenario == scenarioStreaming {
+		// Split the upstream response into chunks as a streamed completion would arrive
+		resp := []byte(responseBody)
+		for i := 0; i < len(resp); i += 64 {
+			end := i + 64
+			if end > len(resp) {
+				end = len(resp)
+			}
+			sequence = append(sequence, bodyMessage(false, resp[i:end], end == len(resp)))
+		}
+	} else {
+		sequence = append(sequence, bodyMessage(false, []byte(responseBody), true))
+	}
+
+	for _, msg := range sequence {
+		if err := stream.Send(msg); err != nil {
+			res.err = err
+			return res
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				res.err = err
+			}
+			return res
+		}
+		if resp.GetImmediateResponse() != nil {
+			res.cacheHit = true
+			return res
+		}
+	}
+	return res
+}
+
+func headersMessage(request bool, headers map[string]string) *ext_proc.ProcessingRequest {
+	headerMap := &core.HeaderMap{}
+	for k, v := range headers {
+		headerMap.Headers = append(headerMap.Headers, &core.HeaderValue{Key: k, RawValue: []byte(v)})
+	}
+	h := &ext_proc.HttpHeaders{Headers: headerMap}
+	if request {
+		return &ext_proc.ProcessingRequest{Request: &ext_proc.ProcessingRequest_RequestHeaders{RequestHeaders: h}}
+	}
+	return &ext_proc.ProcessingRequest{Request: &ext_proc.ProcessingRequest_ResponseHeaders{ResponseHeaders: h}}
+}
+
+func bodyMessage(request bool, body []byte, endOfStream bool) *ext_proc.ProcessingRequest {
+	b := &ext_proc.HttpBody{Body: body, EndOfStream: endOfStream}
+	if request {
+		return &ext_proc.ProcessingRequest{Request: &ext_proc.ProcessingRequest_RequestBody{RequestBody: b}}
+	}
+	return &ext_proc.ProcessingRequest{Request: &ext_proc.ProcessingRequest_ResponseBody{ResponseBody: b}}
+}
+
+// report collects results and prints latency percentiles and error rates per scenario
+func report(results <-chan result, start time.Time) {
+	latencies := make(map[string][]time.Duration)
+	errors := make(map[string]int)
+	cacheHits := make(map[string]int)
+	errorSamples := make(map[string]string)
+	total := 0
+
+	for res := range results {
+		total++
+		latencies[res.scenario] = append(latencies[res.scenario], res.latency)
+		latencies["all"] = append(latencies["all"], res.latency)
+		if res.err != nil {
+			errors[res.scenario]++
+			errors["all"]++
+			if _, ok := errorSamples[res.err.Error()]; !ok && len(errorSamples) < 5 {
+				errorSamples[res.err.Error()] = res.scenario
+			}
+		}
+		if res.cacheHit {
+			cacheHits[res.scenario]++
+			cacheHits["all"]++
+		}
+	}
+	elapsed := time.Since(start)
+	if total == 0 {
+		fmt.Println("\nno results")
+		return
+	}
+
+	fmt.Printf("\n%d requests in %s (%.1f req/s)\n\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+	fmt.Printf("%-12s %8s %8s %8s %10s %10s %10s %10s\n", "scenario", "count", "errors", "hits", "p50", "p90", "p99", "max")
+
+	names := make([]string, 0, len(latencies))
+	for name := range latencies {
+		if name != "all" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append(names, "all")
+
+	for _, name := range names {
+		l := latencies[name]
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		fmt.Printf("%-12s %8d %7.2f%% %8d %10s %10s %10s %10s\n",
+			name, len(l), 100*float64(errors[name])/float64(len(l)), cacheHits[name],
+			percentile(l, 0.50), percentile(l, 0.90), percentile(l, 0.99), l[len(l)-1].Round(time.Microsecond))
+	}
+
+	for msg, scenario := range errorSamples {
+		fmt.Printf("\nsample error (%s): %s", scenario, msg)
+	}
+	if len(errorSamples) > 0 {
+		fmt.Println()
+	}
+}
+
+// percentile returns the q-th percentile of sorted latencies
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(q * float64(len(sorted)-1))
+	return sorted[idx].Round(time.Microsecond)
+}
@@ -1,48 +1,58 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
 	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/extproc"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
 	// Parse command-line flags
 	var (
-		configPath  = flag.String("config", "config/config.yaml", "Path to the configuration file")
-		port        = flag.Int("port", 50051, "Port to listen on")
-		metricsPort = flag.Int("metrics-port", 9190, "Port for Prometheus metrics")
+		configPath   = flag.String("config", "config/config.yaml", "Path to the configuration file")
+		port         = flag.Int("port", 50051, "Port to listen on when the config has no listeners")
+		metricsPort  = flag.Int("metrics-port", 9190, "Port for Prometheus metrics when the config sets no metrics.port")
+		validateOnly = flag.Bool("validate-only", false, "Print every violation of the config and exit, non-zero if there are any")
 	)
 	flag.Parse()
 
 	// Check if config file exists
 	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
-		log.Fatalf("Config file not found: %s", *configPath)
+		slog.Error("Config file not found", "path", *configPath)
+		os.Exit(1)
 	}
 
-	// Start metrics server
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		metricsAddr := fmt.Sprintf(":%d", *metricsPort)
-		log.Printf("Starting metrics server on %s", metricsAddr)
-		if err := http.ListenAndServe(metricsAddr, nil); err != nil {
-			log.Printf("Metrics server error: %v", err)
+	if *validateOnly {
+		if _, err := config.ValidateConfig(*configPath); err != nil {
+			var validationErr *config.ValidationError
+			if !errors.As(err, &validationErr) {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+				os.Exit(1)
+			}
+			for _, v := range validationErr.Violations {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", *configPath, v)
+			}
+			os.Exit(1)
 		}
-	}()
+		fmt.Printf("%s: OK\n", *configPath)
+		return
+	}
 
 	// Create and start the server
-	server, err := extproc.NewServer(*configPath, *port)
+	server, err := extproc.NewServer(*configPath, *port, *metricsPort)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		slog.Error("Failed to create server", "error", err)
+		os.Exit(1)
 	}
 
-	log.Printf("Starting LLM Semantic Router ExtProc with config: %s", *configPath)
+	slog.Info("Starting LLM Semantic Router ExtProc", "config", *configPath)
 	if err := server.Start(); err != nil {
-		log.Fatalf("Server error: %v", err)
+		slog.Error("Server error", "error", err)
+		os.Exit(1)
 	}
 }
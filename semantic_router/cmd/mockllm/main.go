@@ -0,0 +1,63 @@
+// Command mockllm serves mock OpenAI chat completions, for local development
+// and load tests without a real model backend, e.g. as the vllm_backend of
+// config/envoy.yaml.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/mockllm"
+)
+
+func main() {
+	var (
+		addr          = flag.String("addr", ":11434", "Address to listen on")
+		models        = flag.String("models", "", "Comma-separated models served; any model when empty")
+		latency       = flag.Duration("latency", 0, "Time before a response starts")
+		jitter        = flag.Duration("jitter", 0, "Random extra latency, up to this long")
+		chunkInterval = flag.Duration("chunk-interval", 20*time.Millisecond, "Time between the chunks of streamed responses")
+		errorRate     = flag.Float64("error-rate", 0, "Fraction of requests answered with -error-status")
+		errorStatus   = flag.Int("error-status", http.StatusServiceUnavailable, "Status of injected errors")
+		response      = flag.String("response", "", "Content of every answer; answers echo the last user message when empty")
+		seed          = flag.Uint64("seed", 0, "Seed of the injected errors and jitter, random when 0")
+	)
+	flag.Parse()
+
+	options := mockllm.Options{
+		Latency:       *latency,
+		Jitter:        *jitter,
+		ChunkInterval: *chunkInterval,
+		ErrorRate:     *errorRate,
+		ErrorStatus:   *errorStatus,
+		Response:      *response,
+		Seed:          *seed,
+	}
+	if *models != "" {
+		options.Models = strings.Split(*models, ",")
+	}
+	server := &http.Server{Addr: *addr, Handler: mockllm.New(options)}
+
+	go func() {
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		<-signalChan
+		log.Println("Received shutdown signal, stopping mock server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	log.Printf("Serving mock chat completions on %s", *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Mock server error: %v", err)
+	}
+}
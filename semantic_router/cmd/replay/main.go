@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/extproc"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/replay"
+)
+
+func main() {
+	var (
+		configPath = flag.String("config", "config/config.yaml", "Path to the router configuration file")
+		repeat     = flag.Int("repeat", 1, "Times each recording is replayed, to benchmark the router")
+		quiet      = flag.Bool("quiet", false, "Only report recordings whose responses differ")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <recording files or directories...>\n\n"+
+			"Replays recorded ext_proc streams through a router built from the config and\n"+
+			"compares its responses with the recorded ones, ignoring dynamic metadata.\n"+
+			"Exits non-zero when any recording's responses differ.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || *repeat < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	paths, err := replay.Paths(flag.Args())
+	if err != nil {
+		log.Fatalf("Failed to list recordings: %v", err)
+	}
+	router, err := extproc.NewOpenAIRouter(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+	// Replayed streams are not recorded again
+	router.Recordings = nil
+
+	differing := 0
+	var durations []time.Duration
+	for _, path := range paths {
+		rec, err := replay.Load(path)
+		if err != nil {
+			log.Fatalf("Failed to load recording: %v", err)
+		}
+		var diffs []string
+		for i := 0; i < *repeat; i++ {
+			start := time.Now()
+			responses, err := replay.Replay(context.Background(), router, rec)
+			durations = append(durations, time.Since(start))
+			if err != nil {
+				diffs = []string{fmt.Sprintf("replay failed: %v", err)}
+				break
+			}
+			if i == 0 {
+				diffs = replay.Compare(rec.Responses, responses)
+			}
+		}
+		if len(diffs) > 0 {
+			differing++
+			fmt.Printf("%s: DIFFERS\n", path)
+			for _, diff := range diffs {
+				fmt.Printf("  %s\n", diff)
+			}
+		} else if !*quiet {
+			fmt.Printf("%s: OK\n", path)
+		}
+	}
+
+	if len(durations) > 0 {
+		slices.Sort(durations)
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+		fmt.Printf("%d recordings, %d differing; %d replays, mean %s, p50 %s, p99 %s\n", len(paths), differing,
+			len(durations), total/time.Duration(len(durations)), durations[len(durations)/2], durations[len(durations)*99/100])
+	}
+	if differing > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+)
+
+func main() {
+	var (
+		groupBy      = flag.String("group-by", "tenant,model,day", "Comma-separated dimensions: tenant, model, category, application, day or label:<name>")
+		identity     = flag.String("identity", "", "Dimension identifying individuals, e.g. label:user; each request is one when empty")
+		minGroupSize = flag.Int("min-group-size", 10, "Groups with fewer individuals are suppressed")
+		epsilon      = flag.Float64("epsilon", 0, "Privacy budget of the Laplace noise added to each statistic, 0 for no noise")
+		maxTokens    = flag.Int64("max-request-tokens", 8192, "Tokens a request contributes to noised token sums at most")
+		configPath   = flag.String("config", "", "Router config naming the environment variables holding the keys of sealed records")
+		format       = flag.String("format", "json", "Output format: json or csv")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [router log files...]\n\n"+
+			"Exports the usage of decision records aggregated for analytics, suppressing groups\n"+
+			"too small to hide individuals. Reads stdin when no files are given.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *format != "json" && *format != "csv" {
+		log.Fatalf("Unknown format %q: must be json or csv", *format)
+	}
+
+	var sealer *decision.Sealer
+	if *configPath != "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		keys, err := decision.LoadKeys(cfg.DecisionRecords.EncryptionKeyEnv, cfg.DecisionRecords.SigningKeyEnv)
+		if err != nil {
+			log.Fatalf("Failed to load keys: %v", err)
+		}
+		if sealer, err = decision.NewSealer(keys); err != nil {
+			log.Fatalf("Invalid keys: %v", err)
+		}
+	}
+
+	var records []*decision.DecisionRecord
+	read := func(f *os.File, name string) {
+		read, skipped, err := decision.ReadLog(f, sealer)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if skipped > 0 {
+			log.Printf("Skipped %d unreadable decision records in %s", skipped, name)
+		}
+		records = append(records, read...)
+	}
+	if flag.NArg() == 0 {
+		read(os.Stdin, "stdin")
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", path, err)
+		}
+		read(f, path)
+		f.Close()
+	}
+
+	var dimensions []string
+	for _, dimension := range strings.Split(*groupBy, ",") {
+		if dimension = strings.TrimSpace(dimension); dimension != "" {
+			dimensions = append(dimensions, dimension)
+		}
+	}
+	report, err := decision.AggregateUsage(records, decision.UsageOptions{
+		GroupBy:          dimensions,
+		Identity:         *identity,
+		MinGroupSize:     *minGroupSize,
+		Epsilon:          *epsilon,
+		MaxRequestTokens: *maxTokens,
+	})
+	if err != nil {
+		log.Fatalf("Invalid flags: %v", err)
+	}
+	log.Printf("%d decision records, %d groups exported, %d suppressed", len(records), len(report.Groups), report.SuppressedGroups)
+
+	if *format == "csv" {
+		writeCSV(report)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("Failed to encode report: %v", err)
+	}
+}
+
+// writeCSV prints a row per group, the dimensions followed by the statistics
+func writeCSV(report decision.UsageReport) {
+	w := csv.NewWriter(os.Stdout)
+	w.Write(append(append([]string{}, report.GroupBy...), "requests", "prompt_tokens", "completion_tokens"))
+	for _, group := range report.Groups {
+		row := make([]string, 0, len(report.GroupBy)+3)
+		for _, dimension := range report.GroupBy {
+			row = append(row, group.Key[dimension])
+		}
+		row = append(row, strconv.FormatInt(group.Requests, 10), strconv.FormatInt(group.PromptTokens, 10),
+			strconv.FormatInt(group.CompletionTokens, 10))
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalf("Failed to write CSV: %v", err)
+	}
+}
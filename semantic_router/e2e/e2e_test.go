@@ -0,0 +1,164 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/mockllm"
+)
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		content   string
+		wantModel string
+	}{
+		{"math", "auto", "What is the derivative of x cubed?", "math-model"},
+		{"cooking", "auto", "How long do I boil an egg for?", "cooking-model"},
+		{"explicit model", "general-model", "What is the integral of x cubed?", "general-model"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestID := fmt.Sprintf("routing-%d", i)
+			resp, body := post(t, chatRequest(tt.model, tt.content, false), "x-request-id", requestID)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			received := harness.upstream.RequestsWithHeader("x-request-id", requestID)
+			if len(received) != 1 {
+				t.Fatalf("upstream received %d requests, want 1", len(received))
+			}
+			if received[0].Model != tt.wantModel {
+				t.Errorf("upstream received model %s, want %s", received[0].Model, tt.wantModel)
+			}
+			if model := gjson.GetBytes(body, "model").String(); model != tt.wantModel {
+				t.Errorf("response from model %s, want %s", model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestSemanticCache(t *testing.T) {
+	request := chatRequest("general-model", "What is the capital of France?", false)
+	resp, first := post(t, request, "x-request-id", "cache-0")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, first)
+	}
+	if resp.Header.Get("x-cache-hit") != "" {
+		t.Fatal("first request answered from the cache")
+	}
+
+	// Responses are stored asynchronously
+	deadline := time.Now().Add(10 * time.Second)
+	for i := 1; ; i++ {
+		requestID := fmt.Sprintf("cache-%d", i)
+		resp, body := post(t, request, "x-request-id", requestID)
+		if resp.Header.Get("x-cache-hit") == "true" {
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("cached response status %d", resp.StatusCode)
+			}
+			if !strings.HasPrefix(gjson.GetBytes(body, "id").String(), "chatcmpl-mock-") {
+				t.Errorf("cached response is not a stored completion: %s", body)
+			}
+			if received := harness.upstream.RequestsWithHeader("x-request-id", requestID); len(received) != 0 {
+				t.Errorf("cache hit sent %d requests upstream", len(received))
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("response never answered from the cache")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	resp, body := post(t, chatRequest("general-model", "Tell me a story", true), "x-request-id", "stream-0")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Errorf("content type %q, want text/event-stream", contentType)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("stream does not end with [DONE]:\n%s", body)
+	}
+	var content strings.Builder
+	for _, line := range strings.Split(string(body), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok && data != "[DONE]" {
+			content.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+		}
+	}
+	if content.String() != "Answer to: Tell me a story" {
+		t.Errorf("streamed content %q:\n%s", content.String(), body)
+	}
+}
+
+func TestHeaderMutations(t *testing.T) {
+	resp, body := post(t, chatRequest("auto", "Solve the equation 3x + 1 = 10", false),
+		"x-request-id", "headers-0",
+		// Clients can't spoof the decision headers
+		"x-semantic-router-model", "spoofed-model", "x-semantic-router-category", "spoofed")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	received := harness.upstream.RequestsWithHeader("x-request-id", "headers-0")
+	if len(received) != 1 {
+		t.Fatalf("upstream received %d requests, want 1", len(received))
+	}
+	for _, headers := range []http.Header{received[0].Header, resp.Header} {
+		if model := headers.Get("x-semantic-router-model"); model != "math-model" {
+			t.Errorf("x-semantic-router-model = %q, want math-model", model)
+		}
+		if category := headers.Get("x-semantic-router-category"); category != "math" {
+			t.Errorf("x-semantic-router-category = %q, want math", category)
+		}
+		if headers.Get("x-semantic-router-score") == "" {
+			t.Error("x-semantic-router-score missing")
+		}
+	}
+	// The rewritten body must still be well formed
+	if gjson.GetBytes(received[0].Body, "model").String() != "math-model" || !gjson.ValidBytes(received[0].Body) {
+		t.Errorf("upstream received a bad body: %s", received[0].Body)
+	}
+	if length := received[0].Header.Get("Content-Length"); length != "" && length != fmt.Sprint(len(received[0].Body)) {
+		t.Errorf("content-length %s of a %d byte body", length, len(received[0].Body))
+	}
+}
+
+func TestErrorPaths(t *testing.T) {
+	t.Run("upstream error", func(t *testing.T) {
+		resp, body := post(t, chatRequest("general-model", "Hello", false), "x-request-id", "errors-0", mockllm.StatusHeader, "503")
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want 503", resp.StatusCode)
+		}
+		if gjson.GetBytes(body, "error.type").String() != "server_error" {
+			t.Errorf("upstream error body lost: %s", body)
+		}
+		// Errors are not cached
+		resp, _ = post(t, chatRequest("general-model", "Hello", false), "x-request-id", "errors-1", mockllm.StatusHeader, "503")
+		if resp.Header.Get("x-cache-hit") != "" {
+			t.Error("error answered from the cache")
+		}
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		// The router rejects the stream and Envoy, failing open, forwards the
+		// request unprocessed
+		resp, body := post(t, `{"model":`, "x-request-id", "errors-2")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status %d, want the upstream's 400: %s", resp.StatusCode, body)
+		}
+		if gjson.GetBytes(body, "error.type").String() != "invalid_request_error" {
+			t.Errorf("unexpected body: %s", body)
+		}
+	})
+}
@@ -0,0 +1,220 @@
+//go:build e2e
+
+// Package e2e tests the router end to end: requests go over HTTP through a
+// real Envoy, running in Docker with the ext_proc filter, to a mock OpenAI
+// upstream, with the router processing them over gRPC. It catches wire-level
+// regressions the unit tests with fake streams can't, and needs the candle
+// library, the BERT model and Docker:
+//
+//	make test-e2e
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/extproc"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/mockllm"
+)
+
+// envoyImage is the Envoy image the tests run, overridden with E2E_ENVOY_IMAGE
+const envoyImage = "envoyproxy/envoy:v1.31-latest"
+
+// harness is the Envoy, router and upstream every test sends requests through
+var harness *testHarness
+
+type testHarness struct {
+	// URL of Envoy's listener
+	url      string
+	upstream *mockllm.Server
+	// Server of the upstream
+	upstreamServer *http.Server
+	router         *extproc.Server
+	// Name of the Envoy container
+	container string
+}
+
+func TestMain(m *testing.M) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		log.Print("Skipping the end-to-end tests: docker not found")
+		os.Exit(0)
+	}
+	h, err := startHarness()
+	if err != nil {
+		if h != nil {
+			h.stop()
+		}
+		log.Fatalf("Failed to start the end-to-end harness: %v", err)
+	}
+	harness = h
+	code := m.Run()
+	h.stop()
+	os.Exit(code)
+}
+
+// startHarness starts the mock upstream, the router and Envoy, and waits for
+// Envoy to be ready
+func startHarness() (*testHarness, error) {
+	ports, err := freePorts(4)
+	if err != nil {
+		return nil, err
+	}
+	params := struct{ RouterPort, UpstreamPort, ListenerPort, AdminPort int }{ports[0], ports[1], ports[2], ports[3]}
+	dir, err := os.MkdirTemp("", "semantic-router-e2e")
+	if err != nil {
+		return nil, err
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := render("testdata/config.yaml.tmpl", configPath, params); err != nil {
+		return nil, err
+	}
+	if err := render("testdata/envoy.yaml.tmpl", filepath.Join(dir, "envoy.yaml"), params); err != nil {
+		return nil, err
+	}
+
+	h := &testHarness{url: fmt.Sprintf("http://127.0.0.1:%d", params.ListenerPort)}
+	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", params.UpstreamPort))
+	if err != nil {
+		return h, err
+	}
+	h.upstream = mockllm.New(mockllm.Options{})
+	h.upstreamServer = &http.Server{Handler: h.upstream}
+	go h.upstreamServer.Serve(lis)
+	if h.router, err = extproc.NewServer(configPath, params.RouterPort, 0); err != nil {
+		return h, fmt.Errorf("failed to create router: %w", err)
+	}
+	go func() {
+		if err := h.router.Start(); err != nil {
+			log.Printf("Router stopped: %v", err)
+		}
+	}()
+
+	image := envoyImage
+	if override := os.Getenv("E2E_ENVOY_IMAGE"); override != "" {
+		image = override
+	}
+	// The host network lets Envoy reach the router and upstream on loopback
+	h.container = fmt.Sprintf("semantic-router-e2e-%d", os.Getpid())
+	out, err := exec.Command("docker", "run", "--rm", "--detach", "--network", "host",
+		"--name", h.container, "--volume", dir+":/etc/e2e:ro",
+		image, "--config-path", "/etc/e2e/envoy.yaml").CombinedOutput()
+	if err != nil {
+		h.container = ""
+		return h, fmt.Errorf("failed to start envoy: %v: %s", err, out)
+	}
+	if err := waitReady(fmt.Sprintf("http://127.0.0.1:%d/ready", params.AdminPort), time.Minute); err != nil {
+		return h, fmt.Errorf("envoy not ready: %w", err)
+	}
+	return h, nil
+}
+
+func (h *testHarness) stop() {
+	if h.container != "" {
+		if os.Getenv("E2E_ENVOY_LOGS") != "" {
+			out, _ := exec.Command("docker", "logs", h.container).CombinedOutput()
+			log.Printf("Envoy logs:\n%s", out)
+		}
+		exec.Command("docker", "rm", "--force", h.container).Run()
+	}
+	if h.router != nil {
+		h.router.Stop()
+	}
+	if h.upstreamServer != nil {
+		h.upstreamServer.Close()
+	}
+}
+
+// render executes a template file into a file
+func render(name, path string, data any) error {
+	tmpl, err := template.ParseFiles(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tmpl.Execute(f, data)
+}
+
+// freePorts returns loopback ports nothing listens on
+func freePorts(n int) ([]int, error) {
+	ports := make([]int, 0, n)
+	for range n {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		defer lis.Close()
+		ports = append(ports, lis.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
+
+// waitReady polls a URL until it answers 200
+func waitReady(url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// post sends a chat completion request through Envoy, header names and
+// values alternating in headers
+func post(t *testing.T, body string, headers ...string) (*http.Response, []byte) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, harness.url+"/v1/chat/completions", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read the response: %v", err)
+	}
+	return resp, data
+}
+
+// chatRequest returns the body of a chat completion request
+func chatRequest(model, content string, stream bool) string {
+	body, _ := json.Marshal(map[string]any{
+		"model":    model,
+		"stream":   stream,
+		"messages": []map[string]string{{"role": "user", "content": content}},
+	})
+	return string(body)
+}
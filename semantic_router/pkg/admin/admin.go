@@ -0,0 +1,379 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/debugstore"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/discovery"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/fingerprint"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/flags"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/recommend"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/reuseport"
+)
+
+// spec is the OpenAPI specification of the admin API, served at /openapi.yaml
+//
+//go:embed openapi.yaml
+var spec []byte
+
+// Options holds options for creating a new admin server
+type Options struct {
+	// Port to listen on
+	Port int
+	// Address of the interface to listen on, localhost when empty
+	Address string
+	// Bearer token required by every endpoint but the /health and /readyz
+	// probes; empty requires none
+	Token string
+	// Bind the port with SO_REUSEPORT, so a restarted router can bind it
+	// while the previous process drains
+	ReusePort bool
+	// Runtime pipeline stage flags managed through the API
+	Flags *flags.Flags
+	// Build, config and artifact fingerprint of this replica
+	Fingerprint *fingerprint.Fingerprint
+	// Captured request traces, nil when tracing is disabled
+	Traces *debugstore.Store
+	// Candidate categories clustered from unrouted traffic, nil when discovery is disabled
+	Discovery *discovery.Discoverer
+	// Health checks by dimension, reported at /health
+	Health map[string]HealthCheck
+	// Returns why the router cannot serve requests yet, nil once it can;
+	// checked at /readyz. Nil is always ready.
+	Ready func() error
+	// Semantic cache listed and flushed through the API, nil when there is none
+	Cache *cache.SemanticCache
+	// Returns the config serving new requests, reported at /routing
+	Config func() *config.RouterConfig
+	// Recent decision records, nil when none are kept
+	Decisions *decision.RingSink
+	// Learned default models of applications, nil when application learning is disabled
+	Recommender *recommend.Recommender
+	// Returns the circuit breaker state of each model, nil when the circuit
+	// breaker is disabled
+	Circuits func() []breaker.Circuit
+	// Returns up to limit of the recent error responses of model backends,
+	// newest first, or all of them when limit <= 0; nil when none are kept
+	UpstreamErrors func(limit int) []UpstreamError
+	// Applies feedback of a feedback.Kind on a recent request; nil when
+	// routing feedback is disabled
+	RoutingFeedback func(requestID, kind string) error
+	// Serve the gRPC channelz data of the process under /debug/channelz
+	Channelz bool
+	// Classifies texts and requests as the router would, served at
+	// /api/v1/classify; nil when unavailable
+	Classify Classifier
+}
+
+// HealthCheck reports whether a health dimension is healthy and, if not, why
+type HealthCheck func() (healthy bool, detail string)
+
+// Server is the router's admin HTTP API, served on its own port
+type Server struct {
+	options  Options
+	server   *http.Server
+	channelz channelzgrpc.ChannelzServer
+}
+
+// NewServer creates a new admin server with the given options
+func NewServer(options Options) *Server {
+	s := &Server{options: options}
+	if options.Channelz {
+		s.channelz = newChannelz()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /flags", s.handleListFlags)
+	mux.HandleFunc("PUT /flags/{stage}", s.handleSetFlag)
+	mux.HandleFunc("GET /rollouts", s.handleListRollouts)
+	mux.HandleFunc("PUT /rollouts/{stage}", s.handleSetRollout)
+	mux.HandleFunc("DELETE /rollouts/{stage}", s.handleClearRollout)
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("GET /fingerprint", s.handleFingerprint)
+	mux.HandleFunc("GET /discovery/candidates", s.handleListCandidates)
+	mux.HandleFunc("GET /cache/entries", s.handleListCacheEntries)
+	mux.HandleFunc("DELETE /cache/entries", s.handleFlushCache)
+	mux.HandleFunc("GET /cache/pending", s.handleListPending)
+	mux.HandleFunc("GET /routing", s.handleRoutingTable)
+	mux.HandleFunc("POST /routing/feedback", s.handleRoutingFeedback)
+	mux.HandleFunc("GET /decisions/recent", s.handleRecentDecisions)
+	mux.HandleFunc("GET /decisions/prompt-lengths", s.handlePromptLengths)
+	mux.HandleFunc("GET /circuits", s.handleListCircuits)
+	mux.HandleFunc("GET /upstream/errors", s.handleListUpstreamErrors)
+	mux.HandleFunc("GET /applications/recommendations", s.handleListRecommendations)
+	mux.HandleFunc("POST /applications/feedback", s.handleApplicationFeedback)
+	mux.HandleFunc("GET /debug/traces", s.handleListTraces)
+	mux.HandleFunc("GET /debug/traces/{requestID}", s.handleGetTrace)
+	mux.HandleFunc("GET /debug/channelz/servers", s.handleChannelzServers)
+	mux.HandleFunc("GET /debug/channelz/servers/{id}/sockets", s.handleChannelzServerSockets)
+	mux.HandleFunc("GET /debug/channelz/sockets/{id}", s.handleChannelzSocket)
+	mux.HandleFunc("GET /debug/channelz/channels", s.handleChannelzChannels)
+	mux.HandleFunc("GET /debug/channelz/subchannels/{id}", s.handleChannelzSubchannel)
+	mux.HandleFunc("POST /api/v1/classify", s.handleClassify)
+	mux.HandleFunc("GET /openapi.yaml", s.handleSpec)
+	address := options.Address
+	if address == "" {
+		address = "127.0.0.1"
+	}
+	s.server = &http.Server{
+		Addr:              net.JoinHostPort(address, strconv.Itoa(options.Port)),
+		Handler:           s.authorize(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start listens on the admin port and serves the API in the background
+func (s *Server) Start() error {
+	listen := net.Listen
+	if s.options.ReusePort {
+		listen = reuseport.Listen
+	}
+	lis, err := listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address %s: %w", s.server.Addr, err)
+	}
+	log.Printf("Starting admin API on %s", s.server.Addr)
+	go func() {
+		if err := s.server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Admin API error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop shuts down the admin server
+func (s *Server) Stop(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("Error stopping admin API: %v", err)
+	}
+}
+
+// authorize requires the bearer token, if any, on every endpoint but the probes
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.options.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.options.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" && r.URL.Path != "/readyz" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// flagRequest is the body of a flag update
+type flagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (s *Server) handleListFlags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.options.Flags.Snapshot())
+}
+
+func (s *Server) handleSetFlag(w http.ResponseWriter, r *http.Request) {
+	stage := r.PathValue("stage")
+	var req flagRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, `expected a body like {"enabled": false}`)
+		return
+	}
+	if err := s.options.Flags.Set(stage, *req.Enabled); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Printf("Admin API set pipeline stage %s enabled=%v (from %s)", stage, *req.Enabled, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, s.options.Flags.Snapshot())
+}
+
+// rolloutRequest is the body of a rollout update
+type rolloutRequest struct {
+	StartPercent        float64 `json:"start_percent"`
+	TargetPercent       float64 `json:"target_percent"`
+	RampDurationSeconds int     `json:"ramp_duration_seconds"`
+}
+
+// rolloutStatus describes a rollout in API responses
+type rolloutStatus struct {
+	StartPercent        float64   `json:"start_percent"`
+	TargetPercent       float64   `json:"target_percent"`
+	RampStart           time.Time `json:"ramp_start"`
+	RampDurationSeconds int       `json:"ramp_duration_seconds"`
+	CurrentPercent      float64   `json:"current_percent"`
+}
+
+func (s *Server) handleListRollouts(w http.ResponseWriter, r *http.Request) {
+	rollouts := make(map[string]rolloutStatus)
+	for stage, rollout := range s.options.Flags.Rollouts() {
+		rollouts[stage] = rolloutStatus{
+			StartPercent:        rollout.StartPercent,
+			TargetPercent:       rollout.TargetPercent,
+			RampStart:           rollout.RampStart,
+			RampDurationSeconds: int(rollout.RampDuration / time.Second),
+			CurrentPercent:      rollout.CurrentPercent,
+		}
+	}
+	writeJSON(w, http.StatusOK, rollouts)
+}
+
+func (s *Server) handleSetRollout(w http.ResponseWriter, r *http.Request) {
+	stage := r.PathValue("stage")
+	var req rolloutRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, `expected a body like {"start_percent": 5, "target_percent": 100, "ramp_duration_seconds": 3600}`)
+		return
+	}
+	err := s.options.Flags.SetRollout(stage, flags.Rollout{
+		StartPercent:  req.StartPercent,
+		TargetPercent: req.TargetPercent,
+		RampDuration:  time.Duration(req.RampDurationSeconds) * time.Second,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Admin API set rollout for pipeline stage %s (from %s)", stage, r.RemoteAddr)
+	s.handleListRollouts(w, r)
+}
+
+func (s *Server) handleClearRollout(w http.ResponseWriter, r *http.Request) {
+	stage := r.PathValue("stage")
+	s.options.Flags.ClearRollout(stage)
+	log.Printf("Admin API cleared rollout for pipeline stage %s (from %s)", stage, r.RemoteAddr)
+	s.handleListRollouts(w, r)
+}
+
+// Health statuses
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// healthStatus describes the router's health in API responses
+type healthStatus struct {
+	Status     string                     `json:"status"`
+	Dimensions map[string]dimensionStatus `json:"dimensions"`
+}
+
+// dimensionStatus describes a single health dimension
+type dimensionStatus struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// handleHealth reports each health dimension. A degraded router still serves
+// requests, so the response is 200 either way.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := healthStatus{Status: HealthOK, Dimensions: make(map[string]dimensionStatus, len(s.options.Health))}
+	for dimension, check := range s.options.Health {
+		healthy, detail := check()
+		status := dimensionStatus{Status: HealthOK, Detail: detail}
+		if !healthy {
+			status.Status = HealthDegraded
+			health.Status = HealthDegraded
+		}
+		health.Dimensions[dimension] = status
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// Readiness statuses
+const (
+	ReadinessReady    = "ready"
+	ReadinessNotReady = "not_ready"
+)
+
+// readiness describes whether the router can serve requests in API responses
+type readiness struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// handleReady reports whether the router can serve requests, with 503 until
+// it can, for readiness probes
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.options.Ready != nil {
+		if err := s.options.Ready(); err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, readiness{Status: ReadinessNotReady, Detail: err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, readiness{Status: ReadinessReady})
+}
+
+func (s *Server) handleFingerprint(w http.ResponseWriter, r *http.Request) {
+	if s.options.Fingerprint == nil {
+		writeError(w, http.StatusNotFound, "fingerprint not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.options.Fingerprint)
+}
+
+func (s *Server) handleListCandidates(w http.ResponseWriter, r *http.Request) {
+	candidates := s.options.Discovery.Candidates()
+	if candidates == nil {
+		candidates = []discovery.Candidate{}
+	}
+	writeJSON(w, http.StatusOK, candidates)
+}
+
+func (s *Server) handleListTraces(w http.ResponseWriter, r *http.Request) {
+	traces := s.options.Traces.List()
+	if traces == nil {
+		traces = []*debugstore.Trace{}
+	}
+	writeJSON(w, http.StatusOK, traces)
+}
+
+func (s *Server) handleGetTrace(w http.ResponseWriter, r *http.Request) {
+	trace, ok := s.options.Traces.Get(r.PathValue("requestID"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "no trace captured for request")
+		return
+	}
+	writeJSON(w, http.StatusOK, trace)
+}
+
+func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(spec); err != nil {
+		log.Printf("Error writing admin API spec: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing admin API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/fingerprint"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/flags"
+)
+
+func TestFlagsAPI(t *testing.T) {
+	stageFlags, _ := flags.New(flags.Options{})
+	handler := NewServer(Options{Flags: stageFlags}).Handler()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"list", http.MethodGet, "/flags", "", http.StatusOK},
+		{"disable cache", http.MethodPut, "/flags/cache", `{"enabled": false}`, http.StatusOK},
+		{"unknown stage", http.MethodPut, "/flags/translation", `{"enabled": false}`, http.StatusNotFound},
+		{"missing enabled", http.MethodPut, "/flags/cache", `{}`, http.StatusBadRequest},
+		{"wrong method", http.MethodPost, "/flags/cache", `{"enabled": true}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	if stageFlags.Enabled(flags.StageCache) {
+		t.Error("expected the cache stage to be disabled through the API")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/flags", nil))
+	var state map[string]bool
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if state[flags.StageCache] || !state[flags.StageClassification] {
+		t.Errorf("unexpected flag state: %v", state)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	stageFlags, _ := flags.New(flags.Options{})
+	handler := NewServer(Options{Flags: stageFlags, Token: "s3cret", Ready: func() error { return nil }}).Handler()
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantStatus    int
+	}{
+		{"valid token", "/flags", "Bearer s3cret", http.StatusOK},
+		{"missing token", "/flags", "", http.StatusUnauthorized},
+		{"wrong token", "/flags", "Bearer guess", http.StatusUnauthorized},
+		{"token without scheme", "/flags", "s3cret", http.StatusUnauthorized},
+		{"health probe", "/health", "", http.StatusOK},
+		{"readiness probe", "/readyz", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestListensOnLocalhostByDefault(t *testing.T) {
+	if addr := NewServer(Options{Port: 8081}).server.Addr; addr != "127.0.0.1:8081" {
+		t.Errorf("address = %q, want 127.0.0.1:8081", addr)
+	}
+	if addr := NewServer(Options{Port: 8081, Address: "::"}).server.Addr; addr != "[::]:8081" {
+		t.Errorf("address = %q, want [::]:8081", addr)
+	}
+}
+
+func TestRolloutsAPI(t *testing.T) {
+	stageFlags, _ := flags.New(flags.Options{})
+	handler := NewServer(Options{Flags: stageFlags}).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/rollouts/cache",
+		strings.NewReader(`{"start_percent": 0, "target_percent": 0}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if stageFlags.Applies(flags.StageCache, "req-1") {
+		t.Error("expected the cache stage to apply to no traffic")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/rollouts/cache", strings.NewReader(`{"target_percent": 101}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/rollouts/cache", nil))
+	if rec.Code != http.StatusOK || !stageFlags.Applies(flags.StageCache, "req-1") {
+		t.Errorf("expected the rollout to be cleared, status %d", rec.Code)
+	}
+}
+
+func TestFingerprintAPI(t *testing.T) {
+	stageFlags, _ := flags.New(flags.Options{})
+
+	rec := httptest.NewRecorder()
+	NewServer(Options{Flags: stageFlags}).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fingerprint", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without fingerprint = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	handler := NewServer(Options{Flags: stageFlags, Fingerprint: &fingerprint.Fingerprint{
+		Version:    "v1.2.3",
+		ConfigHash: "abc",
+		Models:     []fingerprint.Artifact{{Name: "classifier", ID: "models/classifier", SHA256: "def"}},
+	}}).Handler()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fingerprint", nil))
+	var got fingerprint.Fingerprint
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if got.Version != "v1.2.3" || got.ConfigHash != "abc" || len(got.Models) != 1 || got.Models[0].SHA256 != "def" {
+		t.Errorf("unexpected fingerprint: %+v", got)
+	}
+}
+
+func TestHealthAPI(t *testing.T) {
+	healthy := false
+	handler := NewServer(Options{Health: map[string]HealthCheck{
+		"classifier": func() (bool, string) {
+			if healthy {
+				return true, ""
+			}
+			return false, "safe mode"
+		},
+		"cache": func() (bool, string) { return true, "" },
+	}}).Handler()
+
+	get := func() healthStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var got healthStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		return got
+	}
+
+	got := get()
+	if got.Status != HealthDegraded || got.Dimensions["classifier"] != (dimensionStatus{Status: HealthDegraded, Detail: "safe mode"}) ||
+		got.Dimensions["cache"].Status != HealthOK {
+		t.Errorf("unexpected degraded health: %+v", got)
+	}
+
+	healthy = true
+	if got := get(); got.Status != HealthOK || got.Dimensions["classifier"].Status != HealthOK {
+		t.Errorf("unexpected recovered health: %+v", got)
+	}
+}
+
+func TestReadyAPI(t *testing.T) {
+	var notReady error = errors.New("models are not loaded")
+	handler := NewServer(Options{Ready: func() error { return notReady }}).Handler()
+
+	get := func() (int, readiness) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var got readiness
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		return rec.Code, got
+	}
+
+	if code, got := get(); code != http.StatusServiceUnavailable || got != (readiness{Status: ReadinessNotReady, Detail: "models are not loaded"}) {
+		t.Errorf("not ready: %d %+v", code, got)
+	}
+	notReady = nil
+	if code, got := get(); code != http.StatusOK || got.Status != ReadinessReady {
+		t.Errorf("ready: %d %+v", code, got)
+	}
+}
+
+func TestSpecServed(t *testing.T) {
+	stageFlags, _ := flags.New(flags.Options{})
+	handler := NewServer(Options{Flags: stageFlags}).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	var doc struct {
+		Paths map[string]map[string]interface{} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	// Every route of the API must be documented
+	routes := []string{
+		"GET /flags", "PUT /flags/{stage}",
+		"GET /rollouts", "PUT /rollouts/{stage}", "DELETE /rollouts/{stage}",
+		"GET /health", "GET /readyz", "GET /fingerprint", "GET /discovery/candidates",
+		"GET /cache/entries", "DELETE /cache/entries", "GET /cache/pending",
+		"GET /routing", "POST /routing/feedback", "GET /decisions/recent", "GET /decisions/prompt-lengths", "GET /circuits",
+		"GET /upstream/errors",
+		"GET /applications/recommendations", "POST /applications/feedback",
+		"GET /debug/traces", "GET /debug/traces/{requestID}",
+		"GET /debug/channelz/servers", "GET /debug/channelz/servers/{id}/sockets", "GET /debug/channelz/sockets/{id}",
+		"GET /debug/channelz/channels", "GET /debug/channelz/subchannels/{id}",
+		"POST /api/v1/classify", "GET /openapi.yaml",
+	}
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %s is missing from the spec", route)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/recommend"
+)
+
+// feedbackRequest is the body of an application feedback update
+type feedbackRequest struct {
+	RequestID string `json:"request_id"`
+	Positive  *bool  `json:"positive"`
+}
+
+// enabledRecommender returns the recommender, writing an error if application
+// learning is disabled
+func (s *Server) enabledRecommender(w http.ResponseWriter) *recommend.Recommender {
+	if s.options.Recommender == nil {
+		writeError(w, http.StatusNotFound, "application learning disabled")
+		return nil
+	}
+	return s.options.Recommender
+}
+
+func (s *Server) handleListRecommendations(w http.ResponseWriter, r *http.Request) {
+	recommender := s.enabledRecommender(w)
+	if recommender == nil {
+		return
+	}
+	var recommendations []recommend.Recommendation
+	if s.options.Config != nil {
+		recommendations = recommender.Recommendations(s.options.Config().Applications)
+	}
+	if recommendations == nil {
+		recommendations = []recommend.Recommendation{}
+	}
+	writeJSON(w, http.StatusOK, recommendations)
+}
+
+func (s *Server) handleApplicationFeedback(w http.ResponseWriter, r *http.Request) {
+	recommender := s.enabledRecommender(w)
+	if recommender == nil {
+		return
+	}
+	var req feedbackRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.RequestID == "" || req.Positive == nil {
+		writeError(w, http.StatusBadRequest, `expected a body like {"request_id": "...", "positive": true}`)
+		return
+	}
+	if err := recommender.Feedback(req.RequestID, *req.Positive); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, recommend.ErrUnknownRequest) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/recommend"
+)
+
+func TestApplicationsAPI(t *testing.T) {
+	if status := serve(t, NewServer(Options{}).Handler(), http.MethodGet, "/applications/recommendations", nil); status != http.StatusNotFound {
+		t.Errorf("status with learning disabled = %d, want %d", status, http.StatusNotFound)
+	}
+
+	recommender := recommend.New(recommend.Options{MinRequests: 1})
+	record := decision.New("req-1")
+	record.Routing.Application = "coder"
+	record.Routing.SelectedModel = "phi4"
+	record.ResponseStatus = 200
+	recommender.Write(record)
+	cfg := &config.RouterConfig{Applications: []config.ApplicationConfig{{Name: "coder", SystemPromptPrefix: "You code"}}}
+	handler := NewServer(Options{
+		Recommender: recommender,
+		Config:      func() *config.RouterConfig { return cfg },
+	}).Handler()
+
+	feedback := func(body string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/applications/feedback", strings.NewReader(body)))
+		return rec.Code
+	}
+	if status := feedback(`{"request_id":"req-1","positive":true}`); status != http.StatusNoContent {
+		t.Errorf("feedback status = %d, want %d", status, http.StatusNoContent)
+	}
+	if status := feedback(`{"request_id":"req-9","positive":true}`); status != http.StatusNotFound {
+		t.Errorf("feedback on an unknown request status = %d, want %d", status, http.StatusNotFound)
+	}
+	if status := feedback(`{"request_id":"req-1"}`); status != http.StatusBadRequest {
+		t.Errorf("feedback without positive status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	var recommendations []recommend.Recommendation
+	if status := serve(t, handler, http.MethodGet, "/applications/recommendations", &recommendations); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(recommendations) != 1 || recommendations[0].Models[0].PositiveFeedback != 1 || recommendations[0].Models[0].Score == 0 {
+		t.Errorf("unexpected recommendations: %+v", recommendations)
+	}
+}
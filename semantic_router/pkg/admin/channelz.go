@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// channelzRegistrar captures grpc-go's channelz service as it registers, so
+// the admin API can query it in process rather than over gRPC
+type channelzRegistrar struct {
+	server channelzgrpc.ChannelzServer
+}
+
+func (r *channelzRegistrar) RegisterService(_ *grpc.ServiceDesc, impl any) {
+	r.server = impl.(channelzgrpc.ChannelzServer)
+}
+
+// newChannelz returns the channelz service reporting on the gRPC servers and
+// client connections of the process. Importing it turns channelz data
+// collection on.
+func newChannelz() channelzgrpc.ChannelzServer {
+	var registrar channelzRegistrar
+	service.RegisterChannelzServiceToServer(&registrar)
+	return registrar.server
+}
+
+// channelzPage parses the optional start_id and limit query parameters of
+// channelz listings, which return entities with IDs from start_id on
+func channelzPage(r *http.Request) (startID int64, limit int64, ok bool) {
+	query := r.URL.Query()
+	if value := query.Get("start_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 0 {
+			return 0, 0, false
+		}
+		startID = id
+	}
+	l, err := queryLimit(r)
+	return startID, int64(l), err == nil
+}
+
+// channelzID parses the ID path parameter of a channelz entity
+func channelzID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 0 {
+		writeError(w, http.StatusBadRequest, "id must be a non-negative integer")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeChannelz writes a channelz response as JSON with its proto field names
+func writeChannelz(w http.ResponseWriter, response proto.Message, err error) {
+	if status.Code(err) == codes.NotFound {
+		writeError(w, http.StatusNotFound, status.Convert(err).Message())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, json.RawMessage(data))
+}
+
+// enabledChannelz returns the channelz service, writing an error if it is disabled
+func (s *Server) enabledChannelz(w http.ResponseWriter) channelzgrpc.ChannelzServer {
+	if s.channelz == nil {
+		writeError(w, http.StatusNotFound, "channelz disabled")
+		return nil
+	}
+	return s.channelz
+}
+
+func (s *Server) handleChannelzServers(w http.ResponseWriter, r *http.Request) {
+	channelz := s.enabledChannelz(w)
+	if channelz == nil {
+		return
+	}
+	startID, limit, ok := channelzPage(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "start_id and limit must be non-negative integers")
+		return
+	}
+	response, err := channelz.GetServers(context.Background(), &channelzgrpc.GetServersRequest{StartServerId: startID, MaxResults: limit})
+	writeChannelz(w, response, err)
+}
+
+func (s *Server) handleChannelzServerSockets(w http.ResponseWriter, r *http.Request) {
+	channelz := s.enabledChannelz(w)
+	if channelz == nil {
+		return
+	}
+	id, ok := channelzID(w, r)
+	if !ok {
+		return
+	}
+	startID, limit, ok := channelzPage(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "start_id and limit must be non-negative integers")
+		return
+	}
+	response, err := channelz.GetServerSockets(context.Background(), &channelzgrpc.GetServerSocketsRequest{
+		ServerId: id, StartSocketId: startID, MaxResults: limit,
+	})
+	writeChannelz(w, response, err)
+}
+
+func (s *Server) handleChannelzSocket(w http.ResponseWriter, r *http.Request) {
+	channelz := s.enabledChannelz(w)
+	if channelz == nil {
+		return
+	}
+	id, ok := channelzID(w, r)
+	if !ok {
+		return
+	}
+	response, err := channelz.GetSocket(context.Background(), &channelzgrpc.GetSocketRequest{SocketId: id})
+	writeChannelz(w, response, err)
+}
+
+func (s *Server) handleChannelzChannels(w http.ResponseWriter, r *http.Request) {
+	channelz := s.enabledChannelz(w)
+	if channelz == nil {
+		return
+	}
+	startID, limit, ok := channelzPage(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "start_id and limit must be non-negative integers")
+		return
+	}
+	response, err := channelz.GetTopChannels(context.Background(), &channelzgrpc.GetTopChannelsRequest{StartChannelId: startID, MaxResults: limit})
+	writeChannelz(w, response, err)
+}
+
+func (s *Server) handleChannelzSubchannel(w http.ResponseWriter, r *http.Request) {
+	channelz := s.enabledChannelz(w)
+	if channelz == nil {
+		return
+	}
+	id, ok := channelzID(w, r)
+	if !ok {
+		return
+	}
+	response, err := channelz.GetSubchannel(context.Background(), &channelzgrpc.GetSubchannelRequest{SubchannelId: id})
+	writeChannelz(w, response, err)
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestChannelzAPI(t *testing.T) {
+	if status := serve(t, NewServer(Options{}).Handler(), http.MethodGet, "/debug/channelz/servers", nil); status != http.StatusNotFound {
+		t.Errorf("status with channelz disabled = %d, want 404", status)
+	}
+	handler := NewServer(Options{Channelz: true}).Handler()
+
+	// A gRPC server with a client connection to report on
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+
+	var servers struct {
+		Server []struct {
+			Ref struct {
+				ServerID string `json:"server_id"`
+			} `json:"ref"`
+			ListenSocket []struct {
+				SocketID string `json:"socket_id"`
+			} `json:"listen_socket"`
+		} `json:"server"`
+	}
+	if status := serve(t, handler, http.MethodGet, "/debug/channelz/servers", &servers); status != http.StatusOK {
+		t.Fatalf("servers status = %d", status)
+	}
+	if len(servers.Server) == 0 {
+		t.Fatal("no gRPC servers listed")
+	}
+	serverID := servers.Server[len(servers.Server)-1].Ref.ServerID
+
+	var sockets struct {
+		SocketRef []struct {
+			SocketID string `json:"socket_id"`
+		} `json:"socket_ref"`
+	}
+	if status := serve(t, handler, http.MethodGet, fmt.Sprintf("/debug/channelz/servers/%s/sockets", serverID), &sockets); status != http.StatusOK {
+		t.Fatalf("server sockets status = %d", status)
+	}
+	if len(sockets.SocketRef) != 1 {
+		t.Fatalf("server sockets = %+v, want the client's connection", sockets)
+	}
+
+	var socket struct {
+		Socket struct {
+			Data struct {
+				StreamsSucceeded string `json:"streams_succeeded"`
+			} `json:"data"`
+		} `json:"socket"`
+	}
+	if status := serve(t, handler, http.MethodGet, "/debug/channelz/sockets/"+sockets.SocketRef[0].SocketID, &socket); status != http.StatusOK {
+		t.Fatalf("socket status = %d", status)
+	}
+	if socket.Socket.Data.StreamsSucceeded != "1" {
+		t.Errorf("streams succeeded = %q, want the health check", socket.Socket.Data.StreamsSucceeded)
+	}
+
+	var channels map[string]interface{}
+	if status := serve(t, handler, http.MethodGet, "/debug/channelz/channels", &channels); status != http.StatusOK || channels["channel"] == nil {
+		t.Errorf("channels status = %d, channels %v", status, channels)
+	}
+	for path, want := range map[string]int{
+		"/debug/channelz/sockets/999999999":     http.StatusNotFound,
+		"/debug/channelz/sockets/x":             http.StatusBadRequest,
+		"/debug/channelz/servers?start_id=-1":   http.StatusBadRequest,
+		"/debug/channelz/subchannels/999999999": http.StatusNotFound,
+	} {
+		if status := serve(t, handler, http.MethodGet, path, nil); status != want {
+			t.Errorf("%s status = %d, want %d", path, status, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// maxClassifyBytes bounds the body of a classification request
+const maxClassifyBytes = 4 << 20
+
+// ErrInvalidClassifyRequest is returned by the classifier for requests it
+// cannot classify, such as a request that is not an OpenAI request
+var ErrInvalidClassifyRequest = errors.New("invalid classification request")
+
+// ClassifyRequest is the body of a classification request: raw text, or an
+// OpenAI chat completions request classified the way the router would
+type ClassifyRequest struct {
+	Text    string          `json:"text,omitempty"`
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// Classification is how the router would route a text or request
+type Classification struct {
+	// Category matched, empty when none did
+	Category string `json:"category,omitempty"`
+	// Classifier confidence, or utterance similarity with the similarity
+	// strategy, of the most likely category, even when below its threshold
+	Confidence float32 `json:"confidence"`
+	// Second most likely category and its confidence, when the classifier
+	// reports one
+	RunnerUp           string  `json:"runner_up,omitempty"`
+	RunnerUpConfidence float32 `json:"runner_up_confidence,omitempty"`
+	// Model that would be selected
+	Model string `json:"model"`
+	// First ranked model of the category, when the selection policy picked
+	// another one
+	RankedModel string `json:"ranked_model,omitempty"`
+	// How the text of a request was sampled to the classification budget
+	ClassificationStrategy string `json:"classification_strategy,omitempty"`
+}
+
+// Classifier classifies a text or request without routing it
+type Classifier func(ctx context.Context, req ClassifyRequest) (Classification, error)
+
+func (s *Server) handleClassify(w http.ResponseWriter, r *http.Request) {
+	if s.options.Classify == nil {
+		writeError(w, http.StatusNotFound, "classification unavailable")
+		return
+	}
+	var req ClassifyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxClassifyBytes)).Decode(&req); err != nil || (req.Text == "") == (len(req.Request) == 0) {
+		writeError(w, http.StatusBadRequest, `expected a body like {"text": "..."} or {"request": {"messages": [...]}}`)
+		return
+	}
+	classification, err := s.options.Classify(r.Context(), req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidClassifyRequest) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, classification)
+}
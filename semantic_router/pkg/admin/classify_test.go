@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClassifyAPI(t *testing.T) {
+	classify := func(body string, handler http.Handler) (int, Classification) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/classify", strings.NewReader(body)))
+		var classification Classification
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &classification); err != nil {
+				t.Fatalf("invalid response %s: %v", rec.Body, err)
+			}
+		}
+		return rec.Code, classification
+	}
+	if status, _ := classify(`{"text":"hi"}`, NewServer(Options{}).Handler()); status != http.StatusNotFound {
+		t.Errorf("status without a classifier = %d, want %d", status, http.StatusNotFound)
+	}
+
+	handler := NewServer(Options{Classify: func(_ context.Context, req ClassifyRequest) (Classification, error) {
+		if len(req.Request) > 0 && !strings.Contains(string(req.Request), "messages") {
+			return Classification{}, fmt.Errorf("%w: no messages", ErrInvalidClassifyRequest)
+		}
+		return Classification{Category: "math", Confidence: 0.9, Model: "math-model"}, nil
+	}}).Handler()
+	status, classification := classify(`{"text":"What is the derivative of x^2?"}`, handler)
+	if status != http.StatusOK || classification.Category != "math" || classification.Model != "math-model" {
+		t.Errorf("classify = %d, %+v", status, classification)
+	}
+	if status, _ := classify(`{"request":{"messages":[{"role":"user","content":"hi"}]}}`, handler); status != http.StatusOK {
+		t.Errorf("status of a request = %d, want %d", status, http.StatusOK)
+	}
+	for _, body := range []string{`{}`, `{"text":"hi","request":{"messages":[]}}`, `{"request":{"model":"auto"}}`, `[`} {
+		if status, _ := classify(body, handler); status != http.StatusBadRequest {
+			t.Errorf("status of %s = %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,4209 @@
+// Package client provides primitives to interact with the openapi HTTP API.
+//
+// Code generated by github.com/oapi-codegen/oapi-codegen/v2 version v2.4.1 DO NOT EDIT.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oapi-codegen/runtime"
+)
+
+const (
+	BearerAuthScopes = "bearerAuth.Scopes"
+)
+
+// Defines values for CircuitState.
+const (
+	Closed   CircuitState = "closed"
+	HalfOpen CircuitState = "half_open"
+	Open     CircuitState = "open"
+)
+
+// Defines values for HealthStatus.
+const (
+	Degraded HealthStatus = "degraded"
+	Ok       HealthStatus = "ok"
+)
+
+// Defines values for ReadinessStatus.
+const (
+	NotReady ReadinessStatus = "not_ready"
+	Ready    ReadinessStatus = "ready"
+)
+
+// Defines values for RoutingFeedbackKind.
+const (
+	Correct    RoutingFeedbackKind = "correct"
+	Misrouted  RoutingFeedbackKind = "misrouted"
+	StaleCache RoutingFeedbackKind = "stale_cache"
+)
+
+// Defines values for UpstreamErrorType.
+const (
+	Authentication        UpstreamErrorType = "authentication"
+	ContextLengthExceeded UpstreamErrorType = "context_length_exceeded"
+	InsufficientQuota     UpstreamErrorType = "insufficient_quota"
+	InvalidRequest        UpstreamErrorType = "invalid_request"
+	NotFound              UpstreamErrorType = "not_found"
+	Other                 UpstreamErrorType = "other"
+	Overloaded            UpstreamErrorType = "overloaded"
+	Permission            UpstreamErrorType = "permission"
+	RateLimit             UpstreamErrorType = "rate_limit"
+	Server                UpstreamErrorType = "server"
+)
+
+// ApplicationFeedback defines model for ApplicationFeedback.
+type ApplicationFeedback struct {
+	Positive bool `json:"positive"`
+
+	// RequestId Request ID from the x-request-id header
+	RequestId string `json:"request_id"`
+}
+
+// Artifact defines model for Artifact.
+type Artifact struct {
+	// Error Why the artifact could not be fingerprinted
+	Error *string `json:"error,omitempty"`
+
+	// Id Model ID or path as configured
+	Id string `json:"id"`
+
+	// Name Config key of the artifact, e.g. classifier or category_mapping
+	Name string `json:"name"`
+
+	// Revision Commit of a hub model resolved from the local hub cache
+	Revision *string `json:"revision,omitempty"`
+
+	// Sha256 SHA-256 of a local file or model directory
+	Sha256 *string `json:"sha256,omitempty"`
+}
+
+// CacheEntry defines model for CacheEntry.
+type CacheEntry struct {
+	AgeSeconds float64   `json:"age_seconds"`
+	CreatedAt  time.Time `json:"created_at"`
+	Epoch      *string   `json:"epoch,omitempty"`
+	Id         string    `json:"id"`
+	Model      string    `json:"model"`
+	Query      string    `json:"query"`
+
+	// ResponseBytes Size of the cached response, 0 while pending
+	ResponseBytes int `json:"response_bytes"`
+}
+
+// CacheFlush defines model for CacheFlush.
+type CacheFlush struct {
+	// Flushed Number of pending and completed entries dropped
+	Flushed int `json:"flushed"`
+}
+
+// CategoryCandidate defines model for CategoryCandidate.
+type CategoryCandidate struct {
+	// Examples Queries closest to the cluster's centroid
+	Examples []string `json:"examples"`
+	Id       int      `json:"id"`
+
+	// Keywords Most frequent words in the cluster's queries
+	Keywords []string `json:"keywords"`
+
+	// Share Share of all clustered unrouted queries
+	Share float64 `json:"share"`
+
+	// Size Number of clustered queries in the candidate
+	Size int `json:"size"`
+}
+
+// CategoryPromptLengths defines model for CategoryPromptLengths.
+type CategoryPromptLengths struct {
+	// Category Category the requests were routed by, empty for none
+	Category string `json:"category"`
+
+	// ContextWindow Context window of the primary model in tokens, unset when unknown
+	ContextWindow *int `json:"context_window,omitempty"`
+
+	// ExceedingPrimary Prompts longer than the primary model's context window
+	ExceedingPrimary int `json:"exceeding_primary"`
+
+	// ExceedingSelected Prompts longer than the context window of the model they were routed to
+	ExceedingSelected int                  `json:"exceeding_selected"`
+	ExceedingShare    float64              `json:"exceeding_share"`
+	Histogram         []PromptLengthBucket `json:"histogram"`
+	MaxTokens         int64                `json:"max_tokens"`
+	P50Tokens         int64                `json:"p50_tokens"`
+	P90Tokens         int64                `json:"p90_tokens"`
+	P99Tokens         int64                `json:"p99_tokens"`
+	PrimaryModel      string               `json:"primary_model"`
+	Requests          int                  `json:"requests"`
+
+	// SuggestedModel Model of the category with the smallest context window fitting the p99 prompt
+	SuggestedModel *string `json:"suggested_model,omitempty"`
+	Warning        *string `json:"warning,omitempty"`
+}
+
+// Channelz Response of grpc.channelz.v1.Channelz encoded as JSON with proto field
+// names. Served when admin.channelz is enabled.
+type Channelz map[string]interface{}
+
+// Circuit defines model for Circuit.
+type Circuit struct {
+	// ErrorRate Fraction of responses in the window that failed or were too slow
+	ErrorRate float64 `json:"error_rate"`
+
+	// Errors Responses in the window that were 429 or 5xx
+	Errors int    `json:"errors"`
+	Model  string `json:"model"`
+
+	// OpenUntil When an open circuit lets a trial request through
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+
+	// Requests Responses in the window
+	Requests int `json:"requests"`
+
+	// SlowRequests Responses in the window slower than the latency threshold
+	SlowRequests int          `json:"slow_requests"`
+	State        CircuitState `json:"state"`
+}
+
+// CircuitState defines model for Circuit.State.
+type CircuitState string
+
+// Classification defines model for Classification.
+type Classification struct {
+	// Category Category matched, absent when none did
+	Category *string `json:"category,omitempty"`
+
+	// ClassificationStrategy How the text of a request was sampled to the classification budget
+	ClassificationStrategy *string `json:"classification_strategy,omitempty"`
+
+	// Confidence Classifier confidence, or utterance similarity, of the most likely category
+	Confidence float32 `json:"confidence"`
+
+	// Model Model that would be selected
+	Model string `json:"model"`
+
+	// RankedModel First ranked model of the category, when the selection policy picked another one
+	RankedModel        *string  `json:"ranked_model,omitempty"`
+	RunnerUp           *string  `json:"runner_up,omitempty"`
+	RunnerUpConfidence *float32 `json:"runner_up_confidence,omitempty"`
+}
+
+// ClassifyRequest Exactly one of text and request
+type ClassifyRequest struct {
+	// Request OpenAI chat completions request
+	Request *map[string]interface{} `json:"request,omitempty"`
+	Text    *string                 `json:"text,omitempty"`
+}
+
+// Error defines model for Error.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Fingerprint defines model for Fingerprint.
+type Fingerprint struct {
+	Artifacts []Artifact `json:"artifacts"`
+
+	// ConfigHash SHA-256 of the whole loaded config
+	ConfigHash string     `json:"config_hash"`
+	Models     []Artifact `json:"models"`
+
+	// RoutingHash Short hash of the config deciding which model answers a request
+	RoutingHash string `json:"routing_hash"`
+
+	// Version Build version, or the VCS revision when not set at build time
+	Version string `json:"version"`
+}
+
+// FlagUpdate defines model for FlagUpdate.
+type FlagUpdate struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Flags defines model for Flags.
+type Flags map[string]bool
+
+// Health defines model for Health.
+type Health struct {
+	Dimensions map[string]HealthDimension `json:"dimensions"`
+	Status     HealthStatus               `json:"status"`
+}
+
+// HealthDimension defines model for HealthDimension.
+type HealthDimension struct {
+	// Detail Why the dimension is degraded
+	Detail *string      `json:"detail,omitempty"`
+	Status HealthStatus `json:"status"`
+}
+
+// HealthStatus defines model for HealthStatus.
+type HealthStatus string
+
+// ModelRecommendation defines model for ModelRecommendation.
+type ModelRecommendation struct {
+	Application string `json:"application"`
+
+	// CurrentModel Configured model, unset when the application's requests are classified
+	CurrentModel *string `json:"current_model,omitempty"`
+
+	// Improvement Relative score improvement over the current default
+	Improvement *float64 `json:"improvement,omitempty"`
+
+	// Models Models that served the application, best scored first
+	Models []ModelStats `json:"models"`
+
+	// RecommendedModel Best scored model, unset when none improves enough on the current default
+	RecommendedModel *string `json:"recommended_model,omitempty"`
+}
+
+// ModelStats defines model for ModelStats.
+type ModelStats struct {
+	ErrorRate float64 `json:"error_rate"`
+
+	// Errors Requests that failed with a 5xx status
+	Errors             float64 `json:"errors"`
+	MeanLatencySeconds float64 `json:"mean_latency_seconds"`
+	Model              string  `json:"model"`
+	NegativeFeedback   float64 `json:"negative_feedback"`
+	PositiveFeedback   float64 `json:"positive_feedback"`
+	Requests           float64 `json:"requests"`
+
+	// Score Score the models are ranked by, 0 until the model has min_requests requests
+	Score float64 `json:"score"`
+}
+
+// PromptLengthBucket defines model for PromptLengthBucket.
+type PromptLengthBucket struct {
+	Count int `json:"count"`
+
+	// UpTo Upper bound in tokens, unset for prompts longer than the last bound
+	UpTo *int64 `json:"up_to,omitempty"`
+}
+
+// PromptLengthReport defines model for PromptLengthReport.
+type PromptLengthReport struct {
+	// Categories Sorted by category
+	Categories []CategoryPromptLengths `json:"categories"`
+
+	// Requests Requests with a known prompt length
+	Requests int `json:"requests"`
+
+	// Warnings Warnings of the misconfigured categories, most exceeding first
+	Warnings []string `json:"warnings"`
+}
+
+// Readiness defines model for Readiness.
+type Readiness struct {
+	// Detail Why the router is not ready
+	Detail *string         `json:"detail,omitempty"`
+	Status ReadinessStatus `json:"status"`
+}
+
+// ReadinessStatus defines model for Readiness.Status.
+type ReadinessStatus string
+
+// Rollout defines model for Rollout.
+type Rollout struct {
+	CurrentPercent      float64   `json:"current_percent"`
+	RampDurationSeconds int       `json:"ramp_duration_seconds"`
+	RampStart           time.Time `json:"ramp_start"`
+	StartPercent        float64   `json:"start_percent"`
+	TargetPercent       float64   `json:"target_percent"`
+}
+
+// RolloutUpdate defines model for RolloutUpdate.
+type RolloutUpdate struct {
+	RampDurationSeconds *int     `json:"ramp_duration_seconds,omitempty"`
+	StartPercent        *float64 `json:"start_percent,omitempty"`
+	TargetPercent       float64  `json:"target_percent"`
+}
+
+// Rollouts defines model for Rollouts.
+type Rollouts map[string]Rollout
+
+// RoutingFeedback defines model for RoutingFeedback.
+type RoutingFeedback struct {
+	Kind RoutingFeedbackKind `json:"kind"`
+
+	// RequestId Request ID from the x-request-id header
+	RequestId string `json:"request_id"`
+}
+
+// RoutingFeedbackKind defines model for RoutingFeedback.Kind.
+type RoutingFeedbackKind string
+
+// RoutingTable defines model for RoutingTable.
+type RoutingTable struct {
+	CacheEnabled             bool            `json:"cache_enabled"`
+	CacheSimilarityThreshold float32         `json:"cache_similarity_threshold"`
+	Categories               []RoutingTarget `json:"categories"`
+	ClassifierThreshold      float32         `json:"classifier_threshold"`
+	DefaultModel             string          `json:"default_model"`
+	SimilarityThreshold      float32         `json:"similarity_threshold"`
+
+	// Strategy How queries are matched to categories, classifier or similarity
+	Strategy string `json:"strategy"`
+}
+
+// RoutingTarget defines model for RoutingTarget.
+type RoutingTarget struct {
+	Blocked *bool `json:"blocked,omitempty"`
+
+	// ConfidenceThreshold Classifier confidence needed to route to the category
+	ConfidenceThreshold float32 `json:"confidence_threshold"`
+
+	// Models Ranked models of the category
+	Models          []string `json:"models"`
+	Name            string   `json:"name"`
+	ReasoningEffort *string  `json:"reasoning_effort,omitempty"`
+}
+
+// Trace defines model for Trace.
+type Trace struct {
+	CapturedAt time.Time `json:"captured_at"`
+
+	// Decision Decision record of the request
+	Decision      *map[string]interface{} `json:"decision,omitempty"`
+	DominantStage string                  `json:"dominant_stage"`
+
+	// Headers Request headers with credentials redacted
+	Headers *map[string]string `json:"headers,omitempty"`
+
+	// Reason Why the trace was captured, e.g. slo_breach
+	Reason    string `json:"reason"`
+	RequestId string `json:"request_id"`
+
+	// StageSeconds Time spent in each pipeline stage (request, routing, upstream, response)
+	StageSeconds map[string]float64 `json:"stage_seconds"`
+	TotalSeconds float64            `json:"total_seconds"`
+}
+
+// UpstreamError defines model for UpstreamError.
+type UpstreamError struct {
+	// Code Code of the response's error envelope
+	Code *string `json:"code,omitempty"`
+
+	// Message Message of the response's error envelope, truncated to 512 bytes
+	Message *string `json:"message,omitempty"`
+
+	// Model Model the request was routed to
+	Model     string `json:"model"`
+	RequestId string `json:"request_id"`
+
+	// Status HTTP status of the response
+	Status int       `json:"status"`
+	Time   time.Time `json:"time"`
+
+	// Type Type the error is counted by in llm_model_upstream_error_types_total
+	Type UpstreamErrorType `json:"type"`
+
+	// UpstreamType Type of the response's error envelope
+	UpstreamType *string `json:"upstream_type,omitempty"`
+}
+
+// UpstreamErrorType Type the error is counted by in llm_model_upstream_error_types_total
+type UpstreamErrorType string
+
+// ChannelzID defines model for ChannelzID.
+type ChannelzID = int64
+
+// ChannelzStartID defines model for ChannelzStartID.
+type ChannelzStartID = int64
+
+// Limit defines model for Limit.
+type Limit = int
+
+// Stage defines model for Stage.
+type Stage = string
+
+// ListCacheEntriesParams defines parameters for ListCacheEntries.
+type ListCacheEntriesParams struct {
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ListPendingRequestsParams defines parameters for ListPendingRequests.
+type ListPendingRequestsParams struct {
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ListChannelzChannelsParams defines parameters for ListChannelzChannels.
+type ListChannelzChannelsParams struct {
+	// StartId Lowest channelz ID listed, to page through listings
+	StartId *ChannelzStartID `form:"start_id,omitempty" json:"start_id,omitempty"`
+
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ListChannelzServersParams defines parameters for ListChannelzServers.
+type ListChannelzServersParams struct {
+	// StartId Lowest channelz ID listed, to page through listings
+	StartId *ChannelzStartID `form:"start_id,omitempty" json:"start_id,omitempty"`
+
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ListChannelzServerSocketsParams defines parameters for ListChannelzServerSockets.
+type ListChannelzServerSocketsParams struct {
+	// StartId Lowest channelz ID listed, to page through listings
+	StartId *ChannelzStartID `form:"start_id,omitempty" json:"start_id,omitempty"`
+
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetPromptLengthsParams defines parameters for GetPromptLengths.
+type GetPromptLengthsParams struct {
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ListRecentDecisionsParams defines parameters for ListRecentDecisions.
+type ListRecentDecisionsParams struct {
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ListUpstreamErrorsParams defines parameters for ListUpstreamErrors.
+type ListUpstreamErrorsParams struct {
+	// Limit Maximum number of items returned, all when unset
+	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// ClassifyJSONRequestBody defines body for Classify for application/json ContentType.
+type ClassifyJSONRequestBody = ClassifyRequest
+
+// PostApplicationFeedbackJSONRequestBody defines body for PostApplicationFeedback for application/json ContentType.
+type PostApplicationFeedbackJSONRequestBody = ApplicationFeedback
+
+// SetFlagJSONRequestBody defines body for SetFlag for application/json ContentType.
+type SetFlagJSONRequestBody = FlagUpdate
+
+// SetRolloutJSONRequestBody defines body for SetRollout for application/json ContentType.
+type SetRolloutJSONRequestBody = RolloutUpdate
+
+// PostRoutingFeedbackJSONRequestBody defines body for PostRoutingFeedback for application/json ContentType.
+type PostRoutingFeedbackJSONRequestBody = RoutingFeedback
+
+// RequestEditorFn  is the function signature for the RequestEditor callback function
+type RequestEditorFn func(ctx context.Context, req *http.Request) error
+
+// Doer performs HTTP requests.
+//
+// The standard http.Client implements this interface.
+type HttpRequestDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client which conforms to the OpenAPI3 specification for this service.
+type Client struct {
+	// The endpoint of the server conforming to this interface, with scheme,
+	// https://api.deepmap.com for example. This can contain a path relative
+	// to the server, such as https://api.deepmap.com/dev-test, and all the
+	// paths in the swagger spec will be appended to the server.
+	Server string
+
+	// Doer for performing requests, typically a *http.Client with any
+	// customized settings, such as certificate chains.
+	Client HttpRequestDoer
+
+	// A list of callbacks for modifying requests which are generated before sending over
+	// the network.
+	RequestEditors []RequestEditorFn
+}
+
+// ClientOption allows setting custom parameters during construction
+type ClientOption func(*Client) error
+
+// Creates a new Client, with reasonable defaults
+func NewClient(server string, opts ...ClientOption) (*Client, error) {
+	// create a client with sane default values
+	client := Client{
+		Server: server,
+	}
+	// mutate client and add all optional params
+	for _, o := range opts {
+		if err := o(&client); err != nil {
+			return nil, err
+		}
+	}
+	// ensure the server URL always has a trailing slash
+	if !strings.HasSuffix(client.Server, "/") {
+		client.Server += "/"
+	}
+	// create httpClient, if not already present
+	if client.Client == nil {
+		client.Client = &http.Client{}
+	}
+	return &client, nil
+}
+
+// WithHTTPClient allows overriding the default Doer, which is
+// automatically created using http.Client. This is useful for tests.
+func WithHTTPClient(doer HttpRequestDoer) ClientOption {
+	return func(c *Client) error {
+		c.Client = doer
+		return nil
+	}
+}
+
+// WithRequestEditorFn allows setting up a callback function, which will be
+// called right before sending the request. This can be used to mutate the request.
+func WithRequestEditorFn(fn RequestEditorFn) ClientOption {
+	return func(c *Client) error {
+		c.RequestEditors = append(c.RequestEditors, fn)
+		return nil
+	}
+}
+
+// The interface specification for the client above.
+type ClientInterface interface {
+	// ClassifyWithBody request with any body
+	ClassifyWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	Classify(ctx context.Context, body ClassifyJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// PostApplicationFeedbackWithBody request with any body
+	PostApplicationFeedbackWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	PostApplicationFeedback(ctx context.Context, body PostApplicationFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListModelRecommendations request
+	ListModelRecommendations(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// FlushCache request
+	FlushCache(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListCacheEntries request
+	ListCacheEntries(ctx context.Context, params *ListCacheEntriesParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListPendingRequests request
+	ListPendingRequests(ctx context.Context, params *ListPendingRequestsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListCircuits request
+	ListCircuits(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListChannelzChannels request
+	ListChannelzChannels(ctx context.Context, params *ListChannelzChannelsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListChannelzServers request
+	ListChannelzServers(ctx context.Context, params *ListChannelzServersParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListChannelzServerSockets request
+	ListChannelzServerSockets(ctx context.Context, id ChannelzID, params *ListChannelzServerSocketsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetChannelzSocket request
+	GetChannelzSocket(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetChannelzSubchannel request
+	GetChannelzSubchannel(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListTraces request
+	ListTraces(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetTrace request
+	GetTrace(ctx context.Context, requestID string, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetPromptLengths request
+	GetPromptLengths(ctx context.Context, params *GetPromptLengthsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListRecentDecisions request
+	ListRecentDecisions(ctx context.Context, params *ListRecentDecisionsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListCategoryCandidates request
+	ListCategoryCandidates(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetFingerprint request
+	GetFingerprint(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListFlags request
+	ListFlags(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// SetFlagWithBody request with any body
+	SetFlagWithBody(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	SetFlag(ctx context.Context, stage Stage, body SetFlagJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetHealth request
+	GetHealth(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetReadiness request
+	GetReadiness(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListRollouts request
+	ListRollouts(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ClearRollout request
+	ClearRollout(ctx context.Context, stage Stage, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// SetRolloutWithBody request with any body
+	SetRolloutWithBody(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	SetRollout(ctx context.Context, stage Stage, body SetRolloutJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetRoutingTable request
+	GetRoutingTable(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// PostRoutingFeedbackWithBody request with any body
+	PostRoutingFeedbackWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	PostRoutingFeedback(ctx context.Context, body PostRoutingFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ListUpstreamErrors request
+	ListUpstreamErrors(ctx context.Context, params *ListUpstreamErrorsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+}
+
+func (c *Client) ClassifyWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewClassifyRequestWithBody(c.Server, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) Classify(ctx context.Context, body ClassifyJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewClassifyRequest(c.Server, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) PostApplicationFeedbackWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostApplicationFeedbackRequestWithBody(c.Server, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) PostApplicationFeedback(ctx context.Context, body PostApplicationFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostApplicationFeedbackRequest(c.Server, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListModelRecommendations(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListModelRecommendationsRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) FlushCache(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewFlushCacheRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListCacheEntries(ctx context.Context, params *ListCacheEntriesParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListCacheEntriesRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListPendingRequests(ctx context.Context, params *ListPendingRequestsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListPendingRequestsRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListCircuits(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListCircuitsRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListChannelzChannels(ctx context.Context, params *ListChannelzChannelsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListChannelzChannelsRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListChannelzServers(ctx context.Context, params *ListChannelzServersParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListChannelzServersRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListChannelzServerSockets(ctx context.Context, id ChannelzID, params *ListChannelzServerSocketsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListChannelzServerSocketsRequest(c.Server, id, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetChannelzSocket(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetChannelzSocketRequest(c.Server, id)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetChannelzSubchannel(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetChannelzSubchannelRequest(c.Server, id)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListTraces(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListTracesRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetTrace(ctx context.Context, requestID string, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetTraceRequest(c.Server, requestID)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetPromptLengths(ctx context.Context, params *GetPromptLengthsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetPromptLengthsRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListRecentDecisions(ctx context.Context, params *ListRecentDecisionsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListRecentDecisionsRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListCategoryCandidates(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListCategoryCandidatesRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetFingerprint(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetFingerprintRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListFlags(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListFlagsRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) SetFlagWithBody(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewSetFlagRequestWithBody(c.Server, stage, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) SetFlag(ctx context.Context, stage Stage, body SetFlagJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewSetFlagRequest(c.Server, stage, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetHealth(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetHealthRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetReadiness(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetReadinessRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListRollouts(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListRolloutsRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ClearRollout(ctx context.Context, stage Stage, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewClearRolloutRequest(c.Server, stage)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) SetRolloutWithBody(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewSetRolloutRequestWithBody(c.Server, stage, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) SetRollout(ctx context.Context, stage Stage, body SetRolloutJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewSetRolloutRequest(c.Server, stage, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetRoutingTable(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetRoutingTableRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) PostRoutingFeedbackWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostRoutingFeedbackRequestWithBody(c.Server, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) PostRoutingFeedback(ctx context.Context, body PostRoutingFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostRoutingFeedbackRequest(c.Server, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) ListUpstreamErrors(ctx context.Context, params *ListUpstreamErrorsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewListUpstreamErrorsRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// NewClassifyRequest calls the generic Classify builder with application/json body
+func NewClassifyRequest(server string, body ClassifyJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewClassifyRequestWithBody(server, "application/json", bodyReader)
+}
+
+// NewClassifyRequestWithBody generates requests for Classify with any type of body
+func NewClassifyRequestWithBody(server string, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/api/v1/classify")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewPostApplicationFeedbackRequest calls the generic PostApplicationFeedback builder with application/json body
+func NewPostApplicationFeedbackRequest(server string, body PostApplicationFeedbackJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewPostApplicationFeedbackRequestWithBody(server, "application/json", bodyReader)
+}
+
+// NewPostApplicationFeedbackRequestWithBody generates requests for PostApplicationFeedback with any type of body
+func NewPostApplicationFeedbackRequestWithBody(server string, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/applications/feedback")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewListModelRecommendationsRequest generates requests for ListModelRecommendations
+func NewListModelRecommendationsRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/applications/recommendations")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewFlushCacheRequest generates requests for FlushCache
+func NewFlushCacheRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/cache/entries")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("DELETE", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListCacheEntriesRequest generates requests for ListCacheEntries
+func NewListCacheEntriesRequest(server string, params *ListCacheEntriesParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/cache/entries")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListPendingRequestsRequest generates requests for ListPendingRequests
+func NewListPendingRequestsRequest(server string, params *ListPendingRequestsParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/cache/pending")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListCircuitsRequest generates requests for ListCircuits
+func NewListCircuitsRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/circuits")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListChannelzChannelsRequest generates requests for ListChannelzChannels
+func NewListChannelzChannelsRequest(server string, params *ListChannelzChannelsParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/debug/channelz/channels")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.StartId != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "start_id", runtime.ParamLocationQuery, *params.StartId); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListChannelzServersRequest generates requests for ListChannelzServers
+func NewListChannelzServersRequest(server string, params *ListChannelzServersParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/debug/channelz/servers")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.StartId != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "start_id", runtime.ParamLocationQuery, *params.StartId); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListChannelzServerSocketsRequest generates requests for ListChannelzServerSockets
+func NewListChannelzServerSocketsRequest(server string, id ChannelzID, params *ListChannelzServerSocketsParams) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/debug/channelz/servers/%s/sockets", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.StartId != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "start_id", runtime.ParamLocationQuery, *params.StartId); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetChannelzSocketRequest generates requests for GetChannelzSocket
+func NewGetChannelzSocketRequest(server string, id ChannelzID) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/debug/channelz/sockets/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetChannelzSubchannelRequest generates requests for GetChannelzSubchannel
+func NewGetChannelzSubchannelRequest(server string, id ChannelzID) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/debug/channelz/subchannels/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListTracesRequest generates requests for ListTraces
+func NewListTracesRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/debug/traces")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetTraceRequest generates requests for GetTrace
+func NewGetTraceRequest(server string, requestID string) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "requestID", runtime.ParamLocationPath, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/debug/traces/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetPromptLengthsRequest generates requests for GetPromptLengths
+func NewGetPromptLengthsRequest(server string, params *GetPromptLengthsParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/decisions/prompt-lengths")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListRecentDecisionsRequest generates requests for ListRecentDecisions
+func NewListRecentDecisionsRequest(server string, params *ListRecentDecisionsParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/decisions/recent")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListCategoryCandidatesRequest generates requests for ListCategoryCandidates
+func NewListCategoryCandidatesRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/discovery/candidates")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetFingerprintRequest generates requests for GetFingerprint
+func NewGetFingerprintRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/fingerprint")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListFlagsRequest generates requests for ListFlags
+func NewListFlagsRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/flags")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewSetFlagRequest calls the generic SetFlag builder with application/json body
+func NewSetFlagRequest(server string, stage Stage, body SetFlagJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewSetFlagRequestWithBody(server, stage, "application/json", bodyReader)
+}
+
+// NewSetFlagRequestWithBody generates requests for SetFlag with any type of body
+func NewSetFlagRequestWithBody(server string, stage Stage, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "stage", runtime.ParamLocationPath, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/flags/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("PUT", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewGetHealthRequest generates requests for GetHealth
+func NewGetHealthRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/health")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetReadinessRequest generates requests for GetReadiness
+func NewGetReadinessRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/readyz")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewListRolloutsRequest generates requests for ListRollouts
+func NewListRolloutsRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/rollouts")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewClearRolloutRequest generates requests for ClearRollout
+func NewClearRolloutRequest(server string, stage Stage) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "stage", runtime.ParamLocationPath, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/rollouts/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("DELETE", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewSetRolloutRequest calls the generic SetRollout builder with application/json body
+func NewSetRolloutRequest(server string, stage Stage, body SetRolloutJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewSetRolloutRequestWithBody(server, stage, "application/json", bodyReader)
+}
+
+// NewSetRolloutRequestWithBody generates requests for SetRollout with any type of body
+func NewSetRolloutRequestWithBody(server string, stage Stage, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "stage", runtime.ParamLocationPath, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/rollouts/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("PUT", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewGetRoutingTableRequest generates requests for GetRoutingTable
+func NewGetRoutingTableRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/routing")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewPostRoutingFeedbackRequest calls the generic PostRoutingFeedback builder with application/json body
+func NewPostRoutingFeedbackRequest(server string, body PostRoutingFeedbackJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewPostRoutingFeedbackRequestWithBody(server, "application/json", bodyReader)
+}
+
+// NewPostRoutingFeedbackRequestWithBody generates requests for PostRoutingFeedback with any type of body
+func NewPostRoutingFeedbackRequestWithBody(server string, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/routing/feedback")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewListUpstreamErrorsRequest generates requests for ListUpstreamErrors
+func NewListUpstreamErrorsRequest(server string, params *ListUpstreamErrorsParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/upstream/errors")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (c *Client) applyEditors(ctx context.Context, req *http.Request, additionalEditors []RequestEditorFn) error {
+	for _, r := range c.RequestEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	for _, r := range additionalEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClientWithResponses builds on ClientInterface to offer response payloads
+type ClientWithResponses struct {
+	ClientInterface
+}
+
+// NewClientWithResponses creates a new ClientWithResponses, which wraps
+// Client with return type handling
+func NewClientWithResponses(server string, opts ...ClientOption) (*ClientWithResponses, error) {
+	client, err := NewClient(server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientWithResponses{client}, nil
+}
+
+// WithBaseURL overrides the baseURL.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) error {
+		newBaseURL, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+		c.Server = newBaseURL.String()
+		return nil
+	}
+}
+
+// ClientWithResponsesInterface is the interface specification for the client with responses above.
+type ClientWithResponsesInterface interface {
+	// ClassifyWithBodyWithResponse request with any body
+	ClassifyWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*ClassifyResponse, error)
+
+	ClassifyWithResponse(ctx context.Context, body ClassifyJSONRequestBody, reqEditors ...RequestEditorFn) (*ClassifyResponse, error)
+
+	// PostApplicationFeedbackWithBodyWithResponse request with any body
+	PostApplicationFeedbackWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PostApplicationFeedbackResponse, error)
+
+	PostApplicationFeedbackWithResponse(ctx context.Context, body PostApplicationFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*PostApplicationFeedbackResponse, error)
+
+	// ListModelRecommendationsWithResponse request
+	ListModelRecommendationsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListModelRecommendationsResponse, error)
+
+	// FlushCacheWithResponse request
+	FlushCacheWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*FlushCacheResponse, error)
+
+	// ListCacheEntriesWithResponse request
+	ListCacheEntriesWithResponse(ctx context.Context, params *ListCacheEntriesParams, reqEditors ...RequestEditorFn) (*ListCacheEntriesResponse, error)
+
+	// ListPendingRequestsWithResponse request
+	ListPendingRequestsWithResponse(ctx context.Context, params *ListPendingRequestsParams, reqEditors ...RequestEditorFn) (*ListPendingRequestsResponse, error)
+
+	// ListCircuitsWithResponse request
+	ListCircuitsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListCircuitsResponse, error)
+
+	// ListChannelzChannelsWithResponse request
+	ListChannelzChannelsWithResponse(ctx context.Context, params *ListChannelzChannelsParams, reqEditors ...RequestEditorFn) (*ListChannelzChannelsResponse, error)
+
+	// ListChannelzServersWithResponse request
+	ListChannelzServersWithResponse(ctx context.Context, params *ListChannelzServersParams, reqEditors ...RequestEditorFn) (*ListChannelzServersResponse, error)
+
+	// ListChannelzServerSocketsWithResponse request
+	ListChannelzServerSocketsWithResponse(ctx context.Context, id ChannelzID, params *ListChannelzServerSocketsParams, reqEditors ...RequestEditorFn) (*ListChannelzServerSocketsResponse, error)
+
+	// GetChannelzSocketWithResponse request
+	GetChannelzSocketWithResponse(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*GetChannelzSocketResponse, error)
+
+	// GetChannelzSubchannelWithResponse request
+	GetChannelzSubchannelWithResponse(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*GetChannelzSubchannelResponse, error)
+
+	// ListTracesWithResponse request
+	ListTracesWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListTracesResponse, error)
+
+	// GetTraceWithResponse request
+	GetTraceWithResponse(ctx context.Context, requestID string, reqEditors ...RequestEditorFn) (*GetTraceResponse, error)
+
+	// GetPromptLengthsWithResponse request
+	GetPromptLengthsWithResponse(ctx context.Context, params *GetPromptLengthsParams, reqEditors ...RequestEditorFn) (*GetPromptLengthsResponse, error)
+
+	// ListRecentDecisionsWithResponse request
+	ListRecentDecisionsWithResponse(ctx context.Context, params *ListRecentDecisionsParams, reqEditors ...RequestEditorFn) (*ListRecentDecisionsResponse, error)
+
+	// ListCategoryCandidatesWithResponse request
+	ListCategoryCandidatesWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListCategoryCandidatesResponse, error)
+
+	// GetFingerprintWithResponse request
+	GetFingerprintWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetFingerprintResponse, error)
+
+	// ListFlagsWithResponse request
+	ListFlagsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListFlagsResponse, error)
+
+	// SetFlagWithBodyWithResponse request with any body
+	SetFlagWithBodyWithResponse(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SetFlagResponse, error)
+
+	SetFlagWithResponse(ctx context.Context, stage Stage, body SetFlagJSONRequestBody, reqEditors ...RequestEditorFn) (*SetFlagResponse, error)
+
+	// GetHealthWithResponse request
+	GetHealthWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetHealthResponse, error)
+
+	// GetReadinessWithResponse request
+	GetReadinessWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetReadinessResponse, error)
+
+	// ListRolloutsWithResponse request
+	ListRolloutsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListRolloutsResponse, error)
+
+	// ClearRolloutWithResponse request
+	ClearRolloutWithResponse(ctx context.Context, stage Stage, reqEditors ...RequestEditorFn) (*ClearRolloutResponse, error)
+
+	// SetRolloutWithBodyWithResponse request with any body
+	SetRolloutWithBodyWithResponse(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SetRolloutResponse, error)
+
+	SetRolloutWithResponse(ctx context.Context, stage Stage, body SetRolloutJSONRequestBody, reqEditors ...RequestEditorFn) (*SetRolloutResponse, error)
+
+	// GetRoutingTableWithResponse request
+	GetRoutingTableWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetRoutingTableResponse, error)
+
+	// PostRoutingFeedbackWithBodyWithResponse request with any body
+	PostRoutingFeedbackWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PostRoutingFeedbackResponse, error)
+
+	PostRoutingFeedbackWithResponse(ctx context.Context, body PostRoutingFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*PostRoutingFeedbackResponse, error)
+
+	// ListUpstreamErrorsWithResponse request
+	ListUpstreamErrorsWithResponse(ctx context.Context, params *ListUpstreamErrorsParams, reqEditors ...RequestEditorFn) (*ListUpstreamErrorsResponse, error)
+}
+
+type ClassifyResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Classification
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ClassifyResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ClassifyResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type PostApplicationFeedbackResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r PostApplicationFeedbackResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r PostApplicationFeedbackResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListModelRecommendationsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]ModelRecommendation
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListModelRecommendationsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListModelRecommendationsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type FlushCacheResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *CacheFlush
+	JSON404      *Error
+	JSON501      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r FlushCacheResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r FlushCacheResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListCacheEntriesResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]CacheEntry
+	JSON400      *Error
+	JSON404      *Error
+	JSON501      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListCacheEntriesResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListCacheEntriesResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListPendingRequestsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]CacheEntry
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListPendingRequestsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListPendingRequestsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListCircuitsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]Circuit
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListCircuitsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListCircuitsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListChannelzChannelsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Channelz
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListChannelzChannelsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListChannelzChannelsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListChannelzServersResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Channelz
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListChannelzServersResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListChannelzServersResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListChannelzServerSocketsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Channelz
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListChannelzServerSocketsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListChannelzServerSocketsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetChannelzSocketResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Channelz
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r GetChannelzSocketResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetChannelzSocketResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetChannelzSubchannelResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Channelz
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r GetChannelzSubchannelResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetChannelzSubchannelResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListTracesResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]Trace
+}
+
+// Status returns HTTPResponse.Status
+func (r ListTracesResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListTracesResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetTraceResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Trace
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r GetTraceResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetTraceResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetPromptLengthsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *PromptLengthReport
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r GetPromptLengthsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetPromptLengthsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListRecentDecisionsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]map[string]interface{}
+	JSON400      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListRecentDecisionsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListRecentDecisionsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListCategoryCandidatesResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]CategoryCandidate
+}
+
+// Status returns HTTPResponse.Status
+func (r ListCategoryCandidatesResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListCategoryCandidatesResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetFingerprintResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Fingerprint
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r GetFingerprintResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetFingerprintResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListFlagsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Flags
+}
+
+// Status returns HTTPResponse.Status
+func (r ListFlagsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListFlagsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type SetFlagResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Flags
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r SetFlagResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r SetFlagResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetHealthResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Health
+}
+
+// Status returns HTTPResponse.Status
+func (r GetHealthResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetHealthResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetReadinessResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Readiness
+	JSON503      *Readiness
+}
+
+// Status returns HTTPResponse.Status
+func (r GetReadinessResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetReadinessResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListRolloutsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Rollouts
+}
+
+// Status returns HTTPResponse.Status
+func (r ListRolloutsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListRolloutsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ClearRolloutResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Rollouts
+}
+
+// Status returns HTTPResponse.Status
+func (r ClearRolloutResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ClearRolloutResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type SetRolloutResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Rollouts
+	JSON400      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r SetRolloutResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r SetRolloutResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetRoutingTableResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *RoutingTable
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r GetRoutingTableResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetRoutingTableResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type PostRoutingFeedbackResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r PostRoutingFeedbackResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r PostRoutingFeedbackResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type ListUpstreamErrorsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]UpstreamError
+	JSON400      *Error
+	JSON404      *Error
+}
+
+// Status returns HTTPResponse.Status
+func (r ListUpstreamErrorsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ListUpstreamErrorsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+// ClassifyWithBodyWithResponse request with arbitrary body returning *ClassifyResponse
+func (c *ClientWithResponses) ClassifyWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*ClassifyResponse, error) {
+	rsp, err := c.ClassifyWithBody(ctx, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClassifyResponse(rsp)
+}
+
+func (c *ClientWithResponses) ClassifyWithResponse(ctx context.Context, body ClassifyJSONRequestBody, reqEditors ...RequestEditorFn) (*ClassifyResponse, error) {
+	rsp, err := c.Classify(ctx, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClassifyResponse(rsp)
+}
+
+// PostApplicationFeedbackWithBodyWithResponse request with arbitrary body returning *PostApplicationFeedbackResponse
+func (c *ClientWithResponses) PostApplicationFeedbackWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PostApplicationFeedbackResponse, error) {
+	rsp, err := c.PostApplicationFeedbackWithBody(ctx, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePostApplicationFeedbackResponse(rsp)
+}
+
+func (c *ClientWithResponses) PostApplicationFeedbackWithResponse(ctx context.Context, body PostApplicationFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*PostApplicationFeedbackResponse, error) {
+	rsp, err := c.PostApplicationFeedback(ctx, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePostApplicationFeedbackResponse(rsp)
+}
+
+// ListModelRecommendationsWithResponse request returning *ListModelRecommendationsResponse
+func (c *ClientWithResponses) ListModelRecommendationsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListModelRecommendationsResponse, error) {
+	rsp, err := c.ListModelRecommendations(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListModelRecommendationsResponse(rsp)
+}
+
+// FlushCacheWithResponse request returning *FlushCacheResponse
+func (c *ClientWithResponses) FlushCacheWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*FlushCacheResponse, error) {
+	rsp, err := c.FlushCache(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFlushCacheResponse(rsp)
+}
+
+// ListCacheEntriesWithResponse request returning *ListCacheEntriesResponse
+func (c *ClientWithResponses) ListCacheEntriesWithResponse(ctx context.Context, params *ListCacheEntriesParams, reqEditors ...RequestEditorFn) (*ListCacheEntriesResponse, error) {
+	rsp, err := c.ListCacheEntries(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListCacheEntriesResponse(rsp)
+}
+
+// ListPendingRequestsWithResponse request returning *ListPendingRequestsResponse
+func (c *ClientWithResponses) ListPendingRequestsWithResponse(ctx context.Context, params *ListPendingRequestsParams, reqEditors ...RequestEditorFn) (*ListPendingRequestsResponse, error) {
+	rsp, err := c.ListPendingRequests(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListPendingRequestsResponse(rsp)
+}
+
+// ListCircuitsWithResponse request returning *ListCircuitsResponse
+func (c *ClientWithResponses) ListCircuitsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListCircuitsResponse, error) {
+	rsp, err := c.ListCircuits(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListCircuitsResponse(rsp)
+}
+
+// ListChannelzChannelsWithResponse request returning *ListChannelzChannelsResponse
+func (c *ClientWithResponses) ListChannelzChannelsWithResponse(ctx context.Context, params *ListChannelzChannelsParams, reqEditors ...RequestEditorFn) (*ListChannelzChannelsResponse, error) {
+	rsp, err := c.ListChannelzChannels(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListChannelzChannelsResponse(rsp)
+}
+
+// ListChannelzServersWithResponse request returning *ListChannelzServersResponse
+func (c *ClientWithResponses) ListChannelzServersWithResponse(ctx context.Context, params *ListChannelzServersParams, reqEditors ...RequestEditorFn) (*ListChannelzServersResponse, error) {
+	rsp, err := c.ListChannelzServers(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListChannelzServersResponse(rsp)
+}
+
+// ListChannelzServerSocketsWithResponse request returning *ListChannelzServerSocketsResponse
+func (c *ClientWithResponses) ListChannelzServerSocketsWithResponse(ctx context.Context, id ChannelzID, params *ListChannelzServerSocketsParams, reqEditors ...RequestEditorFn) (*ListChannelzServerSocketsResponse, error) {
+	rsp, err := c.ListChannelzServerSockets(ctx, id, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListChannelzServerSocketsResponse(rsp)
+}
+
+// GetChannelzSocketWithResponse request returning *GetChannelzSocketResponse
+func (c *ClientWithResponses) GetChannelzSocketWithResponse(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*GetChannelzSocketResponse, error) {
+	rsp, err := c.GetChannelzSocket(ctx, id, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetChannelzSocketResponse(rsp)
+}
+
+// GetChannelzSubchannelWithResponse request returning *GetChannelzSubchannelResponse
+func (c *ClientWithResponses) GetChannelzSubchannelWithResponse(ctx context.Context, id ChannelzID, reqEditors ...RequestEditorFn) (*GetChannelzSubchannelResponse, error) {
+	rsp, err := c.GetChannelzSubchannel(ctx, id, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetChannelzSubchannelResponse(rsp)
+}
+
+// ListTracesWithResponse request returning *ListTracesResponse
+func (c *ClientWithResponses) ListTracesWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListTracesResponse, error) {
+	rsp, err := c.ListTraces(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListTracesResponse(rsp)
+}
+
+// GetTraceWithResponse request returning *GetTraceResponse
+func (c *ClientWithResponses) GetTraceWithResponse(ctx context.Context, requestID string, reqEditors ...RequestEditorFn) (*GetTraceResponse, error) {
+	rsp, err := c.GetTrace(ctx, requestID, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetTraceResponse(rsp)
+}
+
+// GetPromptLengthsWithResponse request returning *GetPromptLengthsResponse
+func (c *ClientWithResponses) GetPromptLengthsWithResponse(ctx context.Context, params *GetPromptLengthsParams, reqEditors ...RequestEditorFn) (*GetPromptLengthsResponse, error) {
+	rsp, err := c.GetPromptLengths(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetPromptLengthsResponse(rsp)
+}
+
+// ListRecentDecisionsWithResponse request returning *ListRecentDecisionsResponse
+func (c *ClientWithResponses) ListRecentDecisionsWithResponse(ctx context.Context, params *ListRecentDecisionsParams, reqEditors ...RequestEditorFn) (*ListRecentDecisionsResponse, error) {
+	rsp, err := c.ListRecentDecisions(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListRecentDecisionsResponse(rsp)
+}
+
+// ListCategoryCandidatesWithResponse request returning *ListCategoryCandidatesResponse
+func (c *ClientWithResponses) ListCategoryCandidatesWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListCategoryCandidatesResponse, error) {
+	rsp, err := c.ListCategoryCandidates(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListCategoryCandidatesResponse(rsp)
+}
+
+// GetFingerprintWithResponse request returning *GetFingerprintResponse
+func (c *ClientWithResponses) GetFingerprintWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetFingerprintResponse, error) {
+	rsp, err := c.GetFingerprint(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetFingerprintResponse(rsp)
+}
+
+// ListFlagsWithResponse request returning *ListFlagsResponse
+func (c *ClientWithResponses) ListFlagsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListFlagsResponse, error) {
+	rsp, err := c.ListFlags(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListFlagsResponse(rsp)
+}
+
+// SetFlagWithBodyWithResponse request with arbitrary body returning *SetFlagResponse
+func (c *ClientWithResponses) SetFlagWithBodyWithResponse(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SetFlagResponse, error) {
+	rsp, err := c.SetFlagWithBody(ctx, stage, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSetFlagResponse(rsp)
+}
+
+func (c *ClientWithResponses) SetFlagWithResponse(ctx context.Context, stage Stage, body SetFlagJSONRequestBody, reqEditors ...RequestEditorFn) (*SetFlagResponse, error) {
+	rsp, err := c.SetFlag(ctx, stage, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSetFlagResponse(rsp)
+}
+
+// GetHealthWithResponse request returning *GetHealthResponse
+func (c *ClientWithResponses) GetHealthWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetHealthResponse, error) {
+	rsp, err := c.GetHealth(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetHealthResponse(rsp)
+}
+
+// GetReadinessWithResponse request returning *GetReadinessResponse
+func (c *ClientWithResponses) GetReadinessWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetReadinessResponse, error) {
+	rsp, err := c.GetReadiness(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetReadinessResponse(rsp)
+}
+
+// ListRolloutsWithResponse request returning *ListRolloutsResponse
+func (c *ClientWithResponses) ListRolloutsWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*ListRolloutsResponse, error) {
+	rsp, err := c.ListRollouts(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListRolloutsResponse(rsp)
+}
+
+// ClearRolloutWithResponse request returning *ClearRolloutResponse
+func (c *ClientWithResponses) ClearRolloutWithResponse(ctx context.Context, stage Stage, reqEditors ...RequestEditorFn) (*ClearRolloutResponse, error) {
+	rsp, err := c.ClearRollout(ctx, stage, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClearRolloutResponse(rsp)
+}
+
+// SetRolloutWithBodyWithResponse request with arbitrary body returning *SetRolloutResponse
+func (c *ClientWithResponses) SetRolloutWithBodyWithResponse(ctx context.Context, stage Stage, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SetRolloutResponse, error) {
+	rsp, err := c.SetRolloutWithBody(ctx, stage, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSetRolloutResponse(rsp)
+}
+
+func (c *ClientWithResponses) SetRolloutWithResponse(ctx context.Context, stage Stage, body SetRolloutJSONRequestBody, reqEditors ...RequestEditorFn) (*SetRolloutResponse, error) {
+	rsp, err := c.SetRollout(ctx, stage, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSetRolloutResponse(rsp)
+}
+
+// GetRoutingTableWithResponse request returning *GetRoutingTableResponse
+func (c *ClientWithResponses) GetRoutingTableWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetRoutingTableResponse, error) {
+	rsp, err := c.GetRoutingTable(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetRoutingTableResponse(rsp)
+}
+
+// PostRoutingFeedbackWithBodyWithResponse request with arbitrary body returning *PostRoutingFeedbackResponse
+func (c *ClientWithResponses) PostRoutingFeedbackWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PostRoutingFeedbackResponse, error) {
+	rsp, err := c.PostRoutingFeedbackWithBody(ctx, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePostRoutingFeedbackResponse(rsp)
+}
+
+func (c *ClientWithResponses) PostRoutingFeedbackWithResponse(ctx context.Context, body PostRoutingFeedbackJSONRequestBody, reqEditors ...RequestEditorFn) (*PostRoutingFeedbackResponse, error) {
+	rsp, err := c.PostRoutingFeedback(ctx, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePostRoutingFeedbackResponse(rsp)
+}
+
+// ListUpstreamErrorsWithResponse request returning *ListUpstreamErrorsResponse
+func (c *ClientWithResponses) ListUpstreamErrorsWithResponse(ctx context.Context, params *ListUpstreamErrorsParams, reqEditors ...RequestEditorFn) (*ListUpstreamErrorsResponse, error) {
+	rsp, err := c.ListUpstreamErrors(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseListUpstreamErrorsResponse(rsp)
+}
+
+// ParseClassifyResponse parses an HTTP response from a ClassifyWithResponse call
+func ParseClassifyResponse(rsp *http.Response) (*ClassifyResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ClassifyResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Classification
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParsePostApplicationFeedbackResponse parses an HTTP response from a PostApplicationFeedbackWithResponse call
+func ParsePostApplicationFeedbackResponse(rsp *http.Response) (*PostApplicationFeedbackResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PostApplicationFeedbackResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListModelRecommendationsResponse parses an HTTP response from a ListModelRecommendationsWithResponse call
+func ParseListModelRecommendationsResponse(rsp *http.Response) (*ListModelRecommendationsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListModelRecommendationsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []ModelRecommendation
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseFlushCacheResponse parses an HTTP response from a FlushCacheWithResponse call
+func ParseFlushCacheResponse(rsp *http.Response) (*FlushCacheResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &FlushCacheResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest CacheFlush
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 501:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON501 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListCacheEntriesResponse parses an HTTP response from a ListCacheEntriesWithResponse call
+func ParseListCacheEntriesResponse(rsp *http.Response) (*ListCacheEntriesResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListCacheEntriesResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []CacheEntry
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 501:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON501 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListPendingRequestsResponse parses an HTTP response from a ListPendingRequestsWithResponse call
+func ParseListPendingRequestsResponse(rsp *http.Response) (*ListPendingRequestsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListPendingRequestsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []CacheEntry
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListCircuitsResponse parses an HTTP response from a ListCircuitsWithResponse call
+func ParseListCircuitsResponse(rsp *http.Response) (*ListCircuitsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListCircuitsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []Circuit
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListChannelzChannelsResponse parses an HTTP response from a ListChannelzChannelsWithResponse call
+func ParseListChannelzChannelsResponse(rsp *http.Response) (*ListChannelzChannelsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListChannelzChannelsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Channelz
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListChannelzServersResponse parses an HTTP response from a ListChannelzServersWithResponse call
+func ParseListChannelzServersResponse(rsp *http.Response) (*ListChannelzServersResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListChannelzServersResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Channelz
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListChannelzServerSocketsResponse parses an HTTP response from a ListChannelzServerSocketsWithResponse call
+func ParseListChannelzServerSocketsResponse(rsp *http.Response) (*ListChannelzServerSocketsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListChannelzServerSocketsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Channelz
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetChannelzSocketResponse parses an HTTP response from a GetChannelzSocketWithResponse call
+func ParseGetChannelzSocketResponse(rsp *http.Response) (*GetChannelzSocketResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetChannelzSocketResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Channelz
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetChannelzSubchannelResponse parses an HTTP response from a GetChannelzSubchannelWithResponse call
+func ParseGetChannelzSubchannelResponse(rsp *http.Response) (*GetChannelzSubchannelResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetChannelzSubchannelResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Channelz
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListTracesResponse parses an HTTP response from a ListTracesWithResponse call
+func ParseListTracesResponse(rsp *http.Response) (*ListTracesResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListTracesResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []Trace
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetTraceResponse parses an HTTP response from a GetTraceWithResponse call
+func ParseGetTraceResponse(rsp *http.Response) (*GetTraceResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetTraceResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Trace
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetPromptLengthsResponse parses an HTTP response from a GetPromptLengthsWithResponse call
+func ParseGetPromptLengthsResponse(rsp *http.Response) (*GetPromptLengthsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetPromptLengthsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest PromptLengthReport
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListRecentDecisionsResponse parses an HTTP response from a ListRecentDecisionsWithResponse call
+func ParseListRecentDecisionsResponse(rsp *http.Response) (*ListRecentDecisionsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListRecentDecisionsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListCategoryCandidatesResponse parses an HTTP response from a ListCategoryCandidatesWithResponse call
+func ParseListCategoryCandidatesResponse(rsp *http.Response) (*ListCategoryCandidatesResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListCategoryCandidatesResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []CategoryCandidate
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetFingerprintResponse parses an HTTP response from a GetFingerprintWithResponse call
+func ParseGetFingerprintResponse(rsp *http.Response) (*GetFingerprintResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetFingerprintResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Fingerprint
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListFlagsResponse parses an HTTP response from a ListFlagsWithResponse call
+func ParseListFlagsResponse(rsp *http.Response) (*ListFlagsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListFlagsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Flags
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseSetFlagResponse parses an HTTP response from a SetFlagWithResponse call
+func ParseSetFlagResponse(rsp *http.Response) (*SetFlagResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SetFlagResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Flags
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetHealthResponse parses an HTTP response from a GetHealthWithResponse call
+func ParseGetHealthResponse(rsp *http.Response) (*GetHealthResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetHealthResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Health
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetReadinessResponse parses an HTTP response from a GetReadinessWithResponse call
+func ParseGetReadinessResponse(rsp *http.Response) (*GetReadinessResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetReadinessResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Readiness
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 503:
+		var dest Readiness
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON503 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListRolloutsResponse parses an HTTP response from a ListRolloutsWithResponse call
+func ParseListRolloutsResponse(rsp *http.Response) (*ListRolloutsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListRolloutsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Rollouts
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseClearRolloutResponse parses an HTTP response from a ClearRolloutWithResponse call
+func ParseClearRolloutResponse(rsp *http.Response) (*ClearRolloutResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ClearRolloutResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Rollouts
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseSetRolloutResponse parses an HTTP response from a SetRolloutWithResponse call
+func ParseSetRolloutResponse(rsp *http.Response) (*SetRolloutResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SetRolloutResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Rollouts
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetRoutingTableResponse parses an HTTP response from a GetRoutingTableWithResponse call
+func ParseGetRoutingTableResponse(rsp *http.Response) (*GetRoutingTableResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetRoutingTableResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest RoutingTable
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParsePostRoutingFeedbackResponse parses an HTTP response from a PostRoutingFeedbackWithResponse call
+func ParsePostRoutingFeedbackResponse(rsp *http.Response) (*PostRoutingFeedbackResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PostRoutingFeedbackResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseListUpstreamErrorsResponse parses an HTTP response from a ListUpstreamErrorsWithResponse call
+func ParseListUpstreamErrorsResponse(rsp *http.Response) (*ListUpstreamErrorsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListUpstreamErrorsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []UpstreamError
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest Error
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
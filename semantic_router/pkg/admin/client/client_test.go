@@ -0,0 +1,56 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/admin"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/admin/client"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/flags"
+)
+
+func TestClientAgainstAdminServer(t *testing.T) {
+	stageFlags, _ := flags.New(flags.Options{})
+	server := httptest.NewServer(admin.NewServer(admin.Options{Flags: stageFlags}).Handler())
+	defer server.Close()
+
+	c, err := client.NewClientWithResponses(server.URL)
+	if err != nil {
+		t.Fatalf("NewClientWithResponses: %v", err)
+	}
+	ctx := context.Background()
+
+	setFlag, err := c.SetFlagWithResponse(ctx, flags.StageCache, client.FlagUpdate{Enabled: false})
+	if err != nil || setFlag.JSON200 == nil {
+		t.Fatalf("SetFlag: %v, status %d", err, setFlag.StatusCode())
+	}
+	if (*setFlag.JSON200)[flags.StageCache] {
+		t.Error("expected the cache stage to be disabled")
+	}
+
+	unknown, err := c.SetFlagWithResponse(ctx, "jailbreak", client.FlagUpdate{Enabled: false})
+	if err != nil || unknown.StatusCode() != http.StatusNotFound || unknown.JSON404 == nil || unknown.JSON404.Error == "" {
+		t.Errorf("expected a 404 error for an unknown stage, got %v, status %d", err, unknown.StatusCode())
+	}
+
+	start := 10.0
+	setRollout, err := c.SetRolloutWithResponse(ctx, flags.StageMutation, client.RolloutUpdate{StartPercent: &start, TargetPercent: 50})
+	if err != nil || setRollout.JSON200 == nil {
+		t.Fatalf("SetRollout: %v, status %d", err, setRollout.StatusCode())
+	}
+	if rollout := (*setRollout.JSON200)[flags.StageMutation]; rollout.TargetPercent != 50 || rollout.CurrentPercent != 50 {
+		t.Errorf("unexpected rollout: %+v", rollout)
+	}
+
+	cleared, err := c.ClearRolloutWithResponse(ctx, flags.StageMutation)
+	if err != nil || cleared.JSON200 == nil || len(*cleared.JSON200) != 0 {
+		t.Errorf("ClearRollout: %v, rollouts %v", err, cleared.JSON200)
+	}
+
+	listed, err := c.ListFlagsWithResponse(ctx)
+	if err != nil || listed.JSON200 == nil || (*listed.JSON200)[flags.StageCache] {
+		t.Errorf("ListFlags: %v, flags %v", err, listed.JSON200)
+	}
+}
@@ -0,0 +1,5 @@
+// Package client is a Go client for the semantic router admin API, generated
+// from ../openapi.yaml. Do not edit client.gen.go by hand.
+package client
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.4.1 -config oapi-codegen.yaml ../openapi.yaml
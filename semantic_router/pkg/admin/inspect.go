@@ -0,0 +1,264 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+)
+
+// cacheEntry describes a semantic cache entry in API responses, without its
+// embedding and bodies
+type cacheEntry struct {
+	ID            string    `json:"id"`
+	Model         string    `json:"model"`
+	Epoch         string    `json:"epoch,omitempty"`
+	Query         string    `json:"query"`
+	CreatedAt     time.Time `json:"created_at"`
+	AgeSeconds    float64   `json:"age_seconds"`
+	ResponseBytes int       `json:"response_bytes"`
+}
+
+func newCacheEntry(entry cache.CacheEntry, now time.Time) cacheEntry {
+	return cacheEntry{
+		ID:            entry.ID,
+		Model:         entry.Model,
+		Epoch:         entry.Epoch,
+		Query:         entry.Query,
+		CreatedAt:     entry.Timestamp,
+		AgeSeconds:    now.Sub(entry.Timestamp).Seconds(),
+		ResponseBytes: len(entry.ResponseBody),
+	}
+}
+
+// listedEntries returns up to limit entries, newest first, from entries
+// sorted oldest first
+func listedEntries(entries []cache.CacheEntry, limit int) []cacheEntry {
+	if limit <= 0 || limit > len(entries) {
+		limit = len(entries)
+	}
+	now := time.Now()
+	listed := make([]cacheEntry, 0, limit)
+	for i := len(entries) - 1; i >= len(entries)-limit; i-- {
+		listed = append(listed, newCacheEntry(entries[i], now))
+	}
+	return listed
+}
+
+// queryLimit parses the optional limit query parameter, 0 when unset
+func queryLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, errors.New("limit must be a non-negative integer")
+	}
+	return limit, nil
+}
+
+// enabledCache returns the semantic cache, writing an error if it is disabled
+func (s *Server) enabledCache(w http.ResponseWriter) *cache.SemanticCache {
+	if s.options.Cache == nil || !s.options.Cache.IsEnabled() {
+		writeError(w, http.StatusNotFound, "semantic cache disabled")
+		return nil
+	}
+	return s.options.Cache
+}
+
+func (s *Server) handleListCacheEntries(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c := s.enabledCache(w)
+	if c == nil {
+		return
+	}
+	entries, err := c.Entries()
+	if errors.Is(err, cache.ErrNotListable) {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, listedEntries(entries, limit))
+}
+
+// flushResult is the response of a cache flush
+type flushResult struct {
+	Flushed int `json:"flushed"`
+}
+
+func (s *Server) handleFlushCache(w http.ResponseWriter, r *http.Request) {
+	c := s.enabledCache(w)
+	if c == nil {
+		return
+	}
+	flushed, err := c.Flush()
+	if errors.Is(err, cache.ErrNotListable) {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	log.Printf("Admin API flushed %d cache entries (from %s)", flushed, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, flushResult{Flushed: flushed})
+}
+
+func (s *Server) handleListPending(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c := s.enabledCache(w)
+	if c == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, listedEntries(c.Pending(), limit))
+}
+
+// routingTable describes how the current config routes requests
+type routingTable struct {
+	Strategy                 string          `json:"strategy"`
+	DefaultModel             string          `json:"default_model"`
+	ClassifierThreshold      float32         `json:"classifier_threshold"`
+	SimilarityThreshold      float32         `json:"similarity_threshold"`
+	CacheEnabled             bool            `json:"cache_enabled"`
+	CacheSimilarityThreshold float32         `json:"cache_similarity_threshold"`
+	Categories               []routingTarget `json:"categories"`
+}
+
+// routingTarget describes the routing of a category
+type routingTarget struct {
+	Name                string   `json:"name"`
+	Models              []string `json:"models"`
+	ConfidenceThreshold float32  `json:"confidence_threshold"`
+	ReasoningEffort     string   `json:"reasoning_effort,omitempty"`
+	Blocked             bool     `json:"blocked,omitempty"`
+}
+
+func newRoutingTable(cfg *config.RouterConfig) routingTable {
+	table := routingTable{
+		Strategy:                 cfg.GetRoutingStrategy(),
+		DefaultModel:             cfg.DefaultModel,
+		ClassifierThreshold:      cfg.Classifier.Threshold,
+		SimilarityThreshold:      cfg.BertModel.Threshold,
+		CacheEnabled:             cfg.SemanticCache.Enabled,
+		CacheSimilarityThreshold: cfg.GetCacheSimilarityThreshold(),
+		Categories:               make([]routingTarget, 0, len(cfg.Categories)),
+	}
+	for _, category := range cfg.Categories {
+		models := category.Models
+		if models == nil {
+			models = []string{}
+		}
+		table.Categories = append(table.Categories, routingTarget{
+			Name:                category.Name,
+			Models:              models,
+			ConfidenceThreshold: cfg.GetClassifierThreshold(category),
+			ReasoningEffort:     category.ReasoningEffort,
+			Blocked:             category.Blocked,
+		})
+	}
+	return table
+}
+
+func (s *Server) handleRoutingTable(w http.ResponseWriter, r *http.Request) {
+	if s.options.Config == nil {
+		writeError(w, http.StatusNotFound, "routing table not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoutingTable(s.options.Config()))
+}
+
+func (s *Server) handleRecentDecisions(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	records := s.options.Decisions.Recent(limit)
+	encoded := make([]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		data, err := decision.MarshalJSON(record)
+		if err != nil {
+			log.Printf("Error encoding decision record: %v", err)
+			continue
+		}
+		encoded = append(encoded, data)
+	}
+	writeJSON(w, http.StatusOK, encoded)
+}
+
+func (s *Server) handlePromptLengths(w http.ResponseWriter, r *http.Request) {
+	if s.options.Decisions == nil || s.options.Config == nil {
+		writeError(w, http.StatusNotFound, "no decision records kept")
+		return
+	}
+	limit, err := queryLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg := s.options.Config()
+	writeJSON(w, http.StatusOK, decision.AnalyzePromptLengths(s.options.Decisions.Recent(limit), decision.PromptLengthOptions{
+		Models: func(category string) []string {
+			if category == "" {
+				return []string{cfg.DefaultModel}
+			}
+			return cfg.GetCandidateModelsForCategory(category)
+		},
+		ContextWindow: cfg.GetModelContextWindow,
+	}))
+}
+
+func (s *Server) handleListCircuits(w http.ResponseWriter, r *http.Request) {
+	var circuits []breaker.Circuit
+	if s.options.Circuits != nil {
+		circuits = s.options.Circuits()
+	}
+	if circuits == nil {
+		writeError(w, http.StatusNotFound, "circuit breaker disabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, circuits)
+}
+
+// UpstreamError is an error response of a model's backend
+type UpstreamError struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	// Model the request was routed to
+	Model  string `json:"model"`
+	Status int    `json:"status"`
+	// Type the error is counted by, e.g. context_length_exceeded or rate_limit
+	Type string `json:"type"`
+	// Type, code and message of the response's OpenAI error envelope
+	UpstreamType string `json:"upstream_type,omitempty"`
+	Code         string `json:"code,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+func (s *Server) handleListUpstreamErrors(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var upstreamErrors []UpstreamError
+	if s.options.UpstreamErrors != nil {
+		upstreamErrors = s.options.UpstreamErrors(limit)
+	}
+	if upstreamErrors == nil {
+		writeError(w, http.StatusNotFound, "no upstream errors kept")
+		return
+	}
+	writeJSON(w, http.StatusOK, upstreamErrors)
+}
@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+)
+
+// serve sends a request to the handler and decodes the JSON response into v
+func serve(t *testing.T, handler http.Handler, method, path string, v interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	if v != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("invalid response to %s %s: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestCacheAPI(t *testing.T) {
+	c := cache.NewSemanticCache(cache.SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc:           func(text string) ([]float32, error) { return []float32{1, 0}, nil },
+	})
+	for _, query := range []string{"first", "second"} {
+		if err := c.AddEntry("phi4", query, []byte(query), []byte(`{"answer":42}`)); err != nil {
+			t.Fatalf("AddEntry: %v", err)
+		}
+	}
+	if _, err := c.AddPendingRequest("phi4", "waiting", []byte(`{}`)); err != nil {
+		t.Fatalf("AddPendingRequest: %v", err)
+	}
+	handler := NewServer(Options{Cache: c}).Handler()
+
+	var entries []cacheEntry
+	if status := serve(t, handler, http.MethodGet, "/cache/entries", &entries); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(entries) != 2 || entries[0].Query != "second" || entries[0].ResponseBytes != len(`{"answer":42}`) {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if serve(t, handler, http.MethodGet, "/cache/entries?limit=1", &entries); len(entries) != 1 {
+		t.Errorf("limit=1 listed %d entries", len(entries))
+	}
+	if status := serve(t, handler, http.MethodGet, "/cache/entries?limit=-1", nil); status != http.StatusBadRequest {
+		t.Errorf("status for a negative limit = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	var pending []cacheEntry
+	if serve(t, handler, http.MethodGet, "/cache/pending", &pending); len(pending) != 1 || pending[0].Query != "waiting" {
+		t.Errorf("unexpected pending requests: %+v", pending)
+	}
+
+	var flushed flushResult
+	if status := serve(t, handler, http.MethodDelete, "/cache/entries", &flushed); status != http.StatusOK || flushed.Flushed != 3 {
+		t.Errorf("flush = %d with %+v, want 3 entries flushed", status, flushed)
+	}
+	if serve(t, handler, http.MethodGet, "/cache/entries", &entries); len(entries) != 0 {
+		t.Errorf("%d entries left after a flush", len(entries))
+	}
+
+	disabled := NewServer(Options{}).Handler()
+	if status := serve(t, disabled, http.MethodGet, "/cache/entries", nil); status != http.StatusNotFound {
+		t.Errorf("status without a cache = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestRoutingAPI(t *testing.T) {
+	strict := float32(0.9)
+	cfg := &config.RouterConfig{
+		DefaultModel: "phi4",
+		Categories: []config.Category{
+			{Name: "math", Models: []string{"qwen", "phi4"}},
+			{Name: "law", Models: []string{"llama"}, ConfidenceThreshold: &strict, Blocked: true},
+		},
+	}
+	cfg.Classifier.Threshold = 0.6
+	cfg.Classifier.CategoryMappingPath = "mapping.json"
+	handler := NewServer(Options{Config: func() *config.RouterConfig { return cfg }}).Handler()
+
+	var table routingTable
+	if status := serve(t, handler, http.MethodGet, "/routing", &table); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if table.Strategy != config.RoutingStrategyClassifier || table.DefaultModel != "phi4" || len(table.Categories) != 2 {
+		t.Fatalf("unexpected routing table: %+v", table)
+	}
+	if math := table.Categories[0]; math.ConfidenceThreshold != 0.6 || len(math.Models) != 2 || math.Models[0] != "qwen" {
+		t.Errorf("unexpected math routing: %+v", math)
+	}
+	if law := table.Categories[1]; law.ConfidenceThreshold != 0.9 || !law.Blocked {
+		t.Errorf("unexpected law routing: %+v", law)
+	}
+}
+
+func TestCircuitsAPI(t *testing.T) {
+	handler := NewServer(Options{}).Handler()
+	if status := serve(t, handler, http.MethodGet, "/circuits", nil); status != http.StatusNotFound {
+		t.Errorf("status without a circuit breaker = %d, want 404", status)
+	}
+
+	breakers := breaker.New(breaker.Options{MinRequests: 1})
+	breakers.Record("phi4", false, 0)
+	handler = NewServer(Options{Circuits: breakers.Circuits}).Handler()
+	var circuits []breaker.Circuit
+	if status := serve(t, handler, http.MethodGet, "/circuits", &circuits); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(circuits) != 1 || circuits[0].Model != "phi4" || circuits[0].State != breaker.StateOpen {
+		t.Errorf("circuits = %+v", circuits)
+	}
+}
+
+func TestUpstreamErrorsAPI(t *testing.T) {
+	handler := NewServer(Options{UpstreamErrors: func(int) []UpstreamError { return nil }}).Handler()
+	if status := serve(t, handler, http.MethodGet, "/upstream/errors", nil); status != http.StatusNotFound {
+		t.Errorf("status without kept errors = %d, want 404", status)
+	}
+
+	kept := []UpstreamError{{RequestID: "b", Type: "rate_limit"}, {RequestID: "a", Type: "server"}}
+	handler = NewServer(Options{UpstreamErrors: func(limit int) []UpstreamError {
+		if limit > 0 && limit < len(kept) {
+			return kept[:limit]
+		}
+		return kept
+	}}).Handler()
+	var upstreamErrors []UpstreamError
+	if status := serve(t, handler, http.MethodGet, "/upstream/errors?limit=1", &upstreamErrors); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(upstreamErrors) != 1 || upstreamErrors[0].RequestID != "b" || upstreamErrors[0].Type != "rate_limit" {
+		t.Errorf("upstream errors = %+v", upstreamErrors)
+	}
+	if status := serve(t, handler, http.MethodGet, "/upstream/errors?limit=x", nil); status != http.StatusBadRequest {
+		t.Errorf("status with an invalid limit = %d, want 400", status)
+	}
+}
+
+func TestPromptLengthsAPI(t *testing.T) {
+	if status := serve(t, NewServer(Options{}).Handler(), http.MethodGet, "/decisions/prompt-lengths", nil); status != http.StatusNotFound {
+		t.Errorf("status without decision records = %d, want 404", status)
+	}
+
+	sink := decision.NewRingSink(10)
+	for _, id := range []string{"req-1", "req-2"} {
+		record := decision.New(id)
+		record.Routing.Category = "coding"
+		record.Routing.SelectedModel = "qwen"
+		record.Usage.PromptTokens = 9000
+		sink.Write(record)
+	}
+	cfg := &config.RouterConfig{
+		DefaultModel: "phi4",
+		Categories:   []config.Category{{Name: "coding", Models: []string{"qwen"}}},
+		ModelConfig:  map[string]config.ModelParams{"qwen": {ContextWindow: 8192}, "phi4": {ContextWindow: 16384}},
+	}
+	handler := NewServer(Options{Decisions: sink, Config: func() *config.RouterConfig { return cfg }}).Handler()
+
+	var report decision.PromptLengthReport
+	if status := serve(t, handler, http.MethodGet, "/decisions/prompt-lengths", &report); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(report.Categories) != 1 || report.Categories[0].ExceedingPrimary != 2 || report.Categories[0].ContextWindow != 8192 {
+		t.Errorf("categories = %+v", report.Categories)
+	}
+	// Too few requests to warn about
+	if len(report.Warnings) != 0 {
+		t.Errorf("warnings = %q", report.Warnings)
+	}
+	if status := serve(t, handler, http.MethodGet, "/decisions/prompt-lengths?limit=x", nil); status != http.StatusBadRequest {
+		t.Errorf("status with an invalid limit = %d, want 400", status)
+	}
+}
+
+func TestRecentDecisionsAPI(t *testing.T) {
+	sink := decision.NewRingSink(10)
+	for _, id := range []string{"req-1", "req-2", "req-3"} {
+		record := decision.New(id)
+		record.Routing.SelectedModel = "phi4"
+		sink.Write(record)
+	}
+	handler := NewServer(Options{Decisions: sink}).Handler()
+
+	var records []map[string]interface{}
+	if status := serve(t, handler, http.MethodGet, "/decisions/recent?limit=2", &records); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(records) != 2 || records[0]["request_id"] != "req-3" || records[1]["request_id"] != "req-2" {
+		t.Errorf("unexpected records: %v", records)
+	}
+
+	// Without kept records the list is empty rather than null
+	rec := httptest.NewRecorder()
+	NewServer(Options{}).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/decisions/recent", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "[]\n" {
+		t.Errorf("response without records = %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/feedback"
+)
+
+// routingFeedbackRequest is the body of feedback on a routed request
+type routingFeedbackRequest struct {
+	RequestID string `json:"request_id"`
+	Kind      string `json:"kind"`
+}
+
+func (s *Server) handleRoutingFeedback(w http.ResponseWriter, r *http.Request) {
+	if s.options.RoutingFeedback == nil {
+		writeError(w, http.StatusNotFound, "routing feedback disabled")
+		return
+	}
+	var req routingFeedbackRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.RequestID == "" || req.Kind == "" {
+		writeError(w, http.StatusBadRequest, `expected a body like {"request_id": "...", "kind": "misrouted"}`)
+		return
+	}
+	if err := s.options.RoutingFeedback(req.RequestID, req.Kind); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, feedback.ErrUnknownKind):
+			status = http.StatusBadRequest
+		case errors.Is(err, feedback.ErrUnknownRequest):
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
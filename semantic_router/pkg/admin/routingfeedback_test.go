@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/feedback"
+)
+
+func TestRoutingFeedbackAPI(t *testing.T) {
+	post := func(handler http.Handler, body string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/routing/feedback", strings.NewReader(body)))
+		return rec.Code
+	}
+	if status := post(NewServer(Options{}).Handler(), `{"request_id":"req-1","kind":"misrouted"}`); status != http.StatusNotFound {
+		t.Errorf("status with feedback disabled = %d, want %d", status, http.StatusNotFound)
+	}
+
+	tuner := feedback.New(feedback.Options{})
+	tuner.Observe("req-1", feedback.Request{Category: "math"})
+	handler := NewServer(Options{RoutingFeedback: func(requestID, kind string) error {
+		_, err := tuner.Submit(requestID, kind)
+		return err
+	}}).Handler()
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"request_id":"req-1","kind":"misrouted"}`, http.StatusNoContent},
+		{`{"request_id":"req-9","kind":"misrouted"}`, http.StatusNotFound},
+		{`{"request_id":"req-1","kind":"great"}`, http.StatusBadRequest},
+		{`{"request_id":"req-1"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status := post(handler, tt.body); status != tt.want {
+			t.Errorf("feedback %s status = %d, want %d", tt.body, status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package archive streams the conversations of tenants under a compliance
+// hold to an archival sink, such as a webhook or an S3 bucket, so they can be
+// retained for legal holds without archiving every tenant's traffic.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Outcomes of archiving an exchange
+const (
+	OutcomeArchived = "archived"
+	OutcomeFailed   = "failed"
+	OutcomeDropped  = "dropped"
+)
+
+// Exchange is a request and the response it got, as archived
+type Exchange struct {
+	RequestID string    `json:"request_id"`
+	Tenant    string    `json:"tenant"`
+	Timestamp time.Time `json:"timestamp"`
+	// Model that served the request
+	Model          string `json:"model,omitempty"`
+	ResponseStatus int    `json:"response_status,omitempty"`
+	// Request and response bodies, with PII redacted. Bodies that are not
+	// JSON are archived as strings.
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Sink stores archived exchanges
+type Sink interface {
+	// Store stores an encoded exchange under a key unique to it
+	Store(ctx context.Context, key string, body []byte) error
+}
+
+// Options holds options for creating a new archiver
+type Options struct {
+	Sink Sink
+	// Prepended to the key of every exchange, e.g. conversations/
+	Prefix string
+	// Exchanges waiting to be stored; exchanges beyond it are dropped,
+	// defaults to 1000
+	QueueSize int
+	// Timeout of storing an exchange, defaults to 10s
+	Timeout time.Duration
+	// Attempts to store an exchange before it is given up, defaults to 3
+	MaxAttempts int
+	// Redacts an exchange in the background before it is stored, so redaction
+	// does not delay responses; nil stores exchanges as archived
+	Redact func(*Exchange)
+}
+
+// Archiver stores exchanges with its sink in the background, so archiving does
+// not delay responses
+type Archiver struct {
+	options Options
+	queue   chan *Exchange
+	// Time between attempts to store an exchange, doubled after each
+	backoff time.Duration
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New creates a new archiver with the given options
+func New(options Options) *Archiver {
+	if options.QueueSize <= 0 {
+		options.QueueSize = 1000
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 3
+	}
+	return &Archiver{
+		options: options,
+		queue:   make(chan *Exchange, options.QueueSize),
+		backoff: time.Second,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Archive queues an exchange to be stored, dropping it when the queue is full.
+// A nil archiver archives nothing.
+func (a *Archiver) Archive(exchange *Exchange) {
+	if a == nil {
+		return
+	}
+	exchange.Request = rawJSON(exchange.Request)
+	if len(exchange.Response) > 0 {
+		exchange.Response = rawJSON(exchange.Response)
+	}
+	select {
+	case a.queue <- exchange:
+	default:
+		log.Printf("Archive queue full, dropping exchange of request %s of tenant %s", exchange.RequestID, exchange.Tenant)
+		metrics.RecordComplianceArchive(exchange.Tenant, OutcomeDropped)
+	}
+}
+
+// rawJSON returns a body as JSON, quoting it as a string if it is not JSON
+func rawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// Key returns the key an exchange is stored under, grouping exchanges by
+// tenant and day
+func (a *Archiver) Key(exchange *Exchange) string {
+	return fmt.Sprintf("%s%s/%s/%s.json", a.options.Prefix, keySegment(exchange.Tenant),
+		exchange.Timestamp.UTC().Format("2006/01/02"), keySegment(exchange.RequestID))
+}
+
+// keySegment keeps a client supplied value from adding levels to a key
+func keySegment(value string) string {
+	return strings.ReplaceAll(value, "/", "_")
+}
+
+// Start stores the queued exchanges in the background
+func (a *Archiver) Start() {
+	go func() {
+		defer close(a.done)
+		for {
+			select {
+			case exchange := <-a.queue:
+				a.store(exchange)
+			case <-a.stop:
+				// Store what is still queued before stopping
+				for {
+					select {
+					case exchange := <-a.queue:
+						a.store(exchange)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop stores the queued exchanges and stops
+func (a *Archiver) Stop() {
+	a.once.Do(func() {
+		close(a.stop)
+	})
+	<-a.done
+}
+
+// store stores an exchange with the sink, retrying failures with backoff
+func (a *Archiver) store(exchange *Exchange) {
+	if a.options.Redact != nil {
+		a.options.Redact(exchange)
+	}
+	body, err := json.Marshal(exchange)
+	if err != nil {
+		log.Printf("Error encoding exchange of request %s: %v", exchange.RequestID, err)
+		metrics.RecordComplianceArchive(exchange.Tenant, OutcomeFailed)
+		return
+	}
+	key := a.Key(exchange)
+	backoff := a.backoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), a.options.Timeout)
+		err = a.options.Sink.Store(ctx, key, body)
+		cancel()
+		if err == nil {
+			metrics.RecordComplianceArchive(exchange.Tenant, OutcomeArchived)
+			return
+		}
+		if attempt >= a.options.MaxAttempts {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	log.Printf("Error archiving exchange of request %s of tenant %s after %d attempts: %v",
+		exchange.RequestID, exchange.Tenant, a.options.MaxAttempts, err)
+	metrics.RecordComplianceArchive(exchange.Tenant, OutcomeFailed)
+}
+
+// WebhookSink posts every exchange as JSON to a URL
+type WebhookSink struct {
+	URL string
+	// Authorization header sent with every exchange, if any
+	Authorization string
+	Client        *http.Client
+}
+
+// Store posts an exchange, with its key in the X-Archive-Key header
+func (s *WebhookSink) Store(ctx context.Context, key string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Archive-Key", key)
+	if s.Authorization != "" {
+		req.Header.Set("Authorization", s.Authorization)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// memorySink stores exchanges in memory, failing the first failures attempts
+type memorySink struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	stored   map[string][]byte
+}
+
+func (s *memorySink) Store(_ context.Context, key string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("unavailable")
+	}
+	if s.stored == nil {
+		s.stored = make(map[string][]byte)
+	}
+	s.stored[key] = body
+	return nil
+}
+
+func TestArchiver(t *testing.T) {
+	sink := &memorySink{failures: 1}
+	archiver := New(Options{Sink: sink, Prefix: "conversations/"})
+	archiver.backoff = time.Millisecond
+	before := testutil.ToFloat64(metrics.ComplianceArchive.WithLabelValues("acme/eu", OutcomeArchived))
+	archiver.Start()
+	archiver.Archive(&Exchange{
+		RequestID:      "req-1",
+		Tenant:         "acme/eu",
+		Timestamp:      time.Date(2025, 3, 1, 23, 30, 0, 0, time.FixedZone("", -2*3600)),
+		Model:          "math-model",
+		ResponseStatus: http.StatusBadGateway,
+		Request:        []byte(`{"model":"auto"}`),
+		Response:       []byte("upstream connect error"),
+	})
+	archiver.Stop()
+
+	body, ok := sink.stored["conversations/acme_eu/2025/03/02/req-1.json"]
+	if !ok {
+		t.Fatalf("exchange not stored under the expected key, stored %v", sink.stored)
+	}
+	var exchange map[string]interface{}
+	if err := json.Unmarshal(body, &exchange); err != nil {
+		t.Fatalf("stored exchange is not JSON: %v", err)
+	}
+	if exchange["request"].(map[string]interface{})["model"] != "auto" || exchange["response"] != "upstream connect error" {
+		t.Errorf("stored exchange %s", body)
+	}
+	if got := testutil.ToFloat64(metrics.ComplianceArchive.WithLabelValues("acme/eu", OutcomeArchived)) - before; got != 1 {
+		t.Errorf("archived count increased by %v, want 1", got)
+	}
+}
+
+func TestArchiverGivesUp(t *testing.T) {
+	sink := &memorySink{failures: 10}
+	archiver := New(Options{Sink: sink, MaxAttempts: 2})
+	archiver.backoff = time.Millisecond
+	before := testutil.ToFloat64(metrics.ComplianceArchive.WithLabelValues("acme", OutcomeFailed))
+	archiver.Start()
+	archiver.Archive(&Exchange{RequestID: "req-1", Tenant: "acme", Request: []byte(`{}`)})
+	archiver.Stop()
+
+	if sink.attempts != 2 {
+		t.Errorf("attempts = %d, want 2", sink.attempts)
+	}
+	if got := testutil.ToFloat64(metrics.ComplianceArchive.WithLabelValues("acme", OutcomeFailed)) - before; got != 1 {
+		t.Errorf("failed count increased by %v, want 1", got)
+	}
+}
+
+func TestArchiverDropsWhenFull(t *testing.T) {
+	archiver := New(Options{Sink: &memorySink{}, QueueSize: 1})
+	before := testutil.ToFloat64(metrics.ComplianceArchive.WithLabelValues("acme", OutcomeDropped))
+	// Not started, so nothing leaves the queue
+	archiver.Archive(&Exchange{RequestID: "req-1", Tenant: "acme"})
+	archiver.Archive(&Exchange{RequestID: "req-2", Tenant: "acme"})
+	if got := testutil.ToFloat64(metrics.ComplianceArchive.WithLabelValues("acme", OutcomeDropped)) - before; got != 1 {
+		t.Errorf("dropped count increased by %v, want 1", got)
+	}
+
+	var none *Archiver
+	none.Archive(&Exchange{RequestID: "req-3"})
+}
+
+func TestWebhookSink(t *testing.T) {
+	var gotKey, gotAuth, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-Archive-Key")
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL, Authorization: "Bearer secret"}
+	if err := sink.Store(context.Background(), "acme/2025/03/01/req-1.json", []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if gotKey != "acme/2025/03/01/req-1.json" || gotAuth != "Bearer secret" || gotBody != `{"a":1}` {
+		t.Errorf("posted key %q, authorization %q, body %q", gotKey, gotAuth, gotBody)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if err := sink.Store(context.Background(), "key", nil); err == nil {
+		t.Error("Store succeeded on a 500")
+	}
+}
@@ -0,0 +1,174 @@
+package autoscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// SignalerOptions holds options for creating a new scale-up signaler
+type SignalerOptions struct {
+	Enabled      bool
+	WebhookURL   string
+	Window       time.Duration
+	GrowthFactor float64
+	MinRequests  int
+	Cooldown     time.Duration
+	Timeout      time.Duration
+	// Per-model webhook overrides
+	ModelWebhooks map[string]string
+}
+
+// ScaleUpEvent is the payload posted to the scale-up webhook
+type ScaleUpEvent struct {
+	Model            string    `json:"model"`
+	Category         string    `json:"category"`
+	CurrentRequests  int       `json:"current_requests"`
+	PreviousRequests int       `json:"previous_requests"`
+	WindowSeconds    float64   `json:"window_seconds"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// demandWindow tracks decision counts for the current and previous window
+type demandWindow struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// Signaler watches routing decision counts per category and calls a scale-up
+// webhook for the target model when demand is trending upward
+type Signaler struct {
+	options    SignalerOptions
+	client     *http.Client
+	mu         sync.Mutex
+	windows    map[string]*demandWindow
+	lastSignal map[string]time.Time
+}
+
+// NewSignaler creates a new scale-up signaler with the given options
+func NewSignaler(options SignalerOptions) *Signaler {
+	if options.Window <= 0 {
+		options.Window = time.Minute
+	}
+	if options.GrowthFactor <= 1 {
+		options.GrowthFactor = 1.5
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+	return &Signaler{
+		options:    options,
+		client:     &http.Client{Timeout: options.Timeout},
+		windows:    make(map[string]*demandWindow),
+		lastSignal: make(map[string]time.Time),
+	}
+}
+
+// IsEnabled returns whether scale-up signaling is enabled
+func (s *Signaler) IsEnabled() bool {
+	return s.options.Enabled
+}
+
+// RecordDecision records a routing decision for a category and fires the
+// scale-up webhook for the model if demand for the category is rising. A nil
+// Signaler records nothing.
+func (s *Signaler) RecordDecision(category, model string) {
+	if s == nil || !s.options.Enabled {
+		return
+	}
+
+	if event, ok := s.observe(category, model, time.Now()); ok {
+		go s.send(event)
+	}
+}
+
+// observe updates the demand window for a category and returns a scale-up
+// event if the trend crossed the configured growth factor
+func (s *Signaler) observe(category, model string, now time.Time) (ScaleUpEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[category]
+	if !ok {
+		w = &demandWindow{start: now}
+		s.windows[category] = w
+	}
+
+	// Rotate windows, dropping history if we skipped more than one window
+	if elapsed := now.Sub(w.start); elapsed >= s.options.Window {
+		if elapsed >= 2*s.options.Window {
+			w.previous = 0
+		} else {
+			w.previous = w.current
+		}
+		w.current = 0
+		w.start = now
+	}
+	w.current++
+
+	if w.current < s.options.MinRequests || w.previous == 0 {
+		return ScaleUpEvent{}, false
+	}
+	if float64(w.current) < float64(w.previous)*s.options.GrowthFactor {
+		return ScaleUpEvent{}, false
+	}
+	if last, ok := s.lastSignal[model]; ok && now.Sub(last) < s.options.Cooldown {
+		return ScaleUpEvent{}, false
+	}
+	s.lastSignal[model] = now
+
+	return ScaleUpEvent{
+		Model:            model,
+		Category:         category,
+		CurrentRequests:  w.current,
+		PreviousRequests: w.previous,
+		WindowSeconds:    s.options.Window.Seconds(),
+		Timestamp:        now,
+	}, true
+}
+
+// send posts the scale-up event to the webhook configured for the model
+func (s *Signaler) send(event ScaleUpEvent) {
+	url := s.options.WebhookURL
+	if override, ok := s.options.ModelWebhooks[event.Model]; ok && override != "" {
+		url = override
+	}
+	if url == "" {
+		return
+	}
+
+	log.Printf("Demand for category %s rising (%d -> %d), signaling scale-up for model %s",
+		event.Category, event.PreviousRequests, event.CurrentRequests, event.Model)
+
+	if err := s.post(url, event); err != nil {
+		log.Printf("Scale-up webhook error for model %s: %v", event.Model, err)
+		metrics.RecordAutoscaleSignal(event.Model, "error")
+		return
+	}
+	metrics.RecordAutoscaleSignal(event.Model, "success")
+}
+
+func (s *Signaler) post(url string, event ScaleUpEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scale-up event: %w", err)
+	}
+
+	resp, err := s.client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package autoscale
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserveSignalsOnRisingDemand(t *testing.T) {
+	s := NewSignaler(SignalerOptions{
+		Enabled:      true,
+		Window:       time.Minute,
+		GrowthFactor: 2,
+		MinRequests:  3,
+		Cooldown:     time.Hour,
+	})
+	start := time.Now()
+
+	// Previous window: 2 decisions
+	for i := 0; i < 2; i++ {
+		if _, ok := s.observe("math", "phi4", start); ok {
+			t.Fatal("unexpected signal without history")
+		}
+	}
+
+	// Current window: signal once decisions reach 2x the previous window
+	next := start.Add(time.Minute)
+	var signals int
+	for i := 0; i < 6; i++ {
+		if event, ok := s.observe("math", "phi4", next); ok {
+			signals++
+			if event.CurrentRequests != 4 || event.PreviousRequests != 2 {
+				t.Errorf("unexpected event counts: %+v", event)
+			}
+		}
+	}
+	if signals != 1 {
+		t.Errorf("expected exactly one signal within cooldown, got %d", signals)
+	}
+}
+
+func TestObserveResetsAfterIdleWindows(t *testing.T) {
+	s := NewSignaler(SignalerOptions{Enabled: true, Window: time.Minute, GrowthFactor: 2, MinRequests: 1})
+	start := time.Now()
+
+	s.observe("math", "phi4", start)
+	if _, ok := s.observe("math", "phi4", start.Add(3*time.Minute)); ok {
+		t.Error("expected no signal after idle windows")
+	}
+}
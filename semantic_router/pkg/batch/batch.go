@@ -0,0 +1,278 @@
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// OutcomeAbandoned is recorded for batches not reconciled within the maximum
+// age, besides the terminal status of reconciled batches
+const OutcomeAbandoned = "abandoned"
+
+// Batch is a batch created through the router, awaiting its results
+type Batch struct {
+	ID string
+	// Authorization header of the request creating the batch, used to poll it
+	// when no API key is configured
+	Authorization string
+	Created       time.Time
+}
+
+// Usage is the token usage of the requests of a batch served by one model
+type Usage struct {
+	BatchID          string
+	Model            string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Options holds options for creating a new reconciler
+type Options struct {
+	// Base URL of the OpenAI-compatible API serving the batches, e.g. https://api.openai.com
+	BaseURL string
+	// API key used to poll batches instead of the credentials they were created with
+	APIKey string
+	// Time between polls of the unfinished batches
+	Interval time.Duration
+	// Timeout of a single API call
+	Timeout time.Duration
+	// Age after which unfinished batches are no longer polled
+	MaxAge time.Duration
+	// Receives the usage of each model once a batch finishes
+	Record func(Usage)
+}
+
+// Reconciler tracks batches created through the router and attributes their
+// token usage once they finish, since Batch API requests are answered long
+// after the request creating them
+type Reconciler struct {
+	options Options
+	client  *http.Client
+	mu      sync.Mutex
+	batches map[string]Batch
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New creates a new reconciler with the given options
+func New(options Options) *Reconciler {
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Minute
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 30 * time.Second
+	}
+	if options.MaxAge <= 0 {
+		// Batches complete within a 24h window, plus time to cancel or expire
+		options.MaxAge = 48 * time.Hour
+	}
+	options.BaseURL = strings.TrimSuffix(options.BaseURL, "/")
+	return &Reconciler{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+		batches: make(map[string]Batch),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Track adds a batch to be reconciled once it finishes
+func (r *Reconciler) Track(batch Batch) {
+	if r == nil || batch.ID == "" {
+		return
+	}
+	if batch.Created.IsZero() {
+		batch.Created = time.Now()
+	}
+	r.mu.Lock()
+	r.batches[batch.ID] = batch
+	metrics.RecordBatchesPending(len(r.batches))
+	r.mu.Unlock()
+	log.Printf("Tracking batch %s for usage reconciliation", batch.ID)
+}
+
+// Pending returns the number of batches awaiting reconciliation
+func (r *Reconciler) Pending() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.batches)
+}
+
+// Start polls the unfinished batches in the background every interval
+func (r *Reconciler) Start() {
+	log.Printf("Starting batch reconciliation every %s", r.options.Interval)
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.RunOnce(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops the background polls and waits for the current one to finish
+func (r *Reconciler) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+}
+
+// RunOnce polls every unfinished batch once, reconciling the finished ones
+func (r *Reconciler) RunOnce(ctx context.Context) {
+	r.mu.Lock()
+	batches := make([]Batch, 0, len(r.batches))
+	for _, batch := range r.batches {
+		batches = append(batches, batch)
+	}
+	r.mu.Unlock()
+	sort.Slice(batches, func(i, j int) bool { return batches[i].Created.Before(batches[j].Created) })
+
+	for _, batch := range batches {
+		outcome, err := r.reconcile(ctx, batch)
+		if err != nil {
+			log.Printf("Error reconciling batch %s: %v", batch.ID, err)
+		}
+		if outcome == "" && time.Since(batch.Created) > r.options.MaxAge {
+			log.Printf("Batch %s did not finish within %s, no longer tracking it", batch.ID, r.options.MaxAge)
+			outcome = OutcomeAbandoned
+		}
+		if outcome != "" {
+			r.mu.Lock()
+			delete(r.batches, batch.ID)
+			metrics.RecordBatchesPending(len(r.batches))
+			r.mu.Unlock()
+			metrics.RecordBatchReconciled(outcome)
+		}
+	}
+}
+
+// batchObject holds the fields of an OpenAI batch object used for reconciliation
+type batchObject struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	OutputFileID string `json:"output_file_id"`
+}
+
+// resultLine is a line of a batch output file
+type resultLine struct {
+	Response *struct {
+		Body struct {
+			Model string `json:"model"`
+			Usage struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		} `json:"body"`
+	} `json:"response"`
+}
+
+// reconcile polls a batch and records its usage if it finished, returning its
+// terminal status, or an empty outcome while it is still running or its
+// results could not be read
+func (r *Reconciler) reconcile(ctx context.Context, batch Batch) (string, error) {
+	var object batchObject
+	if err := r.get(ctx, batch, "/v1/batches/"+url.PathEscape(batch.ID), func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&object)
+	}); err != nil {
+		return "", err
+	}
+
+	switch object.Status {
+	case "completed", "expired", "cancelled":
+		// Expired and cancelled batches are billed for the requests that completed
+	case "failed":
+		return object.Status, nil
+	default:
+		return "", nil
+	}
+	if object.OutputFileID == "" {
+		return object.Status, nil
+	}
+
+	usage := make(map[string]*Usage)
+	err := r.get(ctx, batch, "/v1/files/"+url.PathEscape(object.OutputFileID)+"/content", func(body io.Reader) error {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var line resultLine
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Response == nil {
+				continue
+			}
+			model := line.Response.Body.Model
+			if usage[model] == nil {
+				usage[model] = &Usage{BatchID: batch.ID, Model: model}
+			}
+			usage[model].Requests++
+			usage[model].PromptTokens += line.Response.Body.Usage.PromptTokens
+			usage[model].CompletionTokens += line.Response.Body.Usage.CompletionTokens
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		// Retried on the next poll, until the batch is abandoned
+		return "", fmt.Errorf("failed to read output file %s: %w", object.OutputFileID, err)
+	}
+
+	models := make([]string, 0, len(usage))
+	for model := range usage {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		log.Printf("Batch %s used %d prompt and %d completion tokens of model %s over %d requests",
+			batch.ID, usage[model].PromptTokens, usage[model].CompletionTokens, model, usage[model].Requests)
+		if r.options.Record != nil {
+			r.options.Record(*usage[model])
+		}
+	}
+	return object.Status, nil
+}
+
+// get performs an authenticated GET against the API and decodes a successful response
+func (r *Reconciler) get(ctx context.Context, batch Batch, path string, decode func(io.Reader) error) error {
+	ctx, cancel := context.WithTimeout(ctx, r.options.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.options.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if r.options.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.options.APIKey)
+	} else if batch.Authorization != "" {
+		req.Header.Set("Authorization", batch.Authorization)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("GET %s returned status %d", path, resp.StatusCode)
+	}
+	return decode(resp.Body)
+}
@@ -0,0 +1,126 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// fakeAPI serves batches with the given statuses and a shared output file
+func fakeAPI(t *testing.T, statuses map[string]string, wantAuthorization string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != wantAuthorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/v1/files/file-out/content" {
+			fmt.Fprintln(w, `{"custom_id":"1","response":{"status_code":200,"body":{"model":"math-model","usage":{"prompt_tokens":10,"completion_tokens":5}}}}`)
+			fmt.Fprintln(w, `{"custom_id":"2","response":{"status_code":200,"body":{"model":"math-model","usage":{"prompt_tokens":20,"completion_tokens":7}}}}`)
+			fmt.Fprintln(w, `{"custom_id":"3","response":{"status_code":200,"body":{"model":"law-model","usage":{"prompt_tokens":3,"completion_tokens":1}}}}`)
+			fmt.Fprintln(w, `{"custom_id":"4","response":null,"error":{"code":"invalid_request"}}`)
+			return
+		}
+		id := r.URL.Path[len("/v1/batches/"):]
+		status, ok := statuses[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"id":%q,"object":"batch","status":%q,"output_file_id":"file-out"}`, id, status)
+	}))
+}
+
+func TestRunOnce(t *testing.T) {
+	statuses := map[string]string{"batch-done": "completed", "batch-running": "in_progress", "batch-failed": "failed"}
+	api := fakeAPI(t, statuses, "Bearer client-key")
+	defer api.Close()
+
+	var recorded []Usage
+	r := New(Options{
+		BaseURL: api.URL + "/",
+		Record:  func(usage Usage) { recorded = append(recorded, usage) },
+	})
+	for id := range statuses {
+		r.Track(Batch{ID: id, Authorization: "Bearer client-key"})
+	}
+	completed := testutil.ToFloat64(metrics.BatchesReconciled.WithLabelValues("completed"))
+	failed := testutil.ToFloat64(metrics.BatchesReconciled.WithLabelValues("failed"))
+
+	r.RunOnce(context.Background())
+
+	want := []Usage{
+		{BatchID: "batch-done", Model: "law-model", Requests: 1, PromptTokens: 3, CompletionTokens: 1},
+		{BatchID: "batch-done", Model: "math-model", Requests: 2, PromptTokens: 30, CompletionTokens: 12},
+	}
+	if !reflect.DeepEqual(recorded, want) {
+		t.Errorf("recorded usage %+v, want %+v", recorded, want)
+	}
+	if r.Pending() != 1 {
+		t.Errorf("pending = %d, want only the running batch", r.Pending())
+	}
+	if got := testutil.ToFloat64(metrics.BatchesReconciled.WithLabelValues("completed")) - completed; got != 1 {
+		t.Errorf("completed batches = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.BatchesReconciled.WithLabelValues("failed")) - failed; got != 1 {
+		t.Errorf("failed batches = %v, want 1", got)
+	}
+
+	// The running batch finishes, its usage is recorded on the next poll
+	statuses["batch-running"] = "expired"
+	recorded = nil
+	r.RunOnce(context.Background())
+	if len(recorded) != 2 || recorded[0].BatchID != "batch-running" || r.Pending() != 0 {
+		t.Errorf("recorded usage %+v with %d pending, want the expired batch's usage", recorded, r.Pending())
+	}
+}
+
+func TestRunOnceConfiguredAPIKey(t *testing.T) {
+	api := fakeAPI(t, map[string]string{"batch-1": "completed"}, "Bearer router-key")
+	defer api.Close()
+
+	var recorded []Usage
+	r := New(Options{
+		BaseURL: api.URL,
+		APIKey:  "router-key",
+		Record:  func(usage Usage) { recorded = append(recorded, usage) },
+	})
+	r.Track(Batch{ID: "batch-1", Authorization: "Bearer client-key"})
+	r.RunOnce(context.Background())
+	if len(recorded) != 2 {
+		t.Errorf("recorded usage %+v, want the usage of two models", recorded)
+	}
+}
+
+func TestRunOnceAbandonsOldBatches(t *testing.T) {
+	api := fakeAPI(t, map[string]string{"batch-new": "in_progress"}, "")
+	defer api.Close()
+
+	r := New(Options{BaseURL: api.URL, MaxAge: time.Hour})
+	r.Track(Batch{ID: "batch-new"})
+	// Unknown to the API, e.g. deleted, and past the maximum age
+	r.Track(Batch{ID: "batch-old", Created: time.Now().Add(-2 * time.Hour)})
+	abandoned := testutil.ToFloat64(metrics.BatchesReconciled.WithLabelValues(OutcomeAbandoned))
+
+	r.RunOnce(context.Background())
+	if r.Pending() != 1 {
+		t.Errorf("pending = %d, want only the new batch", r.Pending())
+	}
+	if got := testutil.ToFloat64(metrics.BatchesReconciled.WithLabelValues(OutcomeAbandoned)) - abandoned; got != 1 {
+		t.Errorf("abandoned batches = %v, want 1", got)
+	}
+
+	var disabled *Reconciler
+	disabled.Track(Batch{ID: "batch-1"})
+	if disabled.Pending() != 0 {
+		t.Error("a nil reconciler tracks no batches")
+	}
+}
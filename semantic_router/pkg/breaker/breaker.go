@@ -0,0 +1,252 @@
+// Package breaker opens a circuit for a destination model whose responses
+// fail or slow down, so routing avoids the model until it recovers.
+package breaker
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// States of a model's circuit
+const (
+	// Requests are routed to the model
+	StateClosed = "closed"
+	// Requests are routed around the model until the cool-down ends
+	StateOpen = "open"
+	// One trial request is routed to the model, closing the circuit if it
+	// succeeds and opening it again if it fails
+	StateHalfOpen = "half_open"
+)
+
+// buckets is the number of buckets the window is divided into
+const buckets = 10
+
+// Options holds options for creating new circuit breakers
+type Options struct {
+	// Period over which error rates are measured, default 1m
+	Window time.Duration
+	// Fraction of responses in the window that may fail, default 0.5
+	MaxErrorRate float64
+	// Responses taking longer count as failures, disabled when 0
+	MaxLatency time.Duration
+	// Responses in the window needed before the rate is checked, default 20
+	MinRequests int
+	// How long a circuit stays open before a trial request, default 30s
+	Cooldown time.Duration
+}
+
+// bucket counts the responses of a model in a slice of the window
+type bucket struct {
+	start    time.Time
+	requests int
+	errors   int
+	slow     int
+}
+
+// circuit is the state of a model's circuit
+type circuit struct {
+	buckets   [buckets]bucket
+	openUntil time.Time
+	halfOpen  bool
+	// When the trial request of a half-open circuit was let through, zero
+	// until then
+	trialStarted time.Time
+}
+
+// Circuit describes the state of a model's circuit
+type Circuit struct {
+	Model string `json:"model"`
+	State string `json:"state"`
+	// Responses in the window, and how many failed or were too slow
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	SlowRequests int     `json:"slow_requests"`
+	ErrorRate    float64 `json:"error_rate"`
+	// When an open circuit lets a trial request through
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+}
+
+// Breakers track the error rate and latency of the responses of each
+// destination model over a sliding window, and open the circuit of a model
+// over its thresholds for a cool-down. A nil Breakers allows every model.
+type Breakers struct {
+	mu       sync.Mutex
+	options  Options
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+// New creates circuit breakers with the given options
+func New(options Options) *Breakers {
+	if options.Window <= 0 {
+		options.Window = time.Minute
+	}
+	if options.MaxErrorRate <= 0 || options.MaxErrorRate > 1 {
+		options.MaxErrorRate = 0.5
+	}
+	if options.MinRequests <= 0 {
+		options.MinRequests = 20
+	}
+	if options.Cooldown <= 0 {
+		options.Cooldown = 30 * time.Second
+	}
+	return &Breakers{
+		options:  options,
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a request may be routed to the model: always while
+// its circuit is closed, never while it is open, and only for the trial
+// request once the cool-down is over. A trial whose response never arrives
+// is retried after another cool-down.
+func (b *Breakers) Allow(model string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[model]
+	if !ok || c.openUntil.IsZero() {
+		return true
+	}
+	now := b.now()
+	if now.Before(c.openUntil) {
+		return false
+	}
+	if !c.halfOpen {
+		c.halfOpen = true
+		metrics.RecordCircuitState(model, StateHalfOpen)
+		log.Printf("Circuit of model %s is half-open, letting a trial request through", model)
+	}
+	if !c.trialStarted.IsZero() && now.Sub(c.trialStarted) < b.options.Cooldown {
+		return false
+	}
+	c.trialStarted = now
+	return true
+}
+
+// Record counts a response of the model, failed unless success or slower
+// than the latency threshold, and opens the model's circuit if its error rate
+// over the window exceeds the threshold
+func (b *Breakers) Record(model string, success bool, latency time.Duration) {
+	if b == nil {
+		return
+	}
+	b.RecordAt(model, success, latency, b.now())
+}
+
+// RecordAt counts a response of the model that arrived at the given time, so
+// responses logged before a restart can be replayed in order. Responses older
+// than the window are ignored.
+func (b *Breakers) RecordAt(model string, success bool, latency time.Duration, now time.Time) {
+	if b == nil || now.Before(b.now().Add(-b.options.Window)) {
+		return
+	}
+	slow := b.options.MaxLatency > 0 && latency > b.options.MaxLatency
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[model]
+	if !ok {
+		c = &circuit{}
+		b.circuits[model] = c
+		metrics.RecordCircuitState(model, StateClosed)
+	}
+
+	// The trial request decides whether a half-open circuit closes
+	if c.halfOpen {
+		if success && !slow {
+			*c = circuit{}
+			metrics.RecordCircuitState(model, StateClosed)
+			log.Printf("Circuit of model %s closed after a successful trial request", model)
+		} else {
+			b.open(model, c, now)
+			log.Printf("Circuit of model %s opened again after a failed trial request, for %s", model, b.options.Cooldown)
+		}
+		return
+	}
+	if !c.openUntil.IsZero() {
+		// Responses of requests routed before the circuit opened
+		return
+	}
+
+	width := b.options.Window / buckets
+	start := now.Truncate(width)
+	current := &c.buckets[(start.UnixNano()/int64(width))%buckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	current.requests++
+	if !success {
+		current.errors++
+	} else if slow {
+		current.slow++
+	}
+
+	requests, errors, slowRequests := b.counts(c, now)
+	failures := errors + slowRequests
+	if requests < b.options.MinRequests || float64(failures) <= b.options.MaxErrorRate*float64(requests) {
+		return
+	}
+	b.open(model, c, now)
+	log.Printf("ALERT: model %s failed %d and was slow for %d of %d responses in the last %s, over %.0f%%; routing around it for %s",
+		model, errors, slowRequests, requests, b.options.Window, 100*b.options.MaxErrorRate, b.options.Cooldown)
+}
+
+// open opens the model's circuit for a cool-down. Assumes the caller holds the lock
+func (b *Breakers) open(model string, c *circuit, now time.Time) {
+	*c = circuit{openUntil: now.Add(b.options.Cooldown)}
+	metrics.RecordCircuitState(model, StateOpen)
+	metrics.RecordCircuitOpened(model)
+}
+
+// counts returns the responses in the window, and how many failed or were
+// too slow. Assumes the caller holds the lock
+func (b *Breakers) counts(c *circuit, now time.Time) (requests, errors, slow int) {
+	for _, bucket := range c.buckets {
+		if now.Sub(bucket.start) < b.options.Window {
+			requests += bucket.requests
+			errors += bucket.errors
+			slow += bucket.slow
+		}
+	}
+	return requests, errors, slow
+}
+
+// Circuits returns the state of the circuit of each model a response was
+// recorded for, sorted by model
+func (b *Breakers) Circuits() []Circuit {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	circuits := make([]Circuit, 0, len(b.circuits))
+	for model, c := range b.circuits {
+		state := Circuit{Model: model, State: StateClosed}
+		switch {
+		case c.halfOpen:
+			state.State = StateHalfOpen
+		case !c.openUntil.IsZero() && now.Before(c.openUntil):
+			state.State = StateOpen
+			openUntil := c.openUntil
+			state.OpenUntil = &openUntil
+		case !c.openUntil.IsZero():
+			// The cool-down is over, the next request is the trial
+			state.State = StateHalfOpen
+		}
+		state.Requests, state.Errors, state.SlowRequests = b.counts(c, now)
+		if state.Requests > 0 {
+			state.ErrorRate = float64(state.Errors+state.SlowRequests) / float64(state.Requests)
+		}
+		circuits = append(circuits, state)
+	}
+	sort.Slice(circuits, func(i, j int) bool { return circuits[i].Model < circuits[j].Model })
+	return circuits
+}
@@ -0,0 +1,119 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestBreakers(now *time.Time) *Breakers {
+	b := New(Options{
+		Window:       10 * time.Second,
+		MaxErrorRate: 0.5,
+		MaxLatency:   time.Second,
+		MinRequests:  4,
+		Cooldown:     30 * time.Second,
+	})
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func TestOpensCircuitOverErrorRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newTestBreakers(&now)
+
+	// Below the minimum number of responses the rate is not checked
+	for i := 0; i < 3; i++ {
+		b.Record("phi4", false, 0)
+	}
+	if !b.Allow("phi4") {
+		t.Fatal("circuit opened before reaching the minimum number of responses")
+	}
+	// Slow responses count as failures
+	b.Record("phi4", true, 2*time.Second)
+	if b.Allow("phi4") {
+		t.Fatal("circuit still closed after 4 failures out of 4 responses")
+	}
+	if !b.Allow("gemma3") {
+		t.Error("circuit of another model opened")
+	}
+	circuits := b.Circuits()
+	if len(circuits) != 1 || circuits[0].State != StateOpen || circuits[0].OpenUntil == nil {
+		t.Fatalf("Circuits() = %+v", circuits)
+	}
+
+	// After the cool-down a single trial request is let through
+	now = now.Add(31 * time.Second)
+	if !b.Allow("phi4") {
+		t.Fatal("trial request not let through after the cool-down")
+	}
+	if b.Allow("phi4") {
+		t.Error("second request let through while the trial is pending")
+	}
+	if state := b.Circuits()[0].State; state != StateHalfOpen {
+		t.Errorf("state = %s, want half_open", state)
+	}
+
+	// A failed trial opens the circuit again, a successful one closes it
+	b.Record("phi4", false, 0)
+	if b.Allow("phi4") {
+		t.Fatal("circuit closed after a failed trial")
+	}
+	now = now.Add(31 * time.Second)
+	b.Allow("phi4")
+	b.Record("phi4", true, 0)
+	if !b.Allow("phi4") || b.Circuits()[0].State != StateClosed {
+		t.Errorf("circuit not closed after a successful trial: %+v", b.Circuits())
+	}
+}
+
+func TestCircuitStaysClosedUnderErrorRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newTestBreakers(&now)
+	for i := 0; i < 10; i++ {
+		b.Record("phi4", i%2 == 0, 0)
+	}
+	if !b.Allow("phi4") {
+		t.Error("circuit opened at the error rate threshold")
+	}
+
+	// Failures age out of the window
+	now = now.Add(11 * time.Second)
+	for i := 0; i < 4; i++ {
+		b.Record("phi4", true, 0)
+	}
+	if c := b.Circuits()[0]; c.Requests != 4 || c.Errors != 0 {
+		t.Errorf("circuit counts %d responses, %d errors, want the last 4 successes", c.Requests, c.Errors)
+	}
+}
+
+func TestNilBreakersAllow(t *testing.T) {
+	var b *Breakers
+	b.Record("phi4", false, 0)
+	if !b.Allow("phi4") || b.Circuits() != nil {
+		t.Error("nil breakers restricted routing")
+	}
+}
+
+func TestRecordAtReplaysRecentResponses(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newTestBreakers(&now)
+
+	// Responses older than the window are ignored, recent ones open the circuit
+	for i := 0; i < 4; i++ {
+		b.RecordAt("phi4", false, 0, now.Add(-time.Minute))
+	}
+	if circuits := b.Circuits(); len(circuits) != 0 {
+		t.Fatalf("responses older than the window were recorded: %+v", circuits)
+	}
+	for i := 0; i < 4; i++ {
+		b.RecordAt("phi4", false, 0, now.Add(-5*time.Second))
+	}
+	if b.Allow("phi4") {
+		t.Fatal("circuit closed after replaying 4 recent failures")
+	}
+	// The cool-down runs from when the circuit opened in the replayed history
+	now = now.Add(26 * time.Second)
+	if !b.Allow("phi4") {
+		t.Error("trial request not let through after the replayed cool-down")
+	}
+}
@@ -0,0 +1,427 @@
+package cache
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Backend stores the completed entries of the semantic cache. The cache keeps
+// requests still waiting for their response to itself and only hands entries
+// to its backend once they have one.
+type Backend interface {
+	// Get returns the entry with the given ID, or nil if there is none
+	Get(id string) (*CacheEntry, error)
+	// Add stores an entry, replacing any entry with the same ID
+	Add(entry CacheEntry) error
+	// FindSimilar returns the entry of the model and epoch most similar to the
+	// embedding along with its similarity, or nil if there is none
+	FindSimilar(model, epoch string, embedding []float32) (*CacheEntry, float32, error)
+	// Evict removes the entry with the given ID
+	Evict(id string) error
+}
+
+// epochDropper is implemented by backends that drop the entries of previous
+// epochs when the epoch changes, rather than letting them expire
+type epochDropper interface {
+	DropOtherEpochs(epoch string) int
+}
+
+// expirer is implemented by backends removing their expired entries when
+// asked, rather than expiring them by themselves
+type expirer interface {
+	// RemoveExpired removes the expired entries, returning how many were removed
+	RemoveExpired() int
+}
+
+// usageTracker is implemented by backends whose eviction depends on hits
+type usageTracker interface {
+	// Touch records a hit on the entry with the given ID
+	Touch(id string)
+}
+
+// entryLister is implemented by backends able to list and drop all their
+// entries, which backends shared with other replicas are not
+type entryLister interface {
+	// Entries returns the unexpired entries, oldest first
+	Entries() []CacheEntry
+	// Flush removes every entry, returning how many were removed
+	Flush() int
+}
+
+// similarity returns the dot product of two embeddings, their cosine
+// similarity as the embeddings are normalized
+func similarity(a, b []float32) float32 {
+	n := min(len(a), len(b))
+	a, b = a[:n], b[:n]
+	// Four independent sums let the multiplications overlap
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= n; i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < n; i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// memoryBackend keeps the entries in the router's memory. Lookups search an
+// HNSW index per model and epoch unless exact search is configured, which
+// scans every entry.
+type memoryBackend struct {
+	mu         sync.RWMutex
+	entries    []CacheEntry
+	positions  map[string]int
+	maxEntries int
+	ttlSeconds int
+	// Index per model and epoch, nil with exact search
+	indexes      map[string]*hnswGraph
+	indexOptions IndexOptions
+	lastCleanup  time.Time
+	// Eviction of entries over the limits, and the hits and estimated size
+	// of the entries it is based on
+	eviction EvictionOptions
+	usage    map[string]*entryUsage
+	bytes    int64
+	// Entries by model, reported in metrics
+	models map[string]int
+}
+
+// cleanupInterval bounds how often expired entries are removed; lookups skip
+// them in between
+const cleanupInterval = time.Second
+
+// newMemoryBackend creates an in-memory backend keeping at most maxEntries
+// entries for ttlSeconds each; zero disables either limit
+func newMemoryBackend(maxEntries, ttlSeconds int, index IndexOptions, eviction EvictionOptions) *memoryBackend {
+	if eviction.Policy == "" {
+		eviction.Policy = EvictionFIFO
+	}
+	b := &memoryBackend{
+		entries:      []CacheEntry{},
+		positions:    make(map[string]int),
+		maxEntries:   maxEntries,
+		ttlSeconds:   ttlSeconds,
+		indexOptions: index.withDefaults(),
+		eviction:     eviction,
+		usage:        make(map[string]*entryUsage),
+		models:       make(map[string]int),
+	}
+	if !index.ExactSearch {
+		b.indexes = make(map[string]*hnswGraph)
+	}
+	return b
+}
+
+func partitionKey(model, epoch string) string {
+	return model + "\x00" + epoch
+}
+
+// Get returns the entry with the given ID, or nil if there is none
+func (b *memoryBackend) Get(id string) (*CacheEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if i, ok := b.positions[id]; ok && !b.expired(b.entries[i]) {
+		entry := b.entries[i]
+		return &entry, nil
+	}
+	return nil, nil
+}
+
+// Add stores an entry, replacing any entry with the same ID
+func (b *memoryBackend) Add(entry CacheEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Cleanup expired entries
+	if time.Since(b.lastCleanup) >= cleanupInterval {
+		b.cleanupExpiredEntries()
+		b.lastCleanup = time.Now()
+	}
+
+	if i, ok := b.positions[entry.ID]; ok {
+		b.forget(b.entries[i])
+		b.entries[i] = entry
+	} else {
+		b.entries = append(b.entries, entry)
+		b.positions[entry.ID] = len(b.entries) - 1
+	}
+	b.remember(entry)
+	b.enforceLimits(entry.ID)
+	b.reportSize()
+	return nil
+}
+
+// Touch records a hit on the entry with the given ID, for the lru and lfu
+// eviction policies
+func (b *memoryBackend) Touch(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if usage, ok := b.usage[id]; ok {
+		usage.lastUsed = time.Now()
+		usage.hits++
+	}
+}
+
+// RemoveExpired removes the expired entries, returning how many were removed
+func (b *memoryBackend) RemoveExpired() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastCleanup = time.Now()
+	return b.cleanupExpiredEntries()
+}
+
+// enforceLimits evicts entries in the order of the eviction policy until the
+// entries are within the max entries and memory. The entry just stored goes
+// last, as it had no chance to be hit yet. Assumes the caller holds a write
+// lock
+func (b *memoryBackend) enforceLimits(stored string) {
+	overEntries := b.maxEntries > 0 && len(b.entries) > b.maxEntries
+	overMemory := b.eviction.MaxMemoryBytes > 0 && b.bytes > b.eviction.MaxMemoryBytes
+	if !overEntries && !overMemory {
+		return
+	}
+	sort.SliceStable(b.entries, func(i, j int) bool {
+		a, c := b.entries[i], b.entries[j]
+		if a.ID == stored || c.ID == stored {
+			return c.ID == stored && a.ID != stored
+		}
+		return evictsBefore(b.eviction.Policy, *b.usage[a.ID], *b.usage[c.ID], a.Timestamp, c.Timestamp)
+	})
+	evicted := make(map[string]int)
+	n := 0
+	for ; n < len(b.entries); n++ {
+		reason := ""
+		if b.maxEntries > 0 && len(b.entries)-n > b.maxEntries {
+			reason = EvictionReasonMaxEntries
+		} else if b.eviction.MaxMemoryBytes > 0 && b.bytes > b.eviction.MaxMemoryBytes {
+			reason = EvictionReasonMaxMemory
+		} else {
+			break
+		}
+		b.forget(b.entries[n])
+		evicted[reason]++
+	}
+	b.entries = b.entries[n:]
+	b.updatePositions()
+	for reason, count := range evicted {
+		metrics.RecordCacheEvictions(reason, count)
+	}
+	log.Printf("Evicted %d %s cache entries, keeping %d entries of %d bytes", n, b.eviction.Policy, len(b.entries), b.bytes)
+}
+
+// FindSimilar returns the unexpired entry of the model and epoch most similar
+// to the embedding
+func (b *memoryBackend) FindSimilar(model, epoch string, embedding []float32) (*CacheEntry, float32, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.indexes != nil {
+		graph := b.indexes[partitionKey(model, epoch)]
+		if graph == nil {
+			return nil, 0, nil
+		}
+		id, bestSimilarity, ok := graph.search(embedding, b.indexOptions.EfSearch, func(id string) bool {
+			return !b.expired(b.entries[b.positions[id]])
+		})
+		if ok {
+			found := b.entries[b.positions[id]]
+			return &found, bestSimilarity, nil
+		}
+		// Every candidate expired, look further
+	}
+
+	var best *CacheEntry
+	var bestSimilarity float32
+	for i := range b.entries {
+		entry := &b.entries[i]
+		// Only compare with entries with the same model from the current epoch
+		if entry.Model != model || entry.Epoch != epoch || b.expired(*entry) {
+			continue
+		}
+		if s := similarity(embedding, entry.Embedding); best == nil || s > bestSimilarity {
+			best, bestSimilarity = entry, s
+		}
+	}
+	if best == nil {
+		return nil, 0, nil
+	}
+	found := *best
+	return &found, bestSimilarity, nil
+}
+
+// Evict removes the entry with the given ID
+func (b *memoryBackend) Evict(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if i, ok := b.positions[id]; ok {
+		b.forget(b.entries[i])
+		b.entries = append(b.entries[:i], b.entries[i+1:]...)
+		b.updatePositions()
+		b.reportSize()
+	}
+	return nil
+}
+
+// DropOtherEpochs removes the entries of every other epoch, returning how many
+// were removed
+func (b *memoryBackend) DropOtherEpochs(epoch string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := make([]CacheEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		if entry.Epoch == epoch {
+			kept = append(kept, entry)
+		} else {
+			b.forget(entry)
+		}
+	}
+	dropped := len(b.entries) - len(kept)
+	b.entries = kept
+	b.updatePositions()
+	metrics.RecordCacheEvictions(EvictionReasonEpoch, dropped)
+	b.reportSize()
+	return dropped
+}
+
+// Entries returns the unexpired entries, oldest first
+func (b *memoryBackend) Entries() []CacheEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entries := make([]CacheEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		if !b.expired(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries
+}
+
+// Flush removes every entry, returning how many were removed
+func (b *memoryBackend) Flush() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	flushed := len(b.entries)
+	b.entries = []CacheEntry{}
+	clear(b.positions)
+	if b.indexes != nil {
+		clear(b.indexes)
+	}
+	clear(b.usage)
+	b.bytes = 0
+	for model := range b.models {
+		b.models[model] = 0
+	}
+	b.reportSize()
+	return flushed
+}
+
+// index adds an entry to the index of its model and epoch. Assumes the
+// caller holds a write lock
+func (b *memoryBackend) index(entry CacheEntry) {
+	if b.indexes == nil {
+		return
+	}
+	key := partitionKey(entry.Model, entry.Epoch)
+	graph := b.indexes[key]
+	if graph == nil {
+		graph = newHNSWGraph(b.indexOptions)
+		b.indexes[key] = graph
+	}
+	graph.add(entry.ID, entry.Embedding)
+}
+
+// unindex removes an entry from the index of its model and epoch. Assumes
+// the caller holds a write lock
+func (b *memoryBackend) unindex(entry CacheEntry) {
+	if b.indexes == nil {
+		return
+	}
+	key := partitionKey(entry.Model, entry.Epoch)
+	if graph := b.indexes[key]; graph != nil {
+		graph.remove(entry.ID)
+		if graph.len() == 0 {
+			delete(b.indexes, key)
+		}
+	}
+}
+
+// remember indexes a stored entry and accounts for its size. Assumes the
+// caller holds a write lock
+func (b *memoryBackend) remember(entry CacheEntry) {
+	b.index(entry)
+	b.usage[entry.ID] = &entryUsage{lastUsed: entry.Timestamp}
+	b.bytes += entrySize(entry)
+	b.models[entry.Model]++
+}
+
+// forget unindexes an entry being removed and releases its size. Assumes the
+// caller holds a write lock
+func (b *memoryBackend) forget(entry CacheEntry) {
+	b.unindex(entry)
+	delete(b.usage, entry.ID)
+	b.bytes -= entrySize(entry)
+	b.models[entry.Model]--
+}
+
+// reportSize updates the size metrics of the cache, forgetting models left
+// without entries once reported. Assumes the caller holds a write lock
+func (b *memoryBackend) reportSize() {
+	metrics.SetCacheSize(b.models, b.bytes)
+	for model, count := range b.models {
+		if count == 0 {
+			delete(b.models, model)
+		}
+	}
+}
+
+// updatePositions maps the IDs of the entries to their position again after
+// entries were removed. Assumes the caller holds a write lock
+func (b *memoryBackend) updatePositions() {
+	clear(b.positions)
+	for i, entry := range b.entries {
+		b.positions[entry.ID] = i
+	}
+}
+
+// expired reports whether an entry outlived its own TTL or else the backend's
+func (b *memoryBackend) expired(entry CacheEntry) bool {
+	if entry.TTL > 0 {
+		return time.Since(entry.Timestamp) >= entry.TTL
+	}
+	return b.ttlSeconds > 0 && time.Since(entry.Timestamp).Seconds() >= float64(b.ttlSeconds)
+}
+
+// cleanupExpiredEntries removes expired entries from the cache, returning how
+// many were removed. Assumes the caller holds a write lock
+func (b *memoryBackend) cleanupExpiredEntries() int {
+	validEntries := make([]CacheEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		// Keep entries that haven't expired
+		if !b.expired(entry) {
+			validEntries = append(validEntries, entry)
+		} else {
+			b.forget(entry)
+		}
+	}
+
+	expired := len(b.entries) - len(validEntries)
+	if expired > 0 {
+		log.Printf("Removed %d expired cache entries", expired)
+		b.entries = validEntries
+		b.updatePositions()
+		metrics.RecordCacheEvictions(EvictionReasonExpired, expired)
+		b.reportSize()
+	}
+	return expired
+}
@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// keywordEmbedding embeds queries about cats and dogs on orthogonal axes
+func keywordEmbedding(text string) ([]float32, error) {
+	if text == "dogs" {
+		return []float32{0, 1}, nil
+	}
+	return []float32{1, 0}, nil
+}
+
+func newRedisBackend(t *testing.T, options RedisOptions) (*RedisBackend, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	options.Address = server.Addr()
+	backend := NewRedisBackend(options)
+	t.Cleanup(func() { backend.Close() })
+	return backend, server
+}
+
+func TestBackends(t *testing.T) {
+	backends := map[string]func(t *testing.T) Backend{
+		"memory": func(t *testing.T) Backend { return newMemoryBackend(0, 0, IndexOptions{}, EvictionOptions{}) },
+		"memory-exact": func(t *testing.T) Backend {
+			return newMemoryBackend(0, 0, IndexOptions{ExactSearch: true}, EvictionOptions{})
+		},
+		"redis": func(t *testing.T) Backend {
+			backend, _ := newRedisBackend(t, RedisOptions{})
+			return backend
+		},
+	}
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			c := NewSemanticCache(SemanticCacheOptions{
+				SimilarityThreshold: 0.9,
+				Enabled:             true,
+				EmbedFunc:           keywordEmbedding,
+				Epoch:               "v1",
+				Backend:             newBackend(t),
+			})
+
+			id, err := c.AddPendingRequest("phi4", "cats", []byte(`{"q":"cats"}`))
+			if err != nil {
+				t.Fatalf("AddPendingRequest: %v", err)
+			}
+			if _, found, _ := c.FindSimilar("phi4", "cats"); found {
+				t.Error("expected no hit for a pending request")
+			}
+			if err := c.UpdateWithResponse(id, []byte(`{"a":"cats"}`)); err != nil {
+				t.Fatalf("UpdateWithResponse: %v", err)
+			}
+			if err := c.UpdateWithResponse(id, []byte(`{"a":"retry"}`)); err != nil {
+				t.Fatalf("duplicate UpdateWithResponse: %v", err)
+			}
+			if c.PendingCount() != 0 {
+				t.Errorf("expected no pending entries, got %d", c.PendingCount())
+			}
+			if err := c.AddEntry("phi4", "dogs", []byte(`{"q":"dogs"}`), []byte(`{"a":"dogs"}`)); err != nil {
+				t.Fatalf("AddEntry: %v", err)
+			}
+
+			for _, tc := range []struct {
+				model, query string
+				want         string
+			}{
+				{"phi4", "cats", `{"a":"cats"}`},
+				{"phi4", "dogs", `{"a":"dogs"}`},
+				{"gemma3", "cats", ""},
+			} {
+				response, found, err := c.FindSimilar(tc.model, tc.query)
+				if err != nil {
+					t.Fatalf("FindSimilar(%s, %s): %v", tc.model, tc.query, err)
+				}
+				if string(response) != tc.want || found != (tc.want != "") {
+					t.Errorf("FindSimilar(%s, %s) = %s (found=%v), want %s", tc.model, tc.query, response, found, tc.want)
+				}
+			}
+
+			if again, _ := c.AddPendingRequest("phi4", "cats", []byte(`{"q":"cats"}`)); again != id || c.PendingCount() != 0 {
+				t.Errorf("expected the retry to reuse entry %s without a pending request, got %s", id, again)
+			}
+
+			if err := c.Evict(id); err != nil {
+				t.Fatalf("Evict: %v", err)
+			}
+			if _, found, _ := c.FindSimilar("phi4", "cats"); found {
+				t.Error("expected no hit for an evicted entry")
+			}
+		})
+	}
+}
+
+func TestRedisBackendSharedAcrossRouters(t *testing.T) {
+	server := miniredis.RunT(t)
+	newCache := func() *SemanticCache {
+		backend := NewRedisBackend(RedisOptions{Address: server.Addr(), TTL: time.Minute})
+		t.Cleanup(func() { backend.Close() })
+		return NewSemanticCache(SemanticCacheOptions{
+			SimilarityThreshold: 0.9,
+			Enabled:             true,
+			EmbedFunc:           keywordEmbedding,
+			Backend:             backend,
+		})
+	}
+	first, second := newCache(), newCache()
+
+	if err := first.AddEntry("phi4", "cats", []byte(`{}`), []byte(`{"a":"cats"}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if response, found, err := second.FindSimilar("phi4", "cats"); err != nil || !found || string(response) != `{"a":"cats"}` {
+		t.Fatalf("expected another router to hit the entry, got %s (found=%v, err=%v)", response, found, err)
+	}
+
+	server.FastForward(2 * time.Minute)
+	if _, found, err := second.FindSimilar("phi4", "cats"); err != nil || found {
+		t.Errorf("expected no hit after the TTL, got found=%v (err=%v)", found, err)
+	}
+}
+
+func TestRedisBackendMaxEntries(t *testing.T) {
+	backend, server := newRedisBackend(t, RedisOptions{MaxEntries: 2, KeyPrefix: "test:"})
+	start := time.Now()
+	for i, id := range []string{"a", "b", "c"} {
+		entry := CacheEntry{ID: id, Model: "phi4", Embedding: []float32{1, 0}, Timestamp: start.Add(time.Duration(i) * time.Second)}
+		if err := backend.Add(entry); err != nil {
+			t.Fatalf("Add(%s): %v", id, err)
+		}
+	}
+	if server.Exists("test:entry:a") {
+		t.Error("expected the oldest entry to be evicted")
+	}
+	if members, _ := server.Members("test:index::phi4"); len(members) != 2 || members[0] != "b" || members[1] != "c" {
+		t.Errorf("expected the evicted entry to leave the index, got %v", members)
+	}
+	for _, id := range []string{"b", "c"} {
+		if entry, err := backend.Get(id); err != nil || entry == nil || entry.Model != "phi4" {
+			t.Errorf("expected entry %s to be kept, got %+v (err=%v)", id, entry, err)
+		}
+	}
+	if entry, _, err := backend.FindSimilar("phi4", "", []float32{1, 0}); err != nil || entry == nil || entry.ID == "a" {
+		t.Errorf("expected a kept entry to be found, got %+v (err=%v)", entry, err)
+	}
+}
+
+func TestRedisBackendIndexFollowsOtherReplicas(t *testing.T) {
+	writer, server := newRedisBackend(t, RedisOptions{KeyPrefix: "test:"})
+	reader := NewRedisBackend(RedisOptions{Address: server.Addr(), KeyPrefix: "test:"})
+	t.Cleanup(func() { reader.Close() })
+
+	find := func(embedding []float32) string {
+		t.Helper()
+		entry, _, err := reader.FindSimilar("phi4", "v1", embedding)
+		if err != nil {
+			t.Fatalf("FindSimilar: %v", err)
+		}
+		if entry == nil {
+			return ""
+		}
+		return entry.ID
+	}
+	add := func(id string, embedding []float32) {
+		t.Helper()
+		if err := writer.Add(CacheEntry{ID: id, Model: "phi4", Epoch: "v1", Embedding: embedding, Timestamp: time.Now()}); err != nil {
+			t.Fatalf("Add(%s): %v", id, err)
+		}
+	}
+
+	add("cats", []float32{1, 0})
+	if got := find([]float32{1, 0}); got != "cats" {
+		t.Fatalf("expected the entry loaded from the index, got %q", got)
+	}
+	add("dogs", []float32{0, 1})
+	if got := find([]float32{0, 1}); got != "dogs" {
+		t.Fatalf("expected the entry added by the other replica, got %q", got)
+	}
+
+	if err := writer.Evict("dogs"); err != nil {
+		t.Fatalf("Evict: %v", err)
+	}
+	if member, _ := server.IsMember("test:index:v1:phi4", "dogs"); member {
+		t.Error("expected the evicted entry to leave the index")
+	}
+	if got := find([]float32{1, 0}); got != "cats" {
+		t.Errorf("expected the remaining entry, got %q", got)
+	}
+	if _, ok := reader.mirrored["dogs"]; ok {
+		t.Error("expected the eviction to reach the other replica")
+	}
+	if got := find([]float32{0, 1}); got != "cats" {
+		t.Errorf("expected no hit for the evicted entry, got %q", got)
+	}
+}
+
+func TestEntryTTLOverridesBackendTTL(t *testing.T) {
+	redisBackend, server := newRedisBackend(t, RedisOptions{TTL: time.Hour})
+	for name, backend := range map[string]Backend{"memory": newMemoryBackend(0, 3600, IndexOptions{}, EvictionOptions{}), "redis": redisBackend} {
+		t.Run(name, func(t *testing.T) {
+			// Older than the backend's TTL, which a long TTL outlives
+			old := time.Now().Add(-90 * time.Minute)
+			entries := []CacheEntry{
+				{ID: "short", Model: "phi4", Embedding: []float32{1, 0}, Timestamp: old, TTL: time.Minute},
+				{ID: "long", Model: "phi4", Embedding: []float32{0, 1}, Timestamp: old, TTL: 2 * time.Hour},
+			}
+			for _, entry := range entries {
+				if err := backend.Add(entry); err != nil {
+					t.Fatalf("Add(%s): %v", entry.ID, err)
+				}
+			}
+			if name == "redis" {
+				server.FastForward(90 * time.Minute)
+			}
+			if entry, _, _ := backend.FindSimilar("phi4", "", []float32{1, 0}); entry != nil && entry.ID == "short" {
+				t.Error("expected the entry to expire with its own TTL")
+			}
+			if entry, _, _ := backend.FindSimilar("phi4", "", []float32{0, 1}); entry == nil || entry.ID != "long" || entry.TTL != 2*time.Hour {
+				t.Errorf("expected the entry to outlive the backend's TTL, got %+v", entry)
+			}
+		})
+	}
+}
@@ -1,34 +1,81 @@
 package cache
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/chunking"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/embeddings"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
 )
 
+// ErrWriteDropped is returned when a completed entry is dropped because the
+// write queue is full
+var ErrWriteDropped = errors.New("cache write queue full, entry dropped")
+
+// ErrNotListable is returned when listing or flushing the entries of a backend
+// that cannot enumerate them, such as one shared with other replicas
+var ErrNotListable = errors.New("cache backend cannot list its entries")
+
 // CacheEntry represents a cached request-response pair
 type CacheEntry struct {
+	ID           string // Idempotency key derived from the model and request body
+	Epoch        string // Cache epoch the entry was created in
 	RequestBody  []byte
 	ResponseBody []byte
 	Model        string
 	Query        string
 	Embedding    []float32
 	Timestamp    time.Time
+	// Time-to-live of the entry overriding the cache's, e.g. as set by the upstream
+	TTL time.Duration
 }
 
-// SemanticCache implements a semantic cache using BERT embeddings
+// SemanticCache implements a semantic cache using BERT embeddings. Requests
+// waiting for their response are kept in memory; completed entries are stored
+// in the cache's backend.
 type SemanticCache struct {
-	entries             []CacheEntry
+	backend             Backend
+	pending             map[string]CacheEntry
 	mu                  sync.RWMutex
 	similarityThreshold float32
 	maxEntries          int
 	ttlSeconds          int
 	enabled             bool
+	chunking            chunking.Options
+	embedFunc           func(text string) ([]float32, error)
+	epoch               string
+	// Normalizes queries before they are embedded, nil when disabled
+	normalizer *Normalizer
+	compareRaw bool
+	// Skips lookups of queries no entry can be similar to, nil when disabled
+	prefilter *prefilter
+	// Completed entries waiting to be embedded and stored, nil when entries
+	// are stored inline
+	writes      chan CacheEntry
+	writesMu    sync.RWMutex
+	stopped     bool
+	writersDone sync.WaitGroup
+	// Stops removing expired entries in the background, nil when the
+	// backend expires entries by itself
+	evictionStop chan struct{}
+	evictionDone chan struct{}
+	stopOnce     sync.Once
+	// Snapshots of the completed entries on disk
+	snapshot     SnapshotOptions
+	snapshotStop chan struct{}
+	snapshotDone chan struct{}
+	snapshotOnce sync.Once
 }
 
 // SemanticCacheOptions holds options for creating a new semantic cache
@@ -37,89 +84,477 @@ type SemanticCacheOptions struct {
 	MaxEntries          int
 	TTLSeconds          int
 	Enabled             bool
+	// Chunking of queries longer than the model's max sequence length
+	Chunking chunking.Options
+	// Function generating embeddings, defaults to the candle BERT model
+	EmbedFunc func(text string) ([]float32, error)
+	// Epoch partitioning the cache, entries from other epochs are never returned
+	Epoch string
+	// Backend storing the completed entries, defaults to the router's memory
+	// bounded by MaxEntries and TTLSeconds
+	Backend Backend
+	// Nearest neighbor index of the default in-memory backend
+	Index IndexOptions
+	// Eviction of entries of the default in-memory backend
+	Eviction EvictionOptions
+	// Pre-filter skipping lookups that can only miss
+	Prefilter PrefilterOptions
+	// Number of completed entries waiting to be stored before new ones are
+	// dropped. Entries are then embedded and stored in the background, off the
+	// response path; 0 stores them inline.
+	WriteQueueSize int
+	// Goroutines storing queued entries, defaults to 1
+	Writers int
+	// Snapshots of the completed entries on disk, restoring them on restart
+	Snapshot SnapshotOptions
+	// Normalizes queries before they are embedded, none when nil
+	Normalizer *Normalizer
+	// Also look queries up as sent, counting how often each form hits
+	CompareRaw bool
 }
 
 // NewSemanticCache creates a new semantic cache with the given options
 func NewSemanticCache(options SemanticCacheOptions) *SemanticCache {
-	return &SemanticCache{
-		entries:             []CacheEntry{},
+	embedFunc := options.EmbedFunc
+	if embedFunc == nil {
+		embedFunc = func(text string) ([]float32, error) {
+			return candle_binding.GetEmbedding(text, 512)
+		}
+	}
+	backend := options.Backend
+	if backend == nil {
+		backend = newMemoryBackend(options.MaxEntries, options.TTLSeconds, options.Index, options.Eviction)
+	}
+	var filter *prefilter
+	if options.Prefilter.Enabled {
+		if options.Prefilter.Capacity <= 0 {
+			options.Prefilter.Capacity = options.MaxEntries
+		}
+		filter = newPrefilter(options.Prefilter)
+	}
+	c := &SemanticCache{
+		prefilter:           filter,
+		backend:             backend,
+		pending:             make(map[string]CacheEntry),
 		similarityThreshold: options.SimilarityThreshold,
 		maxEntries:          options.MaxEntries,
 		ttlSeconds:          options.TTLSeconds,
 		enabled:             options.Enabled,
+		chunking:            options.Chunking,
+		embedFunc:           embedFunc,
+		epoch:               options.Epoch,
+		snapshot:            options.Snapshot,
+		normalizer:          options.Normalizer,
+		compareRaw:          options.CompareRaw && options.Normalizer != nil,
+	}
+	if options.Enabled && options.WriteQueueSize > 0 {
+		c.writes = make(chan CacheEntry, options.WriteQueueSize)
+		writers := max(options.Writers, 1)
+		c.writersDone.Add(writers)
+		for i := 0; i < writers; i++ {
+			go c.writeQueued()
+		}
+	}
+	if backend, ok := backend.(expirer); ok && options.Enabled {
+		interval := options.Eviction.Interval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		c.evictionStop = make(chan struct{})
+		c.evictionDone = make(chan struct{})
+		go c.removeExpired(backend, interval)
+	}
+	if _, ok := backend.(entryLister); ok && options.Enabled && options.Snapshot.Path != "" {
+		interval := options.Snapshot.Interval
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		c.snapshotStop = make(chan struct{})
+		c.snapshotDone = make(chan struct{})
+		go c.saveSnapshots(interval)
+	}
+	return c
+}
+
+// removeExpired removes the expired entries of the backend every interval
+// until the cache is stopped, so they don't take memory until the next write
+func (c *SemanticCache) removeExpired(backend expirer, interval time.Duration) {
+	defer close(c.evictionDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.evictionStop:
+			return
+		case <-ticker.C:
+			backend.RemoveExpired()
+		}
+	}
+}
+
+// writeQueued stores queued entries until the cache is stopped
+func (c *SemanticCache) writeQueued() {
+	defer c.writersDone.Done()
+	for entry := range c.writes {
+		metrics.SetCacheWriteQueueLength(len(c.writes))
+		if err := c.store(entry); err != nil {
+			log.Printf("Error storing cache entry %s: %v", entry.ID, err)
+		}
 	}
 }
 
+// Stop stores the queued entries and stops the writers, the removal of
+// expired entries and the snapshots, saving a last one; entries completed
+// afterwards are stored inline
+func (c *SemanticCache) Stop() {
+	if c == nil {
+		return
+	}
+	c.stopOnce.Do(func() {
+		if c.evictionStop != nil {
+			close(c.evictionStop)
+			<-c.evictionDone
+		}
+	})
+	if c.writes != nil {
+		c.writesMu.Lock()
+		if !c.stopped {
+			c.stopped = true
+			close(c.writes)
+		}
+		c.writesMu.Unlock()
+		c.writersDone.Wait()
+	}
+	c.stopSnapshots()
+}
+
+// embed generates the embedding for a query, pooling chunk embeddings for long queries
+func (c *SemanticCache) embed(text string) ([]float32, error) {
+	return c.embedWith(text, nil)
+}
+
+// embedWith generates the embedding for a query like embed, reusing the
+// embeddings of its request when given
+func (c *SemanticCache) embedWith(text string, set *embeddings.Set) ([]float32, error) {
+	return c.embedText(c.normalizer.Normalize(text), set)
+}
+
+// embedText generates the embedding of a text as it is
+func (c *SemanticCache) embedText(text string, set *embeddings.Set) ([]float32, error) {
+	chunks := chunking.Split(text, c.chunking)
+	chunkEmbeddings := make([][]float32, 0, len(chunks))
+	for _, chunk := range chunks {
+		embedding, err := set.Embed(chunk, c.embedFunc)
+		if err != nil {
+			return nil, err
+		}
+		chunkEmbeddings = append(chunkEmbeddings, embedding)
+	}
+	return chunking.PoolEmbeddings(chunkEmbeddings, c.chunking.Pooling)
+}
+
+// computedEmbedding returns the embedding of a query if its request already
+// computed the embeddings of all its chunks, nil otherwise
+func (c *SemanticCache) computedEmbedding(text string, set *embeddings.Set) []float32 {
+	chunks := chunking.Split(c.normalizer.Normalize(text), c.chunking)
+	computed := make([][]float32, 0, len(chunks))
+	for _, chunk := range chunks {
+		embedding, ok := set.Lookup(chunk)
+		if !ok {
+			return nil
+		}
+		computed = append(computed, embedding)
+	}
+	embedding, err := chunking.PoolEmbeddings(computed, c.chunking.Pooling)
+	if err != nil {
+		return nil
+	}
+	return embedding
+}
+
 // IsEnabled returns whether the cache is enabled
 func (c *SemanticCache) IsEnabled() bool {
 	return c.enabled
 }
 
+// IdempotencyKey derives a stable key from the model and request body, so a
+// retried request maps to the same cache entry as its original attempt
+func IdempotencyKey(model string, requestBody []byte) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write(requestBody)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// entryID returns the ID of the entry for a request in the given epoch
+func entryID(epoch, model string, requestBody []byte) string {
+	id := IdempotencyKey(model, requestBody)
+	if epoch != "" {
+		id = epoch + ":" + id
+	}
+	return id
+}
+
+// Epoch returns the current cache epoch
+func (c *SemanticCache) Epoch() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.epoch
+}
+
+// SetEpoch starts a new cache epoch, dropping all entries from other epochs.
+// Backends shared with other routers keep them until they expire, as other
+// replicas may still be on the previous epoch.
+func (c *SemanticCache) SetEpoch(epoch string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch == c.epoch {
+		return
+	}
+
+	dropped := 0
+	for id, entry := range c.pending {
+		if entry.Epoch != epoch {
+			delete(c.pending, id)
+			dropped++
+		}
+	}
+	metrics.SetCachePendingEntries(len(c.pending))
+	if backend, ok := c.backend.(epochDropper); ok {
+		dropped += backend.DropOtherEpochs(epoch)
+	}
+	log.Printf("Cache epoch changed from %q to %q, dropped %d entries", c.epoch, epoch, dropped)
+	c.epoch = epoch
+}
+
 // AddPendingRequest adds a pending request to the cache (without response yet)
+// and returns the entry ID. Retries of a request already in the cache reuse the
+// existing entry instead of adding a duplicate.
 func (c *SemanticCache) AddPendingRequest(model string, query string, requestBody []byte) (string, error) {
+	return c.AddPendingRequestWithEmbeddings(model, query, requestBody, nil)
+}
+
+// AddPendingRequestWithEmbeddings adds a pending request like
+// AddPendingRequest, reusing the query embedding its request computed, e.g.
+// to look it up, so it is not embedded again
+func (c *SemanticCache) AddPendingRequestWithEmbeddings(model string, query string, requestBody []byte, set *embeddings.Set) (string, error) {
+	c.mu.RLock()
+	epoch := c.epoch
+	id := entryID(epoch, model, requestBody)
 	if !c.enabled {
-		return query, nil
+		c.mu.RUnlock()
+		return id, nil
+	}
+	_, exists := c.pending[id]
+	c.mu.RUnlock()
+	if !exists {
+		entry, err := c.backend.Get(id)
+		if err != nil {
+			return "", err
+		}
+		exists = entry != nil
+	}
+	if exists {
+		log.Printf("Cache entry %s already exists, not adding duplicate pending request", id)
+		return id, nil
 	}
 
-	// Generate embedding for the query
-	embedding, err := candle_binding.GetEmbedding(query, 512)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate embedding: %w", err)
+	// Generate embedding for the query, unless writers embed it once the
+	// entry is complete and the request has not embedded it already
+	var embedding []float32
+	if c.writes == nil {
+		var err error
+		if embedding, err = c.embedWith(query, set); err != nil {
+			return "", fmt.Errorf("failed to generate embedding: %w", err)
+		}
+	} else {
+		embedding = c.computedEmbedding(query, set)
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Cleanup expired entries if TTL is set
-	c.cleanupExpiredEntries()
+	// Cleanup pending requests that outlived the TTL without a response
+	c.cleanupExpiredPending()
+
+	// Another attempt may have added the entry while we computed the embedding
+	if _, exists := c.pending[id]; exists {
+		return id, nil
+	}
 
 	// Create a new entry with the pending request
-	entry := CacheEntry{
+	c.pending[id] = CacheEntry{
+		ID:          id,
+		Epoch:       epoch,
 		RequestBody: requestBody,
 		Model:       model,
 		Query:       query,
 		Embedding:   embedding,
 		Timestamp:   time.Now(),
 	}
-
-	c.entries = append(c.entries, entry)
 	log.Printf("Added pending cache entry for: %s", query)
 
 	// Enforce max entries limit if set
-	if c.maxEntries > 0 && len(c.entries) > c.maxEntries {
-		// Sort by timestamp (oldest first)
-		sort.Slice(c.entries, func(i, j int) bool {
-			return c.entries[i].Timestamp.Before(c.entries[j].Timestamp)
-		})
-		// Remove oldest entries
-		c.entries = c.entries[len(c.entries)-c.maxEntries:]
-		log.Printf("Trimmed cache to %d entries", c.maxEntries)
+	if c.maxEntries > 0 && len(c.pending) > c.maxEntries {
+		c.trimPending()
 	}
+	metrics.SetCachePendingEntries(len(c.pending))
 
-	return query, nil
+	return id, nil
 }
 
-// UpdateWithResponse updates a pending request with its response
-func (c *SemanticCache) UpdateWithResponse(query string, responseBody []byte) error {
+// UpdateWithResponse completes a pending request with its response, storing
+// it in the backend. Updating an entry that already has a response is a no-op,
+// so duplicate responses from retried requests can't overwrite the first one.
+func (c *SemanticCache) UpdateWithResponse(id string, responseBody []byte) error {
+	return c.UpdateWithResponseTTL(id, responseBody, 0)
+}
+
+// UpdateWithResponseTTL completes a pending request like UpdateWithResponse,
+// keeping the entry for the given TTL instead of the cache's if it is positive.
+// With a write queue the entry is stored in the background, and dropped with
+// ErrWriteDropped if the queue is full.
+func (c *SemanticCache) UpdateWithResponseTTL(id string, responseBody []byte, ttl time.Duration) error {
 	if !c.enabled {
 		return nil
 	}
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	entry, ok := c.pending[id]
+	delete(c.pending, id)
+	metrics.SetCachePendingEntries(len(c.pending))
+	c.mu.Unlock()
+
+	if !ok {
+		existing, err := c.backend.Get(id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return fmt.Errorf("no pending request found for ID: %s", id)
+		}
+		log.Printf("Cache entry %s already has a response, ignoring duplicate update", id)
+		return nil
+	}
 
-	// Find the pending request by query
-	for i, entry := range c.entries {
-		if entry.Query == query && entry.ResponseBody == nil {
-			// Update with response
-			c.entries[i].ResponseBody = responseBody
-			c.entries[i].Timestamp = time.Now()
-			log.Printf("Cache entry updated: %s", query)
-			return nil
+	// Update with response
+	entry.ResponseBody = responseBody
+	entry.Timestamp = time.Now()
+	if ttl > 0 {
+		entry.TTL = ttl
+	}
+	c.writesMu.RLock()
+	defer c.writesMu.RUnlock()
+	if c.writes == nil || c.stopped {
+		return c.store(entry)
+	}
+	select {
+	case c.writes <- entry:
+		metrics.SetCacheWriteQueueLength(len(c.writes))
+		return nil
+	default:
+		metrics.RecordCacheWriteDropped()
+		return ErrWriteDropped
+	}
+}
+
+// store embeds a completed entry if needed and stores it in the backend.
+// Entries of a previous epoch are discarded.
+func (c *SemanticCache) store(entry CacheEntry) error {
+	if epoch := c.Epoch(); entry.Epoch != epoch {
+		log.Printf("Discarding cache entry %s of previous epoch %q", entry.ID, entry.Epoch)
+		return nil
+	}
+	if entry.Embedding == nil {
+		embedding, err := c.embed(entry.Query)
+		if err != nil {
+			return fmt.Errorf("failed to generate embedding: %w", err)
 		}
+		entry.Embedding = embedding
+	}
+	if err := c.backend.Add(entry); err != nil {
+		return err
 	}
+	c.addToPrefilter(entry)
+	log.Printf("Cache entry updated: %s", entry.Query)
+	return nil
+}
+
+// RemovePendingRequest drops a pending request that will never get a response,
+// e.g. because the router rejected it. Entries with a response are kept.
+func (c *SemanticCache) RemovePendingRequest(id string) {
+	if !c.enabled {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+	metrics.SetCachePendingEntries(len(c.pending))
+}
+
+// PendingCount returns the number of entries still waiting for a response
+func (c *SemanticCache) PendingCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.pending)
+}
+
+// Pending returns the entries still waiting for a response, oldest first
+func (c *SemanticCache) Pending() []CacheEntry {
+	c.mu.RLock()
+	entries := make([]CacheEntry, 0, len(c.pending))
+	for _, entry := range c.pending {
+		entries = append(entries, entry)
+	}
+	c.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries
+}
 
-	return fmt.Errorf("no pending request found for query: %s", query)
+// Entries returns the completed entries of the backend, oldest first, or
+// ErrNotListable if the backend cannot list them
+func (c *SemanticCache) Entries() ([]CacheEntry, error) {
+	backend, ok := c.backend.(entryLister)
+	if !ok {
+		return nil, ErrNotListable
+	}
+	return backend.Entries(), nil
+}
+
+// Flush drops every pending and completed entry, returning how many were
+// dropped, or ErrNotListable if the backend cannot drop all its entries
+func (c *SemanticCache) Flush() (int, error) {
+	backend, ok := c.backend.(entryLister)
+	if !ok {
+		return 0, ErrNotListable
+	}
+	c.mu.Lock()
+	flushed := len(c.pending)
+	clear(c.pending)
+	c.mu.Unlock()
+	flushed += backend.Flush()
+	if c.prefilter != nil {
+		c.prefilter.reset()
+	}
+	log.Printf("Cache flushed, dropped %d entries", flushed)
+	return flushed, nil
+}
+
+// Evict removes the entry with the given ID from the cache
+func (c *SemanticCache) Evict(id string) error {
+	if !c.enabled {
+		return nil
+	}
+
+	c.mu.Lock()
+	delete(c.pending, id)
+	metrics.SetCachePendingEntries(len(c.pending))
+	c.mu.Unlock()
+	return c.backend.Evict(id)
 }
 
 // AddEntry adds a complete entry to the cache
@@ -129,12 +564,15 @@ func (c *SemanticCache) AddEntry(model string, query string, requestBody, respon
 	}
 
 	// Generate embedding for the query
-	embedding, err := candle_binding.GetEmbedding(query, 512)
+	embedding, err := c.embed(query)
 	if err != nil {
 		return fmt.Errorf("failed to generate embedding: %w", err)
 	}
 
+	epoch := c.Epoch()
 	entry := CacheEntry{
+		ID:           entryID(epoch, model, requestBody),
+		Epoch:        epoch,
 		RequestBody:  requestBody,
 		ResponseBody: responseBody,
 		Model:        model,
@@ -142,140 +580,169 @@ func (c *SemanticCache) AddEntry(model string, query string, requestBody, respon
 		Embedding:    embedding,
 		Timestamp:    time.Now(),
 	}
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// Cleanup expired entries
-	c.cleanupExpiredEntries()
-
-	c.entries = append(c.entries, entry)
-	log.Printf("Added cache entry: %s", query)
-
-	// Enforce max entries limit
-	if c.maxEntries > 0 && len(c.entries) > c.maxEntries {
-		// Sort by timestamp (oldest first)
-		sort.Slice(c.entries, func(i, j int) bool {
-			return c.entries[i].Timestamp.Before(c.entries[j].Timestamp)
-		})
-		// Remove oldest entries
-		c.entries = c.entries[len(c.entries)-c.maxEntries:]
+	if err := c.backend.Add(entry); err != nil {
+		return err
 	}
-
+	c.addToPrefilter(entry)
+	log.Printf("Added cache entry: %s", query)
 	return nil
 }
 
 // FindSimilar looks for a similar request in the cache
 func (c *SemanticCache) FindSimilar(model string, query string) ([]byte, bool, error) {
+	return c.FindSimilarWithEmbeddings(model, query, nil)
+}
+
+// FindSimilarWithEmbeddings looks for a similar request like FindSimilar,
+// embedding the query into the embeddings of its request for its other
+// stages to reuse
+func (c *SemanticCache) FindSimilarWithEmbeddings(model string, query string, set *embeddings.Set) ([]byte, bool, error) {
+	entry, found, err := c.FindSimilarEntry(model, query, set)
+	if !found {
+		return nil, found, err
+	}
+	return entry.ResponseBody, true, err
+}
+
+// FindSimilarEntry looks for a similar request like FindSimilarWithEmbeddings,
+// returning the entry answering it
+func (c *SemanticCache) FindSimilarEntry(model string, query string, set *embeddings.Set) (*CacheEntry, bool, error) {
 	if !c.enabled {
 		return nil, false, nil
 	}
+	start := time.Now()
+	entry, found, err := c.findSimilar(model, query, set)
+	metrics.RecordCacheLookup(model, found, err, time.Since(start).Seconds())
+	return entry, found, err
+}
+
+// findSimilar looks for a similar request of an enabled cache
+func (c *SemanticCache) findSimilar(model string, query string, set *embeddings.Set) (*CacheEntry, bool, error) {
+	// Skip the embedding for queries no entry can be similar to
+	epoch := c.Epoch()
+	if c.prefilter != nil && !c.prefilter.mayHaveSimilar(model, epoch, c.normalizer.Normalize(query)) {
+		log.Printf("Cache miss predicted by the pre-filter, skipping lookup")
+		metrics.RecordCachePrefilterSkip()
+		return nil, false, nil
+	}
 
 	// Generate embedding for the query
-	queryEmbedding, err := candle_binding.GetEmbedding(query, 512)
+	queryEmbedding, err := c.embedWith(query, set)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to generate embedding: %w", err)
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	// Cleanup expired entries
-	c.cleanupExpiredEntriesReadOnly()
-
-	type SimilarityResult struct {
-		Entry      CacheEntry
-		Similarity float32
+	// Only compare with entries with the same model from the current epoch
+	entry, similarity, err := c.backend.FindSimilar(model, epoch, queryEmbedding)
+	if err != nil {
+		return nil, false, err
 	}
 
-	// Only compare with entries that have responses
-	results := make([]SimilarityResult, 0, len(c.entries))
-	for _, entry := range c.entries {
-		if entry.ResponseBody == nil {
-			continue // Skip entries without responses
-		}
-
-		// Only compare with entries with the same model
-		if entry.Model != model {
-			continue
-		}
-
-		// Calculate similarity
-		var dotProduct float32
-		for i := 0; i < len(queryEmbedding) && i < len(entry.Embedding); i++ {
-			dotProduct += queryEmbedding[i] * entry.Embedding[i]
-		}
-
-		results = append(results, SimilarityResult{
-			Entry:      entry,
-			Similarity: dotProduct,
-		})
+	if c.compareRaw {
+		c.compareWithRaw(model, epoch, query, set, entry != nil && similarity >= c.similarityThreshold)
 	}
 
 	// No results found
-	if len(results) == 0 {
+	if entry == nil {
 		return nil, false, nil
 	}
-
-	// Sort by similarity (highest first)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
-	})
+	metrics.RecordCacheSimilarity(model, similarity)
 
 	// Check if the best match exceeds the threshold
-	if results[0].Similarity >= c.similarityThreshold {
+	if similarity >= c.similarityThreshold {
 		log.Printf("Cache hit: similarity=%.4f, threshold=%.4f",
-			results[0].Similarity, c.similarityThreshold)
-		return results[0].Entry.ResponseBody, true, nil
+			similarity, c.similarityThreshold)
+		if backend, ok := c.backend.(usageTracker); ok {
+			backend.Touch(entry.ID)
+		}
+		return entry, true, nil
 	}
 
 	log.Printf("Cache miss: best similarity=%.4f, threshold=%.4f",
-		results[0].Similarity, c.similarityThreshold)
+		similarity, c.similarityThreshold)
 	return nil, false, nil
 }
 
-// cleanupExpiredEntries removes expired entries from the cache
-// Assumes the caller holds a write lock
-func (c *SemanticCache) cleanupExpiredEntries() {
-	if c.ttlSeconds <= 0 {
-		return
-	}
-
-	now := time.Now()
-	validEntries := make([]CacheEntry, 0, len(c.entries))
-
-	for _, entry := range c.entries {
-		// Keep entries that haven't expired
-		if now.Sub(entry.Timestamp).Seconds() < float64(c.ttlSeconds) {
-			validEntries = append(validEntries, entry)
+// compareWithRaw looks a query up as sent, counting whether it and its
+// normalized form hit. The entries were stored normalized, so this measures
+// what normalizing lookups gains against them.
+func (c *SemanticCache) compareWithRaw(model, epoch, query string, set *embeddings.Set, normalizedHit bool) {
+	rawHit := normalizedHit
+	if c.normalizer.Normalize(query) != query {
+		rawEmbedding, err := c.embedText(query, set)
+		if err != nil {
+			log.Printf("Error embedding the raw query for comparison: %v", err)
+			return
 		}
+		entry, similarity, err := c.backend.FindSimilar(model, epoch, rawEmbedding)
+		if err != nil {
+			log.Printf("Error looking up the raw query for comparison: %v", err)
+			return
+		}
+		rawHit = entry != nil && similarity >= c.similarityThreshold
 	}
+	metrics.RecordCacheNormalizationComparison(normalizedHit, rawHit)
+}
 
-	if len(validEntries) < len(c.entries) {
-		log.Printf("Removed %d expired cache entries", len(c.entries)-len(validEntries))
-		c.entries = validEntries
+// addToPrefilter records the query of an entry stored in the backend
+func (c *SemanticCache) addToPrefilter(entry CacheEntry) {
+	if c.prefilter != nil {
+		c.prefilter.add(entry.Model, entry.Epoch, c.normalizer.Normalize(entry.Query))
 	}
 }
 
-// cleanupExpiredEntriesReadOnly checks for expired entries but doesn't modify the cache
-// Used during read operations where we only have a read lock
-func (c *SemanticCache) cleanupExpiredEntriesReadOnly() {
+// cleanupExpiredPending removes pending requests older than the TTL, whose
+// response is never coming. Assumes the caller holds a write lock
+func (c *SemanticCache) cleanupExpiredPending() {
 	if c.ttlSeconds <= 0 {
 		return
 	}
+	if expired := c.expirePending(time.Duration(c.ttlSeconds) * time.Second); expired > 0 {
+		log.Printf("Removed %d expired pending cache entries", expired)
+	}
+}
 
-	now := time.Now()
-	expiredCount := 0
+// ExpirePending removes pending requests that waited longer than maxAge for
+// their response, e.g. because their stream broke without the router seeing
+// it end, returning how many were removed
+func (c *SemanticCache) ExpirePending(maxAge time.Duration) int {
+	if !c.enabled || maxAge <= 0 {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expirePending(maxAge)
+}
 
-	for _, entry := range c.entries {
-		if now.Sub(entry.Timestamp).Seconds() >= float64(c.ttlSeconds) {
-			expiredCount++
+// expirePending removes pending requests older than maxAge. Assumes the caller
+// holds a write lock
+func (c *SemanticCache) expirePending(maxAge time.Duration) int {
+	expired := 0
+	for id, entry := range c.pending {
+		if time.Since(entry.Timestamp) >= maxAge {
+			delete(c.pending, id)
+			expired++
 		}
 	}
+	metrics.SetCachePendingEntries(len(c.pending))
+	return expired
+}
 
-	if expiredCount > 0 {
-		log.Printf("Found %d expired cache entries during read operation", expiredCount)
+// trimPending removes the oldest pending requests beyond the max entries.
+// Assumes the caller holds a write lock
+func (c *SemanticCache) trimPending() {
+	entries := make([]CacheEntry, 0, len(c.pending))
+	for _, entry := range c.pending {
+		entries = append(entries, entry)
+	}
+	// Sort by timestamp (oldest first)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	for _, entry := range entries[:len(entries)-c.maxEntries] {
+		delete(c.pending, entry.ID)
 	}
+	log.Printf("Trimmed pending cache entries to %d", c.maxEntries)
 }
 
 // ChatMessage represents a message in the OpenAI chat format
@@ -284,14 +751,51 @@ type ChatMessage struct {
 	Content string `json:"content"`
 }
 
+// UnmarshalJSON decodes a message whose content is a string or an array of
+// content parts, of which Content is the text of the text parts, one per line
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	// Fields absent from the message are left unchanged, as without a custom
+	// decoder
+	msg := struct {
+		Role    *string         `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}{Role: &m.Role}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	content := bytes.TrimSpace(msg.Content)
+	if len(content) == 0 || content[0] != '[' {
+		if len(content) > 0 && json.Unmarshal(content, &m.Content) != nil {
+			return errors.New("content is not a string or an array of content parts")
+		}
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return fmt.Errorf("invalid content parts: %w", err)
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
+}
+
 // OpenAIRequest represents an OpenAI API request
 type OpenAIRequest struct {
 	Model    string        `json:"model"`
 	Messages []ChatMessage `json:"messages"`
 }
 
-// ExtractQueryFromOpenAIRequest extracts the user query from an OpenAI request
-func ExtractQueryFromOpenAIRequest(requestBody []byte) (string, string, error) {
+// unmarshalQuery extracts the model and user query by unmarshalling the whole
+// request
+func unmarshalQuery(requestBody []byte) (string, string, error) {
 	var req OpenAIRequest
 	if err := json.Unmarshal(requestBody, &req); err != nil {
 		return "", "", fmt.Errorf("invalid request body: %w", err)
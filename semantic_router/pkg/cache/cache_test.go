@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/embeddings"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// constantEmbedding makes every query identical for the cache
+func constantEmbedding(text string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+func TestEpochPartitionsCache(t *testing.T) {
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc:           constantEmbedding,
+		Epoch:               "v1",
+	})
+	if err := c.AddEntry("phi4", "hello", []byte(`{}`), []byte(`{"epoch":"v1"}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if _, found, _ := c.FindSimilar("phi4", "hello"); !found {
+		t.Fatal("expected a hit in the same epoch")
+	}
+
+	c.SetEpoch("v2")
+	if _, found, _ := c.FindSimilar("phi4", "hello"); found {
+		t.Error("expected no hit for an entry from a previous epoch")
+	}
+
+	id, err := c.AddPendingRequest("phi4", "hello", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("AddPendingRequest: %v", err)
+	}
+	if id != entryID("v2", "phi4", []byte(`{}`)) || id == entryID("v1", "phi4", []byte(`{}`)) {
+		t.Errorf("entry ID %s is not salted with the current epoch", id)
+	}
+	if err := c.UpdateWithResponse(id, []byte(`{"epoch":"v2"}`)); err != nil {
+		t.Fatalf("UpdateWithResponse: %v", err)
+	}
+	response, found, _ := c.FindSimilar("phi4", "hello")
+	if !found || string(response) != `{"epoch":"v2"}` {
+		t.Errorf("expected the v2 response, got %s (found=%v)", response, found)
+	}
+}
+
+func TestAsyncWrites(t *testing.T) {
+	release := make(chan struct{})
+	embedded := make(chan string, 10)
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc: func(text string) ([]float32, error) {
+			if text == "slow" {
+				<-release
+			}
+			embedded <- text
+			return constantEmbedding(text)
+		},
+		WriteQueueSize: 1,
+	})
+
+	complete := func(query string) error {
+		id, err := c.AddPendingRequest("phi4", query, []byte(`{"q":"`+query+`"}`))
+		if err != nil {
+			t.Fatalf("AddPendingRequest: %v", err)
+		}
+		return c.UpdateWithResponse(id, []byte(`{"a":"`+query+`"}`))
+	}
+
+	// The writer blocks embedding the first entry, the second one waits in the
+	// queue and the third one is dropped
+	if err := complete("slow"); err != nil {
+		t.Fatalf("UpdateWithResponse: %v", err)
+	}
+	if len(embedded) != 0 {
+		t.Fatal("pending request embedded before its response, expected the writer to embed it")
+	}
+	for len(c.writes) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := complete("queued"); err != nil {
+		t.Fatalf("UpdateWithResponse: %v", err)
+	}
+	if err := complete("dropped"); !errors.Is(err, ErrWriteDropped) {
+		t.Fatalf("expected the entry to be dropped, got %v", err)
+	}
+	if c.PendingCount() != 0 {
+		t.Errorf("%d entries left pending", c.PendingCount())
+	}
+
+	close(release)
+	c.Stop()
+	for _, query := range []string{"slow", "queued"} {
+		if entry, _ := c.backend.Get(entryID("", "phi4", []byte(`{"q":"`+query+`"}`))); entry == nil {
+			t.Errorf("entry %q not stored", query)
+		}
+	}
+	if entry, _ := c.backend.Get(entryID("", "phi4", []byte(`{"q":"dropped"}`))); entry != nil {
+		t.Error("dropped entry stored")
+	}
+
+	// Entries completed after stopping are stored inline
+	if err := complete("late"); err != nil {
+		t.Fatalf("UpdateWithResponse after Stop: %v", err)
+	}
+	if entry, _ := c.backend.Get(entryID("", "phi4", []byte(`{"q":"late"}`))); entry == nil {
+		t.Error("entry completed after stopping not stored")
+	}
+}
+
+func TestListAndFlush(t *testing.T) {
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc:           constantEmbedding,
+		Prefilter:           PrefilterOptions{Enabled: true},
+	})
+	if err := c.AddEntry("phi4", "hello", []byte(`{"n":1}`), []byte(`{}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if err := c.AddEntry("phi4", "goodbye", []byte(`{"n":2}`), []byte(`{}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if _, err := c.AddPendingRequest("phi4", "waiting", []byte(`{"n":3}`)); err != nil {
+		t.Fatalf("AddPendingRequest: %v", err)
+	}
+
+	entries, err := c.Entries()
+	if err != nil || len(entries) != 2 || entries[0].Query != "hello" || entries[1].Query != "goodbye" {
+		t.Fatalf("Entries = %v, %v, want hello then goodbye", entries, err)
+	}
+	if pending := c.Pending(); len(pending) != 1 || pending[0].Query != "waiting" {
+		t.Fatalf("Pending = %v, want the waiting request", pending)
+	}
+
+	flushed, err := c.Flush()
+	if err != nil || flushed != 3 {
+		t.Fatalf("Flush = %d, %v, want 3", flushed, err)
+	}
+	if entries, _ := c.Entries(); len(entries) != 0 || c.PendingCount() != 0 {
+		t.Errorf("%d entries and %d pending left after a flush", len(entries), c.PendingCount())
+	}
+	if _, found, _ := c.FindSimilar("phi4", "hello"); found {
+		t.Error("expected no hit after a flush")
+	}
+
+	// Entries added after a flush pass the pre-filter again
+	if err := c.AddEntry("phi4", "hello", []byte(`{"n":1}`), []byte(`{}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if _, found, _ := c.FindSimilar("phi4", "hello"); !found {
+		t.Error("expected a hit for an entry added after the flush")
+	}
+
+	shared := NewSemanticCache(SemanticCacheOptions{Enabled: true, EmbedFunc: constantEmbedding, Backend: &stubBackend{}})
+	if _, err := shared.Entries(); !errors.Is(err, ErrNotListable) {
+		t.Errorf("Entries of an unlistable backend = %v, want ErrNotListable", err)
+	}
+	if _, err := shared.Flush(); !errors.Is(err, ErrNotListable) {
+		t.Errorf("Flush of an unlistable backend = %v, want ErrNotListable", err)
+	}
+}
+
+// stubBackend is a backend storing nothing, unable to list its entries
+type stubBackend struct{}
+
+func (*stubBackend) Get(id string) (*CacheEntry, error) { return nil, nil }
+func (*stubBackend) Add(entry CacheEntry) error         { return nil }
+func (*stubBackend) FindSimilar(model, epoch string, embedding []float32) (*CacheEntry, float32, error) {
+	return nil, 0, nil
+}
+func (*stubBackend) Evict(id string) error { return nil }
+
+func TestRequestEmbeddingsReused(t *testing.T) {
+	calls := 0
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc: func(text string) ([]float32, error) {
+			calls++
+			return constantEmbedding(text)
+		},
+		WriteQueueSize: 10,
+	})
+
+	// The lookup's embedding is stored with the entry, not computed again by the writer
+	set := embeddings.NewSet()
+	if _, found, err := c.FindSimilarWithEmbeddings("phi4", "hello", set); err != nil || found {
+		t.Fatalf("FindSimilarWithEmbeddings = %v, %v, want a miss", found, err)
+	}
+	id, err := c.AddPendingRequestWithEmbeddings("phi4", "hello", []byte(`{"q":"hello"}`), set)
+	if err != nil {
+		t.Fatalf("AddPendingRequestWithEmbeddings: %v", err)
+	}
+	if err := c.UpdateWithResponse(id, []byte(`{}`)); err != nil {
+		t.Fatalf("UpdateWithResponse: %v", err)
+	}
+	c.Stop()
+	if calls != 1 {
+		t.Errorf("query embedded %d times, want once", calls)
+	}
+
+	// Requests that did not embed the query leave it to the writer
+	id, err = c.AddPendingRequestWithEmbeddings("phi4", "other", []byte(`{"q":"other"}`), embeddings.NewSet())
+	if err != nil {
+		t.Fatalf("AddPendingRequestWithEmbeddings: %v", err)
+	}
+	if entry := c.pending[id]; entry.Embedding != nil {
+		t.Error("pending request embedded before its response")
+	}
+}
+
+func TestLookupMetrics(t *testing.T) {
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc: func(text string) ([]float32, error) {
+			if text == "broken" {
+				return nil, errors.New("embedding failed")
+			}
+			return keywordEmbedding(text)
+		},
+	})
+	const model = "lookup-metrics-model"
+	if err := c.AddEntry(model, "cats", []byte(`{}`), []byte(`{}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.CacheEntries.WithLabelValues(model)); got != 1 {
+		t.Errorf("llm_cache_entries = %v, want 1", got)
+	}
+
+	for _, query := range []string{"cats", "dogs", "broken"} {
+		c.FindSimilar(model, query)
+	}
+	for name, counter := range map[string]*prometheus.CounterVec{"hits": metrics.CacheHits, "misses": metrics.CacheMisses, "errors": metrics.CacheErrors} {
+		if got := testutil.ToFloat64(counter.WithLabelValues(model)); got != 1 {
+			t.Errorf("%s = %v, want 1", name, got)
+		}
+	}
+	// The hit and the miss found an entry, the failed lookup did not
+	if count := histogramCount(t, metrics.CacheSimilarity.WithLabelValues(model).(prometheus.Histogram)); count != 2 {
+		t.Errorf("similarity observations = %d, want 2", count)
+	}
+	if count := histogramCount(t, metrics.CacheLookupLatency.WithLabelValues(model).(prometheus.Histogram)); count != 3 {
+		t.Errorf("lookup latency observations = %d, want 3", count)
+	}
+
+	if _, err := c.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.CacheEntries.WithLabelValues(model)); got != 0 {
+		t.Errorf("llm_cache_entries after flush = %v, want 0", got)
+	}
+}
+
+func histogramCount(t *testing.T, histogram prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := histogram.Write(&m); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestPendingEntriesGauge(t *testing.T) {
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc:           constantEmbedding,
+	})
+	first, err := c.AddPendingRequest("phi4", "hello", []byte(`{"n":1}`))
+	if err != nil {
+		t.Fatalf("AddPendingRequest: %v", err)
+	}
+	if _, err := c.AddPendingRequest("phi4", "hi", []byte(`{"n":2}`)); err != nil {
+		t.Fatalf("AddPendingRequest: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.CachePendingEntries); got != 2 {
+		t.Errorf("pending entries gauge = %v, want 2", got)
+	}
+	if err := c.UpdateWithResponse(first, []byte(`{}`)); err != nil {
+		t.Fatalf("UpdateWithResponse: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.CachePendingEntries); got != 1 {
+		t.Errorf("pending entries gauge after a response = %v, want 1", got)
+	}
+}
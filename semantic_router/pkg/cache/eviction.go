@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policies choosing which entries the memory backend evicts when it is full
+const (
+	// Oldest entries first
+	EvictionFIFO = "fifo"
+	// Entries hit least recently first
+	EvictionLRU = "lru"
+	// Entries hit least often first, the least recently hit among those
+	EvictionLFU = "lfu"
+)
+
+// Reasons entries are evicted, recorded in metrics
+const (
+	EvictionReasonExpired    = "expired"
+	EvictionReasonMaxEntries = "max_entries"
+	EvictionReasonMaxMemory  = "max_memory"
+	EvictionReasonEpoch      = "epoch"
+)
+
+// entryOverheadBytes approximates the memory an entry takes beyond its
+// fields' contents: the entry itself, its position and its index links
+const entryOverheadBytes = 256
+
+// EvictionOptions holds options for evicting entries of the in-memory backend
+type EvictionOptions struct {
+	// Which entries are evicted when the backend is full, defaults to fifo
+	Policy string
+	// Estimated memory the entries may take, 0 for no limit
+	MaxMemoryBytes int64
+	// How often expired entries are removed in the background, defaults to
+	// 1m; lookups skip them in between
+	Interval time.Duration
+}
+
+// ValidateEvictionPolicy checks an eviction policy, empty for the default
+func ValidateEvictionPolicy(policy string) error {
+	switch policy {
+	case "", EvictionFIFO, EvictionLRU, EvictionLFU:
+		return nil
+	}
+	return fmt.Errorf("unknown eviction policy %q: must be %s, %s or %s", policy, EvictionFIFO, EvictionLRU, EvictionLFU)
+}
+
+// entryUsage tracks the hits of an entry for the lru and lfu policies
+type entryUsage struct {
+	lastUsed time.Time
+	hits     int
+}
+
+// entrySize estimates the memory an entry takes
+func entrySize(entry CacheEntry) int64 {
+	return int64(len(entry.ID)+len(entry.Epoch)+len(entry.RequestBody)+len(entry.ResponseBody)+
+		len(entry.Model)+len(entry.Query)+4*len(entry.Embedding)) + entryOverheadBytes
+}
+
+// evictsBefore reports whether the policy evicts the entry with usage a
+// before the one with usage b, given when each was stored
+func evictsBefore(policy string, a, b entryUsage, storedA, storedB time.Time) bool {
+	switch policy {
+	case EvictionLFU:
+		if a.hits != b.hits {
+			return a.hits < b.hits
+		}
+		fallthrough
+	case EvictionLRU:
+		if !a.lastUsed.Equal(b.lastUsed) {
+			return a.lastUsed.Before(b.lastUsed)
+		}
+	}
+	return storedA.Before(storedB)
+}
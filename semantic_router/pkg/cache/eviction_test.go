@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// fillBackend stores entries a, b and c, a oldest, then hits b three times,
+// a twice and c once, in that order
+func fillBackend(t *testing.T, b *memoryBackend) {
+	t.Helper()
+	start := time.Now().Add(-time.Minute)
+	for i, id := range []string{"a", "b", "c"} {
+		entry := CacheEntry{ID: id, Model: "phi4", Query: id, Embedding: []float32{1, 0}, Timestamp: start.Add(time.Duration(i) * time.Second)}
+		if err := b.Add(entry); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	for _, id := range []string{"b", "b", "b", "a", "a", "c"} {
+		time.Sleep(time.Millisecond)
+		b.Touch(id)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		evicted string
+	}{
+		{EvictionFIFO, "a"},
+		{EvictionLRU, "b"},
+		{EvictionLFU, "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			b := newMemoryBackend(3, 0, IndexOptions{}, EvictionOptions{Policy: tt.policy})
+			fillBackend(t, b)
+			if err := b.Add(CacheEntry{ID: "d", Model: "phi4", Query: "d", Embedding: []float32{0, 1}, Timestamp: time.Now()}); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if entry, _ := b.Get(tt.evicted); entry != nil {
+				t.Errorf("%s kept %s, want it evicted", tt.policy, tt.evicted)
+			}
+			if entries := b.Entries(); len(entries) != 3 {
+				t.Errorf("got %d entries, want 3", len(entries))
+			}
+		})
+	}
+}
+
+func TestEvictionMaxMemory(t *testing.T) {
+	entry := func(id string) CacheEntry {
+		return CacheEntry{ID: id, Model: "phi4", Query: id, ResponseBody: make([]byte, 1000), Embedding: []float32{1, 0}, Timestamp: time.Now()}
+	}
+	size := entrySize(entry("a"))
+	b := newMemoryBackend(0, 0, IndexOptions{}, EvictionOptions{MaxMemoryBytes: 2*size + size/2})
+	before := testutil.ToFloat64(metrics.CacheEvictions.WithLabelValues(EvictionReasonMaxMemory))
+
+	for i := 0; i < 4; i++ {
+		if err := b.Add(entry(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if entries := b.Entries(); len(entries) != 2 || b.bytes != 2*size {
+		t.Errorf("kept %d entries of %d bytes, want 2 of %d", len(entries), b.bytes, 2*size)
+	}
+	if got := testutil.ToFloat64(metrics.CacheEvictions.WithLabelValues(EvictionReasonMaxMemory)) - before; got != 2 {
+		t.Errorf("max_memory evictions = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.CacheMemoryBytes); got != float64(2*size) {
+		t.Errorf("llm_cache_memory_bytes = %v, want %d", got, 2*size)
+	}
+}
+
+func TestExpiredEntriesRemovedInBackground(t *testing.T) {
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		TTLSeconds:          3600,
+		Enabled:             true,
+		EmbedFunc:           keywordEmbedding,
+		Eviction:            EvictionOptions{Interval: 10 * time.Millisecond},
+	})
+	defer c.Stop()
+	backend := c.backend.(*memoryBackend)
+	if err := backend.Add(CacheEntry{ID: "old", Model: "phi4", Query: "cats", Embedding: []float32{1, 0}, Timestamp: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		backend.mu.RLock()
+		n := len(backend.entries)
+		backend.mu.RUnlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired entry not removed in the background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if backend.bytes != 0 {
+		t.Errorf("%d bytes left accounted after removing every entry", backend.bytes)
+	}
+}
+
+func TestValidateEvictionPolicy(t *testing.T) {
+	for _, policy := range []string{"", EvictionFIFO, EvictionLRU, EvictionLFU} {
+		if err := ValidateEvictionPolicy(policy); err != nil {
+			t.Errorf("policy %q rejected: %v", policy, err)
+		}
+	}
+	if ValidateEvictionPolicy("random") == nil {
+		t.Error("unknown policy accepted")
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/tidwall/gjson"
+)
+
+// ExtractQueryFromOpenAIRequest extracts the model and the last user message
+// from an OpenAI request. Only those paths are decoded rather than the whole
+// message history, with the same results as unmarshalling the request:
+// case-insensitive keys, the last of duplicate keys winning and nulls leaving
+// fields unset.
+func ExtractQueryFromOpenAIRequest(requestBody []byte) (string, string, error) {
+	if !gjson.ValidBytes(requestBody) {
+		return "", "", errors.New("invalid request body: malformed JSON")
+	}
+	return ExtractQueryFromValidRequest(requestBody)
+}
+
+// ExtractQueryFromValidRequest is ExtractQueryFromOpenAIRequest for a body
+// already known to be valid JSON, e.g. because it was unmarshalled before,
+// skipping the validation pass. The result for malformed JSON is undefined.
+func ExtractQueryFromValidRequest(requestBody []byte) (string, string, error) {
+	// encoding/json replaces invalid UTF-8 in strings, which gjson keeps as is
+	if !utf8.Valid(requestBody) {
+		return unmarshalQuery(requestBody)
+	}
+
+	// Parse the body in place like gjson.GetBytes does, copying out only the
+	// returned strings
+	root := gjson.Parse(unsafe.String(unsafe.SliceData(requestBody), len(requestBody)))
+	if root.Type == gjson.Null {
+		return "", "", nil
+	}
+	if !root.IsObject() {
+		return "", "", errors.New("invalid request body: not a JSON object")
+	}
+	var model, query string
+	var err error
+	var messagesSeen, duplicateMessages bool
+	root.ForEach(func(key, value gjson.Result) bool {
+		switch {
+		case strings.EqualFold(key.String(), "model"):
+			err = setString(&model, value, "model")
+		case strings.EqualFold(key.String(), "messages"):
+			// encoding/json decodes a repeated array into the elements of
+			// the previous one, which is not worth replicating
+			duplicateMessages = messagesSeen
+			messagesSeen = true
+			query, err = lastUserMessage(value)
+		}
+		return err == nil && !duplicateMessages
+	})
+	if duplicateMessages {
+		return unmarshalQuery(requestBody)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("invalid request body: %w", err)
+	}
+	return strings.Clone(model), strings.Clone(query), nil
+}
+
+// lastUserMessage returns the content of the last message with the user role
+func lastUserMessage(messages gjson.Result) (string, error) {
+	if messages.Type == gjson.Null {
+		return "", nil
+	}
+	if !messages.IsArray() {
+		return "", errors.New("messages is not an array")
+	}
+	var query string
+	var err error
+	messages.ForEach(func(_, message gjson.Result) bool {
+		if message.Type == gjson.Null {
+			return true
+		}
+		if !message.IsObject() {
+			err = errors.New("message is not an object")
+			return false
+		}
+		var role string
+		var content gjson.Result
+		message.ForEach(func(key, value gjson.Result) bool {
+			switch {
+			case strings.EqualFold(key.String(), "role"):
+				err = setString(&role, value, "role")
+			case strings.EqualFold(key.String(), "content"):
+				// The content is decoded as a whole, so the last one wins
+				content = value
+			}
+			return err == nil
+		})
+		if err == nil {
+			var text string
+			text, err = messageText(content)
+			if role == "user" {
+				query = text
+			}
+		}
+		return err == nil
+	})
+	return query, err
+}
+
+// messageText returns the text of a message's content: a string, or the text
+// of the text parts of an array of content parts, one per line
+func messageText(content gjson.Result) (string, error) {
+	if !content.IsArray() {
+		var text string
+		if err := setString(&text, content, "content"); err != nil {
+			return "", errors.New("content is not a string or an array of content parts")
+		}
+		return text, nil
+	}
+	var texts []string
+	var err error
+	content.ForEach(func(_, part gjson.Result) bool {
+		if part.Type == gjson.Null {
+			return true
+		}
+		if !part.IsObject() {
+			err = errors.New("content part is not an object")
+			return false
+		}
+		var partType, text string
+		part.ForEach(func(key, value gjson.Result) bool {
+			switch {
+			case strings.EqualFold(key.String(), "type"):
+				err = setString(&partType, value, "content part type")
+			case strings.EqualFold(key.String(), "text"):
+				err = setString(&text, value, "content part text")
+			}
+			return err == nil
+		})
+		if partType == "text" && text != "" {
+			texts = append(texts, text)
+		}
+		return err == nil
+	})
+	return strings.Join(texts, "\n"), err
+}
+
+// setString sets a string field from a JSON value, leaving it unchanged for null
+func setString(field *string, value gjson.Result, name string) error {
+	switch value.Type {
+	case gjson.String:
+		*field = value.String()
+	case gjson.Null:
+	default:
+		return fmt.Errorf("%s is not a string", name)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExtractQueryFromOpenAIRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantModel string
+		wantQuery string
+	}{
+		{name: "last user message", body: `{"model":"auto","messages":[{"role":"user","content":"first"},{"role":"assistant","content":"reply"},{"role":"user","content":"second"}]}`, wantModel: "auto", wantQuery: "second"},
+		{name: "no user message", body: `{"model":"m","messages":[{"role":"system","content":"be brief"}]}`, wantModel: "m"},
+		{name: "escaped strings", body: `{"model":"a\"b","messages":[{"role":"user","content":"café\n"}]}`, wantModel: `a"b`, wantQuery: "café\n"},
+		{name: "case-insensitive keys", body: `{"Model":"m","MESSAGES":[{"Role":"user","Content":"hi"}]}`, wantModel: "m", wantQuery: "hi"},
+		{name: "last duplicate key wins", body: `{"model":"a","model":"b","messages":[{"role":"user","content":"x","content":"y"}]}`, wantModel: "b", wantQuery: "y"},
+		{name: "null fields", body: `{"model":null,"messages":[null,{"role":"user","content":null}]}`},
+		{name: "null request", body: `null`},
+		{name: "other fields ignored", body: `{"stream":true,"tools":[{"type":"function"}],"model":"m","messages":[{"role":"user","content":"q","name":"n"}]}`, wantModel: "m", wantQuery: "q"},
+		{name: "content parts", body: `{"messages":[{"role":"user","content":[{"type":"text","text":"what is"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}},null,{"Type":"text","Text":"in this image?"}]}]}`, wantQuery: "what is\nin this image?"},
+		{name: "repeated messages", body: `{"messages":[{"role":"user","content":"a"}],"messages":[{"content":"b"}]}`, wantQuery: "b"},
+		{name: "invalid UTF-8", body: "{\"model\":\"m\xff\",\"messages\":[{\"role\":\"user\",\"content\":\"q\xfe\"}]}", wantModel: "m�", wantQuery: "q�"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, query, err := ExtractQueryFromOpenAIRequest([]byte(tt.body))
+			if err != nil || model != tt.wantModel || query != tt.wantQuery {
+				t.Errorf("ExtractQueryFromOpenAIRequest = %q, %q, %v, want %q, %q", model, query, err, tt.wantModel, tt.wantQuery)
+			}
+			if m, q, err := ExtractQueryFromValidRequest([]byte(tt.body)); err != nil || m != model || q != query {
+				t.Errorf("ExtractQueryFromValidRequest = %q, %q, %v, want the same as with validation", m, q, err)
+			}
+			// The partial extraction agrees with unmarshalling the whole request
+			wantModel, wantQuery, wantErr := unmarshalQuery([]byte(tt.body))
+			if wantErr != nil || model != wantModel || query != wantQuery {
+				t.Errorf("unmarshalled request gives %q, %q, %v", wantModel, wantQuery, wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractQueryFromOpenAIRequestRejects(t *testing.T) {
+	for _, body := range []string{
+		``,
+		`{"model":"m"`,
+		`[]`,
+		`"request"`,
+		`{"model":1}`,
+		`{"messages":{}}`,
+		`{"messages":["hi"]}`,
+		`{"messages":[{"role":"user","content":1}]}`,
+		`{"messages":[{"role":"user","content":["hi"]}]}`,
+		`{"messages":[{"role":"user","content":[{"type":"text","text":1}]}]}`,
+		`{"messages":[{"role":"system","content":{}},{"role":"user","content":"hi"}]}`,
+		"{\"model\":\"a\tb\"}",
+	} {
+		if _, _, err := ExtractQueryFromOpenAIRequest([]byte(body)); err == nil {
+			t.Errorf("ExtractQueryFromOpenAIRequest accepted %s", body)
+		}
+		if _, _, err := unmarshalQuery([]byte(body)); err == nil {
+			t.Errorf("unmarshalling accepted %s, which the extraction rejects", body)
+		}
+	}
+}
+
+// chatHistory returns a request with a long conversation, as sent by agents
+// resending their whole history on every turn
+func chatHistory(turns, messageBytes int) []byte {
+	req := OpenAIRequest{Model: "auto"}
+	content := strings.Repeat("lorem ipsum ", messageBytes/12)
+	for i := range turns {
+		req.Messages = append(req.Messages,
+			ChatMessage{Role: "user", Content: fmt.Sprintf("question %d: %s", i, content)},
+			ChatMessage{Role: "assistant", Content: content})
+	}
+	body, _ := json.Marshal(req)
+	return body
+}
+
+func BenchmarkExtractQuery(b *testing.B) {
+	for _, turns := range []int{1, 20, 200} {
+		body := chatHistory(turns, 2048)
+		b.Run(fmt.Sprintf("gjson/turns=%d", turns), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for range b.N {
+				if _, _, err := ExtractQueryFromOpenAIRequest(body); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("gjson-prevalidated/turns=%d", turns), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for range b.N {
+				if _, _, err := ExtractQueryFromValidRequest(body); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("unmarshal/turns=%d", turns), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for range b.N {
+				if _, _, err := unmarshalQuery(body); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package cache
+
+import (
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// IndexOptions holds options for the approximate nearest neighbor index of the
+// in-memory backend, and of the in-memory index of the Redis backend
+type IndexOptions struct {
+	// Scan every entry on lookups instead of searching the index
+	ExactSearch bool
+	// Neighbors linked per entry and layer, default 16
+	M int
+	// Candidates considered when inserting an entry, default 100
+	EfConstruction int
+	// Candidates considered when searching, default 64; higher finds the most
+	// similar entry more reliably at the cost of latency
+	EfSearch int
+}
+
+// withDefaults returns the options with defaults applied
+func (o IndexOptions) withDefaults() IndexOptions {
+	if o.M <= 0 {
+		o.M = 16
+	}
+	if o.EfConstruction <= 0 {
+		o.EfConstruction = 100
+	}
+	if o.EfSearch <= 0 {
+		o.EfSearch = 64
+	}
+	return o
+}
+
+// hnswNode is an embedding in the graph with its links on each of its layers
+type hnswNode struct {
+	id      string
+	vector  []float32
+	links   [][]int32
+	deleted bool
+}
+
+// hnswGraph is a hierarchical navigable small world graph over embeddings,
+// searched greedily from the sparse top layer down to the dense bottom one,
+// which finds the most similar embedding in logarithmic rather than linear
+// time with high probability.
+//
+// Removed nodes are only marked deleted: they still route searches but are
+// never returned. The graph is rebuilt from the live nodes once deleted ones
+// make up half of it.
+type hnswGraph struct {
+	options  IndexOptions
+	nodes    []*hnswNode
+	byID     map[string]int32
+	entry    int32
+	maxLevel int
+	deleted  int
+	levelMul float64
+	rand     *rand.Rand
+}
+
+func newHNSWGraph(options IndexOptions) *hnswGraph {
+	options = options.withDefaults()
+	return &hnswGraph{
+		options:  options,
+		byID:     make(map[string]int32),
+		entry:    -1,
+		levelMul: 1 / math.Log(float64(options.M)),
+		// Deterministic, so the same inserts always build the same graph
+		rand: rand.New(rand.NewPCG(1, 2)),
+	}
+}
+
+// len returns the number of live nodes
+func (g *hnswGraph) len() int {
+	return len(g.byID)
+}
+
+// maxLinks returns how many links a node keeps on a layer; the bottom layer,
+// holding every node, is twice as dense
+func (g *hnswGraph) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * g.options.M
+	}
+	return g.options.M
+}
+
+// add inserts an embedding, replacing the node of the same ID
+func (g *hnswGraph) add(id string, vector []float32) {
+	g.remove(id)
+	level := int(-math.Log(1-g.rand.Float64()) * g.levelMul)
+	node := int32(len(g.nodes))
+	g.nodes = append(g.nodes, &hnswNode{id: id, vector: vector, links: make([][]int32, level+1)})
+	g.byID[id] = node
+	if g.entry < 0 {
+		g.entry, g.maxLevel = node, level
+		return
+	}
+
+	nearest := []candidate{{node: g.entry, similarity: similarity(vector, g.nodes[g.entry].vector)}}
+	for layer := g.maxLevel; layer > level; layer-- {
+		nearest = g.searchLayer(vector, nearest, 1, layer)
+	}
+	for layer := min(level, g.maxLevel); layer >= 0; layer-- {
+		nearest = g.searchLayer(vector, nearest, g.options.EfConstruction, layer)
+		neighbors := mostSimilar(nearest, g.options.M)
+		for _, neighbor := range neighbors {
+			g.nodes[node].links[layer] = append(g.nodes[node].links[layer], neighbor.node)
+			g.link(neighbor.node, node, layer)
+		}
+	}
+	if level > g.maxLevel {
+		g.entry, g.maxLevel = node, level
+	}
+}
+
+// link adds a link from one node to another on a layer, dropping the link to
+// the least similar node once the node has too many
+func (g *hnswGraph) link(from, to int32, layer int) {
+	n := g.nodes[from]
+	n.links[layer] = append(n.links[layer], to)
+	if len(n.links[layer]) <= g.maxLinks(layer) {
+		return
+	}
+	links := make([]candidate, len(n.links[layer]))
+	for i, other := range n.links[layer] {
+		links[i] = candidate{node: other, similarity: similarity(n.vector, g.nodes[other].vector)}
+	}
+	kept := mostSimilar(links, g.maxLinks(layer))
+	n.links[layer] = n.links[layer][:0]
+	for _, c := range kept {
+		n.links[layer] = append(n.links[layer], c.node)
+	}
+}
+
+// remove marks the node of an ID deleted, rebuilding the graph once half of
+// it is deleted
+func (g *hnswGraph) remove(id string) {
+	node, ok := g.byID[id]
+	if !ok {
+		return
+	}
+	delete(g.byID, id)
+	g.nodes[node].deleted = true
+	g.deleted++
+	if g.deleted > len(g.nodes)/2 {
+		g.rebuild()
+	}
+}
+
+// rebuild builds the graph again from its live nodes
+func (g *hnswGraph) rebuild() {
+	nodes := g.nodes
+	*g = *newHNSWGraph(g.options)
+	for _, n := range nodes {
+		if !n.deleted {
+			g.add(n.id, n.vector)
+		}
+	}
+}
+
+// search returns the ID of the live node most similar to the embedding that
+// accept accepts, searching ef candidates. ok is false when none of them was
+// accepted, although farther nodes may have been.
+func (g *hnswGraph) search(vector []float32, ef int, accept func(id string) bool) (string, float32, bool) {
+	if g.entry < 0 {
+		return "", 0, false
+	}
+	if ef <= 0 {
+		ef = g.options.EfSearch
+	}
+	nearest := []candidate{{node: g.entry, similarity: similarity(vector, g.nodes[g.entry].vector)}}
+	for layer := g.maxLevel; layer > 0; layer-- {
+		nearest = g.searchLayer(vector, nearest, 1, layer)
+	}
+	nearest = g.searchLayer(vector, nearest, ef, 0)
+	sort.Slice(nearest, func(i, j int) bool { return nearest[i].similarity > nearest[j].similarity })
+	for _, c := range nearest {
+		if n := g.nodes[c.node]; !n.deleted && accept(n.id) {
+			return n.id, c.similarity, true
+		}
+	}
+	return "", 0, false
+}
+
+// searchLayer returns the ef nodes of a layer most similar to the embedding
+// found by a best-first walk from the entry nodes
+func (g *hnswGraph) searchLayer(vector []float32, entries []candidate, ef, layer int) []candidate {
+	visited := make(map[int32]bool, 4*ef)
+	// Nodes to expand, most similar first, and the best found, least similar first
+	toVisit := &candidateHeap{mostSimilarFirst: true}
+	found := &candidateHeap{}
+	for _, c := range entries {
+		visited[c.node] = true
+		heap.Push(toVisit, c)
+		heap.Push(found, c)
+		if found.Len() > ef {
+			heap.Pop(found)
+		}
+	}
+	for toVisit.Len() > 0 {
+		c := heap.Pop(toVisit).(candidate)
+		if found.Len() >= ef && c.similarity < found.items[0].similarity {
+			break
+		}
+		for _, neighbor := range g.nodes[c.node].links[layer] {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+			s := similarity(vector, g.nodes[neighbor].vector)
+			if found.Len() < ef || s > found.items[0].similarity {
+				next := candidate{node: neighbor, similarity: s}
+				heap.Push(toVisit, next)
+				heap.Push(found, next)
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+	return found.items
+}
+
+// candidate is a node found by a search with its similarity to the query
+type candidate struct {
+	node       int32
+	similarity float32
+}
+
+// mostSimilar returns the n most similar candidates
+func mostSimilar(candidates []candidate, n int) []candidate {
+	sorted := append([]candidate(nil), candidates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].similarity > sorted[j].similarity })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// candidateHeap is a heap of candidates, the least similar on top unless
+// mostSimilarFirst
+type candidateHeap struct {
+	items            []candidate
+	mostSimilarFirst bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.mostSimilarFirst {
+		return h.items[i].similarity > h.items[j].similarity
+	}
+	return h.items[i].similarity < h.items[j].similarity
+}
+
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *candidateHeap) Push(x any) { h.items = append(h.items, x.(candidate)) }
+
+func (h *candidateHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
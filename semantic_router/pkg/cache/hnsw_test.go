@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// randomEmbeddings returns n random normalized embeddings. Like the
+// embeddings of text, they lie close to a subspace of far fewer dimensions.
+func randomEmbeddings(rng *rand.Rand, n, dims int) [][]float32 {
+	const latentDims = 24
+	projection := make([][]float32, latentDims)
+	for i := range projection {
+		projection[i] = randomEmbedding(rng, dims)
+	}
+	embeddings := make([][]float32, n)
+	for i := range embeddings {
+		v := make([]float32, dims)
+		for _, axis := range projection {
+			weight := float32(rng.NormFloat64())
+			for j := range v {
+				v[j] += weight * axis[j]
+			}
+		}
+		embeddings[i] = perturb(rng, normalize(v), 0.01)
+	}
+	return embeddings
+}
+
+func randomEmbedding(rng *rand.Rand, dims int) []float32 {
+	v := make([]float32, dims)
+	for i := range v {
+		v[i] = float32(rng.NormFloat64())
+	}
+	return normalize(v)
+}
+
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range v {
+		v[i] *= scale
+	}
+	return v
+}
+
+// perturb returns a normalized embedding close to the given one, as the
+// embedding of a rephrased query would be
+func perturb(rng *rand.Rand, v []float32, noise float64) []float32 {
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x + float32(noise*rng.NormFloat64())
+	}
+	return normalize(out)
+}
+
+func exactNearest(embeddings [][]float32, query []float32, skip func(i int) bool) int {
+	best, bestSimilarity := -1, float32(0)
+	for i, e := range embeddings {
+		if skip != nil && skip(i) {
+			continue
+		}
+		if s := similarity(query, e); best < 0 || s > bestSimilarity {
+			best, bestSimilarity = i, s
+		}
+	}
+	return best
+}
+
+func TestHNSWFindsNearest(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 7))
+	embeddings := randomEmbeddings(rng, 3000, 32)
+	graph := newHNSWGraph(IndexOptions{})
+	for i, e := range embeddings {
+		graph.add(fmt.Sprint(i), e)
+	}
+
+	acceptAll := func(string) bool { return true }
+	const queries = 200
+	hits := 0
+	for q := 0; q < queries; q++ {
+		query := perturb(rng, embeddings[rng.IntN(len(embeddings))], 0.05)
+		id, _, ok := graph.search(query, 0, acceptAll)
+		if ok && id == fmt.Sprint(exactNearest(embeddings, query, nil)) {
+			hits++
+		}
+	}
+	if recall := float64(hits) / queries; recall < 0.95 {
+		t.Errorf("recall %.2f, want at least 0.95", recall)
+	}
+
+	// Removed nodes are never returned, including after the graph is rebuilt
+	removed := func(i int) bool { return i%3 != 0 }
+	for i := range embeddings {
+		if removed(i) {
+			graph.remove(fmt.Sprint(i))
+		}
+	}
+	if graph.len() != 1000 || graph.deleted > len(graph.nodes)/2 {
+		t.Fatalf("graph has %d live of %d nodes, %d deleted", graph.len(), len(graph.nodes), graph.deleted)
+	}
+	hits = 0
+	for q := 0; q < queries; q++ {
+		query := randomEmbedding(rng, 32)
+		id, _, ok := graph.search(query, 0, acceptAll)
+		if !ok {
+			t.Fatal("no live node found")
+		}
+		var i int
+		fmt.Sscan(id, &i)
+		if removed(i) {
+			t.Fatalf("removed node %s returned", id)
+		}
+		if i == exactNearest(embeddings, query, removed) {
+			hits++
+		}
+	}
+	if recall := float64(hits) / queries; recall < 0.9 {
+		t.Errorf("recall %.2f after removals, want at least 0.9", recall)
+	}
+}
+
+func TestMemoryBackendIndexSkipsExpiredEntries(t *testing.T) {
+	backend := newMemoryBackend(0, 0, IndexOptions{EfSearch: 1}, EvictionOptions{})
+	now := time.Now()
+	entries := []CacheEntry{
+		{ID: "expired", Model: "phi4", Embedding: []float32{1, 0}, Timestamp: now.Add(-time.Hour), TTL: time.Minute},
+		{ID: "live", Model: "phi4", Embedding: normalize([]float32{1, 1}), Timestamp: now},
+	}
+	for _, entry := range entries {
+		if err := backend.Add(entry); err != nil {
+			t.Fatalf("Add(%s): %v", entry.ID, err)
+		}
+	}
+	// The expired entry is the only candidate the search considers
+	entry, _, err := backend.FindSimilar("phi4", "", []float32{1, 0})
+	if err != nil || entry == nil || entry.ID != "live" {
+		t.Errorf("expected the live entry, got %+v (err=%v)", entry, err)
+	}
+}
+
+// BenchmarkMemoryBackendFindSimilar compares lookups searching the index with
+// scanning every entry, for embeddings of 384 dimensions like the default
+// embedding model's. Building the larger backends takes a while.
+func BenchmarkMemoryBackendFindSimilar(b *testing.B) {
+	const dims = 384
+	for _, entries := range []int{1000, 10000, 50000} {
+		rng := rand.New(rand.NewPCG(1, uint64(entries)))
+		embeddings := randomEmbeddings(rng, entries, dims)
+		queries := make([][]float32, 100)
+		for i := range queries {
+			queries[i] = perturb(rng, embeddings[rng.IntN(entries)], 0.02)
+		}
+		for _, mode := range []struct {
+			name    string
+			options IndexOptions
+		}{
+			{"exact", IndexOptions{ExactSearch: true}},
+			{"hnsw", IndexOptions{}},
+		} {
+			// Built once, as b.Run calls the benchmark several times
+			var backend *memoryBackend
+			b.Run(fmt.Sprintf("%s/entries=%d", mode.name, entries), func(b *testing.B) {
+				if backend == nil {
+					backend = newMemoryBackend(0, 0, mode.options, EvictionOptions{})
+					now := time.Now()
+					for i, e := range embeddings {
+						backend.Add(CacheEntry{ID: fmt.Sprint(i), Model: "phi4", Embedding: e, Timestamp: now})
+					}
+					b.ResetTimer()
+				}
+				for i := range b.N {
+					if entry, _, _ := backend.FindSimilar("phi4", "", queries[i%len(queries)]); entry == nil {
+						b.Fatal("no entry found")
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// NormalizationOptions holds options for normalizing queries before they are
+// embedded for the cache
+type NormalizationOptions struct {
+	// Lowercase queries
+	Lowercase bool
+	// Expand contractions, e.g. "what's" into "what is"; matched
+	// case-insensitively
+	ExpandContractions bool
+	// Separate punctuation and symbols from words and collapse whitespace, so
+	// "2+2" and "2 + 2" are the same
+	CollapseWhitespace bool
+	// Remove punctuation, keeping symbols such as + and =
+	StripPunctuation bool
+	// Remove stopwords, matched case-insensitively
+	RemoveStopwords bool
+	// Stopwords removed, a short list of English ones when empty
+	Stopwords []string
+	// Patterns replaced by a placeholder, e.g. the names or numbers filled
+	// into a prompt template
+	Masks []MaskOptions
+}
+
+// MaskOptions holds a pattern masked in queries
+type MaskOptions struct {
+	// Name of the masked variable; the placeholder is __name__
+	Name string
+	// Regular expression; the built-in one of number, email, url or uuid
+	// when empty
+	Regex string
+}
+
+// builtinMasks are the patterns of the masks of the built-in names
+var builtinMasks = map[string]string{
+	"number": `\b\d+(?:[.,]\d+)*\b`,
+	"email":  `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`,
+	"url":    `\bhttps?://[^\s]+`,
+	"uuid":   `\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`,
+}
+
+// defaultStopwords are removed when no stopwords are configured
+var defaultStopwords = []string{
+	"a", "an", "the", "is", "are", "was", "were", "be", "been", "am",
+	"of", "to", "in", "on", "at", "for", "with", "by", "and", "or",
+	"do", "does", "did", "can", "could", "would", "will", "should",
+	"please", "me", "i", "you", "my", "your", "it", "this", "that",
+}
+
+// contractions expands contracted words, checked before the suffixes
+var contractions = map[string]string{
+	"can't": "cannot", "won't": "will not", "shan't": "shall not", "let's": "let us",
+	"what's": "what is", "that's": "that is", "it's": "it is", "there's": "there is",
+	"here's": "here is", "who's": "who is", "where's": "where is", "how's": "how is",
+	"he's": "he is", "she's": "she is", "when's": "when is", "why's": "why is",
+}
+
+// contractionSuffixes expands the contracted suffixes of other words; 's is
+// left alone, as it is usually possessive
+var contractionSuffixes = []struct{ suffix, expansion string }{
+	{"n't", " not"}, {"'re", " are"}, {"'ve", " have"}, {"'ll", " will"}, {"'d", " would"}, {"'m", " am"},
+}
+
+// compiledMask is a mask with its pattern compiled
+type compiledMask struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}
+
+// Normalizer rewrites queries so trivially different phrasings embed the
+// same. A nil Normalizer leaves queries unchanged.
+type Normalizer struct {
+	options   NormalizationOptions
+	masks     []compiledMask
+	stopwords map[string]bool
+}
+
+// NewNormalizer creates a normalizer with the given options
+func NewNormalizer(options NormalizationOptions) (*Normalizer, error) {
+	n := &Normalizer{options: options}
+	for i, mask := range options.Masks {
+		if mask.Name == "" {
+			return nil, fmt.Errorf("mask %d has no name", i)
+		}
+		expr := mask.Regex
+		if expr == "" {
+			var ok bool
+			if expr, ok = builtinMasks[mask.Name]; !ok {
+				return nil, fmt.Errorf("mask %s has no regex and no built-in one", mask.Name)
+			}
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("mask %s: %w", mask.Name, err)
+		}
+		n.masks = append(n.masks, compiledMask{pattern: pattern, placeholder: "__" + mask.Name + "__"})
+	}
+	if options.RemoveStopwords {
+		stopwords := options.Stopwords
+		if len(stopwords) == 0 {
+			stopwords = defaultStopwords
+		}
+		n.stopwords = make(map[string]bool, len(stopwords))
+		for _, word := range stopwords {
+			n.stopwords[strings.ToLower(word)] = true
+		}
+	}
+	return n, nil
+}
+
+// Normalize returns the normalized form of a query. Masks apply to the query
+// as sent, before the other steps.
+func (n *Normalizer) Normalize(query string) string {
+	if n == nil {
+		return query
+	}
+	for _, mask := range n.masks {
+		query = mask.pattern.ReplaceAllString(query, mask.placeholder)
+	}
+	if n.options.Lowercase {
+		query = strings.ToLower(query)
+	}
+	if n.options.ExpandContractions {
+		query = expandContractions(query)
+	}
+	if !n.options.CollapseWhitespace && !n.options.StripPunctuation && n.stopwords == nil {
+		return query
+	}
+
+	var tokens []string
+	if n.options.CollapseWhitespace {
+		tokens = tokenize(query)
+	} else {
+		tokens = strings.Fields(query)
+	}
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if n.options.StripPunctuation {
+			token = strings.TrimFunc(token, isStripped)
+			if token == "" {
+				continue
+			}
+		}
+		if n.stopwords[strings.ToLower(token)] {
+			continue
+		}
+		kept = append(kept, token)
+	}
+	return strings.Join(kept, " ")
+}
+
+// isWordRune reports whether a rune belongs to a word, which underscores do
+// so that mask placeholders stay whole
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_' || r == '\'' || r == '’'
+}
+
+// isStripped reports whether a rune is punctuation removed from tokens, other
+// than the underscores of placeholders
+func isStripped(r rune) bool {
+	return unicode.IsPunct(r) && r != '_'
+}
+
+// tokenize splits a query into words and single punctuation or symbol runes
+func tokenize(query string) []string {
+	var tokens []string
+	start := -1
+	for i, r := range query {
+		switch {
+		case isWordRune(r):
+			if start < 0 {
+				start = i
+			}
+			continue
+		case start >= 0:
+			tokens = append(tokens, query[start:i])
+			start = -1
+		}
+		if !unicode.IsSpace(r) {
+			tokens = append(tokens, string(r))
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, query[start:])
+	}
+	return tokens
+}
+
+// expandContractions expands the contracted words of a query, which are
+// lowercased; other words are kept as they are
+func expandContractions(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		lower := strings.ToLower(strings.ReplaceAll(word, "’", "'"))
+		trimmed := strings.TrimRightFunc(lower, func(r rune) bool { return unicode.IsPunct(r) && r != '\'' })
+		trailing := lower[len(trimmed):]
+		if expansion, ok := contractions[trimmed]; ok {
+			words[i] = expansion + trailing
+			continue
+		}
+		for _, c := range contractionSuffixes {
+			if strings.HasSuffix(trimmed, c.suffix) && len(trimmed) > len(c.suffix) {
+				words[i] = trimmed[:len(trimmed)-len(c.suffix)] + c.expansion + trailing
+				break
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestNormalize(t *testing.T) {
+	all := NormalizationOptions{Lowercase: true, ExpandContractions: true, CollapseWhitespace: true, StripPunctuation: true}
+	for _, tc := range []struct {
+		name    string
+		options NormalizationOptions
+		query   string
+		want    string
+	}{
+		{"none", NormalizationOptions{}, "What's  2+2?", "What's  2+2?"},
+		{"all", all, "What's 2+2?", "what is 2 + 2"},
+		{"already normal", all, "what is 2 + 2", "what is 2 + 2"},
+		{"whitespace only", NormalizationOptions{CollapseWhitespace: true}, " Hello,\n world ", "Hello , world"},
+		{"suffix contractions", NormalizationOptions{ExpandContractions: true}, "They're sure we DON'T know", "they are sure we do not know"},
+		{"curly apostrophe", all, "It’s late", "it is late"},
+		{"possessive kept", all, "John's book", "john's book"},
+		{"stopwords", NormalizationOptions{Lowercase: true, RemoveStopwords: true}, "What is the capital of France", "what capital france"},
+		{"custom stopwords", NormalizationOptions{RemoveStopwords: true, Stopwords: []string{"Please"}}, "please help me", "help me"},
+		{"masks", NormalizationOptions{Lowercase: true, StripPunctuation: true, CollapseWhitespace: true, Masks: []MaskOptions{{Name: "email"}, {Name: "ticket", Regex: `TCK-\d+`}}},
+			"Email bob@example.com about TCK-42.", "email __email__ about __ticket__"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			normalizer, err := NewNormalizer(tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := normalizer.Normalize(tc.query); got != tc.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tc.query, got, tc.want)
+			}
+		})
+	}
+
+	var normalizer *Normalizer
+	if got := normalizer.Normalize("What's up?"); got != "What's up?" {
+		t.Errorf("nil normalizer changed the query to %q", got)
+	}
+	for _, masks := range [][]MaskOptions{{{Regex: "x"}}, {{Name: "unknown"}}, {{Name: "bad", Regex: "("}}} {
+		if _, err := NewNormalizer(NormalizationOptions{Masks: masks}); err == nil {
+			t.Errorf("NewNormalizer accepted masks %+v", masks)
+		}
+	}
+}
+
+func TestCacheNormalizesQueries(t *testing.T) {
+	normalizer, err := NewNormalizer(NormalizationOptions{Lowercase: true, ExpandContractions: true, CollapseWhitespace: true, StripPunctuation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		// Only the normalized query embeds like the cached one
+		EmbedFunc: func(text string) ([]float32, error) {
+			if text == "what is 2 + 2" {
+				return []float32{1, 0}, nil
+			}
+			return []float32{0, 1}, nil
+		},
+		Normalizer: normalizer,
+		CompareRaw: true,
+	})
+	const model = "normalization-model"
+	if err := c.AddEntry(model, "What is 2 + 2", []byte(`{}`), []byte(`{"answer":4}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+
+	comparisons := metrics.CacheNormalizationComparisons.WithLabelValues("hit", "miss")
+	before := testutil.ToFloat64(comparisons)
+	response, found, err := c.FindSimilar(model, "What's 2+2?")
+	if err != nil || !found || string(response) != `{"answer":4}` {
+		t.Errorf("FindSimilar = %s, %v, %v, want the cached answer", response, found, err)
+	}
+	if got := testutil.ToFloat64(comparisons) - before; got != 1 {
+		t.Errorf("comparisons where only the normalized query hit = %v, want 1", got)
+	}
+}
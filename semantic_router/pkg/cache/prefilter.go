@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PrefilterOptions holds options for the lookup pre-filter
+type PrefilterOptions struct {
+	Enabled bool
+	// Fraction of a query's words that must occur in cached queries of the
+	// same model for the lookup to run, default 0.3
+	MinOverlap float64
+	// Entries tracked per generation of the filter, default 10000
+	Capacity int
+	// Probability of a word wrongly looking known, default 0.01
+	FalsePositiveRate float64
+}
+
+// prefilter predicts, without computing an embedding, that a query has no
+// similar cached entry: similar queries share words, so a query whose words
+// mostly never occurred in a cached query of the model is a certain miss.
+//
+// Words are tracked in Bloom filters, which can't forget evicted entries.
+// The filter is rotated once a generation tracked Capacity entries and
+// checks the current and previous generation, so entries cached more than
+// two generations ago are forgotten and may no longer be hit.
+type prefilter struct {
+	mu         sync.RWMutex
+	current    *bloomFilter
+	previous   *bloomFilter
+	added      int
+	capacity   int
+	words      int
+	minOverlap float64
+	rate       float64
+}
+
+func newPrefilter(options PrefilterOptions) *prefilter {
+	if options.MinOverlap <= 0 {
+		options.MinOverlap = 0.3
+	}
+	if options.Capacity <= 0 {
+		options.Capacity = 10000
+	}
+	if options.FalsePositiveRate <= 0 || options.FalsePositiveRate >= 1 {
+		options.FalsePositiveRate = 0.01
+	}
+	// A query has a few dozen distinct words at most
+	const wordsPerEntry = 32
+	words := options.Capacity * wordsPerEntry
+	return &prefilter{
+		current:    newBloomFilter(words, options.FalsePositiveRate),
+		capacity:   options.Capacity,
+		words:      words,
+		minOverlap: options.MinOverlap,
+		rate:       options.FalsePositiveRate,
+	}
+}
+
+// add records the words of a cached query
+func (p *prefilter) add(model, epoch, query string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.added >= p.capacity {
+		p.previous = p.current
+		p.current = newBloomFilter(p.words, p.rate)
+		p.added = 0
+	}
+	for _, word := range queryWords(query) {
+		p.current.add(prefilterKey(model, epoch, word))
+	}
+	p.added++
+}
+
+// reset forgets every cached query, e.g. once the cache was flushed
+func (p *prefilter) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = newBloomFilter(p.words, p.rate)
+	p.previous = nil
+	p.added = 0
+}
+
+// mayHaveSimilar reports whether a cached query of the model may be similar
+// to the query, false meaning certainly none is
+func (p *prefilter) mayHaveSimilar(model, epoch, query string) bool {
+	words := queryWords(query)
+	if len(words) == 0 {
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	known := 0
+	for _, word := range words {
+		key := prefilterKey(model, epoch, word)
+		if p.current.contains(key) || (p.previous != nil && p.previous.contains(key)) {
+			known++
+		}
+	}
+	return float64(known) >= p.minOverlap*float64(len(words))
+}
+
+func prefilterKey(model, epoch, word string) string {
+	return model + "\x00" + epoch + "\x00" + word
+}
+
+// queryWords returns the distinct lowercase words of a query
+func queryWords(query string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(fields))
+	words := fields[:0]
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+// bloomFilter is a Bloom filter over strings
+type bloomFilter struct {
+	bits   []uint64
+	hashes int
+}
+
+// newBloomFilter sizes a filter for n items at the given false positive rate
+func newBloomFilter(n int, rate float64) *bloomFilter {
+	bitsPerItem := int(math.Ceil(-math.Log(rate) / (math.Ln2 * math.Ln2)))
+	words := (n*bitsPerItem + 63) / 64
+	return &bloomFilter{
+		bits:   make([]uint64, words),
+		hashes: max(1, int(math.Round(float64(bitsPerItem)*math.Ln2))),
+	}
+}
+
+// positions derives the filter's bit positions of a key by double hashing
+func (f *bloomFilter) positions(key string, visit func(bit uint64) bool) bool {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	size := uint64(len(f.bits)) * 64
+	for i := 0; i < f.hashes; i++ {
+		if !visit((h1 + uint64(i)*h2) % size) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) add(key string) {
+	f.positions(key, func(bit uint64) bool {
+		f.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+func (f *bloomFilter) contains(key string) bool {
+	return f.positions(key, func(bit uint64) bool {
+		return f.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilterHasNoFalseNegatives(t *testing.T) {
+	f := newBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.add(fmt.Sprintf("word%d", i))
+	}
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if !f.contains(fmt.Sprintf("word%d", i)) {
+			t.Fatalf("word%d added but not contained", i)
+		}
+		if f.contains(fmt.Sprintf("other%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("%d false positives out of 1000, expected about 10", falsePositives)
+	}
+}
+
+func TestPrefilter(t *testing.T) {
+	p := newPrefilter(PrefilterOptions{Enabled: true, MinOverlap: 0.5})
+	p.add("phi4", "v1", "What is the derivative of x squared?")
+
+	tests := []struct {
+		name  string
+		model string
+		epoch string
+		query string
+		want  bool
+	}{
+		{"same query", "phi4", "v1", "What is the derivative of x squared?", true},
+		{"reworded query", "phi4", "v1", "what's the derivative of x^2", true},
+		{"unrelated query", "phi4", "v1", "Who won the 1998 world cup final?", false},
+		{"other model", "llama", "v1", "What is the derivative of x squared?", false},
+		{"other epoch", "phi4", "v2", "What is the derivative of x squared?", false},
+		{"no words", "phi4", "v1", "?!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.mayHaveSimilar(tt.model, tt.epoch, tt.query); got != tt.want {
+				t.Errorf("mayHaveSimilar(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefilterRotation(t *testing.T) {
+	p := newPrefilter(PrefilterOptions{Enabled: true, Capacity: 2})
+	p.add("phi4", "", "alpha beta")
+	p.add("phi4", "", "gamma delta")
+	p.add("phi4", "", "epsilon zeta")
+	if !p.mayHaveSimilar("phi4", "", "alpha beta") {
+		t.Error("entries of the previous generation should be known")
+	}
+	p.add("phi4", "", "eta theta")
+	p.add("phi4", "", "iota kappa")
+	if p.mayHaveSimilar("phi4", "", "alpha beta") {
+		t.Error("entries two generations old should be forgotten")
+	}
+	if !p.mayHaveSimilar("phi4", "", "iota kappa") {
+		t.Error("entries of the current generation should be known")
+	}
+}
+
+func TestCacheSkipsPrefilteredLookups(t *testing.T) {
+	embeddings := 0
+	c := NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		Enabled:             true,
+		EmbedFunc: func(text string) ([]float32, error) {
+			embeddings++
+			return constantEmbedding(text)
+		},
+		Prefilter: PrefilterOptions{Enabled: true},
+	})
+	if err := c.AddEntry("phi4", "what is the derivative of x squared", []byte(`{}`), []byte(`{}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+
+	embeddings = 0
+	if _, found, err := c.FindSimilar("phi4", "who won the world cup"); found || err != nil {
+		t.Fatalf("expected a miss, got found=%v err=%v", found, err)
+	}
+	if embeddings != 0 {
+		t.Errorf("expected the lookup to be skipped, computed %d embeddings", embeddings)
+	}
+
+	if _, found, _ := c.FindSimilar("phi4", "what is the derivative of x squared"); !found {
+		t.Error("expected a hit for a cached query")
+	}
+	if embeddings != 1 {
+		t.Errorf("expected one embedding for the lookup, computed %d", embeddings)
+	}
+}
@@ -0,0 +1,606 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisOptions holds options for creating a new Redis backend
+type RedisOptions struct {
+	// Address of the Redis server, host:port
+	Address  string
+	Password string
+	DB       int
+	// Prefix of every key the backend writes, defaults to "semantic-cache:"
+	KeyPrefix string
+	// Maximum number of entries to keep across all models and epochs, 0 for no limit
+	MaxEntries int
+	// Time-to-live of entries, 0 for no expiration
+	TTL time.Duration
+	// Timeout of a single cache operation, defaults to 1s
+	Timeout time.Duration
+	// Options of the in-memory index lookups search; ExactSearch is ignored
+	Index IndexOptions
+}
+
+// redisLogLength is roughly how many changes the log of a Redis backend keeps;
+// replicas that fall further behind reload their index
+const redisLogLength = 10000
+
+// redisLookupAttempts is how many of the most similar entries a lookup reads
+// before giving up when they turn out to be gone
+const redisLookupAttempts = 3
+
+// redisSweepInterval is how often expired entries are dropped from the index
+const redisSweepInterval = time.Minute
+
+// RedisBackend stores cache entries in Redis, so they are shared by every
+// replica of the router and survive restarts.
+//
+// Each entry is a hash at <prefix>entry:<id> holding its fields, with the
+// embedding as little-endian float32s. The IDs of the entries of a model and
+// epoch are in the set <prefix>index:<epoch>:<model>, and all IDs are in the
+// sorted set <prefix>entries scored by creation time, which enforces the max
+// entries. Entries with their own TTL expire after it; indexes expire with
+// their longest-lived entry, which needs Redis 7.
+//
+// Lookups search an in-memory index of the embeddings, so only the most
+// similar entry is read from Redis. A model and epoch is loaded from its index
+// set on its first lookup and then kept up to date from the stream
+// <prefix>log, to which every addition and eviction is appended, so entries
+// stored or evicted by other replicas are seen on their next lookup. Entries
+// that expired or are otherwise missing are dropped when a lookup finds them.
+type RedisBackend struct {
+	client  *redis.Client
+	options RedisOptions
+
+	mu sync.RWMutex
+	// Graphs of the embeddings of the loaded models and epochs, by partitionKey
+	graphs map[string]*hnswGraph
+	// Entries in the graphs, by ID
+	mirrored map[string]mirroredEntry
+	// ID of the last change read from the log, empty before the first lookup
+	logID string
+	swept time.Time
+}
+
+// mirroredEntry is an entry in the in-memory index of a Redis backend
+type mirroredEntry struct {
+	partition string
+	// Zero for entries that don't expire
+	expires time.Time
+}
+
+// NewRedisBackend creates a new Redis backend; it connects lazily, on first use
+func NewRedisBackend(options RedisOptions) *RedisBackend {
+	if options.KeyPrefix == "" {
+		options.KeyPrefix = "semantic-cache:"
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+	return &RedisBackend{
+		client: redis.NewClient(&redis.Options{
+			Addr:     options.Address,
+			Password: options.Password,
+			DB:       options.DB,
+		}),
+		options:  options,
+		graphs:   make(map[string]*hnswGraph),
+		mirrored: make(map[string]mirroredEntry),
+	}
+}
+
+// Ping checks that the Redis server is reachable
+func (b *RedisBackend) Ping() error {
+	ctx, cancel := b.context()
+	defer cancel()
+	return b.client.Ping(ctx).Err()
+}
+
+// Close closes the connections to the Redis server
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
+
+func (b *RedisBackend) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), b.options.Timeout)
+}
+
+func (b *RedisBackend) entryKey(id string) string {
+	return b.options.KeyPrefix + "entry:" + id
+}
+
+func (b *RedisBackend) indexKey(model, epoch string) string {
+	return b.options.KeyPrefix + "index:" + epoch + ":" + model
+}
+
+func (b *RedisBackend) entriesKey() string {
+	return b.options.KeyPrefix + "entries"
+}
+
+func (b *RedisBackend) logKey() string {
+	return b.options.KeyPrefix + "log"
+}
+
+// logChange appends a change to the log, trimming it to about redisLogLength
+func (b *RedisBackend) logChange(ctx context.Context, pipe redis.Pipeliner, values ...interface{}) {
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.logKey(),
+		MaxLen: redisLogLength,
+		Approx: true,
+		Values: values,
+	})
+}
+
+// expiry returns when an entry created at the timestamp expires, zero if never
+func (b *RedisBackend) expiry(timestamp time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = b.options.TTL
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return timestamp.Add(ttl)
+}
+
+// Get returns the entry with the given ID, or nil if there is none
+func (b *RedisBackend) Get(id string) (*CacheEntry, error) {
+	ctx, cancel := b.context()
+	defer cancel()
+	fields, err := b.client.HGetAll(ctx, b.entryKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry %s: %w", id, err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return decodeRedisEntry(id, fields)
+}
+
+// Add stores an entry, replacing any entry with the same ID
+func (b *RedisBackend) Add(entry CacheEntry) error {
+	ctx, cancel := b.context()
+	defer cancel()
+
+	key := b.entryKey(entry.ID)
+	index := b.indexKey(entry.Model, entry.Epoch)
+	ttl := b.options.TTL
+	if entry.TTL > 0 {
+		ttl = entry.TTL
+	}
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key,
+			"epoch", entry.Epoch,
+			"model", entry.Model,
+			"query", entry.Query,
+			"request", entry.RequestBody,
+			"response", entry.ResponseBody,
+			"embedding", encodeEmbedding(entry.Embedding),
+			"timestamp", strconv.FormatInt(entry.Timestamp.UnixNano(), 10),
+			"ttl", strconv.FormatInt(int64(entry.TTL), 10),
+		)
+		pipe.SAdd(ctx, index, entry.ID)
+		pipe.ZAdd(ctx, b.entriesKey(), redis.Z{Score: float64(entry.Timestamp.UnixNano()), Member: entry.ID})
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+			// Indexes expire with their longest-lived entry
+			pipe.ExpireNX(ctx, index, ttl)
+			pipe.ExpireGT(ctx, index, ttl)
+		}
+		if b.options.TTL > 0 {
+			// Entries kept longer by their own TTL stop counting towards the max entries
+			pipe.ZRemRangeByScore(ctx, b.entriesKey(), "-inf",
+				strconv.FormatInt(time.Now().Add(-b.options.TTL).UnixNano(), 10))
+		}
+		b.logChange(ctx, pipe, "op", "add", "id", entry.ID, "model", entry.Model, "epoch", entry.Epoch)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store cache entry %s: %w", entry.ID, err)
+	}
+
+	partition := partitionKey(entry.Model, entry.Epoch)
+	b.mu.Lock()
+	if b.graphs[partition] != nil {
+		b.mirror(partition, entry.ID, entry.Embedding, b.expiry(entry.Timestamp, entry.TTL))
+	}
+	b.mu.Unlock()
+
+	return b.trim(ctx)
+}
+
+// trim evicts the oldest entries beyond the max entries
+func (b *RedisBackend) trim(ctx context.Context) error {
+	if b.options.MaxEntries <= 0 {
+		return nil
+	}
+	count, err := b.client.ZCard(ctx, b.entriesKey()).Result()
+	if err != nil {
+		return fmt.Errorf("failed to count cache entries: %w", err)
+	}
+	excess := count - int64(b.options.MaxEntries)
+	if excess <= 0 {
+		return nil
+	}
+	oldest, err := b.client.ZRange(ctx, b.entriesKey(), 0, excess-1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list cache entries: %w", err)
+	}
+	if err := b.remove(ctx, oldest); err != nil {
+		return fmt.Errorf("failed to trim cache entries: %w", err)
+	}
+	log.Printf("Trimmed cache to %d entries", b.options.MaxEntries)
+	return nil
+}
+
+// remove deletes entries along with their index memberships and logs their
+// eviction
+func (b *RedisBackend) remove(ctx context.Context, ids []string) error {
+	partitions := make([]*redis.SliceCmd, len(ids))
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			partitions[i] = pipe.HMGet(ctx, b.entryKey(id), "model", "epoch")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			pipe.Del(ctx, b.entryKey(id))
+			pipe.ZRem(ctx, b.entriesKey(), id)
+			values := partitions[i].Val()
+			model, hasModel := values[0].(string)
+			epoch, hasEpoch := values[1].(string)
+			if hasModel && hasEpoch {
+				pipe.SRem(ctx, b.indexKey(model, epoch), id)
+			}
+			b.logChange(ctx, pipe, "op", "evict", "id", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	for _, id := range ids {
+		b.forget(id)
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// FindSimilar searches the in-memory index of the model and epoch for the
+// entry most similar to the given one, reading only that entry from Redis
+func (b *RedisBackend) FindSimilar(model, epoch string, embedding []float32) (*CacheEntry, float32, error) {
+	ctx, cancel := b.context()
+	defer cancel()
+
+	if err := b.sync(ctx); err != nil {
+		return nil, 0, err
+	}
+	key := partitionKey(model, epoch)
+	b.mu.RLock()
+	loaded := b.graphs[key] != nil
+	b.mu.RUnlock()
+	if !loaded {
+		if err := b.load(ctx, model, epoch); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for attempt := 0; attempt < redisLookupAttempts; attempt++ {
+		id, bestSimilarity, ok := b.search(key, embedding)
+		if !ok {
+			return nil, 0, nil
+		}
+		fields, err := b.client.HGetAll(ctx, b.entryKey(id)).Result()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read cache entry %s: %w", id, err)
+		}
+		if len(fields) == 0 {
+			// Expired, or evicted before the change reached us
+			b.mu.Lock()
+			b.forget(id)
+			b.mu.Unlock()
+			if err := b.client.SRem(ctx, b.indexKey(model, epoch), id).Err(); err != nil {
+				log.Printf("Error removing expired entry %s from cache index: %v", id, err)
+			}
+			continue
+		}
+		entry, err := decodeRedisEntry(id, fields)
+		if err != nil {
+			return nil, 0, err
+		}
+		return entry, bestSimilarity, nil
+	}
+	return nil, 0, nil
+}
+
+// search returns the unexpired entry of a loaded partition most similar to
+// the embedding
+func (b *RedisBackend) search(partition string, embedding []float32) (string, float32, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	graph := b.graphs[partition]
+	if graph == nil {
+		return "", 0, false
+	}
+	now := time.Now()
+	return graph.search(embedding, 0, func(id string) bool {
+		expires := b.mirrored[id].expires
+		return expires.IsZero() || now.Before(expires)
+	})
+}
+
+// load reads the embeddings of a model and epoch from its index set into the
+// in-memory index
+func (b *RedisBackend) load(ctx context.Context, model, epoch string) error {
+	index := b.indexKey(model, epoch)
+	ids, err := b.client.SMembers(ctx, index).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read cache index: %w", err)
+	}
+	cmds := make([]*redis.SliceCmd, len(ids))
+	if len(ids) > 0 {
+		_, err = b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, id := range ids {
+				cmds[i] = pipe.HMGet(ctx, b.entryKey(id), "embedding", "timestamp", "ttl")
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read cache embeddings: %w", err)
+		}
+	}
+
+	key := partitionKey(model, epoch)
+	var expired []interface{}
+	b.mu.Lock()
+	if b.graphs[key] == nil {
+		b.graphs[key] = newHNSWGraph(b.options.Index)
+		for i, cmd := range cmds {
+			embedding, expires, ok := b.parseMirrored(cmd.Val())
+			if !ok {
+				expired = append(expired, ids[i])
+				continue
+			}
+			b.mirror(key, ids[i], embedding, expires)
+		}
+	}
+	b.mu.Unlock()
+
+	if len(expired) > 0 {
+		if err := b.client.SRem(ctx, index, expired...).Err(); err != nil {
+			log.Printf("Error removing %d expired entries from cache index: %v", len(expired), err)
+		}
+	}
+	return nil
+}
+
+// sync applies the changes appended to the log since the last sync to the
+// in-memory index, reading the embeddings of entries added to loaded
+// partitions. When the log was trimmed past the last change read, every
+// partition is dropped to be loaded again.
+func (b *RedisBackend) sync(ctx context.Context) error {
+	b.mu.RLock()
+	after := b.logID
+	b.mu.RUnlock()
+
+	if after == "" {
+		// Nothing is loaded yet, so only changes from now on matter
+		last, err := b.client.XRevRangeN(ctx, b.logKey(), "+", "-", 1).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read cache log: %w", err)
+		}
+		b.mu.Lock()
+		if b.logID == "" {
+			b.logID = "0-0"
+			if len(last) > 0 {
+				b.logID = last[0].ID
+			}
+		}
+		b.mu.Unlock()
+		return nil
+	}
+
+	var first, changes *redis.XMessageSliceCmd
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		first = pipe.XRangeN(ctx, b.logKey(), "-", "+", 1)
+		changes = pipe.XRange(ctx, b.logKey(), "("+after, "+")
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read cache log: %w", err)
+	}
+	messages := changes.Val()
+	if len(messages) == 0 {
+		b.sweep()
+		return nil
+	}
+
+	type addition struct{ id, partition string }
+	var added []addition
+	b.mu.Lock()
+	if b.logID != after {
+		// Another lookup synced meanwhile
+		b.mu.Unlock()
+		return nil
+	}
+	b.logID = messages[len(messages)-1].ID
+	if oldest := first.Val(); len(oldest) > 0 && streamIDLess(after, oldest[0].ID) {
+		log.Printf("Cache log was trimmed past the last change read, reloading the cache index")
+		clear(b.graphs)
+		clear(b.mirrored)
+		b.mu.Unlock()
+		return nil
+	}
+	for _, message := range messages {
+		id, _ := message.Values["id"].(string)
+		switch message.Values["op"] {
+		case "add":
+			model, _ := message.Values["model"].(string)
+			epoch, _ := message.Values["epoch"].(string)
+			key := partitionKey(model, epoch)
+			if _, known := b.mirrored[id]; !known && b.graphs[key] != nil {
+				added = append(added, addition{id, key})
+			}
+		case "evict":
+			b.forget(id)
+		}
+	}
+	b.mu.Unlock()
+	b.sweep()
+	if len(added) == 0 {
+		return nil
+	}
+
+	cmds := make([]*redis.SliceCmd, len(added))
+	_, err = b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, a := range added {
+			cmds[i] = pipe.HMGet(ctx, b.entryKey(a.id), "embedding", "timestamp", "ttl")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read cache embeddings: %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, a := range added {
+		// Entries evicted since they were added are gone
+		if embedding, expires, ok := b.parseMirrored(cmds[i].Val()); ok && b.graphs[a.partition] != nil {
+			b.mirror(a.partition, a.id, embedding, expires)
+		}
+	}
+	return nil
+}
+
+// sweep drops expired entries from the in-memory index every
+// redisSweepInterval
+func (b *RedisBackend) sweep() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if now.Sub(b.swept) < redisSweepInterval {
+		return
+	}
+	b.swept = now
+	for id, entry := range b.mirrored {
+		if !entry.expires.IsZero() && !now.Before(entry.expires) {
+			b.forget(id)
+		}
+	}
+}
+
+// mirror adds an entry to the graph of a loaded partition, assuming the lock
+// is held
+func (b *RedisBackend) mirror(partition, id string, embedding []float32, expires time.Time) {
+	if previous, ok := b.mirrored[id]; ok && previous.partition != partition {
+		b.forget(id)
+	}
+	b.graphs[partition].add(id, embedding)
+	b.mirrored[id] = mirroredEntry{partition: partition, expires: expires}
+}
+
+// forget drops an entry from the in-memory index, assuming the lock is held
+func (b *RedisBackend) forget(id string) {
+	entry, ok := b.mirrored[id]
+	if !ok {
+		return
+	}
+	if graph := b.graphs[entry.partition]; graph != nil {
+		graph.remove(id)
+	}
+	delete(b.mirrored, id)
+}
+
+// parseMirrored parses the embedding, timestamp and TTL of an entry read with
+// HMGET, returning false if the entry is gone
+func (b *RedisBackend) parseMirrored(values []interface{}) ([]float32, time.Time, bool) {
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	timestamp, _ := values[1].(string)
+	nanos, _ := strconv.ParseInt(timestamp, 10, 64)
+	ttl, _ := values[2].(string)
+	duration, _ := strconv.ParseInt(ttl, 10, 64)
+	return decodeEmbedding([]byte(data)), b.expiry(time.Unix(0, nanos), time.Duration(duration)), true
+}
+
+// Evict removes the entry with the given ID
+func (b *RedisBackend) Evict(id string) error {
+	ctx, cancel := b.context()
+	defer cancel()
+	if err := b.remove(ctx, []string{id}); err != nil {
+		return fmt.Errorf("failed to evict cache entry %s: %w", id, err)
+	}
+	return nil
+}
+
+// streamIDLess reports whether the stream ID a, <ms>-<seq>, is before b
+func streamIDLess(a, b string) bool {
+	aMillis, aSeq := splitStreamID(a)
+	bMillis, bSeq := splitStreamID(b)
+	return aMillis < bMillis || aMillis == bMillis && aSeq < bSeq
+}
+
+func splitStreamID(id string) (uint64, uint64) {
+	millis, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(millis, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
+
+// decodeRedisEntry rebuilds an entry from the fields of its hash
+func decodeRedisEntry(id string, fields map[string]string) (*CacheEntry, error) {
+	nanos, err := strconv.ParseInt(fields["timestamp"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp of cache entry %s: %w", id, err)
+	}
+	// Entries written before TTLs were stored have none of their own
+	ttl, _ := strconv.ParseInt(fields["ttl"], 10, 64)
+	return &CacheEntry{
+		ID:           id,
+		Epoch:        fields["epoch"],
+		RequestBody:  []byte(fields["request"]),
+		ResponseBody: []byte(fields["response"]),
+		Model:        fields["model"],
+		Query:        fields["query"],
+		Embedding:    decodeEmbedding([]byte(fields["embedding"])),
+		Timestamp:    time.Unix(0, nanos),
+		TTL:          time.Duration(ttl),
+	}, nil
+}
+
+// encodeEmbedding encodes an embedding as little-endian float32s
+func encodeEmbedding(embedding []float32) []byte {
+	data := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+// decodeEmbedding decodes an embedding encoded by encodeEmbedding
+func decodeEmbedding(data []byte) []float32 {
+	embedding := make([]float32, len(data)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return embedding
+}
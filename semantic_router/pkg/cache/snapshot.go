@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// snapshotVersion is the version of the snapshot file format
+const snapshotVersion = 1
+
+// SnapshotOptions holds options for snapshotting the completed entries of the
+// cache to disk, so a restarted router starts with the entries it had
+type SnapshotOptions struct {
+	// File the entries are written to, none when empty
+	Path string
+	// How often the entries are written, defaults to 5m; they are also
+	// written when the cache is stopped
+	Interval time.Duration
+	// Estimated size of the entries written, the newest kept; 0 for no limit
+	MaxBytes int64
+	// Model generating the embeddings, snapshots of another model's
+	// embeddings are not loaded
+	EmbeddingModel string
+}
+
+// snapshotHeader is the first line of a snapshot file
+type snapshotHeader struct {
+	Version        int       `json:"version"`
+	EmbeddingModel string    `json:"embedding_model"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// snapshotEntry is a line of a snapshot file holding an entry
+type snapshotEntry struct {
+	ID           string    `json:"id"`
+	Epoch        string    `json:"epoch,omitempty"`
+	Model        string    `json:"model"`
+	Query        string    `json:"query"`
+	RequestBody  []byte    `json:"request_body"`
+	ResponseBody []byte    `json:"response_body"`
+	Embedding    []float32 `json:"embedding"`
+	Timestamp    time.Time `json:"timestamp"`
+	TTLSeconds   float64   `json:"ttl_seconds,omitempty"`
+}
+
+// saveSnapshots saves a snapshot every interval until the snapshots are stopped
+func (c *SemanticCache) saveSnapshots(interval time.Duration) {
+	defer close(c.snapshotDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.snapshotStop:
+			return
+		case <-ticker.C:
+			if _, err := c.SaveSnapshot(); err != nil {
+				log.Printf("Error saving cache snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// stopSnapshots stops saving snapshots and saves a last one
+func (c *SemanticCache) stopSnapshots() {
+	c.snapshotOnce.Do(func() {
+		if c.snapshotStop == nil {
+			return
+		}
+		close(c.snapshotStop)
+		<-c.snapshotDone
+		if _, err := c.SaveSnapshot(); err != nil {
+			log.Printf("Error saving cache snapshot: %v", err)
+		}
+	})
+}
+
+// SaveSnapshot writes the completed entries to the snapshot file, the newest
+// within the size limit, returning how many were written. The file is
+// replaced atomically, so a crash mid-write leaves the previous snapshot.
+func (c *SemanticCache) SaveSnapshot() (int, error) {
+	if c.snapshot.Path == "" {
+		return 0, nil
+	}
+	written, err := c.saveSnapshot()
+	metrics.RecordCacheSnapshot("save", written, err)
+	return written, err
+}
+
+func (c *SemanticCache) saveSnapshot() (int, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, err
+	}
+	// Entries are listed oldest first, the newest are kept
+	first := 0
+	if c.snapshot.MaxBytes > 0 {
+		var size int64
+		for first = len(entries); first > 0; first-- {
+			size += entrySize(entries[first-1])
+			if size > c.snapshot.MaxBytes {
+				break
+			}
+		}
+	}
+	entries = entries[first:]
+
+	dir := filepath.Dir(c.snapshot.Path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, filepath.Base(c.snapshot.Path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(file.Name())
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(snapshotHeader{Version: snapshotVersion, EmbeddingModel: c.snapshot.EmbeddingModel, CreatedAt: time.Now()})
+	for _, entry := range entries {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(snapshotEntry{
+			ID:           entry.ID,
+			Epoch:        entry.Epoch,
+			Model:        entry.Model,
+			Query:        entry.Query,
+			RequestBody:  entry.RequestBody,
+			ResponseBody: entry.ResponseBody,
+			Embedding:    entry.Embedding,
+			Timestamp:    entry.Timestamp,
+			TTLSeconds:   entry.TTL.Seconds(),
+		})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(file.Name(), c.snapshot.Path); err != nil {
+		return 0, fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return len(entries), nil
+}
+
+// LoadSnapshot stores the entries of the snapshot file that are unexpired and
+// of the current epoch, returning how many were loaded. A missing snapshot
+// loads nothing; a snapshot of another embedding model is ignored.
+func (c *SemanticCache) LoadSnapshot() (int, error) {
+	if !c.enabled || c.snapshot.Path == "" {
+		return 0, nil
+	}
+	loaded, err := c.loadSnapshot()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	metrics.RecordCacheSnapshot("load", loaded, err)
+	return loaded, err
+}
+
+func (c *SemanticCache) loadSnapshot() (int, error) {
+	if _, ok := c.backend.(entryLister); !ok {
+		return 0, ErrNotListable
+	}
+	file, err := os.Open(c.snapshot.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(bufio.NewReader(file))
+
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return 0, fmt.Errorf("invalid snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+	if header.EmbeddingModel != c.snapshot.EmbeddingModel {
+		log.Printf("Ignoring cache snapshot of embedding model %q, the cache uses %q", header.EmbeddingModel, c.snapshot.EmbeddingModel)
+		return 0, nil
+	}
+
+	epoch := c.Epoch()
+	loaded := 0
+	for {
+		var line snapshotEntry
+		if err := decoder.Decode(&line); err == io.EOF {
+			break
+		} else if err != nil {
+			return loaded, fmt.Errorf("invalid snapshot entry: %w", err)
+		}
+		entry := CacheEntry{
+			ID:           line.ID,
+			Epoch:        line.Epoch,
+			RequestBody:  line.RequestBody,
+			ResponseBody: line.ResponseBody,
+			Model:        line.Model,
+			Query:        line.Query,
+			Embedding:    line.Embedding,
+			Timestamp:    line.Timestamp,
+			TTL:          time.Duration(line.TTLSeconds * float64(time.Second)),
+		}
+		if entry.Epoch != epoch || len(entry.Embedding) == 0 || c.expired(entry) {
+			continue
+		}
+		if err := c.backend.Add(entry); err != nil {
+			return loaded, err
+		}
+		c.addToPrefilter(entry)
+		loaded++
+	}
+	return loaded, nil
+}
+
+// expired reports whether an entry outlived its TTL or the cache's
+func (c *SemanticCache) expired(entry CacheEntry) bool {
+	if entry.TTL > 0 {
+		return time.Since(entry.Timestamp) >= entry.TTL
+	}
+	return c.ttlSeconds > 0 && time.Since(entry.Timestamp).Seconds() >= float64(c.ttlSeconds)
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newSnapshotCache(path, epoch, embeddingModel string) *SemanticCache {
+	return NewSemanticCache(SemanticCacheOptions{
+		SimilarityThreshold: 0.9,
+		TTLSeconds:          3600,
+		Enabled:             true,
+		EmbedFunc:           keywordEmbedding,
+		Epoch:               epoch,
+		Snapshot:            SnapshotOptions{Path: path, Interval: time.Hour, EmbeddingModel: embeddingModel},
+	})
+}
+
+func TestSnapshotRestoresEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := newSnapshotCache(path, "", "bert")
+	if err := c.AddEntry("phi4", "cats", []byte(`{"q":"cats"}`), []byte(`{"a":"cats"}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	// An expired entry is not restored
+	if err := c.backend.Add(CacheEntry{ID: "old", Model: "phi4", Query: "dogs", Embedding: []float32{0, 1}, Timestamp: time.Now().Add(-time.Minute), TTL: time.Second}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	c.Stop()
+
+	restored := newSnapshotCache(path, "", "bert")
+	defer restored.Stop()
+	loaded, err := restored.LoadSnapshot()
+	if err != nil || loaded != 1 {
+		t.Fatalf("LoadSnapshot = %d, %v, want 1 entry", loaded, err)
+	}
+	response, found, err := restored.FindSimilar("phi4", "cats")
+	if err != nil || !found || string(response) != `{"a":"cats"}` {
+		t.Errorf("restored entry not found: %s, %v, %v", response, found, err)
+	}
+}
+
+func TestSnapshotSkipsStaleEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := newSnapshotCache(path, "v1", "bert")
+	if err := c.AddEntry("phi4", "cats", []byte(`{"q":"cats"}`), []byte(`{}`)); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if _, err := c.SaveSnapshot(); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	c.Stop()
+
+	tests := []struct {
+		name           string
+		epoch          string
+		embeddingModel string
+	}{
+		{"another epoch", "v2", "bert"},
+		{"another embedding model", "v1", "minilm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := newSnapshotCache(path, tt.epoch, tt.embeddingModel)
+			defer restored.Stop()
+			if loaded, err := restored.LoadSnapshot(); err != nil || loaded != 0 {
+				t.Errorf("LoadSnapshot = %d, %v, want nothing loaded", loaded, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotMaxBytesKeepsNewest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := newSnapshotCache(path, "", "bert")
+	start := time.Now().Add(-time.Minute)
+	var size int64
+	for i, query := range []string{"a", "b", "c"} {
+		entry := CacheEntry{ID: query, Model: "phi4", Query: query, Embedding: []float32{1, 0}, Timestamp: start.Add(time.Duration(i) * time.Second)}
+		if err := c.backend.Add(entry); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		size = entrySize(entry)
+	}
+	c.snapshot.MaxBytes = 2 * size
+	if written, err := c.SaveSnapshot(); err != nil || written != 2 {
+		t.Fatalf("SaveSnapshot = %d, %v, want 2 entries", written, err)
+	}
+	c.Stop()
+
+	restored := newSnapshotCache(path, "", "bert")
+	defer restored.Stop()
+	if _, err := restored.LoadSnapshot(); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	for id, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		if entry, _ := restored.backend.Get(id); (entry != nil) != want {
+			t.Errorf("entry %s restored = %v, want %v", id, entry != nil, want)
+		}
+	}
+}
+
+func TestLoadMissingSnapshot(t *testing.T) {
+	c := newSnapshotCache(filepath.Join(t.TempDir(), "missing"), "", "bert")
+	defer c.Stop()
+	if loaded, err := c.LoadSnapshot(); err != nil || loaded != 0 {
+		t.Errorf("LoadSnapshot = %d, %v, want nothing loaded", loaded, err)
+	}
+}
@@ -0,0 +1,202 @@
+package canary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Header marks canary requests, which bypass the semantic cache so every run
+// exercises routing and the upstream
+const Header = "x-semantic-router-canary"
+
+// Checks performed for each probe
+const (
+	// CheckRouting routes the probe through the in-process pipeline and asserts the model
+	CheckRouting = "routing"
+	// CheckUpstream sends the probe to the upstream URL and asserts a successful response
+	CheckUpstream = "upstream"
+)
+
+// Probe is a known prompt sent through the router on every run
+type Probe struct {
+	Name   string
+	Prompt string
+	// Model requested by the probe, defaults to auto
+	Model string
+	// Model the probe must be routed to, not asserted when empty
+	ExpectedModel string
+}
+
+// RouteFunc routes an OpenAI request body through the router pipeline and
+// returns the model the request was routed to
+type RouteFunc func(ctx context.Context, body []byte) (string, error)
+
+// Options holds options for creating a new canary
+type Options struct {
+	// Time between runs
+	Interval time.Duration
+	// Timeout of a single check
+	Timeout time.Duration
+	// URL the probes are also sent to, e.g. the Envoy listener; upstream checks are skipped when empty
+	UpstreamURL string
+	Probes      []Probe
+	// Routes probes through the pipeline
+	Route RouteFunc
+	// Reports whether runs should happen on this replica, e.g. only on the
+	// elected leader; runs always happen when nil
+	ShouldRun func() bool
+}
+
+// Result is the outcome of one check of a probe
+type Result struct {
+	Probe   string
+	Check   string
+	Err     error
+	Latency time.Duration
+}
+
+// Canary periodically sends known prompts through the router and exposes the
+// outcome of each check as gauges for alerting
+type Canary struct {
+	options Options
+	client  *http.Client
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New creates a new canary with the given options
+func New(options Options) *Canary {
+	if options.Interval <= 0 {
+		options.Interval = time.Minute
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	for i := range options.Probes {
+		if options.Probes[i].Model == "" {
+			options.Probes[i].Model = "auto"
+		}
+	}
+	return &Canary{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start runs the probes in the background every interval, starting immediately
+func (c *Canary) Start() {
+	log.Printf("Starting canary with %d probes every %s", len(c.options.Probes), c.options.Interval)
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.options.Interval)
+		defer ticker.Stop()
+		for {
+			if c.options.ShouldRun == nil || c.options.ShouldRun() {
+				c.RunOnce(context.Background())
+			}
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the background runs and waits for the current one to finish
+func (c *Canary) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+}
+
+// RunOnce runs every check of every probe once and records the results
+func (c *Canary) RunOnce(ctx context.Context) []Result {
+	var results []Result
+	for _, probe := range c.options.Probes {
+		body, err := requestBody(probe)
+		if err != nil {
+			log.Printf("Canary probe %s has an invalid request: %v", probe.Name, err)
+			continue
+		}
+		if c.options.Route != nil {
+			results = append(results, c.run(ctx, probe, CheckRouting, func(ctx context.Context) error {
+				return c.checkRouting(ctx, probe, body)
+			}))
+		}
+		if c.options.UpstreamURL != "" {
+			results = append(results, c.run(ctx, probe, CheckUpstream, func(ctx context.Context) error {
+				return c.checkUpstream(ctx, body)
+			}))
+		}
+		metrics.RecordCanaryRun(probe.Name)
+	}
+	return results
+}
+
+// run performs a single check with a timeout and records its outcome
+func (c *Canary) run(ctx context.Context, probe Probe, check string, fn func(ctx context.Context) error) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := fn(ctx)
+	result := Result{Probe: probe.Name, Check: check, Err: err, Latency: time.Since(start)}
+	if err != nil {
+		log.Printf("Canary probe %s failed %s check: %v", probe.Name, check, err)
+	}
+	metrics.RecordCanaryCheck(probe.Name, check, err == nil, result.Latency.Seconds())
+	return result
+}
+
+func (c *Canary) checkRouting(ctx context.Context, probe Probe, body []byte) error {
+	model, err := c.options.Route(ctx, body)
+	if err != nil {
+		return err
+	}
+	if probe.ExpectedModel != "" && model != probe.ExpectedModel {
+		return fmt.Errorf("routed to %s, expected %s", model, probe.ExpectedModel)
+	}
+	return nil
+}
+
+func (c *Canary) checkUpstream(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.options.UpstreamURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(Header, "true")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// requestBody builds the chat completion request for a probe
+func requestBody(probe Probe) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"model": probe.Model,
+		"messages": []map[string]string{
+			{"role": "user", "content": probe.Prompt},
+		},
+	})
+}
@@ -0,0 +1,115 @@
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestRunOnce(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get(Header) != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Messages[0].Content == "unhealthy" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	// Model the fake pipeline routes each prompt to
+	routes := map[string]string{"What is the derivative of x^2?": "math-model", "unhealthy": "default-model"}
+	c := New(Options{
+		UpstreamURL: upstream.URL,
+		Probes: []Probe{
+			{Name: "math", Prompt: "What is the derivative of x^2?", ExpectedModel: "math-model"},
+			{Name: "law", Prompt: "unhealthy", ExpectedModel: "law-model"},
+			{Name: "broken", Prompt: "anything"},
+		},
+		Route: func(ctx context.Context, body []byte) (string, error) {
+			var req struct {
+				Model    string `json:"model"`
+				Messages []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				return "", err
+			}
+			if req.Model != "auto" {
+				return "", errors.New("probe must request auto")
+			}
+			model, ok := routes[req.Messages[0].Content]
+			if !ok {
+				return "", errors.New("pipeline failure")
+			}
+			return model, nil
+		},
+	})
+
+	results := c.RunOnce(context.Background())
+	want := map[string]bool{
+		"math/routing":    true,
+		"math/upstream":   true,
+		"law/routing":     false,
+		"law/upstream":    false,
+		"broken/routing":  false,
+		"broken/upstream": true,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		key := result.Probe + "/" + result.Check
+		if ok := result.Err == nil; ok != want[key] {
+			t.Errorf("%s succeeded = %v, want %v (err: %v)", key, ok, want[key], result.Err)
+		}
+		success := testutil.ToFloat64(metrics.CanarySuccess.WithLabelValues(result.Probe, result.Check))
+		if (success == 1) != want[key] {
+			t.Errorf("%s success gauge = %v", key, success)
+		}
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	runs := make(chan struct{}, 10)
+	c := New(Options{
+		Interval: 10 * time.Millisecond,
+		Probes:   []Probe{{Name: "loop", Prompt: "hi"}},
+		Route: func(ctx context.Context, body []byte) (string, error) {
+			runs <- struct{}{}
+			return "model", nil
+		},
+	})
+	c.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("canary did not run")
+		}
+	}
+	c.Stop()
+	// Stopping twice must not panic
+	c.Stop()
+}
@@ -0,0 +1,116 @@
+package chunking
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Pooling modes for combining per-chunk results
+const (
+	PoolingMean = "mean"
+	PoolingMax  = "max"
+)
+
+// Options holds options for splitting long text into chunks
+type Options struct {
+	// Enable chunking; when disabled text is passed through as a single chunk
+	Enabled bool
+	// Maximum words per chunk, sized to stay under the model's max sequence length
+	ChunkWords int
+	// Words shared between consecutive chunks so context isn't cut mid-thought
+	OverlapWords int
+	// How chunk results are combined: mean or max
+	Pooling string
+}
+
+// Split splits text into overlapping chunks of at most ChunkWords words.
+// Text that fits in one chunk is returned unchanged.
+func Split(text string, options Options) []string {
+	if !options.Enabled || options.ChunkWords <= 0 {
+		return []string{text}
+	}
+
+	words := strings.Fields(text)
+	if len(words) <= options.ChunkWords {
+		return []string{text}
+	}
+
+	step := options.ChunkWords - options.OverlapWords
+	if step <= 0 {
+		step = options.ChunkWords
+	}
+
+	var chunks []string
+	for start := 0; start < len(words); start += step {
+		end := start + options.ChunkWords
+		if end > len(words) {
+			end = len(words)
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+	}
+	return chunks
+}
+
+// PoolEmbeddings combines chunk embeddings into a single L2-normalized embedding
+// using element-wise mean or max pooling
+func PoolEmbeddings(embeddings [][]float32, pooling string) ([]float32, error) {
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embeddings to pool")
+	}
+	if len(embeddings) == 1 {
+		return embeddings[0], nil
+	}
+
+	dim := len(embeddings[0])
+	pooled := make([]float32, dim)
+	switch pooling {
+	case PoolingMean, "":
+		for _, emb := range embeddings {
+			if len(emb) != dim {
+				return nil, fmt.Errorf("embedding dimension mismatch: %d != %d", len(emb), dim)
+			}
+			for i, v := range emb {
+				pooled[i] += v
+			}
+		}
+		for i := range pooled {
+			pooled[i] /= float32(len(embeddings))
+		}
+	case PoolingMax:
+		copy(pooled, embeddings[0])
+		for _, emb := range embeddings[1:] {
+			if len(emb) != dim {
+				return nil, fmt.Errorf("embedding dimension mismatch: %d != %d", len(emb), dim)
+			}
+			for i, v := range emb {
+				if v > pooled[i] {
+					pooled[i] = v
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown pooling mode: %s", pooling)
+	}
+
+	normalize(pooled)
+	return pooled, nil
+}
+
+// normalize scales the vector to unit length so dot products remain cosine similarities
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+}
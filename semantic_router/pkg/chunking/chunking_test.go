@@ -0,0 +1,50 @@
+package chunking
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	options := Options{Enabled: true, ChunkWords: 4, OverlapWords: 1}
+
+	if got := Split("short text", options); !reflect.DeepEqual(got, []string{"short text"}) {
+		t.Errorf("expected short text unchanged, got %v", got)
+	}
+
+	got := Split("a b c d e f g h i j", options)
+	want := []string{"a b c d", "d e f g", "g h i j"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	options.Enabled = false
+	if got := Split("a b c d e f g h i j", options); len(got) != 1 {
+		t.Errorf("expected a single chunk when disabled, got %v", got)
+	}
+}
+
+func TestPoolEmbeddings(t *testing.T) {
+	embeddings := [][]float32{{1, 0}, {0, 1}}
+
+	mean, err := PoolEmbeddings(embeddings, PoolingMean)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(float64(mean[0]-mean[1])) > 1e-6 || math.Abs(float64(mean[0])-math.Sqrt(0.5)) > 1e-6 {
+		t.Errorf("unexpected mean pooling result: %v", mean)
+	}
+
+	max, err := PoolEmbeddings([][]float32{{0.6, -1}, {-1, 0.8}}, PoolingMax)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(float64(max[0])-0.6) > 1e-6 || math.Abs(float64(max[1])-0.8) > 1e-6 {
+		t.Errorf("unexpected max pooling result: %v", max)
+	}
+
+	if _, err := PoolEmbeddings(embeddings, "median"); err == nil {
+		t.Error("expected error for unknown pooling mode")
+	}
+}
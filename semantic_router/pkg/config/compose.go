@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey lists the files a config file is composed from
+const includeKey = "include"
+
+// readConfig reads a config file, composing it with the files it includes.
+//
+// A file may list other files under include, as paths or glob patterns
+// relative to the file itself; files matching a glob are taken in lexical
+// order. The included files are merged in the order listed, each after its
+// own includes, and the including file's own settings are merged last. So an
+// environment overlay includes the base config and the per-tenant fragments,
+// and overrides what it sets itself.
+//
+// Merging combines mappings key by key, with later values replacing earlier
+// ones. Lists whose entries all have a name, e.g. categories or residency
+// tenants, are merged entry by entry, matched by name, with new entries
+// appended. Any other list is replaced as a whole.
+func readConfig(path string) (*RouterConfig, error) {
+	merged, files, err := composeFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compose config: %w", err)
+	}
+	cfg := &RouterConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	cfg.Sources = files
+	cfg.unknownKeys = unknownKeys(merged, reflect.TypeOf(cfg), "")
+	return cfg, nil
+}
+
+// composeFile returns the merged settings of a file and its includes, along
+// with every file read in merge order. stack holds the files being composed,
+// to detect include cycles.
+func composeFile(path string, stack []string) (map[string]interface{}, []string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, including := range stack {
+		if including == absPath {
+			return nil, nil, fmt.Errorf("config file %s includes itself", path)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if settings == nil {
+		settings = make(map[string]interface{})
+	}
+
+	includes, err := includedFiles(path, settings[includeKey])
+	if err != nil {
+		return nil, nil, err
+	}
+	delete(settings, includeKey)
+
+	merged := make(map[string]interface{})
+	var files []string
+	for _, include := range includes {
+		included, includedFiles, err := composeFile(include, append(stack, absPath))
+		if err != nil {
+			return nil, nil, err
+		}
+		merged = mergeSettings(merged, included).(map[string]interface{})
+		files = append(files, includedFiles...)
+	}
+	merged = mergeSettings(merged, settings).(map[string]interface{})
+	return merged, append(files, path), nil
+}
+
+// includedFiles resolves the include list of a file to paths
+func includedFiles(path string, value interface{}) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	patterns, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s in %s must be a list of files", includeKey, path)
+	}
+
+	var files []string
+	dir := filepath.Dir(path)
+	for _, entry := range patterns {
+		pattern, ok := entry.(string)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("%s in %s has an invalid entry %v", includeKey, path, entry)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s in %s has an invalid pattern %q: %w", includeKey, path, entry, err)
+		}
+		// A plain path must exist, a pattern may match nothing
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return nil, fmt.Errorf("config file %s included by %s does not exist", pattern, path)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSettings merges overlay onto base as described in readConfig
+func mergeSettings(base, overlay interface{}) interface{} {
+	switch overlayValue := overlay.(type) {
+	case map[string]interface{}:
+		baseMap, ok := base.(map[string]interface{})
+		if !ok {
+			return overlayValue
+		}
+		merged := make(map[string]interface{}, len(baseMap)+len(overlayValue))
+		for key, value := range baseMap {
+			merged[key] = value
+		}
+		for key, value := range overlayValue {
+			merged[key] = mergeSettings(merged[key], value)
+		}
+		return merged
+	case []interface{}:
+		baseList, ok := base.([]interface{})
+		if !ok || !namedEntries(baseList) || !namedEntries(overlayValue) {
+			return overlayValue
+		}
+		merged := append([]interface{}{}, baseList...)
+		for _, entry := range overlayValue {
+			name := entry.(map[string]interface{})["name"]
+			found := false
+			for i, existing := range merged {
+				if existing.(map[string]interface{})["name"] == name {
+					merged[i] = mergeSettings(existing, entry)
+					found = true
+					break
+				}
+			}
+			if !found {
+				merged = append(merged, entry)
+			}
+		}
+		return merged
+	default:
+		return overlay
+	}
+}
+
+// namedEntries reports whether every entry of a list is a mapping with a name
+func namedEntries(list []interface{}) bool {
+	for _, entry := range list {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := fields["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeFiles writes the files under a temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadConfigComposesIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.yaml": `
+default_model: base-model
+categories:
+  - name: math
+    models: [math-small]
+    reasoning_effort: low
+  - name: law
+    models: [law-model]
+semantic_cache:
+  enabled: false
+  max_entries: 1000
+api_paths:
+  prefixes: [/llm]
+`,
+		"tenants/b-acme.yaml": `
+residency:
+  tenants:
+    - name: acme
+      allowed_regions: [eu]
+`,
+		"tenants/a-globex.yaml": `
+residency:
+  tenants:
+    - name: globex
+      allowed_regions: [us]
+`,
+		"env/prod.yaml": `
+include:
+  - ../base.yaml
+  - ../tenants/*.yaml
+default_model: prod-model
+categories:
+  - name: math
+    models: [math-large]
+  - name: code
+    models: [code-model]
+semantic_cache:
+  enabled: true
+api_paths:
+  prefixes: [/openai]
+`,
+	})
+
+	cfg, err := readConfig(filepath.Join(dir, "env/prod.yaml"))
+	if err != nil {
+		t.Fatalf("readConfig: %v", err)
+	}
+	if cfg.DefaultModel != "prod-model" {
+		t.Errorf("default_model = %q, want the overlay's", cfg.DefaultModel)
+	}
+	wantCategories := []Category{
+		{Name: "math", Models: []string{"math-large"}, ReasoningEffort: "low"},
+		{Name: "law", Models: []string{"law-model"}},
+		{Name: "code", Models: []string{"code-model"}},
+	}
+	if !reflect.DeepEqual(cfg.Categories, wantCategories) {
+		t.Errorf("categories = %+v, want %+v", cfg.Categories, wantCategories)
+	}
+	if !cfg.SemanticCache.Enabled || cfg.SemanticCache.MaxEntries != 1000 {
+		t.Errorf("semantic_cache = %+v, want the overlay merged onto the base", cfg.SemanticCache)
+	}
+	if !reflect.DeepEqual(cfg.APIPaths.Prefixes, []string{"/openai"}) {
+		t.Errorf("api_paths.prefixes = %v, want the overlay's list", cfg.APIPaths.Prefixes)
+	}
+	var tenants []string
+	for _, tenant := range cfg.Residency.Tenants {
+		tenants = append(tenants, tenant.Name)
+	}
+	if !reflect.DeepEqual(tenants, []string{"globex", "acme"}) {
+		t.Errorf("tenants = %v, want the fragments in lexical order", tenants)
+	}
+	wantSources := []string{
+		filepath.Join(dir, "base.yaml"),
+		filepath.Join(dir, "tenants/a-globex.yaml"),
+		filepath.Join(dir, "tenants/b-acme.yaml"),
+		filepath.Join(dir, "env/prod.yaml"),
+	}
+	if !reflect.DeepEqual(cfg.Sources, wantSources) {
+		t.Errorf("sources = %v, want %v", cfg.Sources, wantSources)
+	}
+}
+
+func TestReadConfigRejectsInvalidIncludes(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "cycle",
+			files:   map[string]string{"config.yaml": "include: [other.yaml]", "other.yaml": "include: [config.yaml]"},
+			wantErr: "includes itself",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"config.yaml": "include: [missing.yaml]"},
+			wantErr: "does not exist",
+		},
+		{
+			name:    "not a list",
+			files:   map[string]string{"config.yaml": "include: base.yaml"},
+			wantErr: "must be a list",
+		},
+		{
+			name:    "invalid fragment",
+			files:   map[string]string{"config.yaml": "include: [bad.yaml]", "bad.yaml": "categories: ["},
+			wantErr: "bad.yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			if _, err := readConfig(filepath.Join(dir, "config.yaml")); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readConfig error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A pattern may match nothing
+	dir := writeFiles(t, map[string]string{"config.yaml": "include: [tenants/*.yaml]\ndefault_model: m"})
+	if cfg, err := readConfig(filepath.Join(dir, "config.yaml")); err != nil || cfg.DefaultModel != "m" {
+		t.Errorf("readConfig = %+v, %v", cfg, err)
+	}
+}
+
+func TestReadConfigWithoutIncludesMatchesDirectParse(t *testing.T) {
+	path := "../../../config/config.yaml"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Skipf("example config not found: %v", err)
+	}
+	want := &RouterConfig{}
+	if err := yaml.Unmarshal(data, want); err != nil {
+		t.Fatalf("yaml.Unmarshal: %v", err)
+	}
+	got, err := readConfig(path)
+	if err != nil {
+		t.Fatalf("readConfig: %v", err)
+	}
+	got.Sources = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Error("composing a single file changed the parsed config")
+	}
+}
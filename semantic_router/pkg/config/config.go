@@ -1,38 +1,1817 @@
 package config
 
 import (
-	"fmt"
-	"os"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // RouterConfig represents the main configuration for the LLM Router
 type RouterConfig struct {
+	// Files the config was composed from in merge order, set when it is loaded
+	Sources []string `yaml:"-"`
+
+	// Keys of the composed config matching no setting
+	unknownKeys []string
+
+	// Handling of keys matching no setting: "warn" or "error". Unset, they are
+	// warnings when the router loads the config and errors in validate-config.
+	UnknownKeys string `yaml:"unknown_keys,omitempty"`
+
 	// BERT model configuration for Candle BERT similarity comparison
 	BertModel struct {
 		ModelID   string  `yaml:"model_id"`
 		Threshold float32 `yaml:"threshold"`
 		UseCPU    bool    `yaml:"use_cpu"`
+		// The model embeds all languages into one space, so category utterances of
+		// every language are matched regardless of the query's language
+		Multilingual bool `yaml:"multilingual,omitempty"`
+		// Where model_id points: hub (default), local or oci
+		Source string `yaml:"source,omitempty"`
+		// Hub revision and expected file checksums used with model_download
+		Revision  string            `yaml:"revision,omitempty"`
+		Checksums map[string]string `yaml:"checksums,omitempty"`
+		// Similarity models for queries detected in a language, keyed by ISO
+		// 639-1 code and loaded concurrently at startup alongside model_id,
+		// which scores queries in other languages
+		LanguageModels map[string]LanguageModel `yaml:"language_models,omitempty"`
 	} `yaml:"bert_model"`
 
-	// Classifier configuration for text classification
-	Classifier struct {
-		ModelID             string  `yaml:"model_id"`
-		Threshold           float32 `yaml:"threshold"`
-		UseCPU              bool    `yaml:"use_cpu"`
-		CategoryMappingPath string  `yaml:"category_mapping_path"`
-	} `yaml:"classifier"`
+	// Classifier configuration for text classification
+	Classifier struct {
+		ModelID             string  `yaml:"model_id"`
+		Threshold           float32 `yaml:"threshold"`
+		UseCPU              bool    `yaml:"use_cpu"`
+		CategoryMappingPath string  `yaml:"category_mapping_path"`
+		// Where model_id points: hub (default), local or oci
+		Source string `yaml:"source,omitempty"`
+		// Hub revision and expected file checksums used with model_download
+		Revision  string            `yaml:"revision,omitempty"`
+		Checksums map[string]string `yaml:"checksums,omitempty"`
+	} `yaml:"classifier"`
+
+	// How queries are matched to categories
+	Routing RoutingConfig `yaml:"routing,omitempty"`
+
+	// Downloading and verifying hub models into a local cache at startup
+	ModelDownload ModelDownloadConfig `yaml:"model_download,omitempty"`
+
+	// Serving while the models fail to load at startup
+	SafeMode SafeModeConfig `yaml:"safe_mode,omitempty"`
+
+	// Categories for routing queries
+	Categories []Category `yaml:"categories"`
+
+	// Default LLM model to use if no match is found
+	DefaultModel string `yaml:"default_model"`
+
+	// Whether routing decisions are applied: "enforce" (default), "shadow"
+	// to make and record them while every request passes through unchanged,
+	// or "speculative" to also continue requests before they are classified
+	Mode string `yaml:"mode,omitempty"`
+
+	// Semantic cache configuration
+	SemanticCache SemanticCacheConfig `yaml:"semantic_cache"`
+
+	// Per-model configuration keyed by model name
+	ModelConfig map[string]ModelParams `yaml:"model_config,omitempty"`
+
+	// Scale-up signaling for autoscaled model backends
+	Autoscale AutoscaleConfig `yaml:"autoscale,omitempty"`
+
+	// Locality-aware selection among model endpoints
+	EndpointSelection EndpointSelectionConfig `yaml:"endpoint_selection,omitempty"`
+
+	// Selection among a category's models by the load their endpoints report
+	LoadAwareRouting LoadAwareRoutingConfig `yaml:"load_aware_routing,omitempty"`
+
+	// Body mutation templates keyed by model family and feature, extending or
+	// replacing the built-in templates
+	ModelFamilyTemplates map[string]map[string]MutationTemplate `yaml:"model_family_templates,omitempty"`
+
+	// Removal of provider-identifying fields and headers from responses
+	ResponseScrubbing ResponseScrubbingConfig `yaml:"response_scrubbing,omitempty"`
+
+	// Latency budget of the routing decision made in the request phase
+	DecisionBudget DecisionBudgetConfig `yaml:"decision_budget,omitempty"`
+
+	// Routing of turns returning tool output to the model that made the tool call
+	ToolCallRouting ToolCallRoutingConfig `yaml:"tool_call_routing,omitempty"`
+
+	// Routing of requests away from models whose context window they exceed
+	ContextRouting ContextRoutingConfig `yaml:"context_routing,omitempty"`
+
+	// Routing of the turns of a conversation to the model its first turn went to
+	SessionRouting SessionRoutingConfig `yaml:"session_routing,omitempty"`
+
+	// Applications recognized by their system prompt, with their own routing
+	// profile; the first matching application applies
+	Applications []ApplicationConfig `yaml:"applications,omitempty"`
+
+	// Learning which model serves each application best
+	ApplicationLearning ApplicationLearningConfig `yaml:"application_learning,omitempty"`
+
+	// Tuning category thresholds from feedback on routed requests
+	RoutingFeedback RoutingFeedbackConfig `yaml:"routing_feedback,omitempty"`
+
+	// Routing policies of tenants, resolved from a request header
+	Tenants TenantsConfig `yaml:"tenants,omitempty"`
+
+	// Expiry of the state kept across ext_proc streams
+	RequestState RequestStateConfig `yaml:"request_state,omitempty"`
+
+	// Detection of the API endpoint of requests mounted under other paths
+	APIPaths APIPathsConfig `yaml:"api_paths,omitempty"`
+
+	// Handling of Anthropic Messages API requests
+	AnthropicMessages AnthropicMessagesConfig `yaml:"anthropic_messages,omitempty"`
+
+	// Passthrough of Batch API requests with usage accounted once batches finish
+	BatchAccounting BatchAccountingConfig `yaml:"batch_accounting,omitempty"`
+
+	// Handling of streamed chat completions
+	Streaming StreamingConfig `yaml:"streaming,omitempty"`
+
+	// Reloading of the config while the server runs
+	ConfigReload ConfigReloadConfig `yaml:"config_reload,omitempty"`
+
+	// Limit on response bodies buffered for accounting, scrubbing and caching
+	ResponseBuffering ResponseBufferingConfig `yaml:"response_buffering,omitempty"`
+
+	// Limit of the request bodies reassembled from chunks
+	RequestBuffering RequestBufferingConfig `yaml:"request_buffering,omitempty"`
+
+	// Headers describing routing decisions, added to requests and responses
+	DecisionHeaders DecisionHeadersConfig `yaml:"decision_headers,omitempty"`
+
+	// Signed receipts of routing decisions for billing and audit proxies
+	RoutingReceipts RoutingReceiptsConfig `yaml:"routing_receipts,omitempty"`
+
+	// The router's version and capabilities advertised to Envoy
+	ProcessorMetadata ProcessorMetadataConfig `yaml:"processor_metadata,omitempty"`
+
+	// Limits of the bytes buffered per stream and by all streams
+	StreamLimits StreamLimitsConfig `yaml:"stream_limits,omitempty"`
+
+	// Chunking of text longer than the BERT model's max sequence length
+	TextChunking TextChunkingConfig `yaml:"text_chunking,omitempty"`
+
+	// Sampling of very long inputs before classification
+	ClassificationBudget ClassificationBudgetConfig `yaml:"classification_budget,omitempty"`
+
+	// Stripping of boilerplate from system prompts before classification
+	BoilerplateFilter BoilerplateFilterConfig `yaml:"boilerplate_filter,omitempty"`
+
+	// Detection of PII in requests, which are blocked or redacted before routing
+	PII PIIConfig `yaml:"pii,omitempty"`
+
+	// Rejection of jailbreak and prompt injection attempts before routing
+	PromptGuard PromptGuardConfig `yaml:"prompt_guard,omitempty"`
+
+	// Automatic disablement of pipeline stages failing too often
+	ErrorBudgets ErrorBudgetsConfig `yaml:"error_budgets,omitempty"`
+
+	// Routing around destination models whose responses fail or slow down
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+
+	// Reproducible routing decisions for CI and integration tests
+	Deterministic DeterministicConfig `yaml:"deterministic,omitempty"`
+
+	// Emission of per-request decision records
+	DecisionRecords DecisionRecordsConfig `yaml:"decision_records,omitempty"`
+
+	// Seeding learned routing state at startup from logged decision records
+	WarmStart WarmStartConfig `yaml:"warm_start,omitempty"`
+
+	// Initial state of the runtime pipeline stage flags; stages not listed start enabled
+	PipelineStages map[string]bool `yaml:"pipeline_stages,omitempty"`
+
+	// Gradual rollouts limiting enabled pipeline stages to a share of traffic
+	StageRollouts map[string]StageRolloutConfig `yaml:"stage_rollouts,omitempty"`
+
+	// Addresses the ext_proc server listens on, every interface at the port
+	// given on the command line when empty
+	Listeners []ListenerConfig `yaml:"listeners,omitempty"`
+
+	// TLS, and optionally client certificate authentication, of the listeners
+	TLS ServerTLSConfig `yaml:"tls,omitempty"`
+
+	// Message size, keepalive and concurrency limits of the gRPC server
+	GRPC GRPCServerConfig `yaml:"grpc,omitempty"`
+
+	// Zero-downtime restarts of the router binary
+	GracefulRestart GracefulRestartConfig `yaml:"graceful_restart,omitempty"`
+
+	// Draining of open streams when the router stops
+	Shutdown ShutdownConfig `yaml:"shutdown,omitempty"`
+
+	// HTTP listener serving the Prometheus metrics
+	Metrics MetricsServerConfig `yaml:"metrics,omitempty"`
+
+	// Admin HTTP API
+	Admin AdminConfig `yaml:"admin,omitempty"`
+
+	// OpenTelemetry spans of request processing
+	Tracing TracingConfig `yaml:"tracing,omitempty"`
+
+	// Level and format of the router's logs
+	Logging LoggingConfig `yaml:"logging,omitempty"`
+
+	// Routing policies keyed on the client's region
+	GeoRouting GeoRoutingConfig `yaml:"geo_routing,omitempty"`
+
+	// Tenant policies requiring compliance attributes of the models they are routed to
+	Residency ResidencyConfig `yaml:"residency,omitempty"`
+
+	// Sink archiving the conversations of tenants under a compliance hold
+	ComplianceArchive ComplianceArchiveConfig `yaml:"compliance_archive,omitempty"`
+
+	// Synthetic canary traffic sent through the pipeline in the background
+	Canary CanaryConfig `yaml:"canary,omitempty"`
+
+	// Central coordinator sharing quota consumption and endpoint health across replicas
+	Coordinator CoordinatorConfig `yaml:"coordinator,omitempty"`
+
+	// Self-registration with a control plane
+	Registration RegistrationConfig `yaml:"registration,omitempty"`
+
+	// Faults injected to validate resilience features in staging
+	FaultInjection FaultInjectionConfig `yaml:"fault_injection,omitempty"`
+
+	// Leader election restricting singleton background jobs to one replica
+	LeaderElection LeaderElectionConfig `yaml:"leader_election,omitempty"`
+
+	// Clustering of unrouted queries into candidate new categories
+	CategoryDiscovery CategoryDiscoveryConfig `yaml:"category_discovery,omitempty"`
+
+	// Memoization of the embeddings of recurring texts
+	EmbeddingCache EmbeddingCacheConfig `yaml:"embedding_cache,omitempty"`
+
+	// Where the embeddings of routing and the semantic cache are computed
+	EmbeddingProvider EmbeddingProviderConfig `yaml:"embedding_provider,omitempty"`
+
+	// Capture of decision traces for requests breaching the latency SLO
+	SlowRequestTracing SlowRequestTracingConfig `yaml:"slow_request_tracing,omitempty"`
+
+	// Recording of ext_proc streams for replay
+	StreamRecording StreamRecordingConfig `yaml:"stream_recording,omitempty"`
+
+	// Hourly and daily token budgets of clients identified by a header
+	TokenBudgets TokenBudgetsConfig `yaml:"token_budgets,omitempty"`
+
+	// Per-tenant metrics and which tenants get their own metric labels
+	TenantMetrics TenantMetricsConfig `yaml:"tenant_metrics,omitempty"`
+
+	// Request headers tagging requests with dimensions of metrics and
+	// decision records, e.g. the team or feature sending them
+	RequestTags []RequestTagConfig `yaml:"request_tags,omitempty"`
+}
+
+// ModelDownloadConfig represents configuration for downloading models from the Hugging Face Hub
+type ModelDownloadConfig struct {
+	// Download models into the cache directory and verify their checksums
+	// instead of letting the model loader fetch them
+	Enabled bool `yaml:"enabled"`
+
+	// Directory models are downloaded into
+	CacheDir string `yaml:"cache_dir,omitempty"`
+
+	// Base URL of the hub, defaults to https://huggingface.co
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Patterns of the repository files to download; configs, tokenizer and
+	// safetensors weights when empty
+	Files []string `yaml:"files,omitempty"`
+
+	// Download attempts per model before startup fails or safe mode takes over
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+
+	// Seconds before the first retry, doubled after every failed attempt
+	RetryIntervalSeconds int `yaml:"retry_interval_seconds,omitempty"`
+
+	// Username for OCI registries; the password is read from MODEL_REGISTRY_PASSWORD
+	RegistryUsername string `yaml:"registry_username,omitempty"`
+
+	// OCI registries served over plain HTTP, e.g. registry.local:5000
+	PlainHTTPRegistries []string `yaml:"plain_http_registries,omitempty"`
+}
+
+// SafeModeConfig represents configuration for serving without the models when they fail to load
+type SafeModeConfig struct {
+	// Start in safe mode instead of failing when the models cannot be loaded
+	Enabled bool `yaml:"enabled"`
+
+	// Seconds before the first retry of loading the models, doubled after every failure
+	RetryIntervalSeconds int `yaml:"retry_interval_seconds,omitempty"`
+
+	// Upper bound of the retry interval in seconds
+	MaxRetryIntervalSeconds int `yaml:"max_retry_interval_seconds,omitempty"`
+}
+
+// CategoryDiscoveryConfig represents configuration for discovering categories from unrouted traffic
+type CategoryDiscoveryConfig struct {
+	// Enable clustering queries that no category matched
+	Enabled bool `yaml:"enabled"`
+
+	// Number of recent unrouted queries clustered
+	MaxSamples int `yaml:"max_samples,omitempty"`
+
+	// Minimum cosine similarity for a query to join a cluster
+	SimilarityThreshold float32 `yaml:"similarity_threshold,omitempty"`
+
+	// Minimum number of queries in a cluster to surface it as a candidate category
+	MinClusterSize int `yaml:"min_cluster_size,omitempty"`
+
+	// Number of representative examples per candidate
+	MaxExamples int `yaml:"max_examples,omitempty"`
+}
+
+// EmbeddingCacheConfig represents the memoization of text embeddings, shared by
+// utterance routing, the semantic cache and category discovery
+type EmbeddingCacheConfig struct {
+	// Enable memoizing embeddings
+	Enabled bool `yaml:"enabled"`
+
+	// Embeddings kept, the least recently used evicted first (default 10000)
+	MaxEntries int `yaml:"max_entries,omitempty"`
+
+	// Share embeddings between texts differing only in case; only for uncased
+	// embedding models such as all-MiniLM-L12-v2
+	CaseInsensitive bool `yaml:"case_insensitive,omitempty"`
+}
+
+// Embedding providers
+const (
+	// EmbeddingProviderCandle embeds texts with bert_model in process
+	EmbeddingProviderCandle = "candle"
+	// EmbeddingProviderRemote embeds texts with an OpenAI-compatible
+	// embeddings endpoint
+	EmbeddingProviderRemote = "remote"
+)
+
+// EmbeddingProviderConfig represents where the embeddings of utterance
+// routing, the semantic cache and category discovery are computed
+type EmbeddingProviderConfig struct {
+	// candle (default) or remote
+	Type string `yaml:"type,omitempty"`
+
+	// Endpoint used by the remote provider
+	Remote RemoteEmbeddingConfig `yaml:"remote,omitempty"`
+}
+
+// RemoteEmbeddingConfig represents an OpenAI-compatible /v1/embeddings
+// endpoint
+type RemoteEmbeddingConfig struct {
+	URL string `yaml:"url"`
+
+	// Model named in requests
+	Model string `yaml:"model,omitempty"`
+
+	// Environment variable holding the bearer token of the endpoint
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+
+	// Timeout of a request in milliseconds, default 5000
+	TimeoutMs int `yaml:"timeout_ms,omitempty"`
+
+	// Most texts embedded in one request, default 32
+	MaxBatchSize int `yaml:"max_batch_size,omitempty"`
+
+	// Milliseconds a text waits for concurrently embedded texts to share its
+	// request; 0 sends every text alone
+	BatchWaitMs int `yaml:"batch_wait_ms,omitempty"`
+
+	// Failing fast while the endpoint fails or slows down
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+}
+
+// GetEmbeddingProvider returns the effective embedding provider
+func (c *RouterConfig) GetEmbeddingProvider() string {
+	if c.EmbeddingProvider.Type == "" {
+		return EmbeddingProviderCandle
+	}
+	return c.EmbeddingProvider.Type
+}
+
+// GetEmbeddingModel returns the model embedding texts, which embeddings
+// computed with another one can't be compared with
+func (c *RouterConfig) GetEmbeddingModel() string {
+	if c.GetEmbeddingProvider() == EmbeddingProviderRemote {
+		return c.EmbeddingProvider.Remote.URL + "#" + c.EmbeddingProvider.Remote.Model
+	}
+	return c.BertModel.ModelID
+}
+
+// SlowRequestTracingConfig represents configuration for capturing traces of slow requests
+type SlowRequestTracingConfig struct {
+	// Enable capturing traces of requests slower than the SLO
+	Enabled bool `yaml:"enabled"`
+
+	// Total request latency SLO in milliseconds, from request headers to the end of the response
+	SLOMilliseconds int `yaml:"slo_milliseconds"`
+
+	// Number of traces kept in the debug store
+	MaxTraces int `yaml:"max_traces,omitempty"`
+
+	// Directory traces are also written to, empty to keep them in memory only
+	Directory string `yaml:"directory,omitempty"`
+
+	// Request headers redacted in traces in addition to the built-in credential headers
+	RedactHeaders []string `yaml:"redact_headers,omitempty"`
+}
+
+// StreamRecordingConfig represents recording the messages of ext_proc streams
+// to files, to replay them through the router
+type StreamRecordingConfig struct {
+	// Record sampled streams
+	Enabled bool `yaml:"enabled"`
+
+	// Directory recordings are written to, one file per stream
+	Directory string `yaml:"directory"`
+
+	// Fraction of streams recorded, default 1
+	SampleRate float64 `yaml:"sample_rate,omitempty"`
+
+	// Most recordings kept; the oldest written by the process are removed past
+	// it, default 1000
+	MaxFiles int `yaml:"max_files,omitempty"`
+
+	// Headers redacted in recordings in addition to the built-in credential headers
+	RedactHeaders []string `yaml:"redact_headers,omitempty"`
+}
+
+// LeaderElectionConfig represents configuration for Kubernetes Lease based leader election
+type LeaderElectionConfig struct {
+	// Enable leader election; without it every replica runs the background jobs
+	Enabled bool `yaml:"enabled"`
+
+	// Name of the Lease object
+	LeaseName string `yaml:"lease_name,omitempty"`
+
+	// Namespace of the Lease object, defaults to the pod's namespace
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Identity of this replica, defaults to the hostname (the pod name)
+	Identity string `yaml:"identity,omitempty"`
+
+	// Seconds a lease is valid without renewal
+	LeaseDurationSeconds int `yaml:"lease_duration_seconds,omitempty"`
+
+	// Seconds between renewals and acquisition attempts
+	RetryIntervalSeconds int `yaml:"retry_interval_seconds,omitempty"`
+}
+
+// CoordinatorConfig represents configuration for syncing with a fleet coordinator
+type CoordinatorConfig struct {
+	// Address of the coordinator (host:port); empty disables fleet coordination
+	Address string `yaml:"address,omitempty"`
+
+	// Identity of this replica, defaults to the hostname
+	ReplicaID string `yaml:"replica_id,omitempty"`
+
+	// Seconds between syncs
+	SyncIntervalSeconds int `yaml:"sync_interval_seconds,omitempty"`
+
+	// Timeout of a single sync in seconds
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// RegistrationConfig represents configuration for announcing the instance to
+// a control plane on startup and with heartbeats thereafter
+type RegistrationConfig struct {
+	// Endpoint announcements are POSTed to; empty disables registration
+	URL string `yaml:"url,omitempty"`
+
+	// Identity of this instance, defaults to the hostname
+	InstanceID string `yaml:"instance_id,omitempty"`
+
+	// ext_proc address announced (host:port), defaults to the hostname and
+	// the gRPC port
+	AdvertiseAddress string `yaml:"advertise_address,omitempty"`
+
+	// Environment variable holding the Authorization header value, if any
+	AuthorizationEnv string `yaml:"authorization_env,omitempty"`
+
+	// Seconds between heartbeats
+	HeartbeatIntervalSeconds int `yaml:"heartbeat_interval_seconds,omitempty"`
+
+	// Timeout of a single announcement in seconds
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// FaultInjectionConfig represents faults injected into request processing,
+// so timeouts, circuit breakers and degraded modes can be validated in
+// staging. Rates are the share of requests, or of calls, that get a fault.
+type FaultInjectionConfig struct {
+	// Inject faults; never enable in production
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Latency added to classifier calls, in milliseconds
+	ClassificationLatencyMs int `yaml:"classification_latency_ms,omitempty"`
+
+	// Share of classifier calls delayed, defaults to 1 when a latency is set
+	ClassificationLatencyRate float64 `yaml:"classification_latency_rate,omitempty"`
+
+	// Share of semantic cache lookups and stores that fail
+	CacheErrorRate float64 `yaml:"cache_error_rate,omitempty"`
+
+	// Share of routed requests answered with a simulated upstream error
+	// instead of being forwarded
+	UpstreamErrorRate float64 `yaml:"upstream_error_rate,omitempty"`
+
+	// Status of simulated upstream errors, defaults to 503
+	UpstreamErrorStatus int `yaml:"upstream_error_status,omitempty"`
+}
+
+// CanaryConfig represents configuration for the in-process canary
+type CanaryConfig struct {
+	// Enable the canary
+	Enabled bool `yaml:"enabled"`
+
+	// Seconds between canary runs
+	IntervalSeconds int `yaml:"interval_seconds,omitempty"`
+
+	// Timeout of each canary check in seconds
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+
+	// URL the probes are also sent to, e.g. the Envoy listener, to check upstream health end to end
+	UpstreamURL string `yaml:"upstream_url,omitempty"`
+
+	// Known prompts and the routing outcome expected for each
+	Probes []CanaryProbe `yaml:"probes,omitempty"`
+}
+
+// CanaryProbe represents a known prompt sent by the canary
+type CanaryProbe struct {
+	Name   string `yaml:"name"`
+	Prompt string `yaml:"prompt"`
+	// Model requested by the probe, defaults to auto
+	Model string `yaml:"model,omitempty"`
+	// Model the probe must be routed to, not asserted when empty
+	ExpectedModel string `yaml:"expected_model,omitempty"`
+}
+
+// ResidencyConfig represents configuration for tenant data-residency policies
+type ResidencyConfig struct {
+	// Enable residency policies
+	Enabled bool `yaml:"enabled"`
+
+	// Header identifying the tenant of a request, defaults to x-tenant-id
+	TenantHeader string `yaml:"tenant_header,omitempty"`
+
+	// Per-tenant policies
+	Tenants []TenantPolicy `yaml:"tenants,omitempty"`
+}
+
+// TenantPolicy restricts a tenant to models carrying all of the required
+// compliance attributes, and to the categories it does not block
+type TenantPolicy struct {
+	Name               string   `yaml:"name"`
+	RequiredAttributes []string `yaml:"required_attributes,omitempty"`
+	// Categories the tenant's requests may not be about, answered with the
+	// category's block response
+	BlockedCategories []string `yaml:"blocked_categories,omitempty"`
+	// HTTP status returned when no qualifying model can serve the request: 403 (default) or 451
+	DenyStatus int `yaml:"deny_status,omitempty"`
+	// Most tokens the tenant's requests may generate; larger or missing
+	// max_tokens are lowered to it. 0 is unlimited.
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+	// Archive the tenant's redacted requests and responses to the
+	// compliance_archive sink, e.g. for a legal hold
+	ComplianceHold bool `yaml:"compliance_hold,omitempty"`
+}
+
+// ComplianceArchiveConfig represents the sink the conversations of tenants
+// under a compliance hold are archived to, a webhook or an S3 bucket
+type ComplianceArchiveConfig struct {
+	Webhook ArchiveWebhookConfig `yaml:"webhook,omitempty"`
+	S3      ArchiveS3Config      `yaml:"s3,omitempty"`
+
+	// Prepended to the key of every exchange, e.g. conversations/
+	Prefix string `yaml:"prefix,omitempty"`
+
+	// Exchanges waiting to be archived; exchanges beyond it are dropped,
+	// default 1000
+	QueueSize int `yaml:"queue_size,omitempty"`
+
+	// Timeout of archiving an exchange, default 10
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// ArchiveWebhookConfig represents a URL every archived exchange is posted to
+type ArchiveWebhookConfig struct {
+	URL string `yaml:"url,omitempty"`
+
+	// Environment variable holding the Authorization header value, if any
+	AuthorizationEnv string `yaml:"authorization_env,omitempty"`
+}
+
+// ArchiveS3Config represents an S3 bucket every archived exchange is put into
+// as an object
+type ArchiveS3Config struct {
+	Bucket string `yaml:"bucket,omitempty"`
+	Region string `yaml:"region,omitempty"`
+
+	// URL of an S3 compatible store, defaults to AWS S3 in the region
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Environment variables holding the credentials, default
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	AccessKeyIDEnv     string `yaml:"access_key_id_env,omitempty"`
+	SecretAccessKeyEnv string `yaml:"secret_access_key_env,omitempty"`
+	SessionTokenEnv    string `yaml:"session_token_env,omitempty"`
+}
+
+// GeoRoutingConfig represents configuration for client region based routing policies
+type GeoRoutingConfig struct {
+	// Enable geo routing policies
+	Enabled bool `yaml:"enabled"`
+
+	// Header carrying the client's region, set by a trusted edge; takes precedence over the client IP
+	RegionHeader string `yaml:"region_header,omitempty"`
+
+	// Header carrying the client IP chain, defaults to x-forwarded-for
+	ClientIPHeader string `yaml:"client_ip_header,omitempty"`
+
+	// Number of trusted proxies at the end of the client IP chain
+	TrustedProxyHops int `yaml:"trusted_proxy_hops,omitempty"`
+
+	// Client networks and the region they belong to
+	Networks []GeoNetwork `yaml:"networks,omitempty"`
+
+	// Policies restricting which models clients from a region may use
+	Policies []GeoPolicy `yaml:"policies,omitempty"`
+}
+
+// GeoNetwork maps a client network to a region
+type GeoNetwork struct {
+	CIDR   string `yaml:"cidr"`
+	Region string `yaml:"region"`
+}
+
+// GeoPolicy restricts clients from a region to models hosted in the allowed regions
+type GeoPolicy struct {
+	ClientRegion        string   `yaml:"client_region"`
+	AllowedModelRegions []string `yaml:"allowed_model_regions"`
+	// HTTP status returned when no allowed model can serve the request: 451 (default) or 403
+	DenyStatus int `yaml:"deny_status,omitempty"`
+}
+
+// StageRolloutConfig represents a gradual rollout of a pipeline stage
+type StageRolloutConfig struct {
+	// Share of traffic, 0-100, the stage applies to when the ramp starts
+	StartPercent float64 `yaml:"start_percent"`
+	// Share of traffic the stage applies to once the ramp completes
+	TargetPercent float64 `yaml:"target_percent"`
+	// When the ramp starts; defaults to router startup
+	RampStart time.Time `yaml:"ramp_start,omitempty"`
+	// Length of the linear ramp from start_percent to target_percent
+	RampDurationSeconds int `yaml:"ramp_duration_seconds,omitempty"`
+}
+
+// ListenerConfig represents an address the ext_proc server listens on
+type ListenerConfig struct {
+	// Network: tcp (IPv4 and IPv6), tcp4, tcp6 or unix; defaults to tcp
+	Network string `yaml:"network,omitempty"`
+
+	// Address: host:port for TCP, e.g. 127.0.0.1:50051 or [::1]:50051, or the
+	// socket path for unix
+	Address string `yaml:"address"`
+}
+
+// GRPCServerConfig represents tuning of the gRPC server serving ext_proc.
+// Zero leaves the gRPC default of each setting.
+type GRPCServerConfig struct {
+	// Largest message received, such as a request body chunk; gRPC defaults
+	// to 4 MiB
+	MaxRecvMessageBytes int `yaml:"max_recv_message_bytes,omitempty"`
+
+	// Largest message sent, such as a mutated body
+	MaxSendMessageBytes int `yaml:"max_send_message_bytes,omitempty"`
+
+	// Most streams open at once on a connection
+	MaxConcurrentStreams uint32 `yaml:"max_concurrent_streams,omitempty"`
+
+	// How long a connection is idle before the server pings it, and how long
+	// it waits for the ping's answer before closing the connection
+	KeepaliveTimeSeconds    int `yaml:"keepalive_time_seconds,omitempty"`
+	KeepaliveTimeoutSeconds int `yaml:"keepalive_timeout_seconds,omitempty"`
+
+	// Age after which connections are asked to reconnect, spreading Envoy's
+	// connections over replicas that were added, and how long their open
+	// streams may then finish before the connection is closed
+	MaxConnectionAgeSeconds      int `yaml:"max_connection_age_seconds,omitempty"`
+	MaxConnectionAgeGraceSeconds int `yaml:"max_connection_age_grace_seconds,omitempty"`
+}
+
+// ServerTLSConfig represents TLS of the ext_proc listeners. The certificate
+// files are reloaded when they change, so certificates can be rotated without
+// a restart.
+type ServerTLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PEM server certificate chain and private key
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+
+	// PEM CAs client certificates are verified against; without it client
+	// certificates are not requested
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+
+	// Reject clients presenting no certificate signed by the client CAs (mTLS).
+	// Without it, a client certificate is verified only if one is presented.
+	RequireClientCert bool `yaml:"require_client_cert,omitempty"`
+}
+
+// GracefulRestartConfig represents how a new router process takes over from
+// the running one without dropping streams
+type GracefulRestartConfig struct {
+	// Bind the TCP listeners and the admin API with SO_REUSEPORT, so a new
+	// process can bind the same addresses while the old one is still serving
+	ReusePort bool `yaml:"reuse_port,omitempty"`
+
+	// On SIGUSR2, start the binary again with the listening sockets handed
+	// over, and drain and exit once the new process is serving
+	Handoff bool `yaml:"handoff,omitempty"`
+
+	// How long to wait for the new process to start serving before giving up
+	// and keeping the old one; defaults to 300, enough to load the models
+	ReadyTimeoutSeconds int `yaml:"ready_timeout_seconds,omitempty"`
+}
+
+// ShutdownConfig represents how the router stops on SIGTERM or after a
+// handoff
+type ShutdownConfig struct {
+	// How long open streams may keep running once the router stops accepting
+	// new ones, after which they are closed; defaults to 30
+	DrainTimeoutSeconds int `yaml:"drain_timeout_seconds,omitempty"`
+
+	// File the metrics are written to in the Prometheus text format once
+	// streams drained and queued writes were flushed, so the last counts are
+	// kept after the final scrape; empty writes none
+	FinalMetricsPath string `yaml:"final_metrics_path,omitempty"`
+}
+
+// MetricsServerConfig represents the HTTP listener serving the Prometheus
+// metrics. The listener is not reconfigured on reload.
+type MetricsServerConfig struct {
+	// Serve the metrics; defaults to true
+	Enabled *bool `yaml:"enabled,omitempty"`
+
+	// Port the metrics are served on; defaults to the -metrics-port flag
+	Port int `yaml:"port,omitempty"`
+
+	// Path the metrics are served at; defaults to /metrics
+	Path string `yaml:"path,omitempty"`
+}
+
+// IsEnabled returns whether the metrics are served
+func (c MetricsServerConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// AdminConfig represents configuration for the admin HTTP API
+type AdminConfig struct {
+	// Port the admin API listens on; 0 disables the API
+	Port int `yaml:"port,omitempty"`
+
+	// Address of the interface the admin API listens on; defaults to 127.0.0.1.
+	// Addresses reachable from other hosts need token_env, since the API can
+	// switch off pipeline stages and flush the cache.
+	Address string `yaml:"address,omitempty"`
+
+	// Environment variable holding a bearer token required by every endpoint
+	// but /health and /readyz
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	// Decision records of this many recent requests are kept in memory for
+	// /decisions/recent; 0 keeps none
+	RecentDecisions int `yaml:"recent_decisions,omitempty"`
+
+	// Error responses of this many recent requests are kept in memory for
+	// /upstream/errors; 0 keeps none
+	RecentUpstreamErrors int `yaml:"recent_upstream_errors,omitempty"`
+
+	// Serve the gRPC channelz data of the ext_proc server and the router's
+	// client connections at /debug/channelz, and register the channelz service
+	// on the ext_proc port for tools such as grpcdebug
+	Channelz bool `yaml:"channelz,omitempty"`
+}
+
+// LoggingConfig represents the router's structured logs
+type LoggingConfig struct {
+	// Minimum level logged: debug, info, warn or error; defaults to info and
+	// is applied on config reload
+	Level string `yaml:"level,omitempty"`
+
+	// Output format, text or json; defaults to text
+	Format string `yaml:"format,omitempty"`
+
+	// Log the full request and response bodies at debug level. They may
+	// contain PII and credentials pasted into prompts.
+	LogPayloads bool `yaml:"log_payloads,omitempty"`
+}
+
+// TracingConfig represents the export of OpenTelemetry spans of the ext_proc
+// phases, continuing the trace of Envoy's traceparent header
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// OTLP gRPC collector address, default localhost:4317
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Export without TLS
+	Insecure bool `yaml:"insecure,omitempty"`
+
+	// Share of traces sampled when Envoy made no sampling decision, default 1
+	SampleRate *float64 `yaml:"sample_rate,omitempty"`
+
+	// Service name of the spans, default semantic-router
+	ServiceName string `yaml:"service_name,omitempty"`
+}
+
+// GetTracingSampleRate returns the effective share of traces sampled
+func (c *RouterConfig) GetTracingSampleRate() float64 {
+	if c.Tracing.SampleRate != nil {
+		return *c.Tracing.SampleRate
+	}
+	return 1
+}
+
+// DecisionRecordsConfig represents configuration for per-request routing decision records
+type DecisionRecordsConfig struct {
+	// Log a decision record as a JSON line for every completed request
+	Enabled bool `yaml:"enabled"`
+
+	// Record up to this many characters of the classified prompt, used to show
+	// example prompts when analyzing confused categories; 0 records none
+	PromptExcerptChars int `yaml:"prompt_excerpt_chars,omitempty"`
+
+	// Environment variable holding a base64 AES key of 16, 24 or 32 bytes;
+	// logged records are then encrypted with AES-GCM
+	EncryptionKeyEnv string `yaml:"encryption_key_env,omitempty"`
+
+	// Environment variable holding a base64 key; logged records are then
+	// signed with HMAC-SHA256
+	SigningKeyEnv string `yaml:"signing_key_env,omitempty"`
+}
+
+// WarmStartConfig represents replaying logged decision records at startup, so
+// a restarted router begins with the circuit state and application model
+// statistics of its predecessors instead of learning them from scratch
+type WarmStartConfig struct {
+	// Replay decision records at startup
+	Enabled bool `yaml:"enabled"`
+
+	// Files of decision records, bare JSON lines or router logs; sealed
+	// records are opened with the decision_records keys
+	Paths []string `yaml:"paths,omitempty"`
+
+	// Only records from the last this many hours are replayed, defaults to 24
+	MaxAgeHours float64 `yaml:"max_age_hours,omitempty"`
+
+	// Most recent records replayed, defaults to 100000
+	MaxRecords int `yaml:"max_records,omitempty"`
+}
+
+// BoilerplateFilterConfig represents configuration for stripping boilerplate from system prompts
+type BoilerplateFilterConfig struct {
+	// Enable stripping boilerplate from system prompts before classification
+	Enabled bool `yaml:"enabled"`
+
+	// Case-insensitive regular expressions stripped repeatedly from the start of
+	// system prompts; built-in assistant persona patterns are used when empty
+	PrefixPatterns []string `yaml:"prefix_patterns,omitempty"`
+
+	// Phrases removed anywhere in system prompts, case-insensitively
+	Phrases []string `yaml:"phrases,omitempty"`
+
+	// Sentences seen in at least this many system prompts are suppressed; 0 disables
+	CommonSentenceMinCount int `yaml:"common_sentence_min_count,omitempty"`
+
+	// Distinct sentences counted before rare ones are forgotten
+	CommonSentenceMaxTracked int `yaml:"common_sentence_max_tracked,omitempty"`
+}
+
+// PIIConfig represents configuration for detecting PII in requests with a
+// token classification model
+type PIIConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Token classification model labelling PII with BIO tags, e.g. B-EMAIL;
+	// without one PII is only detected by patterns
+	ModelID string `yaml:"model_id"`
+	UseCPU  bool   `yaml:"use_cpu"`
+	// Where model_id points: hub (default), local or oci
+	Source string `yaml:"source,omitempty"`
+	// Hub revision and expected file checksums used with model_download
+	Revision  string            `yaml:"revision,omitempty"`
+	Checksums map[string]string `yaml:"checksums,omitempty"`
+
+	// Minimum confidence of a detected entity (default 0.5)
+	Threshold float32 `yaml:"threshold,omitempty"`
+
+	// Handling of PII types by label without the BIO prefix, e.g. EMAIL
+	Types map[string]PIITypeConfig `yaml:"types,omitempty"`
+
+	// Action for types not listed: block, redact (default), tokenize or allow
+	DefaultAction string `yaml:"default_action,omitempty"`
+
+	// Let requests through unscanned when detection fails, rather than rejecting them
+	FailOpen bool `yaml:"fail_open,omitempty"`
+
+	// Regex patterns detecting PII in every request alongside the model
+	Patterns []PIIPatternConfig `yaml:"patterns,omitempty"`
+
+	// Additional patterns for the requests of a tenant, by tenant
+	TenantPatterns map[string][]PIIPatternConfig `yaml:"tenant_patterns,omitempty"`
+}
+
+// PIIPatternConfig represents a regex pattern detecting a type of PII
+type PIIPatternConfig struct {
+	// Type of the PII matched, e.g. SSN, handled like the model's types
+	Type string `yaml:"type"`
+
+	// Regular expression; the built-in one of EMAIL, SSN, CREDIT_CARD or
+	// IP_ADDRESS when empty
+	Regex string `yaml:"regex,omitempty"`
+}
+
+// PromptGuardConfig represents configuration for rejecting requests whose user
+// messages a classifier flags as jailbreak or prompt injection attempts
+type PromptGuardConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Sequence classifier trained like the category classifier
+	ModelID string `yaml:"model_id"`
+	UseCPU  bool   `yaml:"use_cpu"`
+	// Where model_id points: hub (default), local or oci
+	Source string `yaml:"source,omitempty"`
+	// Hub revision and expected file checksums used with model_download
+	Revision  string            `yaml:"revision,omitempty"`
+	Checksums map[string]string `yaml:"checksums,omitempty"`
+
+	// Mapping of the model's classes to labels, in the category mapping format
+	MappingPath string `yaml:"mapping_path"`
+
+	// Labels of the classes that are no attack (default ["benign"])
+	BenignLabels []string `yaml:"benign_labels,omitempty"`
+
+	// Minimum confidence of an attack class for a request to be rejected (default 0.7)
+	Threshold float32 `yaml:"threshold,omitempty"`
+
+	// Response to rejected requests, a 400 error by default. {{.Category}} is
+	// the detected label.
+	Response *ResponseTemplate `yaml:"response,omitempty"`
+
+	// Let requests through unchecked when classification fails, rather than rejecting them
+	FailOpen bool `yaml:"fail_open,omitempty"`
+}
+
+// ErrorBudgetsConfig represents configuration for disabling pipeline stages
+// whose error rate exceeds their budget. A disabled stage fails open for its
+// cool-down: classification routes to the default model, the cache is
+// skipped, and PII detection and the prompt guard let requests through.
+type ErrorBudgetsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Seconds over which error rates are measured, default 60
+	WindowSeconds int `yaml:"window_seconds,omitempty"`
+
+	// Budget per stage: classification, cache, pii or prompt_guard. Stages
+	// not listed are never disabled.
+	Stages map[string]StageErrorBudgetConfig `yaml:"stages,omitempty"`
+}
+
+// CircuitBreakerConfig represents configuration for routing around destination
+// models whose responses fail or slow down. Classified requests for a model
+// whose circuit is open go to the next model of the category's fallback chain.
+type CircuitBreakerConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Seconds over which error rates are measured, default 60
+	WindowSeconds int `yaml:"window_seconds,omitempty"`
+
+	// Fraction of responses in the window that may fail, default 0.5
+	MaxErrorRate float64 `yaml:"max_error_rate,omitempty"`
+
+	// Responses whose headers take longer count as failures, disabled when 0
+	MaxLatencyMs int `yaml:"max_latency_ms,omitempty"`
+
+	// Responses in the window needed before the rate is checked, default 20
+	MinRequests int `yaml:"min_requests,omitempty"`
+
+	// Seconds a circuit stays open before a trial request, default 30
+	CooldownSeconds int `yaml:"cooldown_seconds,omitempty"`
+}
+
+// DeterministicConfig represents configuration for routing identically run to
+// run. Random choices are drawn from a seeded source, and embeddings can be
+// served from recorded fixtures instead of the embedding model.
+type DeterministicConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Seed of the random choices: application model exploration, fault
+	// injection and the IDs of requests without an x-request-id
+	Seed uint64 `yaml:"seed,omitempty"`
+
+	// File of recorded embeddings, one {"hash", "embedding"} JSON object per
+	// line keyed by the SHA-256 of the text; texts without one fail to embed
+	EmbeddingFixtures string `yaml:"embedding_fixtures,omitempty"`
+
+	// Embed texts missing from the fixtures with the model and append them to
+	// the file, to generate fixtures
+	RecordFixtures bool `yaml:"record_fixtures,omitempty"`
+}
+
+// StageErrorBudgetConfig represents the error budget of one pipeline stage
+type StageErrorBudgetConfig struct {
+	// Fraction of calls in the window that may fail, default 0.5
+	MaxErrorRate float64 `yaml:"max_error_rate,omitempty"`
+
+	// Calls in the window needed before the rate is checked, default 20
+	MinCalls int `yaml:"min_calls,omitempty"`
+
+	// Seconds the stage stays disabled once over budget, default 30
+	CooldownSeconds int `yaml:"cooldown_seconds,omitempty"`
+}
+
+// PIITypeConfig represents the handling of one type of PII
+type PIITypeConfig struct {
+	// What to do with requests containing the type: block, redact, tokenize or allow
+	Action string `yaml:"action"`
+}
+
+// ClassificationBudgetConfig represents configuration for sampling long text before classification
+type ClassificationBudgetConfig struct {
+	// Sampling strategy: full, head_tail or system_and_last_user
+	Strategy string `yaml:"strategy,omitempty"`
+
+	// Text with more words than this is sampled; 0 disables sampling
+	MaxWords int `yaml:"max_words,omitempty"`
+
+	// Words kept from the start and end of the text by head_tail sampling,
+	// together at most max_words; an unset one gets what the other leaves
+	HeadWords int `yaml:"head_words,omitempty"`
+	TailWords int `yaml:"tail_words,omitempty"`
+}
+
+// TextChunkingConfig represents configuration for embedding and classifying long text in chunks
+type TextChunkingConfig struct {
+	// Enable chunking; otherwise long text is truncated by the model
+	Enabled bool `yaml:"enabled"`
+
+	// Maximum words per chunk, sized to stay under the model's max sequence length
+	ChunkWords int `yaml:"chunk_words,omitempty"`
+
+	// Words shared between consecutive chunks
+	OverlapWords int `yaml:"overlap_words,omitempty"`
+
+	// How chunk results are combined: mean or max
+	Pooling string `yaml:"pooling,omitempty"`
+}
+
+// DecisionBudgetConfig represents the time the router may add to a request
+// while deciding where to route it. Steps that no longer fit, based on their
+// average duration, are skipped or approximated.
+type DecisionBudgetConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Budget from the request body arriving to the routing decision, e.g. 25
+	BudgetMilliseconds int `yaml:"budget_ms"`
+}
+
+// ToolCallRoutingConfig represents how turns returning tool output are routed.
+// The model of each response making tool calls is remembered by tool call ID,
+// and the turn answering the calls goes to the same model without being
+// classified again.
+type ToolCallRoutingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Seconds a tool call is remembered after the response making it, default 600
+	TTLSeconds int `yaml:"ttl_seconds,omitempty"`
+}
+
+// ContextRoutingConfig represents how requests exceeding the context window of
+// the model they are routed to are redirected. The tokens a request needs, its
+// counted prompt tokens plus its generation limit, are checked against the
+// context_window of the routed model's config.
+type ContextRoutingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// How prompt tokens are counted: "chars" (default), about 4 characters per
+	// token, or "pretokens", splitting text into words, numbers and punctuation
+	// as BPE tokenizers do
+	TokenCounter string `yaml:"token_counter,omitempty"`
+}
+
+// SessionRoutingConfig represents how the turns of a conversation are routed.
+// The model each conversation was routed to is remembered, and later turns
+// keep going to it, so the upstream's KV cache stays warm, unless one is
+// confidently classified in another category.
+type SessionRoutingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Request header carrying the conversation ID; when absent the first system
+	// and user messages identify the conversation
+	SessionHeader string `yaml:"session_header,omitempty"`
+
+	// Seconds a conversation is remembered after its last turn, default 1800
+	TTLSeconds int `yaml:"ttl_seconds,omitempty"`
+
+	// Confidence from which a turn classified in another category than the
+	// conversation is routed anew, default 0.9
+	RerouteConfidence float32 `yaml:"reroute_confidence,omitempty"`
+}
+
+// ApplicationConfig represents an application recognized by the fixed system
+// prompt it sends, and the routing profile applied to its requests
+type ApplicationConfig struct {
+	Name string `yaml:"name"`
+
+	// Start of the application's system prompt
+	SystemPromptPrefix string `yaml:"system_prompt_prefix,omitempty"`
+
+	// Hex SHA-256 of the application's whole system prompt, without leading
+	// and trailing whitespace; matched before prefixes
+	SystemPromptSHA256 string `yaml:"system_prompt_sha256,omitempty"`
+
+	// Model the application's requests for the auto model are sent to, without
+	// classifying them
+	Model string `yaml:"model,omitempty"`
+
+	// Cache partition of the application's requests, so they are only answered
+	// with responses to the same partition; empty shares the cache
+	CachePartition string `yaml:"cache_partition,omitempty"`
+
+	// Requests per minute the application may send, fleet-wide per quota
+	// window when a coordinator is configured; 0 is unlimited
+	RequestsPerMinute int `yaml:"requests_per_minute,omitempty"`
+}
+
+// TenantsConfig represents the routing policies of the tenants sharing the
+// router, each with its own models, cache and token budgets
+type TenantsConfig struct {
+	// Header identifying the tenant of a request, default x-tenant-id
+	Header string `yaml:"header,omitempty"`
+
+	// Whether the header carries an API key, such as authorization, matched
+	// against the tenants' api_key_sha256 instead of naming the tenant; a
+	// "Bearer " prefix is ignored
+	HashedKeys bool `yaml:"hashed_keys,omitempty"`
+
+	Policies []TenantRoutingPolicy `yaml:"policies,omitempty"`
+}
+
+// TenantRoutingPolicy represents the routing policy of a tenant
+type TenantRoutingPolicy struct {
+	Name string `yaml:"name"`
+
+	// Hex SHA-256 of the tenant's API keys, with hashed_keys
+	APIKeySHA256 []string `yaml:"api_key_sha256,omitempty"`
+
+	// Model of the tenant's requests matching no category, instead of the
+	// router's default model
+	DefaultModel string `yaml:"default_model,omitempty"`
+
+	// Models of the tenant's requests by category, the first allowed one
+	// replacing the category's model
+	CategoryModels map[string][]string `yaml:"category_models,omitempty"`
+
+	// Skip the semantic cache for the tenant's requests, which are otherwise
+	// cached apart from other tenants'
+	DisableCache bool `yaml:"disable_cache,omitempty"`
+
+	// Prompt and completion tokens the tenant may use per hour and per UTC
+	// day, counted per replica; 0 is unlimited
+	HourlyTokens int64 `yaml:"hourly_tokens,omitempty"`
+	DailyTokens  int64 `yaml:"daily_tokens,omitempty"`
+}
+
+// ApplicationLearningConfig represents learning the best default model of each
+// application from the error rates, latency and feedback of its requests
+type ApplicationLearningConfig struct {
+	// Score the models serving each application and recommend defaults
+	// through the admin API
+	Enabled bool `yaml:"enabled"`
+
+	// Requests a model must have served an application before it is scored,
+	// defaults to 50
+	MinRequests int `yaml:"min_requests,omitempty"`
+
+	// Half-life of observations in hours; 0 keeps them at full weight
+	HalfLifeHours float64 `yaml:"half_life_hours,omitempty"`
+
+	// Score penalty per second of mean completion latency, defaults to 0.1
+	LatencyWeight float64 `yaml:"latency_weight,omitempty"`
+
+	// Score bonus of unanimously positive feedback, defaults to 0.5
+	FeedbackWeight float64 `yaml:"feedback_weight,omitempty"`
+
+	// Relative score improvement required to recommend another model,
+	// defaults to 0.05
+	MinImprovement float64 `yaml:"min_improvement,omitempty"`
+
+	// Share of the auto requests of applications with a model that are
+	// classified instead, so other models are observed, 0 to 1
+	ExploreRate float64 `yaml:"explore_rate,omitempty"`
+
+	// Route applications' requests to their recommended model instead of the
+	// configured one
+	AutoApply bool `yaml:"auto_apply,omitempty"`
+}
+
+// RoutingFeedbackConfig represents feedback posted by downstream systems on
+// routed requests through the admin API. Feedback evicts the request's cache
+// entry, and moves the routing threshold of its category within max_drift of
+// the configured one.
+type RoutingFeedbackConfig struct {
+	// Accept feedback and tune the category thresholds
+	Enabled bool `yaml:"enabled"`
+
+	// Threshold change per feedback, defaults to 0.01
+	Step float32 `yaml:"step,omitempty"`
+
+	// Most a threshold moves from the configured one either way, defaults to 0.1
+	MaxDrift float32 `yaml:"max_drift,omitempty"`
+
+	// Recent requests remembered for feedback, defaults to 10000
+	MaxTrackedRequests int `yaml:"max_tracked_requests,omitempty"`
+}
+
+// RequestStateConfig represents how the state kept across ext_proc streams is
+// expired. Each request's own state ends with its stream; pending cache
+// entries, retry attempts and tool calls outlive it and are swept periodically.
+type RequestStateConfig struct {
+	// Seconds a pending cache entry waits for its response before it is
+	// dropped, default 600
+	PendingTTLSeconds int `yaml:"pending_ttl_seconds,omitempty"`
+
+	// Seconds between sweeps of the expired state, default 60
+	SweepIntervalSeconds int `yaml:"sweep_interval_seconds,omitempty"`
+}
+
+// APIPathsConfig represents how the API endpoint of a request is detected from
+// its path, for gateways not serving the OpenAI paths at the root. Requests
+// to endpoints other than chat completions pass through without routing.
+type APIPathsConfig struct {
+	// Prefixes the API is mounted under, e.g. /llm for /llm/v1/images/generations
+	Prefixes []string `yaml:"prefixes,omitempty"`
+
+	// Path patterns assigned to endpoints, checked in order before the prefixes
+	Rules []APIPathRule `yaml:"rules,omitempty"`
+}
+
+// APIPathRule assigns requests whose path matches a regular expression to an
+// API endpoint, e.g. images/generations, audio/speech, batches,
+// chat_completions, completions or embeddings
+type APIPathRule struct {
+	Pattern  string `yaml:"pattern"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+// AnthropicMessagesConfig represents how requests to the Anthropic Messages API
+// (/v1/messages) are handled. They are routed and cached like chat
+// completions, and forwarded as they are unless translated.
+type AnthropicMessagesConfig struct {
+	// Translate requests to OpenAI chat completions, and their responses back,
+	// for models served by OpenAI-compatible backends
+	TranslateToOpenAI bool `yaml:"translate_to_openai,omitempty"`
+	// Models served by Messages API backends, whose requests are never translated
+	NativeModels []string `yaml:"native_models,omitempty"`
+}
+
+// BatchAccountingConfig represents how the usage of Batch API requests is
+// accounted. Requests to /v1/batches always pass through without
+// classification or caching; with accounting enabled, batches created through
+// the router are polled until they finish and the token usage in their output
+// file is attributed to the models that served it.
+type BatchAccountingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Base URL of the API serving the batches, e.g. https://api.openai.com
+	APIBase string `yaml:"api_base"`
+
+	// Environment variable holding the API key used to poll batches; without
+	// it, batches are polled with the credentials they were created with
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+
+	// Seconds between polls of the unfinished batches, default 300
+	PollIntervalSeconds int `yaml:"poll_interval_seconds,omitempty"`
+
+	// Hours after which unfinished batches are no longer polled, default 48
+	MaxAgeHours int `yaml:"max_age_hours,omitempty"`
+}
+
+// Strategies matching queries to categories
+const (
+	// RoutingStrategyClassifier maps queries to categories with the fine-tuned
+	// sequence classifier
+	RoutingStrategyClassifier = "classifier"
+	// RoutingStrategySimilarity matches queries against category utterances
+	// and descriptions by embedding similarity
+	RoutingStrategySimilarity = "similarity"
+)
+
+// RoutingConfig represents how queries are matched to categories
+type RoutingConfig struct {
+	// classifier or similarity; unset, the classifier is used when
+	// classifier.category_mapping_path is set
+	Strategy string `yaml:"strategy,omitempty"`
+
+	// How a model is picked among the matched category's models
+	ModelSelection ModelSelectionConfig `yaml:"model_selection,omitempty"`
+
+	// Headers clients may override routing with for a single request
+	Overrides RoutingOverridesConfig `yaml:"overrides,omitempty"`
+}
+
+// RoutingOverridesConfig represents the routing overrides clients may ask for
+// with request headers
+type RoutingOverridesConfig struct {
+	// Honor x-router-bypass: true, forwarding the request with the model it
+	// names, without classification or the semantic cache
+	AllowBypass bool `yaml:"allow_bypass,omitempty"`
+
+	// Honor x-cache-bypass: true, skipping the semantic cache
+	AllowCacheBypass bool `yaml:"allow_cache_bypass,omitempty"`
+
+	// Models requests may be pinned to with x-router-model instead of being
+	// classified; pins are ignored when empty
+	PinnableModels []string `yaml:"pinnable_models,omitempty"`
+}
+
+// Policies picking a model among the matched category's models
+const (
+	// ModelSelectionRanked picks the first ranked model
+	ModelSelectionRanked = "ranked"
+	// ModelSelectionCheapestAboveThreshold picks the cheapest model whose
+	// quality reaches the threshold
+	ModelSelectionCheapestAboveThreshold = "cheapest_above_threshold"
+	// ModelSelectionBestQuality picks the model of the highest quality
+	ModelSelectionBestQuality = "best_quality"
+	// ModelSelectionBalanced trades quality for cost, the more so the more
+	// confident the match
+	ModelSelectionBalanced = "balanced"
+)
+
+// ModelSelectionConfig represents how a model is picked among the matched
+// category's models, by their quality for the category and their cost
+type ModelSelectionConfig struct {
+	// ranked (default), cheapest_above_threshold, best_quality or balanced
+	Policy string `yaml:"policy,omitempty"`
+
+	// Quality a model needs to be picked by cheapest_above_threshold, default 0.7
+	QualityThreshold float64 `yaml:"quality_threshold,omitempty"`
+
+	// Weight of cost against quality for balanced, default 0.5
+	CostWeight float64 `yaml:"cost_weight,omitempty"`
+}
+
+// GetModelSelectionPolicy returns the effective model selection policy
+func (c *RouterConfig) GetModelSelectionPolicy() string {
+	if c.Routing.ModelSelection.Policy != "" {
+		return c.Routing.ModelSelection.Policy
+	}
+	return ModelSelectionRanked
+}
+
+// GetRoutingStrategy returns the effective strategy matching queries to categories
+func (c *RouterConfig) GetRoutingStrategy() string {
+	if c.Routing.Strategy != "" {
+		return c.Routing.Strategy
+	}
+	if c.Classifier.CategoryMappingPath != "" {
+		return RoutingStrategyClassifier
+	}
+	return RoutingStrategySimilarity
+}
+
+// GetClassifierThreshold returns the classifier confidence a query needs to be
+// routed to a category, the category's own threshold if it sets one
+func (c *RouterConfig) GetClassifierThreshold(category Category) float32 {
+	if category.ConfidenceThreshold != nil {
+		return *category.ConfidenceThreshold
+	}
+	return c.Classifier.Threshold
+}
+
+// StreamingConfig represents how streamed chat completions are handled.
+// Streamed responses are always reassembled into the completion they amount
+// to for token accounting and caching.
+type StreamingConfig struct {
+	// Answer streaming requests from the semantic cache, replaying the cached
+	// completion as server-sent events; otherwise they bypass the cache
+	ReplayCachedAsSSE bool `yaml:"replay_cached_as_sse"`
+}
+
+// ConfigReloadConfig represents how the config is reloaded while the server
+// runs. SIGHUP always reloads it; this only adds watching its files.
+type ConfigReloadConfig struct {
+	// Reload when the config file or any file it includes changes
+	WatchFiles bool `yaml:"watch_files"`
+
+	// Milliseconds to wait for further changes before reloading, default 500
+	DebounceMs int `yaml:"debounce_ms,omitempty"`
+}
+
+// ResponseBufferingConfig represents how much of a response body is buffered.
+// Beyond the limit the remaining chunks pass through unbuffered and the
+// response is neither scrubbed nor cached.
+type ResponseBufferingConfig struct {
+	// Maximum bytes buffered per response; defaults to 16 MiB
+	MaxBytes int `yaml:"max_bytes,omitempty"`
+}
+
+// RequestBufferingConfig represents how much of a request body Envoy streams
+// in chunks is buffered to reassemble it. Larger bodies pass through
+// unprocessed.
+type RequestBufferingConfig struct {
+	// Maximum bytes buffered per request; defaults to 16 MiB
+	MaxBytes int `yaml:"max_bytes,omitempty"`
+}
+
+// DecisionHeadersConfig represents the headers describing the routing decision
+// of a request: x-semantic-router-model, and x-semantic-router-category and
+// x-semantic-router-score for classified requests
+type DecisionHeadersConfig struct {
+	// Add them to the request sent upstream
+	Request bool `yaml:"request,omitempty"`
+
+	// Add them to the response returned to the client
+	Response bool `yaml:"response,omitempty"`
+}
+
+// Placements of routing receipts
+const (
+	// The x-semantic-router-receipt header of the request sent upstream and of
+	// the response
+	ReceiptPlacementHeader = "header"
+	// A semantic_router_receipt field added to JSON responses
+	ReceiptPlacementBody = "body"
+)
+
+// RoutingReceiptsConfig represents the signed receipts of routing decisions
+// (the selected model, category, estimated cost and timestamps) attached to
+// requests, for billing and audit proxies verifying them with a shared key
+type RoutingReceiptsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Environment variable holding the base64 HMAC-SHA256 key receipts are
+	// signed with
+	SigningKeyEnv string `yaml:"signing_key_env,omitempty"`
+	// header or body; defaults to header
+	Placement string `yaml:"placement,omitempty"`
+}
+
+// ProcessorMetadataConfig represents what the router advertises about itself
+// on every ext_proc stream: its version, the version of its contract with the
+// filter and its capabilities, as gRPC response headers and as dynamic
+// metadata of the first response. Streams whose route requires capabilities
+// the router lacks are refused, so Envoy can fail over or pass them through.
+type ProcessorMetadataConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+}
+
+// StreamLimitsConfig represents the limits of the bytes ext_proc streams
+// buffer: their request headers, request body and response body. A stream that
+// would exceed its limit or the server's budget passes the rest of its request
+// and response through unprocessed.
+type StreamLimitsConfig struct {
+	// Enable the limits
+	Enabled bool `yaml:"enabled"`
+
+	// Maximum bytes buffered per stream; defaults to 32 MiB
+	MaxStreamBytes int `yaml:"max_stream_bytes,omitempty"`
+
+	// Maximum bytes buffered by all streams together; defaults to 512 MiB
+	MaxTotalBytes int `yaml:"max_total_bytes,omitempty"`
+}
+
+// ResponseScrubbingConfig represents configuration for hiding which backend answered a request
+type ResponseScrubbingConfig struct {
+	// Enable response scrubbing
+	Enabled bool `yaml:"enabled"`
+
+	// Dotted paths of response body fields to remove, e.g. system_fingerprint
+	RemoveFields []string `yaml:"remove_fields,omitempty"`
+
+	// Response headers to remove; a trailing "*" matches a header name prefix
+	RemoveHeaders []string `yaml:"remove_headers,omitempty"`
+
+	// Replace the backend model name in responses
+	RewriteModel bool `yaml:"rewrite_model,omitempty"`
+
+	// Model name reported to clients; if empty the model the client requested is used
+	ModelAlias string `yaml:"model_alias,omitempty"`
+}
+
+// MutationTemplate describes request body field edits for enabling a feature on a model family
+type MutationTemplate struct {
+	// Values to set keyed by dotted field path; string values may use {{name}} placeholders
+	Set map[string]interface{} `yaml:"set,omitempty"`
+
+	// Dotted field paths to remove
+	Remove []string `yaml:"remove,omitempty"`
+}
+
+// AutoscaleConfig represents configuration for demand-based scale-up signaling
+type AutoscaleConfig struct {
+	// Enable scale-up signaling
+	Enabled bool `yaml:"enabled"`
+
+	// Webhook called with the target model when demand for a category is rising
+	WebhookURL string `yaml:"webhook_url"`
+
+	// Length of the window over which routing decisions are counted
+	WindowSeconds int `yaml:"window_seconds,omitempty"`
+
+	// Ratio of current to previous window decisions that counts as rising demand
+	GrowthFactor float64 `yaml:"growth_factor,omitempty"`
+
+	// Minimum decisions in the current window before a signal is sent
+	MinRequests int `yaml:"min_requests,omitempty"`
+
+	// Minimum time between signals for the same model
+	CooldownSeconds int `yaml:"cooldown_seconds,omitempty"`
+
+	// Timeout for webhook calls
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// BuiltinModelFamilies are the model families with built-in body mutation
+// templates; model_family_templates adds more
+var BuiltinModelFamilies = []string{"openai", "deepseek", "qwen3"}
+
+// ModelParams represents configuration for a single backend model
+type ModelParams struct {
+	// API family of the model, which decides the request fields used for features
+	// such as reasoning: openai (default), deepseek, qwen3 or a family of
+	// model_family_templates
+	Family string `yaml:"family,omitempty"`
+
+	// Reasoning mode requested from the model
+	Reasoning ModelReasoningConfig `yaml:"reasoning,omitempty"`
+
+	// Maintenance windows during which the model is excluded from routing
+	MaintenanceWindows []MaintenanceWindow `yaml:"maintenance_windows,omitempty"`
+
+	// Deprecation of the model, moving its traffic to a replacement until its sunset
+	Deprecation ModelDeprecationConfig `yaml:"deprecation,omitempty"`
+
+	// Scale-up webhook for this model's backend, overrides autoscale.webhook_url
+	ScaleUpWebhook string `yaml:"scale_up_webhook,omitempty"`
+
+	// Backend endpoints serving this model, possibly across regions and zones
+	Endpoints []ModelEndpoint `yaml:"endpoints,omitempty"`
+
+	// Region the model is hosted in, matched against geo routing policies (e.g. eu)
+	Region string `yaml:"region,omitempty"`
+
+	// Residency and compliance attributes of the model's deployment (e.g. eu-only, hipaa, on-prem)
+	Compliance []string `yaml:"compliance,omitempty"`
+
+	// Cost in USD per million prompt and completion tokens, for cost-aware
+	// model selection; unpriced models count as free
+	PromptCostPerMillion     float64 `yaml:"prompt_cost_per_million,omitempty"`
+	CompletionCostPerMillion float64 `yaml:"completion_cost_per_million,omitempty"`
+
+	// Context window of the model in tokens, which the prompt lengths of the
+	// categories routed to it and, with context routing, the requests routed
+	// to it are checked against; 0 is unknown
+	ContextWindow int `yaml:"context_window,omitempty"`
+
+	// Constraints on the generation parameters of requests forwarded to the
+	// model, by request field, for backends rejecting or mishandling some
+	Parameters map[string]ParameterConstraintConfig `yaml:"parameters,omitempty"`
+
+	// Values set on the generation parameters of requests forwarded to the
+	// model, by request field, e.g. a default temperature or stop sequences;
+	// applied before the parameter constraints
+	ParamOverrides map[string]ParamOverrideConfig `yaml:"param_overrides,omitempty"`
+}
+
+// ParamOverrideConfig represents a value set on a generation parameter of the
+// requests forwarded to a model. Requests setting the parameter keep their
+// value unless the override is forced or appended.
+type ParamOverrideConfig struct {
+	// Value of the parameter, any JSON value
+	Value interface{} `yaml:"value"`
 
-	// Categories for routing queries
-	Categories []Category `yaml:"categories"`
+	// Replace the value the request sets
+	Force bool `yaml:"force,omitempty"`
 
-	// Default LLM model to use if no match is found
-	DefaultModel string `yaml:"default_model"`
+	// Add the value, a string or a list, to the request's list, e.g. to add
+	// stop sequences to the request's
+	Append bool `yaml:"append,omitempty"`
+}
 
-	// Semantic cache configuration
-	SemanticCache SemanticCacheConfig `yaml:"semantic_cache"`
+// ParameterConstraintConfig represents a constraint on a generation parameter
+// of the requests forwarded to a model: the parameter is stripped, or clamped
+// to its bounds when it is a number
+type ParameterConstraintConfig struct {
+	Strip bool     `yaml:"strip,omitempty"`
+	Min   *float64 `yaml:"min,omitempty"`
+	Max   *float64 `yaml:"max,omitempty"`
+}
+
+// ModelReasoningConfig represents the reasoning mode requested from a model
+type ModelReasoningConfig struct {
+	// The model cannot reason, so no reasoning parameters are sent to it,
+	// whatever the category's reasoning_effort
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Reasoning effort requested when the category sets none: none, low,
+	// medium or high
+	Effort string `yaml:"effort,omitempty"`
+}
+
+// ModelDeprecationConfig represents the retirement of a model. From its
+// deprecation, clients are told it is deprecated and a growing share of its
+// traffic moves to the replacement, reaching all of it at the sunset.
+type ModelDeprecationConfig struct {
+	// When the model was deprecated; unset, it is not
+	Since time.Time `yaml:"since,omitempty"`
+
+	// When the model is retired: its requests go to the replacement, or are
+	// rejected without one. Unset, the model stays deprecated without a
+	// traffic schedule.
+	Sunset time.Time `yaml:"sunset,omitempty"`
+
+	// Model the traffic moves to
+	Replacement string `yaml:"replacement,omitempty"`
+}
+
+// Deprecated returns whether the model is deprecated at the given time
+func (d ModelDeprecationConfig) Deprecated(now time.Time) bool {
+	return !d.Since.IsZero() && !now.Before(d.Since)
+}
+
+// Retired returns whether the model is past its sunset at the given time
+func (d ModelDeprecationConfig) Retired(now time.Time) bool {
+	return d.Deprecated(now) && !d.Sunset.IsZero() && !now.Before(d.Sunset)
+}
+
+// ShiftedShare returns the share of the model's traffic moved to the
+// replacement at the given time, growing linearly from 0 at the deprecation
+// to 1 at the sunset
+func (d ModelDeprecationConfig) ShiftedShare(now time.Time) float64 {
+	switch {
+	case !d.Deprecated(now) || d.Replacement == "" || d.Sunset.IsZero():
+		return 0
+	case d.Retired(now):
+		return 1
+	}
+	return float64(now.Sub(d.Since)) / float64(d.Sunset.Sub(d.Since))
+}
+
+// GetModelDeprecation returns the deprecation of a model, and whether it is
+// deprecated at the given time
+func (c *RouterConfig) GetModelDeprecation(model string, now time.Time) (ModelDeprecationConfig, bool) {
+	deprecation := c.ModelConfig[model].Deprecation
+	return deprecation, deprecation.Deprecated(now)
+}
+
+// ModelEndpoint represents a single backend endpoint serving a model
+type ModelEndpoint struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"` // host:port used by Envoy to reach the endpoint
+	Region  string `yaml:"region,omitempty"`
+	Zone    string `yaml:"zone,omitempty"`
+
+	// Maintenance windows during which the endpoint is excluded from routing
+	MaintenanceWindows []MaintenanceWindow `yaml:"maintenance_windows,omitempty"`
+}
+
+// IsInMaintenance returns whether the endpoint is inside one of its maintenance windows at the given time
+func (e ModelEndpoint) IsInMaintenance(now time.Time) bool {
+	for _, window := range e.MaintenanceWindows {
+		if window.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// EndpointSelectionConfig represents configuration for locality-aware endpoint selection
+type EndpointSelectionConfig struct {
+	// Region and zone this router instance runs in
+	Region string `yaml:"region,omitempty"`
+	Zone   string `yaml:"zone,omitempty"`
+
+	// Consecutive upstream failures before an endpoint is marked unhealthy
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+
+	// Seconds an unhealthy endpoint is excluded before it is tried again
+	CooldownSeconds int `yaml:"cooldown_seconds,omitempty"`
+
+	// Consistent mapping of sessions to endpoints for prefix-cache affinity
+	SessionAffinity SessionAffinityConfig `yaml:"session_affinity,omitempty"`
+
+	// Preference for endpoints that recently served the prompt's prefix
+	PrefixAffinity PrefixAffinityConfig `yaml:"prefix_affinity,omitempty"`
+}
+
+// LoadAwareRoutingConfig represents how the load metrics of model endpoints
+// are polled and weighed when picking among the models of a category
+type LoadAwareRoutingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Path of the endpoints' Prometheus metrics, default /metrics
+	MetricsPath string `yaml:"metrics_path,omitempty"`
+
+	// Seconds between polls, default 5, and timeout of a poll, default 2
+	PollIntervalSeconds int `yaml:"poll_interval_seconds,omitempty"`
+	TimeoutSeconds      int `yaml:"timeout_seconds,omitempty"`
+
+	// Seconds after which an endpoint's metrics are no longer used, default
+	// three poll intervals
+	MaxAgeSeconds int `yaml:"max_age_seconds,omitempty"`
+
+	// Consecutive failed polls before an endpoint's metrics are ignored, default 3
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+
+	// Weights of queued requests, running requests and KV-cache usage (0 to 1)
+	// in an endpoint's load score, default 1, 0.1 and 10 when none is set
+	QueueWeight   float64 `yaml:"queue_weight,omitempty"`
+	RunningWeight float64 `yaml:"running_weight,omitempty"`
+	KVCacheWeight float64 `yaml:"kv_cache_weight,omitempty"`
+
+	// How much lower another model's load score must be for it to be picked
+	// instead of the semantically chosen model, default 1
+	Tolerance float64 `yaml:"tolerance,omitempty"`
+}
+
+// PrefixAffinityConfig represents configuration for prefix-cache-aware endpoint scoring
+type PrefixAffinityConfig struct {
+	// Enable prefix-cache-aware endpoint scoring
+	Enabled bool `yaml:"enabled"`
+
+	// Number of prompt characters per prefix block
+	BlockSize int `yaml:"block_size,omitempty"`
+
+	// Maximum prefix blocks remembered per endpoint
+	MaxBlocksPerEndpoint int `yaml:"max_blocks_per_endpoint,omitempty"`
+
+	// Seconds a served prefix is assumed to remain in the endpoint's KV cache
+	TTLSeconds int `yaml:"ttl_seconds,omitempty"`
+}
+
+// SessionAffinityConfig represents configuration for session-to-endpoint affinity
+type SessionAffinityConfig struct {
+	// Enable consistent hashing of sessions to endpoints
+	Enabled bool `yaml:"enabled"`
+
+	// Request header carrying the session ID; if absent the conversation prefix is hashed
+	SessionHeader string `yaml:"session_header,omitempty"`
+
+	// Header set on the upstream request for Envoy's ring hash or maglev load balancer
+	HashHeader string `yaml:"hash_header,omitempty"`
+}
+
+// GetModelEndpoints returns the configured endpoints for every model that has any
+func (c *RouterConfig) GetModelEndpoints() map[string][]ModelEndpoint {
+	result := make(map[string][]ModelEndpoint)
+	for model, params := range c.ModelConfig {
+		if len(params.Endpoints) > 0 {
+			result[model] = params.Endpoints
+		}
+	}
+	return result
+}
+
+// MaintenanceWindow represents a scheduled period during which a model is out of service
+type MaintenanceWindow struct {
+	Start  time.Time `yaml:"start"`
+	End    time.Time `yaml:"end,omitempty"` // Zero value means the window has no scheduled end
+	Reason string    `yaml:"reason,omitempty"`
+}
+
+// Contains returns whether the given time falls within the maintenance window
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	if t.Before(w.Start) {
+		return false
+	}
+	return w.End.IsZero() || t.Before(w.End)
+}
+
+// IsModelInMaintenance returns whether the model is inside one of its maintenance windows at the given time
+func (c *RouterConfig) IsModelInMaintenance(model string, now time.Time) bool {
+	params, ok := c.ModelConfig[model]
+	if !ok {
+		return false
+	}
+	for _, window := range params.MaintenanceWindows {
+		if window.Contains(now) {
+			return true
+		}
+	}
+	return false
 }
 
 // SemanticCacheConfig represents configuration for the semantic cache
@@ -49,6 +1828,304 @@ type SemanticCacheConfig struct {
 
 	// Time-to-live for cache entries in seconds (0 means no expiration)
 	TTLSeconds int `yaml:"ttl_seconds,omitempty"`
+
+	// Entries the memory backend evicts first when over max_entries or
+	// max_memory_bytes: "fifo" (default, oldest), "lru" or "lfu"
+	EvictionPolicy string `yaml:"eviction_policy,omitempty"`
+
+	// Estimated memory the entries of the memory backend may take (0 means no limit)
+	MaxMemoryBytes int64 `yaml:"max_memory_bytes,omitempty"`
+
+	// Seconds between background removals of expired entries of the memory
+	// backend (default 60)
+	EvictionIntervalSeconds int `yaml:"eviction_interval_seconds,omitempty"`
+
+	// Epoch partitioning the cache; entries cached under another epoch are never returned.
+	// Change it when a change to prompts or routing makes cached answers stale.
+	Epoch string `yaml:"epoch,omitempty"`
+
+	// Derive the epoch from a hash of the routing config, so any routing change starts a new epoch
+	EpochFromConfig bool `yaml:"epoch_from_config,omitempty"`
+
+	// Let upstreams set how long their responses are cached with an
+	// x-semantic-cache-ttl header or Cache-Control, including not caching them
+	HonorUpstreamTTL bool `yaml:"honor_upstream_ttl,omitempty"`
+
+	// Upper bound of TTLs set by upstreams in seconds (0 means no bound)
+	MaxUpstreamTTLSeconds int `yaml:"max_upstream_ttl_seconds,omitempty"`
+
+	// Backend storing cache entries: "memory" (default) or "redis"
+	Backend string `yaml:"backend,omitempty"`
+
+	// Redis server of the redis backend
+	Redis RedisCacheConfig `yaml:"redis,omitempty"`
+
+	// Pre-filter skipping lookups of queries unlike any cached one
+	Prefilter CachePrefilterConfig `yaml:"prefilter,omitempty"`
+
+	// Normalization of queries before they are embedded for the cache
+	Normalization CacheNormalizationConfig `yaml:"normalization,omitempty"`
+
+	// Completed entries waiting to be embedded and stored in the background
+	// before new ones are dropped (default 1024)
+	WriteQueueSize int `yaml:"write_queue_size,omitempty"`
+
+	// Goroutines storing queued entries (default 1)
+	WriteWorkers int `yaml:"write_workers,omitempty"`
+
+	// Embed and store completed entries inline in the response path instead
+	SyncWrites bool `yaml:"sync_writes,omitempty"`
+
+	// Scan every entry on lookups instead of searching the HNSW index of the memory backend
+	ExactSearch bool `yaml:"exact_search,omitempty"`
+
+	// HNSW index of the memory backend
+	Index CacheIndexConfig `yaml:"index,omitempty"`
+
+	// Snapshots of the memory backend's entries on disk, loaded on startup
+	Snapshot CacheSnapshotConfig `yaml:"snapshot,omitempty"`
+}
+
+// CacheSnapshotConfig represents the snapshots of the cache entries of the
+// memory backend, keeping the hit rate up across restarts
+type CacheSnapshotConfig struct {
+	// File the entries are written to; no snapshots when empty
+	Path string `yaml:"path,omitempty"`
+
+	// Seconds between snapshots (default 300); one is also written on shutdown
+	IntervalSeconds int `yaml:"interval_seconds,omitempty"`
+
+	// Estimated size of the entries written, the newest kept (0 means no limit)
+	MaxBytes int64 `yaml:"max_bytes,omitempty"`
+}
+
+// CacheIndexConfig represents the HNSW index the memory backend searches for
+// the most similar entry, trading exact results for lookups that stay fast as
+// the cache grows
+type CacheIndexConfig struct {
+	// Neighbors linked per entry (default 16)
+	M int `yaml:"m,omitempty"`
+
+	// Candidates considered when inserting an entry (default 100)
+	EfConstruction int `yaml:"ef_construction,omitempty"`
+
+	// Candidates considered on lookups (default 64); higher finds the most
+	// similar entry more reliably at the cost of latency
+	EfSearch int `yaml:"ef_search,omitempty"`
+}
+
+// CachePrefilterConfig represents the semantic cache's lookup pre-filter,
+// which skips computing an embedding for queries sharing too few words with
+// any cached query of their model
+type CachePrefilterConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Fraction of a query's words that must occur in cached queries for the lookup to run (default 0.3)
+	MinOverlap float64 `yaml:"min_overlap,omitempty"`
+
+	// Entries remembered per generation of the filter (default max_entries, else 10000)
+	Capacity int `yaml:"capacity,omitempty"`
+
+	// Probability of a word wrongly looking cached (default 0.01)
+	FalsePositiveRate float64 `yaml:"false_positive_rate,omitempty"`
+}
+
+// CacheNormalizationConfig represents the normalization of queries before
+// they are embedded for cache lookups and entries, so trivially different
+// phrasings match. Routing classifies queries as sent.
+type CacheNormalizationConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Lowercase queries
+	Lowercase bool `yaml:"lowercase,omitempty"`
+
+	// Expand contractions, e.g. "what's" into "what is"
+	ExpandContractions bool `yaml:"expand_contractions,omitempty"`
+
+	// Separate punctuation and symbols from words and collapse whitespace
+	CollapseWhitespace bool `yaml:"collapse_whitespace,omitempty"`
+
+	// Remove punctuation, keeping symbols such as + and =
+	StripPunctuation bool `yaml:"strip_punctuation,omitempty"`
+
+	// Remove stopwords, a short list of English ones unless stopwords is set
+	RemoveStopwords bool     `yaml:"remove_stopwords,omitempty"`
+	Stopwords       []string `yaml:"stopwords,omitempty"`
+
+	// Template variables replaced by a __name__ placeholder before the other
+	// steps
+	Masks []CacheMaskConfig `yaml:"masks,omitempty"`
+
+	// Also look queries up as sent, counting how often each form hits in
+	// llm_cache_normalization_comparisons_total; costs a second embedding
+	CompareRaw bool `yaml:"compare_raw,omitempty"`
+}
+
+// CacheMaskConfig represents a template variable masked in queries
+type CacheMaskConfig struct {
+	// Name of the variable
+	Name string `yaml:"name"`
+
+	// Regular expression; the built-in one of number, email, url or uuid
+	// when empty
+	Regex string `yaml:"regex,omitempty"`
+}
+
+// TokenBudgetsConfig represents the hourly and daily token budgets of client
+// identities. The prompt and completion tokens of responses are counted
+// against the client's budgets, and requests of clients that used one up are
+// rejected with 429 until its period ends.
+type TokenBudgetsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Request header identifying the client, e.g. x-api-key or x-user-id;
+	// requests without it are not budgeted
+	IdentityHeader string `yaml:"identity_header"`
+
+	// Tokens a client may use per hour and per UTC day, 0 is unlimited
+	HourlyTokens int64 `yaml:"hourly_tokens,omitempty"`
+	DailyTokens  int64 `yaml:"daily_tokens,omitempty"`
+
+	// Budgets of specific clients, replacing the ones above
+	Identities []TokenBudgetIdentityConfig `yaml:"identities,omitempty"`
+
+	// Redis server sharing the counters across replicas; without an address
+	// each replica counts in memory
+	Redis RedisCacheConfig `yaml:"redis,omitempty"`
+}
+
+// TenantMetricsConfig represents the per-tenant request and token metrics and
+// the scope of the tenant label of every tenant-labeled metric, bounding
+// their cardinality while keeping selected tenants visible on their own
+type TenantMetricsConfig struct {
+	// Export request and token counts per tenant
+	Enabled bool `yaml:"enabled"`
+
+	// Request header identifying the tenant, defaults to residency.tenant_header
+	// when residency is enabled, x-tenant-id otherwise
+	TenantHeader string `yaml:"tenant_header,omitempty"`
+
+	// Tenants reported under their own label, the others together under
+	// other_label; every tenant is labeled on its own when empty
+	LabeledTenants []string `yaml:"labeled_tenants,omitempty"`
+
+	// Label of the tenants not labeled on their own, defaults to other
+	OtherLabel string `yaml:"other_label,omitempty"`
+
+	// Tenants left out of tenant-labeled metrics, e.g. synthetic traffic
+	ExcludedTenants []string `yaml:"excluded_tenants,omitempty"`
+}
+
+// RequestTagConfig represents a request header whose value tags the request
+// in the llm_tagged_* metrics and the labels of its decision record
+type RequestTagConfig struct {
+	// Name of the tag, e.g. team
+	Name string `yaml:"name"`
+
+	// Request header carrying the value, e.g. x-team
+	Header string `yaml:"header"`
+
+	// Values reported on their own, bounding the cardinality of the metrics;
+	// any other value is reported as other_value
+	AllowedValues []string `yaml:"allowed_values"`
+
+	// Value reported for values not allowed, defaults to other
+	OtherValue string `yaml:"other_value,omitempty"`
+}
+
+// TokenBudgetIdentityConfig represents the token budgets of a client
+type TokenBudgetIdentityConfig struct {
+	// Value of the identity header
+	Identity string `yaml:"identity"`
+
+	// Tokens the client may use per hour and per UTC day, 0 is unlimited
+	HourlyTokens int64 `yaml:"hourly_tokens,omitempty"`
+	DailyTokens  int64 `yaml:"daily_tokens,omitempty"`
+}
+
+// RedisCacheConfig represents a Redis server, storing semantic cache entries
+// or token budget counters
+type RedisCacheConfig struct {
+	// Address of the server, host:port
+	Address string `yaml:"address"`
+
+	// Environment variable holding the server's password, if any
+	PasswordEnv string `yaml:"password_env,omitempty"`
+
+	// Database number
+	DB int `yaml:"db,omitempty"`
+
+	// Prefix of the keys written, so routers with different caches or budgets can share a server
+	KeyPrefix string `yaml:"key_prefix,omitempty"`
+
+	// Timeout of a single cache operation in milliseconds (default 1000)
+	TimeoutMs int `yaml:"timeout_ms,omitempty"`
+}
+
+// GetCacheEpoch returns the effective cache epoch, combining the configured
+// epoch, if enabled the routing config hash, and with query normalization a
+// hash of its steps
+func (c *RouterConfig) GetCacheEpoch() string {
+	epoch := c.SemanticCache.Epoch
+	if c.SemanticCache.EpochFromConfig {
+		if epoch != "" {
+			epoch += "-"
+		}
+		epoch += c.RoutingHash()
+	}
+	// Entries embedded with other normalization steps can't be compared
+	if normalization := c.SemanticCache.Normalization; normalization.Enabled {
+		normalization.CompareRaw = false
+		if data, err := yaml.Marshal(normalization); err == nil {
+			sum := sha256.Sum256(data)
+			if epoch != "" {
+				epoch += "-"
+			}
+			epoch += "n" + hex.EncodeToString(sum[:4])
+		}
+	}
+	return epoch
+}
+
+// GetCacheWriteQueueSize returns the size of the semantic cache's write queue,
+// 0 when entries are stored inline
+func (c *RouterConfig) GetCacheWriteQueueSize() int {
+	if c.SemanticCache.SyncWrites {
+		return 0
+	}
+	if c.SemanticCache.WriteQueueSize <= 0 {
+		return 1024
+	}
+	return c.SemanticCache.WriteQueueSize
+}
+
+// Hash returns the SHA-256 of the whole loaded config
+func (c *RouterConfig) Hash() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		log.Printf("Error hashing config: %v", err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// RoutingHash returns a short hash of the config that decides which model answers
+// a request and how the request is shaped
+func (c *RouterConfig) RoutingHash() string {
+	data, err := yaml.Marshal(struct {
+		Categories           []Category                             `yaml:"categories"`
+		DefaultModel         string                                 `yaml:"default_model"`
+		ModelConfig          map[string]ModelParams                 `yaml:"model_config"`
+		ModelFamilyTemplates map[string]map[string]MutationTemplate `yaml:"model_family_templates"`
+		Applications         []ApplicationConfig                    `yaml:"applications,omitempty"`
+	}{c.Categories, c.DefaultModel, c.ModelConfig, c.ModelFamilyTemplates, c.Applications})
+	if err != nil {
+		log.Printf("Error hashing routing config: %v", err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
 }
 
 // GetCacheSimilarityThreshold returns the effective threshold for the semantic cache
@@ -60,14 +2137,128 @@ func (c *RouterConfig) GetCacheSimilarityThreshold() float32 {
 }
 
 // Category represents a category for routing queries
+// LanguageModel is the similarity model matching queries of a language
+// against category utterances
+type LanguageModel struct {
+	ModelID string `yaml:"model_id"`
+	// Similarity needed to route to a category, overriding bert_model.threshold
+	Threshold float32 `yaml:"threshold,omitempty"`
+	// Where model_id points: hub (default), local or oci
+	Source string `yaml:"source,omitempty"`
+	// Hub revision and expected file checksums used with model_download
+	Revision  string            `yaml:"revision,omitempty"`
+	Checksums map[string]string `yaml:"checksums,omitempty"`
+}
+
 type Category struct {
 	Name        string   `yaml:"name"`
 	Description string   `yaml:"description,omitempty"`
 	Models      []string `yaml:"models"` // Ranked list of LLM models
+	// Models retries of a request fall back to, in order, once the selected
+	// model's backend answered an earlier attempt with 429 or 5xx
+	Fallbacks []string `yaml:"fallbacks,omitempty"`
+	// Quality in [0, 1] of models for the category, for cost-aware model
+	// selection. Unscored models are scored by rank, from 1 for the first down
+	// to 1/n for the last of n models.
+	Quality map[string]float64 `yaml:"quality,omitempty"`
+	// Classifier confidence needed to route to this category, overriding classifier.threshold
+	ConfidenceThreshold *float32 `yaml:"confidence_threshold,omitempty"`
+	// Reasoning effort requested from the selected model: none, low, medium or high
+	ReasoningEffort string `yaml:"reasoning_effort,omitempty"`
+	// System prompt added to requests routed by the category
+	SystemPrompt string `yaml:"system_prompt,omitempty"`
+	// How the system prompt is added: insert (default) puts it before the
+	// client's messages, replace drops the client's system messages
+	SystemPromptMode string `yaml:"system_prompt_mode,omitempty"`
+	// Example queries keyed by ISO 639-1 language code, matched by similarity
+	// against queries in that language when no classifier is configured
+	Utterances map[string][]string `yaml:"utterances,omitempty"`
+	// Task descriptions keyed by ISO 639-1 language code, matched instead of
+	// the description against queries in a language without utterances
+	Descriptions map[string]string `yaml:"descriptions,omitempty"`
+	// Weighted split of the category's traffic between models, e.g. to send
+	// 5% of it to a new model during a rollout; replaces the model selection
+	// of requests classified into the category
+	TrafficSplit []WeightedModel `yaml:"traffic_split,omitempty"`
+	// Block requests classified into the category for every tenant
+	Blocked bool `yaml:"blocked,omitempty"`
+	// Response returned instead of routing requests of the category when it is
+	// blocked, for everyone or by a tenant policy
+	BlockResponse *ResponseTemplate `yaml:"block_response,omitempty"`
+}
+
+// WeightedModel represents a model's share of a category's traffic split
+type WeightedModel struct {
+	Model string `yaml:"model"`
+	// Share of the traffic relative to the other models' weights
+	Weight float64 `yaml:"weight"`
+	// Group the model's requests are labeled with in metrics, e.g. canary or
+	// stable; the model name when empty
+	Group string `yaml:"group,omitempty"`
+}
+
+// ResponseTemplate represents a response the router returns itself. Message,
+// header values and body are Go templates with the variables {{.Category}},
+// {{.RequestID}}, {{.Tenant}} and {{.Model}}.
+type ResponseTemplate struct {
+	// HTTP status, defaults to 403
+	Status int `yaml:"status,omitempty"`
+	// Headers set on the response in addition to content-type
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Message returned in an OpenAI-style body: a chat completion whose
+	// assistant reply is the message for 2xx statuses, an error otherwise
+	Message string `yaml:"message,omitempty"`
+	// Exact JSON body, taking precedence over message. Variables are
+	// JSON-escaped, so they can be used inside strings.
+	Body string `yaml:"body,omitempty"`
+}
+
+// GetReasoningEffortForCategory returns the reasoning effort configured for the named category
+func (c *RouterConfig) GetReasoningEffortForCategory(categoryName string) string {
+	for _, category := range c.Categories {
+		if category.Name == categoryName {
+			return category.ReasoningEffort
+		}
+	}
+	return ""
+}
+
+// GetSystemPromptForCategory returns the system prompt configured for the named
+// category and how it is added to requests
+func (c *RouterConfig) GetSystemPromptForCategory(categoryName string) (prompt, mode string) {
+	for _, category := range c.Categories {
+		if category.Name == categoryName {
+			return category.SystemPrompt, category.SystemPromptMode
+		}
+	}
+	return "", ""
+}
+
+// GetReasoningEffort returns the reasoning effort requested from a model for
+// a request of the named category: the category's, else the model's default,
+// and none at all from models that cannot reason
+func (c *RouterConfig) GetReasoningEffort(categoryName, model string) string {
+	reasoning := c.ModelConfig[model].Reasoning
+	if reasoning.Disabled {
+		return ""
+	}
+	if effort := c.GetReasoningEffortForCategory(categoryName); effort != "" {
+		return effort
+	}
+	return reasoning.Effort
+}
+
+// GetModelFamily returns the API family of the model, defaulting to openai
+func (c *RouterConfig) GetModelFamily(model string) string {
+	if params, ok := c.ModelConfig[model]; ok && params.Family != "" {
+		return params.Family
+	}
+	return "openai"
 }
 
 var (
 	config     *RouterConfig
+	configMu   sync.RWMutex
 	configOnce sync.Once
 	configErr  error
 )
@@ -75,27 +2266,71 @@ var (
 // LoadConfig loads the configuration from the specified YAML file
 func LoadConfig(configPath string) (*RouterConfig, error) {
 	configOnce.Do(func() {
-		data, err := os.ReadFile(configPath)
-		if err != nil {
-			configErr = fmt.Errorf("failed to read config file: %w", err)
-			return
+		cfg, err := readConfig(configPath)
+		if err == nil && len(cfg.Sources) > 1 {
+			log.Printf("Composed config from %s", strings.Join(cfg.Sources, ", "))
 		}
-
-		config = &RouterConfig{}
-		if err := yaml.Unmarshal(data, config); err != nil {
-			configErr = fmt.Errorf("failed to parse config file: %w", err)
-			return
+		if err == nil {
+			err = cfg.checkUnknownKeys(UnknownKeysWarn)
 		}
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			cfg = nil
+		}
+		configMu.Lock()
+		config, configErr = cfg, err
+		configMu.Unlock()
 	})
 
 	if configErr != nil {
 		return nil, configErr
 	}
-	return config, nil
+	return GetConfig(), nil
+}
+
+// ReloadConfig reads the configuration from the specified YAML file again,
+// making it the current configuration unless it can't be read or is invalid
+func ReloadConfig(configPath string) (*RouterConfig, error) {
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkUnknownKeys(UnknownKeysWarn); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	configMu.Lock()
+	config = cfg
+	configMu.Unlock()
+	return cfg, nil
+}
+
+// ValidateConfig reads the configuration from the specified YAML file without
+// making it the current configuration, rejecting unknown keys unless the
+// config sets unknown_keys itself. An invalid config is returned along with
+// its *ValidationError.
+func ValidateConfig(configPath string) (*RouterConfig, error) {
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkUnknownKeys(UnknownKeysError); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
 }
 
 // GetConfig returns the current configuration
 func GetConfig() *RouterConfig {
+	configMu.RLock()
+	defer configMu.RUnlock()
 	return config
 }
 
@@ -113,17 +2348,184 @@ func (c *RouterConfig) GetCategoryDescriptions() []string {
 	return descriptions
 }
 
+// HasCategoryUtterances returns whether any category has example utterances
+// or descriptions in a language
+func (c *RouterConfig) HasCategoryUtterances() bool {
+	for _, category := range c.Categories {
+		if len(category.Utterances) > 0 || len(category.Descriptions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCategoryUtterances returns the texts matched against a query in the given
+// language and the index of the category each text belongs to. Categories use
+// their utterances in that language, or their description in it, or their
+// description when they have neither. With a multilingual model, utterances of
+// every language are used.
+func (c *RouterConfig) GetCategoryUtterances(language string) ([]string, []int) {
+	var texts []string
+	var categories []int
+	descriptions := c.GetCategoryDescriptions()
+	for i, category := range c.Categories {
+		var utterances []string
+		if c.BertModel.Multilingual {
+			languages := make([]string, 0, len(category.Utterances))
+			for lang := range category.Utterances {
+				languages = append(languages, lang)
+			}
+			sort.Strings(languages)
+			for _, lang := range languages {
+				utterances = append(utterances, category.Utterances[lang]...)
+			}
+		} else {
+			utterances = category.Utterances[language]
+		}
+		if len(utterances) == 0 {
+			if description, ok := category.Descriptions[language]; ok && description != "" {
+				utterances = []string{description}
+			} else {
+				utterances = []string{descriptions[i]}
+			}
+		}
+		for _, utterance := range utterances {
+			texts = append(texts, utterance)
+			categories = append(categories, i)
+		}
+	}
+	return texts, categories
+}
+
+// GetLanguageModel returns the similarity model configured for queries in the
+// language, if any
+func (c *RouterConfig) GetLanguageModel(language string) (LanguageModel, bool) {
+	if language == "" {
+		return LanguageModel{}, false
+	}
+	model, ok := c.BertModel.LanguageModels[language]
+	return model, ok
+}
+
+// GetSimilarityThreshold returns the similarity needed to route a query in the
+// language to a category: its language model's threshold, when set, or
+// bert_model.threshold
+func (c *RouterConfig) GetSimilarityThreshold(language string) float32 {
+	if model, ok := c.GetLanguageModel(language); ok && model.Threshold > 0 {
+		return model.Threshold
+	}
+	return c.BertModel.Threshold
+}
+
 // GetModelForCategoryIndex returns the best LLM model name for the category at the given index
 func (c *RouterConfig) GetModelForCategoryIndex(index int) string {
+	return c.GetCandidateModelsForCategoryIndex(index)[0]
+}
+
+// GetCandidateModelsForCategoryIndex returns the models that can serve the category at
+// the given index in order of preference, ending with the default model
+func (c *RouterConfig) GetCandidateModelsForCategoryIndex(index int) []string {
 	if index < 0 || index >= len(c.Categories) {
-		return c.DefaultModel
+		return []string{c.DefaultModel}
+	}
+
+	// Rank the category's models, skipping those under maintenance
+	now := time.Now()
+	candidates := make([]string, 0, len(c.Categories[index].Models)+1)
+	for _, model := range c.Categories[index].Models {
+		if c.IsModelInMaintenance(model, now) {
+			log.Printf("Model %s is in a maintenance window, skipping", model)
+			continue
+		}
+		candidates = append(candidates, model)
+	}
+
+	// Fall back to default model if category has no available models
+	return append(candidates, c.DefaultModel)
+}
+
+// GetCandidateModelsForCategory returns the candidate models for the named category,
+// or only the default model if the category is unknown
+func (c *RouterConfig) GetCandidateModelsForCategory(name string) []string {
+	for i, category := range c.Categories {
+		if strings.EqualFold(category.Name, name) {
+			return c.GetCandidateModelsForCategoryIndex(i)
+		}
+	}
+	return []string{c.DefaultModel}
+}
+
+// GetFallbackModelsForCategory returns the fallback chain of the named
+// category: its models then its fallbacks, skipping those under maintenance
+// and duplicates, then the default model
+func (c *RouterConfig) GetFallbackModelsForCategory(name string) []string {
+	chain := []string{}
+	for _, category := range c.Categories {
+		if !strings.EqualFold(category.Name, name) {
+			continue
+		}
+		now := time.Now()
+		for _, model := range slices.Concat(category.Models, category.Fallbacks) {
+			if !slices.Contains(chain, model) && !c.IsModelInMaintenance(model, now) {
+				chain = append(chain, model)
+			}
+		}
+		break
 	}
+	if !slices.Contains(chain, c.DefaultModel) {
+		chain = append(chain, c.DefaultModel)
+	}
+	return chain
+}
 
+// GetModelQuality returns the quality of a model for the category at the given
+// index, its configured score or one derived from its rank
+func (c *RouterConfig) GetModelQuality(index int, model string) float64 {
+	if index < 0 || index >= len(c.Categories) {
+		return 0
+	}
 	category := c.Categories[index]
-	if len(category.Models) > 0 {
-		return category.Models[0]
+	if quality, ok := category.Quality[model]; ok {
+		return quality
+	}
+	rank := slices.Index(category.Models, model)
+	if rank < 0 {
+		return 0
+	}
+	return 1 - float64(rank)/float64(len(category.Models))
+}
+
+// GetModelCost returns the estimated cost in USD of a request to the model
+// with the given token counts, 0 for unpriced models
+func (c *RouterConfig) GetModelCost(model string, promptTokens, completionTokens int) float64 {
+	params := c.ModelConfig[model]
+	return (float64(promptTokens)*params.PromptCostPerMillion + float64(completionTokens)*params.CompletionCostPerMillion) / 1e6
+}
+
+// GetModelContextWindow returns the context window of a model in tokens, 0
+// when it is not configured
+func (c *RouterConfig) GetModelContextWindow(model string) int {
+	return c.ModelConfig[model].ContextWindow
+}
+
+// GetModelComplianceAttributes returns the compliance attributes of each model that has any
+func (c *RouterConfig) GetModelComplianceAttributes() map[string][]string {
+	attributes := make(map[string][]string)
+	for model, params := range c.ModelConfig {
+		if len(params.Compliance) > 0 {
+			attributes[model] = params.Compliance
+		}
 	}
+	return attributes
+}
 
-	// Fall back to default model if category has no models
-	return c.DefaultModel
+// GetModelRegions returns the hosting region of each model that has one
+func (c *RouterConfig) GetModelRegions() map[string]string {
+	regions := make(map[string]string)
+	for model, params := range c.ModelConfig {
+		if params.Region != "" {
+			regions[model] = params.Region
+		}
+	}
+	return regions
 }
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetModelForCategoryIndexSkipsMaintenance(t *testing.T) {
+	now := time.Now()
+	cfg := &RouterConfig{
+		DefaultModel: "default",
+		Categories: []Category{
+			{Name: "math", Models: []string{"a", "b"}},
+			{Name: "law", Models: []string{"a"}},
+		},
+		ModelConfig: map[string]ModelParams{
+			"a": {MaintenanceWindows: []MaintenanceWindow{
+				{Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			}},
+		},
+	}
+
+	if got := cfg.GetModelForCategoryIndex(0); got != "b" {
+		t.Errorf("expected next ranked model b, got %s", got)
+	}
+	if got := cfg.GetModelForCategoryIndex(1); got != "default" {
+		t.Errorf("expected default model, got %s", got)
+	}
+}
+
+func TestGetFallbackModelsForCategory(t *testing.T) {
+	now := time.Now()
+	cfg := &RouterConfig{
+		DefaultModel: "default",
+		Categories: []Category{
+			{Name: "math", Models: []string{"a", "b"}, Fallbacks: []string{"b", "c", "d"}},
+		},
+		ModelConfig: map[string]ModelParams{
+			"c": {MaintenanceWindows: []MaintenanceWindow{
+				{Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			}},
+		},
+	}
+
+	if got, want := cfg.GetFallbackModelsForCategory("Math"), []string{"a", "b", "d", "default"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fallback chain = %v, want %v", got, want)
+	}
+	if got, want := cfg.GetFallbackModelsForCategory(""), []string{"default"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fallback chain without a category = %v, want %v", got, want)
+	}
+}
+
+func TestGetModelQuality(t *testing.T) {
+	cfg := &RouterConfig{
+		Categories: []Category{
+			{Name: "math", Models: []string{"a", "b", "c", "d"}, Quality: map[string]float64{"c": 0.9}},
+		},
+	}
+	for model, want := range map[string]float64{"a": 1, "b": 0.75, "c": 0.9, "d": 0.25, "other": 0} {
+		if got := cfg.GetModelQuality(0, model); got != want {
+			t.Errorf("quality of %s = %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestGetReasoningEffort(t *testing.T) {
+	cfg := &RouterConfig{
+		Categories: []Category{
+			{Name: "math", ReasoningEffort: "high"},
+			{Name: "law"},
+		},
+		ModelConfig: map[string]ModelParams{
+			"r1":    {Family: "deepseek", Reasoning: ModelReasoningConfig{Effort: "low"}},
+			"small": {Reasoning: ModelReasoningConfig{Disabled: true, Effort: "low"}},
+		},
+	}
+	tests := []struct {
+		category, model, want string
+	}{
+		{"math", "r1", "high"},
+		{"law", "r1", "low"},
+		{"", "r1", "low"},
+		{"math", "unknown", "high"},
+		{"law", "unknown", ""},
+		{"math", "small", ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.GetReasoningEffort(tt.category, tt.model); got != tt.want {
+			t.Errorf("GetReasoningEffort(%q, %q) = %q, want %q", tt.category, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestModelDeprecationSchedule(t *testing.T) {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	deprecation := ModelDeprecationConfig{Since: since, Sunset: since.Add(100 * time.Hour), Replacement: "phi5"}
+	tests := []struct {
+		name                string
+		now                 time.Time
+		deprecated, retired bool
+		share               float64
+	}{
+		{"before deprecation", since.Add(-time.Hour), false, false, 0},
+		{"at deprecation", since, true, false, 0},
+		{"quarter way", since.Add(25 * time.Hour), true, false, 0.25},
+		{"at sunset", since.Add(100 * time.Hour), true, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deprecation.Deprecated(tt.now); got != tt.deprecated {
+				t.Errorf("Deprecated = %v, want %v", got, tt.deprecated)
+			}
+			if got := deprecation.Retired(tt.now); got != tt.retired {
+				t.Errorf("Retired = %v, want %v", got, tt.retired)
+			}
+			if got := deprecation.ShiftedShare(tt.now); got != tt.share {
+				t.Errorf("ShiftedShare = %v, want %v", got, tt.share)
+			}
+		})
+	}
+
+	// Without a replacement or a sunset no traffic moves before the sunset
+	noReplacement := ModelDeprecationConfig{Since: since, Sunset: since.Add(100 * time.Hour)}
+	noSunset := ModelDeprecationConfig{Since: since, Replacement: "phi5"}
+	if noReplacement.ShiftedShare(since.Add(50*time.Hour)) != 0 || noSunset.ShiftedShare(since.Add(50*time.Hour)) != 0 {
+		t.Error("traffic moved without a schedule")
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{"before start", MaintenanceWindow{Start: start, End: start.Add(time.Hour)}, start.Add(-time.Minute), false},
+		{"inside", MaintenanceWindow{Start: start, End: start.Add(time.Hour)}, start.Add(time.Minute), true},
+		{"at end", MaintenanceWindow{Start: start, End: start.Add(time.Hour)}, start.Add(time.Hour), false},
+		{"open ended", MaintenanceWindow{Start: start}, start.Add(24 * time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(tt.at); got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCacheEpoch(t *testing.T) {
+	cfg := &RouterConfig{
+		DefaultModel: "phi4",
+		Categories:   []Category{{Name: "math", Models: []string{"phi4"}}},
+	}
+	cfg.SemanticCache.Epoch = "2025-01"
+	if got := cfg.GetCacheEpoch(); got != "2025-01" {
+		t.Errorf("GetCacheEpoch() = %q, want the configured epoch", got)
+	}
+
+	cfg.SemanticCache.EpochFromConfig = true
+	before := cfg.GetCacheEpoch()
+	if before == "2025-01" || before != cfg.GetCacheEpoch() {
+		t.Errorf("expected a stable epoch including the config hash, got %q", before)
+	}
+
+	cfg.Categories[0].Models = []string{"mistral-small3.1"}
+	if cfg.GetCacheEpoch() == before {
+		t.Error("expected a routing change to start a new epoch")
+	}
+
+	cfg.SemanticCache.TTLSeconds = 60
+	after := cfg.GetCacheEpoch()
+	cfg.SemanticCache.TTLSeconds = 120
+	if cfg.GetCacheEpoch() != after {
+		t.Error("expected cache tuning not to change the epoch")
+	}
+
+	cfg.SemanticCache.Normalization = CacheNormalizationConfig{Enabled: true, Lowercase: true}
+	normalized := cfg.GetCacheEpoch()
+	if normalized == after {
+		t.Error("expected query normalization to start a new epoch")
+	}
+	cfg.SemanticCache.Normalization.CompareRaw = true
+	if cfg.GetCacheEpoch() != normalized {
+		t.Error("expected comparing raw lookups not to change the epoch")
+	}
+	cfg.SemanticCache.Normalization.StripPunctuation = true
+	if cfg.GetCacheEpoch() == normalized {
+		t.Error("expected another normalization step to start a new epoch")
+	}
+}
+
+func TestGetCategoryUtterances(t *testing.T) {
+	cfg := &RouterConfig{Categories: []Category{
+		{Name: "math", Description: "mathematics", Utterances: map[string][]string{
+			"en": {"solve this equation"},
+			"de": {"löse diese Gleichung", "berechne die Ableitung"},
+		}},
+		{Name: "law", Descriptions: map[string]string{"fr": "questions de droit"}},
+	}}
+
+	tests := []struct {
+		name         string
+		language     string
+		multilingual bool
+		wantTexts    []string
+		wantIndexes  []int
+	}{
+		{"language with utterances", "de", false, []string{"löse diese Gleichung", "berechne die Ableitung", "law"}, []int{0, 0, 1}},
+		{"language without utterances falls back to descriptions", "fr", false, []string{"mathematics", "questions de droit"}, []int{0, 1}},
+		{"undetected language", "", false, []string{"mathematics", "law"}, []int{0, 1}},
+		{"multilingual model matches every language", "fr", true, []string{"löse diese Gleichung", "berechne die Ableitung", "solve this equation", "questions de droit"}, []int{0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.BertModel.Multilingual = tt.multilingual
+			texts, indexes := cfg.GetCategoryUtterances(tt.language)
+			if !reflect.DeepEqual(texts, tt.wantTexts) || !reflect.DeepEqual(indexes, tt.wantIndexes) {
+				t.Errorf("GetCategoryUtterances(%q) = %v %v, want %v %v", tt.language, texts, indexes, tt.wantTexts, tt.wantIndexes)
+			}
+		})
+	}
+}
+
+func TestGetSimilarityThreshold(t *testing.T) {
+	cfg := &RouterConfig{}
+	cfg.BertModel.Threshold = 0.6
+	cfg.BertModel.LanguageModels = map[string]LanguageModel{
+		"de": {ModelID: "german-bert", Threshold: 0.75},
+		"fr": {ModelID: "french-bert"},
+	}
+	for language, want := range map[string]float32{"de": 0.75, "fr": 0.6, "en": 0.6, "": 0.6} {
+		if got := cfg.GetSimilarityThreshold(language); got != want {
+			t.Errorf("GetSimilarityThreshold(%q) = %v, want %v", language, got, want)
+		}
+	}
+}
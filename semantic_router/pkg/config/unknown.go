@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// How keys of a config that match no setting are handled
+const (
+	// UnknownKeysWarn logs unknown keys and ignores them, so configs written
+	// for newer routers still load
+	UnknownKeysWarn = "warn"
+	// UnknownKeysError rejects configs with unknown keys, catching typos
+	UnknownKeysError = "error"
+)
+
+// unknownKeys returns the dotted paths of the keys of settings that match no
+// field of the given type, e.g. semantic_cache.bakend or categories[2].modles
+func unknownKeys(settings interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := settings.(map[string]interface{})
+		if !ok {
+			// Scalars decoded into structs, e.g. timestamps
+			return nil
+		}
+		known := yamlFields(t)
+		for key, value := range fields {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			field, ok := known[key]
+			if !ok {
+				unknown = append(unknown, keyPath)
+				continue
+			}
+			unknown = append(unknown, unknownKeys(value, field, keyPath)...)
+		}
+	case reflect.Map:
+		entries, ok := settings.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range entries {
+			unknown = append(unknown, unknownKeys(value, t.Elem(), path+"."+key)...)
+		}
+	case reflect.Slice, reflect.Array:
+		entries, ok := settings.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, value := range entries {
+			unknown = append(unknown, unknownKeys(value, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// yamlFields returns the types of the fields of a struct by their YAML key,
+// including the fields of inlined structs
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if strings.Contains(options, "inline") {
+			for key, inlined := range yamlFields(field.Type) {
+				fields[key] = inlined
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// checkUnknownKeys reports the keys of the config that match no setting,
+// handling them as set by unknown_keys or else by defaultMode
+func (c *RouterConfig) checkUnknownKeys(defaultMode string) error {
+	mode := c.UnknownKeys
+	if mode == "" {
+		mode = defaultMode
+	}
+	switch mode {
+	case UnknownKeysWarn:
+		for _, key := range c.unknownKeys {
+			log.Printf("Warning: ignoring unknown config key %s", key)
+		}
+		return nil
+	case UnknownKeysError:
+		if len(c.unknownKeys) > 0 {
+			return fmt.Errorf("unknown config keys: %s", strings.Join(c.unknownKeys, ", "))
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid unknown_keys %q, must be %s or %s", mode, UnknownKeysWarn, UnknownKeysError)
+	}
+}
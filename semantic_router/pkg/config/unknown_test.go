@@ -0,0 +1,79 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "known keys",
+			config: "default_model: m\nsemantic_cache:\n  backend: memory\nstage_rollouts:\n  cache:\n    start_percent: 10\n",
+		},
+		{
+			name:   "typos at every level",
+			config: "defualt_model: m\nsemantic_cache:\n  bakend: redis\ncategories:\n  - name: math\n    modles: [m]\nmodel_config:\n  m:\n    famliy: qwen\n",
+			want:   "categories[0].modles,defualt_model,model_config.m.famliy,semantic_cache.bakend",
+		},
+		{
+			name:   "free-form values",
+			config: "pipeline_stages:\n  anything: true\ncategories:\n  - name: math\n    utterances:\n      xx: [hello]\n",
+		},
+		{
+			name:    "invalid mode",
+			config:  "unknown_keys: ignore\n",
+			wantErr: "invalid unknown_keys",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"config.yaml": tt.config})
+			cfg, err := readConfig(filepath.Join(dir, "config.yaml"))
+			if err != nil {
+				t.Fatalf("readConfig: %v", err)
+			}
+			if got := strings.Join(cfg.unknownKeys, ","); got != tt.want {
+				t.Errorf("unknown keys = %q, want %q", got, tt.want)
+			}
+			err = cfg.checkUnknownKeys(UnknownKeysWarn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("expected unknown keys to be warnings, got %v", err)
+			}
+			if err := cfg.checkUnknownKeys(UnknownKeysError); (err != nil) != (tt.want != "") {
+				t.Errorf("strict check returned %v for unknown keys %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigIsStrict(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"strict.yaml":     validBase + "defualt_model: m\n",
+		"permissive.yaml": validBase + "unknown_keys: warn\ndefualt_model: m\n",
+	})
+	if _, err := ValidateConfig(filepath.Join(dir, "strict.yaml")); err == nil || !strings.Contains(err.Error(), "defualt_model") {
+		t.Errorf("expected the unknown key to fail validation, got %v", err)
+	}
+	if _, err := ValidateConfig(filepath.Join(dir, "permissive.yaml")); err != nil {
+		t.Errorf("expected unknown_keys: warn to allow unknown keys, got %v", err)
+	}
+	if _, err := ReloadConfig(filepath.Join(dir, "strict.yaml")); err != nil {
+		t.Errorf("expected unknown keys to be warnings at runtime, got %v", err)
+	}
+	if _, err := ValidateConfig("../../../config/config.yaml"); err != nil {
+		t.Errorf("expected the shipped config to validate: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Violation is a setting of a config that is missing or out of range
+type Violation struct {
+	// Dotted path of the setting, e.g. categories[2].confidence_threshold
+	Field   string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Field + ": " + v.Message
+}
+
+// ValidationError lists every violation of a config
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		lines = append(lines, v.String())
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(lines, "; "))
+}
+
+// Validate checks the settings every router needs and the ranges of
+// thresholds, returning a *ValidationError listing all violations. Settings
+// needing more than the config to check, such as mapping files, are checked
+// when the router is built.
+func (c *RouterConfig) Validate() error {
+	var v validator
+	v.required("default_model", c.DefaultModel)
+	v.fraction("bert_model.threshold", c.BertModel.Threshold)
+	v.fraction("classifier.threshold", c.Classifier.Threshold)
+
+	remote := false
+	switch c.GetEmbeddingProvider() {
+	case EmbeddingProviderCandle:
+		v.required("bert_model.model_id", c.BertModel.ModelID)
+		languages := make([]string, 0, len(c.BertModel.LanguageModels))
+		for language := range c.BertModel.LanguageModels {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+		for _, language := range languages {
+			field := "bert_model.language_models." + language
+			v.required(field+".model_id", c.BertModel.LanguageModels[language].ModelID)
+			v.fraction(field+".threshold", c.BertModel.LanguageModels[language].Threshold)
+		}
+	case EmbeddingProviderRemote:
+		remote = true
+		v.required("embedding_provider.remote.url", c.EmbeddingProvider.Remote.URL)
+		if len(c.BertModel.LanguageModels) > 0 {
+			v.add("bert_model.language_models", "need embedding_provider %s", EmbeddingProviderCandle)
+		}
+	default:
+		v.add("embedding_provider.type", "must be %s or %s, got %q", EmbeddingProviderCandle, EmbeddingProviderRemote, c.EmbeddingProvider.Type)
+	}
+
+	switch c.GetRoutingStrategy() {
+	case RoutingStrategyClassifier:
+		v.required("classifier.category_mapping_path", c.Classifier.CategoryMappingPath)
+		// The classifier falls back to bert_model, which a remote provider
+		// doesn't load
+		if remote {
+			v.required("classifier.model_id", c.Classifier.ModelID)
+		}
+	case RoutingStrategySimilarity:
+	default:
+		v.add("routing.strategy", "must be %s or %s, got %q", RoutingStrategyClassifier, RoutingStrategySimilarity, c.Routing.Strategy)
+	}
+
+	names := make(map[string]int, len(c.Categories))
+	for i, category := range c.Categories {
+		field := fmt.Sprintf("categories[%d]", i)
+		if category.Name == "" {
+			v.add(field+".name", "is required")
+		} else if first, ok := names[strings.ToLower(category.Name)]; ok {
+			v.add(field+".name", "%q is also the name of categories[%d]", category.Name, first)
+		} else {
+			names[strings.ToLower(category.Name)] = i
+		}
+		for j, model := range category.Models {
+			v.required(fmt.Sprintf("%s.models[%d]", field, j), model)
+		}
+		if category.ConfidenceThreshold != nil {
+			v.fraction(field+".confidence_threshold", *category.ConfidenceThreshold)
+		}
+	}
+
+	models := make([]string, 0, len(c.ModelConfig))
+	for model := range c.ModelConfig {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		family := c.ModelConfig[model].Family
+		if _, ok := c.ModelFamilyTemplates[family]; family != "" && !ok && !slices.Contains(BuiltinModelFamilies, family) {
+			v.add("model_config."+model+".family", "must be %s or a family of model_family_templates, got %q", strings.Join(BuiltinModelFamilies, ", "), family)
+		}
+	}
+
+	if c.Metrics.Port < 0 || c.Metrics.Port > 65535 {
+		v.add("metrics.port", "must be between 0 and 65535, got %d", c.Metrics.Port)
+	}
+	if c.Metrics.Path != "" && !strings.HasPrefix(c.Metrics.Path, "/") {
+		v.add("metrics.path", "must start with /, got %q", c.Metrics.Path)
+	}
+
+	if c.Admin.Port > 0 && c.Admin.TokenEnv == "" && !isLoopback(c.Admin.Address) {
+		v.add("admin.address", "must be a loopback address unless admin.token_env is set, got %q", c.Admin.Address)
+	}
+
+	if budget := c.ClassificationBudget; budget.MaxWords > 0 {
+		headOK := v.wordCount("classification_budget.head_words", budget.HeadWords, budget.MaxWords)
+		tailOK := v.wordCount("classification_budget.tail_words", budget.TailWords, budget.MaxWords)
+		if headOK && tailOK && budget.HeadWords+budget.TailWords > budget.MaxWords {
+			v.add("classification_budget", "head_words %d and tail_words %d add up to more than max_words %d", budget.HeadWords, budget.TailWords, budget.MaxWords)
+		}
+	}
+
+	switch c.TextChunking.Pooling {
+	case "", "mean", "max":
+	default:
+		v.add("text_chunking.pooling", "must be mean or max, got %q", c.TextChunking.Pooling)
+	}
+
+	if c.RoutingFeedback.Enabled {
+		v.fraction("routing_feedback.step", c.RoutingFeedback.Step)
+		v.fraction("routing_feedback.max_drift", c.RoutingFeedback.MaxDrift)
+	}
+
+	if c.SemanticCache.SimilarityThreshold != nil {
+		v.fraction("semantic_cache.similarity_threshold", *c.SemanticCache.SimilarityThreshold)
+	}
+	if c.PII.Enabled {
+		v.fraction("pii.threshold", c.PII.Threshold)
+	}
+	if c.PromptGuard.Enabled {
+		v.required("prompt_guard.model_id", c.PromptGuard.ModelID)
+		v.required("prompt_guard.mapping_path", c.PromptGuard.MappingPath)
+		v.fraction("prompt_guard.threshold", c.PromptGuard.Threshold)
+	}
+
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+// isLoopback returns whether an address only accepts local connections; an
+// empty address defaults to localhost
+func isLoopback(address string) bool {
+	if address == "" || address == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validator collects the violations of a config
+type validator struct {
+	violations []Violation
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// required reports an empty setting
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+	}
+}
+
+// wordCount reports a number of words outside [0, max_words], returning
+// whether it is within
+func (v *validator) wordCount(field string, words, maxWords int) bool {
+	if words < 0 || words > maxWords {
+		v.add(field, "must be between 0 and max_words %d, got %d", maxWords, words)
+		return false
+	}
+	return true
+}
+
+// fraction reports a setting outside [0, 1]
+func (v *validator) fraction(field string, value float32) {
+	if value < 0 || value > 1 {
+		v.add(field, "must be between 0 and 1, got %g", value)
+	}
+}
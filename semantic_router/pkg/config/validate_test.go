@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// validBase holds the settings every valid config needs
+const validBase = "default_model: m\nbert_model:\n  model_id: bert\n"
+
+func TestValidate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"valid.yaml": validBase + `
+model_config:
+  llama-3:
+    family: llama
+model_family_templates:
+  llama:
+    reasoning_on:
+      set: {think: true}
+categories:
+  - name: math
+    models: [math-model]
+    confidence_threshold: 0.4
+admin:
+  port: 8081
+  address: 0.0.0.0
+  token_env: ROUTER_ADMIN_TOKEN
+`,
+		"invalid.yaml": `
+bert_model:
+  threshold: 1.5
+  language_models:
+    de:
+      model_id: german-bert
+      threshold: 1.2
+    fr:
+      threshold: 0.5
+classifier:
+  threshold: -0.1
+routing:
+  strategy: classifier
+model_config:
+  llama-3:
+    family: llama
+  phi4:
+    family: openai
+categories:
+  - name: math
+    models: [math-model, ""]
+  - name: Math
+    confidence_threshold: 2
+  - models: [m]
+metrics:
+  path: metrics
+admin:
+  port: 8081
+  address: 0.0.0.0
+classification_budget:
+  strategy: head_tail
+  max_words: 100
+  head_words: -1
+  tail_words: 200
+text_chunking:
+  pooling: median
+routing_feedback:
+  enabled: true
+  max_drift: 1.5
+semantic_cache:
+  similarity_threshold: 1.2
+prompt_guard:
+  enabled: true
+  threshold: 0.7
+`,
+	})
+
+	if _, err := ValidateConfig(filepath.Join(dir, "valid.yaml")); err != nil {
+		t.Errorf("valid config failed validation: %v", err)
+	}
+
+	_, err := ValidateConfig(filepath.Join(dir, "invalid.yaml"))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("ValidateConfig error = %v, want a *ValidationError", err)
+	}
+	var fields []string
+	for _, v := range validationErr.Violations {
+		fields = append(fields, v.Field)
+	}
+	want := []string{
+		"default_model",
+		"bert_model.threshold",
+		"classifier.threshold",
+		"bert_model.model_id",
+		"bert_model.language_models.de.threshold",
+		"bert_model.language_models.fr.model_id",
+		"classifier.category_mapping_path",
+		"categories[0].models[1]",
+		"categories[1].name",
+		"categories[1].confidence_threshold",
+		"categories[2].name",
+		"model_config.llama-3.family",
+		"metrics.path",
+		"admin.address",
+		"classification_budget.head_words",
+		"classification_budget.tail_words",
+		"text_chunking.pooling",
+		"routing_feedback.max_drift",
+		"semantic_cache.similarity_threshold",
+		"prompt_guard.model_id",
+		"prompt_guard.mapping_path",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("violations at %v, want %v", fields, want)
+	}
+
+	remote := &RouterConfig{DefaultModel: "m"}
+	remote.Classifier.CategoryMappingPath = "mapping.json"
+	remote.EmbeddingProvider.Type = EmbeddingProviderRemote
+	err = remote.Validate()
+	if !errors.As(err, &validationErr) || len(validationErr.Violations) != 2 ||
+		validationErr.Violations[0].Field != "embedding_provider.remote.url" || validationErr.Violations[1].Field != "classifier.model_id" {
+		t.Errorf("remote provider without url or classifier model: %v", err)
+	}
+
+	budget := &RouterConfig{DefaultModel: "m"}
+	budget.BertModel.ModelID = "bert"
+	budget.ClassificationBudget = ClassificationBudgetConfig{Strategy: "head_tail", MaxWords: 100, HeadWords: 80, TailWords: 80}
+	err = budget.Validate()
+	if !errors.As(err, &validationErr) || len(validationErr.Violations) != 1 || validationErr.Violations[0].Field != "classification_budget" {
+		t.Errorf("head_words and tail_words over max_words: %v", err)
+	}
+
+	if _, err := ReloadConfig(filepath.Join(dir, "invalid.yaml")); err == nil {
+		t.Error("ReloadConfig accepted an invalid config")
+	}
+}
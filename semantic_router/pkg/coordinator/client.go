@@ -0,0 +1,175 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// ClientOptions holds options for creating a new coordinator client
+type ClientOptions struct {
+	// Address of the coordinator, host:port
+	Address string
+	// Stable identity of this replica
+	ReplicaID string
+	// Time between syncs
+	Interval time.Duration
+	// Timeout of a single sync
+	Timeout time.Duration
+	// Reports the endpoints this replica considers unhealthy, may be nil
+	UnhealthyEndpoints func() []string
+	// Receives the endpoints considered unhealthy fleet-wide after every sync, may be nil
+	OnFleetUnhealthy func(addresses []string)
+}
+
+// Client syncs a replica's state with the coordinator in the background and
+// serves the fleet-wide view. When the coordinator is unreachable the last view
+// is kept and local quota consumption is retried with the next sync, so the
+// router degrades to per-replica decisions instead of failing.
+type Client struct {
+	options ClientOptions
+	conn    *grpc.ClientConn
+	rpc     CoordinatorClient
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	mu         sync.Mutex
+	pending    map[string]int64
+	inflight   map[string]int64
+	fleetUsage map[string]int64
+	lastSync   time.Time
+}
+
+// NewClient creates a coordinator client with the given options. It does not
+// contact the coordinator until Start.
+func NewClient(options ClientOptions) (*Client, error) {
+	if options.Address == "" {
+		return nil, fmt.Errorf("coordinator address is required")
+	}
+	if options.ReplicaID == "" {
+		return nil, fmt.Errorf("replica ID is required")
+	}
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Second
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 2 * time.Second
+	}
+	conn, err := grpc.NewClient(options.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coordinator connection: %w", err)
+	}
+	return &Client{
+		options:    options,
+		conn:       conn,
+		rpc:        NewCoordinatorClient(conn),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		pending:    make(map[string]int64),
+		fleetUsage: make(map[string]int64),
+	}, nil
+}
+
+// Start syncs with the coordinator in the background every interval
+func (c *Client) Start() {
+	log.Printf("Syncing with coordinator %s as replica %s every %s", c.options.Address, c.options.ReplicaID, c.options.Interval)
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.options.Interval)
+		defer ticker.Stop()
+		for {
+			if err := c.Sync(context.Background()); err != nil {
+				log.Printf("Error syncing with coordinator: %v", err)
+			}
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops syncing and closes the connection
+func (c *Client) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+		c.conn.Close()
+	})
+}
+
+// AddQuotaUsage records local consumption of a quota, shared with the fleet on the next sync
+func (c *Client) AddQuotaUsage(key string, amount int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[key] += amount
+}
+
+// QuotaUsage returns the fleet-wide consumption of a quota in the current
+// window, including local consumption not yet synced
+func (c *Client) QuotaUsage(key string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fleetUsage[key] + c.inflight[key] + c.pending[key]
+}
+
+// LastSync returns when the client last synced successfully, zero if never
+func (c *Client) LastSync() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastSync
+}
+
+// Sync reports local state to the coordinator once and applies the fleet view
+func (c *Client) Sync(ctx context.Context) error {
+	c.mu.Lock()
+	deltas := c.pending
+	c.pending = make(map[string]int64)
+	c.inflight = deltas
+	c.mu.Unlock()
+
+	var unhealthy []string
+	if c.options.UnhealthyEndpoints != nil {
+		unhealthy = c.options.UnhealthyEndpoints()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+	resp, err := c.rpc.Sync(ctx, &SyncRequest{
+		ReplicaId:          c.options.ReplicaID,
+		QuotaDeltas:        deltas,
+		UnhealthyEndpoints: unhealthy,
+	})
+	if err != nil {
+		// Keep the unsynced consumption for the next attempt
+		c.mu.Lock()
+		for key, delta := range deltas {
+			c.pending[key] += delta
+		}
+		c.inflight = nil
+		c.mu.Unlock()
+		metrics.RecordCoordinatorSync(false, 0)
+		return err
+	}
+
+	c.mu.Lock()
+	c.fleetUsage = resp.GetQuotaUsage()
+	c.inflight = nil
+	c.lastSync = time.Now()
+	c.mu.Unlock()
+
+	if c.options.OnFleetUnhealthy != nil {
+		c.options.OnFleetUnhealthy(resp.GetUnhealthyEndpoints())
+	}
+	metrics.RecordCoordinatorSync(true, int(resp.GetLiveReplicas()))
+	return nil
+}
@@ -0,0 +1,124 @@
+package coordinator
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestServerAggregatesReplicas(t *testing.T) {
+	s := NewServer(ServerOptions{Window: time.Minute, ReplicaTTL: 10 * time.Second, UnhealthyReplicas: 2})
+	now := time.Date(2025, 1, 1, 12, 0, 5, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	sync := func(replica string, deltas map[string]int64, unhealthy ...string) *SyncResponse {
+		t.Helper()
+		resp, err := s.Sync(ctx, &SyncRequest{ReplicaId: replica, QuotaDeltas: deltas, UnhealthyEndpoints: unhealthy})
+		if err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+		return resp
+	}
+
+	sync("a", map[string]int64{"team-a": 10}, "10.0.0.1:8000")
+	resp := sync("b", map[string]int64{"team-a": 5, "team-b": 1}, "10.0.0.1:8000", "10.0.0.2:8000")
+	if want := map[string]int64{"team-a": 15, "team-b": 1}; !reflect.DeepEqual(resp.GetQuotaUsage(), want) {
+		t.Errorf("quota usage = %v, want %v", resp.GetQuotaUsage(), want)
+	}
+	// Only the endpoint reported by two replicas is unhealthy fleet-wide
+	if want := []string{"10.0.0.1:8000"}; !reflect.DeepEqual(resp.GetUnhealthyEndpoints(), want) {
+		t.Errorf("unhealthy endpoints = %v, want %v", resp.GetUnhealthyEndpoints(), want)
+	}
+	if resp.GetLiveReplicas() != 2 {
+		t.Errorf("live replicas = %d, want 2", resp.GetLiveReplicas())
+	}
+
+	// Replica a stops syncing and the quota window rolls over
+	now = now.Add(time.Minute)
+	resp = sync("b", map[string]int64{"team-a": 2}, "10.0.0.1:8000")
+	if want := map[string]int64{"team-a": 2}; !reflect.DeepEqual(resp.GetQuotaUsage(), want) {
+		t.Errorf("quota usage after window = %v, want %v", resp.GetQuotaUsage(), want)
+	}
+	if len(resp.GetUnhealthyEndpoints()) != 0 || resp.GetLiveReplicas() != 1 {
+		t.Errorf("expected the expired replica's reports to be dropped, got %v with %d replicas",
+			resp.GetUnhealthyEndpoints(), resp.GetLiveReplicas())
+	}
+
+	if _, err := s.Sync(ctx, &SyncRequest{}); err == nil {
+		t.Error("expected an error without a replica ID")
+	}
+}
+
+func TestClientSyncsWithServer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer()
+	RegisterCoordinatorServer(server, NewServer(ServerOptions{}))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	var fleetUnhealthy []string
+	newClient := func(replica string, unhealthy ...string) *Client {
+		c, err := NewClient(ClientOptions{
+			Address:            lis.Addr().String(),
+			ReplicaID:          replica,
+			UnhealthyEndpoints: func() []string { return unhealthy },
+			OnFleetUnhealthy:   func(addresses []string) { fleetUnhealthy = addresses },
+		})
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		t.Cleanup(func() { c.conn.Close() })
+		return c
+	}
+	a := newClient("a", "10.0.0.1:8000")
+	b := newClient("b")
+	ctx := context.Background()
+
+	a.AddQuotaUsage("team-a", 3)
+	if got := a.QuotaUsage("team-a"); got != 3 {
+		t.Errorf("unsynced usage = %d, want 3", got)
+	}
+	if err := a.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	b.AddQuotaUsage("team-a", 4)
+	if err := b.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if got := b.QuotaUsage("team-a"); got != 7 {
+		t.Errorf("fleet usage = %d, want 7", got)
+	}
+	if !reflect.DeepEqual(fleetUnhealthy, []string{"10.0.0.1:8000"}) {
+		t.Errorf("fleet unhealthy = %v", fleetUnhealthy)
+	}
+	if b.LastSync().IsZero() {
+		t.Error("expected a successful sync time")
+	}
+}
+
+func TestClientKeepsUsageWhenUnreachable(t *testing.T) {
+	c, err := NewClient(ClientOptions{Address: "127.0.0.1:1", ReplicaID: "a", Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.conn.Close()
+
+	c.AddQuotaUsage("team-a", 5)
+	if err := c.Sync(context.Background()); err == nil {
+		t.Fatal("expected an error from an unreachable coordinator")
+	}
+	if got := c.QuotaUsage("team-a"); got != 5 {
+		t.Errorf("usage after failed sync = %d, want 5", got)
+	}
+	if !c.LastSync().IsZero() {
+		t.Error("expected no successful sync")
+	}
+}
@@ -0,0 +1,116 @@
+package coordinator
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ServerOptions holds options for creating a new coordinator server
+type ServerOptions struct {
+	// Length of the fixed quota windows; usage resets at the start of each window
+	Window time.Duration
+	// How long a replica counts as live after its last sync
+	ReplicaTTL time.Duration
+	// Number of live replicas that must report an endpoint unhealthy before it
+	// is considered unhealthy fleet-wide
+	UnhealthyReplicas int
+}
+
+// replicaState is the last state synced by a replica
+type replicaState struct {
+	lastSync  time.Time
+	unhealthy []string
+}
+
+// Server aggregates quota consumption and endpoint health reported by router replicas
+type Server struct {
+	UnimplementedCoordinatorServer
+
+	options ServerOptions
+	now     func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	quotaUsage  map[string]int64
+	replicas    map[string]*replicaState
+}
+
+// NewServer creates a new coordinator server with the given options
+func NewServer(options ServerOptions) *Server {
+	if options.Window <= 0 {
+		options.Window = time.Minute
+	}
+	if options.ReplicaTTL <= 0 {
+		options.ReplicaTTL = 30 * time.Second
+	}
+	if options.UnhealthyReplicas <= 0 {
+		options.UnhealthyReplicas = 1
+	}
+	return &Server{
+		options:    options,
+		now:        time.Now,
+		quotaUsage: make(map[string]int64),
+		replicas:   make(map[string]*replicaState),
+	}
+}
+
+// Sync implements CoordinatorServer
+func (s *Server) Sync(ctx context.Context, req *SyncRequest) (*SyncResponse, error) {
+	if req.GetReplicaId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "replica_id is required")
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Start a new quota window when the current one has passed
+	if windowStart := now.Truncate(s.options.Window); windowStart.After(s.windowStart) {
+		s.windowStart = windowStart
+		s.quotaUsage = make(map[string]int64)
+	}
+	for key, delta := range req.GetQuotaDeltas() {
+		s.quotaUsage[key] += delta
+	}
+
+	s.replicas[req.GetReplicaId()] = &replicaState{
+		lastSync:  now,
+		unhealthy: req.GetUnhealthyEndpoints(),
+	}
+
+	// Count unhealthy reports from live replicas, forgetting replicas that stopped syncing
+	reports := make(map[string]int)
+	for id, replica := range s.replicas {
+		if now.Sub(replica.lastSync) > s.options.ReplicaTTL {
+			delete(s.replicas, id)
+			continue
+		}
+		for _, address := range replica.unhealthy {
+			reports[address]++
+		}
+	}
+	var unhealthy []string
+	for address, count := range reports {
+		if count >= s.options.UnhealthyReplicas {
+			unhealthy = append(unhealthy, address)
+		}
+	}
+	sort.Strings(unhealthy)
+
+	usage := make(map[string]int64, len(s.quotaUsage))
+	for key, value := range s.quotaUsage {
+		usage[key] = value
+	}
+	return &SyncResponse{
+		QuotaUsage:         usage,
+		WindowStart:        timestamppb.New(s.windowStart),
+		UnhealthyEndpoints: unhealthy,
+		LiveReplicas:       int32(len(s.replicas)),
+	}, nil
+}
@@ -0,0 +1,145 @@
+package debugstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace is the captured decision trace of a single request
+type Trace struct {
+	RequestID  string    `json:"request_id"`
+	CapturedAt time.Time `json:"captured_at"`
+	// Why the trace was captured, e.g. slo_breach
+	Reason string `json:"reason"`
+	// Total request latency and the time spent in each pipeline stage
+	TotalSeconds  float64            `json:"total_seconds"`
+	StageSeconds  map[string]float64 `json:"stage_seconds"`
+	DominantStage string             `json:"dominant_stage"`
+	// Request headers with sensitive values redacted
+	Headers map[string]string `json:"headers,omitempty"`
+	// Decision record of the request as JSON
+	Decision json.RawMessage `json:"decision,omitempty"`
+}
+
+// Options holds options for creating a new debug store
+type Options struct {
+	// Number of traces kept, oldest evicted first
+	MaxTraces int
+	// Directory each trace is also written to as a JSON file, empty to keep
+	// traces in memory only. Files are pruned along with evicted traces.
+	Directory string
+}
+
+// Store keeps the most recent captured traces for debugging
+type Store struct {
+	options Options
+
+	mu     sync.Mutex
+	traces []*Trace
+}
+
+// New creates a new debug store with the given options
+func New(options Options) (*Store, error) {
+	if options.MaxTraces <= 0 {
+		options.MaxTraces = 100
+	}
+	if options.Directory != "" {
+		if err := os.MkdirAll(options.Directory, 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create debug store directory: %w", err)
+		}
+	}
+	return &Store{options: options}, nil
+}
+
+// Add stores a trace, evicting the oldest one when the store is full
+func (s *Store) Add(trace *Trace) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.traces = append(s.traces, trace)
+	var evicted []*Trace
+	if overflow := len(s.traces) - s.options.MaxTraces; overflow > 0 {
+		evicted = append(evicted, s.traces[:overflow]...)
+		s.traces = append([]*Trace(nil), s.traces[overflow:]...)
+	}
+	s.mu.Unlock()
+
+	if s.options.Directory == "" {
+		return
+	}
+	if err := s.writeFile(trace); err != nil {
+		log.Printf("Error writing debug trace for request %s: %v", trace.RequestID, err)
+	}
+	for _, old := range evicted {
+		if err := os.Remove(s.path(old)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error pruning debug trace for request %s: %v", old.RequestID, err)
+		}
+	}
+}
+
+// List returns the stored traces, newest first
+func (s *Store) List() []*Trace {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	traces := make([]*Trace, len(s.traces))
+	for i, trace := range s.traces {
+		traces[len(traces)-1-i] = trace
+	}
+	return traces
+}
+
+// Get returns the newest trace of a request
+func (s *Store) Get(requestID string) (*Trace, bool) {
+	for _, trace := range s.List() {
+		if trace.RequestID == requestID {
+			return trace, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Store) writeFile(trace *Trace) error {
+	data, err := json.MarshalIndent(trace, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(trace), data, 0o640)
+}
+
+// path returns the file a trace is written to, named so files sort by capture time
+func (s *Store) path(trace *Trace) string {
+	id := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, trace.RequestID)
+	return filepath.Join(s.options.Directory, fmt.Sprintf("%s-%s.json", trace.CapturedAt.UTC().Format("20060102T150405.000000000"), id))
+}
+
+// DominantStage returns the stage that took the longest
+func DominantStage(stageSeconds map[string]float64) string {
+	stages := make([]string, 0, len(stageSeconds))
+	for stage := range stageSeconds {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	dominant := ""
+	for _, stage := range stages {
+		if dominant == "" || stageSeconds[stage] > stageSeconds[dominant] {
+			dominant = stage
+		}
+	}
+	return dominant
+}
@@ -0,0 +1,70 @@
+package debugstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreEvictsOldest(t *testing.T) {
+	dir := t.TempDir()
+	store, err := New(Options{MaxTraces: 2, Directory: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	start := time.Now()
+	for i, id := range []string{"req-1", "req/2", "req-3"} {
+		store.Add(&Trace{RequestID: id, CapturedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	traces := store.List()
+	if len(traces) != 2 || traces[0].RequestID != "req-3" || traces[1].RequestID != "req/2" {
+		t.Fatalf("expected the two newest traces newest first, got %+v", traces)
+	}
+	if _, ok := store.Get("req-1"); ok {
+		t.Error("expected req-1 to be evicted")
+	}
+	if trace, ok := store.Get("req/2"); !ok || trace.RequestID != "req/2" {
+		t.Error("expected req/2 to be kept")
+	}
+
+	// Files follow the in-memory traces and never escape the directory
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Errorf("expected 2 trace files, got %v", files)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			t.Errorf("unexpected directory %s in the debug store", entry.Name())
+		}
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	var store *Store
+	store.Add(&Trace{RequestID: "req-1"})
+	if store.List() != nil {
+		t.Error("a nil store must hold no traces")
+	}
+	if _, ok := store.Get("req-1"); ok {
+		t.Error("a nil store must hold no traces")
+	}
+}
+
+func TestDominantStage(t *testing.T) {
+	tests := []struct {
+		stages map[string]float64
+		want   string
+	}{
+		{map[string]float64{}, ""},
+		{map[string]float64{"routing": 0.1, "upstream": 2.5, "response": 0.4}, "upstream"},
+		{map[string]float64{"routing": 1, "request": 1}, "request"},
+	}
+	for _, tt := range tests {
+		if got := DominantStage(tt.stages); got != tt.want {
+			t.Errorf("DominantStage(%v) = %q, want %q", tt.stages, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package decision
+
+import "sort"
+
+// Correction is the category feedback says a routed request belonged to
+type Correction struct {
+	RequestID string `json:"request_id"`
+	Category  string `json:"category"`
+}
+
+// ConfusionOptions holds options for analyzing confused categories
+type ConfusionOptions struct {
+	// Records whose confidence exceeds the runner-up's by less than this are
+	// counted as confused, defaults to 0.1
+	MarginThreshold float32
+	// Maximum example requests kept per pair, defaults to 3
+	MaxExamples int
+}
+
+// Sources of a confusion example
+const (
+	SourceMargin   = "margin"
+	SourceFeedback = "feedback"
+)
+
+// ConfusionExample is a request that contributed to a confused pair
+type ConfusionExample struct {
+	RequestID string `json:"request_id"`
+	// Category the request was routed by and the one it was confused with
+	Routed      string `json:"routed"`
+	Alternative string `json:"alternative"`
+	// Confidence margin over the runner-up, 0 when unknown
+	Margin float32 `json:"margin"`
+	// Prompt excerpt, when the record has one
+	Prompt string `json:"prompt,omitempty"`
+	// Whether the request counted through its margin or through feedback
+	Source string `json:"source"`
+}
+
+// ConfusionPair is an unordered pair of categories the router frequently confuses
+type ConfusionPair struct {
+	Categories [2]string `json:"categories"`
+	// Requests classified with a small margin between the two categories
+	LowMargin int `json:"low_margin"`
+	// Requests routed by one category that feedback corrected to the other
+	Corrections int `json:"corrections"`
+	// Mean margin of the low margin requests
+	MeanMargin float32            `json:"mean_margin"`
+	Examples   []ConfusionExample `json:"examples"`
+}
+
+// Total returns the number of requests counted for the pair
+func (p ConfusionPair) Total() int {
+	return p.LowMargin + p.Corrections
+}
+
+// AnalyzeConfusion finds category pairs that decision records and feedback
+// corrections show are frequently confused, most frequent first. Records
+// without a runner-up category only count through corrections.
+func AnalyzeConfusion(records []*DecisionRecord, corrections []Correction, options ConfusionOptions) []ConfusionPair {
+	if options.MarginThreshold <= 0 {
+		options.MarginThreshold = 0.1
+	}
+	if options.MaxExamples <= 0 {
+		options.MaxExamples = 3
+	}
+
+	pairs := make(map[[2]string]*ConfusionPair)
+	marginSums := make(map[[2]string]float32)
+	pairFor := func(a, b string) *ConfusionPair {
+		key := [2]string{a, b}
+		if b < a {
+			key = [2]string{b, a}
+		}
+		pair, ok := pairs[key]
+		if !ok {
+			pair = &ConfusionPair{Categories: key}
+			pairs[key] = pair
+		}
+		return pair
+	}
+	margin := func(routing *Routing) float32 {
+		if routing.GetRunnerUpCategory() == "" {
+			return 0
+		}
+		return routing.GetConfidence() - routing.GetRunnerUpConfidence()
+	}
+
+	// Retries of a request share its routing, so each request counts once
+	byID := make(map[string]*DecisionRecord, len(records))
+	for _, record := range records {
+		id := record.GetRequestId()
+		if _, seen := byID[id]; seen && id != "" {
+			continue
+		}
+		byID[id] = record
+		routing := record.GetRouting()
+		routed, alternative := routing.GetCategory(), routing.GetRunnerUpCategory()
+		if routed == "" || alternative == "" || routed == alternative {
+			continue
+		}
+		m := margin(routing)
+		if m >= options.MarginThreshold {
+			continue
+		}
+		pair := pairFor(routed, alternative)
+		pair.LowMargin++
+		marginSums[pair.Categories] += m
+		pair.Examples = append(pair.Examples, ConfusionExample{
+			RequestID:   record.GetRequestId(),
+			Routed:      routed,
+			Alternative: alternative,
+			Margin:      m,
+			Prompt:      record.GetPromptExcerpt(),
+			Source:      SourceMargin,
+		})
+	}
+
+	for _, correction := range corrections {
+		record, ok := byID[correction.RequestID]
+		if !ok {
+			continue
+		}
+		routing := record.GetRouting()
+		routed := routing.GetCategory()
+		if routed == "" || correction.Category == "" || routed == correction.Category {
+			continue
+		}
+		pair := pairFor(routed, correction.Category)
+		pair.Corrections++
+		pair.Examples = append(pair.Examples, ConfusionExample{
+			RequestID:   record.GetRequestId(),
+			Routed:      routed,
+			Alternative: correction.Category,
+			Margin:      margin(routing),
+			Prompt:      record.GetPromptExcerpt(),
+			Source:      SourceFeedback,
+		})
+	}
+
+	result := make([]ConfusionPair, 0, len(pairs))
+	for key, pair := range pairs {
+		if pair.LowMargin > 0 {
+			pair.MeanMargin = marginSums[key] / float32(pair.LowMargin)
+		}
+		// Corrected requests are the strongest evidence, then the closest calls
+		sort.SliceStable(pair.Examples, func(i, j int) bool {
+			a, b := pair.Examples[i], pair.Examples[j]
+			if a.Source != b.Source {
+				return a.Source == SourceFeedback
+			}
+			return a.Margin < b.Margin
+		})
+		if len(pair.Examples) > options.MaxExamples {
+			pair.Examples = pair.Examples[:options.MaxExamples]
+		}
+		result = append(result, *pair)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total() != result[j].Total() {
+			return result[i].Total() > result[j].Total()
+		}
+		if result[i].Categories[0] != result[j].Categories[0] {
+			return result[i].Categories[0] < result[j].Categories[0]
+		}
+		return result[i].Categories[1] < result[j].Categories[1]
+	})
+	return result
+}
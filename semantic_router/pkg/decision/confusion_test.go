@@ -0,0 +1,77 @@
+package decision
+
+import (
+	"reflect"
+	"testing"
+)
+
+func classifiedRecord(id, category string, confidence float32, runnerUp string, runnerUpConfidence float32) *DecisionRecord {
+	record := New(id)
+	record.Routing.Category = category
+	record.Routing.Confidence = confidence
+	record.Routing.RunnerUpCategory = runnerUp
+	record.Routing.RunnerUpConfidence = runnerUpConfidence
+	record.PromptExcerpt = "prompt " + id
+	return record
+}
+
+func TestAnalyzeConfusion(t *testing.T) {
+	records := []*DecisionRecord{
+		classifiedRecord("1", "math", 0.52, "physics", 0.48),
+		classifiedRecord("2", "physics", 0.50, "math", 0.45),
+		classifiedRecord("3", "math", 0.55, "physics", 0.40),
+		classifiedRecord("4", "law", 0.51, "business", 0.49),
+		classifiedRecord("5", "law", 0.90, "business", 0.05),
+		// Retry of request 1, counted once
+		classifiedRecord("1", "math", 0.52, "physics", 0.48),
+		// Older record without a runner-up
+		classifiedRecord("6", "history", 0.70, "", 0),
+	}
+	corrections := []Correction{
+		{RequestID: "3", Category: "physics"},
+		{RequestID: "5", Category: "business"},
+		{RequestID: "6", Category: "philosophy"},
+		// Confirmations and unknown requests are ignored
+		{RequestID: "2", Category: "physics"},
+		{RequestID: "missing", Category: "math"},
+	}
+
+	pairs := AnalyzeConfusion(records, corrections, ConfusionOptions{MaxExamples: 2})
+
+	var got [][2]string
+	for _, pair := range pairs {
+		got = append(got, pair.Categories)
+	}
+	want := [][2]string{{"math", "physics"}, {"business", "law"}, {"history", "philosophy"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got pairs %v, want %v", got, want)
+	}
+
+	mathPhysics := pairs[0]
+	if mathPhysics.LowMargin != 2 || mathPhysics.Corrections != 1 {
+		t.Errorf("math/physics counted %d low margin and %d corrections, want 2 and 1", mathPhysics.LowMargin, mathPhysics.Corrections)
+	}
+	if diff := mathPhysics.MeanMargin - 0.045; diff > 1e-6 || diff < -1e-6 {
+		t.Errorf("math/physics mean margin %f, want 0.045", mathPhysics.MeanMargin)
+	}
+	// The correction comes first, then the closest call
+	if len(mathPhysics.Examples) != 2 || mathPhysics.Examples[0].RequestID != "3" || mathPhysics.Examples[0].Source != SourceFeedback ||
+		mathPhysics.Examples[1].RequestID != "1" || mathPhysics.Examples[1].Prompt != "prompt 1" {
+		t.Errorf("unexpected math/physics examples: %+v", mathPhysics.Examples)
+	}
+
+	businessLaw := pairs[1]
+	if businessLaw.LowMargin != 1 || businessLaw.Corrections != 1 {
+		t.Errorf("business/law counted %d low margin and %d corrections, want 1 and 1", businessLaw.LowMargin, businessLaw.Corrections)
+	}
+}
+
+func TestAnalyzeConfusionNoConfusion(t *testing.T) {
+	records := []*DecisionRecord{
+		classifiedRecord("1", "math", 0.9, "physics", 0.05),
+		classifiedRecord("2", "", 0, "", 0),
+	}
+	if pairs := AnalyzeConfusion(records, nil, ConfusionOptions{}); len(pairs) != 0 {
+		t.Errorf("got pairs %+v for confident records, want none", pairs)
+	}
+}
@@ -0,0 +1,180 @@
+package decision
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SchemaVersion is the version of decision.proto this code was built with.
+// Bump it with every change to the schema.
+const SchemaVersion = 11
+
+// New creates a record for a request stamped with the current schema version and time
+func New(requestID string) *DecisionRecord {
+	return &DecisionRecord{
+		SchemaVersion: SchemaVersion,
+		RequestId:     requestID,
+		Timestamp:     timestamppb.New(time.Now()),
+		Routing:       &Routing{},
+		Endpoint:      &Endpoint{},
+		Usage:         &Usage{},
+	}
+}
+
+// Marshal encodes a record in the binary wire format, used for event streams and storage
+func Marshal(record *DecisionRecord) ([]byte, error) {
+	return proto.Marshal(record)
+}
+
+// MarshalJSON encodes a record as single-line JSON with snake_case field names, used for logs.
+// protojson varies its whitespace between builds, so the output is compacted to
+// keep records byte-stable, as signatures of sealed records require.
+func MarshalJSON(record *DecisionRecord) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		return nil, err
+	}
+	return compacted.Bytes(), nil
+}
+
+// Unmarshal decodes a record from the binary wire format. Fields added by newer
+// producers are kept as unknown fields, so records can be re-encoded without loss.
+func Unmarshal(data []byte) (*DecisionRecord, error) {
+	record := &DecisionRecord{}
+	if err := proto.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("invalid decision record: %w", err)
+	}
+	return record, validate(record)
+}
+
+// UnmarshalJSON decodes a JSON record, ignoring fields added by newer producers
+func UnmarshalJSON(data []byte) (*DecisionRecord, error) {
+	record := &DecisionRecord{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("invalid decision record: %w", err)
+	}
+	return record, validate(record)
+}
+
+// validate rejects records without a schema version, which were not produced by this schema
+func validate(record *DecisionRecord) error {
+	if record.GetSchemaVersion() == 0 {
+		return fmt.Errorf("decision record has no schema version")
+	}
+	return nil
+}
+
+// Sink receives completed decision records
+type Sink interface {
+	Write(record *DecisionRecord)
+}
+
+// Prefixes of decision records in the process log
+const (
+	LogPrefix       = "decision_record "
+	SealedLogPrefix = "decision_record_sealed "
+)
+
+// LogSink writes records to the process log as JSON lines
+type LogSink struct {
+	// Encrypts or signs the records, nil to log them as they are
+	Sealer *Sealer
+}
+
+// Write logs the record
+func (s LogSink) Write(record *DecisionRecord) {
+	if s.Sealer != nil {
+		s.writeSealed(record)
+		return
+	}
+	data, err := MarshalJSON(record)
+	if err != nil {
+		log.Printf("Error encoding decision record: %v", err)
+		return
+	}
+	log.Printf("%s%s", LogPrefix, data)
+}
+
+// writeSealed logs the record sealed as a JSON line
+func (s LogSink) writeSealed(record *DecisionRecord) {
+	sealed, err := s.Sealer.Seal(record)
+	if err != nil {
+		log.Printf("Error sealing decision record: %v", err)
+		return
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		log.Printf("Error encoding decision record: %v", err)
+		return
+	}
+	log.Printf("%s%s", SealedLogPrefix, data)
+}
+
+// MultiSink hands every record to each of its sinks
+type MultiSink []Sink
+
+// Write hands the record to each sink
+func (m MultiSink) Write(record *DecisionRecord) {
+	for _, sink := range m {
+		sink.Write(record)
+	}
+}
+
+// RingSink keeps the most recent records in memory
+type RingSink struct {
+	mu      sync.Mutex
+	records []*DecisionRecord
+	next    int
+	full    bool
+}
+
+// NewRingSink creates a sink keeping the last size records
+func NewRingSink(size int) *RingSink {
+	return &RingSink{records: make([]*DecisionRecord, max(size, 1))}
+}
+
+// Write keeps a copy of the record, replacing the oldest once full
+func (s *RingSink) Write(record *DecisionRecord) {
+	record = proto.Clone(record).(*DecisionRecord)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[s.next] = record
+	s.next = (s.next + 1) % len(s.records)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Recent returns up to limit of the kept records, newest first; limit <= 0
+// returns all of them. Safe to call on a nil sink.
+func (s *RingSink) Recent(limit int) []*DecisionRecord {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.next
+	if s.full {
+		n = len(s.records)
+	}
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	records := make([]*DecisionRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		records = append(records, s.records[(s.next-i+len(s.records))%len(s.records)])
+	}
+	return records
+}
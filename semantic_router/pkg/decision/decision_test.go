@@ -0,0 +1,113 @@
+package decision
+
+import (
+	"slices"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestRecord() *DecisionRecord {
+	record := New("req-1")
+	record.Attempt = 2
+	record.Routing.OriginalModel = "auto"
+	record.Routing.SelectedModel = "phi4"
+	record.Routing.Category = "math"
+	record.Usage.PromptTokens = 10
+	record.Labels = map[string]string{"team": "search"}
+	return record
+}
+
+func TestRoundTrip(t *testing.T) {
+	record := newTestRecord()
+
+	data, err := Marshal(record)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !proto.Equal(record, decoded) {
+		t.Errorf("binary round trip changed the record: %v", decoded)
+	}
+
+	data, err = MarshalJSON(record)
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	decoded, err = UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if !proto.Equal(record, decoded) {
+		t.Errorf("JSON round trip changed the record: %v", decoded)
+	}
+}
+
+func TestRecordsFromNewerProducers(t *testing.T) {
+	record := newTestRecord()
+	data, err := Marshal(record)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// A newer producer added field 100
+	data = protowire.AppendTag(data, 100, protowire.BytesType)
+	data = protowire.AppendString(data, "future")
+
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.GetRouting().GetSelectedModel() != "phi4" {
+		t.Errorf("known fields lost: %v", decoded)
+	}
+	reencoded, err := Marshal(decoded)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if len(reencoded) != len(data) {
+		t.Errorf("unknown field dropped on re-encode: %d bytes, want %d", len(reencoded), len(data))
+	}
+
+	if _, err := UnmarshalJSON([]byte(`{"schema_version":2,"request_id":"req-1","future_field":{"a":1}}`)); err != nil {
+		t.Errorf("UnmarshalJSON rejected a record with a newer field: %v", err)
+	}
+}
+
+func TestUnversionedRecordsAreRejected(t *testing.T) {
+	if _, err := UnmarshalJSON([]byte(`{"request_id":"req-1"}`)); err == nil {
+		t.Error("expected an error for a record without a schema version")
+	}
+	if _, err := Unmarshal(nil); err == nil {
+		t.Error("expected an error for an empty record")
+	}
+}
+
+func TestRingSinkKeepsNewest(t *testing.T) {
+	sink := NewRingSink(3)
+	if got := sink.Recent(0); len(got) != 0 {
+		t.Fatalf("empty sink returned %d records", len(got))
+	}
+	for _, id := range []string{"req-1", "req-2", "req-3", "req-4"} {
+		sink.Write(New(id))
+	}
+	var ids []string
+	for _, record := range sink.Recent(0) {
+		ids = append(ids, record.RequestId)
+	}
+	if want := []string{"req-4", "req-3", "req-2"}; !slices.Equal(ids, want) {
+		t.Errorf("Recent(0) = %v, want %v", ids, want)
+	}
+	if got := sink.Recent(1); len(got) != 1 || got[0].RequestId != "req-4" {
+		t.Errorf("Recent(1) = %v, want req-4", got)
+	}
+
+	var none *RingSink
+	if got := none.Recent(0); got != nil {
+		t.Errorf("nil sink returned %v", got)
+	}
+}
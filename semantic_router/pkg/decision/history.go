@@ -0,0 +1,55 @@
+package decision
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ReadLog reads decision records from JSON lines, either bare or in router
+// log lines, skipping anything else. Sealed records are opened with the
+// sealer, and skipped without one. It returns the records in the order read
+// and how many lines looked like records but could not be read.
+func ReadLog(r io.Reader, sealer *Sealer) (records []*DecisionRecord, skipped int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		sealed := false
+		if i := strings.Index(line, SealedLogPrefix); i >= 0 {
+			line, sealed = line[i+len(SealedLogPrefix):], true
+		} else if i := strings.Index(line, LogPrefix); i >= 0 {
+			line = line[i+len(LogPrefix):]
+		}
+		if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+			continue
+		}
+		var record *DecisionRecord
+		var err error
+		if sealed {
+			record, err = openLine(line, sealer)
+		} else {
+			record, err = UnmarshalJSON([]byte(line))
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, skipped, scanner.Err()
+}
+
+// openLine decodes and opens a sealed record
+func openLine(line string, sealer *Sealer) (*DecisionRecord, error) {
+	if sealer == nil {
+		return nil, errors.New("decision record is sealed but no keys are set")
+	}
+	var sealed SealedRecord
+	if err := json.Unmarshal([]byte(line), &sealed); err != nil {
+		return nil, err
+	}
+	return sealer.Open(&sealed)
+}
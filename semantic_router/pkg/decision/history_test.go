@@ -0,0 +1,41 @@
+package decision
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestReadLog(t *testing.T) {
+	var buf bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&buf)
+	sealer, _ := NewSealer(Keys{Encryption: bytes.Repeat([]byte{1}, 32)})
+	LogSink{}.Write(newTestRecord())
+	LogSink{Sealer: sealer}.Write(newTestRecord())
+	log.SetOutput(output)
+	bare, _ := MarshalJSON(newTestRecord())
+	buf.WriteString("Starting router\n")
+	buf.Write(bare)
+	buf.WriteString("\ndecision_record {\"schema_version\": \"broken\"}\n")
+
+	records, skipped, err := ReadLog(strings.NewReader(buf.String()), sealer)
+	if err != nil {
+		t.Fatalf("ReadLog: %v", err)
+	}
+	if len(records) != 3 || skipped != 1 {
+		t.Fatalf("read %d records, skipped %d, want 3 and 1", len(records), skipped)
+	}
+	for _, record := range records {
+		if record.GetRouting().GetSelectedModel() != "phi4" {
+			t.Errorf("unexpected record %v", record)
+		}
+	}
+
+	// Without keys sealed records are skipped
+	records, skipped, _ = ReadLog(strings.NewReader(buf.String()), nil)
+	if len(records) != 2 || skipped != 2 {
+		t.Errorf("read %d records, skipped %d without keys, want 2 and 2", len(records), skipped)
+	}
+}
@@ -0,0 +1,202 @@
+package decision
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PromptLengthOptions holds options for analyzing prompt lengths
+type PromptLengthOptions struct {
+	// Returns the models of a category in order of preference, the first
+	// being its primary model; the category is "" for requests routed by no
+	// category
+	Models func(category string) []string
+	// Returns the context window of a model in tokens, 0 when unknown
+	ContextWindow func(model string) int
+	// Share of a category's prompts that may exceed the context window of its
+	// primary model before it is warned about, defaults to 0.05
+	MaxExceedingShare float64
+	// Categories with fewer requests are not warned about, defaults to 20
+	MinRequests int
+}
+
+// promptLengthBounds are the upper bounds in tokens of the prompt length
+// histogram buckets, followed by a bucket of longer prompts
+var promptLengthBounds = []int64{512, 1024, 2048, 4096, 8192, 16384, 32768, 65536, 131072}
+
+// PromptLengthBucket counts the prompts of a category up to a length
+type PromptLengthBucket struct {
+	// Upper bound in tokens, 0 for the bucket of prompts longer than the last bound
+	UpTo  int64 `json:"up_to,omitempty"`
+	Count int   `json:"count"`
+}
+
+// CategoryPromptLengths is the distribution of the prompt lengths of a
+// category, compared against the context windows of its models
+type CategoryPromptLengths struct {
+	// Category the requests were routed by, "" for none
+	Category string `json:"category"`
+	Requests int    `json:"requests"`
+	// Percentiles and maximum of the prompt lengths in tokens
+	P50       int64                `json:"p50_tokens"`
+	P90       int64                `json:"p90_tokens"`
+	P99       int64                `json:"p99_tokens"`
+	Max       int64                `json:"max_tokens"`
+	Histogram []PromptLengthBucket `json:"histogram"`
+	// Primary model of the category and its context window, 0 when unknown
+	PrimaryModel  string `json:"primary_model"`
+	ContextWindow int    `json:"context_window,omitempty"`
+	// Prompts longer than the primary model's context window, and their share
+	// of the category's
+	ExceedingPrimary int     `json:"exceeding_primary"`
+	ExceedingShare   float64 `json:"exceeding_share"`
+	// Prompts longer than the context window of the model they were routed to
+	ExceedingSelected int `json:"exceeding_selected"`
+	// Model of the category with the smallest context window fitting the p99
+	// prompt, when the primary model's does not
+	SuggestedModel string `json:"suggested_model,omitempty"`
+	// Why the category looks misconfigured, if it does
+	Warning string `json:"warning,omitempty"`
+}
+
+// PromptLengthReport is the prompt length distribution of each category
+type PromptLengthReport struct {
+	// Requests with a known prompt length
+	Requests   int                     `json:"requests"`
+	Categories []CategoryPromptLengths `json:"categories"`
+	// Warnings of the misconfigured categories, most exceeding first
+	Warnings []string `json:"warnings"`
+}
+
+// promptTokens returns the prompt length of a record in tokens, as reported
+// by the model or else as estimated by the router, 0 when unknown
+func promptTokens(record *DecisionRecord) int64 {
+	if tokens := record.GetUsage().GetPromptTokens(); tokens > 0 {
+		return tokens
+	}
+	return record.GetUsage().GetEstimatedPromptTokens()
+}
+
+// percentile returns the p-th percentile of sorted lengths
+func percentile(sorted []int64, p float64) int64 {
+	index := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(index, 0), len(sorted)-1)]
+}
+
+// AnalyzePromptLengths compares the prompt lengths of the requests of each
+// category in decision records against the context windows of the category's
+// models, warning about categories whose prompts often exceed their primary
+// model's. Records without a prompt length are skipped.
+func AnalyzePromptLengths(records []*DecisionRecord, options PromptLengthOptions) PromptLengthReport {
+	if options.MaxExceedingShare <= 0 {
+		options.MaxExceedingShare = 0.05
+	}
+	if options.MinRequests <= 0 {
+		options.MinRequests = 20
+	}
+	contextWindow := func(model string) int {
+		if options.ContextWindow == nil || model == "" {
+			return 0
+		}
+		return options.ContextWindow(model)
+	}
+
+	// Retries of a request share its prompt, so each request counts once
+	type category struct {
+		lengths           []int64
+		exceedingSelected int
+	}
+	categories := make(map[string]*category)
+	seen := make(map[string]bool, len(records))
+	report := PromptLengthReport{Categories: []CategoryPromptLengths{}, Warnings: []string{}}
+	for _, record := range records {
+		tokens := promptTokens(record)
+		if tokens <= 0 {
+			continue
+		}
+		if id := record.GetRequestId(); id != "" {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		name := record.GetRouting().GetCategory()
+		c, ok := categories[name]
+		if !ok {
+			c = &category{}
+			categories[name] = c
+		}
+		c.lengths = append(c.lengths, tokens)
+		if window := contextWindow(record.GetRouting().GetSelectedModel()); window > 0 && tokens > int64(window) {
+			c.exceedingSelected++
+		}
+		report.Requests++
+	}
+
+	for name, c := range categories {
+		sort.Slice(c.lengths, func(i, j int) bool { return c.lengths[i] < c.lengths[j] })
+		lengths := CategoryPromptLengths{
+			Category:          name,
+			Requests:          len(c.lengths),
+			P50:               percentile(c.lengths, 0.5),
+			P90:               percentile(c.lengths, 0.9),
+			P99:               percentile(c.lengths, 0.99),
+			Max:               c.lengths[len(c.lengths)-1],
+			ExceedingSelected: c.exceedingSelected,
+		}
+		buckets := make([]PromptLengthBucket, len(promptLengthBounds)+1)
+		for i, bound := range promptLengthBounds {
+			buckets[i].UpTo = bound
+		}
+		for _, length := range c.lengths {
+			buckets[sort.Search(len(promptLengthBounds), func(i int) bool { return length <= promptLengthBounds[i] })].Count++
+		}
+		lengths.Histogram = buckets
+
+		var models []string
+		if options.Models != nil {
+			models = options.Models(name)
+		}
+		if len(models) > 0 {
+			lengths.PrimaryModel = models[0]
+			lengths.ContextWindow = contextWindow(models[0])
+		}
+		if lengths.ContextWindow > 0 {
+			window := int64(lengths.ContextWindow)
+			lengths.ExceedingPrimary = len(c.lengths) - sort.Search(len(c.lengths), func(i int) bool { return c.lengths[i] > window })
+			lengths.ExceedingShare = float64(lengths.ExceedingPrimary) / float64(len(c.lengths))
+		}
+		if lengths.Requests >= options.MinRequests && lengths.ExceedingShare > options.MaxExceedingShare {
+			// The other models of the category may fit its long prompts
+			suggestedWindow := 0
+			for _, model := range models[1:] {
+				if window := contextWindow(model); int64(window) >= lengths.P99 && (suggestedWindow == 0 || window < suggestedWindow) {
+					lengths.SuggestedModel, suggestedWindow = model, window
+				}
+			}
+			label := fmt.Sprintf("%q", name)
+			if name == "" {
+				label = "uncategorized"
+			}
+			lengths.Warning = fmt.Sprintf("%.0f%% of %s prompts (%d of %d) exceed the %d-token context window of primary model %s; p99 is %d tokens",
+				100*lengths.ExceedingShare, label, lengths.ExceedingPrimary, lengths.Requests, lengths.ContextWindow, lengths.PrimaryModel, lengths.P99)
+			if lengths.SuggestedModel != "" {
+				lengths.Warning += fmt.Sprintf("; consider ranking %s (%d tokens) first", lengths.SuggestedModel, suggestedWindow)
+			}
+		}
+		report.Categories = append(report.Categories, lengths)
+	}
+
+	sort.Slice(report.Categories, func(i, j int) bool { return report.Categories[i].Category < report.Categories[j].Category })
+	warned := make([]CategoryPromptLengths, 0, len(report.Categories))
+	for _, lengths := range report.Categories {
+		if lengths.Warning != "" {
+			warned = append(warned, lengths)
+		}
+	}
+	sort.SliceStable(warned, func(i, j int) bool { return warned[i].ExceedingShare > warned[j].ExceedingShare })
+	for _, lengths := range warned {
+		report.Warnings = append(report.Warnings, lengths.Warning)
+	}
+	return report
+}
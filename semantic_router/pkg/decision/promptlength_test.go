@@ -0,0 +1,84 @@
+package decision
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func promptRecord(id, category, model string, promptTokens, estimatedTokens int64) *DecisionRecord {
+	record := New(id)
+	record.Routing.Category = category
+	record.Routing.SelectedModel = model
+	record.Usage.PromptTokens = promptTokens
+	record.Usage.EstimatedPromptTokens = estimatedTokens
+	return record
+}
+
+func TestAnalyzePromptLengths(t *testing.T) {
+	var records []*DecisionRecord
+	// 3 of 10 coding prompts exceed the small model's 4k window
+	for i := 0; i < 10; i++ {
+		tokens := int64(1000)
+		if i < 3 {
+			tokens = 6000
+		}
+		records = append(records, promptRecord(fmt.Sprintf("c%d", i), "coding", "small-model", tokens, 0))
+	}
+	records = append(records,
+		// Retry of a request, counted once
+		promptRecord("c0", "coding", "large-model", 6000, 0),
+		// Estimated before routing when the model reported no usage
+		promptRecord("m1", "math", "small-model", 0, 300),
+		// Unknown prompt length
+		promptRecord("m2", "math", "small-model", 0, 0),
+		promptRecord("u1", "", "default-model", 200000, 0),
+	)
+	models := map[string][]string{
+		"coding": {"small-model", "huge-model", "large-model", "default-model"},
+		"math":   {"small-model", "default-model"},
+		"":       {"default-model"},
+	}
+	windows := map[string]int{"small-model": 4096, "large-model": 8192, "huge-model": 131072, "default-model": 32768}
+
+	report := AnalyzePromptLengths(records, PromptLengthOptions{
+		Models:        func(category string) []string { return models[category] },
+		ContextWindow: func(model string) int { return windows[model] },
+		MinRequests:   1,
+	})
+	if report.Requests != 12 || len(report.Categories) != 3 {
+		t.Fatalf("report of %d requests in %d categories, want 12 in 3", report.Requests, len(report.Categories))
+	}
+
+	uncategorized, coding, math := report.Categories[0], report.Categories[1], report.Categories[2]
+	if coding.Category != "coding" || coding.Requests != 10 || coding.P50 != 1000 || coding.P99 != 6000 || coding.Max != 6000 {
+		t.Errorf("coding lengths = %+v", coding)
+	}
+	if coding.PrimaryModel != "small-model" || coding.ContextWindow != 4096 || coding.ExceedingPrimary != 3 || coding.ExceedingShare != 0.3 || coding.ExceedingSelected != 3 {
+		t.Errorf("coding windows = %+v", coding)
+	}
+	if coding.SuggestedModel != "large-model" || !strings.Contains(coding.Warning, `30% of "coding" prompts (3 of 10)`) {
+		t.Errorf("coding suggestion %q, warning %q", coding.SuggestedModel, coding.Warning)
+	}
+	if counts := coding.Histogram; counts[1].UpTo != 1024 || counts[1].Count != 7 || counts[4].UpTo != 8192 || counts[4].Count != 3 {
+		t.Errorf("coding histogram = %+v", counts)
+	}
+	if math.Requests != 1 || math.P50 != 300 || math.Warning != "" {
+		t.Errorf("math lengths = %+v", math)
+	}
+	if last := uncategorized.Histogram[len(uncategorized.Histogram)-1]; last.UpTo != 0 || last.Count != 1 {
+		t.Errorf("uncategorized overflow bucket = %+v", last)
+	}
+	if len(report.Warnings) != 2 || !strings.HasPrefix(report.Warnings[0], "100% of uncategorized prompts") || report.Warnings[1] != coding.Warning {
+		t.Errorf("warnings = %q", report.Warnings)
+	}
+
+	// Categories with few requests are not warned about
+	report = AnalyzePromptLengths(records, PromptLengthOptions{
+		Models:        func(category string) []string { return models[category] },
+		ContextWindow: func(model string) int { return windows[model] },
+	})
+	if len(report.Warnings) != 0 {
+		t.Errorf("warnings below the default minimum requests = %q", report.Warnings)
+	}
+}
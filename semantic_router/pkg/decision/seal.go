@@ -0,0 +1,141 @@
+package decision
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrBadSignature is returned when opening a sealed record whose signature is
+// missing or does not match its content
+var ErrBadSignature = errors.New("decision record signature mismatch")
+
+// Keys are the keys records are sealed with. Either may be nil.
+type Keys struct {
+	// AES key of 16, 24 or 32 bytes encrypting records with AES-GCM
+	Encryption []byte
+	// HMAC-SHA256 key signing records
+	Signing []byte
+}
+
+// LoadKeys reads base64 encoded keys from the named environment variables,
+// leaving keys with an empty name nil
+func LoadKeys(encryptionKeyEnv, signingKeyEnv string) (Keys, error) {
+	var keys Keys
+	var err error
+	if keys.Encryption, err = loadKey(encryptionKeyEnv); err != nil {
+		return Keys{}, err
+	}
+	if keys.Signing, err = loadKey(signingKeyEnv); err != nil {
+		return Keys{}, err
+	}
+	return keys, nil
+}
+
+func loadKey(env string) ([]byte, error) {
+	if env == "" {
+		return nil, nil
+	}
+	value := os.Getenv(env)
+	if value == "" {
+		return nil, fmt.Errorf("%s is not set", env)
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64 encoded: %w", env, err)
+	}
+	return key, nil
+}
+
+// SealedRecord is a decision record encrypted, signed or both. Encrypted
+// records carry their nonce and ciphertext instead of the record. The
+// signature covers the record, or the nonce and ciphertext when encrypted.
+type SealedRecord struct {
+	Record     json.RawMessage `json:"record,omitempty"`
+	Nonce      []byte          `json:"nonce,omitempty"`
+	Ciphertext []byte          `json:"ciphertext,omitempty"`
+	Signature  []byte          `json:"signature,omitempty"`
+}
+
+// Sealer encrypts and signs decision records, and verifies and decrypts them
+type Sealer struct {
+	aead       cipher.AEAD
+	signingKey []byte
+}
+
+// NewSealer creates a sealer with the given keys, at least one of which must be set
+func NewSealer(keys Keys) (*Sealer, error) {
+	if keys.Encryption == nil && keys.Signing == nil {
+		return nil, errors.New("no encryption or signing key")
+	}
+	s := &Sealer{signingKey: keys.Signing}
+	if keys.Encryption != nil {
+		block, err := aes.NewCipher(keys.Encryption)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+		if s.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Seal encodes the record as JSON, then encrypts and signs it with the keys set
+func (s *Sealer) Seal(record *DecisionRecord) (*SealedRecord, error) {
+	data, err := MarshalJSON(record)
+	if err != nil {
+		return nil, err
+	}
+	sealed := &SealedRecord{Record: data}
+	if s.aead != nil {
+		sealed.Nonce = make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(sealed.Nonce); err != nil {
+			return nil, err
+		}
+		sealed.Ciphertext = s.aead.Seal(nil, sealed.Nonce, data, nil)
+		sealed.Record = nil
+	}
+	if s.signingKey != nil {
+		sealed.Signature = s.sign(sealed)
+	}
+	return sealed, nil
+}
+
+// Open verifies the signature of a sealed record when the sealer has a
+// signing key, and decrypts it when encrypted
+func (s *Sealer) Open(sealed *SealedRecord) (*DecisionRecord, error) {
+	if s.signingKey != nil && !hmac.Equal(sealed.Signature, s.sign(sealed)) {
+		return nil, ErrBadSignature
+	}
+	data := []byte(sealed.Record)
+	if sealed.Ciphertext != nil {
+		if s.aead == nil {
+			return nil, errors.New("decision record is encrypted but no encryption key is set")
+		}
+		var err error
+		if data, err = s.aead.Open(nil, sealed.Nonce, sealed.Ciphertext, nil); err != nil {
+			return nil, fmt.Errorf("failed to decrypt decision record: %w", err)
+		}
+	}
+	return UnmarshalJSON(data)
+}
+
+// sign returns the HMAC of the signed content of a sealed record
+func (s *Sealer) sign(sealed *SealedRecord) []byte {
+	mac := hmac.New(sha256.New, s.signingKey)
+	if sealed.Ciphertext != nil {
+		mac.Write(sealed.Nonce)
+		mac.Write(sealed.Ciphertext)
+	} else {
+		mac.Write(sealed.Record)
+	}
+	return mac.Sum(nil)
+}
@@ -0,0 +1,123 @@
+package decision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestSealRoundTrip(t *testing.T) {
+	encryption := bytes.Repeat([]byte{1}, 32)
+	signing := []byte("signing-key")
+	tests := []struct {
+		name          string
+		keys          Keys
+		wantPlaintext bool
+	}{
+		{"encrypted and signed", Keys{Encryption: encryption, Signing: signing}, false},
+		{"encrypted", Keys{Encryption: encryption}, false},
+		{"signed", Keys{Signing: signing}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealer, err := NewSealer(tt.keys)
+			if err != nil {
+				t.Fatalf("NewSealer: %v", err)
+			}
+			sealed, err := sealer.Seal(newTestRecord())
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			data, _ := json.Marshal(sealed)
+			if got := bytes.Contains(data, []byte("phi4")); got != tt.wantPlaintext {
+				t.Errorf("sealed record contains the selected model: %v, want %v", got, tt.wantPlaintext)
+			}
+
+			var decoded SealedRecord
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("invalid sealed record: %v", err)
+			}
+			record, err := sealer.Open(&decoded)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if record.RequestId != "req-1" || record.Routing.SelectedModel != "phi4" {
+				t.Errorf("unexpected opened record: %v", record)
+			}
+		})
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	sealer, _ := NewSealer(Keys{Signing: []byte("signing-key")})
+	sealed, err := sealer.Seal(newTestRecord())
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	sealed.Record = bytes.Replace(sealed.Record, []byte("phi4"), []byte("gpt4"), 1)
+	if _, err := sealer.Open(sealed); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Open of a tampered record = %v, want ErrBadSignature", err)
+	}
+
+	other, _ := NewSealer(Keys{Signing: []byte("other-key")})
+	sealed, _ = sealer.Seal(newTestRecord())
+	if _, err := other.Open(sealed); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Open with another key = %v, want ErrBadSignature", err)
+	}
+
+	encrypted, _ := NewSealer(Keys{Encryption: bytes.Repeat([]byte{1}, 16)})
+	sealed, _ = encrypted.Seal(newTestRecord())
+	sealed.Ciphertext[0] ^= 1
+	if _, err := encrypted.Open(sealed); err == nil {
+		t.Error("expected an error decrypting a tampered record")
+	}
+}
+
+func TestNewSealerValidatesKeys(t *testing.T) {
+	if _, err := NewSealer(Keys{}); err == nil {
+		t.Error("expected an error without keys")
+	}
+	if _, err := NewSealer(Keys{Encryption: []byte("short")}); err == nil {
+		t.Error("expected an error for an invalid AES key")
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	t.Setenv("TEST_DECISION_ENCRYPTION_KEY", "AQEBAQEBAQEBAQEBAQEBAQ==")
+	t.Setenv("TEST_DECISION_BAD_KEY", "not base64!")
+	keys, err := LoadKeys("TEST_DECISION_ENCRYPTION_KEY", "")
+	if err != nil || len(keys.Encryption) != 16 || keys.Signing != nil {
+		t.Errorf("LoadKeys = %v, %v, want a 16 byte encryption key only", keys, err)
+	}
+	if _, err := LoadKeys("", "TEST_DECISION_UNSET_KEY"); err == nil {
+		t.Error("expected an error for an unset variable")
+	}
+	if _, err := LoadKeys("TEST_DECISION_BAD_KEY", ""); err == nil {
+		t.Error("expected an error for a key that is not base64")
+	}
+}
+
+func TestLogSinkSeals(t *testing.T) {
+	var buf bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(output)
+	sealer, _ := NewSealer(Keys{Encryption: bytes.Repeat([]byte{1}, 32)})
+	LogSink{Sealer: sealer}.Write(newTestRecord())
+
+	line := buf.String()
+	i := strings.Index(line, SealedLogPrefix)
+	if i < 0 || strings.Contains(line, "phi4") {
+		t.Fatalf("expected an encrypted record in the log, got %q", line)
+	}
+	var sealed SealedRecord
+	if err := json.Unmarshal([]byte(line[i+len(SealedLogPrefix):]), &sealed); err != nil {
+		t.Fatalf("invalid sealed record: %v", err)
+	}
+	if record, err := sealer.Open(&sealed); err != nil || record.RequestId != "req-1" {
+		t.Errorf("Open = %v, %v", record, err)
+	}
+}
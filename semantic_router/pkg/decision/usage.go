@@ -0,0 +1,203 @@
+package decision
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// Dimensions usage can be grouped by, besides labels named label:<name>
+const (
+	UsageByTenant      = "tenant"
+	UsageByModel       = "model"
+	UsageByCategory    = "category"
+	UsageByApplication = "application"
+	UsageByDay         = "day"
+)
+
+// usageLabelPrefix names a record label as a usage dimension
+const usageLabelPrefix = "label:"
+
+// UsageOptions holds options for aggregating usage for export. Groups too
+// small to hide the individuals in them are suppressed, and with an epsilon
+// the statistics of the remaining groups are noised, so exports can't be
+// used to reconstruct the behavior of a single user.
+type UsageOptions struct {
+	// Dimensions the requests are grouped by, in order
+	GroupBy []string
+	// Dimension identifying individuals, e.g. label:user; groups must contain
+	// MinGroupSize distinct individuals. Requests count as individuals when
+	// empty.
+	Identity string
+	// Groups with fewer individuals are suppressed, defaults to 10
+	MinGroupSize int
+	// Privacy budget of the Laplace noise added to each statistic of each
+	// group, smaller is noisier; 0 adds no noise
+	Epsilon float64
+	// Tokens a request contributes to token sums at most when noised, bounding
+	// their sensitivity; defaults to 8192
+	MaxRequestTokens int64
+	// Source of the noise, defaults to one seeded from crypto/rand
+	Rand *rand.Rand
+}
+
+// UsageGroup is the usage of the requests sharing the values of the dimensions
+type UsageGroup struct {
+	// Values of the grouping dimensions by dimension
+	Key              map[string]string `json:"key"`
+	Requests         int64             `json:"requests"`
+	PromptTokens     int64             `json:"prompt_tokens"`
+	CompletionTokens int64             `json:"completion_tokens"`
+}
+
+// UsageReport is the usage of a set of decision records fit for export
+type UsageReport struct {
+	GroupBy []string     `json:"group_by"`
+	Groups  []UsageGroup `json:"groups"`
+	// Groups left out for having too few individuals
+	SuppressedGroups int `json:"suppressed_groups"`
+	// Minimum group size and privacy budget the report was made with
+	MinGroupSize int     `json:"min_group_size"`
+	Epsilon      float64 `json:"epsilon,omitempty"`
+}
+
+// ValidateUsageDimension checks a dimension usage can be grouped by
+func ValidateUsageDimension(dimension string) error {
+	switch dimension {
+	case UsageByTenant, UsageByModel, UsageByCategory, UsageByApplication, UsageByDay:
+		return nil
+	}
+	if name, ok := strings.CutPrefix(dimension, usageLabelPrefix); ok && name != "" {
+		return nil
+	}
+	return fmt.Errorf("unknown usage dimension %q: must be %s, %s, %s, %s, %s or %s<name>", dimension,
+		UsageByTenant, UsageByModel, UsageByCategory, UsageByApplication, UsageByDay, usageLabelPrefix)
+}
+
+// usageDimension returns the value of a dimension of a record
+func usageDimension(record *DecisionRecord, dimension string) string {
+	switch dimension {
+	case UsageByTenant:
+		return record.GetRouting().GetTenant()
+	case UsageByModel:
+		return record.GetRouting().GetSelectedModel()
+	case UsageByCategory:
+		return record.GetRouting().GetCategory()
+	case UsageByApplication:
+		return record.GetRouting().GetApplication()
+	case UsageByDay:
+		return record.GetTimestamp().AsTime().UTC().Format("2006-01-02")
+	}
+	return record.GetLabels()[strings.TrimPrefix(dimension, usageLabelPrefix)]
+}
+
+// AggregateUsage groups the usage of the requests of decision records by the
+// dimensions, suppressing groups of fewer than MinGroupSize individuals and
+// noising the others when an epsilon is set. Shadow records are left out, as
+// they were not served as recorded.
+func AggregateUsage(records []*DecisionRecord, options UsageOptions) (UsageReport, error) {
+	for _, dimension := range options.GroupBy {
+		if err := ValidateUsageDimension(dimension); err != nil {
+			return UsageReport{}, err
+		}
+	}
+	if options.Identity != "" {
+		if err := ValidateUsageDimension(options.Identity); err != nil {
+			return UsageReport{}, err
+		}
+	}
+	if options.MinGroupSize <= 0 {
+		options.MinGroupSize = 10
+	}
+	if options.MaxRequestTokens <= 0 {
+		options.MaxRequestTokens = 8192
+	}
+	if options.Epsilon > 0 && options.Rand == nil {
+		var seed [32]byte
+		crand.Read(seed[:])
+		options.Rand = rand.New(rand.NewChaCha8(seed))
+	}
+
+	type group struct {
+		usage       UsageGroup
+		requests    map[string]bool
+		individuals map[string]bool
+	}
+	groups := make(map[string]*group)
+	for _, record := range records {
+		if record.GetShadow() {
+			continue
+		}
+		values := make([]string, len(options.GroupBy))
+		for i, dimension := range options.GroupBy {
+			values[i] = usageDimension(record, dimension)
+		}
+		key := strings.Join(values, "\x00")
+		g := groups[key]
+		if g == nil {
+			g = &group{
+				usage:       UsageGroup{Key: make(map[string]string, len(values))},
+				requests:    make(map[string]bool),
+				individuals: make(map[string]bool),
+			}
+			for i, dimension := range options.GroupBy {
+				g.usage.Key[dimension] = values[i]
+			}
+			groups[key] = g
+		}
+		prompt, completion := record.GetUsage().GetPromptTokens(), record.GetUsage().GetCompletionTokens()
+		if options.Epsilon > 0 {
+			prompt, completion = min(prompt, options.MaxRequestTokens), min(completion, options.MaxRequestTokens)
+		}
+		// Retries of a request are attempts of the same request
+		g.requests[record.GetRequestId()] = true
+		g.usage.PromptTokens += prompt
+		g.usage.CompletionTokens += completion
+		individual := record.GetRequestId()
+		if options.Identity != "" {
+			individual = usageDimension(record, options.Identity)
+		}
+		g.individuals[individual] = true
+	}
+
+	report := UsageReport{GroupBy: options.GroupBy, Groups: []UsageGroup{}, MinGroupSize: options.MinGroupSize, Epsilon: options.Epsilon}
+	for _, g := range groups {
+		if len(g.individuals) < options.MinGroupSize {
+			report.SuppressedGroups++
+			continue
+		}
+		usage := g.usage
+		usage.Requests = int64(len(g.requests))
+		if options.Epsilon > 0 {
+			usage.Requests = noised(usage.Requests, 1/options.Epsilon, options.Rand)
+			tokenScale := float64(options.MaxRequestTokens) / options.Epsilon
+			usage.PromptTokens = noised(usage.PromptTokens, tokenScale, options.Rand)
+			usage.CompletionTokens = noised(usage.CompletionTokens, tokenScale, options.Rand)
+		}
+		report.Groups = append(report.Groups, usage)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i].Key, report.Groups[j].Key
+		for _, dimension := range options.GroupBy {
+			if a[dimension] != b[dimension] {
+				return a[dimension] < b[dimension]
+			}
+		}
+		return false
+	})
+	return report, nil
+}
+
+// noised adds Laplace noise of the scale to a non-negative statistic, keeping
+// it non-negative
+func noised(value int64, scale float64, r *rand.Rand) int64 {
+	u := r.Float64() - 0.5
+	for u == -0.5 {
+		u = r.Float64() - 0.5
+	}
+	noise := -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+	return max(0, int64(math.Round(float64(value)+noise)))
+}
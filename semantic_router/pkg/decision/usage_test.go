@@ -0,0 +1,97 @@
+package decision
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+func usageRecord(id, tenant, user string, promptTokens, completionTokens int64) *DecisionRecord {
+	record := New(id)
+	record.Routing.Tenant = tenant
+	record.Routing.SelectedModel = "phi4"
+	record.Labels = map[string]string{"user": user}
+	record.Usage.PromptTokens = promptTokens
+	record.Usage.CompletionTokens = completionTokens
+	return record
+}
+
+func TestAggregateUsage(t *testing.T) {
+	records := []*DecisionRecord{
+		usageRecord("1", "acme", "alice", 100, 10),
+		usageRecord("2", "acme", "bob", 200, 20),
+		usageRecord("3", "acme", "carol", 300, 30),
+		// Retry of request 3, counted as the same request
+		usageRecord("3", "acme", "carol", 300, 30),
+		// A tenant of a single user, whose usage would be exposed
+		usageRecord("4", "globex", "dave", 400, 40),
+		usageRecord("5", "globex", "dave", 500, 50),
+		usageRecord("6", "globex", "dave", 600, 60),
+	}
+	shadow := usageRecord("7", "acme", "erin", 700, 70)
+	shadow.Shadow = true
+	records = append(records, shadow)
+
+	report, err := AggregateUsage(records, UsageOptions{GroupBy: []string{UsageByTenant, UsageByModel}, Identity: "label:user", MinGroupSize: 3})
+	if err != nil {
+		t.Fatalf("AggregateUsage: %v", err)
+	}
+	if report.SuppressedGroups != 1 || len(report.Groups) != 1 {
+		t.Fatalf("got %d groups and %d suppressed, want globex suppressed: %+v", len(report.Groups), report.SuppressedGroups, report)
+	}
+	group := report.Groups[0]
+	if group.Key[UsageByTenant] != "acme" || group.Key[UsageByModel] != "phi4" {
+		t.Errorf("unexpected group key %v", group.Key)
+	}
+	if group.Requests != 3 || group.PromptTokens != 900 || group.CompletionTokens != 90 {
+		t.Errorf("got %d requests, %d prompt and %d completion tokens, want 3, 900 and 90",
+			group.Requests, group.PromptTokens, group.CompletionTokens)
+	}
+
+	// Without an identity each request is an individual, so globex is exported
+	report, err = AggregateUsage(records, UsageOptions{GroupBy: []string{UsageByTenant}, MinGroupSize: 3})
+	if err != nil {
+		t.Fatalf("AggregateUsage: %v", err)
+	}
+	if len(report.Groups) != 2 || report.SuppressedGroups != 0 {
+		t.Errorf("got %d groups and %d suppressed, want 2 and 0", len(report.Groups), report.SuppressedGroups)
+	}
+}
+
+func TestAggregateUsageNoise(t *testing.T) {
+	var records []*DecisionRecord
+	for i := 0; i < 1000; i++ {
+		records = append(records, usageRecord(fmt.Sprint(i), "acme", "", 100, 100000))
+	}
+	options := UsageOptions{GroupBy: []string{UsageByTenant}, MinGroupSize: 1, Epsilon: 1, MaxRequestTokens: 1000}
+
+	options.Rand = rand.New(rand.NewPCG(1, 2))
+	noisy, err := AggregateUsage(records, options)
+	if err != nil {
+		t.Fatalf("AggregateUsage: %v", err)
+	}
+	options.Rand = rand.New(rand.NewPCG(1, 2))
+	again, _ := AggregateUsage(records, options)
+	if !reflect.DeepEqual(noisy.Groups, again.Groups) {
+		t.Errorf("same noise source gave %+v and %+v", noisy.Groups[0], again.Groups[0])
+	}
+
+	group := noisy.Groups[0]
+	if group.Requests < 950 || group.Requests > 1050 {
+		t.Errorf("noised requests = %d, want about 1000", group.Requests)
+	}
+	// Completions are clipped to the per-request bound before noise
+	if group.CompletionTokens < 900000 || group.CompletionTokens > 1100000 {
+		t.Errorf("noised completion tokens = %d, want about 1000000", group.CompletionTokens)
+	}
+}
+
+func TestAggregateUsageInvalidDimension(t *testing.T) {
+	if _, err := AggregateUsage(nil, UsageOptions{GroupBy: []string{"user_agent"}}); err == nil {
+		t.Error("unknown dimension accepted")
+	}
+	if _, err := AggregateUsage(nil, UsageOptions{Identity: "label:"}); err == nil {
+		t.Error("empty label accepted")
+	}
+}
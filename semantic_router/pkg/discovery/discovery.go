@@ -0,0 +1,320 @@
+package discovery
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxTextRunes bounds the length of a query kept as an example
+const maxTextRunes = 500
+
+// Options holds options for creating a new category discoverer
+type Options struct {
+	// Embedding function for queries
+	Embed func(text string) ([]float32, error)
+	// Number of recent unrouted queries clustered, oldest evicted first
+	MaxSamples int
+	// Minimum cosine similarity between a query and a cluster's centroid for
+	// the query to join the cluster
+	SimilarityThreshold float32
+	// Minimum number of queries in a cluster to surface it as a candidate
+	MinClusterSize int
+	// Number of representative examples per candidate
+	MaxExamples int
+	// Number of queries waiting to be embedded before new ones are dropped
+	QueueSize int
+}
+
+// Candidate is a cluster of unrouted queries that may warrant a new category
+type Candidate struct {
+	ID int `json:"id"`
+	// Number of queries in the cluster and their share of all clustered queries
+	Size  int     `json:"size"`
+	Share float64 `json:"share"`
+	// Queries closest to the cluster's centroid
+	Examples []string `json:"examples"`
+	// Most frequent words in the cluster's queries, a starting point for naming the category
+	Keywords []string `json:"keywords"`
+}
+
+type sample struct {
+	text      string
+	embedding []float32
+	cluster   *cluster
+}
+
+type cluster struct {
+	id      int
+	sum     []float32
+	members []*sample
+}
+
+// centroid returns the normalized mean of the cluster's members
+func (c *cluster) centroid() []float32 {
+	return normalize(append([]float32(nil), c.sum...))
+}
+
+// Discoverer clusters queries that no category matched, so candidate new
+// categories can be surfaced with representative examples. Queries are
+// embedded and clustered in the background, off the request path.
+type Discoverer struct {
+	options Options
+	queue   chan string
+	done    chan struct{}
+	once    sync.Once
+	// Guards sending to the queue against closing it
+	queueMu sync.RWMutex
+	stopped bool
+
+	mu       sync.Mutex
+	samples  []*sample
+	clusters []*cluster
+	nextID   int
+}
+
+// New creates a new category discoverer with the given options
+func New(options Options) *Discoverer {
+	if options.MaxSamples <= 0 {
+		options.MaxSamples = 1000
+	}
+	if options.SimilarityThreshold <= 0 {
+		options.SimilarityThreshold = 0.75
+	}
+	if options.MinClusterSize <= 0 {
+		options.MinClusterSize = 5
+	}
+	if options.MaxExamples <= 0 {
+		options.MaxExamples = 3
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 256
+	}
+	return &Discoverer{
+		options: options,
+		queue:   make(chan string, options.QueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start clusters observed queries in the background
+func (d *Discoverer) Start() {
+	go func() {
+		defer close(d.done)
+		for text := range d.queue {
+			d.observe(text)
+		}
+	}()
+}
+
+// Stop stops clustering after the queued queries
+func (d *Discoverer) Stop() {
+	d.once.Do(func() {
+		d.queueMu.Lock()
+		d.stopped = true
+		close(d.queue)
+		d.queueMu.Unlock()
+		<-d.done
+	})
+}
+
+// Observe queues a query that no category matched, dropping it if the queue
+// is full or the discoverer stopped
+func (d *Discoverer) Observe(text string) {
+	if d == nil || strings.TrimSpace(text) == "" {
+		return
+	}
+	d.queueMu.RLock()
+	defer d.queueMu.RUnlock()
+	if d.stopped {
+		return
+	}
+	select {
+	case d.queue <- text:
+	default:
+	}
+}
+
+// observe embeds a query and adds it to the most similar cluster, or to a new one
+func (d *Discoverer) observe(text string) {
+	if runes := []rune(text); len(runes) > maxTextRunes {
+		text = string(runes[:maxTextRunes])
+	}
+	embedding, err := d.options.Embed(text)
+	if err != nil {
+		log.Printf("Error embedding query for category discovery: %v", err)
+		return
+	}
+	s := &sample{text: text, embedding: normalize(embedding)}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var best *cluster
+	bestSimilarity := float32(-1)
+	for _, c := range d.clusters {
+		if similarity := dot(s.embedding, c.centroid()); similarity > bestSimilarity {
+			best, bestSimilarity = c, similarity
+		}
+	}
+	if best == nil || bestSimilarity < d.options.SimilarityThreshold {
+		d.nextID++
+		best = &cluster{id: d.nextID, sum: make([]float32, len(s.embedding))}
+		d.clusters = append(d.clusters, best)
+	}
+	s.cluster = best
+	best.members = append(best.members, s)
+	add(best.sum, s.embedding, 1)
+
+	d.samples = append(d.samples, s)
+	if len(d.samples) > d.options.MaxSamples {
+		d.evict(d.samples[0])
+		d.samples = d.samples[1:]
+	}
+}
+
+// evict removes the oldest sample from its cluster, dropping the cluster once empty
+func (d *Discoverer) evict(s *sample) {
+	c := s.cluster
+	add(c.sum, s.embedding, -1)
+	for i, member := range c.members {
+		if member == s {
+			c.members = append(c.members[:i], c.members[i+1:]...)
+			break
+		}
+	}
+	if len(c.members) > 0 {
+		return
+	}
+	for i, other := range d.clusters {
+		if other == c {
+			d.clusters = append(d.clusters[:i], d.clusters[i+1:]...)
+			break
+		}
+	}
+}
+
+// Candidates returns the clusters large enough to suggest a new category, largest first
+func (d *Discoverer) Candidates() []Candidate {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	candidates := []Candidate{}
+	for _, c := range d.clusters {
+		if len(c.members) < d.options.MinClusterSize {
+			continue
+		}
+		candidates = append(candidates, Candidate{
+			ID:       c.id,
+			Size:     len(c.members),
+			Share:    float64(len(c.members)) / float64(len(d.samples)),
+			Examples: d.examples(c),
+			Keywords: keywords(c.members, 5),
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Size > candidates[j].Size
+	})
+	return candidates
+}
+
+// examples returns the distinct member queries closest to the cluster's centroid
+func (d *Discoverer) examples(c *cluster) []string {
+	centroid := c.centroid()
+	members := append([]*sample(nil), c.members...)
+	sort.SliceStable(members, func(i, j int) bool {
+		return dot(members[i].embedding, centroid) > dot(members[j].embedding, centroid)
+	})
+	seen := make(map[string]bool)
+	var examples []string
+	for _, member := range members {
+		if len(examples) == d.options.MaxExamples {
+			break
+		}
+		if !seen[member.text] {
+			seen[member.text] = true
+			examples = append(examples, member.text)
+		}
+	}
+	return examples
+}
+
+// keywordStopwords are frequent words that never name a topic
+var keywordStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "how": true, "what": true, "which": true, "does": true,
+	"with": true, "you": true, "are": true, "can": true, "this": true, "that": true, "from": true,
+	"who": true, "why": true, "when": true, "where": true, "need": true, "have": true, "your": true,
+}
+
+// keywords returns the most frequent words across the queries, counting each
+// word once per query
+func keywords(members []*sample, limit int) []string {
+	counts := make(map[string]int)
+	for _, member := range members {
+		seen := make(map[string]bool)
+		for _, word := range strings.FieldsFunc(strings.ToLower(member.text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(word)) < 3 || keywordStopwords[word] || seen[word] {
+				continue
+			}
+			seen[word] = true
+			counts[word]++
+		}
+	}
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > limit {
+		words = words[:limit]
+	}
+	return words
+}
+
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+	// Scaled into a copy, embeddings may be shared with other callers
+	scale := float32(1 / math.Sqrt(norm))
+	normalized := make([]float32, len(v))
+	for i := range v {
+		normalized[i] = v[i] * scale
+	}
+	return normalized
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		if i < len(b) {
+			sum += a[i] * b[i]
+		}
+	}
+	return sum
+}
+
+func add(sum, v []float32, sign float32) {
+	for i := range sum {
+		if i < len(v) {
+			sum[i] += sign * v[i]
+		}
+	}
+}
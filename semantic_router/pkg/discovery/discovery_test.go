@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"strings"
+	"testing"
+)
+
+// topicEmbedding maps queries mentioning a topic word to that topic's axis
+func topicEmbedding(text string) ([]float32, error) {
+	embedding := make([]float32, 4)
+	switch {
+	case strings.Contains(text, "tax"):
+		embedding[0] = 1
+	case strings.Contains(text, "recipe"):
+		embedding[1] = 1
+	default:
+		embedding[2] = 1
+	}
+	// A small per-query offset keeps members distinct but similar
+	embedding[3] = float32(len(text)%5) / 20
+	return embedding, nil
+}
+
+func TestCandidates(t *testing.T) {
+	d := New(Options{Embed: topicEmbedding, MinClusterSize: 3, MaxExamples: 2})
+	queries := []string{
+		"how do I file my tax return",
+		"tax deductions for freelancers",
+		"which tax forms does a landlord need",
+		"tax deadline extension",
+		"easy recipe for dinner",
+		"vegan recipe ideas",
+		"what is the weather",
+	}
+	for _, query := range queries {
+		d.observe(query)
+	}
+
+	candidates := d.Candidates()
+	if len(candidates) != 1 {
+		t.Fatalf("expected only the tax cluster to be large enough, got %+v", candidates)
+	}
+	tax := candidates[0]
+	if tax.Size != 4 || tax.Share != 4.0/7 || len(tax.Examples) != 2 {
+		t.Errorf("unexpected candidate: %+v", tax)
+	}
+	for _, example := range tax.Examples {
+		if !strings.Contains(example, "tax") {
+			t.Errorf("unexpected example %q in the tax cluster", example)
+		}
+	}
+	if len(tax.Keywords) == 0 || tax.Keywords[0] != "tax" {
+		t.Errorf("expected tax as the top keyword, got %v", tax.Keywords)
+	}
+}
+
+func TestEvictsOldestSamples(t *testing.T) {
+	d := New(Options{Embed: topicEmbedding, MaxSamples: 3, MinClusterSize: 1})
+	for _, query := range []string{"tax one", "tax two", "recipe one", "recipe two", "recipe three"} {
+		d.observe(query)
+	}
+	candidates := d.Candidates()
+	if len(candidates) != 1 || candidates[0].Size != 3 || candidates[0].Share != 1 {
+		t.Errorf("expected only the recent recipe queries to remain, got %+v", candidates)
+	}
+}
+
+func TestObserveInBackground(t *testing.T) {
+	d := New(Options{Embed: topicEmbedding, MinClusterSize: 1})
+	d.Start()
+	d.Observe("tax question")
+	d.Observe("   ")
+	d.Stop()
+	if candidates := d.Candidates(); len(candidates) != 1 || candidates[0].Size != 1 {
+		t.Errorf("expected the queued query to be clustered, got %+v", candidates)
+	}
+
+	// Streams still draining may observe queries after the discoverer stopped
+	d.Observe("late tax question")
+	if candidates := d.Candidates(); len(candidates) != 1 || candidates[0].Size != 1 {
+		t.Errorf("expected queries observed after stopping to be dropped, got %+v", candidates)
+	}
+
+	var disabled *Discoverer
+	disabled.Observe("tax question")
+	if disabled.Candidates() != nil {
+		t.Error("a nil discoverer must have no candidates")
+	}
+}
@@ -0,0 +1,159 @@
+package embeddings
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Provider computes the embeddings of texts: the embedding model, a memo of
+// it or recorded fixtures
+type Provider interface {
+	Embed(text string) ([]float32, error)
+}
+
+// ProviderFunc adapts an embedding function to a Provider
+type ProviderFunc func(text string) ([]float32, error)
+
+// Embed returns the embedding of a text
+func (f ProviderFunc) Embed(text string) ([]float32, error) {
+	return f(text)
+}
+
+// Options holds options for creating a new embedding memo
+type Options struct {
+	// Computes the embedding of a text
+	Embed func(text string) ([]float32, error)
+	// Embeddings kept, the least recently used evicted first; 0 disables
+	// memoization and every text is embedded
+	MaxEntries int
+	// Key texts case-insensitively, for uncased models that embed a text and
+	// its lowercase form the same
+	CaseInsensitive bool
+}
+
+// memoEntry is a memoized embedding with its key
+type memoEntry struct {
+	key       string
+	embedding []float32
+}
+
+// Memo memoizes the embeddings of texts in an LRU keyed by their normalized
+// text, so the texts embedded for routing, cache lookups and updates, and
+// category discovery are embedded once however often they recur. Texts that
+// differ only in whitespace, or case when case-insensitive, share an
+// embedding. Memoized embeddings are shared and must not be modified.
+type Memo struct {
+	mu              sync.Mutex
+	embed           func(text string) ([]float32, error)
+	maxEntries      int
+	caseInsensitive bool
+	entries         map[string]*list.Element
+	// Most recently used first
+	order *list.List
+}
+
+// New creates an embedding memo with the given options
+func New(options Options) *Memo {
+	return &Memo{
+		embed:           options.Embed,
+		maxEntries:      options.MaxEntries,
+		caseInsensitive: options.CaseInsensitive,
+		entries:         make(map[string]*list.Element),
+		order:           list.New(),
+	}
+}
+
+// key normalizes a text into its memo key
+func (m *Memo) key(text string) string {
+	key := strings.Join(strings.Fields(text), " ")
+	if m.caseInsensitive {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// Embed returns the embedding of a text, memoized or computed
+func (m *Memo) Embed(text string) ([]float32, error) {
+	if m.maxEntries <= 0 {
+		return m.embed(text)
+	}
+	key := m.key(text)
+	m.mu.Lock()
+	if element, ok := m.entries[key]; ok {
+		m.order.MoveToFront(element)
+		embedding := element.Value.(*memoEntry).embedding
+		m.mu.Unlock()
+		metrics.RecordEmbeddingCacheHit()
+		return embedding, nil
+	}
+	m.mu.Unlock()
+
+	// Embed without the lock, concurrent misses of a text may both compute it
+	metrics.RecordEmbeddingCacheMiss()
+	embedding, err := m.embed(text)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.order.MoveToFront(element)
+		return element.Value.(*memoEntry).embedding, nil
+	}
+	m.entries[key] = m.order.PushFront(&memoEntry{key: key, embedding: embedding})
+	for m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoEntry).key)
+	}
+	return embedding, nil
+}
+
+// FindMostSimilar returns the index of the candidate most similar to the query
+// and their cosine similarity, comparing memoized embeddings
+func (m *Memo) FindMostSimilar(query string, candidates []string) (int, float32, error) {
+	if len(candidates) == 0 {
+		return -1, 0, fmt.Errorf("no candidates")
+	}
+	queryEmbedding, err := m.Embed(query)
+	if err != nil {
+		return -1, 0, err
+	}
+	return m.MostSimilar(queryEmbedding, candidates)
+}
+
+// MostSimilar returns the index of the candidate most similar to an already
+// embedded query and their cosine similarity, comparing memoized embeddings
+func (m *Memo) MostSimilar(queryEmbedding []float32, candidates []string) (int, float32, error) {
+	if len(candidates) == 0 {
+		return -1, 0, fmt.Errorf("no candidates")
+	}
+	best, bestScore := -1, float32(0)
+	for i, candidate := range candidates {
+		embedding, err := m.Embed(candidate)
+		if err != nil {
+			return -1, 0, err
+		}
+		// Embeddings are normalized, their dot product is their cosine similarity
+		var score float32
+		for j := 0; j < len(embedding) && j < len(queryEmbedding); j++ {
+			score += queryEmbedding[j] * embedding[j]
+		}
+		if best < 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best, bestScore, nil
+}
+
+// Len returns the number of memoized embeddings
+func (m *Memo) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
@@ -0,0 +1,131 @@
+package embeddings
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// countingEmbed embeds texts by their first letter, counting the calls per text
+func countingEmbed(calls map[string]int) func(text string) ([]float32, error) {
+	return func(text string) ([]float32, error) {
+		calls[text]++
+		if text == "" {
+			return nil, errors.New("empty text")
+		}
+		embedding := make([]float32, 26)
+		embedding[(text[0]|0x20-'a')%26] = 1
+		return embedding, nil
+	}
+}
+
+func TestMemoEmbed(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxEntries      int
+		caseInsensitive bool
+		texts           []string
+		wantCalls       map[string]int
+	}{
+		{
+			name:       "recurring text embedded once",
+			maxEntries: 10,
+			texts:      []string{"what is pi", "what is pi", "what is pi"},
+			wantCalls:  map[string]int{"what is pi": 1},
+		},
+		{
+			name:       "whitespace ignored",
+			maxEntries: 10,
+			texts:      []string{"what is pi", "  what   is\tpi ", "what is pi"},
+			wantCalls:  map[string]int{"what is pi": 1},
+		},
+		{
+			name:       "case sensitive by default",
+			maxEntries: 10,
+			texts:      []string{"what is pi", "What is pi"},
+			wantCalls:  map[string]int{"what is pi": 1, "What is pi": 1},
+		},
+		{
+			name:            "case insensitive",
+			maxEntries:      10,
+			caseInsensitive: true,
+			texts:           []string{"what is pi", "What is PI"},
+			wantCalls:       map[string]int{"what is pi": 1},
+		},
+		{
+			name:       "least recently used evicted",
+			maxEntries: 2,
+			texts:      []string{"a", "b", "a", "c", "a", "b"},
+			wantCalls:  map[string]int{"a": 1, "b": 2, "c": 1},
+		},
+		{
+			name:      "disabled",
+			texts:     []string{"a", "a"},
+			wantCalls: map[string]int{"a": 2},
+		},
+		{
+			name:       "errors not memoized",
+			maxEntries: 10,
+			texts:      []string{"", ""},
+			wantCalls:  map[string]int{"": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := make(map[string]int)
+			memo := New(Options{Embed: countingEmbed(calls), MaxEntries: tt.maxEntries, CaseInsensitive: tt.caseInsensitive})
+			for _, text := range tt.texts {
+				memo.Embed(text)
+			}
+			if len(calls) != len(tt.wantCalls) {
+				t.Errorf("embedded %v, want %v", calls, tt.wantCalls)
+			}
+			for text, want := range tt.wantCalls {
+				if calls[text] != want {
+					t.Errorf("%q embedded %d times, want %d", text, calls[text], want)
+				}
+			}
+			if tt.maxEntries > 0 && memo.Len() > tt.maxEntries {
+				t.Errorf("%d embeddings memoized, over the limit of %d", memo.Len(), tt.maxEntries)
+			}
+		})
+	}
+}
+
+func TestMemoCountsHitsAndMisses(t *testing.T) {
+	hits, misses := testutil.ToFloat64(metrics.EmbeddingCacheHits), testutil.ToFloat64(metrics.EmbeddingCacheMisses)
+	memo := New(Options{Embed: countingEmbed(make(map[string]int)), MaxEntries: 10})
+	for _, text := range []string{"a", "a", "b", "a"} {
+		memo.Embed(text)
+	}
+	if got := testutil.ToFloat64(metrics.EmbeddingCacheHits) - hits; got != 2 {
+		t.Errorf("hits = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.EmbeddingCacheMisses) - misses; got != 2 {
+		t.Errorf("misses = %v, want 2", got)
+	}
+}
+
+func TestMemoFindMostSimilar(t *testing.T) {
+	calls := make(map[string]int)
+	memo := New(Options{Embed: countingEmbed(calls), MaxEntries: 10})
+	candidates := []string{"apples", "bananas", "cherries"}
+	for range 3 {
+		index, score, err := memo.FindMostSimilar("black coffee", candidates)
+		if err != nil || index != 1 || score != 1 {
+			t.Fatalf("FindMostSimilar = %d, %v, %v, want 1, 1", index, score, err)
+		}
+	}
+	// Candidates are embedded once across searches
+	for _, candidate := range candidates {
+		if calls[candidate] != 1 {
+			t.Errorf("%q embedded %d times, want 1", candidate, calls[candidate])
+		}
+	}
+	if _, _, err := memo.FindMostSimilar("query", nil); err == nil {
+		t.Error("expected an error without candidates")
+	}
+}
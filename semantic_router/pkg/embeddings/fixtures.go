@@ -0,0 +1,122 @@
+package embeddings
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// ErrNoFixture is returned for texts the fixtures have no embedding of
+var ErrNoFixture = errors.New("no recorded embedding")
+
+// fixture is a line of a fixtures file
+type fixture struct {
+	Hash      string    `json:"hash"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// ContentHash returns the key of a text's embedding in fixtures, the hex
+// SHA-256 of the exact text
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fixtures serve recorded embeddings keyed by the content hash of their text,
+// so tests of classification and caching run offline and route identically
+// run to run without the embedding model. A fixtures file holds one JSON
+// object per line with the hash and the embedding, and no prompt text.
+type Fixtures struct {
+	mu         sync.Mutex
+	path       string
+	embeddings map[string][]float32
+	// Computes the embeddings of texts not recorded yet, nil when replaying
+	record Provider
+}
+
+// LoadFixtures loads the embeddings recorded in a fixtures file. With a
+// provider to record from, texts without an embedding are embedded by it and
+// appended to the file, which need not exist yet; without one they fail with
+// ErrNoFixture.
+func LoadFixtures(path string, record Provider) (*Fixtures, error) {
+	f := &Fixtures{
+		path:       path,
+		embeddings: make(map[string][]float32),
+		record:     record,
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && record != nil {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry fixture
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		f.embeddings[entry.Hash] = entry.Embedding
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Len returns the number of recorded embeddings
+func (f *Fixtures) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.embeddings)
+}
+
+// Embed returns the recorded embedding of a text, recording it first when
+// recording
+func (f *Fixtures) Embed(text string) ([]float32, error) {
+	hash := ContentHash(text)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if embedding, ok := f.embeddings[hash]; ok {
+		return slices.Clone(embedding), nil
+	}
+	if f.record == nil {
+		return nil, fmt.Errorf("%w of %q (%s) in %s", ErrNoFixture, text, hash, f.path)
+	}
+
+	// Recording is for generating fixtures, so it is serialized for a file
+	// in the order texts were first seen
+	embedding, err := f.record.Embed(text)
+	if err != nil {
+		return nil, err
+	}
+	line, err := json.Marshal(fixture{Hash: hash, Embedding: embedding})
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	f.embeddings[hash] = embedding
+	return slices.Clone(embedding), nil
+}
@@ -0,0 +1,63 @@
+package embeddings
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.jsonl")
+	if _, err := LoadFixtures(path, nil); err == nil {
+		t.Error("replaying a missing fixtures file succeeded")
+	}
+
+	// Recording embeds and appends each text once
+	calls := make(map[string]int)
+	recorder, err := LoadFixtures(path, ProviderFunc(countingEmbed(calls)))
+	if err != nil {
+		t.Fatalf("LoadFixtures: %v", err)
+	}
+	for _, text := range []string{"apple", "banana", "apple"} {
+		if _, err := recorder.Embed(text); err != nil {
+			t.Fatalf("Embed(%q): %v", text, err)
+		}
+	}
+	if calls["apple"] != 1 || calls["banana"] != 1 {
+		t.Errorf("embedding calls = %v, want one per text", calls)
+	}
+	recorded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(recorded), "apple") || !strings.Contains(string(recorded), ContentHash("apple")) {
+		t.Errorf("fixtures file = %s, want embeddings keyed by content hash", recorded)
+	}
+
+	// Replaying serves the recorded embeddings without the model
+	replay, err := LoadFixtures(path, nil)
+	if err != nil {
+		t.Fatalf("LoadFixtures: %v", err)
+	}
+	if replay.Len() != 2 {
+		t.Errorf("loaded %d embeddings, want 2", replay.Len())
+	}
+	got, err := replay.Embed("banana")
+	want, _ := countingEmbed(map[string]int{})("banana")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Embed(banana) = %v, %v, want the recorded embedding", got, err)
+	}
+	if _, err := replay.Embed("cherry"); !errors.Is(err, ErrNoFixture) {
+		t.Errorf("Embed of an unrecorded text returned %v, want ErrNoFixture", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{\"hash\":\"00\"}\nnot json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFixtures(path, nil); err == nil {
+		t.Error("loaded a malformed fixtures file")
+	}
+}
@@ -0,0 +1,223 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// ErrCircuitOpen is returned without calling the remote endpoint while its
+// circuit is open
+var ErrCircuitOpen = errors.New("embedding endpoint circuit open")
+
+// remoteCircuit names the endpoint's circuit in the breakers and their metrics
+const remoteCircuit = "embedding_endpoint"
+
+// RemoteOptions holds options for creating a new remote provider
+type RemoteOptions struct {
+	// OpenAI-compatible embeddings endpoint, e.g. http://tei:8080/v1/embeddings
+	URL string
+	// Model named in requests
+	Model string
+	// Bearer token sent with requests, none when empty
+	APIKey string
+	// Timeout of a request, default 5s
+	Timeout time.Duration
+	// Most texts embedded in one request, default 32
+	MaxBatchSize int
+	// How long a text waits for others to share its request; 0 sends every
+	// text alone
+	BatchWait time.Duration
+	// Circuit breaker of the endpoint, calls fail fast while it is open; none
+	// when nil
+	Breakers *breaker.Breakers
+	// Client of the endpoint, default a client with the timeout
+	HTTPClient *http.Client
+}
+
+// Remote computes embeddings with an OpenAI-compatible /v1/embeddings
+// endpoint, for deployments that don't ship the embedding model. Texts
+// embedded concurrently within the batch wait share a request.
+type Remote struct {
+	options RemoteOptions
+	mu      sync.Mutex
+	// Calls waiting for the next request
+	pending []*remoteCall
+}
+
+// Ensure Remote implements Provider
+var _ Provider = &Remote{}
+
+// remoteCall is a text waiting for its embedding
+type remoteCall struct {
+	text      string
+	embedding []float32
+	err       error
+	done      chan struct{}
+}
+
+// NewRemote creates a remote provider with the given options
+func NewRemote(options RemoteOptions) (*Remote, error) {
+	if options.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = 32
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: options.Timeout}
+	}
+	return &Remote{options: options}, nil
+}
+
+// Embed returns the embedding of a text, batched with the texts embedded
+// concurrently
+func (r *Remote) Embed(text string) ([]float32, error) {
+	if r.options.BatchWait <= 0 {
+		embeddings, err := r.EmbedBatch([]string{text})
+		if err != nil {
+			return nil, err
+		}
+		return embeddings[0], nil
+	}
+
+	call := &remoteCall{text: text, done: make(chan struct{})}
+	r.mu.Lock()
+	r.pending = append(r.pending, call)
+	switch len(r.pending) {
+	case 1:
+		time.AfterFunc(r.options.BatchWait, r.flush)
+	case r.options.MaxBatchSize:
+		go r.flush()
+	}
+	r.mu.Unlock()
+	<-call.done
+	return call.embedding, call.err
+}
+
+// flush embeds the pending texts in one request
+func (r *Remote) flush() {
+	r.mu.Lock()
+	calls := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if len(calls) == 0 {
+		// Flushed when the batch filled up before the wait ended
+		return
+	}
+
+	texts := make([]string, len(calls))
+	for i, call := range calls {
+		texts[i] = call.text
+	}
+	embeddings, err := r.embed(texts)
+	for i, call := range calls {
+		if err != nil {
+			call.err = err
+		} else {
+			call.embedding = embeddings[i]
+		}
+		close(call.done)
+	}
+}
+
+// EmbedBatch returns the embeddings of texts in order, in requests of at most
+// the maximum batch size
+func (r *Remote) EmbedBatch(texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += r.options.MaxBatchSize {
+		batch, err := r.embed(texts[start:min(start+r.options.MaxBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+// embeddingsRequest is the body of an embeddings request
+type embeddingsRequest struct {
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+}
+
+// embeddingsResponse is the body of an embeddings response
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// embed sends one request embedding texts, counting its outcome in the
+// endpoint's circuit
+func (r *Remote) embed(texts []string) ([][]float32, error) {
+	if !r.options.Breakers.Allow(remoteCircuit) {
+		metrics.RecordRemoteEmbeddingRequest("circuit_open", len(texts), 0)
+		return nil, ErrCircuitOpen
+	}
+	start := time.Now()
+	embeddings, err := r.request(texts)
+	latency := time.Since(start)
+	r.options.Breakers.Record(remoteCircuit, err == nil, latency)
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	metrics.RecordRemoteEmbeddingRequest(outcome, len(texts), latency.Seconds())
+	return embeddings, err
+}
+
+func (r *Remote) request(texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embeddingsRequest{Model: r.options.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.options.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.options.APIKey)
+	}
+	resp, err := r.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embedding endpoint returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	var decoded embeddingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	if len(decoded.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding endpoint returned %d embeddings for %d texts", len(decoded.Data), len(texts))
+	}
+	embeddings := make([][]float32, len(texts))
+	for _, data := range decoded.Data {
+		if data.Index < 0 || data.Index >= len(texts) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("embedding endpoint returned an invalid index %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,147 @@
+package embeddings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+)
+
+// embeddingServer serves embeddings of one dimension holding the length of
+// each input, recording the inputs of every request
+type embeddingServer struct {
+	mu       sync.Mutex
+	requests [][]string
+	status   int
+}
+
+func (s *embeddingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req embeddingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, req.Input)
+	status := s.status
+	s.mu.Unlock()
+	if status != 0 {
+		http.Error(w, "unavailable", status)
+		return
+	}
+	type data struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	}
+	resp := struct {
+		Data []data `json:"data"`
+	}{}
+	// Answer out of order, as the index decides the position
+	for i := len(req.Input) - 1; i >= 0; i-- {
+		resp.Data = append(resp.Data, data{Index: i, Embedding: []float32{float32(len(req.Input[i]))}})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *embeddingServer) batches() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestRemoteEmbedBatch(t *testing.T) {
+	server := &embeddingServer{}
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+	remote, err := NewRemote(RemoteOptions{URL: endpoint.URL, Model: "bge", MaxBatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embeddings, err := remote.EmbedBatch([]string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float32{1, 2, 3} {
+		if embeddings[i][0] != want {
+			t.Errorf("embedding %d = %v, want [%v]", i, embeddings[i], want)
+		}
+	}
+	if got := len(server.batches()); got != 2 {
+		t.Errorf("sent %d requests for 3 texts in batches of 2, want 2", got)
+	}
+}
+
+func TestRemoteEmbedBatchesConcurrentTexts(t *testing.T) {
+	server := &embeddingServer{}
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+	remote, err := NewRemote(RemoteOptions{URL: endpoint.URL, MaxBatchSize: 4, BatchWait: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A full batch is sent without waiting
+	texts := []string{"a", "bb", "ccc", "dddd"}
+	var wg sync.WaitGroup
+	for _, text := range texts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			embedding, err := remote.Embed(text)
+			if err != nil || embedding[0] != float32(len(text)) {
+				t.Errorf("Embed(%q) = %v, %v", text, embedding, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if batches := server.batches(); len(batches) != 1 || len(batches[0]) != 4 {
+		t.Errorf("sent requests %v, want one with every text", batches)
+	}
+}
+
+func TestRemoteCircuitBreaker(t *testing.T) {
+	server := &embeddingServer{status: http.StatusServiceUnavailable}
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+	remote, err := NewRemote(RemoteOptions{
+		URL:      endpoint.URL,
+		Breakers: breaker.New(breaker.Options{MinRequests: 2, Cooldown: time.Minute}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := remote.Embed("a"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("call %d returned %v, want the endpoint's error", i, err)
+		}
+	}
+	if _, err := remote.Embed("a"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("call after repeated failures returned %v, want ErrCircuitOpen", err)
+	}
+	if got := len(server.batches()); got != 2 {
+		t.Errorf("endpoint received %d requests, want 2 before the circuit opened", got)
+	}
+}
+
+func TestRemoteTimeout(t *testing.T) {
+	release := make(chan struct{})
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer endpoint.Close()
+	defer close(release)
+	remote, err := NewRemote(RemoteOptions{URL: endpoint.URL, Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Embed("a"); err == nil {
+		t.Error("slow endpoint returned no error")
+	}
+}
@@ -0,0 +1,45 @@
+package embeddings
+
+import "github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+
+// Set holds the embeddings computed for a single request, so the stages of the
+// request embedding the same text, e.g. the cache lookup, the cache store and
+// utterance routing, compute it once. Unlike a Memo it lives as long as its
+// request and is not safe for concurrent use, as a request's stages run in
+// turn. A nil Set holds nothing and computes every embedding.
+type Set struct {
+	embeddings map[string][]float32
+}
+
+// NewSet creates an empty embedding set
+func NewSet() *Set {
+	return &Set{embeddings: make(map[string][]float32)}
+}
+
+// Embed returns the embedding of a text, computed with embed the first time
+// the set is asked for it. Stages pass their own embedding function, which
+// for a request's stages is the same model.
+func (s *Set) Embed(text string, embed func(text string) ([]float32, error)) ([]float32, error) {
+	if s == nil {
+		return embed(text)
+	}
+	if embedding, ok := s.embeddings[text]; ok {
+		metrics.RecordRequestEmbeddingReused()
+		return embedding, nil
+	}
+	embedding, err := embed(text)
+	if err != nil {
+		return nil, err
+	}
+	s.embeddings[text] = embedding
+	return embedding, nil
+}
+
+// Lookup returns the embedding of a text if the set computed it
+func (s *Set) Lookup(text string) ([]float32, bool) {
+	if s == nil {
+		return nil, false
+	}
+	embedding, ok := s.embeddings[text]
+	return embedding, ok
+}
@@ -0,0 +1,50 @@
+package embeddings
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestSetEmbedsOnce(t *testing.T) {
+	calls := make(map[string]int)
+	embed := countingEmbed(calls)
+	reused := testutil.ToFloat64(metrics.RequestEmbeddingsReused)
+
+	set := NewSet()
+	if _, ok := set.Lookup("what is pi"); ok {
+		t.Error("empty set found an embedding")
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := set.Embed("what is pi", embed); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	if calls["what is pi"] != 1 {
+		t.Errorf("text embedded %d times, want once", calls["what is pi"])
+	}
+	if embedding, ok := set.Lookup("what is pi"); !ok || embedding[('w'-'a')%26] != 1 {
+		t.Errorf("Lookup = %v, %v, want the computed embedding", embedding, ok)
+	}
+	if got := testutil.ToFloat64(metrics.RequestEmbeddingsReused) - reused; got != 2 {
+		t.Errorf("reused embeddings increased by %v, want 2", got)
+	}
+
+	// Failures are not kept, so a later stage may retry
+	if _, err := set.Embed("", embed); err == nil {
+		t.Error("expected the embedding error")
+	}
+	if _, ok := set.Lookup(""); ok {
+		t.Error("failed embedding kept")
+	}
+
+	// A nil set computes every embedding
+	var none *Set
+	none.Embed("pi", embed)
+	none.Embed("pi", embed)
+	if calls["pi"] != 2 {
+		t.Errorf("nil set embedded %d times, want 2", calls["pi"])
+	}
+}
@@ -0,0 +1,278 @@
+package endpoints
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Locality labels describing where a selected endpoint lives relative to the router
+const (
+	LocalityZone   = "local_zone"
+	LocalityRegion = "local_region"
+	LocalityRemote = "remote"
+)
+
+// SelectorOptions holds options for creating a new endpoint selector
+type SelectorOptions struct {
+	// Region and zone the router runs in
+	Region string
+	Zone   string
+	// Consecutive failures before an endpoint is marked unhealthy
+	FailureThreshold int
+	// How long an unhealthy endpoint is excluded before it is tried again
+	Cooldown time.Duration
+	// Endpoints per model name
+	ModelEndpoints map[string][]config.ModelEndpoint
+	// Prefix index used to prefer endpoints likely holding the prompt's KV cache, may be nil
+	Prefixes *PrefixIndex
+}
+
+// Hints carries request attributes that influence endpoint choice
+type Hints struct {
+	// Session key consistently mapped to one endpoint
+	SessionKey string
+	// Prompt text used for prefix-cache affinity
+	Prompt string
+}
+
+// Selection is the result of picking an endpoint for a model
+type Selection struct {
+	Model    string
+	Endpoint config.ModelEndpoint
+	Locality string
+}
+
+// endpointHealth tracks passive health state for a single endpoint
+type endpointHealth struct {
+	consecutiveFailures int
+	unhealthyUntil      time.Time
+}
+
+// Selector picks backend endpoints for a model, preferring endpoints local
+// to the router and failing over to remote ones when local endpoints are unhealthy
+type Selector struct {
+	options SelectorOptions
+	counter uint64
+	mu      sync.Mutex
+	health  map[string]*endpointHealth
+	// Endpoints other replicas of the fleet consider unhealthy, by address
+	fleetUnhealthy map[string]bool
+}
+
+// NewSelector creates a new endpoint selector with the given options
+func NewSelector(options SelectorOptions) *Selector {
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = 3
+	}
+	if options.Cooldown <= 0 {
+		options.Cooldown = 30 * time.Second
+	}
+	return &Selector{
+		options: options,
+		health:  make(map[string]*endpointHealth),
+	}
+}
+
+// HasEndpoints returns whether any endpoints are configured for the model
+func (s *Selector) HasEndpoints(model string) bool {
+	return len(s.options.ModelEndpoints[model]) > 0
+}
+
+// Select picks an endpoint for the model. Healthy endpoints in the router's zone
+// are preferred, then its region, then remote ones. If no endpoint is healthy the
+// selection fails open to the best-located endpoint not under maintenance.
+func (s *Selector) Select(model string) (Selection, bool) {
+	return s.SelectForKey(model, "")
+}
+
+// SelectForKey is like Select but, when a session key is given, consistently maps
+// the key to the same endpoint within the preferred locality tier so repeated turns
+// of a conversation land on the replica holding their prefix cache
+func (s *Selector) SelectForKey(model, key string) (Selection, bool) {
+	return s.SelectWithHints(model, Hints{SessionKey: key})
+}
+
+// SelectWithHints picks an endpoint for the model using the request hints. Within
+// the preferred locality tier, the endpoint that most recently served the longest
+// prefix of the prompt wins, then the session's consistent-hash endpoint.
+func (s *Selector) SelectWithHints(model string, hints Hints) (Selection, bool) {
+	candidates := s.options.ModelEndpoints[model]
+	if len(candidates) == 0 {
+		return Selection{}, false
+	}
+
+	now := time.Now()
+	available := make([]config.ModelEndpoint, 0, len(candidates))
+	for _, ep := range candidates {
+		if ep.IsInMaintenance(now) {
+			continue
+		}
+		available = append(available, ep)
+	}
+	if len(available) == 0 {
+		log.Printf("All endpoints for model %s are in maintenance", model)
+		return Selection{}, false
+	}
+
+	s.mu.Lock()
+	healthy := make([]config.ModelEndpoint, 0, len(available))
+	for _, ep := range available {
+		if h, ok := s.health[ep.Address]; ok && now.Before(h.unhealthyUntil) {
+			continue
+		}
+		if s.fleetUnhealthy[ep.Address] {
+			continue
+		}
+		healthy = append(healthy, ep)
+	}
+	s.mu.Unlock()
+
+	if len(healthy) == 0 {
+		log.Printf("No healthy endpoints for model %s, failing open", model)
+		healthy = available
+	}
+
+	var blocks []uint64
+	if s.options.Prefixes != nil && hints.Prompt != "" {
+		blocks = s.options.Prefixes.Blocks(hints.Prompt)
+	}
+
+	selection, ok := s.pick(model, healthy, hints.SessionKey, blocks)
+	if ok {
+		metrics.RecordEndpointSelection(model, selection.Endpoint.Name, selection.Locality)
+		if s.options.Prefixes != nil {
+			s.options.Prefixes.Record(selection.Endpoint.Address, blocks)
+		}
+	}
+	return selection, ok
+}
+
+// pick chooses among the best-located tier of candidates, by longest cached prefix,
+// then by rendezvous hashing when a key is given, and in round-robin order otherwise
+func (s *Selector) pick(model string, candidates []config.ModelEndpoint, key string, blocks []uint64) (Selection, bool) {
+	for _, locality := range []string{LocalityZone, LocalityRegion, LocalityRemote} {
+		var tier []config.ModelEndpoint
+		for _, ep := range candidates {
+			if s.localityOf(ep) == locality {
+				tier = append(tier, ep)
+			}
+		}
+		if len(tier) == 0 {
+			continue
+		}
+		var endpoint config.ModelEndpoint
+		if best, ok := s.bestPrefixMatch(tier, blocks); ok {
+			endpoint = best
+			metrics.RecordPrefixAffinitySelection(model)
+		} else if key != "" {
+			endpoint = rendezvous(key, tier)
+		} else {
+			n := atomic.AddUint64(&s.counter, 1)
+			endpoint = tier[n%uint64(len(tier))]
+		}
+		return Selection{
+			Model:    model,
+			Endpoint: endpoint,
+			Locality: locality,
+		}, true
+	}
+	return Selection{}, false
+}
+
+// bestPrefixMatch returns the endpoint that most recently served the longest prefix of the prompt
+func (s *Selector) bestPrefixMatch(tier []config.ModelEndpoint, blocks []uint64) (config.ModelEndpoint, bool) {
+	if s.options.Prefixes == nil || len(blocks) == 0 {
+		return config.ModelEndpoint{}, false
+	}
+	var best config.ModelEndpoint
+	bestScore := 0
+	for _, ep := range tier {
+		if score := s.options.Prefixes.Score(ep.Address, blocks); score > bestScore {
+			best, bestScore = ep, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+// localityOf classifies an endpoint relative to the router's region and zone
+func (s *Selector) localityOf(ep config.ModelEndpoint) string {
+	if s.options.Region == "" || ep.Region != s.options.Region {
+		return LocalityRemote
+	}
+	if s.options.Zone != "" && ep.Zone == s.options.Zone {
+		return LocalityZone
+	}
+	return LocalityRegion
+}
+
+// RecordResult records the outcome of a request sent to an endpoint
+func (s *Selector) RecordResult(selection Selection, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	address := selection.Endpoint.Address
+	h, ok := s.health[address]
+	if !ok {
+		h = &endpointHealth{}
+		s.health[address] = h
+	}
+
+	if success {
+		if h.consecutiveFailures >= s.options.FailureThreshold {
+			log.Printf("Endpoint %s for model %s recovered", selection.Endpoint.Name, selection.Model)
+		}
+		h.consecutiveFailures = 0
+		h.unhealthyUntil = time.Time{}
+		metrics.RecordEndpointHealth(selection.Model, selection.Endpoint.Name, s.localityOf(selection.Endpoint), true)
+		return
+	}
+
+	h.consecutiveFailures++
+	if h.consecutiveFailures >= s.options.FailureThreshold {
+		h.unhealthyUntil = time.Now().Add(s.options.Cooldown)
+		log.Printf("Endpoint %s for model %s marked unhealthy after %d consecutive failures",
+			selection.Endpoint.Name, selection.Model, h.consecutiveFailures)
+		metrics.RecordEndpointHealth(selection.Model, selection.Endpoint.Name, s.localityOf(selection.Endpoint), false)
+	}
+}
+
+// UnhealthyEndpoints returns the addresses of the endpoints this selector currently
+// considers unhealthy from its own request outcomes
+func (s *Selector) UnhealthyEndpoints() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var unhealthy []string
+	for address, h := range s.health {
+		if now.Before(h.unhealthyUntil) {
+			unhealthy = append(unhealthy, address)
+		}
+	}
+	sort.Strings(unhealthy)
+	return unhealthy
+}
+
+// SetFleetUnhealthy replaces the set of endpoints considered unhealthy fleet-wide,
+// which are excluded from selection like locally unhealthy ones
+func (s *Selector) SetFleetUnhealthy(addresses []string) {
+	fleetUnhealthy := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		fleetUnhealthy[address] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for address := range fleetUnhealthy {
+		if !s.fleetUnhealthy[address] {
+			log.Printf("Endpoint %s marked unhealthy by the fleet", address)
+		}
+	}
+	s.fleetUnhealthy = fleetUnhealthy
+}
@@ -0,0 +1,179 @@
+package endpoints
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func newTestSelector() *Selector {
+	return NewSelector(SelectorOptions{
+		Region:           "us-east-1",
+		Zone:             "us-east-1a",
+		FailureThreshold: 2,
+		Cooldown:         time.Minute,
+		ModelEndpoints: map[string][]config.ModelEndpoint{
+			"phi4": {
+				{Name: "remote", Address: "10.1.0.1:8000", Region: "eu-west-1", Zone: "eu-west-1a"},
+				{Name: "region", Address: "10.0.2.1:8000", Region: "us-east-1", Zone: "us-east-1b"},
+				{Name: "zone", Address: "10.0.1.1:8000", Region: "us-east-1", Zone: "us-east-1a"},
+			},
+		},
+	})
+}
+
+func TestSelectPrefersLocalEndpoints(t *testing.T) {
+	s := newTestSelector()
+
+	selection, ok := s.Select("phi4")
+	if !ok || selection.Endpoint.Name != "zone" || selection.Locality != LocalityZone {
+		t.Fatalf("expected local zone endpoint, got %+v", selection)
+	}
+
+	// Fail the local zone endpoint until it is marked unhealthy
+	s.RecordResult(selection, false)
+	s.RecordResult(selection, false)
+
+	selection, ok = s.Select("phi4")
+	if !ok || selection.Endpoint.Name != "region" || selection.Locality != LocalityRegion {
+		t.Fatalf("expected failover to local region endpoint, got %+v", selection)
+	}
+
+	s.RecordResult(selection, false)
+	s.RecordResult(selection, false)
+
+	selection, ok = s.Select("phi4")
+	if !ok || selection.Endpoint.Name != "remote" || selection.Locality != LocalityRemote {
+		t.Fatalf("expected failover to remote endpoint, got %+v", selection)
+	}
+}
+
+func TestSelectSkipsFleetUnhealthyEndpoints(t *testing.T) {
+	s := newTestSelector()
+
+	zone, _ := s.Select("phi4")
+	s.RecordResult(zone, false)
+	s.RecordResult(zone, false)
+	if got := s.UnhealthyEndpoints(); len(got) != 1 || got[0] != "10.0.1.1:8000" {
+		t.Fatalf("UnhealthyEndpoints() = %v, want the local zone endpoint", got)
+	}
+
+	// Another replica reports the region endpoint unhealthy
+	s.SetFleetUnhealthy([]string{"10.0.2.1:8000"})
+	if selection, ok := s.Select("phi4"); !ok || selection.Endpoint.Name != "remote" {
+		t.Fatalf("expected failover to the remote endpoint, got %+v", selection)
+	}
+	// Fleet reports are not echoed back as local ones
+	if got := s.UnhealthyEndpoints(); len(got) != 1 {
+		t.Errorf("UnhealthyEndpoints() = %v, want only the locally failed endpoint", got)
+	}
+
+	s.SetFleetUnhealthy(nil)
+	if selection, ok := s.Select("phi4"); !ok || selection.Endpoint.Name != "region" {
+		t.Fatalf("expected the region endpoint once the fleet report clears, got %+v", selection)
+	}
+}
+
+func TestSelectSkipsEndpointsInMaintenance(t *testing.T) {
+	now := time.Now()
+	s := NewSelector(SelectorOptions{
+		ModelEndpoints: map[string][]config.ModelEndpoint{
+			"phi4": {
+				{Name: "a", Address: "a:8000", MaintenanceWindows: []config.MaintenanceWindow{{Start: now.Add(-time.Minute)}}},
+				{Name: "b", Address: "b:8000"},
+			},
+		},
+	})
+
+	for i := 0; i < 4; i++ {
+		selection, ok := s.Select("phi4")
+		if !ok || selection.Endpoint.Name != "b" {
+			t.Fatalf("expected endpoint b, got %+v", selection)
+		}
+	}
+
+	if _, ok := s.Select("unknown"); ok {
+		t.Error("expected no selection for model without endpoints")
+	}
+}
+
+func TestSelectForKeyIsSticky(t *testing.T) {
+	s := NewSelector(SelectorOptions{
+		ModelEndpoints: map[string][]config.ModelEndpoint{
+			"phi4": {
+				{Name: "a", Address: "a:8000"},
+				{Name: "b", Address: "b:8000"},
+				{Name: "c", Address: "c:8000"},
+			},
+		},
+	})
+
+	first, ok := s.SelectForKey("phi4", "session-1")
+	if !ok {
+		t.Fatal("expected a selection")
+	}
+	for i := 0; i < 10; i++ {
+		next, _ := s.SelectForKey("phi4", "session-1")
+		if next.Endpoint.Name != first.Endpoint.Name {
+			t.Fatalf("session moved from %s to %s", first.Endpoint.Name, next.Endpoint.Name)
+		}
+	}
+
+	// Sessions on other endpoints stay put when one endpoint becomes unhealthy
+	s.options.FailureThreshold = 1
+	s.RecordResult(first, false)
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		all := []config.ModelEndpoint{{Name: "a", Address: "a:8000"}, {Name: "b", Address: "b:8000"}, {Name: "c", Address: "c:8000"}}
+		before := rendezvous(key, all)
+		after, _ := s.SelectForKey("phi4", key)
+		if before.Name != first.Endpoint.Name && after.Endpoint.Name != before.Name {
+			t.Errorf("key %s remapped from %s to %s", key, before.Name, after.Endpoint.Name)
+		}
+	}
+}
+
+func TestSelectWithHintsPrefersCachedPrefix(t *testing.T) {
+	prefixes := NewPrefixIndex(PrefixIndexOptions{BlockSize: 4})
+	s := NewSelector(SelectorOptions{
+		ModelEndpoints: map[string][]config.ModelEndpoint{
+			"phi4": {
+				{Name: "a", Address: "a:8000"},
+				{Name: "b", Address: "b:8000"},
+			},
+		},
+		Prefixes: prefixes,
+	})
+
+	// Warm endpoint b with the conversation prefix
+	prefixes.Record("b:8000", prefixes.Blocks("system: be brief\nuser: hi\n"))
+
+	for i := 0; i < 4; i++ {
+		selection, ok := s.SelectWithHints("phi4", Hints{Prompt: "system: be brief\nuser: hi\nassistant: hello\n"})
+		if !ok || selection.Endpoint.Name != "b" {
+			t.Fatalf("expected endpoint b holding the prefix, got %+v", selection)
+		}
+	}
+}
+
+func TestPrefixIndexEvictsLeastRecentlyRecorded(t *testing.T) {
+	prefixes := NewPrefixIndex(PrefixIndexOptions{BlockSize: 1, MaxBlocksPerEndpoint: 4})
+	conversation, other := prefixes.Blocks("abcd"), prefixes.Blocks("xy")
+	prefixes.Record("a:8000", conversation)
+	prefixes.Record("a:8000", other)
+
+	// The trailing blocks of the conversation make room, its leading ones stay
+	if score := prefixes.Score("a:8000", conversation); score != 2 {
+		t.Errorf("conversation score = %d, want 2", score)
+	}
+	if score := prefixes.Score("a:8000", other); score != 2 {
+		t.Errorf("other score = %d, want 2", score)
+	}
+
+	// Recording a block again keeps it longest
+	prefixes.Record("a:8000", conversation[:1])
+	prefixes.Record("a:8000", prefixes.Blocks("pqr"))
+	if score := prefixes.Score("a:8000", conversation); score != 1 {
+		t.Errorf("conversation score after more prompts = %d, want 1", score)
+	}
+}
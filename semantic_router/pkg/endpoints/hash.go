@@ -0,0 +1,36 @@
+package endpoints
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// rendezvous picks the endpoint with the highest hash weight for the key.
+// Removing an endpoint only remaps the keys that were assigned to it, which
+// keeps sessions on their replica while the endpoint set changes with health.
+func rendezvous(key string, candidates []config.ModelEndpoint) config.ModelEndpoint {
+	var best config.ModelEndpoint
+	var bestWeight uint64
+	for i, ep := range candidates {
+		weight := hashKey(key + "/" + ep.Address)
+		if i == 0 || weight > bestWeight {
+			best = ep
+			bestWeight = weight
+		}
+	}
+	return best
+}
+
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// SessionHash returns a stable hex digest of a session key, suitable for use
+// as the hash input of Envoy's ring hash or maglev load balancers
+func SessionHash(key string) string {
+	return fmt.Sprintf("%016x", hashKey(key))
+}
@@ -0,0 +1,130 @@
+package endpoints
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// PrefixIndexOptions holds options for creating a new prefix index
+type PrefixIndexOptions struct {
+	// Number of prompt characters per prefix block
+	BlockSize int
+	// Maximum prefix blocks remembered per endpoint
+	MaxBlocksPerEndpoint int
+	// How long a served prefix is assumed to stay in an endpoint's KV cache
+	TTL time.Duration
+}
+
+// PrefixIndex remembers which prompt prefixes were recently sent to each endpoint,
+// approximating which replicas still hold the KV cache for a prompt's prefix
+type PrefixIndex struct {
+	options   PrefixIndexOptions
+	mu        sync.Mutex
+	endpoints map[string]*prefixBlocks
+}
+
+// prefixBlocks are the blocks recently sent to an endpoint
+type prefixBlocks struct {
+	blocks map[uint64]*list.Element
+	// Most recently recorded first
+	order *list.List
+}
+
+// prefixBlock is a block with when it was last sent
+type prefixBlock struct {
+	hash     uint64
+	recorded time.Time
+}
+
+// NewPrefixIndex creates a new prefix index with the given options
+func NewPrefixIndex(options PrefixIndexOptions) *PrefixIndex {
+	if options.BlockSize <= 0 {
+		options.BlockSize = 256
+	}
+	if options.MaxBlocksPerEndpoint <= 0 {
+		options.MaxBlocksPerEndpoint = 10000
+	}
+	if options.TTL <= 0 {
+		options.TTL = 10 * time.Minute
+	}
+	return &PrefixIndex{
+		options:   options,
+		endpoints: make(map[string]*prefixBlocks),
+	}
+}
+
+// Blocks splits the prompt into fixed-size blocks and returns a chained hash per
+// block, so each hash identifies the whole prefix up to and including that block
+func (p *PrefixIndex) Blocks(prompt string) []uint64 {
+	n := len(prompt) / p.options.BlockSize
+	if n == 0 {
+		return nil
+	}
+	blocks := make([]uint64, 0, n)
+	h := fnv.New64a()
+	for i := 0; i < n; i++ {
+		h.Write([]byte(prompt[i*p.options.BlockSize : (i+1)*p.options.BlockSize]))
+		blocks = append(blocks, h.Sum64())
+	}
+	return blocks
+}
+
+// Score returns how many leading blocks of the prompt were recently served by the endpoint
+func (p *PrefixIndex) Score(address string, blocks []uint64) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen, ok := p.endpoints[address]
+	if !ok {
+		return 0
+	}
+	now := time.Now()
+	score := 0
+	for _, block := range blocks {
+		element, ok := seen.blocks[block]
+		if !ok || now.Sub(element.Value.(*prefixBlock).recorded) > p.options.TTL {
+			break
+		}
+		score++
+	}
+	return score
+}
+
+// Record remembers that the prompt blocks were sent to the endpoint
+func (p *PrefixIndex) Record(address string, blocks []uint64) {
+	if len(blocks) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen, ok := p.endpoints[address]
+	if !ok {
+		seen = &prefixBlocks{blocks: make(map[uint64]*list.Element), order: list.New()}
+		p.endpoints[address] = seen
+	}
+	now := time.Now()
+	// Last block first, so the leading blocks every longer prompt shares are
+	// evicted last
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if element, ok := seen.blocks[blocks[i]]; ok {
+			element.Value.(*prefixBlock).recorded = now
+			seen.order.MoveToFront(element)
+			continue
+		}
+		seen.blocks[blocks[i]] = seen.order.PushFront(&prefixBlock{hash: blocks[i], recorded: now})
+	}
+
+	// Drop expired blocks, then the least recently recorded ones beyond the limit
+	for oldest := seen.order.Back(); oldest != nil; oldest = seen.order.Back() {
+		block := oldest.Value.(*prefixBlock)
+		if seen.order.Len() <= p.options.MaxBlocksPerEndpoint && now.Sub(block.recorded) <= p.options.TTL {
+			break
+		}
+		seen.order.Remove(oldest)
+		delete(seen.blocks, block.hash)
+	}
+}
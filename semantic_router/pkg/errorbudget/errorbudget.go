@@ -0,0 +1,206 @@
+package errorbudget
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Stages whose failures are counted against an error budget
+const (
+	// Classification of "auto" requests; when disabled they go to the default model
+	StageClassification = "classification"
+	// Semantic cache lookups and updates
+	StageCache = "cache"
+	// PII detection; when disabled requests pass unscanned
+	StagePII = "pii"
+	// Jailbreak and prompt injection detection; when disabled requests pass unchecked
+	StagePromptGuard = "prompt_guard"
+)
+
+// Stages lists every stage that can have an error budget
+var Stages = []string{StageClassification, StageCache, StagePII, StagePromptGuard}
+
+// buckets is the number of buckets the window is divided into
+const buckets = 10
+
+// Budget is the error budget of a stage
+type Budget struct {
+	// Fraction of calls in the window that may fail, default 0.5
+	MaxErrorRate float64
+	// Calls in the window needed before the rate is checked, default 20
+	MinCalls int
+	// How long the stage stays disabled once over budget, default 30s
+	Cooldown time.Duration
+}
+
+// Options holds options for creating a new error budget tracker
+type Options struct {
+	// Period over which error rates are measured, default 1m
+	Window time.Duration
+	// Budget per stage; stages not listed are never disabled
+	Budgets map[string]Budget
+}
+
+// bucket counts the calls of a stage in a slice of the window
+type bucket struct {
+	start  time.Time
+	calls  int
+	errors int
+}
+
+// stageState is the error rate tracking of a stage
+type stageState struct {
+	budget        Budget
+	buckets       [buckets]bucket
+	disabledUntil time.Time
+}
+
+// Tracker tracks the error rate of each pipeline stage over a sliding window
+// and disables a stage that exceeds its budget for a cool-down period, so a
+// failing dependency fails open instead of adding its errors and timeouts to
+// every request. A nil tracker never disables a stage.
+type Tracker struct {
+	mu     sync.Mutex
+	window time.Duration
+	stages map[string]*stageState
+	now    func() time.Time
+}
+
+// New creates an error budget tracker with the given options
+func New(options Options) (*Tracker, error) {
+	if options.Window <= 0 {
+		options.Window = time.Minute
+	}
+	t := &Tracker{
+		window: options.Window,
+		stages: make(map[string]*stageState, len(options.Budgets)),
+		now:    time.Now,
+	}
+	for stage, budget := range options.Budgets {
+		if !knownStage(stage) {
+			return nil, fmt.Errorf("unknown stage %q, expected one of %s", stage, strings.Join(Stages, ", "))
+		}
+		if budget.MaxErrorRate <= 0 || budget.MaxErrorRate > 1 {
+			budget.MaxErrorRate = 0.5
+		}
+		if budget.MinCalls <= 0 {
+			budget.MinCalls = 20
+		}
+		if budget.Cooldown <= 0 {
+			budget.Cooldown = 30 * time.Second
+		}
+		t.stages[stage] = &stageState{budget: budget}
+		metrics.RecordStageAutoDisabled(stage, false)
+	}
+	return t, nil
+}
+
+func knownStage(stage string) bool {
+	for _, known := range Stages {
+		if stage == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow reports whether the stage should run, false while it is disabled for
+// exceeding its budget
+func (t *Tracker) Allow(stage string) bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.stages[stage]
+	if !ok || state.disabledUntil.IsZero() {
+		return true
+	}
+	if t.now().Before(state.disabledUntil) {
+		return false
+	}
+	// The cool-down is over, start over with a clean window
+	state.disabledUntil = time.Time{}
+	state.buckets = [buckets]bucket{}
+	metrics.RecordStageAutoDisabled(stage, false)
+	log.Printf("Re-enabling pipeline stage %s after its error budget cool-down", stage)
+	return true
+}
+
+// Record counts a call of the stage, failed when err is not nil, and disables
+// the stage if its error rate over the window exceeds the budget
+func (t *Tracker) Record(stage string, err error) {
+	if t == nil {
+		return
+	}
+	if err != nil {
+		metrics.RecordStageError(stage)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.stages[stage]
+	if !ok || !state.disabledUntil.IsZero() {
+		return
+	}
+
+	now := t.now()
+	width := t.window / buckets
+	start := now.Truncate(width)
+	current := &state.buckets[(start.UnixNano()/int64(width))%buckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	current.calls++
+	if err != nil {
+		current.errors++
+	}
+
+	var calls, errors int
+	for _, b := range state.buckets {
+		if now.Sub(b.start) < t.window {
+			calls += b.calls
+			errors += b.errors
+		}
+	}
+	if calls < state.budget.MinCalls || float64(errors) <= state.budget.MaxErrorRate*float64(calls) {
+		return
+	}
+	state.disabledUntil = now.Add(state.budget.Cooldown)
+	metrics.RecordStageAutoDisabled(stage, true)
+	log.Printf("ALERT: pipeline stage %s failed %d of %d calls in the last %s, over its error budget of %.0f%%; disabling it for %s (last error: %v)",
+		stage, errors, calls, t.window, 100*state.budget.MaxErrorRate, state.budget.Cooldown, err)
+}
+
+// Disabled returns the stages currently disabled for exceeding their budget,
+// sorted
+func (t *Tracker) Disabled() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var disabled []string
+	for stage, state := range t.stages {
+		if !state.disabledUntil.IsZero() && now.Before(state.disabledUntil) {
+			disabled = append(disabled, stage)
+		}
+	}
+	sort.Strings(disabled)
+	return disabled
+}
+
+// Health reports the router degraded while any stage is disabled
+func (t *Tracker) Health() (bool, string) {
+	disabled := t.Disabled()
+	if len(disabled) == 0 {
+		return true, ""
+	}
+	return false, "over error budget, disabled: " + strings.Join(disabled, ", ")
+}
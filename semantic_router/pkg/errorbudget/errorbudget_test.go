@@ -0,0 +1,107 @@
+package errorbudget
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var errBackend = errors.New("backend unavailable")
+
+func newTestTracker(t *testing.T, now *time.Time) *Tracker {
+	t.Helper()
+	tracker, err := New(Options{
+		Window: 10 * time.Second,
+		Budgets: map[string]Budget{
+			StageCache: {MaxErrorRate: 0.5, MinCalls: 4, Cooldown: 30 * time.Second},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	tracker.now = func() time.Time { return *now }
+	return tracker
+}
+
+func TestDisablesStageOverBudget(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tracker := newTestTracker(t, &now)
+
+	// Below the minimum number of calls the rate is not checked
+	for i := 0; i < 3; i++ {
+		tracker.Record(StageCache, errBackend)
+	}
+	if !tracker.Allow(StageCache) {
+		t.Fatal("stage disabled before reaching the minimum number of calls")
+	}
+	tracker.Record(StageCache, errBackend)
+	if tracker.Allow(StageCache) {
+		t.Fatal("stage still enabled after 4 failures out of 4 calls")
+	}
+	if got := tracker.Disabled(); !reflect.DeepEqual(got, []string{StageCache}) {
+		t.Errorf("Disabled() = %v", got)
+	}
+	if healthy, detail := tracker.Health(); healthy || detail == "" {
+		t.Errorf("Health() = %v, %q, want degraded", healthy, detail)
+	}
+
+	// Stages without a budget are never disabled
+	for i := 0; i < 10; i++ {
+		tracker.Record(StageClassification, errBackend)
+	}
+	if !tracker.Allow(StageClassification) {
+		t.Error("stage without a budget disabled")
+	}
+
+	// Enabled again with a clean window after the cool-down
+	now = now.Add(31 * time.Second)
+	if !tracker.Allow(StageCache) {
+		t.Fatal("stage still disabled after the cool-down")
+	}
+	tracker.Record(StageCache, errBackend)
+	if !tracker.Allow(StageCache) {
+		t.Error("failures before the cool-down counted again")
+	}
+	if healthy, _ := tracker.Health(); !healthy {
+		t.Error("expected healthy once no stage is disabled")
+	}
+}
+
+func TestErrorsWithinBudget(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tracker := newTestTracker(t, &now)
+	for i := 0; i < 10; i++ {
+		tracker.Record(StageCache, nil)
+		tracker.Record(StageCache, errBackend)
+	}
+	if !tracker.Allow(StageCache) {
+		t.Error("stage disabled at an error rate of 50%, within its budget")
+	}
+}
+
+func TestFailuresOutsideWindowExpire(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tracker := newTestTracker(t, &now)
+	for i := 0; i < 3; i++ {
+		tracker.Record(StageCache, errBackend)
+	}
+	now = now.Add(15 * time.Second)
+	tracker.Record(StageCache, nil)
+	tracker.Record(StageCache, errBackend)
+	if !tracker.Allow(StageCache) {
+		t.Error("failures older than the window counted against the budget")
+	}
+}
+
+func TestNewRejectsUnknownStages(t *testing.T) {
+	if _, err := New(Options{Budgets: map[string]Budget{"mutation": {}}}); err == nil {
+		t.Error("expected an error for a stage without error tracking")
+	}
+
+	var tracker *Tracker
+	tracker.Record(StageCache, errBackend)
+	if !tracker.Allow(StageCache) {
+		t.Error("expected a nil tracker to allow every stage")
+	}
+}
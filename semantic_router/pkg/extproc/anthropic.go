@@ -0,0 +1,446 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// chatCompletionsPath is the path of translated Messages API requests
+const chatCompletionsPath = "/v1/chat/completions"
+
+// translatesMessages reports whether Messages API requests routed to a model
+// are translated to chat completions
+func (r *OpenAIRouter) translatesMessages(model string) bool {
+	cfg := r.Config.AnthropicMessages
+	return cfg.TranslateToOpenAI && !slices.Contains(cfg.NativeModels, model)
+}
+
+// translatedPath returns the chat completions path of a Messages API request,
+// keeping the prefix the API is mounted under and the query
+func translatedPath(path string) string {
+	path, query, hasQuery := strings.Cut(path, "?")
+	if i := strings.LastIndex(path, "/v1/messages"); i >= 0 {
+		path = path[:i] + chatCompletionsPath
+	} else {
+		path = chatCompletionsPath
+	}
+	if hasQuery {
+		path += "?" + query
+	}
+	return path
+}
+
+// messagesRequest is the part of a Messages API request that is translated;
+// fields without a chat completions counterpart, e.g. top_k, are dropped
+type messagesRequest struct {
+	Model         string              `json:"model"`
+	System        json.RawMessage     `json:"system"`
+	Messages      []messagesMessage   `json:"messages"`
+	MaxTokens     *int                `json:"max_tokens"`
+	Temperature   *float64            `json:"temperature"`
+	TopP          *float64            `json:"top_p"`
+	StopSequences []string            `json:"stop_sequences"`
+	Stream        bool                `json:"stream"`
+	Tools         []messagesTool      `json:"tools"`
+	ToolChoice    *messagesToolChoice `json:"tool_choice"`
+	Metadata      *struct {
+		UserID string `json:"user_id"`
+	} `json:"metadata"`
+}
+
+type messagesMessage struct {
+	Role string `json:"role"`
+	// A string or an array of content blocks
+	Content json.RawMessage `json:"content"`
+}
+
+// messagesBlock is a content block of a message: text, an image, a tool call
+// of the assistant or the output of a tool returned by the user
+type messagesBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	// Source of an image
+	Source *struct {
+		Type      string `json:"type"`
+		MediaType string `json:"media_type"`
+		Data      string `json:"data"`
+		URL       string `json:"url"`
+	} `json:"source"`
+	// Call of a tool_use block
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+	// Output of a tool_result block, a string or an array of content blocks
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+}
+
+type messagesTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type messagesToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use"`
+}
+
+// messagesBlocks decodes content, a string or an array of content blocks
+func messagesBlocks(content json.RawMessage) ([]messagesBlock, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 || string(content) == "null" {
+		return nil, nil
+	}
+	if content[0] == '"' {
+		var text string
+		if err := json.Unmarshal(content, &text); err != nil {
+			return nil, err
+		}
+		return []messagesBlock{{Type: contentPartText, Text: text}}, nil
+	}
+	var blocks []messagesBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return nil, fmt.Errorf("invalid content blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// blocksText joins the text of the text blocks of content, one per line
+func blocksText(content json.RawMessage) (string, error) {
+	blocks, err := messagesBlocks(content)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, block := range blocks {
+		if block.Type == contentPartText && block.Text != "" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// translateMessagesRequest translates a Messages API request to a chat
+// completion request. The system prompt becomes a system message, tool_use
+// blocks tool calls of the assistant, and tool_result blocks tool messages
+// preceding the rest of the user's message.
+func translateMessagesRequest(body []byte) ([]byte, error) {
+	var req messagesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+
+	var messages []map[string]any
+	if system, err := blocksText(req.System); err != nil {
+		return nil, fmt.Errorf("invalid system prompt: %w", err)
+	} else if system != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": system})
+	}
+	for i, msg := range req.Messages {
+		blocks, err := messagesBlocks(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		var parts []map[string]any
+		var texts []string
+		var toolCalls []map[string]any
+		hasImage := false
+		for _, block := range blocks {
+			switch block.Type {
+			case contentPartText:
+				texts = append(texts, block.Text)
+				parts = append(parts, map[string]any{"type": contentPartText, "text": block.Text})
+			case "image":
+				if block.Source == nil {
+					continue
+				}
+				url := block.Source.URL
+				if block.Source.Type == "base64" {
+					url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+				}
+				hasImage = true
+				parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]string{"url": url}})
+			case "tool_use":
+				arguments := "{}"
+				if len(block.Input) > 0 {
+					arguments = string(block.Input)
+				}
+				toolCalls = append(toolCalls, map[string]any{
+					"id":       block.ID,
+					"type":     "function",
+					"function": map[string]string{"name": block.Name, "arguments": arguments},
+				})
+			case "tool_result":
+				output, err := blocksText(block.Content)
+				if err != nil {
+					return nil, fmt.Errorf("message %d: tool result: %w", i, err)
+				}
+				messages = append(messages, map[string]any{"role": "tool", "tool_call_id": block.ToolUseID, "content": output})
+			}
+		}
+
+		translated := map[string]any{"role": msg.Role}
+		switch {
+		case hasImage:
+			translated["content"] = parts
+		case len(texts) > 0:
+			translated["content"] = strings.Join(texts, "\n")
+		case len(toolCalls) > 0:
+			translated["content"] = nil
+		default:
+			// A message of tool results alone
+			if len(blocks) > 0 {
+				continue
+			}
+			translated["content"] = ""
+		}
+		if len(toolCalls) > 0 {
+			translated["tool_calls"] = toolCalls
+		}
+		messages = append(messages, translated)
+	}
+
+	translated := map[string]any{"model": req.Model, "messages": messages}
+	if req.MaxTokens != nil {
+		translated["max_tokens"] = *req.MaxTokens
+	}
+	if req.Temperature != nil {
+		translated["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		translated["top_p"] = *req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		translated["stop"] = req.StopSequences
+	}
+	if req.Stream {
+		// The usage is needed for the final message_delta event
+		translated["stream"] = true
+		translated["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if req.Metadata != nil && req.Metadata.UserID != "" {
+		translated["user"] = req.Metadata.UserID
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			function := map[string]any{"name": tool.Name}
+			if tool.Description != "" {
+				function["description"] = tool.Description
+			}
+			if len(tool.InputSchema) > 0 {
+				function["parameters"] = tool.InputSchema
+			}
+			tools = append(tools, map[string]any{"type": "function", "function": function})
+		}
+		translated["tools"] = tools
+	}
+	if choice := req.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "auto", "none":
+			translated["tool_choice"] = choice.Type
+		case "any":
+			translated["tool_choice"] = "required"
+		case "tool":
+			translated["tool_choice"] = map[string]any{"type": "function", "function": map[string]string{"name": choice.Name}}
+		}
+		if choice.DisableParallelToolUse {
+			translated["parallel_tool_calls"] = false
+		}
+	}
+	return encodeRequestBody(translated)
+}
+
+// messagesResponse is a Messages API response, or an error when Type is
+// "error"
+type messagesResponse struct {
+	ID           string                  `json:"id,omitempty"`
+	Type         string                  `json:"type"`
+	Role         string                  `json:"role,omitempty"`
+	Model        string                  `json:"model,omitempty"`
+	Content      []messagesResponseBlock `json:"content,omitempty"`
+	StopReason   string                  `json:"stop_reason,omitempty"`
+	StopSequence *string                 `json:"stop_sequence,omitempty"`
+	Usage        *messagesUsage          `json:"usage,omitempty"`
+	Error        *messagesError          `json:"error,omitempty"`
+}
+
+type messagesResponseBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type messagesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type messagesError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// messagesStopReasons maps the finish reasons of chat completions to the stop
+// reasons of messages; others end the turn
+var messagesStopReasons = map[string]string{
+	"length":         "max_tokens",
+	"tool_calls":     "tool_use",
+	"function_call":  "tool_use",
+	"content_filter": "refusal",
+}
+
+// messagesErrorType returns the Messages API error type of a status
+func messagesErrorType(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+	if status >= 500 {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
+
+// translateChatCompletion translates a chat completion, or the error an
+// upstream answered with, to a Messages API response. Only the first choice
+// is kept, since messages have one.
+func translateChatCompletion(body []byte, status int) ([]byte, error) {
+	var completion struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content   string     `json:"content"`
+				ToolCalls []ToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage OpenAIUsage `json:"usage"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, fmt.Errorf("failed to parse chat completion: %w", err)
+	}
+	if status >= 400 || completion.Error != nil {
+		if status < 400 {
+			status = http.StatusInternalServerError
+		}
+		message := http.StatusText(status)
+		if completion.Error != nil && completion.Error.Message != "" {
+			message = completion.Error.Message
+		}
+		return json.Marshal(messagesResponse{Type: "error", Error: &messagesError{Type: messagesErrorType(status), Message: message}})
+	}
+
+	message := messagesResponse{
+		ID:         "msg_" + strings.TrimPrefix(completion.ID, "chatcmpl-"),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      completion.Model,
+		Content:    []messagesResponseBlock{},
+		StopReason: "end_turn",
+		Usage:      &messagesUsage{InputTokens: completion.Usage.PromptTokens, OutputTokens: completion.Usage.CompletionTokens},
+	}
+	if len(completion.Choices) > 0 {
+		choice := completion.Choices[0]
+		if choice.Message.Content != "" {
+			message.Content = append(message.Content, messagesResponseBlock{Type: contentPartText, Text: choice.Message.Content})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			input := json.RawMessage(call.Function.Arguments)
+			if !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			message.Content = append(message.Content, messagesResponseBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+		}
+		if reason, ok := messagesStopReasons[choice.FinishReason]; ok {
+			message.StopReason = reason
+		}
+	}
+	return json.Marshal(message)
+}
+
+// messagesEventStream replays a translated response as the server-sent events
+// of a streamed message, each content block in a single delta
+func messagesEventStream(body []byte) ([]byte, error) {
+	var message messagesResponse
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+	var stream bytes.Buffer
+	// Events are named after their type
+	send := func(events ...map[string]any) error {
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&stream, "event: %s\ndata: %s\n\n", event["type"], data)
+		}
+		return nil
+	}
+	if message.Type == "error" {
+		if err := send(map[string]any{"type": "error", "error": message.Error}); err != nil {
+			return nil, err
+		}
+		return stream.Bytes(), nil
+	}
+
+	usage := message.Usage
+	if usage == nil {
+		usage = &messagesUsage{}
+	}
+	start := message
+	start.Content, start.StopReason = []messagesResponseBlock{}, ""
+	start.Usage = &messagesUsage{InputTokens: usage.InputTokens}
+	if err := send(map[string]any{"type": "message_start", "message": start}); err != nil {
+		return nil, err
+	}
+	for i, block := range message.Content {
+		opening := map[string]any{"type": contentPartText, "text": ""}
+		delta := map[string]any{"type": "text_delta", "text": block.Text}
+		if block.Type == "tool_use" {
+			opening = map[string]any{"type": "tool_use", "id": block.ID, "name": block.Name, "input": map[string]any{}}
+			delta = map[string]any{"type": "input_json_delta", "partial_json": string(block.Input)}
+		}
+		if err := send(
+			map[string]any{"type": "content_block_start", "index": i, "content_block": opening},
+			map[string]any{"type": "content_block_delta", "index": i, "delta": delta},
+			map[string]any{"type": "content_block_stop", "index": i},
+		); err != nil {
+			return nil, err
+		}
+	}
+	if err := send(
+		map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": message.StopReason, "stop_sequence": nil},
+			"usage": map[string]int{"output_tokens": usage.OutputTokens},
+		},
+		map[string]any{"type": "message_stop"},
+	); err != nil {
+		return nil, err
+	}
+	return stream.Bytes(), nil
+}
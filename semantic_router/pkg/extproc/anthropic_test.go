@@ -0,0 +1,159 @@
+package extproc
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+)
+
+func TestTranslateMessagesRequest(t *testing.T) {
+	body := `{
+		"model": "claude",
+		"system": [{"type": "text", "text": "Be brief"}],
+		"max_tokens": 256,
+		"top_k": 5,
+		"stop_sequences": ["END"],
+		"stream": true,
+		"tools": [{"name": "weather", "description": "Current weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any", "disable_parallel_tool_use": true},
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "Weather here?"}, {"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "aGk="}}]},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": {"city": "Paris"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "toolu_1", "content": "Sunny"}, {"type": "text", "text": "Thanks"}]}
+		]
+	}`
+	translated, err := translateMessagesRequest([]byte(body))
+	if err != nil {
+		t.Fatalf("translateMessagesRequest: %v", err)
+	}
+	for path, want := range map[string]string{
+		"model":                              "claude",
+		"max_tokens":                         "256",
+		"stop":                               `["END"]`,
+		"stream_options.include_usage":       "true",
+		"tool_choice":                        "required",
+		"parallel_tool_calls":                "false",
+		"tools.0.function.parameters.type":   "object",
+		"messages.#":                         "5",
+		"messages.0.role":                    "system",
+		"messages.0.content":                 "Be brief",
+		"messages.1.content.1.image_url.url": "data:image/png;base64,aGk=",
+		"messages.2.content":                 "",
+		"messages.2.tool_calls.0.function.arguments": `{"city": "Paris"}`,
+		"messages.3.role":         "tool",
+		"messages.3.tool_call_id": "toolu_1",
+		"messages.3.content":      "Sunny",
+		"messages.4.content":      "Thanks",
+	} {
+		if got := gjson.GetBytes(translated, path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if gjson.GetBytes(translated, "top_k").Exists() || gjson.GetBytes(translated, "system").Exists() {
+		t.Errorf("untranslated fields kept: %s", translated)
+	}
+}
+
+func TestTranslateChatCompletion(t *testing.T) {
+	completion := `{"id":"chatcmpl-1","model":"math-model","choices":[{"message":{"role":"assistant","content":"Let me check","tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":12,"completion_tokens":7,"total_tokens":19}}`
+	message, err := translateChatCompletion([]byte(completion), http.StatusOK)
+	if err != nil {
+		t.Fatalf("translateChatCompletion: %v", err)
+	}
+	want := `{"id":"msg_1","type":"message","role":"assistant","model":"math-model","content":[{"type":"text","text":"Let me check"},{"type":"tool_use","id":"call_1","name":"weather","input":{"city":"Paris"}}],"stop_reason":"tool_use","usage":{"input_tokens":12,"output_tokens":7}}`
+	if string(message) != want {
+		t.Errorf("translated message:\n got %s\nwant %s", message, want)
+	}
+
+	failure, err := translateChatCompletion([]byte(`{"error":{"message":"slow down","type":"rate_limit_exceeded"}}`), http.StatusTooManyRequests)
+	if err != nil {
+		t.Fatalf("translateChatCompletion: %v", err)
+	}
+	if want := `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`; string(failure) != want {
+		t.Errorf("translated error = %s, want %s", failure, want)
+	}
+}
+
+func TestMessagesEventStream(t *testing.T) {
+	message := `{"id":"msg_1","type":"message","role":"assistant","model":"m","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`
+	stream, err := messagesEventStream([]byte(message))
+	if err != nil {
+		t.Fatalf("messagesEventStream: %v", err)
+	}
+	var events []string
+	for _, match := range regexp.MustCompile(`(?m)^event: (\S+)$`).FindAllStringSubmatch(string(stream), -1) {
+		events = append(events, match[1])
+	}
+	if got, want := strings.Join(events, ","), "message_start,content_block_start,content_block_delta,content_block_stop,message_delta,message_stop"; got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+	if !strings.Contains(string(stream), `"delta":{"text":"Hi","type":"text_delta"}`) || !strings.Contains(string(stream), `"usage":{"output_tokens":1}`) {
+		t.Errorf("unexpected stream:\n%s", stream)
+	}
+}
+
+func TestProcessMessages(t *testing.T) {
+	request := `{"model":"auto","max_tokens":64,"system":"Be brief","messages":[{"role":"user","content":[{"type":"text","text":"What is the derivative of x^2?"}]}]}`
+	completion := `{"id":"chatcmpl-1","object":"chat.completion","model":"math-model","choices":[{"index":0,"message":{"role":"assistant","content":"2x"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`
+	for _, tc := range []struct {
+		name      string
+		native    []string
+		translate bool
+	}{
+		{"translated", nil, true},
+		{"native model", []string{"math-model"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.Config.AnthropicMessages.TranslateToOpenAI = true
+			router.Config.AnthropicMessages.NativeModels = tc.native
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1", ":method", "POST", ":path", "/v1/messages?beta=true"),
+				requestBody(request),
+				responseHeaders("200"),
+				responseBody(completion, true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			common := stream.responses[1].GetRequestBody().GetResponse()
+			body := common.GetBodyMutation().GetBody()
+			if model := gjson.GetBytes(body, "model").String(); model != "math-model" {
+				t.Errorf("routed to %q, want math-model", model)
+			}
+			if translated := gjson.GetBytes(body, "messages.0.role").String() == "system"; translated != tc.translate {
+				t.Errorf("request translated %v, want %v: %s", translated, tc.translate, body)
+			}
+			if path := hasHeader(common.GetHeaderMutation(), ":path"); path != tc.translate {
+				t.Errorf("path rewritten %v, want %v", path, tc.translate)
+			}
+
+			response := stream.responses[3].GetResponseBody().GetResponse().GetBodyMutation().GetBody()
+			if tc.translate {
+				if gjson.GetBytes(response, "type").String() != "message" || gjson.GetBytes(response, "content.0.text").String() != "2x" {
+					t.Errorf("unexpected translated response %s", response)
+				}
+			} else if response != nil {
+				t.Errorf("response of a native model rewritten: %s", response)
+			}
+		})
+	}
+}
+
+func TestTranslatedPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/v1/messages":            "/v1/chat/completions",
+		"/llm/v1/messages?beta=1": "/llm/v1/chat/completions?beta=1",
+		"/tenants/acme/claude":    "/v1/chat/completions",
+	} {
+		if got := translatedPath(path); got != want {
+			t.Errorf("translatedPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
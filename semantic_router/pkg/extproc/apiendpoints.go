@@ -0,0 +1,161 @@
+package extproc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// API endpoints whose requests pass through without routing, by the metrics
+// label they are counted under
+const (
+	apiEndpointBatches             = "batches"
+	apiEndpointImageGenerations    = "images/generations"
+	apiEndpointImageEdits          = "images/edits"
+	apiEndpointImageVariations     = "images/variations"
+	apiEndpointAudioSpeech         = "audio/speech"
+	apiEndpointAudioTranscriptions = "audio/transcriptions"
+	apiEndpointAudioTranslations   = "audio/translations"
+	apiEndpointCountTokens         = "messages/count_tokens"
+	// Other image and audio endpoints
+	apiEndpointImages = "images"
+	apiEndpointAudio  = "audio"
+)
+
+// Routed API endpoints. Requests to unknown paths are routed as chat completions.
+const (
+	apiEndpointChatCompletions = "chat_completions"
+	apiEndpointCompletions     = "completions"
+	apiEndpointEmbeddings      = "embeddings"
+	// Anthropic Messages API
+	apiEndpointMessages = "messages"
+)
+
+// routedEndpoints maps path prefixes to the routed endpoints besides chat
+// completions they belong to
+var routedEndpoints = []struct {
+	prefix   string
+	endpoint string
+}{
+	{"/v1/completions", apiEndpointCompletions},
+	{"/v1/embeddings", apiEndpointEmbeddings},
+	{"/v1/messages", apiEndpointMessages},
+}
+
+// passthroughEndpoints maps path prefixes to the endpoints they belong to,
+// most specific first
+var passthroughEndpoints = []struct {
+	prefix   string
+	endpoint string
+}{
+	{"/v1/batches", apiEndpointBatches},
+	{"/v1/images/generations", apiEndpointImageGenerations},
+	{"/v1/images/edits", apiEndpointImageEdits},
+	{"/v1/images/variations", apiEndpointImageVariations},
+	{"/v1/images", apiEndpointImages},
+	{"/v1/audio/speech", apiEndpointAudioSpeech},
+	{"/v1/audio/transcriptions", apiEndpointAudioTranscriptions},
+	{"/v1/audio/translations", apiEndpointAudioTranslations},
+	{"/v1/audio", apiEndpointAudio},
+	{"/v1/messages/count_tokens", apiEndpointCountTokens},
+}
+
+// apiPathRule assigns the requests whose path matches a pattern to an endpoint
+type apiPathRule struct {
+	pattern  *regexp.Regexp
+	endpoint string
+}
+
+// apiPathMatcher detects the API endpoint of a request from its path, for
+// gateways mounting the API under a prefix such as /llm or /openai
+type apiPathMatcher struct {
+	// Prefixes stripped before matching the OpenAI paths, longest first
+	prefixes []string
+	rules    []apiPathRule
+}
+
+func newAPIPathMatcher(cfg config.APIPathsConfig) (*apiPathMatcher, error) {
+	m := &apiPathMatcher{}
+	for _, prefix := range cfg.Prefixes {
+		trimmed := strings.Trim(prefix, "/")
+		if trimmed == "" {
+			return nil, fmt.Errorf("invalid prefix %q", prefix)
+		}
+		m.prefixes = append(m.prefixes, "/"+trimmed)
+	}
+	sort.SliceStable(m.prefixes, func(i, j int) bool { return len(m.prefixes[i]) > len(m.prefixes[j]) })
+
+	known := map[string]bool{apiEndpointChatCompletions: true}
+	for _, candidate := range append(passthroughEndpoints, routedEndpoints...) {
+		known[candidate.endpoint] = true
+	}
+	for _, rule := range cfg.Rules {
+		if !known[rule.Endpoint] {
+			return nil, fmt.Errorf("unknown endpoint %q for pattern %q", rule.Endpoint, rule.Pattern)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", rule.Pattern, err)
+		}
+		m.rules = append(m.rules, apiPathRule{pattern: re, endpoint: rule.Endpoint})
+	}
+	return m, nil
+}
+
+// passthroughEndpoint returns the endpoint of a request that passes through
+// without routing, or an empty string for requests to route
+func (m *apiPathMatcher) passthroughEndpoint(path string) string {
+	if endpoint := m.endpoint(path); !isRoutedEndpoint(endpoint) {
+		return endpoint
+	}
+	return ""
+}
+
+// routedEndpoint returns the endpoint of a request to route, chat_completions,
+// completions, embeddings or messages, or an empty string for requests
+// passing through
+func (m *apiPathMatcher) routedEndpoint(path string) string {
+	if endpoint := m.endpoint(path); isRoutedEndpoint(endpoint) {
+		return endpoint
+	}
+	return ""
+}
+
+// isRoutedEndpoint reports whether requests to an endpoint are routed
+func isRoutedEndpoint(endpoint string) bool {
+	switch endpoint {
+	case apiEndpointChatCompletions, apiEndpointCompletions, apiEndpointEmbeddings, apiEndpointMessages:
+		return true
+	}
+	return false
+}
+
+// endpoint returns the endpoint of a request, chat_completions for chat
+// completions and requests to unknown paths. The first rule matching the path
+// wins, otherwise the path without a configured prefix is matched against
+// the OpenAI paths.
+func (m *apiPathMatcher) endpoint(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	if m != nil {
+		for _, rule := range m.rules {
+			if rule.pattern.MatchString(path) {
+				return rule.endpoint
+			}
+		}
+		for _, prefix := range m.prefixes {
+			if rest, ok := strings.CutPrefix(path, prefix); ok && strings.HasPrefix(rest, "/") {
+				path = rest
+				break
+			}
+		}
+	}
+	for _, candidate := range append(passthroughEndpoints, routedEndpoints...) {
+		if rest, ok := strings.CutPrefix(path, candidate.prefix); ok && (rest == "" || rest[0] == '/') {
+			return candidate.endpoint
+		}
+	}
+	return apiEndpointChatCompletions
+}
@@ -0,0 +1,145 @@
+package extproc
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestPassthroughEndpoint(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/v1/chat/completions"},
+		{path: ""},
+		{path: "/v1/batches", want: apiEndpointBatches},
+		{path: "/v1/batches?limit=10", want: apiEndpointBatches},
+		{path: "/v1/batches/batch_abc/cancel", want: apiEndpointBatches},
+		{path: "/v1/batchesx"},
+		{path: "/v1/images/generations", want: apiEndpointImageGenerations},
+		{path: "/v1/images/edits", want: apiEndpointImageEdits},
+		{path: "/v1/images/upscale", want: apiEndpointImages},
+		{path: "/v1/audio/speech", want: apiEndpointAudioSpeech},
+		{path: "/v1/audio/transcriptions?x=1", want: apiEndpointAudioTranscriptions},
+		{path: "/v1/audio/voices", want: apiEndpointAudio},
+		{path: "/v1/completions"},
+		{path: "/v1/embeddings"},
+		{path: "/v1/messages"},
+		{path: "/v1/messages/count_tokens", want: apiEndpointCountTokens},
+	}
+	var defaults *apiPathMatcher
+	for _, tt := range tests {
+		if got := defaults.passthroughEndpoint(tt.path); got != tt.want {
+			t.Errorf("passthroughEndpoint(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRoutedEndpoint(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/v1/chat/completions", want: apiEndpointChatCompletions},
+		{path: "/unknown", want: apiEndpointChatCompletions},
+		{path: "/v1/completions", want: apiEndpointCompletions},
+		{path: "/v1/embeddings?x=1", want: apiEndpointEmbeddings},
+		{path: "/v1/completionsx", want: apiEndpointChatCompletions},
+		{path: "/v1/messages", want: apiEndpointMessages},
+		{path: "/v1/images/generations"},
+	}
+	var defaults *apiPathMatcher
+	for _, tt := range tests {
+		if got := defaults.routedEndpoint(tt.path); got != tt.want {
+			t.Errorf("routedEndpoint(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPassthroughEndpointConfigured(t *testing.T) {
+	m, err := newAPIPathMatcher(config.APIPathsConfig{
+		Prefixes: []string{"llm/", "/llm/openai"},
+		Rules: []config.APIPathRule{
+			{Pattern: `^/tenants/[^/]+/images$`, Endpoint: apiEndpointImageGenerations},
+			{Pattern: `^/llm/v1/audio/realtime`, Endpoint: apiEndpointChatCompletions},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newAPIPathMatcher: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/llm/v1/images/generations", want: apiEndpointImageGenerations},
+		{path: "/llm/openai/v1/batches/batch_abc", want: apiEndpointBatches},
+		{path: "/llm/v1/chat/completions"},
+		{path: "/llmx/v1/images/generations"},
+		{path: "/v1/audio/speech", want: apiEndpointAudioSpeech},
+		{path: "/tenants/acme/images?x=1", want: apiEndpointImageGenerations},
+		{path: "/llm/v1/audio/realtime"},
+	}
+	for _, tt := range tests {
+		if got := m.passthroughEndpoint(tt.path); got != tt.want {
+			t.Errorf("passthroughEndpoint(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNewAPIPathMatcherRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.APIPathsConfig
+		wantErr string
+	}{
+		{name: "root prefix", cfg: config.APIPathsConfig{Prefixes: []string{"/"}}, wantErr: "invalid prefix"},
+		{name: "bad pattern", cfg: config.APIPathsConfig{Rules: []config.APIPathRule{{Pattern: "(", Endpoint: apiEndpointAudio}}}, wantErr: "invalid pattern"},
+		{name: "unknown endpoint", cfg: config.APIPathsConfig{Rules: []config.APIPathRule{{Pattern: "^/x", Endpoint: "video"}}}, wantErr: "unknown endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newAPIPathMatcher(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newAPIPathMatcher error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessImageGeneration(t *testing.T) {
+	router := newTestRouter(t, true)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	before := testutil.ToFloat64(metrics.PassthroughRequests.WithLabelValues(apiEndpointImageGenerations, "200"))
+
+	// Not a chat completion, so neither classified nor counted as a model request
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1", ":method", "POST", ":path", "/v1/images/generations"),
+		requestBody(`{"model":"dall-e-3","prompt":"a derivative","n":1,"size":"1024x1024"}`),
+		responseHeaders("200"),
+		responseBody(`{"created":1,"data":[{"b64_json":"aGVsbG8="}]}`, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	if len(stream.responses) != 4 {
+		t.Fatalf("got %d responses, want 4", len(stream.responses))
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse()
+	if body == nil || body.GetBodyMutation() != nil || body.GetHeaderMutation() != nil {
+		t.Errorf("expected the request to pass through unchanged, got %v", stream.responses[1])
+	}
+	if got := testutil.ToFloat64(metrics.PassthroughRequests.WithLabelValues(apiEndpointImageGenerations, "200")) - before; got != 1 {
+		t.Errorf("passthrough requests = %v, want 1", got)
+	}
+	if len(sink.records) != 0 {
+		t.Errorf("expected no decision record for a passthrough request, got %v", sink.records)
+	}
+}
@@ -0,0 +1,195 @@
+package extproc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/coordinator"
+)
+
+// Outcomes of requests of recognized applications
+const (
+	applicationAdmitted      = "admitted"
+	applicationQuotaExceeded = "quota_exceeded"
+)
+
+// applicationMatcher recognizes applications by their system prompt
+type applicationMatcher struct {
+	// Applications by the hash of their whole system prompt
+	byHash map[string]*config.ApplicationConfig
+	// Applications matched by prefix, in config order
+	byPrefix []*config.ApplicationConfig
+}
+
+// newApplicationMatcher creates a matcher of the configured applications, nil
+// when there are none
+func newApplicationMatcher(apps []config.ApplicationConfig) (*applicationMatcher, error) {
+	if len(apps) == 0 {
+		return nil, nil
+	}
+	m := &applicationMatcher{byHash: make(map[string]*config.ApplicationConfig)}
+	names := make(map[string]bool, len(apps))
+	for i := range apps {
+		app := &apps[i]
+		if app.Name == "" {
+			return nil, fmt.Errorf("application %d has no name", i)
+		}
+		if names[app.Name] {
+			return nil, fmt.Errorf("application %s is configured twice", app.Name)
+		}
+		names[app.Name] = true
+		if app.SystemPromptSHA256 == "" && app.SystemPromptPrefix == "" {
+			return nil, fmt.Errorf("application %s sets neither system_prompt_sha256 nor system_prompt_prefix", app.Name)
+		}
+		if app.RequestsPerMinute < 0 {
+			return nil, fmt.Errorf("application %s has a negative requests_per_minute", app.Name)
+		}
+		if hash := strings.ToLower(app.SystemPromptSHA256); hash != "" {
+			if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("application %s: system_prompt_sha256 is not a hex SHA-256", app.Name)
+			}
+			if _, ok := m.byHash[hash]; !ok {
+				m.byHash[hash] = app
+			}
+		}
+		if app.SystemPromptPrefix != "" {
+			m.byPrefix = append(m.byPrefix, app)
+		}
+	}
+	return m, nil
+}
+
+// match returns the application whose system prompt the request sends, nil
+// if none. Hashes are checked before prefixes.
+func (m *applicationMatcher) match(req *OpenAIRequest) *config.ApplicationConfig {
+	if m == nil {
+		return nil
+	}
+	var systemPrompt string
+	found := false
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			systemPrompt, found = msg.Content, true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	if len(m.byHash) > 0 {
+		sum := sha256.Sum256([]byte(strings.TrimSpace(systemPrompt)))
+		if app, ok := m.byHash[hex.EncodeToString(sum[:])]; ok {
+			return app
+		}
+	}
+	for _, app := range m.byPrefix {
+		if strings.HasPrefix(systemPrompt, app.SystemPromptPrefix) {
+			return app
+		}
+	}
+	return nil
+}
+
+// applicationModel returns the model an application's auto requests are sent
+// to without classification: its recommended model when recommendations are
+// applied, else its configured one. It is empty for requests of no
+// application, applications without a model, and requests sampled to explore
+// other models.
+func (r *OpenAIRouter) applicationModel(app *config.ApplicationConfig) string {
+	if app == nil {
+		return ""
+	}
+	learning := r.Config.ApplicationLearning
+	if r.Recommender != nil && learning.AutoApply {
+		if model := r.Recommender.Recommended(app); model != "" {
+			return model
+		}
+	}
+	if app.Model == "" || (r.Recommender != nil && r.random.Float64() < learning.ExploreRate) {
+		return ""
+	}
+	return app.Model
+}
+
+// applicationQuotas counts the requests of applications with a quota in fixed
+// one-minute windows. With a coordinator, usage is counted fleet-wide in the
+// coordinator's quota windows instead.
+type applicationQuotas struct {
+	coordinator *coordinator.Client
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func newApplicationQuotas(coordinatorClient *coordinator.Client) *applicationQuotas {
+	return &applicationQuotas{coordinator: coordinatorClient, counts: make(map[string]int)}
+}
+
+// quotaKey is the key of an application's quota shared with the coordinator
+func quotaKey(app *config.ApplicationConfig) string {
+	return "application:" + app.Name
+}
+
+// admit counts a request of the application, returning false without counting
+// it when the application is over its quota
+func (q *applicationQuotas) admit(app *config.ApplicationConfig, now time.Time) bool {
+	if app.RequestsPerMinute <= 0 {
+		return true
+	}
+	if q.coordinator != nil {
+		key := quotaKey(app)
+		if q.coordinator.QuotaUsage(key) >= int64(app.RequestsPerMinute) {
+			return false
+		}
+		q.coordinator.AddQuotaUsage(key, 1)
+		return true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if now.Sub(q.windowStart) >= time.Minute {
+		q.windowStart = now.Truncate(time.Minute)
+		clear(q.counts)
+	}
+	if q.counts[app.Name] >= app.RequestsPerMinute {
+		return false
+	}
+	q.counts[app.Name]++
+	return true
+}
+
+// applicationQuotaResponse rejects a request of an application over its quota
+// with an OpenAI style rate limit error
+func applicationQuotaResponse(app *config.ApplicationConfig) *ext_proc.ProcessingResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("application %s is over its quota of %d requests per minute", app.Name, app.RequestsPerMinute),
+			"type":    "rate_limit_exceeded",
+			"code":    http.StatusTooManyRequests,
+		},
+	})
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode_TooManyRequests},
+				Headers: &ext_proc.HeaderMutation{
+					SetHeaders: []*core.HeaderValueOption{
+						{Header: &core.HeaderValue{Key: "content-type", Value: "application/json"}},
+					},
+				},
+				Body: body,
+			},
+		},
+	}
+}
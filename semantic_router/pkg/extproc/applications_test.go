@@ -0,0 +1,180 @@
+package extproc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/recommend"
+)
+
+func TestApplicationMatcher(t *testing.T) {
+	const supportPrompt = "You are the support assistant of Acme."
+	sum := sha256.Sum256([]byte(supportPrompt))
+	matcher, err := newApplicationMatcher([]config.ApplicationConfig{
+		{Name: "coder", SystemPromptPrefix: "You are a coding assistant"},
+		{Name: "support", SystemPromptSHA256: hex.EncodeToString(sum[:])},
+		{Name: "generic", SystemPromptPrefix: "You are"},
+	})
+	if err != nil {
+		t.Fatalf("newApplicationMatcher: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		messages []ChatMessage
+		want     string
+	}{
+		{name: "prefix", messages: []ChatMessage{{Role: "system", Content: "You are a coding assistant. Be terse."}}, want: "coder"},
+		{name: "hash before prefix", messages: []ChatMessage{{Role: "system", Content: "  " + supportPrompt + "\n"}}, want: "support"},
+		{name: "changed prompt falls back to prefixes", messages: []ChatMessage{{Role: "system", Content: supportPrompt + " Today is Monday."}}, want: "generic"},
+		{name: "first system message", messages: []ChatMessage{{Role: "system", Content: "Answer in French."}, {Role: "system", Content: "You are a coding assistant"}}},
+		{name: "no system prompt", messages: []ChatMessage{{Role: "user", Content: "You are a coding assistant"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if app := matcher.match(&OpenAIRequest{Messages: tt.messages}); app != nil {
+				got = app.Name
+			}
+			if got != tt.want {
+				t.Errorf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var none *applicationMatcher
+	if none.match(&OpenAIRequest{Messages: tests[0].messages}) != nil {
+		t.Error("a nil matcher matched an application")
+	}
+}
+
+func TestNewApplicationMatcherRejects(t *testing.T) {
+	tests := map[string][]config.ApplicationConfig{
+		"no name":      {{SystemPromptPrefix: "You are"}},
+		"duplicate":    {{Name: "a", SystemPromptPrefix: "x"}, {Name: "a", SystemPromptPrefix: "y"}},
+		"no prompt":    {{Name: "a", Model: "math-model"}},
+		"bad hash":     {{Name: "a", SystemPromptSHA256: "abc"}},
+		"negative rpm": {{Name: "a", SystemPromptPrefix: "x", RequestsPerMinute: -1}},
+	}
+	for name, apps := range tests {
+		if _, err := newApplicationMatcher(apps); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestApplicationQuotaWindow(t *testing.T) {
+	quotas := newApplicationQuotas(nil)
+	app := &config.ApplicationConfig{Name: "coder", RequestsPerMinute: 2}
+	start := time.Date(2025, 1, 1, 12, 0, 10, 0, time.UTC)
+
+	for i, want := range []bool{true, true, false} {
+		if got := quotas.admit(app, start.Add(time.Duration(i)*time.Second)); got != want {
+			t.Errorf("request %d admitted = %v, want %v", i, got, want)
+		}
+	}
+	if !quotas.admit(app, start.Add(time.Minute)) {
+		t.Error("request in the next window was rejected")
+	}
+	if !quotas.admit(&config.ApplicationConfig{Name: "free"}, start) {
+		t.Error("application without a quota was rejected")
+	}
+}
+
+func TestProcessApplications(t *testing.T) {
+	router := newTestRouter(t, true)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	var err error
+	router.applications, err = newApplicationMatcher([]config.ApplicationConfig{{
+		Name:               "tutor",
+		SystemPromptPrefix: "You are a law tutor",
+		Model:              "law-model",
+		CachePartition:     "tutor",
+		RequestsPerMinute:  1,
+	}})
+	if err != nil {
+		t.Fatalf("newApplicationMatcher: %v", err)
+	}
+
+	send := func(id string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", id),
+			requestBody(`{"model":"auto","messages":[{"role":"system","content":"You are a law tutor."},{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+
+	// The application's model applies although the classifier picks math
+	stream := send("req-1")
+	body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if model := gjson.GetBytes(body, "model").String(); model != "law-model" {
+		t.Errorf("routed to %q, want law-model", model)
+	}
+	if app := sink.records[0].GetRouting().GetApplication(); app != "tutor" {
+		t.Errorf("decision record application = %q, want tutor", app)
+	}
+
+	// The second request in the minute is over the quota
+	stream = send("req-2")
+	immediate := stream.responses[1].GetImmediateResponse()
+	if immediate == nil || immediate.GetStatus().GetCode() != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429 response, got %v", stream.responses[1])
+	}
+	if got := gjson.GetBytes(immediate.GetBody(), "error.type").String(); got != "rate_limit_exceeded" {
+		t.Errorf("error type = %q", got)
+	}
+	if record := sink.records[1]; record.GetResponseStatus() != http.StatusTooManyRequests || record.GetRouting().GetApplication() != "tutor" {
+		t.Errorf("decision record status %d, application %q", record.GetResponseStatus(), record.GetRouting().GetApplication())
+	}
+}
+
+func TestApplicationModel(t *testing.T) {
+	router := newTestRouter(t, false)
+	app := &config.ApplicationConfig{Name: "tutor", Model: "law-model"}
+	if got := router.applicationModel(app); got != "law-model" {
+		t.Errorf("model without learning = %q, want law-model", got)
+	}
+	if got := router.applicationModel(nil); got != "" {
+		t.Errorf("model of no application = %q", got)
+	}
+
+	router.Recommender = recommend.New(recommend.Options{MinRequests: 1})
+	for i, model := range []string{"law-model", "math-model"} {
+		record := decision.New(fmt.Sprintf("req-%d", i))
+		record.Routing.Application = "tutor"
+		record.Routing.SelectedModel = model
+		record.ResponseStatus = http.StatusOK
+		if model == "law-model" {
+			record.ResponseStatus = http.StatusBadGateway
+		}
+		router.Recommender.Write(record)
+	}
+	if got := router.applicationModel(app); got != "law-model" {
+		t.Errorf("recommendation applied without auto_apply: %q", got)
+	}
+	router.Config.ApplicationLearning.AutoApply = true
+	if got := router.applicationModel(app); got != "math-model" {
+		t.Errorf("model with auto_apply = %q, want the recommended math-model", got)
+	}
+	router.Config.ApplicationLearning.AutoApply = false
+	router.Config.ApplicationLearning.ExploreRate = 1
+	if got := router.applicationModel(app); got != "" {
+		t.Errorf("explored request pinned to %q", got)
+	}
+}
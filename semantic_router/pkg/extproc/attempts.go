@@ -0,0 +1,125 @@
+package extproc
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// attemptState tracks the attempts seen for a single request
+type attemptState struct {
+	count     int
+	completed bool
+	lastSeen  time.Time
+	// Models whose backend failed an attempt, in order
+	failedModels []string
+}
+
+// attemptTracker counts attempts of the same request, keyed by request ID and
+// content, so retried requests are not double counted in metrics
+type attemptTracker struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	lastPrune time.Time
+	attempts  map[string]*attemptState
+}
+
+func newAttemptTracker(ttl time.Duration) *attemptTracker {
+	return &attemptTracker{
+		ttl:       ttl,
+		lastPrune: time.Now(),
+		attempts:  make(map[string]*attemptState),
+	}
+}
+
+// begin records a new attempt for the key and returns its attempt number, starting at 1
+func (t *attemptTracker) begin(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+
+	state, ok := t.attempts[key]
+	if !ok {
+		state = &attemptState{}
+		t.attempts[key] = state
+	}
+	state.count++
+	state.lastSeen = now
+	return state.count
+}
+
+// complete marks the request as completed and returns true only for the first completion
+func (t *attemptTracker) complete(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.attempts[key]
+	if !ok {
+		return true
+	}
+	if state.completed {
+		return false
+	}
+	state.completed = true
+	state.lastSeen = time.Now()
+	return true
+}
+
+// fail records that the model's backend failed an attempt of the request
+func (t *attemptTracker) fail(key, model string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.attempts[key]
+	if !ok {
+		return
+	}
+	if !slices.Contains(state.failedModels, model) {
+		state.failedModels = append(state.failedModels, model)
+	}
+	state.lastSeen = time.Now()
+}
+
+// failed returns the models whose backend failed earlier attempts of the request
+func (t *attemptTracker) failed(key string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if state, ok := t.attempts[key]; ok {
+		return slices.Clone(state.failedModels)
+	}
+	return nil
+}
+
+// prune removes attempts not seen within the TTL, at most twice per TTL.
+// Assumes the caller holds the lock
+func (t *attemptTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.ttl/2 {
+		return
+	}
+	t.expire(now)
+}
+
+// expire removes attempts not seen within the TTL, returning how many were
+// removed. Assumes the caller holds the lock
+func (t *attemptTracker) expire(now time.Time) int {
+	expired := 0
+	for key, state := range t.attempts {
+		if now.Sub(state.lastSeen) > t.ttl {
+			delete(t.attempts, key)
+			expired++
+		}
+	}
+	t.lastPrune = now
+	return expired
+}
+
+// sweep removes the expired attempts of requests no longer seen, for the
+// janitor; lookups only prune as they go
+func (t *attemptTracker) sweep() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.expire(time.Now())
+}
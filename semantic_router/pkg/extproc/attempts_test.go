@@ -0,0 +1,37 @@
+package extproc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttemptTracker(t *testing.T) {
+	tracker := newAttemptTracker(time.Minute)
+
+	if n := tracker.begin("req-1"); n != 1 {
+		t.Errorf("expected first attempt, got %d", n)
+	}
+	if n := tracker.begin("req-1"); n != 2 {
+		t.Errorf("expected second attempt, got %d", n)
+	}
+	if n := tracker.begin("req-2"); n != 1 {
+		t.Errorf("expected first attempt for other request, got %d", n)
+	}
+
+	if !tracker.complete("req-1") {
+		t.Error("expected first completion to be counted")
+	}
+	if tracker.complete("req-1") {
+		t.Error("expected duplicate completion to be ignored")
+	}
+
+	tracker.fail("req-1", "a")
+	tracker.fail("req-1", "a")
+	tracker.fail("unknown", "a")
+	if failed := tracker.failed("req-1"); len(failed) != 1 || failed[0] != "a" {
+		t.Errorf("failed models = %v, want [a]", failed)
+	}
+	if failed := tracker.failed("unknown"); failed != nil {
+		t.Errorf("failed models of an unknown request = %v", failed)
+	}
+}
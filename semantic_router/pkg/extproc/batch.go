@@ -0,0 +1,33 @@
+package extproc
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/batch"
+)
+
+// isBatchCreation reports whether a Batch API request creates a batch, i.e. is
+// a POST to the batches collection, wherever the API is mounted
+func isBatchCreation(headers map[string]string) bool {
+	path, _, _ := strings.Cut(headers[":path"], "?")
+	return headers[":method"] == http.MethodPost && strings.HasSuffix(path, "/batches")
+}
+
+// trackBatch hands the batch created by a successful Batch API response over
+// for reconciliation once it finishes
+func (r *OpenAIRouter) trackBatch(headers map[string]string, statusCode int, responseBody []byte) {
+	if r.Batches == nil || !isBatchCreation(headers) || statusCode != http.StatusOK {
+		return
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(responseBody, &created); err != nil || created.ID == "" {
+		slog.Warn("Error reading the created batch, its usage will not be accounted", "error", err)
+		return
+	}
+	r.Batches.Track(batch.Batch{ID: created.ID, Authorization: headers["authorization"]})
+}
@@ -0,0 +1,60 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/batch"
+)
+
+func TestIsBatchCreation(t *testing.T) {
+	tests := []struct {
+		method, path string
+		creation     bool
+	}{
+		{method: "POST", path: "/v1/batches", creation: true},
+		{method: "POST", path: "/v1/batches?beta=true", creation: true},
+		{method: "POST", path: "/llm/v1/batches", creation: true},
+		{method: "GET", path: "/v1/batches"},
+		{method: "POST", path: "/v1/batches/batch_abc/cancel"},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{":method": tt.method, ":path": tt.path}
+		if got := isBatchCreation(headers); got != tt.creation {
+			t.Errorf("isBatchCreation(%s %s) = %v, want %v", tt.method, tt.path, got, tt.creation)
+		}
+	}
+}
+
+func TestProcessBatchRequest(t *testing.T) {
+	router := newTestRouter(t, true)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	router.Batches = batch.New(batch.Options{BaseURL: "http://127.0.0.1:0"})
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1", ":method", "POST", ":path", "/v1/batches", "authorization", "Bearer client-key"),
+		requestBody(`{"input_file_id":"file-in","endpoint":"/v1/chat/completions","completion_window":"24h"}`),
+		responseHeaders("200"),
+		responseBody(`{"id":"batch_abc","object":"batch","status":"validating"}`, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	if len(stream.responses) != 4 {
+		t.Fatalf("got %d responses, want 4", len(stream.responses))
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse()
+	if body == nil || body.GetBodyMutation() != nil || body.GetHeaderMutation() != nil {
+		t.Errorf("expected the batch request to pass through unchanged, got %v", stream.responses[1])
+	}
+	if router.Batches.Pending() != 1 {
+		t.Errorf("pending batches = %d, want 1", router.Batches.Pending())
+	}
+	if len(sink.records) != 0 {
+		t.Errorf("expected no decision record for a batch request, got %v", sink.records)
+	}
+}
@@ -0,0 +1,233 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// blockVariables are the variables available in block response templates
+type blockVariables struct {
+	Category  string
+	RequestID string
+	Tenant    string
+	Model     string
+}
+
+// defaultBlockResponse is returned for blocked categories without a block_response
+var defaultBlockResponse = mustParseBlockResponse(config.ResponseTemplate{
+	Message: "Requests about {{.Category}} are not allowed",
+})
+
+// blockResponse is a parsed block response template
+type blockResponse struct {
+	status  int
+	headers map[string]*template.Template
+	message *template.Template
+	body    *template.Template
+	// Type of the OpenAI-style error body, category_blocked by default
+	errorType string
+}
+
+// blockResponses holds the parsed block responses by category
+type blockResponses map[string]*blockResponse
+
+// newBlockResponses parses the block responses of the categories
+func newBlockResponses(categories []config.Category) (blockResponses, error) {
+	responses := make(blockResponses)
+	for _, category := range categories {
+		if category.BlockResponse == nil {
+			continue
+		}
+		response, err := parseBlockResponse(*category.BlockResponse)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block_response for category %s: %w", category.Name, err)
+		}
+		responses[category.Name] = response
+	}
+	return responses, nil
+}
+
+func mustParseBlockResponse(tmpl config.ResponseTemplate) *blockResponse {
+	response, err := parseBlockResponse(tmpl)
+	if err != nil {
+		panic(err)
+	}
+	return response
+}
+
+// parseBlockResponse parses a response template and renders it once with
+// sample variables, so mistakes such as unknown variables or a body that is
+// not JSON are reported at startup
+func parseBlockResponse(tmpl config.ResponseTemplate) (*blockResponse, error) {
+	response := &blockResponse{status: tmpl.Status, headers: make(map[string]*template.Template, len(tmpl.Headers))}
+	if response.status == 0 {
+		response.status = http.StatusForbidden
+	}
+	if response.status < 200 || response.status > 599 {
+		return nil, fmt.Errorf("status %d is not a valid response status", response.status)
+	}
+	var err error
+	if response.message, err = template.New("message").Parse(tmpl.Message); err != nil {
+		return nil, err
+	}
+	if tmpl.Body != "" {
+		if response.body, err = template.New("body").Parse(tmpl.Body); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range tmpl.Headers {
+		if response.headers[strings.ToLower(name)], err = template.New(name).Parse(value); err != nil {
+			return nil, err
+		}
+	}
+
+	sample := blockVariables{Category: "category", RequestID: "request-id", Tenant: "tenant", Model: "model"}
+	if _, err := response.renderBody(sample); err != nil {
+		return nil, err
+	}
+	for name, header := range response.headers {
+		if _, err := execute(header, sample); err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+	}
+	return response, nil
+}
+
+// render returns the immediate response for a blocked request and its status
+func (b blockResponses) render(vars blockVariables) (*ext_proc.ProcessingResponse, int) {
+	response, ok := b[vars.Category]
+	if !ok {
+		response = defaultBlockResponse
+	}
+	return response.render(vars, defaultBlockResponse)
+}
+
+// render returns the immediate response for a blocked request and its status,
+// rendering the fallback response if this one fails to render
+func (b *blockResponse) render(vars blockVariables, fallback *blockResponse) (*ext_proc.ProcessingResponse, int) {
+	response := b
+	body, err := response.renderBody(vars)
+	if err != nil {
+		slog.Error("Error rendering block response, using the default", "request_id", vars.RequestID, "category", vars.Category, "error", err)
+		response = fallback
+		body, _ = response.renderBody(vars)
+	}
+
+	headers := []*core.HeaderValueOption{
+		{Header: &core.HeaderValue{Key: "content-type", Value: "application/json"}},
+	}
+	// Header values can't span lines
+	oneLine := strings.NewReplacer("\r", "", "\n", "")
+	for _, name := range slices.Sorted(maps.Keys(response.headers)) {
+		value, err := execute(response.headers[name], vars)
+		if err != nil {
+			slog.Error("Error rendering block response header", "request_id", vars.RequestID, "header", name, "error", err)
+			continue
+		}
+		headers = append(headers, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: name, Value: oneLine.Replace(value)},
+		})
+	}
+
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(response.status)},
+				Headers: &ext_proc.HeaderMutation{SetHeaders: headers},
+				Body:    body,
+			},
+		},
+	}, response.status
+}
+
+// renderBody renders the configured body, or an OpenAI-style body carrying the
+// message: a chat completion for successful statuses, an error otherwise
+func (b *blockResponse) renderBody(vars blockVariables) ([]byte, error) {
+	if b.body != nil {
+		escaped := blockVariables{
+			Category:  jsonEscape(vars.Category),
+			RequestID: jsonEscape(vars.RequestID),
+			Tenant:    jsonEscape(vars.Tenant),
+			Model:     jsonEscape(vars.Model),
+		}
+		body, err := execute(b.body, escaped)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid([]byte(body)) {
+			return nil, fmt.Errorf("body is not valid JSON: %s", body)
+		}
+		return []byte(body), nil
+	}
+
+	message, err := execute(b.message, vars)
+	if err != nil {
+		return nil, err
+	}
+	if b.status >= 300 {
+		errorType := b.errorType
+		if errorType == "" {
+			errorType = "category_blocked"
+		}
+		return json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": message,
+				"type":    errorType,
+				"code":    b.status,
+			},
+		})
+	}
+	return json.Marshal(map[string]interface{}{
+		"id":      "blocked-" + vars.RequestID,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   vars.Model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": message},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+func execute(tmpl *template.Template, vars blockVariables) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// jsonEscape escapes a value for use inside a JSON string
+func jsonEscape(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted[1 : len(quoted)-1])
+}
+
+// categoryBlocked returns whether requests of the category are blocked, for
+// every tenant or by the tenant's policy
+func (r *OpenAIRouter) categoryBlocked(category, tenant string) bool {
+	if category == "" {
+		return false
+	}
+	for _, c := range r.Config.Categories {
+		if c.Name == category && c.Blocked {
+			return true
+		}
+	}
+	return r.Residency.PolicyFor(tenant).BlocksCategory(category)
+}
@@ -0,0 +1,130 @@
+package extproc
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+)
+
+func TestProcessBlockedCategory(t *testing.T) {
+	tests := []struct {
+		name        string
+		blocked     bool
+		template    *config.ResponseTemplate
+		tenant      string
+		wantStatus  int
+		wantBody    string
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "blocked for everyone with the default response",
+			blocked:    true,
+			wantStatus: 403,
+			wantBody:   `"message":"Requests about law are not allowed"`,
+		},
+		{
+			name:   "blocked by the tenant with a message",
+			tenant: "kids-app",
+			template: &config.ResponseTemplate{
+				Status:  200,
+				Headers: map[string]string{"X-Blocked-Category": "{{.Category}}"},
+				Message: "Sorry {{.Tenant}}, no {{.Category}} questions",
+			},
+			wantStatus:  200,
+			wantBody:    `"content":"Sorry kids-app, no law questions"`,
+			wantHeaders: map[string]string{"x-blocked-category": "law"},
+		},
+		{
+			name:       "exact body",
+			blocked:    true,
+			template:   &config.ResponseTemplate{Status: 451, Body: `{"blocked":"{{.Category}}","request":"{{.RequestID}}"}`},
+			wantStatus: 451,
+			wantBody:   `{"blocked":"law","request":"req-\"1\""}`,
+		},
+		{name: "other tenant", tenant: "acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			sink := &recordingSink{}
+			router.Decisions = sink
+			router.Config.Categories[1].Blocked = tt.blocked
+			router.Config.Categories[1].BlockResponse = tt.template
+			var err error
+			if router.blockResponses, err = newBlockResponses(router.Config.Categories); err != nil {
+				t.Fatalf("newBlockResponses: %v", err)
+			}
+			router.Residency, err = policy.NewResidency(policy.ResidencyOptions{
+				Tenants: []config.TenantPolicy{{Name: "kids-app", BlockedCategories: []string{"law"}}},
+			})
+			if err != nil {
+				t.Fatalf("NewResidency: %v", err)
+			}
+
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", `req-"1"`, "x-tenant-id", tt.tenant),
+				requestBody(`{"model":"auto","messages":[{"role":"user","content":"Who owns this contract?"}]}`),
+			}}
+			if err := router.Process(stream); err != nil && err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			immediate := stream.responses[1].GetImmediateResponse()
+			if tt.wantStatus == 0 {
+				if immediate != nil {
+					t.Fatalf("request blocked with %d: %s", immediate.GetStatus().GetCode(), immediate.GetBody())
+				}
+				return
+			}
+			if got := int(immediate.GetStatus().GetCode()); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if !json.Valid(immediate.GetBody()) || !strings.Contains(string(immediate.GetBody()), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", immediate.GetBody(), tt.wantBody)
+			}
+			headers := make(map[string]string)
+			for _, header := range immediate.GetHeaders().GetSetHeaders() {
+				headers[header.GetHeader().GetKey()] = header.GetHeader().GetValue()
+			}
+			for name, want := range tt.wantHeaders {
+				if headers[name] != want {
+					t.Errorf("header %s = %q, want %q", name, headers[name], want)
+				}
+			}
+			if router.Cache.PendingCount() != 0 {
+				t.Errorf("blocked request left %d pending cache entries", router.Cache.PendingCount())
+			}
+			record := sink.records[0]
+			if record.GetResponseStatus() != int32(tt.wantStatus) || record.GetRouting().GetPolicyViolation() == "" {
+				t.Errorf("decision record status %d, violation %q", record.GetResponseStatus(), record.GetRouting().GetPolicyViolation())
+			}
+		})
+	}
+}
+
+func TestNewBlockResponsesRejectsInvalidTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template config.ResponseTemplate
+	}{
+		{name: "unknown variable", template: config.ResponseTemplate{Message: "{{.Topic}} is blocked"}},
+		{name: "unparsable message", template: config.ResponseTemplate{Message: "{{.Category"}},
+		{name: "body not JSON", template: config.ResponseTemplate{Body: `{"blocked": {{.Category}}}`}},
+		{name: "unknown variable in header", template: config.ResponseTemplate{Headers: map[string]string{"x-reason": "{{.Reason}}"}}},
+		{name: "invalid status", template: config.ResponseTemplate{Status: 99}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			categories := []config.Category{{Name: "law", BlockResponse: &tt.template}}
+			if _, err := newBlockResponses(categories); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package extproc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// defaultBoilerplatePrefixes match generic assistant personas that open many
+// system prompts, used when no prefix patterns are configured
+var defaultBoilerplatePrefixes = []string{
+	`you are (a|an) (very )?(helpful|friendly|harmless|honest|useful|knowledgeable|smart|expert)\b[^.!?\n]*[.!?]?`,
+	`you are chatgpt\b[^.!?\n]*[.!?]?`,
+	`(please )?(always )?(answer|respond) (as )?(helpfully|concisely|accurately)[^.!?\n]*[.!?]?`,
+}
+
+// sentenceBoundary splits text into sentences for common sentence suppression
+var sentenceBoundary = regexp.MustCompile(`[^.!?\n]+[.!?]*`)
+
+// boilerplateFilter strips boilerplate shared by many system prompts before
+// classification, so the distinguishing content decides the category
+type boilerplateFilter struct {
+	prefixes []*regexp.Regexp
+	phrases  []*regexp.Regexp
+	// Sentences seen in at least this many system prompts are suppressed, 0 to disable
+	commonMinCount int
+	commonMax      int
+
+	mu        sync.Mutex
+	sentences map[string]int
+}
+
+// newBoilerplateFilter compiles the configured patterns, returning nil when filtering is disabled
+func newBoilerplateFilter(cfg config.BoilerplateFilterConfig) (*boilerplateFilter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	patterns := cfg.PrefixPatterns
+	if len(patterns) == 0 {
+		patterns = defaultBoilerplatePrefixes
+	}
+	f := &boilerplateFilter{
+		commonMinCount: cfg.CommonSentenceMinCount,
+		commonMax:      cfg.CommonSentenceMaxTracked,
+		sentences:      make(map[string]int),
+	}
+	if f.commonMax <= 0 {
+		f.commonMax = 10000
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(`(?i)^\s*(?:` + pattern + `)\s*`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix pattern %q: %w", pattern, err)
+		}
+		f.prefixes = append(f.prefixes, re)
+	}
+	for _, phrase := range cfg.Phrases {
+		f.phrases = append(f.phrases, regexp.MustCompile(`(?i)`+regexp.QuoteMeta(phrase)))
+	}
+	return f, nil
+}
+
+// classificationRequest returns a copy of the request with boilerplate stripped
+// from its system messages. The request sent upstream is left untouched.
+func (f *boilerplateFilter) classificationRequest(req *OpenAIRequest) *OpenAIRequest {
+	if f == nil {
+		return req
+	}
+	filtered := &OpenAIRequest{Model: req.Model, Messages: make([]ChatMessage, len(req.Messages))}
+	for i, msg := range req.Messages {
+		if msg.Role == "system" || msg.Role == "developer" {
+			msg.Content = f.strip(msg.Content)
+		}
+		filtered.Messages[i] = msg
+	}
+	return filtered
+}
+
+// strip removes boilerplate prefixes, configured phrases and common sentences from text
+func (f *boilerplateFilter) strip(text string) string {
+	for stripped := true; stripped; {
+		stripped = false
+		for _, prefix := range f.prefixes {
+			if loc := prefix.FindStringIndex(text); loc != nil && loc[1] > 0 {
+				text = text[loc[1]:]
+				stripped = true
+			}
+		}
+	}
+	for _, phrase := range f.phrases {
+		text = phrase.ReplaceAllString(text, "")
+	}
+	if f.commonMinCount > 0 {
+		text = f.suppressCommonSentences(text)
+	}
+	return strings.TrimSpace(text)
+}
+
+// suppressCommonSentences counts the sentences of a system prompt and drops
+// those already seen in enough other system prompts
+func (f *boilerplateFilter) suppressCommonSentences(text string) string {
+	sentences := sentenceBoundary.FindAllString(text, -1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seen := make(map[string]bool)
+	kept := make([]string, 0, len(sentences))
+	for _, sentence := range sentences {
+		key := strings.Join(strings.Fields(strings.ToLower(sentence)), " ")
+		if key == "" {
+			continue
+		}
+		if !seen[key] {
+			seen[key] = true
+			f.sentences[key]++
+		}
+		if f.sentences[key] < f.commonMinCount {
+			kept = append(kept, strings.TrimSpace(sentence))
+		}
+	}
+	if len(f.sentences) > f.commonMax {
+		f.decay()
+	}
+	return strings.Join(kept, " ")
+}
+
+// decay halves every sentence count and forgets rare sentences, bounding memory
+// while keeping sentences that stay common
+func (f *boilerplateFilter) decay() {
+	for key, count := range f.sentences {
+		if count /= 2; count == 0 {
+			delete(f.sentences, key)
+		} else {
+			f.sentences[key] = count
+		}
+	}
+}
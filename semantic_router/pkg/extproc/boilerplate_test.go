@@ -0,0 +1,108 @@
+package extproc
+
+import (
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestBoilerplateStrip(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.BoilerplateFilterConfig
+		text string
+		want string
+	}{
+		{
+			name: "default persona prefixes",
+			cfg:  config.BoilerplateFilterConfig{Enabled: true},
+			text: "You are a helpful assistant. Answer concisely and accurately. You review tax filings for small businesses.",
+			want: "You review tax filings for small businesses.",
+		},
+		{
+			name: "persona only",
+			cfg:  config.BoilerplateFilterConfig{Enabled: true},
+			text: "You are ChatGPT, a large language model trained by OpenAI.",
+			want: "",
+		},
+		{
+			name: "configured prefix replaces defaults",
+			cfg:  config.BoilerplateFilterConfig{Enabled: true, PrefixPatterns: []string{`acme bot here[.!]?`}},
+			text: "ACME bot here! You are a helpful assistant.",
+			want: "You are a helpful assistant.",
+		},
+		{
+			name: "phrases anywhere",
+			cfg:  config.BoilerplateFilterConfig{Enabled: true, Phrases: []string{"Think step by step."}},
+			text: "Solve organic chemistry problems. think step by step. Show reaction mechanisms.",
+			want: "Solve organic chemistry problems.  Show reaction mechanisms.",
+		},
+		{
+			name: "prefix only at the start",
+			cfg:  config.BoilerplateFilterConfig{Enabled: true},
+			text: "Grade essays. You are a helpful assistant.",
+			want: "Grade essays. You are a helpful assistant.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newBoilerplateFilter(tt.cfg)
+			if err != nil {
+				t.Fatalf("newBoilerplateFilter: %v", err)
+			}
+			if got := f.strip(tt.text); got != tt.want {
+				t.Errorf("strip() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoilerplateCommonSentences(t *testing.T) {
+	f, _ := newBoilerplateFilter(config.BoilerplateFilterConfig{
+		Enabled:                true,
+		PrefixPatterns:         []string{`$^`},
+		CommonSentenceMinCount: 3,
+	})
+	prompts := []string{
+		"Follow the company style guide. Review contracts for liability clauses.",
+		"Follow the  company style guide. Diagnose symptoms of common illnesses.",
+		"FOLLOW THE COMPANY STYLE GUIDE. Explain protein folding.",
+	}
+	for _, prompt := range prompts[:2] {
+		if got := f.strip(prompt); got != prompt {
+			t.Errorf("strip(%q) = %q, expected nothing suppressed yet", prompt, got)
+		}
+	}
+	if got := f.strip(prompts[2]); got != "Explain protein folding." {
+		t.Errorf("strip() = %q, want the shared sentence suppressed", got)
+	}
+}
+
+func TestBoilerplateLeavesRequestUntouched(t *testing.T) {
+	f, _ := newBoilerplateFilter(config.BoilerplateFilterConfig{Enabled: true})
+	req := &OpenAIRequest{Model: "auto", Messages: []ChatMessage{
+		{Role: "system", Content: "You are a helpful assistant. You are a tax advisor."},
+		{Role: "user", Content: "You are a helpful assistant, right?"},
+	}}
+	filtered := f.classificationRequest(req)
+	if filtered.Messages[0].Content != "You are a tax advisor." {
+		t.Errorf("system message = %q", filtered.Messages[0].Content)
+	}
+	if filtered.Messages[1].Content != req.Messages[1].Content {
+		t.Error("user messages must not be filtered")
+	}
+	if req.Messages[0].Content != "You are a helpful assistant. You are a tax advisor." {
+		t.Error("the request sent upstream must not be modified")
+	}
+
+	var disabled *boilerplateFilter
+	if disabled.classificationRequest(req) != req {
+		t.Error("a disabled filter must return the request as is")
+	}
+}
+
+func TestNewBoilerplateFilterRejectsInvalidPattern(t *testing.T) {
+	if _, err := newBoilerplateFilter(config.BoilerplateFilterConfig{Enabled: true, PrefixPatterns: []string{"("}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
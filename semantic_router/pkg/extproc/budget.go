@@ -0,0 +1,75 @@
+package extproc
+
+import (
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// Classification text budget strategies
+const (
+	BudgetStrategyFull              = "full"
+	BudgetStrategyHeadTail          = "head_tail"
+	BudgetStrategySystemAndLastUser = "system_and_last_user"
+)
+
+// applyClassificationBudget reduces text over the configured word budget to a
+// sample according to the configured strategy. It returns the text to classify
+// and the strategy that was actually applied.
+func applyClassificationBudget(cfg config.ClassificationBudgetConfig, req *OpenAIRequest, text string) (string, string) {
+	words := strings.Fields(text)
+	if cfg.MaxWords <= 0 || len(words) <= cfg.MaxWords {
+		return text, BudgetStrategyFull
+	}
+
+	switch cfg.Strategy {
+	case BudgetStrategyHeadTail:
+		return headTail(words, cfg.MaxWords, cfg.HeadWords, cfg.TailWords), BudgetStrategyHeadTail
+	case BudgetStrategySystemAndLastUser:
+		var system, lastUser string
+		for _, msg := range req.Messages {
+			if msg.Role == "system" && system == "" {
+				system = msg.Content
+			} else if msg.Role == "user" {
+				lastUser = msg.Content
+			}
+		}
+		sample := strings.TrimSpace(system + "\n" + lastUser)
+		if sample == "" {
+			return text, BudgetStrategyFull
+		}
+		// The sample itself may still be over budget, keep its head and tail
+		if sampleWords := strings.Fields(sample); len(sampleWords) > cfg.MaxWords {
+			return headTail(sampleWords, cfg.MaxWords, cfg.HeadWords, cfg.TailWords), BudgetStrategySystemAndLastUser + "+" + BudgetStrategyHeadTail
+		}
+		return sample, BudgetStrategySystemAndLastUser
+	default:
+		return text, BudgetStrategyFull
+	}
+}
+
+// headTail keeps the first head and last tail words. An unset count gets what
+// the other leaves of the limit, and with neither set the limit is split evenly.
+// Counts adding up to more than the limit are scaled down to fit it.
+func headTail(words []string, limit, head, tail int) string {
+	switch {
+	case head <= 0 && tail <= 0:
+		head = limit / 2
+		tail = limit - head
+	case head <= 0:
+		head = max(limit-tail, 0)
+	case tail <= 0:
+		tail = max(limit-head, 0)
+	}
+	if limit > 0 && head+tail > limit {
+		head = head * limit / (head + tail)
+		tail = limit - head
+	}
+	if head+tail >= len(words) {
+		return strings.Join(words, " ")
+	}
+	sample := make([]string, 0, head+tail)
+	sample = append(sample, words[:head]...)
+	sample = append(sample, words[len(words)-tail:]...)
+	return strings.Join(sample, " ")
+}
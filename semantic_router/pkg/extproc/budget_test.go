@@ -0,0 +1,62 @@
+package extproc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestApplyClassificationBudget(t *testing.T) {
+	long := strings.Repeat("filler ", 100) + "question"
+	req := &OpenAIRequest{Messages: []ChatMessage{
+		{Role: "system", Content: "You are a tutor"},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: "answer"},
+		{Role: "user", Content: "what about integrals"},
+	}}
+
+	cfg := config.ClassificationBudgetConfig{Strategy: BudgetStrategyHeadTail, MaxWords: 10, HeadWords: 2, TailWords: 1}
+	text, strategy := applyClassificationBudget(cfg, req, long)
+	if strategy != BudgetStrategyHeadTail || text != "filler filler question" {
+		t.Errorf("unexpected head_tail result: %q (%s)", text, strategy)
+	}
+
+	cfg.Strategy = BudgetStrategySystemAndLastUser
+	text, strategy = applyClassificationBudget(cfg, req, long)
+	if strategy != BudgetStrategySystemAndLastUser || text != "You are a tutor\nwhat about integrals" {
+		t.Errorf("unexpected system_and_last_user result: %q (%s)", text, strategy)
+	}
+
+	text, strategy = applyClassificationBudget(cfg, req, "short text")
+	if strategy != BudgetStrategyFull || text != "short text" {
+		t.Errorf("expected text under budget to be used in full, got %q (%s)", text, strategy)
+	}
+}
+
+func TestHeadTailStaysWithinLimit(t *testing.T) {
+	words := strings.Fields("a b c d e f g h")
+	for _, tc := range []struct {
+		name              string
+		limit, head, tail int
+		want              string
+	}{
+		{"even split", 4, 0, 0, "a b g h"},
+		{"odd split", 3, 0, 0, "a g h"},
+		{"head from limit", 4, 0, 1, "a b c h"},
+		{"tail from limit", 4, 3, 0, "a b c h"},
+		{"tail over limit", 2, 0, 3, "g h"},
+		{"head over limit", 2, 3, 0, "a b"},
+		{"both set", 4, 1, 1, "a h"},
+		{"both over limit", 4, 3, 3, "a b g h"},
+		{"sum over limit", 4, 3, 1, "a b c h"},
+		{"uneven sum over limit", 5, 6, 2, "a b c g h"},
+		{"over the words", 20, 10, 10, "a b c d e f g h"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := headTail(words, tc.limit, tc.head, tc.tail); got != tc.want {
+				t.Errorf("headTail(%d, %d, %d) = %q, want %q", tc.limit, tc.head, tc.tail, got, tc.want)
+			}
+		})
+	}
+}
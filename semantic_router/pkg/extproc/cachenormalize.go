@@ -0,0 +1,24 @@
+package extproc
+
+import (
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// newCacheNormalizer creates the normalizer of the queries embedded for the
+// cache
+func newCacheNormalizer(cfg config.CacheNormalizationConfig) (*cache.Normalizer, error) {
+	masks := make([]cache.MaskOptions, 0, len(cfg.Masks))
+	for _, mask := range cfg.Masks {
+		masks = append(masks, cache.MaskOptions{Name: mask.Name, Regex: mask.Regex})
+	}
+	return cache.NewNormalizer(cache.NormalizationOptions{
+		Lowercase:          cfg.Lowercase,
+		ExpandContractions: cfg.ExpandContractions,
+		CollapseWhitespace: cfg.CollapseWhitespace,
+		StripPunctuation:   cfg.StripPunctuation,
+		RemoveStopwords:    cfg.RemoveStopwords,
+		Stopwords:          cfg.Stopwords,
+		Masks:              masks,
+	})
+}
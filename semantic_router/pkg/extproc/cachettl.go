@@ -0,0 +1,65 @@
+package extproc
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// cacheTTLHeader lets upstreams set how many seconds the router caches their
+// response, 0 to not cache it
+const cacheTTLHeader = "x-semantic-cache-ttl"
+
+// upstreamCacheTTL returns how long the upstream allows its response to be
+// cached, as set by x-semantic-cache-ttl or else Cache-Control. A zero TTL
+// means the response must not be cached; set is false when the upstream says
+// nothing, leaving the cache's own TTL. TTLs are capped at maxTTL if positive.
+func upstreamCacheTTL(headers *core.HeaderMap, maxTTL time.Duration) (ttl time.Duration, set bool) {
+	if value := getHeaderValue(headers, cacheTTLHeader); value != "" {
+		seconds, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || seconds < 0 {
+			slog.Warn("Ignoring invalid header", "header", cacheTTLHeader, "value", value)
+		} else {
+			return capTTL(time.Duration(seconds)*time.Second, maxTTL), true
+		}
+	}
+
+	cacheControl := getHeaderValue(headers, "cache-control")
+	if cacheControl == "" {
+		return 0, false
+	}
+	// The router is a shared cache, so s-maxage takes precedence over max-age
+	maxAge, sharedMaxAge := -1, -1
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0, true
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		case "s-maxage":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				sharedMaxAge = seconds
+			}
+		}
+	}
+	if sharedMaxAge >= 0 {
+		maxAge = sharedMaxAge
+	}
+	if maxAge < 0 {
+		return 0, false
+	}
+	return capTTL(time.Duration(maxAge)*time.Second, maxTTL), true
+}
+
+func capTTL(ttl, maxTTL time.Duration) time.Duration {
+	if maxTTL > 0 && ttl > maxTTL {
+		return maxTTL
+	}
+	return ttl
+}
@@ -0,0 +1,83 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+func TestUpstreamCacheTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		maxTTL  time.Duration
+		wantTTL time.Duration
+		wantSet bool
+	}{
+		{"no directive", nil, 0, 0, false},
+		{"ttl header", map[string]string{"x-semantic-cache-ttl": "3600"}, 0, time.Hour, true},
+		{"ttl header disables caching", map[string]string{"x-semantic-cache-ttl": "0"}, 0, 0, true},
+		{"ttl header wins over cache-control", map[string]string{"x-semantic-cache-ttl": "60", "cache-control": "no-store"}, 0, time.Minute, true},
+		{"invalid ttl header falls back", map[string]string{"x-semantic-cache-ttl": "soon", "cache-control": "max-age=30"}, 0, 30 * time.Second, true},
+		{"max-age", map[string]string{"cache-control": "public, max-age=120"}, 0, 2 * time.Minute, true},
+		{"s-maxage wins", map[string]string{"cache-control": "max-age=120, s-maxage=60"}, 0, time.Minute, true},
+		{"no-store", map[string]string{"cache-control": "no-store"}, 0, 0, true},
+		{"private", map[string]string{"cache-control": "private, max-age=60"}, 0, 0, true},
+		{"no lifetime", map[string]string{"cache-control": "public"}, 0, 0, false},
+		{"capped", map[string]string{"x-semantic-cache-ttl": "86400"}, time.Hour, time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := &core.HeaderMap{}
+			for key, value := range tt.headers {
+				headers.Headers = append(headers.Headers, &core.HeaderValue{Key: key, RawValue: []byte(value)})
+			}
+			ttl, set := upstreamCacheTTL(headers, tt.maxTTL)
+			if ttl != tt.wantTTL || set != tt.wantSet {
+				t.Errorf("upstreamCacheTTL = %s, %v, want %s, %v", ttl, set, tt.wantTTL, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestProcessHonorsUpstreamTTL(t *testing.T) {
+	const request = `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`
+	for _, ttl := range []string{"0", "3600"} {
+		router := newTestRouter(t, true)
+		router.Config.SemanticCache.HonorUpstreamTTL = true
+
+		headers := responseHeaders("200")
+		headerMap := headers.GetResponseHeaders().GetHeaders()
+		headerMap.Headers = append(headerMap.Headers, &core.HeaderValue{Key: cacheTTLHeader, RawValue: []byte(ttl)})
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-1"),
+			requestBody(request),
+			headers,
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		removed := stream.responses[2].GetResponseHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders()
+		if len(removed) != 1 || removed[0] != cacheTTLHeader {
+			t.Errorf("expected %s to be removed from the client response, got %v", cacheTTLHeader, removed)
+		}
+		if pending := router.Cache.PendingCount(); pending != 0 {
+			t.Errorf("expected no pending cache entry, got %d", pending)
+		}
+
+		stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-2"),
+			requestBody(request),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		if hit := stream.responses[1].GetImmediateResponse() != nil; hit != (ttl != "0") {
+			t.Errorf("with %s: %s, cache hit = %v", cacheTTLHeader, ttl, hit)
+		}
+	}
+}
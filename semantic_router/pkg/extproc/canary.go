@@ -0,0 +1,102 @@
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/canary"
+)
+
+// canaryRequests numbers canary requests so each gets its own request ID
+var canaryRequests atomic.Uint64
+
+// canaryKey marks the context of canary probe streams
+type canaryKey struct{}
+
+// isCanary returns whether a stream context belongs to a canary probe. Probes
+// are marked through the context rather than the canary header, which any
+// client can send.
+func isCanary(ctx context.Context) bool {
+	probe, _ := ctx.Value(canaryKey{}).(bool)
+	return probe
+}
+
+// routeCanary sends a request body through the full request pipeline in process
+// and returns the model it was routed to. Probes count toward no metrics,
+// decision records, autoscaling demand or budgets.
+func (r *OpenAIRouter) routeCanary(ctx context.Context, body []byte) (string, error) {
+	requestID := fmt.Sprintf("canary-%d", canaryRequests.Add(1))
+	stream := &canaryStream{
+		ctx: context.WithValue(ctx, canaryKey{}, true),
+		requests: []*ext_proc.ProcessingRequest{
+			{
+				Request: &ext_proc.ProcessingRequest_RequestHeaders{
+					RequestHeaders: &ext_proc.HttpHeaders{
+						Headers: &core.HeaderMap{
+							Headers: []*core.HeaderValue{
+								{Key: "x-request-id", RawValue: []byte(requestID)},
+								{Key: canary.Header, RawValue: []byte("true")},
+							},
+						},
+					},
+				},
+			},
+			{
+				Request: &ext_proc.ProcessingRequest_RequestBody{
+					RequestBody: &ext_proc.HttpBody{Body: body, EndOfStream: true},
+				},
+			},
+		},
+	}
+	if err := r.Process(stream); err != nil && err != io.EOF {
+		return "", err
+	}
+	if len(stream.responses) < 2 {
+		return "", fmt.Errorf("pipeline sent %d responses, expected 2", len(stream.responses))
+	}
+
+	response := stream.responses[1]
+	if immediate := response.GetImmediateResponse(); immediate != nil {
+		return "", fmt.Errorf("pipeline answered with status %d", immediate.GetStatus().GetCode())
+	}
+	if mutated := response.GetRequestBody().GetResponse().GetBodyMutation().GetBody(); mutated != nil {
+		body = mutated
+	}
+	req, err := parseOpenAIRequest(body)
+	if err != nil {
+		return "", fmt.Errorf("pipeline produced an invalid request: %w", err)
+	}
+	return req.Model, nil
+}
+
+// canaryStream feeds canary requests to Process and collects its responses
+type canaryStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	requests  []*ext_proc.ProcessingRequest
+	responses []*ext_proc.ProcessingResponse
+}
+
+func (s *canaryStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *canaryStream) Send(resp *ext_proc.ProcessingResponse) error {
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+func (s *canaryStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,117 @@
+package extproc
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestRouteCanary(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantModel string
+		wantErr   bool
+	}{
+		{
+			name:      "auto request is routed",
+			body:      `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantModel: "math-model",
+		},
+		{
+			name:      "explicit model passes through",
+			body:      `{"model":"phi4","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantModel: "phi4",
+		},
+		{
+			name:    "invalid request",
+			body:    `{"model":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			model, err := router.routeCanary(context.Background(), []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("routeCanary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if model != tt.wantModel {
+				t.Errorf("routeCanary() = %q, want %q", model, tt.wantModel)
+			}
+			// Canary requests must neither read nor populate the semantic cache
+			if pending := router.Cache.PendingCount(); pending != 0 {
+				t.Errorf("canary left %d pending cache entries", pending)
+			}
+		})
+	}
+}
+
+func TestRouteCanaryLeavesAccountingUnchanged(t *testing.T) {
+	router := newTestRouter(t, false)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	var err error
+	router.applications, err = newApplicationMatcher([]config.ApplicationConfig{{
+		Name:               "tutor",
+		SystemPromptPrefix: "You are a law tutor",
+		RequestsPerMinute:  1,
+	}})
+	if err != nil {
+		t.Fatalf("newApplicationMatcher: %v", err)
+	}
+
+	counters := func() []float64 {
+		routingLatency, _ := histogramState(t, metrics.ModelRoutingLatency)
+		scores, _ := histogramState(t, metrics.RoutingScore.WithLabelValues(config.RoutingStrategyClassifier, "math"))
+		return []float64{
+			testutil.ToFloat64(metrics.ModelRequests.WithLabelValues("auto")),
+			testutil.ToFloat64(metrics.ModelRoutingModifications.WithLabelValues("auto", "math-model")),
+			testutil.ToFloat64(metrics.RoutingDecisions.WithLabelValues("auto", "math-model", "math")),
+			testutil.ToFloat64(metrics.ApplicationRequests.WithLabelValues("tutor", applicationAdmitted)),
+			float64(routingLatency),
+			float64(scores),
+		}
+	}
+	before := counters()
+
+	// Probes are routed as usual, the second and third one within the
+	// application's quota of one request a minute
+	probes := []string{
+		`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+		`{"model":"auto","messages":[{"role":"system","content":"You are a law tutor."},{"role":"user","content":"What is the derivative of x^2?"}]}`,
+		`{"model":"auto","messages":[{"role":"system","content":"You are a law tutor."},{"role":"user","content":"What is the derivative of x^2?"}]}`,
+	}
+	for i, probe := range probes {
+		if model, err := router.routeCanary(context.Background(), []byte(probe)); err != nil || model != "math-model" {
+			t.Fatalf("probe %d routed to %q, %v; want math-model", i, model, err)
+		}
+	}
+
+	if after := counters(); !slices.Equal(after, before) {
+		t.Errorf("metrics changed from %v to %v", before, after)
+	}
+	if len(sink.records) != 0 {
+		t.Errorf("probes wrote %d decision records", len(sink.records))
+	}
+
+	// The application's quota is left for real requests
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(probes[1]),
+	}}
+	if err := router.Process(stream); err != nil && err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	if immediate := stream.responses[1].GetImmediateResponse(); immediate != nil {
+		t.Errorf("request after the probes rejected with %d", immediate.GetStatus().GetCode())
+	}
+}
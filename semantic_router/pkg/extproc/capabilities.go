@@ -0,0 +1,145 @@
+package extproc
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/fingerprint"
+)
+
+// processorProtocolVersion is the version of the router's contract with the
+// ext_proc filter: the phases it expects, and the headers and metadata it
+// sets. It is raised on changes Envoy configs must be adapted to.
+const processorProtocolVersion = 1
+
+// Capabilities the router advertises
+const (
+	capabilityModelRouting      = "model_routing"
+	capabilityDecisionMetadata  = "decision_metadata"
+	capabilityStreaming         = "streaming"
+	capabilityMultimodal        = "multimodal"
+	capabilityToolCalls         = "tool_calls"
+	capabilitySemanticCache     = "semantic_cache"
+	capabilityPII               = "pii"
+	capabilityPromptGuard       = "prompt_guard"
+	capabilityEndpointSelection = "endpoint_selection"
+	capabilityComplianceArchive = "compliance_archive"
+)
+
+// gRPC response headers advertising the processor
+const (
+	processorVersionHeader         = "x-semantic-router-version"
+	processorProtocolVersionHeader = "x-semantic-router-protocol-version"
+	processorCapabilitiesHeader    = "x-semantic-router-capabilities"
+)
+
+// requiredCapabilitiesKey is the key of the semantic_router metadata Envoy
+// forwards listing the capabilities a route requires
+const requiredCapabilitiesKey = "required_capabilities"
+
+// capabilities returns what the router can do with the current config, sorted
+func (r *OpenAIRouter) capabilities() []string {
+	capabilities := []string{
+		capabilityModelRouting,
+		capabilityDecisionMetadata,
+		capabilityStreaming,
+		capabilityMultimodal,
+		capabilityToolCalls,
+	}
+	if r.Cache != nil && r.Cache.IsEnabled() {
+		capabilities = append(capabilities, capabilitySemanticCache)
+	}
+	if r.PII != nil {
+		capabilities = append(capabilities, capabilityPII)
+	}
+	if r.promptGuard != nil {
+		capabilities = append(capabilities, capabilityPromptGuard)
+	}
+	if r.Endpoints != nil {
+		capabilities = append(capabilities, capabilityEndpointSelection)
+	}
+	if r.Archive != nil {
+		capabilities = append(capabilities, capabilityComplianceArchive)
+	}
+	slices.Sort(capabilities)
+	return capabilities
+}
+
+// advertiseProcessor sends the router's version and capabilities as the
+// gRPC response headers of a stream. It does nothing unless processor
+// metadata is enabled.
+func (r *OpenAIRouter) advertiseProcessor(ctx context.Context) {
+	if !r.Config.ProcessorMetadata.Enabled {
+		return
+	}
+	header := metadata.Pairs(
+		processorVersionHeader, fingerprint.BuildVersion(),
+		processorProtocolVersionHeader, strconv.Itoa(processorProtocolVersion),
+		processorCapabilitiesHeader, strings.Join(r.capabilities(), ","),
+	)
+	// Without a gRPC transport, as in tests, there is no one to tell
+	_ = grpc.SetHeader(ctx, header)
+}
+
+// processorMetadata returns the dynamic metadata advertising the router to
+// Envoy, nil unless processor metadata is enabled
+func (r *OpenAIRouter) processorMetadata() *structpb.Struct {
+	if !r.Config.ProcessorMetadata.Enabled {
+		return nil
+	}
+	capabilities := make([]interface{}, 0)
+	for _, capability := range r.capabilities() {
+		capabilities = append(capabilities, capability)
+	}
+	return buildDecisionMetadata(map[string]interface{}{
+		"processor_version":          fingerprint.BuildVersion(),
+		"processor_protocol_version": processorProtocolVersion,
+		"processor_capabilities":     capabilities,
+	})
+}
+
+// checkRequiredCapabilities refuses a stream whose route requires
+// capabilities the router lacks, listed in the semantic_router metadata Envoy
+// forwards as a list or a comma separated string. With failure_mode_allow,
+// Envoy then passes the request through unprocessed.
+func (r *OpenAIRouter) checkRequiredCapabilities(req *ext_proc.ProcessingRequest) error {
+	if !r.Config.ProcessorMetadata.Enabled {
+		return nil
+	}
+	namespace := req.GetMetadataContext().GetFilterMetadata()[decisionMetadataNamespace]
+	value, ok := namespace.GetFields()[requiredCapabilitiesKey]
+	if !ok {
+		return nil
+	}
+	var required []string
+	switch v := value.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		required = strings.Split(v.StringValue, ",")
+	case *structpb.Value_ListValue:
+		for _, item := range v.ListValue.GetValues() {
+			required = append(required, item.GetStringValue())
+		}
+	default:
+		return status.Errorf(codes.InvalidArgument, "%s must be a list or a comma separated string", requiredCapabilitiesKey)
+	}
+	capabilities := r.capabilities()
+	var missing []string
+	for _, capability := range required {
+		if capability = strings.TrimSpace(capability); capability != "" && !slices.Contains(capabilities, capability) {
+			missing = append(missing, capability)
+		}
+	}
+	if len(missing) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "router lacks the required capabilities %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
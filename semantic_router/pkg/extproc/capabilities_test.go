@@ -0,0 +1,94 @@
+package extproc
+
+import (
+	"io"
+	"slices"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// requireCapabilities sets the capabilities a route requires in the metadata
+// Envoy forwards with a stream's request headers
+func requireCapabilities(t *testing.T, req *ext_proc.ProcessingRequest, required interface{}) *ext_proc.ProcessingRequest {
+	t.Helper()
+	namespace, err := structpb.NewStruct(map[string]interface{}{requiredCapabilitiesKey: required})
+	if err != nil {
+		t.Fatalf("NewStruct: %v", err)
+	}
+	req.MetadataContext = &core.Metadata{FilterMetadata: map[string]*structpb.Struct{decisionMetadataNamespace: namespace}}
+	return req
+}
+
+func TestCapabilities(t *testing.T) {
+	router := newTestRouter(t, true)
+	capabilities := router.capabilities()
+	if !slices.Contains(capabilities, capabilitySemanticCache) || slices.Contains(capabilities, capabilityPII) {
+		t.Errorf("capabilities = %v, want semantic_cache without pii", capabilities)
+	}
+	if !slices.IsSorted(capabilities) {
+		t.Errorf("capabilities %v are not sorted", capabilities)
+	}
+	if slices.Contains(newTestRouter(t, false).capabilities(), capabilitySemanticCache) {
+		t.Error("semantic_cache advertised with the cache disabled")
+	}
+}
+
+func TestProcessAdvertisesProcessor(t *testing.T) {
+	router := newTestRouter(t, false)
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{requestHeaders("x-request-id", "req-1")}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	if metadata := stream.responses[0].GetDynamicMetadata(); metadata != nil {
+		t.Errorf("metadata sent while disabled: %v", metadata)
+	}
+
+	router.Config.ProcessorMetadata.Enabled = true
+	stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requireCapabilities(t, requestHeaders("x-request-id", "req-2"), []interface{}{capabilityModelRouting, capabilityMultimodal}),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	fields := stream.responses[0].GetDynamicMetadata().GetFields()[decisionMetadataNamespace].GetStructValue().GetFields()
+	if got := fields["processor_protocol_version"].GetNumberValue(); got != processorProtocolVersion {
+		t.Errorf("processor_protocol_version = %v, want %d", got, processorProtocolVersion)
+	}
+	var advertised []string
+	for _, value := range fields["processor_capabilities"].GetListValue().GetValues() {
+		advertised = append(advertised, value.GetStringValue())
+	}
+	if !slices.Equal(advertised, router.capabilities()) {
+		t.Errorf("processor_capabilities = %v, want %v", advertised, router.capabilities())
+	}
+	if _, ok := fields["processor_version"]; !ok {
+		t.Error("processor_version missing")
+	}
+}
+
+func TestProcessRefusesMissingCapabilities(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.ProcessorMetadata.Enabled = true
+	for name, tt := range map[string]struct {
+		required interface{}
+		code     codes.Code
+	}{
+		"list":       {required: []interface{}{capabilityModelRouting, capabilityPII}, code: codes.FailedPrecondition},
+		"string":     {required: "model_routing, semantic_cache", code: codes.FailedPrecondition},
+		"not a list": {required: 1.0, code: codes.InvalidArgument},
+	} {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{requireCapabilities(t, requestHeaders("x-request-id", "req-1"), tt.required)}}
+		err := router.Process(stream)
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: Process returned %v, want %v", name, err, tt.code)
+		}
+		if len(stream.responses) != 0 {
+			t.Errorf("%s: refused stream got responses", name)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package extproc
+
+import (
+	"testing"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/chunking"
+)
+
+func TestPoolClassResults(t *testing.T) {
+	// Class 1 wins one chunk confidently, class 0 two chunks less so
+	split := []candle_binding.ClassResult{
+		{Class: 0, Confidence: 0.6, RunnerUpClass: 1, RunnerUpConfidence: 0.3},
+		{Class: 1, Confidence: 0.95, RunnerUpClass: 0, RunnerUpConfidence: 0.05},
+		{Class: 0, Confidence: 0.7, RunnerUpClass: 2, RunnerUpConfidence: 0.2},
+	}
+	// Every chunk agrees, the runner-up comes from the chunks' runners-up
+	agreed := []candle_binding.ClassResult{
+		{Class: 2, Confidence: 0.8, RunnerUpClass: 1, RunnerUpConfidence: 0.1},
+		{Class: 2, Confidence: 0.6, RunnerUpClass: 0, RunnerUpConfidence: 0.3},
+	}
+	none := candle_binding.ClassResult{Class: -1, RunnerUpClass: -1}
+
+	tests := []struct {
+		name    string
+		pooling string
+		results []candle_binding.ClassResult
+		want    candle_binding.ClassResult
+	}{
+		{"mean", chunking.PoolingMean, split, candle_binding.ClassResult{Class: 0, Confidence: 1.3 / 3, RunnerUpClass: 1, RunnerUpConfidence: 0.95 / 3}},
+		{"default is mean", "", split, candle_binding.ClassResult{Class: 0, Confidence: 1.3 / 3, RunnerUpClass: 1, RunnerUpConfidence: 0.95 / 3}},
+		{"max", chunking.PoolingMax, split, split[1]},
+		{"mean of agreeing chunks", chunking.PoolingMean, agreed, candle_binding.ClassResult{Class: 2, Confidence: 0.7, RunnerUpClass: 0, RunnerUpConfidence: 0.15}},
+		{"max of agreeing chunks", chunking.PoolingMax, agreed, agreed[0]},
+		{"mean without results", chunking.PoolingMean, nil, none},
+		{"max without results", chunking.PoolingMax, nil, none},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := poolClassResults(tt.results, tt.pooling)
+			if got.Class != tt.want.Class || got.RunnerUpClass != tt.want.RunnerUpClass ||
+				!approxEqual(got.Confidence, tt.want.Confidence) || !approxEqual(got.RunnerUpConfidence, tt.want.RunnerUpConfidence) {
+				t.Errorf("poolClassResults = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func approxEqual(a, b float32) bool {
+	return a-b < 1e-6 && b-a < 1e-6
+}
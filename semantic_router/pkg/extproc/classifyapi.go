@@ -0,0 +1,43 @@
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/admin"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/embeddings"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/langdetect"
+)
+
+// classifyForAPI returns how the router would route raw text or the messages
+// of an OpenAI request, for the admin API. Nothing is forwarded or recorded,
+// and routing scores and autoscaling signals are left alone.
+func (r *OpenAIRouter) classifyForAPI(_ context.Context, req admin.ClassifyRequest) (admin.Classification, error) {
+	var classification admin.Classification
+	text := req.Text
+	if len(req.Request) > 0 {
+		openAIRequest, err := parseOpenAIRequest(req.Request)
+		if err != nil {
+			return classification, fmt.Errorf("%w: %v", admin.ErrInvalidClassifyRequest, err)
+		}
+		classificationRequest := r.boilerplate.classificationRequest(openAIRequest)
+		userContent, nonUserMessages := extractMessageContents(classificationRequest)
+		text, classification.ClassificationStrategy = applyClassificationBudget(r.Config.ClassificationBudget,
+			classificationRequest, classificationInput(userContent, nonUserMessages))
+	}
+	if text == "" {
+		return classification, fmt.Errorf("%w: no text to classify", admin.ErrInvalidClassifyRequest)
+	}
+
+	match := r.findBestModelMatch(slog.Default(), text, langdetect.Detect(text), embeddings.NewSet(), nil, true)
+	classification.Category = match.Category
+	classification.Confidence = match.Confidence
+	classification.RunnerUp = match.RunnerUp
+	classification.RunnerUpConfidence = match.RunnerUpConfidence
+	classification.Model = match.Model
+	if match.RankedModel != match.Model {
+		classification.RankedModel = match.RankedModel
+	}
+	return classification, nil
+}
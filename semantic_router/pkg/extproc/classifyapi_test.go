@@ -0,0 +1,38 @@
+package extproc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/admin"
+)
+
+func TestClassifyForAPI(t *testing.T) {
+	router := newTestRouter(t, false)
+	for _, tc := range []struct {
+		name         string
+		req          admin.ClassifyRequest
+		wantCategory string
+		wantModel    string
+	}{
+		{"text", admin.ClassifyRequest{Text: "What is the derivative of x^2?"}, "math", "math-model"},
+		{"request", admin.ClassifyRequest{Request: []byte(`{"model":"auto","messages":[{"role":"user","content":"Is plagiarism a crime?"}]}`)}, "law", "law-model"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			classification, err := router.classifyForAPI(context.Background(), tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if classification.Category != tc.wantCategory || classification.Model != tc.wantModel || classification.Confidence == 0 {
+				t.Errorf("classifyForAPI = %+v, want %s and %s", classification, tc.wantCategory, tc.wantModel)
+			}
+		})
+	}
+
+	for _, body := range []string{`[1]`, `{"model":"auto","messages":[]}`} {
+		if _, err := router.classifyForAPI(context.Background(), admin.ClassifyRequest{Request: []byte(body)}); !errors.Is(err, admin.ErrInvalidClassifyRequest) {
+			t.Errorf("classifyForAPI(%s) error %v, want ErrInvalidClassifyRequest", body, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/archive"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/pii"
+)
+
+// newComplianceArchive creates the archiver of the conversations of tenants
+// under a compliance hold, nil when no sink is configured. Responses are
+// redacted with the PII detector, if any, before they are archived.
+func newComplianceArchive(cfg config.ComplianceArchiveConfig, detector *pii.Detector) (*archive.Archiver, error) {
+	var sink archive.Sink
+	switch {
+	case cfg.Webhook.URL != "" && cfg.S3.Bucket != "":
+		return nil, fmt.Errorf("set either webhook.url or s3.bucket, not both")
+	case cfg.Webhook.URL != "":
+		webhook := &archive.WebhookSink{URL: cfg.Webhook.URL}
+		if cfg.Webhook.AuthorizationEnv != "" {
+			webhook.Authorization = os.Getenv(cfg.Webhook.AuthorizationEnv)
+			if webhook.Authorization == "" {
+				return nil, fmt.Errorf("%s is not set", cfg.Webhook.AuthorizationEnv)
+			}
+		}
+		sink = webhook
+	case cfg.S3.Bucket != "":
+		if cfg.S3.Region == "" {
+			return nil, fmt.Errorf("s3.region is required")
+		}
+		s3 := &archive.S3Sink{
+			Endpoint:        cfg.S3.Endpoint,
+			Bucket:          cfg.S3.Bucket,
+			Region:          cfg.S3.Region,
+			AccessKeyID:     os.Getenv(envOr(cfg.S3.AccessKeyIDEnv, "AWS_ACCESS_KEY_ID")),
+			SecretAccessKey: os.Getenv(envOr(cfg.S3.SecretAccessKeyEnv, "AWS_SECRET_ACCESS_KEY")),
+			SessionToken:    os.Getenv(envOr(cfg.S3.SessionTokenEnv, "AWS_SESSION_TOKEN")),
+		}
+		if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			return nil, fmt.Errorf("S3 credentials are not set")
+		}
+		sink = s3
+	default:
+		return nil, nil
+	}
+
+	options := archive.Options{
+		Sink:      sink,
+		Prefix:    cfg.Prefix,
+		QueueSize: cfg.QueueSize,
+		Timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+	}
+	if detector != nil {
+		options.Redact = func(exchange *archive.Exchange) {
+			exchange.Response = redactResponsePII(detector, exchange.Response, exchange.Tenant)
+		}
+	}
+	return archive.New(options), nil
+}
+
+// envOr returns the environment variable name, or the default name if unset
+func envOr(name, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// redactResponsePII redacts PII from the message content of every choice of a
+// completion. Tokenized PII is redacted, as placeholders in an archive could
+// not be restored. Bodies that are not completions are returned unchanged.
+func redactResponsePII(detector *pii.Detector, body []byte, tenant string) []byte {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(response["choices"], &choices); err != nil {
+		return body
+	}
+	changed := false
+	for _, choice := range choices {
+		var message map[string]json.RawMessage
+		if err := json.Unmarshal(choice["message"], &message); err != nil {
+			continue
+		}
+		var content string
+		if err := json.Unmarshal(message["content"], &content); err != nil || content == "" {
+			continue
+		}
+		scan, err := detector.Scan(content, tenant, nil)
+		if err != nil || !scan.Redacted() {
+			continue
+		}
+		message["content"], _ = json.Marshal(scan.Text)
+		choice["message"], _ = json.Marshal(message)
+		changed = true
+	}
+	if !changed {
+		return body
+	}
+	response["choices"], _ = json.Marshal(choices)
+	redacted, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+// archiveExchange archives the request and response of a tenant under a
+// compliance hold. The request is archived as sent upstream, after PII
+// redaction.
+func (r *OpenAIRouter) archiveExchange(reqCtx *RequestContext, response []byte) {
+	if r.Archive == nil || reqCtx.record == nil {
+		return
+	}
+	tenant := reqCtx.record.Routing.Tenant
+	if !r.Residency.PolicyFor(tenant).HoldsConversations() || len(reqCtx.OriginalBody) == 0 {
+		return
+	}
+	r.Archive.Archive(&archive.Exchange{
+		RequestID:      reqCtx.ID,
+		Tenant:         tenant,
+		Timestamp:      reqCtx.StartTime,
+		Model:          reqCtx.Model,
+		ResponseStatus: reqCtx.responseStatus,
+		Request:        reqCtx.OriginalBody,
+		Response:       response,
+	})
+}
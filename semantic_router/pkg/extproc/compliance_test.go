@@ -0,0 +1,107 @@
+package extproc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+)
+
+func TestProcessArchivesHeldTenants(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.PII = config.PIIConfig{
+		Enabled:  true,
+		Patterns: []config.PIIPatternConfig{{Type: "EMAIL"}},
+	}
+	var err error
+	if router.PII, err = newPIIDetector(router.Config.PII, nil); err != nil {
+		t.Fatalf("newPIIDetector: %v", err)
+	}
+	router.Residency, err = policy.NewResidency(policy.ResidencyOptions{
+		Tenants: []config.TenantPolicy{{Name: "acme", ComplianceHold: true}, {Name: "other", MaxTokens: 1000}},
+	})
+	if err != nil {
+		t.Fatalf("NewResidency: %v", err)
+	}
+	var mu sync.Mutex
+	stored := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		stored[r.Header.Get("X-Archive-Key")] = body
+		mu.Unlock()
+	}))
+	defer server.Close()
+	router.Archive, err = newComplianceArchive(config.ComplianceArchiveConfig{Webhook: config.ArchiveWebhookConfig{URL: server.URL}}, router.PII)
+	if err != nil {
+		t.Fatalf("newComplianceArchive: %v", err)
+	}
+	router.Archive.Start()
+
+	const completion = `{"id":"c1","object":"chat.completion","model":"math-model","choices":[{"message":{"role":"assistant","content":"Ask bob@example.com"}}]}`
+	for _, tenant := range []string{"acme", "other"} {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-"+tenant, "x-tenant-id", tenant),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2? Mail jane@example.com"}]}`),
+			responseHeaders("200"),
+			responseBody(completion, true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+	}
+	router.Archive.Stop()
+
+	if len(stored) != 1 {
+		t.Fatalf("archived %d exchanges, want only the held tenant's", len(stored))
+	}
+	for key, body := range stored {
+		if !strings.HasPrefix(key, "acme/") || !strings.HasSuffix(key, "/req-acme.json") {
+			t.Errorf("archived under %s", key)
+		}
+		if strings.Contains(string(body), "@example.com") {
+			t.Errorf("archived exchange contains PII: %s", body)
+		}
+		exchange := gjson.ParseBytes(body)
+		if exchange.Get("tenant").String() != "acme" || exchange.Get("model").String() != "math-model" ||
+			exchange.Get("response_status").Int() != 200 {
+			t.Errorf("archived exchange %s", body)
+		}
+		if !strings.HasPrefix(exchange.Get("request.messages.0.content").String(), "What is the derivative") ||
+			!strings.HasPrefix(exchange.Get("response.choices.0.message.content").String(), "Ask ") {
+			t.Errorf("archived conversation %s", body)
+		}
+	}
+}
+
+func TestNewComplianceArchive(t *testing.T) {
+	if archiver, err := newComplianceArchive(config.ComplianceArchiveConfig{}, nil); archiver != nil || err != nil {
+		t.Errorf("archive without a sink: %v, %v", archiver, err)
+	}
+	t.Setenv("ARCHIVE_KEY_ID", "AKID")
+	t.Setenv("ARCHIVE_SECRET", "secret")
+	s3 := config.ArchiveS3Config{Bucket: "hold", Region: "eu-west-1", AccessKeyIDEnv: "ARCHIVE_KEY_ID", SecretAccessKeyEnv: "ARCHIVE_SECRET"}
+	if archiver, err := newComplianceArchive(config.ComplianceArchiveConfig{S3: s3}, nil); archiver == nil || err != nil {
+		t.Errorf("S3 archive: %v, %v", archiver, err)
+	}
+
+	tests := map[string]config.ComplianceArchiveConfig{
+		"both sinks":           {Webhook: config.ArchiveWebhookConfig{URL: "http://archive"}, S3: s3},
+		"unset authorization":  {Webhook: config.ArchiveWebhookConfig{URL: "http://archive", AuthorizationEnv: "ARCHIVE_UNSET"}},
+		"no region":            {S3: config.ArchiveS3Config{Bucket: "hold", AccessKeyIDEnv: "ARCHIVE_KEY_ID", SecretAccessKeyEnv: "ARCHIVE_SECRET"}},
+		"unset S3 credentials": {S3: config.ArchiveS3Config{Bucket: "hold", Region: "eu-west-1", AccessKeyIDEnv: "ARCHIVE_UNSET"}},
+	}
+	for name, cfg := range tests {
+		if _, err := newComplianceArchive(cfg, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
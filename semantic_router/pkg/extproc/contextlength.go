@@ -0,0 +1,173 @@
+package extproc
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+)
+
+// Token counters of context-length routing
+const (
+	// About charsPerToken characters per token, as the prompt token estimate
+	TokenCounterChars = "chars"
+	// Pieces split like tiktoken's pre-tokenizer, long words counting as several
+	TokenCounterPretokens = "pretokens"
+)
+
+// Outcomes of routing a request exceeding the context window of its model
+const (
+	contextRedirected = "redirected"
+	contextNoFit      = "no_fit"
+)
+
+const (
+	// pretokenRunes approximates the characters per token of long words
+	pretokenRunes = 8
+	// pretokenDigits is how many digits tiktoken's pre-tokenizer keeps together
+	pretokenDigits = 3
+)
+
+// newContextTokenCounter returns the counter of the tokens of requests checked
+// against the context windows of models, nil when context routing is disabled
+func newContextTokenCounter(cfg config.ContextRoutingConfig) (func(*OpenAIRequest) int, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	switch cfg.TokenCounter {
+	case "", TokenCounterChars:
+		return estimatePromptTokens, nil
+	case TokenCounterPretokens:
+		return countPretokens, nil
+	}
+	return nil, fmt.Errorf("invalid context_routing: unknown token_counter %q, must be %s or %s", cfg.TokenCounter, TokenCounterChars, TokenCounterPretokens)
+}
+
+// countPretokens approximates the tokens of the messages of a request as BPE
+// tokenizers count them: text is split into words with their leading space,
+// or punctuation with their leading space, groups of up to three digits and
+// runs of whitespace. Each piece is one token, except that words count one per
+// pretokenRunes characters and punctuation one per two characters.
+func countPretokens(req *OpenAIRequest) int {
+	tokens := 0
+	for _, msg := range req.Messages {
+		tokens += pretokens(msg.Role) + pretokens(msg.Content) + messageOverheadTokens
+	}
+	return tokens
+}
+
+// pretokens counts the tokens of a text, see countPretokens
+func pretokens(text string) int {
+	tokens := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == ' ' && i+size < len(text) {
+			// A space belongs to the word or punctuation following it
+			if next, _ := utf8.DecodeRuneInString(text[i+size:]); runeClass(next) == runeLetter || runeClass(next) == runeSymbol {
+				i += size
+				continue
+			}
+		}
+		class := runeClass(r)
+		n := 0
+		for i < len(text) {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if runeClass(r) != class || (class == runeDigit && n == pretokenDigits) {
+				break
+			}
+			i += size
+			n++
+		}
+		switch class {
+		case runeLetter:
+			tokens += (n + pretokenRunes - 1) / pretokenRunes
+		case runeDigit:
+			tokens++
+		case runeSpace:
+			// Spaces between words are merged into them, runs of them and line
+			// breaks are mostly one token
+			tokens++
+		default:
+			tokens += (n + 1) / 2
+		}
+	}
+	return tokens
+}
+
+// Classes of characters split into pieces by countPretokens
+const (
+	runeLetter = iota
+	runeDigit
+	runeSpace
+	runeSymbol
+)
+
+func runeClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r) || unicode.IsMark(r):
+		return runeLetter
+	case unicode.IsDigit(r):
+		return runeDigit
+	case unicode.IsSpace(r):
+		return runeSpace
+	}
+	return runeSymbol
+}
+
+// contextTokens returns the tokens a request needs in the context window of
+// the model serving it, its prompt and generation limit, 0 when context
+// routing is disabled
+func (r *OpenAIRouter) contextTokens(req *OpenAIRequest, body []byte) int {
+	if r.countTokens == nil {
+		return 0
+	}
+	_, maxTokens := requestedMaxTokens(body)
+	return r.countTokens(req) + int(maxTokens)
+}
+
+// fitsContext reports whether a request needing tokens fits the context
+// window of a model, which it does when the window is unknown
+func (r *OpenAIRouter) fitsContext(model string, tokens int) bool {
+	window := r.Config.GetModelContextWindow(model)
+	return window <= 0 || tokens <= window
+}
+
+// contextFitModel returns the model a request needing tokens goes to instead
+// of one whose context window it exceeds: the first model of the category's
+// fallback chain known to fit it, else the configured model with the smallest
+// context window fitting it, each allowed by the policies and with a closed
+// circuit. It returns false when no model is known to fit the request.
+func (r *OpenAIRouter) contextFitModel(model, category string, tokens int, policies policy.Set) (string, bool) {
+	fits := func(candidate string) bool {
+		window := r.Config.GetModelContextWindow(candidate)
+		return candidate != model && window >= tokens && policies.Check(candidate) == nil && r.Breakers.Allow(candidate)
+	}
+	for _, candidate := range r.Config.GetFallbackModelsForCategory(category) {
+		if fits(candidate) {
+			metrics.RecordContextLengthRouting(model, contextRedirected)
+			return candidate, true
+		}
+	}
+
+	var longContext []string
+	for candidate := range r.Config.ModelConfig {
+		if fits(candidate) {
+			longContext = append(longContext, candidate)
+		}
+	}
+	if len(longContext) == 0 {
+		metrics.RecordContextLengthRouting(model, contextNoFit)
+		return "", false
+	}
+	slices.SortFunc(longContext, func(a, b string) int {
+		return cmp.Or(cmp.Compare(r.Config.GetModelContextWindow(a), r.Config.GetModelContextWindow(b)), strings.Compare(a, b))
+	})
+	metrics.RecordContextLengthRouting(model, contextRedirected)
+	return longContext[0], true
+}
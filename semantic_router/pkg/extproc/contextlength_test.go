@@ -0,0 +1,78 @@
+package extproc
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestPretokens(t *testing.T) {
+	for text, want := range map[string]int{
+		"":                           0,
+		"Hello world":                2,
+		"What is 12345?":             6,
+		"internationalization":       3,
+		"a, b.\n\nc":                 6,
+		"  indented":                 2,
+		"Explain the theorem please": 4,
+	} {
+		if got := pretokens(text); got != want {
+			t.Errorf("pretokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestNewContextTokenCounter(t *testing.T) {
+	if counter, err := newContextTokenCounter(config.ContextRoutingConfig{}); counter != nil || err != nil {
+		t.Errorf("disabled context routing: %v, %v", counter != nil, err)
+	}
+	for _, name := range []string{"", TokenCounterChars, TokenCounterPretokens} {
+		if counter, err := newContextTokenCounter(config.ContextRoutingConfig{Enabled: true, TokenCounter: name}); counter == nil || err != nil {
+			t.Errorf("token counter %q: %v", name, err)
+		}
+	}
+	if _, err := newContextTokenCounter(config.ContextRoutingConfig{Enabled: true, TokenCounter: "tiktoken"}); err == nil {
+		t.Error("unknown token counter accepted")
+	}
+}
+
+func TestProcessContextRouting(t *testing.T) {
+	long := strings.Repeat("Consider the derivative of x^2 again. ", 20)
+	for _, tc := range []struct {
+		name      string
+		prompt    string
+		maxTokens string
+		windows   map[string]int
+		wantModel string
+	}{
+		{"fits", "What is the derivative of x^2?", "", map[string]int{"math-model": 100, "long-model": 8192}, "math-model"},
+		{"long prompt", long, "", map[string]int{"math-model": 100, "long-model": 8192, "longer-model": 32768}, "long-model"},
+		{"generation limit", "What is the derivative of x^2?", `,"max_tokens":200`, map[string]int{"math-model": 100, "long-model": 8192}, "long-model"},
+		{"nothing fits", long, "", map[string]int{"math-model": 100}, "math-model"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.Config.ModelConfig = map[string]config.ModelParams{}
+			for model, window := range tc.windows {
+				router.Config.ModelConfig[model] = config.ModelParams{ContextWindow: window}
+			}
+			router.countTokens = estimatePromptTokens
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders(),
+				requestBody(`{"model":"auto","messages":[{"role":"user","content":"` + tc.prompt + `"}]` + tc.maxTokens + `}`),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+			body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+			if model := gjson.GetBytes(body, "model").String(); model != tc.wantModel {
+				t.Errorf("routed to %q, want %s", model, tc.wantModel)
+			}
+		})
+	}
+}
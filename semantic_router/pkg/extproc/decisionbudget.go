@@ -0,0 +1,113 @@
+package extproc
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Steps of the request phase whose cost is tracked against the decision budget
+const (
+	// A semantic cache lookup, including storing the pending request on a miss
+	costCacheLookup = "cache_lookup"
+	// A single classifier or similarity call
+	costClassify = "classify"
+)
+
+// Approximations made to stay within the decision budget, recorded in
+// decision records and metrics
+const (
+	// The semantic cache was not consulted
+	DegradedCacheLookup = "cache_lookup"
+	// Only the first chunks of long text were classified
+	DegradedClassificationChunks = "classification_chunks"
+	// The request was not classified and went to the default model
+	DegradedClassification = "classification"
+)
+
+// stageCosts keeps a moving average of how long each budgeted step takes
+type stageCosts struct {
+	mu    sync.Mutex
+	costs map[string]time.Duration
+}
+
+func newStageCosts() *stageCosts {
+	return &stageCosts{costs: make(map[string]time.Duration)}
+}
+
+// estimate returns the expected duration of a step, zero until it was observed
+func (c *stageCosts) estimate(step string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.costs[step]
+}
+
+// observe folds a measured duration into the step's moving average
+func (c *stageCosts) observe(step string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cost, ok := c.costs[step]; ok {
+		c.costs[step] = cost + (d-cost)/5
+	} else {
+		c.costs[step] = d
+	}
+}
+
+// decisionBudget is the time left for the routing decision of one request.
+// Before each budgeted step the remaining time is compared with the step's
+// average cost; steps that no longer fit are skipped or approximated, so the
+// latency the router adds stays bounded. A nil budget is unlimited.
+type decisionBudget struct {
+	deadline time.Time
+	costs    *stageCosts
+	degraded []string
+}
+
+// newDecisionBudget starts the budget of a request whose body arrived at
+// start, or returns nil when no budget is configured
+func (r *OpenAIRouter) newDecisionBudget(start time.Time) *decisionBudget {
+	cfg := r.Config.DecisionBudget
+	if !cfg.Enabled || cfg.BudgetMilliseconds <= 0 {
+		return nil
+	}
+	return &decisionBudget{
+		deadline: start.Add(time.Duration(cfg.BudgetMilliseconds) * time.Millisecond),
+		costs:    r.stageCosts,
+	}
+}
+
+// allows reports whether the step still fits in the remaining budget. If it
+// does not, the approximation taken instead is recorded.
+func (b *decisionBudget) allows(step, approximation string) bool {
+	if b == nil {
+		return true
+	}
+	remaining := time.Until(b.deadline)
+	estimate := b.costs.estimate(step)
+	if remaining >= estimate {
+		return true
+	}
+	slog.Info("Decision budget too short for step, degrading", "remaining", remaining.Round(time.Microsecond),
+		"step", step, "estimate", estimate.Round(time.Microsecond), "approximation", approximation)
+	b.degraded = append(b.degraded, approximation)
+	metrics.RecordDecisionBudgetDegraded(approximation)
+	return false
+}
+
+// observe records the duration of a step that started at start
+func (b *decisionBudget) observe(step string, start time.Time) {
+	if b == nil {
+		return
+	}
+	b.costs.observe(step, time.Since(start))
+}
+
+// Degraded returns the approximations made for the request
+func (b *decisionBudget) Degraded() []string {
+	if b == nil {
+		return nil
+	}
+	return b.degraded
+}
@@ -0,0 +1,116 @@
+package extproc
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+)
+
+func TestStageCosts(t *testing.T) {
+	costs := newStageCosts()
+	if got := costs.estimate(costClassify); got != 0 {
+		t.Errorf("estimate before any observation = %s, want 0", got)
+	}
+	costs.observe(costClassify, 10*time.Millisecond)
+	costs.observe(costClassify, 20*time.Millisecond)
+	if got := costs.estimate(costClassify); got != 12*time.Millisecond {
+		t.Errorf("estimate = %s, want the moving average 12ms", got)
+	}
+
+	var unlimited *decisionBudget
+	if !unlimited.allows(costClassify, DegradedClassification) || unlimited.Degraded() != nil {
+		t.Error("nil budget degraded a step")
+	}
+}
+
+func TestProcessWithinDecisionBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		costs        map[string]time.Duration
+		wantModel    string
+		wantCached   bool
+		wantDegraded []string
+	}{
+		{name: "within budget", wantModel: "math-model", wantCached: true},
+		{
+			name:         "cache lookup too slow",
+			costs:        map[string]time.Duration{costCacheLookup: time.Hour},
+			wantModel:    "math-model",
+			wantDegraded: []string{DegradedCacheLookup},
+		},
+		{
+			name:         "classifier too slow",
+			costs:        map[string]time.Duration{costClassify: time.Hour},
+			wantModel:    "default-model",
+			wantCached:   true,
+			wantDegraded: []string{DegradedClassification},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			sink := &recordingSink{}
+			router.Decisions = sink
+			router.Config.DecisionBudget.Enabled = true
+			router.Config.DecisionBudget.BudgetMilliseconds = 1000
+			for step, cost := range tt.costs {
+				router.stageCosts.observe(step, cost)
+			}
+
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+			routing := sink.records[0].GetRouting()
+			if routing.GetSelectedModel() != tt.wantModel {
+				t.Errorf("routed to %s, want %s", routing.GetSelectedModel(), tt.wantModel)
+			}
+			if !reflect.DeepEqual(routing.GetBudgetDegraded(), tt.wantDegraded) {
+				t.Errorf("budget_degraded = %v, want %v", routing.GetBudgetDegraded(), tt.wantDegraded)
+			}
+			if _, found, _ := router.Cache.FindSimilar("auto", "What is the derivative of x^2?"); found != tt.wantCached {
+				t.Errorf("response cached = %v, want %v", found, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestClassifyTextStopsChunksWhenBudgetRunsOut(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.TextChunking.Enabled = true
+	router.Config.TextChunking.ChunkWords = 4
+	budget := &decisionBudget{deadline: time.Now().Add(time.Hour), costs: router.stageCosts}
+	var classified []string
+	router.classify = func(text string) (candle_binding.ClassResult, error) {
+		classified = append(classified, text)
+		// The first chunk uses up the budget
+		budget.deadline = time.Now()
+		router.stageCosts.observe(costClassify, time.Second)
+		return fakeClassifier(text)
+	}
+
+	result, err := router.classifyText("what is the derivative of x^2 and of the sine of x", budget)
+	if err != nil {
+		t.Fatalf("classifyText: %v", err)
+	}
+	if len(classified) != 1 || !strings.HasPrefix(classified[0], "what is the derivative") {
+		t.Errorf("classified %q, want only the first chunk", classified)
+	}
+	if result.Class != 0 {
+		t.Errorf("class = %d, want the first chunk's class", result.Class)
+	}
+	if got := budget.Degraded(); !reflect.DeepEqual(got, []string{DegradedClassificationChunks}) {
+		t.Errorf("degraded = %v, want %s", got, DegradedClassificationChunks)
+	}
+}
@@ -0,0 +1,37 @@
+package extproc
+
+import (
+	"strconv"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// Headers carrying the routing decision of a request
+const (
+	decisionModelHeader    = "x-semantic-router-model"
+	decisionCategoryHeader = "x-semantic-router-category"
+	decisionScoreHeader    = "x-semantic-router-score"
+)
+
+// addDecisionHeaders adds headers describing the routing decision of a request
+// to a header mutation, created when nil: the model it was sent to and, when it
+// was classified, the category and classification score. They replace any
+// headers of the same names, so clients can't forge them.
+func addDecisionHeaders(mutation *ext_proc.HeaderMutation, model string, match categoryMatch) *ext_proc.HeaderMutation {
+	if mutation == nil {
+		mutation = &ext_proc.HeaderMutation{}
+	}
+	set := func(key, value string) {
+		mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+			Header:       &core.HeaderValue{Key: key, RawValue: []byte(value)},
+			AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		})
+	}
+	set(decisionModelHeader, model)
+	if match.Category != "" || match.Confidence > 0 {
+		set(decisionCategoryHeader, match.Category)
+		set(decisionScoreHeader, strconv.FormatFloat(float64(match.Confidence), 'f', 4, 32))
+	}
+	return mutation
+}
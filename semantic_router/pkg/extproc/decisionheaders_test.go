@@ -0,0 +1,100 @@
+package extproc
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// setHeaders returns the headers a mutation sets, by name
+func setHeaders(mutation *ext_proc.HeaderMutation) map[string]string {
+	headers := make(map[string]string)
+	for _, h := range mutation.GetSetHeaders() {
+		headers[h.GetHeader().GetKey()] = string(h.GetHeader().GetRawValue())
+	}
+	return headers
+}
+
+func TestProcessDecisionHeaders(t *testing.T) {
+	classified := map[string]string{
+		decisionModelHeader:    "math-model",
+		decisionCategoryHeader: "math",
+		decisionScoreHeader:    "0.9000",
+	}
+	tests := []struct {
+		name         string
+		cfg          config.DecisionHeadersConfig
+		model        string
+		wantRequest  map[string]string
+		wantResponse map[string]string
+	}{
+		{name: "disabled", model: "auto"},
+		{
+			name:         "classified",
+			cfg:          config.DecisionHeadersConfig{Request: true, Response: true},
+			model:        "auto",
+			wantRequest:  classified,
+			wantResponse: classified,
+		},
+		{
+			name:        "request only",
+			cfg:         config.DecisionHeadersConfig{Request: true},
+			model:       "auto",
+			wantRequest: classified,
+		},
+		{
+			name:         "model chosen by the client",
+			cfg:          config.DecisionHeadersConfig{Request: true, Response: true},
+			model:        "phi4",
+			wantRequest:  map[string]string{decisionModelHeader: "phi4"},
+			wantResponse: map[string]string{decisionModelHeader: "phi4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.Config.DecisionHeaders = tt.cfg
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1", decisionModelHeader, "forged"),
+				requestBody(`{"model":"` + tt.model + `","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			requestMutation := stream.responses[1].GetRequestBody().GetResponse().GetHeaderMutation()
+			if got := decisionHeadersOf(setHeaders(requestMutation)); !reflect.DeepEqual(got, tt.wantRequest) {
+				t.Errorf("request headers = %v, want %v", got, tt.wantRequest)
+			}
+			for _, h := range requestMutation.GetSetHeaders() {
+				if h.GetHeader().GetKey() == decisionModelHeader && h.GetAppendAction() != core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD {
+					t.Errorf("model header appended with %v, want it to overwrite the forged one", h.GetAppendAction())
+				}
+			}
+			responseMutation := stream.responses[2].GetResponseHeaders().GetResponse().GetHeaderMutation()
+			if got := decisionHeadersOf(setHeaders(responseMutation)); !reflect.DeepEqual(got, tt.wantResponse) {
+				t.Errorf("response headers = %v, want %v", got, tt.wantResponse)
+			}
+		})
+	}
+}
+
+// decisionHeadersOf returns the decision headers among headers, nil when none
+func decisionHeadersOf(headers map[string]string) map[string]string {
+	var decision map[string]string
+	for _, name := range []string{decisionModelHeader, decisionCategoryHeader, decisionScoreHeader} {
+		if value, ok := headers[name]; ok {
+			if decision == nil {
+				decision = make(map[string]string)
+			}
+			decision[name] = value
+		}
+	}
+	return decision
+}
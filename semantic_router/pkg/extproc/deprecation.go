@@ -0,0 +1,95 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// Response headers telling clients the model serving them is deprecated, as
+// defined by RFC 9745 and RFC 8594
+const (
+	deprecationHeader = "deprecation"
+	sunsetHeader      = "sunset"
+)
+
+// Outcomes of requests routed to deprecated models, recorded in metrics
+const (
+	// The deprecated model served the request
+	DeprecationServed = "served"
+	// The request moved to the replacement model
+	DeprecationShifted = "shifted"
+	// The model is retired without a replacement, so the request was rejected
+	DeprecationRejected = "rejected"
+)
+
+// validateDeprecations checks the deprecation schedules of the models
+func validateDeprecations(cfg *config.RouterConfig) error {
+	for model, params := range cfg.ModelConfig {
+		deprecation := params.Deprecation
+		switch {
+		case deprecation.Since.IsZero() && (!deprecation.Sunset.IsZero() || deprecation.Replacement != ""):
+			return fmt.Errorf("invalid deprecation for model %s: since is required", model)
+		case !deprecation.Sunset.IsZero() && !deprecation.Sunset.After(deprecation.Since):
+			return fmt.Errorf("invalid deprecation for model %s: sunset must be after since", model)
+		case deprecation.Replacement == model:
+			return fmt.Errorf("invalid deprecation for model %s: a model cannot replace itself", model)
+		}
+	}
+	return nil
+}
+
+// deprecationBucket maps a request for a model to a point in [0, 1). The
+// request moves to the replacement once the shifted share passes its point,
+// so retries of a request move together and stay moved as the share grows.
+func deprecationBucket(model, requestID string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(requestID))
+	return float64(h.Sum64()%10000) / 10000
+}
+
+// deprecationHeaders returns the headers announcing the deprecation of a model
+func deprecationHeaders(deprecation config.ModelDeprecationConfig) []*core.HeaderValueOption {
+	headers := []*core.HeaderValueOption{{
+		Header: &core.HeaderValue{Key: deprecationHeader, RawValue: []byte(fmt.Sprintf("@%d", deprecation.Since.Unix()))},
+	}}
+	if !deprecation.Sunset.IsZero() {
+		headers = append(headers, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: sunsetHeader, RawValue: []byte(deprecation.Sunset.UTC().Format(http.TimeFormat))},
+		})
+	}
+	return headers
+}
+
+// retiredModelResponse rejects a request for a model past its sunset that
+// has no replacement
+func retiredModelResponse(model string, deprecation config.ModelDeprecationConfig) *ext_proc.ProcessingResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("model %s was retired on %s", model, deprecation.Sunset.UTC().Format("2006-01-02")),
+			"type":    "invalid_request_error",
+			"code":    "model_retired",
+		},
+	})
+	headers := append([]*core.HeaderValueOption{
+		{Header: &core.HeaderValue{Key: "content-type", Value: "application/json"}},
+	}, deprecationHeaders(deprecation)...)
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_Gone},
+				Headers: &ext_proc.HeaderMutation{SetHeaders: headers},
+				Body:    body,
+			},
+		},
+	}
+}
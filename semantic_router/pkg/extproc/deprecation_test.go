@@ -0,0 +1,118 @@
+package extproc
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestValidateDeprecations(t *testing.T) {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		deprecation config.ModelDeprecationConfig
+		wantErr     bool
+	}{
+		{"none", config.ModelDeprecationConfig{}, false},
+		{"scheduled", config.ModelDeprecationConfig{Since: since, Sunset: since.Add(time.Hour), Replacement: "new-model"}, false},
+		{"deprecated only", config.ModelDeprecationConfig{Since: since}, false},
+		{"sunset without since", config.ModelDeprecationConfig{Sunset: since}, true},
+		{"sunset before since", config.ModelDeprecationConfig{Since: since, Sunset: since.Add(-time.Hour)}, true},
+		{"replaces itself", config.ModelDeprecationConfig{Since: since, Replacement: "old-model"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.RouterConfig{ModelConfig: map[string]config.ModelParams{"old-model": {Deprecation: tt.deprecation}}}
+			if err := validateDeprecations(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateDeprecations = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessDeprecatedModel(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		deprecation config.ModelDeprecationConfig
+		wantModel   string
+		wantStatus  int
+	}{
+		{
+			name:        "served before its share comes up",
+			deprecation: config.ModelDeprecationConfig{Since: now.Add(-time.Second), Sunset: now.Add(1000 * time.Hour), Replacement: "new-model"},
+			wantModel:   "old-model",
+		},
+		{
+			name:        "shifted to the replacement",
+			deprecation: config.ModelDeprecationConfig{Since: now.Add(-1000 * time.Hour), Sunset: now.Add(time.Second), Replacement: "new-model"},
+			wantModel:   "new-model",
+		},
+		{
+			name:        "retired with a replacement",
+			deprecation: config.ModelDeprecationConfig{Since: now.Add(-2 * time.Hour), Sunset: now.Add(-time.Hour), Replacement: "new-model"},
+			wantModel:   "new-model",
+		},
+		{
+			name:        "retired without a replacement",
+			deprecation: config.ModelDeprecationConfig{Since: now.Add(-2 * time.Hour), Sunset: now.Add(-time.Hour)},
+			wantStatus:  http.StatusGone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.Config.ModelConfig = map[string]config.ModelParams{"old-model": {Deprecation: tt.deprecation}}
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(`{"model":"old-model","messages":[{"role":"user","content":"hello"}]}`),
+				responseHeaders("200"),
+			}}
+			err := router.Process(stream)
+
+			if tt.wantStatus != 0 {
+				if err != nil {
+					t.Fatalf("Process returned %v", err)
+				}
+				immediate := stream.responses[1].GetImmediateResponse()
+				if immediate == nil || int(immediate.GetStatus().GetCode()) != tt.wantStatus {
+					t.Fatalf("expected a %d response, got %v", tt.wantStatus, stream.responses[1])
+				}
+				if !hasHeader(immediate.GetHeaders(), sunsetHeader) {
+					t.Error("rejection has no sunset header")
+				}
+				return
+			}
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("Process returned %v", err)
+			}
+			model := "old-model"
+			if body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody(); body != nil {
+				model = gjson.GetBytes(body, "model").String()
+			}
+			if model != tt.wantModel {
+				t.Errorf("request sent to %s, want %s", model, tt.wantModel)
+			}
+			headers := stream.responses[2].GetResponseHeaders().GetResponse().GetHeaderMutation()
+			if !hasHeader(headers, deprecationHeader) || !hasHeader(headers, sunsetHeader) {
+				t.Errorf("response lacks deprecation headers: %v", headers)
+			}
+		})
+	}
+}
+
+func hasHeader(mutation *ext_proc.HeaderMutation, key string) bool {
+	for _, header := range mutation.GetSetHeaders() {
+		if header.GetHeader().GetKey() == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package extproc
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// randomSource is the source of the router's random choices: application
+// model exploration, fault injection and generated request IDs. A nil source
+// is math/rand's global one; in deterministic mode it is seeded, so runs
+// replaying the same requests in the same order make the same choices.
+type randomSource struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// newRandomSource creates the seeded source of deterministic mode, nil unless
+// it is enabled
+func newRandomSource(cfg config.DeterministicConfig) *randomSource {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &randomSource{rand: rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))}
+}
+
+// Float64 returns a random number in [0, 1)
+func (s *randomSource) Float64() float64 {
+	if s == nil {
+		return rand.Float64()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64()
+}
+
+// Read fills p with random bytes, for generating request IDs
+func (s *randomSource) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var word [8]byte
+	for i := 0; i < len(p); i += len(word) {
+		binary.LittleEndian.PutUint64(word[:], s.rand.Uint64())
+		copy(p[i:], word[:])
+	}
+	return len(p), nil
+}
+
+// newID returns a random request ID
+func (s *randomSource) newID() string {
+	if s == nil {
+		return uuid.NewString()
+	}
+	id, err := uuid.NewRandomFromReader(s)
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
@@ -0,0 +1,51 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestRandomSourceSeeded(t *testing.T) {
+	if newRandomSource(config.DeterministicConfig{Seed: 7}) != nil {
+		t.Error("random source seeded outside deterministic mode")
+	}
+
+	cfg := config.DeterministicConfig{Enabled: true, Seed: 7}
+	a, b := newRandomSource(cfg), newRandomSource(cfg)
+	for i := 0; i < 3; i++ {
+		if x, y := a.Float64(), b.Float64(); x != y {
+			t.Fatalf("draw %d: %v != %v with the same seed", i, x, y)
+		}
+		if x, y := a.newID(), b.newID(); x != y {
+			t.Fatalf("ID %d: %s != %s with the same seed", i, x, y)
+		}
+	}
+	if newRandomSource(config.DeterministicConfig{Enabled: true, Seed: 8}).newID() == newRandomSource(cfg).newID() {
+		t.Error("different seeds generated the same ID")
+	}
+}
+
+func TestProcessDeterministicRequestIDs(t *testing.T) {
+	generatedID := func() string {
+		router := newTestRouter(t, false)
+		router.random = newRandomSource(config.DeterministicConfig{Enabled: true, Seed: 42})
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{requestHeaders()}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		for _, header := range stream.responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+			if header.GetHeader().GetKey() == "x-request-id" {
+				return string(header.GetHeader().GetRawValue()) + header.GetHeader().GetValue()
+			}
+		}
+		t.Fatal("no request ID generated")
+		return ""
+	}
+	if first, second := generatedID(), generatedID(); first != second {
+		t.Errorf("generated request IDs %s and %s, want the same in deterministic mode", first, second)
+	}
+}
@@ -0,0 +1,63 @@
+package extproc
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+)
+
+// drain stops the server from accepting streams and waits for the open ones to
+// finish, closing those still open after timeout. It reports whether all
+// streams finished in time.
+func drain(server *grpc.Server, timeout time.Duration, streams func() int64) bool {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+	}
+	slog.Warn("Streams did not drain in time, closing them", "timeout", timeout, "streams", streams())
+	server.Stop()
+	<-done
+	return false
+}
+
+// writeMetrics writes the metrics of a gatherer to a file in the Prometheus
+// text format, replacing it at once so a reader never sees part of it
+func writeMetrics(gatherer prometheus.Gatherer, path string) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
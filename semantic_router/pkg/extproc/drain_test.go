@@ -0,0 +1,95 @@
+package extproc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// blockingProcessor holds streams open until the client closes them
+type blockingProcessor struct {
+	ext_proc.UnimplementedExternalProcessorServer
+	started chan struct{}
+}
+
+func (p *blockingProcessor) Process(stream ext_proc.ExternalProcessor_ProcessServer) error {
+	p.started <- struct{}{}
+	<-stream.Context().Done()
+	return stream.Context().Err()
+}
+
+func TestDrain(t *testing.T) {
+	serve := func(t *testing.T) (*grpc.Server, *blockingProcessor, string) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		processor := &blockingProcessor{started: make(chan struct{}, 1)}
+		server := grpc.NewServer()
+		ext_proc.RegisterExternalProcessorServer(server, processor)
+		go server.Serve(lis)
+		t.Cleanup(server.Stop)
+		return server, processor, lis.Addr().String()
+	}
+	noStreams := func() int64 { return 0 }
+
+	t.Run("idle", func(t *testing.T) {
+		server, _, _ := serve(t)
+		if !drain(server, time.Second, noStreams) {
+			t.Error("idle server did not drain")
+		}
+	})
+
+	t.Run("open stream", func(t *testing.T) {
+		server, processor, address := serve(t)
+		conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		defer conn.Close()
+		if _, err := ext_proc.NewExternalProcessorClient(conn).Process(context.Background()); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+		<-processor.started
+
+		start := time.Now()
+		if drain(server, 50*time.Millisecond, func() int64 { return 1 }) {
+			t.Error("server with an open stream drained")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("drain took %v, want about the timeout", elapsed)
+		}
+	})
+}
+
+func TestWriteMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_requests_total", Help: "Requests"})
+	registry.MustRegister(counter)
+	counter.Add(3)
+
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := writeMetrics(registry, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "test_requests_total 3") {
+		t.Errorf("final metrics = %q, want the counter", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the metrics", len(entries))
+	}
+}
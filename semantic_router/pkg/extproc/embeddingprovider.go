@@ -0,0 +1,46 @@
+package extproc
+
+import (
+	"os"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/embeddings"
+)
+
+// newRemoteEmbeddings creates the remote embedding provider of the config, nil
+// when texts are embedded in process
+func newRemoteEmbeddings(cfg *config.RouterConfig) (*embeddings.Remote, error) {
+	if cfg.GetEmbeddingProvider() != config.EmbeddingProviderRemote {
+		return nil, nil
+	}
+	remoteCfg := cfg.EmbeddingProvider.Remote
+	var apiKey string
+	if remoteCfg.APIKeyEnv != "" {
+		apiKey = os.Getenv(remoteCfg.APIKeyEnv)
+	}
+	return embeddings.NewRemote(embeddings.RemoteOptions{
+		URL:          remoteCfg.URL,
+		Model:        remoteCfg.Model,
+		APIKey:       apiKey,
+		Timeout:      time.Duration(remoteCfg.TimeoutMs) * time.Millisecond,
+		MaxBatchSize: remoteCfg.MaxBatchSize,
+		BatchWait:    time.Duration(remoteCfg.BatchWaitMs) * time.Millisecond,
+		Breakers:     newBreakers(remoteCfg.CircuitBreaker),
+	})
+}
+
+// newBreakers creates the circuit breakers of a config, nil when disabled
+func newBreakers(cfg config.CircuitBreakerConfig) *breaker.Breakers {
+	if !cfg.Enabled {
+		return nil
+	}
+	return breaker.New(breaker.Options{
+		Window:       time.Duration(cfg.WindowSeconds) * time.Second,
+		MaxErrorRate: cfg.MaxErrorRate,
+		MaxLatency:   time.Duration(cfg.MaxLatencyMs) * time.Millisecond,
+		MinRequests:  cfg.MinRequests,
+		Cooldown:     time.Duration(cfg.CooldownSeconds) * time.Second,
+	})
+}
@@ -0,0 +1,41 @@
+package extproc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestNewRemoteEmbeddings(t *testing.T) {
+	cfg := &config.RouterConfig{}
+	if remote, err := newRemoteEmbeddings(cfg); remote != nil || err != nil {
+		t.Errorf("candle provider created remote embeddings %v, %v", remote, err)
+	}
+
+	var authorization string
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{"index": 0, "embedding": []float32{0.5, 0.5}}},
+		})
+	}))
+	defer endpoint.Close()
+	t.Setenv("EMBEDDINGS_API_KEY", "sk-embed")
+	cfg.EmbeddingProvider = config.EmbeddingProviderConfig{
+		Type:   config.EmbeddingProviderRemote,
+		Remote: config.RemoteEmbeddingConfig{URL: endpoint.URL, APIKeyEnv: "EMBEDDINGS_API_KEY"},
+	}
+	remote, err := newRemoteEmbeddings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedding, err := remote.Embed("hello"); err != nil || len(embedding) != 2 {
+		t.Errorf("Embed = %v, %v", embedding, err)
+	}
+	if authorization != "Bearer sk-embed" {
+		t.Errorf("sent authorization %q, want the key from the environment", authorization)
+	}
+}
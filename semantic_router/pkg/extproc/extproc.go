@@ -1,12 +1,18 @@
 package extproc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -17,12 +23,47 @@ import (
 	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 
 	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/admin"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/archive"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/autoscale"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/batch"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
 	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/canary"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/chunking"
 	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/coordinator"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/debugstore"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/discovery"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/embeddings"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/endpoints"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/errorbudget"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/feedback"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/fingerprint"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/flags"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/langdetect"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/leader"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/load"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/logging"
 	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/modelstore"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/pii"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/recommend"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/registration"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/replay"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tokenbudget"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
+	channelzservice "google.golang.org/grpc/channelz/service"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var (
@@ -36,9 +77,105 @@ type OpenAIRouter struct {
 	CategoryDescriptions []string
 	CategoryMapping      *CategoryMapping
 	Cache                *cache.SemanticCache
-	// Map to track pending requests and their unique IDs
-	pendingRequests     map[string][]byte
-	pendingRequestsLock sync.Mutex
+	Autoscaler           *autoscale.Signaler
+	Endpoints            *endpoints.Selector
+	FamilyTemplates      *FamilyTemplates
+	// Receives a decision record per request, nil when records are disabled
+	Decisions decision.Sink
+	// Decision records of recent requests, nil unless kept for the admin API
+	RecentDecisions *decision.RingSink
+	// Error responses of recent requests, nil unless kept for the admin API
+	UpstreamErrors *upstreamErrorLog
+	// Runtime switches for pipeline stages
+	Flags *flags.Flags
+	// Disables stages failing too often, nil when error budgets are disabled
+	ErrorBudgets *errorbudget.Tracker
+	// Routes around models whose responses fail, nil when the circuit breaker is disabled
+	Breakers *breaker.Breakers
+	// Hourly and daily token budgets of clients, nil when disabled
+	TokenBudgets *tokenbudget.Budgets
+	// Client region resolver and routing policies, nil when geo routing is disabled
+	Geo *policy.Geo
+	// Tenant data-residency policies, nil when residency is disabled
+	Residency *policy.Residency
+	// Archives the conversations of tenants under a compliance hold, nil
+	// without a compliance_archive sink
+	Archive *archive.Archiver
+	// Fleet coordinator client, nil unless coordinator.address is set
+	Coordinator *coordinator.Client
+	// Clusters unrouted queries into candidate categories, nil when discovery is disabled
+	Discovery *discovery.Discoverer
+	// Learns the best model of each application, nil when application learning is disabled
+	Recommender *recommend.Recommender
+	// Tunes category thresholds from feedback on routed requests, nil when routing feedback is disabled
+	Feedback *feedback.Tuner
+	// Finds PII in requests to block or redact, nil when PII detection is disabled
+	PII *pii.Detector
+	// Rejects jailbreak and prompt injection attempts, nil when the prompt guard is disabled
+	promptGuard *promptGuard
+	// Injects faults for resilience testing, nil when fault injection is disabled
+	faults *faultInjector
+	// Source of random choices, seeded in deterministic mode and nil otherwise
+	random *randomSource
+	// Traces of requests exceeding the latency SLO, nil when slow request tracing is disabled
+	Traces *debugstore.Store
+	// Records sampled streams for replay, nil when stream recording is disabled
+	Recordings *replay.Recorder
+	// Downloads and verifies hub models, nil when model download is disabled
+	ModelStore *modelstore.Store
+	// Accounts for the usage of Batch API batches once they finish, nil when batch accounting is disabled
+	Batches *batch.Reconciler
+	// Polls the load of model endpoints, nil when load-aware routing is disabled
+	Load *load.Monitor
+	// Retries loading the models in safe mode, nil when they loaded at startup
+	models *modelLoader
+	// Attempts per request, used to detect retries
+	attempts *attemptTracker
+	// Models that made recent tool calls, nil when tool call routing is disabled
+	toolCalls *toolCallTracker
+	// Counts the tokens of requests checked against context windows, nil when
+	// context routing is disabled
+	countTokens func(*OpenAIRequest) int
+	// Models conversations were routed to, nil when session routing is disabled
+	sessions *sessionTracker
+	// Recognizes applications by their system prompt, nil when none are configured
+	applications *applicationMatcher
+	// Requests counted against application quotas
+	appQuotas *applicationQuotas
+	// Resolves the routing policies of tenants, nil when none are configured
+	tenants *tenantRouter
+	// Tokens counted against tenant budgets, kept across config reloads
+	tenantTokens tokenbudget.Counter
+	// Average durations of the steps checked against the decision budget
+	stageCosts *stageCosts
+	// Classifier used for routing, replaceable in tests
+	classify func(text string) (candle_binding.ClassResult, error)
+	// Detects the API endpoint of requests from their path
+	apiPaths *apiPathMatcher
+	// Key signing routing receipts, nil when receipts are disabled
+	receiptKey []byte
+	// Responses returned for blocked categories, by category
+	blockResponses blockResponses
+	// Strips system prompt boilerplate before classification, nil when disabled
+	boilerplate *boilerplateFilter
+	// Similarity search used to match category utterances, scoring with the
+	// model of the language, or bert_model for an empty language, and embedding
+	// the query into the request's embeddings when it compares memoized
+	// embeddings itself; replaceable in tests
+	findSimilar func(set *embeddings.Set, language, query string, candidates []string) candle_binding.SimResult
+	// Embeddings of the category utterances searched by findSimilar, by the
+	// language of the model embedding them; nil when it compares memoized
+	// embeddings
+	utterances         *utteranceEmbeddings
+	languageUtterances map[string]*utteranceEmbeddings
+	// Embeds the readiness probe without the embedding cache, replaceable in tests
+	probeEmbedding func(text string) ([]float32, error)
+	// Expires the state kept across streams
+	janitor *stateJanitor
+	// Bytes buffered by streams, nil when unlimited
+	streamBudget *streamBudget
+	// Soak-mode leak checker, nil unless built with the debug tag
+	leaks *leakChecker
 }
 
 // Ensure OpenAIRouter implements the ext_proc calls
@@ -50,186 +187,1649 @@ func NewOpenAIRouter(configPath string) (*OpenAIRouter, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	if err := logging.Setup(logging.Options{Level: cfg.Logging.Level, Format: cfg.Logging.Format}); err != nil {
+		return nil, fmt.Errorf("invalid logging: %w", err)
+	}
 
 	initMutex.Lock()
 	defer initMutex.Unlock()
 
 	// Load category mapping if classifier is enabled
 	var categoryMapping *CategoryMapping
-	if cfg.Classifier.CategoryMappingPath != "" {
+	switch strategy := cfg.GetRoutingStrategy(); strategy {
+	case config.RoutingStrategyClassifier:
+		if cfg.Classifier.CategoryMappingPath == "" {
+			return nil, fmt.Errorf("invalid routing: the classifier strategy needs classifier.category_mapping_path")
+		}
 		categoryMapping, err = LoadCategoryMapping(cfg.Classifier.CategoryMappingPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load category mapping: %w", err)
 		}
-		log.Printf("Loaded category mapping with %d categories", len(categoryMapping.CategoryToIdx))
+		slog.Info("Loaded category mapping", "categories", len(categoryMapping.CategoryToIdx))
+	case config.RoutingStrategySimilarity:
+		if cfg.Classifier.CategoryMappingPath != "" {
+			slog.Info("Routing by similarity, not loading the classifier")
+		}
+	default:
+		return nil, fmt.Errorf("invalid routing: unknown strategy %q", strategy)
+	}
+	if err := validateModelSelection(cfg.Routing.ModelSelection); err != nil {
+		return nil, fmt.Errorf("invalid routing.model_selection: %w", err)
+	}
+
+	var store *modelstore.Store
+	if downloadCfg := cfg.ModelDownload; downloadCfg.Enabled {
+		store, err = modelstore.New(modelstore.Options{
+			CacheDir:            downloadCfg.CacheDir,
+			Endpoint:            downloadCfg.Endpoint,
+			Token:               os.Getenv("HF_TOKEN"),
+			Files:               downloadCfg.Files,
+			MaxAttempts:         downloadCfg.MaxAttempts,
+			RetryInterval:       time.Duration(downloadCfg.RetryIntervalSeconds) * time.Second,
+			RegistryUsername:    downloadCfg.RegistryUsername,
+			RegistryPassword:    os.Getenv("MODEL_REGISTRY_PASSWORD"),
+			PlainHTTPRegistries: downloadCfg.PlainHTTPRegistries,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid model_download: %w", err)
+		}
+	}
+
+	var loadErr error
+	if !initialized {
+		loadErr = initModels(cfg, categoryMapping, store)
+		if loadErr != nil && !cfg.SafeMode.Enabled {
+			return nil, loadErr
+		}
+		initialized = loadErr == nil
+	}
+
+	router, err := newRouter(cfg, categoryMapping)
+	if err != nil {
+		return nil, err
+	}
+	router.ModelStore = store
+	if loadErr != nil {
+		slog.Warn("Starting in safe mode with rules-only routing", "error", loadErr)
+		router.models = newModelLoader(func() error {
+			initMutex.Lock()
+			defer initMutex.Unlock()
+			if initialized {
+				return nil
+			}
+			if err := initModels(cfg, categoryMapping, store); err != nil {
+				return err
+			}
+			initialized = true
+			return nil
+		}, cfg.SafeMode, loadErr)
+	}
+	return router, nil
+}
+
+// initModels loads the similarity model and, with a category mapping, the
+// classifier, fetching them through the model store first when there is one
+func initModels(cfg *config.RouterConfig, categoryMapping *CategoryMapping, store *modelstore.Store) error {
+	// Initialize the BERT model for similarity search, unless a remote
+	// endpoint embeds texts
+	var bertModelID string
+	var err error
+	if cfg.GetEmbeddingProvider() == config.EmbeddingProviderCandle {
+		bertModelID, err = fetchModel(store, modelstore.Model{
+			Name:      "bert_model",
+			Source:    cfg.BertModel.Source,
+			ID:        cfg.BertModel.ModelID,
+			Revision:  cfg.BertModel.Revision,
+			Checksums: cfg.BertModel.Checksums,
+		})
+		if err != nil {
+			return err
+		}
+		if err := candle_binding.InitModel(bertModelID, cfg.BertModel.UseCPU); err != nil {
+			return fmt.Errorf("failed to initialize BERT model: %w", err)
+		}
+
+		// Load the similarity models of languages into the model pool, all at once
+		languages := make([]string, 0, len(cfg.BertModel.LanguageModels))
+		for language := range cfg.BertModel.LanguageModels {
+			languages = append(languages, language)
+		}
+		slices.Sort(languages)
+		pool := make([]candle_binding.PoolModel, 0, len(languages))
+		for _, language := range languages {
+			languageModel := cfg.BertModel.LanguageModels[language]
+			modelID, err := fetchModel(store, modelstore.Model{
+				Name:      languageModelName(language),
+				Source:    languageModel.Source,
+				ID:        languageModel.ModelID,
+				Revision:  languageModel.Revision,
+				Checksums: languageModel.Checksums,
+			})
+			if err != nil {
+				return err
+			}
+			pool = append(pool, candle_binding.PoolModel{Name: languageModelName(language), ModelID: modelID, UseCPU: cfg.BertModel.UseCPU})
+		}
+		if err := candle_binding.InitModelPool(pool); err != nil {
+			return fmt.Errorf("failed to initialize language models: %w", err)
+		}
+		if len(pool) > 0 {
+			slog.Info("Initialized language models", "languages", languages)
+		}
+	}
+
+	// Initialize the classifier model if enabled
+	if categoryMapping != nil {
+		// Get the number of categories from the mapping
+		numClasses := len(categoryMapping.CategoryToIdx)
+		if numClasses < 2 {
+			slog.Warn("Not enough categories for classification, need at least 2", "categories", numClasses)
+		} else {
+			// Use the same model or a specific classifier model
+			classifierModelID := bertModelID
+			if cfg.Classifier.ModelID != "" {
+				classifierModelID, err = fetchModel(store, modelstore.Model{
+					Name:      "classifier",
+					Source:    cfg.Classifier.Source,
+					ID:        cfg.Classifier.ModelID,
+					Revision:  cfg.Classifier.Revision,
+					Checksums: cfg.Classifier.Checksums,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			err = candle_binding.InitClassifier(classifierModelID, numClasses, cfg.Classifier.UseCPU)
+			if err != nil {
+				return fmt.Errorf("failed to initialize classifier model: %w", err)
+			}
+			slog.Info("Initialized classifier", "categories", numClasses)
+		}
+	}
+
+	// Initialize the PII token classifier if enabled, unless PII is only
+	// detected by patterns
+	if cfg.PII.Enabled && cfg.PII.ModelID != "" {
+		piiModelID, err := fetchModel(store, modelstore.Model{
+			Name:      "pii",
+			Source:    cfg.PII.Source,
+			ID:        cfg.PII.ModelID,
+			Revision:  cfg.PII.Revision,
+			Checksums: cfg.PII.Checksums,
+		})
+		if err != nil {
+			return err
+		}
+		if err := candle_binding.InitTokenClassifier(piiModelID, cfg.PII.UseCPU); err != nil {
+			return fmt.Errorf("failed to initialize PII model: %w", err)
+		}
+	}
+
+	// Initialize the prompt guard classifier if enabled
+	if cfg.PromptGuard.Enabled {
+		mapping, err := LoadCategoryMapping(cfg.PromptGuard.MappingPath)
+		if err != nil {
+			return fmt.Errorf("failed to load prompt guard mapping: %w", err)
+		}
+		guardModelID, err := fetchModel(store, modelstore.Model{
+			Name:      "prompt_guard",
+			Source:    cfg.PromptGuard.Source,
+			ID:        cfg.PromptGuard.ModelID,
+			Revision:  cfg.PromptGuard.Revision,
+			Checksums: cfg.PromptGuard.Checksums,
+		})
+		if err != nil {
+			return err
+		}
+		if err := candle_binding.InitJailbreakClassifier(guardModelID, len(mapping.IdxToCategory), cfg.PromptGuard.UseCPU); err != nil {
+			return fmt.Errorf("failed to initialize prompt guard model: %w", err)
+		}
+	}
+	return nil
+}
+
+// fetchModel returns the directory of a downloaded and verified model, or the
+// configured model ID for the model loader to fetch when there is no store
+func fetchModel(store *modelstore.Store, model modelstore.Model) (string, error) {
+	dir, err := store.Fetch(context.Background(), model)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s model: %w", model.Name, err)
+	}
+	return dir, nil
+}
+
+// newRouter builds the router and its subsystems from an already loaded config,
+// assuming the models have been initialized
+func newRouter(cfg *config.RouterConfig, categoryMapping *CategoryMapping) (*OpenAIRouter, error) {
+	if err := validateRouterMode(cfg.Mode); err != nil {
+		return nil, err
+	}
+	rollouts := make(map[string]flags.Rollout, len(cfg.StageRollouts))
+	for stage, rollout := range cfg.StageRollouts {
+		rollouts[stage] = flags.Rollout{
+			StartPercent:  rollout.StartPercent,
+			TargetPercent: rollout.TargetPercent,
+			RampStart:     rollout.RampStart,
+			RampDuration:  time.Duration(rollout.RampDurationSeconds) * time.Second,
+		}
+	}
+	stageFlags, err := flags.New(flags.Options{Initial: cfg.PipelineStages, Rollouts: rollouts})
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline_stages: %w", err)
+	}
+	if disabled := stageFlags.Disabled(); len(disabled) > 0 {
+		slog.Info("Pipeline stages disabled at startup", "stages", disabled)
+	}
+	var errorBudgets *errorbudget.Tracker
+	if budgetCfg := cfg.ErrorBudgets; budgetCfg.Enabled {
+		budgets := make(map[string]errorbudget.Budget, len(budgetCfg.Stages))
+		for stage, stageCfg := range budgetCfg.Stages {
+			budgets[stage] = errorbudget.Budget{
+				MaxErrorRate: stageCfg.MaxErrorRate,
+				MinCalls:     stageCfg.MinCalls,
+				Cooldown:     time.Duration(stageCfg.CooldownSeconds) * time.Second,
+			}
+		}
+		errorBudgets, err = errorbudget.New(errorbudget.Options{
+			Window:  time.Duration(budgetCfg.WindowSeconds) * time.Second,
+			Budgets: budgets,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid error_budgets: %w", err)
+		}
+		slog.Info("Error budgets enabled", "stages", len(budgets))
+	}
+	breakers := newBreakers(cfg.CircuitBreaker)
+	if breakers != nil {
+		slog.Info("Circuit breaker enabled")
+	}
+	tokenBudgets, err := newTokenBudgets(cfg.TokenBudgets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token_budgets: %w", err)
+	}
+
+	categoryDescriptions := cfg.GetCategoryDescriptions()
+	slog.Debug("Category descriptions", "descriptions", categoryDescriptions)
+
+	// Embed with the remote endpoint when configured, and serve recorded
+	// embeddings in deterministic mode, when fixtures are given
+	computeEmbedding := candle_binding.GetEmbeddingDefault
+	remoteEmbeddings, err := newRemoteEmbeddings(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedding_provider: %w", err)
+	}
+	if remoteEmbeddings != nil {
+		computeEmbedding = remoteEmbeddings.Embed
+		slog.Info("Embedding with a remote endpoint", "url", cfg.EmbeddingProvider.Remote.URL,
+			"model", cfg.EmbeddingProvider.Remote.Model)
+	}
+	probeEmbedding := computeEmbedding
+	var fixtures *embeddings.Fixtures
+	if deterministicCfg := cfg.Deterministic; deterministicCfg.Enabled {
+		if deterministicCfg.EmbeddingFixtures != "" {
+			var record embeddings.Provider
+			if deterministicCfg.RecordFixtures {
+				record = embeddings.ProviderFunc(computeEmbedding)
+			}
+			fixtures, err = embeddings.LoadFixtures(deterministicCfg.EmbeddingFixtures, record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load embedding fixtures: %w", err)
+			}
+			computeEmbedding = fixtures.Embed
+			slog.Info("Serving embeddings from fixtures", "path", deterministicCfg.EmbeddingFixtures,
+				"recorded", fixtures.Len(), "record", deterministicCfg.RecordFixtures)
+		}
+		slog.Warn("Deterministic mode enabled", "seed", deterministicCfg.Seed)
+	}
+
+	// Memoize embeddings, shared by utterance routing, the cache and discovery.
+	// Similarity with fixtures compares their embeddings, unmemoized unless
+	// the embedding cache is enabled. Remote embeddings are always memoized,
+	// so category utterances are not sent with every request.
+	embed := computeEmbedding
+	utterances := newUtteranceEmbeddings()
+	languageUtterances := make(map[string]*utteranceEmbeddings, len(cfg.BertModel.LanguageModels))
+	for language := range cfg.BertModel.LanguageModels {
+		languageUtterances[language] = newLanguageUtteranceEmbeddings(language)
+	}
+	findSimilar := func(_ *embeddings.Set, language, query string, candidates []string) candle_binding.SimResult {
+		// Queries are scored with bert_model until their language's model loads
+		if u, ok := languageUtterances[language]; ok && u.loaded() {
+			return u.findMostSimilar(query, candidates)
+		}
+		return utterances.findMostSimilar(query, candidates)
+	}
+	if memoCfg := cfg.EmbeddingCache; memoCfg.Enabled || fixtures != nil || remoteEmbeddings != nil {
+		memoCfg.Enabled = memoCfg.Enabled || remoteEmbeddings != nil
+		maxEntries := memoCfg.MaxEntries
+		if !memoCfg.Enabled {
+			maxEntries = 0
+		} else if maxEntries <= 0 {
+			maxEntries = 10000
+		}
+		memo := embeddings.New(embeddings.Options{
+			Embed:           computeEmbedding,
+			MaxEntries:      maxEntries,
+			CaseInsensitive: memoCfg.CaseInsensitive,
+		})
+		embed = memo.Embed
+		utterances, languageUtterances = nil, nil
+		findSimilar = func(set *embeddings.Set, _, query string, candidates []string) candle_binding.SimResult {
+			queryEmbedding, err := set.Embed(query, memo.Embed)
+			if err != nil {
+				slog.Error("Error embedding the text to find the most similar to", "error", err)
+				return candle_binding.SimResult{Index: -1, Score: -1}
+			}
+			index, score, err := memo.MostSimilar(queryEmbedding, candidates)
+			if err != nil {
+				slog.Error("Error finding the most similar text", "error", err)
+				return candle_binding.SimResult{Index: -1, Score: -1}
+			}
+			return candle_binding.SimResult{Index: index, Score: score}
+		}
+		if memoCfg.Enabled {
+			slog.Info("Embedding cache enabled", "max_entries", maxEntries)
+		}
+	}
+
+	// Create semantic cache with config options
+	cacheOptions := cache.SemanticCacheOptions{
+		SimilarityThreshold: cfg.GetCacheSimilarityThreshold(),
+		MaxEntries:          cfg.SemanticCache.MaxEntries,
+		TTLSeconds:          cfg.SemanticCache.TTLSeconds,
+		Enabled:             cfg.SemanticCache.Enabled,
+		Chunking:            chunkingOptions(cfg),
+		Epoch:               cfg.GetCacheEpoch(),
+		Prefilter: cache.PrefilterOptions{
+			Enabled:           cfg.SemanticCache.Prefilter.Enabled,
+			MinOverlap:        cfg.SemanticCache.Prefilter.MinOverlap,
+			Capacity:          cfg.SemanticCache.Prefilter.Capacity,
+			FalsePositiveRate: cfg.SemanticCache.Prefilter.FalsePositiveRate,
+		},
+		EmbedFunc:      embed,
+		WriteQueueSize: cfg.GetCacheWriteQueueSize(),
+		Writers:        cfg.SemanticCache.WriteWorkers,
+		Index: cache.IndexOptions{
+			ExactSearch:    cfg.SemanticCache.ExactSearch,
+			M:              cfg.SemanticCache.Index.M,
+			EfConstruction: cfg.SemanticCache.Index.EfConstruction,
+			EfSearch:       cfg.SemanticCache.Index.EfSearch,
+		},
+		Eviction: cache.EvictionOptions{
+			Policy:         cfg.SemanticCache.EvictionPolicy,
+			MaxMemoryBytes: cfg.SemanticCache.MaxMemoryBytes,
+			Interval:       time.Duration(cfg.SemanticCache.EvictionIntervalSeconds) * time.Second,
+		},
+		Snapshot: cache.SnapshotOptions{
+			Path:           cfg.SemanticCache.Snapshot.Path,
+			Interval:       time.Duration(cfg.SemanticCache.Snapshot.IntervalSeconds) * time.Second,
+			MaxBytes:       cfg.SemanticCache.Snapshot.MaxBytes,
+			EmbeddingModel: cfg.GetEmbeddingModel(),
+		},
+	}
+	if err := cache.ValidateEvictionPolicy(cfg.SemanticCache.EvictionPolicy); err != nil {
+		return nil, fmt.Errorf("invalid semantic_cache: %w", err)
+	}
+	if normalizationCfg := cfg.SemanticCache.Normalization; normalizationCfg.Enabled {
+		cacheOptions.Normalizer, err = newCacheNormalizer(normalizationCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic_cache.normalization: %w", err)
+		}
+		cacheOptions.CompareRaw = normalizationCfg.CompareRaw
+	}
+	cacheBackend := cfg.SemanticCache.Backend
+	switch cacheBackend {
+	case "", "memory":
+		cacheBackend = "memory"
+	case "redis":
+		redisCfg := cfg.SemanticCache.Redis
+		if redisCfg.Address == "" {
+			return nil, fmt.Errorf("invalid semantic_cache: the redis backend needs an address")
+		}
+		var password string
+		if redisCfg.PasswordEnv != "" {
+			password = os.Getenv(redisCfg.PasswordEnv)
+			if password == "" {
+				return nil, fmt.Errorf("invalid semantic_cache: %s is not set", redisCfg.PasswordEnv)
+			}
+		}
+		redisBackend := cache.NewRedisBackend(cache.RedisOptions{
+			Address:    redisCfg.Address,
+			Password:   password,
+			DB:         redisCfg.DB,
+			KeyPrefix:  redisCfg.KeyPrefix,
+			MaxEntries: cfg.SemanticCache.MaxEntries,
+			TTL:        time.Duration(cfg.SemanticCache.TTLSeconds) * time.Second,
+			Timeout:    time.Duration(redisCfg.TimeoutMs) * time.Millisecond,
+			Index:      cacheOptions.Index,
+		})
+		if cfg.SemanticCache.Enabled {
+			// Cache errors only cost hits, so an unreachable server is not fatal
+			if err := redisBackend.Ping(); err != nil {
+				slog.Warn("Semantic cache Redis server is unreachable", "address", redisCfg.Address, "error", err)
+			}
+		}
+		if cfg.SemanticCache.Snapshot.Path != "" {
+			return nil, fmt.Errorf("invalid semantic_cache: snapshots are only taken of the memory backend")
+		}
+		cacheOptions.Backend = redisBackend
+	default:
+		return nil, fmt.Errorf("invalid semantic_cache: unknown backend %q", cacheBackend)
+	}
+	semanticCache := cache.NewSemanticCache(cacheOptions)
+	// A missing or unreadable snapshot only costs hits until the cache refills
+	if loaded, err := semanticCache.LoadSnapshot(); err != nil {
+		slog.Warn("Error loading semantic cache snapshot", "path", cacheOptions.Snapshot.Path, "loaded", loaded, "error", err)
+	} else if loaded > 0 {
+		slog.Info("Loaded semantic cache snapshot", "path", cacheOptions.Snapshot.Path, "entries", loaded)
+	}
+
+	if semanticCache.IsEnabled() {
+		slog.Info("Semantic cache enabled", "backend", cacheBackend, "threshold", cacheOptions.SimilarityThreshold,
+			"max_entries", cacheOptions.MaxEntries, "ttl_seconds", cacheOptions.TTLSeconds, "epoch", cacheOptions.Epoch)
+	} else {
+		slog.Info("Semantic cache is disabled")
+	}
+
+	// Create scale-up signaler for autoscaled backends
+	modelWebhooks := make(map[string]string)
+	for model, params := range cfg.ModelConfig {
+		if params.ScaleUpWebhook != "" {
+			modelWebhooks[model] = params.ScaleUpWebhook
+		}
+	}
+	autoscaler := autoscale.NewSignaler(autoscale.SignalerOptions{
+		Enabled:       cfg.Autoscale.Enabled,
+		WebhookURL:    cfg.Autoscale.WebhookURL,
+		Window:        time.Duration(cfg.Autoscale.WindowSeconds) * time.Second,
+		GrowthFactor:  cfg.Autoscale.GrowthFactor,
+		MinRequests:   cfg.Autoscale.MinRequests,
+		Cooldown:      time.Duration(cfg.Autoscale.CooldownSeconds) * time.Second,
+		Timeout:       time.Duration(cfg.Autoscale.TimeoutSeconds) * time.Second,
+		ModelWebhooks: modelWebhooks,
+	})
+	if autoscaler.IsEnabled() {
+		slog.Info("Scale-up signaling enabled", "webhook", cfg.Autoscale.WebhookURL)
+	}
+
+	// Track served prompt prefixes per endpoint if prefix affinity is enabled
+	var prefixes *endpoints.PrefixIndex
+	if prefixCfg := cfg.EndpointSelection.PrefixAffinity; prefixCfg.Enabled {
+		prefixes = endpoints.NewPrefixIndex(endpoints.PrefixIndexOptions{
+			BlockSize:            prefixCfg.BlockSize,
+			MaxBlocksPerEndpoint: prefixCfg.MaxBlocksPerEndpoint,
+			TTL:                  time.Duration(prefixCfg.TTLSeconds) * time.Second,
+		})
+	}
+
+	var toolCalls *toolCallTracker
+	if toolCfg := cfg.ToolCallRouting; toolCfg.Enabled {
+		ttl := 10 * time.Minute
+		if toolCfg.TTLSeconds > 0 {
+			ttl = time.Duration(toolCfg.TTLSeconds) * time.Second
+		}
+		toolCalls = newToolCallTracker(ttl)
+	}
+
+	blocks, err := newBlockResponses(cfg.Categories)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSystemPrompts(cfg.Categories); err != nil {
+		return nil, err
+	}
+	if err := validateTrafficSplits(cfg.Categories); err != nil {
+		return nil, err
+	}
+	if err := validateReasoningEfforts(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateModelFamilies(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateDeprecations(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateParameterConstraints(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateRequestTags(cfg.RequestTags); err != nil {
+		return nil, err
+	}
+	applyTenantMetrics(cfg.TenantMetrics)
+	apiPaths, err := newAPIPathMatcher(cfg.APIPaths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_paths: %w", err)
+	}
+	applications, err := newApplicationMatcher(cfg.Applications)
+	if err != nil {
+		return nil, fmt.Errorf("invalid applications: %w", err)
+	}
+	tenantTokens := tokenbudget.NewMemoryCounter()
+	tenants, err := newTenantRouter(cfg.Tenants, cfg.Categories, tenantTokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenants: %w", err)
+	}
+	receiptKey, err := newReceiptKey(cfg.RoutingReceipts)
+	if err != nil {
+		return nil, err
+	}
+	countContextTokens, err := newContextTokenCounter(cfg.ContextRouting)
+	if err != nil {
+		return nil, err
+	}
+
+	router := &OpenAIRouter{
+		Config:               cfg,
+		CategoryDescriptions: categoryDescriptions,
+		CategoryMapping:      categoryMapping,
+		Cache:                semanticCache,
+		Autoscaler:           autoscaler,
+		Endpoints: endpoints.NewSelector(endpoints.SelectorOptions{
+			Region:           cfg.EndpointSelection.Region,
+			Zone:             cfg.EndpointSelection.Zone,
+			FailureThreshold: cfg.EndpointSelection.FailureThreshold,
+			Cooldown:         time.Duration(cfg.EndpointSelection.CooldownSeconds) * time.Second,
+			ModelEndpoints:   cfg.GetModelEndpoints(),
+			Prefixes:         prefixes,
+		}),
+		FamilyTemplates: NewFamilyTemplates(cfg.ModelFamilyTemplates),
+		Flags:           stageFlags,
+		ErrorBudgets:    errorBudgets,
+		Breakers:        breakers,
+		TokenBudgets:    tokenBudgets,
+		random:          newRandomSource(cfg.Deterministic),
+		attempts:        newAttemptTracker(10 * time.Minute),
+		toolCalls:       toolCalls,
+		sessions:        newSessionTracker(cfg.SessionRouting),
+		countTokens:     countContextTokens,
+		stageCosts:      newStageCosts(),
+		blockResponses:  blocks,
+		apiPaths:        apiPaths,
+		applications:    applications,
+		tenants:         tenants,
+		tenantTokens:    tenantTokens,
+		receiptKey:      receiptKey,
+		classify:        candle_binding.ClassifyText,
+		findSimilar:     findSimilar,
+		utterances:      utterances,
+		probeEmbedding:  probeEmbedding,
+	}
+	router.languageUtterances = languageUtterances
+	router.retainUtterances(cfg)
+	var sinks decision.MultiSink
+	if recordsCfg := cfg.DecisionRecords; recordsCfg.Enabled {
+		sink := decision.LogSink{}
+		if recordsCfg.EncryptionKeyEnv != "" || recordsCfg.SigningKeyEnv != "" {
+			keys, err := decision.LoadKeys(recordsCfg.EncryptionKeyEnv, recordsCfg.SigningKeyEnv)
+			if err != nil {
+				return nil, fmt.Errorf("invalid decision_records: %w", err)
+			}
+			if sink.Sealer, err = decision.NewSealer(keys); err != nil {
+				return nil, fmt.Errorf("invalid decision_records: %w", err)
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	if learningCfg := cfg.ApplicationLearning; learningCfg.Enabled {
+		if learningCfg.ExploreRate < 0 || learningCfg.ExploreRate > 1 {
+			return nil, fmt.Errorf("invalid application_learning: explore_rate must be between 0 and 1")
+		}
+		router.Recommender = recommend.New(recommend.Options{
+			MinRequests:    learningCfg.MinRequests,
+			HalfLife:       time.Duration(learningCfg.HalfLifeHours * float64(time.Hour)),
+			LatencyWeight:  learningCfg.LatencyWeight,
+			FeedbackWeight: learningCfg.FeedbackWeight,
+			MinImprovement: learningCfg.MinImprovement,
+		})
+		sinks = append(sinks, router.Recommender)
+		slog.Info("Application model learning enabled")
+	}
+	if feedbackCfg := cfg.RoutingFeedback; feedbackCfg.Enabled && cfg.Admin.Port > 0 {
+		router.Feedback = feedback.New(feedback.Options{
+			Step:               feedbackCfg.Step,
+			MaxDrift:           feedbackCfg.MaxDrift,
+			MaxTrackedRequests: feedbackCfg.MaxTrackedRequests,
+		})
+		slog.Info("Routing feedback enabled")
+	}
+	if cfg.Admin.Port > 0 && cfg.Admin.RecentDecisions > 0 {
+		router.RecentDecisions = decision.NewRingSink(cfg.Admin.RecentDecisions)
+		sinks = append(sinks, router.RecentDecisions)
+	}
+	if cfg.Admin.Port > 0 && cfg.Admin.RecentUpstreamErrors > 0 {
+		router.UpstreamErrors = newUpstreamErrorLog(cfg.Admin.RecentUpstreamErrors)
+	}
+	switch len(sinks) {
+	case 0:
+	case 1:
+		router.Decisions = sinks[0]
+	default:
+		router.Decisions = sinks
+	}
+	if err := router.warmStart(cfg.WarmStart, cfg.DecisionRecords); err != nil {
+		return nil, fmt.Errorf("invalid warm_start: %w", err)
+	}
+	classifyTokens := candle_binding.ClassifyTokensDefault
+	if cfg.PII.ModelID == "" {
+		classifyTokens = nil
+	}
+	router.PII, err = newPIIDetector(cfg.PII, classifyTokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pii: %w", err)
+	}
+	if guardCfg := cfg.PromptGuard; guardCfg.Enabled {
+		mapping, err := LoadCategoryMapping(guardCfg.MappingPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load prompt guard mapping: %w", err)
+		}
+		router.promptGuard, err = newPromptGuard(guardCfg, mapping, chunkingOptions(cfg), candle_binding.ClassifyJailbreakText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt_guard: %w", err)
+		}
+		slog.Info("Prompt guard enabled", "classes", len(mapping.IdxToCategory), "threshold", router.promptGuard.threshold)
+	}
+	router.faults, err = newFaultInjector(cfg.FaultInjection, router.random.Float64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fault_injection: %w", err)
+	}
+	if geoCfg := cfg.GeoRouting; geoCfg.Enabled {
+		router.Geo, err = policy.NewGeo(policy.GeoOptions{
+			RegionHeader:     geoCfg.RegionHeader,
+			ClientIPHeader:   geoCfg.ClientIPHeader,
+			TrustedProxyHops: geoCfg.TrustedProxyHops,
+			Networks:         geoCfg.Networks,
+			Policies:         geoCfg.Policies,
+			ModelRegions:     cfg.GetModelRegions(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid geo_routing: %w", err)
+		}
+		slog.Info("Geo routing enabled", "networks", len(geoCfg.Networks), "policies", len(geoCfg.Policies))
+	}
+	if residencyCfg := cfg.Residency; residencyCfg.Enabled {
+		router.Residency, err = policy.NewResidency(policy.ResidencyOptions{
+			TenantHeader:    residencyCfg.TenantHeader,
+			Tenants:         residencyCfg.Tenants,
+			ModelAttributes: cfg.GetModelComplianceAttributes(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid residency: %w", err)
+		}
+		slog.Info("Residency policies enabled", "tenants", len(residencyCfg.Tenants))
+	}
+	router.Archive, err = newComplianceArchive(cfg.ComplianceArchive, router.PII)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compliance_archive: %w", err)
+	}
+	if router.Residency.Holds() && router.Archive == nil {
+		return nil, fmt.Errorf("residency tenants are under a compliance hold but compliance_archive has no sink")
+	}
+	if coordCfg := cfg.Coordinator; coordCfg.Address != "" {
+		replicaID := coordCfg.ReplicaID
+		if replicaID == "" {
+			replicaID, _ = os.Hostname()
+		}
+		router.Coordinator, err = coordinator.NewClient(coordinator.ClientOptions{
+			Address:            coordCfg.Address,
+			ReplicaID:          replicaID,
+			Interval:           time.Duration(coordCfg.SyncIntervalSeconds) * time.Second,
+			Timeout:            time.Duration(coordCfg.TimeoutSeconds) * time.Second,
+			UnhealthyEndpoints: router.Endpoints.UnhealthyEndpoints,
+			OnFleetUnhealthy:   router.Endpoints.SetFleetUnhealthy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinator: %w", err)
+		}
+	}
+	router.appQuotas = newApplicationQuotas(router.Coordinator)
+	if batchCfg := cfg.BatchAccounting; batchCfg.Enabled {
+		if batchCfg.APIBase == "" {
+			return nil, fmt.Errorf("invalid batch_accounting: api_base is required")
+		}
+		var apiKey string
+		if batchCfg.APIKeyEnv != "" {
+			apiKey = os.Getenv(batchCfg.APIKeyEnv)
+			if apiKey == "" {
+				return nil, fmt.Errorf("invalid batch_accounting: %s is not set", batchCfg.APIKeyEnv)
+			}
+		}
+		router.Batches = batch.New(batch.Options{
+			BaseURL:  batchCfg.APIBase,
+			APIKey:   apiKey,
+			Interval: time.Duration(batchCfg.PollIntervalSeconds) * time.Second,
+			MaxAge:   time.Duration(batchCfg.MaxAgeHours) * time.Hour,
+			Record: func(usage batch.Usage) {
+				metrics.RecordModelTokensDetailed(usage.Model, float64(usage.PromptTokens), float64(usage.CompletionTokens))
+			},
+		})
+	}
+	if loadCfg := cfg.LoadAwareRouting; loadCfg.Enabled {
+		router.Load = load.New(load.Options{
+			ModelEndpoints:   cfg.GetModelEndpoints(),
+			MetricsPath:      loadCfg.MetricsPath,
+			Interval:         time.Duration(loadCfg.PollIntervalSeconds) * time.Second,
+			Timeout:          time.Duration(loadCfg.TimeoutSeconds) * time.Second,
+			MaxAge:           time.Duration(loadCfg.MaxAgeSeconds) * time.Second,
+			FailureThreshold: loadCfg.FailureThreshold,
+			QueueWeight:      loadCfg.QueueWeight,
+			RunningWeight:    loadCfg.RunningWeight,
+			KVCacheWeight:    loadCfg.KVCacheWeight,
+		})
+	}
+	router.boilerplate, err = newBoilerplateFilter(cfg.BoilerplateFilter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid boilerplate_filter: %w", err)
+	}
+	if discoveryCfg := cfg.CategoryDiscovery; discoveryCfg.Enabled {
+		router.Discovery = discovery.New(discovery.Options{
+			Embed:               embed,
+			MaxSamples:          discoveryCfg.MaxSamples,
+			SimilarityThreshold: discoveryCfg.SimilarityThreshold,
+			MinClusterSize:      discoveryCfg.MinClusterSize,
+			MaxExamples:         discoveryCfg.MaxExamples,
+		})
+		slog.Info("Category discovery enabled for unrouted queries")
+	}
+	if tracingCfg := cfg.SlowRequestTracing; tracingCfg.Enabled {
+		router.Traces, err = debugstore.New(debugstore.Options{
+			MaxTraces: tracingCfg.MaxTraces,
+			Directory: tracingCfg.Directory,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid slow_request_tracing: %w", err)
+		}
+		slog.Info("Slow request tracing enabled", "slo_ms", tracingCfg.SLOMilliseconds)
+	}
+	if recordingCfg := cfg.StreamRecording; recordingCfg.Enabled {
+		router.Recordings, err = replay.NewRecorder(replay.RecorderOptions{
+			Directory:     recordingCfg.Directory,
+			SampleRate:    recordingCfg.SampleRate,
+			MaxFiles:      recordingCfg.MaxFiles,
+			RedactHeaders: append(slices.Clone(credentialHeaders), recordingCfg.RedactHeaders...),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream_recording: %w", err)
+		}
+		slog.Info("Recording ext_proc streams", "directory", recordingCfg.Directory, "sample_rate", recordingCfg.SampleRate)
+	}
+	router.janitor = newStateJanitor(router, cfg.RequestState)
+	router.streamBudget = newStreamBudget(cfg.StreamLimits)
+	router.leaks = newLeakChecker(leakCheckEnabled, router.leakCounts)
+	return router, nil
+}
+
+// leakCounts reports the size of the per-request state checked for leaks
+func (r *OpenAIRouter) leakCounts() map[string]int {
+	return map[string]int{
+		leakKindCachePending: r.Cache.PendingCount(),
+	}
+}
+
+// releasePendingRequest drops the pending cache entry of a request that will
+// not complete it, because the router answered it instead of the upstream or
+// the stream ended before the response did
+func (r *OpenAIRouter) releasePendingRequest(reqCtx *RequestContext) {
+	if reqCtx.CacheID == "" {
+		return
+	}
+	r.Cache.RemovePendingRequest(reqCtx.CacheID)
+	r.leaks.release(leakKindCachePending, reqCtx.CacheID)
+	reqCtx.CacheID = ""
+}
+
+// defaultMaxResponseBufferBytes bounds how much of a response body is buffered
+// for accounting and caching when no limit is configured
+const defaultMaxResponseBufferBytes = 16 * 1024 * 1024
+
+// maxResponseBufferBytes returns the configured response buffering limit
+func (r *OpenAIRouter) maxResponseBufferBytes() int {
+	if limit := r.Config.ResponseBuffering.MaxBytes; limit > 0 {
+		return limit
+	}
+	return defaultMaxResponseBufferBytes
+}
+
+// decisionMetadataNamespace is the Envoy dynamic metadata namespace holding routing decision details
+const decisionMetadataNamespace = "semantic_router"
+
+// buildDecisionMetadata wraps decision fields in the router's dynamic metadata namespace
+func buildDecisionMetadata(fields map[string]interface{}) *structpb.Struct {
+	if len(fields) == 0 {
+		return nil
+	}
+	metadata, err := structpb.NewStruct(map[string]interface{}{
+		decisionMetadataNamespace: fields,
+	})
+	if err != nil {
+		slog.Error("Error building decision metadata", "error", err)
+		return nil
+	}
+	return metadata
+}
+
+// destinationEndpointHeader carries the selected backend endpoint address to
+// Envoy. Only the router sets it: one sent by the client is always removed,
+// so clients cannot send requests to addresses of their choosing.
+const destinationEndpointHeader = "x-semantic-router-destination-endpoint"
+
+// stripDestinationEndpoint adds the removal of a client-sent destination
+// endpoint to a header mutation
+func stripDestinationEndpoint(mutation *ext_proc.HeaderMutation) *ext_proc.HeaderMutation {
+	if mutation == nil {
+		mutation = &ext_proc.HeaderMutation{}
+	}
+	mutation.RemoveHeaders = append(mutation.RemoveHeaders, destinationEndpointHeader)
+	return mutation
+}
+
+// getHeaderValue returns the value of a header, checking both Value and RawValue
+func getHeaderValue(headers *core.HeaderMap, key string) string {
+	if headers == nil {
+		return ""
+	}
+	for _, h := range headers.Headers {
+		if strings.EqualFold(h.Key, key) {
+			if h.Value != "" {
+				return h.Value
+			}
+			return string(h.RawValue)
+		}
+	}
+	return ""
+}
+
+// getSessionKey returns the session identifier from the configured header, or
+// the conversation prefix (first system and user message) when it is absent
+func getSessionKey(requestHeaders map[string]string, sessionHeader string, req *OpenAIRequest) string {
+	if sessionHeader != "" {
+		if value := requestHeaders[strings.ToLower(sessionHeader)]; value != "" {
+			return value
+		}
+	}
+
+	var system, user string
+	for _, msg := range req.Messages {
+		if msg.Role == "system" && system == "" {
+			system = msg.Content
+		} else if msg.Role == "user" && user == "" {
+			user = msg.Content
+		}
+	}
+	if system == "" && user == "" {
+		return ""
+	}
+	return system + "\n" + user
+}
+
+// getPromptText concatenates the conversation in order, as the upstream would see it
+func getPromptText(req *OpenAIRequest) string {
+	var sb strings.Builder
+	for _, msg := range req.Messages {
+		sb.WriteString(msg.Role)
+		sb.WriteString(": ")
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Send a response with proper error handling and logging
+func sendResponse(stream ext_proc.ExternalProcessor_ProcessServer, response *ext_proc.ProcessingResponse, msgType string) error {
+	if err := stream.Send(response); err != nil {
+		slog.Error("Error sending response", "response", msgType, "error", err)
+		return err
+	}
+	slog.Debug("Sent response", "response", msgType)
+	return nil
+}
+
+// requestPolicies returns the routing policies applying to a request, recording
+// the client region and tenant they were resolved from, and a scope string
+// identifying the combination, empty when no policy applies
+func (r *OpenAIRouter) requestPolicies(headers map[string]string, record *decision.DecisionRecord) (policy.Set, string) {
+	var policies policy.Set
+	var scope []string
+
+	clientRegion := r.Geo.ClientRegion(headers)
+	record.Routing.ClientRegion = clientRegion
+	if geoPolicy := r.Geo.PolicyFor(clientRegion); geoPolicy != nil {
+		policies = append(policies, geoPolicy)
+		scope = append(scope, "region="+clientRegion)
+	}
+
+	tenant := r.Residency.Tenant(headers)
+	record.Routing.Tenant = tenant
+	if tenantPolicy := r.Residency.PolicyFor(tenant); tenantPolicy != nil {
+		policies = append(policies, tenantPolicy)
+		scope = append(scope, "tenant="+tenant)
+	}
+	return policies, strings.Join(scope, ",")
+}
+
+// recordPolicyOutcomes records the outcome of each policy applying to a request,
+// which is allowed unless the policy rerouted or denied it
+func recordPolicyOutcomes(policies policy.Set, outcomes map[string]string) {
+	for _, p := range policies {
+		outcome, ok := outcomes[p.Name()]
+		if !ok {
+			outcome = "allowed"
+		}
+		metrics.RecordRoutingPolicyDecision(p.Name(), outcome)
+	}
+}
+
+// policyDenialResponse rejects a request that violates a routing policy with an
+// OpenAI style error body
+func policyDenialResponse(statusCode int, message string) *ext_proc.ProcessingResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    "policy_violation",
+			"code":    statusCode,
+		},
+	})
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode(statusCode)},
+				Headers: &ext_proc.HeaderMutation{
+					SetHeaders: []*core.HeaderValueOption{
+						{
+							Header: &core.HeaderValue{
+								Key:   "content-type",
+								Value: "application/json",
+							},
+						},
+					},
+				},
+				Body: body,
+			},
+		},
+	}
+}
+
+// finalizeResponse records metrics and updates the cache for the complete
+// response, returning mutations for the final response body chunk
+func (r *OpenAIRouter) finalizeResponse(reqCtx *RequestContext) (*ext_proc.HeaderMutation, *ext_proc.BodyMutation) {
+	completionLatency := time.Since(reqCtx.StartTime)
+	responseBody := reqCtx.responseBuffer
+	if reqCtx.Model != "" {
+		metrics.RecordResponseBodySize(reqCtx.Model, reqCtx.responseBytes)
+	}
+
+	// Feed the model's circuit breaker, timing the upstream by its headers so
+	// long streams do not count as slow
+	if reqCtx.Model != "" && reqCtx.responseStatus != 0 {
+		r.Breakers.Record(reqCtx.Model, !isUpstreamError(reqCtx.responseStatus), reqCtx.ResponseStartTime.Sub(reqCtx.RoutedTime))
+	}
+	if r.Config.Logging.LogPayloads && responseBody != nil {
+		reqCtx.log.Debug("Response payload", "body", string(responseBody))
+	}
+
+	// Count error responses by the error they report. Streamed responses
+	// only count by their status.
+	var upstreamErr upstreamError
+	var errored bool
+	if reqCtx.responseStreamed || reqCtx.responseOverflow {
+		upstreamErr, errored = parseUpstreamError(reqCtx.responseStatus, nil)
+	} else {
+		upstreamErr, errored = parseUpstreamError(reqCtx.responseStatus, responseBody)
+	}
+	if errored {
+		r.observeUpstreamError(reqCtx, upstreamErr)
+	}
+
+	// Streamed responses are accounted for and cached as the completion they amount to
+	completionBody := responseBody
+	if reqCtx.responseStreamed && !reqCtx.responseOverflow {
+		assembled, err := assembleStreamedCompletion(responseBody)
+		if err != nil {
+			reqCtx.log.Warn("Error assembling streamed response", "error", err)
+		}
+		completionBody = assembled
+	}
+
+	// Record tokens used with the model that was used, once per request across
+	// retries. Failed attempts of tracked requests leave it to the attempt that
+	// succeeds.
+	if reqCtx.Model != "" && (reqCtx.attemptKey == "" || (!errored && r.attempts.complete(reqCtx.attemptKey))) {
+		// Parse tokens from the response JSON
+		var promptTokens, completionTokens int
+		if completionBody != nil && !reqCtx.responseOverflow {
+			var err error
+			promptTokens, completionTokens, _, err = parseTokensFromResponse(completionBody)
+			if err != nil {
+				reqCtx.log.Warn("Error parsing tokens from response", "error", err)
+			}
+		}
+		metrics.RecordModelTokensDetailed(
+			reqCtx.Model,
+			float64(promptTokens),
+			float64(completionTokens),
+		)
+		metrics.RecordModelCompletionLatency(reqCtx.Model, completionLatency.Seconds())
+		if tenant := r.metricsTenant(reqCtx); tenant != "" {
+			metrics.RecordTenantUsage(tenant, float64(promptTokens), float64(completionTokens))
+		}
+		if len(reqCtx.tags) > 0 {
+			metrics.RecordTaggedUsage(reqCtx.tags, reqCtx.Model, float64(promptTokens), float64(completionTokens),
+				r.Config.GetModelCost(reqCtx.Model, promptTokens, completionTokens))
+		}
+		r.recordSelectionCost(reqCtx, promptTokens, completionTokens)
+		if category := reqCtx.routedMatch.Category; category != "" {
+			if group := r.trafficGroup(category, reqCtx.Model); group != "" {
+				metrics.RecordTrafficSplit(category, group, reqCtx.Model, float64(promptTokens), float64(completionTokens), completionLatency.Seconds())
+			}
+		}
+		// Upstreams not reporting usage are charged the estimated prompt
+		budgetedPrompt := promptTokens
+		if budgetedPrompt == 0 {
+			budgetedPrompt = reqCtx.estimatedPromptTokens
+		}
+		if reqCtx.budgetIdentity != "" {
+			r.TokenBudgets.Record(reqCtx.budgetIdentity, int64(budgetedPrompt+completionTokens))
+		}
+		r.tenants.recordTokens(reqCtx.tenant, int64(budgetedPrompt+completionTokens))
+		if !reqCtx.responseOverflow {
+			reconcileTokenUsage(reqCtx.Model, reqCtx.estimatedPromptTokens, promptTokens)
+		}
+		if reqCtx.record != nil {
+			reqCtx.record.Usage.EstimatedPromptTokens = int64(reqCtx.estimatedPromptTokens)
+			reqCtx.record.Usage.PromptTokens = int64(promptTokens)
+			reqCtx.record.Usage.CompletionTokens = int64(completionTokens)
+			reqCtx.record.Usage.CompletionSeconds = completionLatency.Seconds()
+		}
 	}
-
-	if !initialized {
-		// Initialize the BERT model for similarity search
-		err = candle_binding.InitModel(cfg.BertModel.ModelID, cfg.BertModel.UseCPU)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize BERT model: %w", err)
+	r.writeDecision(reqCtx)
+	r.trackFeedback(reqCtx, reqCtx.CacheID)
+	r.archiveExchange(reqCtx, completionBody)
+	recordStageCohorts(reqCtx.stageCohorts, time.Since(reqCtx.ProcessingStartTime), reqCtx.responseStatus == 0 || reqCtx.responseStatus >= 500)
+	r.captureSlowRequest(reqCtx.ID, requestTimings{
+		headers:         reqCtx.StartTime,
+		body:            reqCtx.ProcessingStartTime,
+		routed:          reqCtx.RoutedTime,
+		responseHeaders: reqCtx.ResponseStartTime,
+	}, reqCtx.Headers, reqCtx.record)
+
+	// The request's pending cache entry, if any, is completed below or
+	// dropped once the stream ends
+	cacheID := reqCtx.CacheID
+
+	// Remember which model made the response's tool calls, so the turns
+	// returning their output are routed back to it
+	if r.toolCalls != nil && !reqCtx.responseOverflow && reqCtx.ClientModel == "auto" && reqCtx.Model != "" {
+		if callIDs := responseToolCallIDs(responseBody); len(callIDs) > 0 {
+			reqCtx.routedMatch.Model = reqCtx.Model
+			r.toolCalls.record(callIDs, reqCtx.routedMatch)
+			reqCtx.log.Debug("Recorded tool calls", "tool_calls", len(callIDs))
 		}
+	}
 
-		// Initialize the classifier model if enabled
-		if categoryMapping != nil {
-			// Get the number of categories from the mapping
-			numClasses := len(categoryMapping.CategoryToIdx)
-			if numClasses < 2 {
-				log.Printf("Warning: Not enough categories for classification, need at least 2, got %d", numClasses)
-			} else {
-				// Use the same model or a specific classifier model
-				classifierModelID := cfg.Classifier.ModelID
-				if classifierModelID == "" {
-					classifierModelID = cfg.BertModel.ModelID
-				}
+	if reqCtx.responseOverflow {
+		reqCtx.log.Info("Response was not fully buffered, skipping scrubbing and cache update")
+		return nil, nil
+	}
 
-				err = candle_binding.InitClassifier(classifierModelID, numClasses, cfg.Classifier.UseCPU)
-				if err != nil {
-					return nil, fmt.Errorf("failed to initialize classifier model: %w", err)
+	// Scrub provider-identifying fields before the body is cached or returned. The
+	// body can only be replaced when it arrived as a single message.
+	var headerMutation *ext_proc.HeaderMutation
+	var bodyMutation *ext_proc.BodyMutation
+	if r.Config.ResponseScrubbing.Enabled && len(responseBody) > 0 {
+		scrub := scrubResponseBody
+		if reqCtx.responseStreamed {
+			scrub = scrubEventStream
+		}
+		if reqCtx.responseChunks > 1 {
+			reqCtx.log.Info("Response arrived in chunks, skipping scrubbing", "chunks", reqCtx.responseChunks)
+		} else if scrubbed, err := scrub(r.Config.ResponseScrubbing, responseBody, reqCtx.ClientModel); err != nil {
+			reqCtx.log.Error("Error scrubbing response body", "error", err)
+		} else {
+			if !reqCtx.responseStreamed {
+				completionBody = scrubbed
+			} else if completionBody != nil {
+				if completionBody, err = scrubResponseBody(r.Config.ResponseScrubbing, completionBody, reqCtx.ClientModel); err != nil {
+					reqCtx.log.Error("Error scrubbing assembled response", "error", err)
 				}
-				log.Printf("Initialized classifier with %d categories", numClasses)
+			}
+			bodyMutation = &ext_proc.BodyMutation{
+				Mutation: &ext_proc.BodyMutation_Body{Body: scrubbed},
+			}
+			headerMutation = &ext_proc.HeaderMutation{
+				RemoveHeaders: []string{"content-length"},
 			}
 		}
+	}
 
-		initialized = true
+	// Answer translated Messages API requests in their schema, also in the cache
+	if reqCtx.messagesTranslated && len(completionBody) > 0 {
+		translated, err := translateChatCompletion(completionBody, reqCtx.responseStatus)
+		if err == nil && reqCtx.responseStreamed {
+			completionBody = translated
+			translated, err = messagesEventStream(translated)
+		} else if err == nil {
+			completionBody = translated
+		}
+		switch {
+		case err != nil:
+			reqCtx.log.Error("Error translating chat completion to a message", "error", err)
+		case reqCtx.responseChunks > 1:
+			reqCtx.log.Warn("Response arrived in chunks, leaving it untranslated", "chunks", reqCtx.responseChunks)
+		default:
+			bodyMutation = &ext_proc.BodyMutation{
+				Mutation: &ext_proc.BodyMutation_Body{Body: translated},
+			}
+			headerMutation = &ext_proc.HeaderMutation{
+				RemoveHeaders: []string{"content-length"},
+			}
+		}
 	}
 
-	categoryDescriptions := cfg.GetCategoryDescriptions()
-	log.Printf("Category descriptions: %v", categoryDescriptions)
+	// Restore the PII tokenized in the request. The cache keeps the tokenized
+	// response, restored with the PII of each request it is returned for.
+	if reqCtx.piiTokens != nil && len(responseBody) > 0 {
+		if reqCtx.responseChunks > 1 {
+			reqCtx.log.Warn("Response arrived in chunks, leaving PII placeholders in place", "chunks", reqCtx.responseChunks)
+		} else {
+			body := responseBody
+			if bodyMutation != nil {
+				body = bodyMutation.GetBody()
+			}
+			bodyMutation = &ext_proc.BodyMutation{
+				Mutation: &ext_proc.BodyMutation_Body{Body: reqCtx.piiTokens.Detokenize(body)},
+			}
+			headerMutation = &ext_proc.HeaderMutation{
+				RemoveHeaders: []string{"content-length"},
+			}
+		}
+	}
 
-	// Create semantic cache with config options
-	cacheOptions := cache.SemanticCacheOptions{
-		SimilarityThreshold: cfg.GetCacheSimilarityThreshold(),
-		MaxEntries:          cfg.SemanticCache.MaxEntries,
-		TTLSeconds:          cfg.SemanticCache.TTLSeconds,
-		Enabled:             cfg.SemanticCache.Enabled,
+	// Attach the routing receipt to JSON responses. The cache keeps the
+	// response without it.
+	if reqCtx.receipt != "" && r.receiptPlacement() == config.ReceiptPlacementBody && !reqCtx.responseStreamed && len(responseBody) > 0 {
+		if reqCtx.responseChunks > 1 {
+			reqCtx.log.Warn("Response arrived in chunks, leaving the routing receipt out", "chunks", reqCtx.responseChunks)
+		} else {
+			body := responseBody
+			if bodyMutation != nil {
+				body = bodyMutation.GetBody()
+			}
+			if withReceipt, ok := addReceiptField(body, reqCtx.receipt); ok {
+				bodyMutation = &ext_proc.BodyMutation{
+					Mutation: &ext_proc.BodyMutation_Body{Body: withReceipt},
+				}
+				headerMutation = &ext_proc.HeaderMutation{
+					RemoveHeaders: []string{"content-length"},
+				}
+			}
+		}
 	}
-	semanticCache := cache.NewSemanticCache(cacheOptions)
 
-	if semanticCache.IsEnabled() {
-		log.Printf("Semantic cache enabled with threshold: %.4f, max entries: %d, TTL: %d seconds",
-			cacheOptions.SimilarityThreshold, cacheOptions.MaxEntries, cacheOptions.TTLSeconds)
-	} else {
-		log.Println("Semantic cache is disabled")
+	// If we have a pending request, update the cache
+	if cacheID != "" && errored {
+		reqCtx.log.Debug("Upstream returned an error, not caching the response")
+		r.releasePendingRequest(reqCtx)
+	} else if cacheID != "" && reqCtx.upstreamTTLSet && reqCtx.upstreamTTL == 0 {
+		reqCtx.log.Debug("Upstream marked the response as not cacheable")
+		r.releasePendingRequest(reqCtx)
+	} else if cacheID != "" && reqCtx.Query != "" && completionBody != nil {
+		// Completing the entry takes it out of the pending ones, whatever the outcome
+		reqCtx.CacheID = ""
+		err := r.Cache.UpdateWithResponseTTL(cacheID, completionBody, reqCtx.upstreamTTL)
+		r.leaks.release(leakKindCachePending, cacheID)
+		if errors.Is(err, cache.ErrWriteDropped) {
+			reqCtx.log.Debug("Response not cached", "reason", err)
+		} else if err != nil {
+			r.ErrorBudgets.Record(errorbudget.StageCache, err)
+			reqCtx.log.Error("Error updating cache", "error", err)
+			// Continue even if cache update fails
+		} else {
+			reqCtx.log.Debug("Cache updated")
+		}
 	}
 
-	return &OpenAIRouter{
-		Config:               cfg,
-		CategoryDescriptions: categoryDescriptions,
-		CategoryMapping:      categoryMapping,
-		Cache:                semanticCache,
-		pendingRequests:      make(map[string][]byte),
-	}, nil
+	return headerMutation, bodyMutation
 }
 
-// Send a response with proper error handling and logging
-func sendResponse(stream ext_proc.ExternalProcessor_ProcessServer, response *ext_proc.ProcessingResponse, msgType string) error {
-	// log.Printf("Sending %s response: %+v", msgType, response)
-	if err := stream.Send(response); err != nil {
-		log.Printf("Error sending %s response: %v", msgType, err)
-		return err
+// finalizePassthrough records metrics for the complete response to a request
+// that passed through without routing
+func (r *OpenAIRouter) finalizePassthrough(reqCtx *RequestContext) {
+	metrics.RecordPassthroughRequest(reqCtx.apiEndpoint, reqCtx.responseStatus, reqCtx.requestBytes, reqCtx.responseBytes, time.Since(reqCtx.StartTime).Seconds())
+	if reqCtx.apiEndpoint == apiEndpointBatches {
+		r.trackBatch(reqCtx.Headers, reqCtx.responseStatus, reqCtx.responseBuffer)
 	}
-	log.Printf("Successfully sent %s response", msgType)
-	return nil
 }
 
 // Process implements the ext_proc calls
 func (r *OpenAIRouter) Process(stream ext_proc.ExternalProcessor_ProcessServer) error {
-	log.Println("Started processing a new request")
-	requestHeaders := make(map[string]string)
-	var requestID string
-	var originalRequestBody []byte
-	var requestModel string
-	var requestQuery string
-	var startTime time.Time
-	var processingStartTime time.Time
+	slog.Debug("Started processing a new stream")
+	r.leaks.streamStarted()
+	defer r.leaks.streamEnded()
+	r.advertiseProcessor(stream.Context())
+	// Canary probes are neither recorded nor timed
+	if !isCanary(stream.Context()) {
+		var finishRecording func()
+		stream, finishRecording = r.Recordings.Record(stream)
+		defer finishRecording()
+		stream = &phaseTimedStream{ExternalProcessor_ProcessServer: stream}
+	}
+	if r.Config.Mode == RouterModeSpeculative {
+		return r.processSpeculatively(stream)
+	}
+	return r.process(stream, r.Config.Mode == RouterModeShadow)
+}
+
+// process runs the messages of a stream through the router, applying none of
+// its decisions in shadow mode
+func (r *OpenAIRouter) process(stream ext_proc.ExternalProcessor_ProcessServer, shadow bool) error {
+	reqCtx := newRequestContext()
+	reqCtx.canary = isCanary(stream.Context())
+	stream = &chunkedBodyStream{ExternalProcessor_ProcessServer: stream, reqCtx: reqCtx, maxBytes: r.maxRequestBufferBytes()}
+	if shadow {
+		reqCtx.shadow = true
+		stream = &shadowStream{ExternalProcessor_ProcessServer: stream, router: r, reqCtx: reqCtx}
+	}
+	defer r.releasePendingRequest(reqCtx)
+	defer r.streamBudget.release(reqCtx)
+	defer reqCtx.endTrace()
 
 	for {
 		req, err := stream.Recv()
 		if err != nil {
-			log.Printf("Error receiving request: %v", err)
+			reqCtx.log.Debug("Stream ended", "reason", err)
 			return err
 		}
 
-		log.Printf("Processing message type: %T", req.Request)
-
 		switch v := req.Request.(type) {
 		case *ext_proc.ProcessingRequest_RequestHeaders:
 			// Record start time for overall request processing
-			startTime = time.Now()
-			log.Println("Received request headers")
+			reqCtx.StartTime = time.Now()
+			slog.Debug("Received request headers")
 
 			// Store headers for later use
 			headers := v.RequestHeaders.Headers
 			for _, h := range headers.Headers {
-				requestHeaders[h.Key] = h.Value
+				value := h.Value
+				if value == "" {
+					value = string(h.RawValue)
+				}
+				reqCtx.Headers[strings.ToLower(h.Key)] = value
 				// Store request ID if present
 				if strings.ToLower(h.Key) == "x-request-id" {
-					requestID = h.Value
+					reqCtx.ID = value
+				}
+			}
+			reqCtx.startTrace(stream.Context())
+			headersSpan := reqCtx.startSpan(spanRequestHeaders)
+			reqCtx.apiEndpoint = r.apiPaths.passthroughEndpoint(reqCtx.Headers[":path"])
+			reqCtx.routedEndpoint = r.apiPaths.routedEndpoint(reqCtx.Headers[":path"])
+			r.streamBudget.reserve(reqCtx, headerBytes(headers.Headers), "request_headers")
+
+			// Give requests without an ID one, passing it upstream so logs of
+			// both sides can be correlated
+			var headerMutation *ext_proc.HeaderMutation
+			if reqCtx.ensureID(r.random.newID) {
+				slog.Debug("Request has no x-request-id, generated one", "request_id", reqCtx.ID)
+				headerMutation = &ext_proc.HeaderMutation{
+					SetHeaders: []*core.HeaderValueOption{
+						{
+							Header: &core.HeaderValue{
+								Key:      "x-request-id",
+								RawValue: []byte(reqCtx.ID),
+							},
+						},
+					},
 				}
 			}
+			headerMutation = stripDestinationEndpoint(headerMutation)
+			reqCtx.log = slog.With("request_id", reqCtx.ID)
+			if err := r.checkRequiredCapabilities(req); err != nil {
+				reqCtx.log.Warn("Refusing stream", "error", err)
+				headersSpan.End()
+				return err
+			}
 
 			// Allow the request to continue
 			response := &ext_proc.ProcessingResponse{
 				Response: &ext_proc.ProcessingResponse_RequestHeaders{
 					RequestHeaders: &ext_proc.HeadersResponse{
 						Response: &ext_proc.CommonResponse{
-							Status: ext_proc.CommonResponse_CONTINUE,
+							Status:         ext_proc.CommonResponse_CONTINUE,
+							HeaderMutation: headerMutation,
 						},
 					},
 				},
+				DynamicMetadata: r.processorMetadata(),
 			}
 
+			headersSpan.End()
 			if err := sendResponse(stream, response, "header"); err != nil {
 				return err
 			}
 
 		case *ext_proc.ProcessingRequest_RequestBody:
-			log.Println("Received request body")
+			reqCtx.log.Debug("Received request body")
+			if reqCtx.apiEndpoint != "" {
+				// Only chat, legacy completions and embeddings requests are
+				// classified; the prompts of a batch, for one, are in its input file
+				reqCtx.log.Info("Passing request through", "endpoint", reqCtx.apiEndpoint)
+				reqCtx.requestBytes += len(v.RequestBody.Body)
+				response := &ext_proc.ProcessingResponse{
+					Response: &ext_proc.ProcessingResponse_RequestBody{
+						RequestBody: &ext_proc.BodyResponse{
+							Response: &ext_proc.CommonResponse{
+								Status: ext_proc.CommonResponse_CONTINUE,
+							},
+						},
+					},
+				}
+				if err := sendResponse(stream, response, "passthrough request body"); err != nil {
+					return err
+				}
+				continue
+			}
+			if !r.streamBudget.reserve(reqCtx, len(v.RequestBody.Body), "request_body") {
+				// Too large to process within the byte limits, forward it as is
+				response := &ext_proc.ProcessingResponse{
+					Response: &ext_proc.ProcessingResponse_RequestBody{
+						RequestBody: &ext_proc.BodyResponse{
+							Response: &ext_proc.CommonResponse{
+								Status: ext_proc.CommonResponse_CONTINUE,
+							},
+						},
+					},
+				}
+				if err := sendResponse(stream, response, "oversized request body"); err != nil {
+					return err
+				}
+				continue
+			}
 			// Record start time for model routing
-			processingStartTime = time.Now()
+			reqCtx.ProcessingStartTime = time.Now()
+			budget := r.newDecisionBudget(reqCtx.ProcessingStartTime)
 			// Save the original request body
-			originalRequestBody = v.RequestBody.Body
+			reqCtx.OriginalBody = v.RequestBody.Body
 
 			// Parse the OpenAI request
-			openAIRequest, err := parseOpenAIRequest(originalRequestBody)
+			parseSpan := reqCtx.startSpan(spanParseBody, attribute.Int("request.body_bytes", len(reqCtx.OriginalBody)))
+			openAIRequest, err := parseRoutedRequest(reqCtx.routedEndpoint, reqCtx.OriginalBody)
+			endSpan(parseSpan, err)
 			if err != nil {
-				log.Printf("Error parsing OpenAI request: %v", err)
+				reqCtx.log.Warn("Error parsing OpenAI request", "error", err)
 				return status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
 			}
 
 			// Store the original model
 			originalModel := openAIRequest.Model
-			log.Printf("Original model: %s", originalModel)
+			reqCtx.ClientModel = originalModel
+			if openAIRequest.endpoint != "" {
+				reqCtx.log = reqCtx.log.With("endpoint", openAIRequest.endpoint)
+			}
+			reqCtx.log.Debug("Parsed request", "original_model", originalModel)
+
+			reqCtx.record = decision.New(reqCtx.ID)
+			reqCtx.embeddings = embeddings.NewSet()
+			reqCtx.record.Attempt = 1
+			reqCtx.record.Shadow = reqCtx.shadow
+			reqCtx.record.Routing.OriginalModel = originalModel
+			if reqCtx.tags = requestTags(r.Config.RequestTags, reqCtx.Headers); reqCtx.tags != nil {
+				reqCtx.record.Labels = reqCtx.tags
+				reqCtx.log = reqCtx.log.With("tags", reqCtx.tags)
+			}
 
-			// Record the initial request to this model
-			metrics.RecordModelRequest(originalModel)
+			// Resolve the routing policies restricting the models the request may use
+			policies, policyScope := r.requestPolicies(reqCtx.Headers, reqCtx.record)
+			policyOutcomes := make(map[string]string)
+
+			// Reject clients that used up a token budget until it frees up. Usage is
+			// counted while the rate limit stage is off, so budgets stay accurate.
+			if r.TokenBudgets != nil {
+				reqCtx.budgetIdentity = reqCtx.Headers[strings.ToLower(r.Config.TokenBudgets.IdentityHeader)]
+			}
+			if reqCtx.budgetIdentity != "" && r.stageApplies(flags.StageRateLimit, reqCtx.ID, reqCtx.stageCohorts) {
+				if exceeded := r.TokenBudgets.Check(reqCtx.budgetIdentity); exceeded != nil {
+					reqCtx.log.Info("Rejecting request, client is over its token budget", "period", exceeded.Period,
+						"budget", exceeded.Limit, "used", exceeded.Used, "retry_after", exceeded.RetryAfter)
+					metrics.RecordTokenBudgetRejection(exceeded.Period)
+					reqCtx.record.ResponseStatus = http.StatusTooManyRequests
+					reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+					r.writeDecision(reqCtx)
+					if err := sendResponse(stream, tokenBudgetResponse(exceeded), "token budget rejection"); err != nil {
+						return err
+					}
+					return nil
+				}
+			}
+
+			// Apply the routing policy of the tenant, rejecting tenants over their budget
+			if reqCtx.tenant = r.tenants.resolve(reqCtx.Headers); reqCtx.tenant != nil {
+				if reqCtx.record.Routing.Tenant == "" {
+					reqCtx.record.Routing.Tenant = reqCtx.tenant.Name
+				}
+				if exceeded := r.tenants.checkBudget(reqCtx.tenant); exceeded != nil && r.stageApplies(flags.StageRateLimit, reqCtx.ID, reqCtx.stageCohorts) {
+					reqCtx.log.Info("Rejecting request, tenant is over its token budget", "tenant", reqCtx.tenant.Name,
+						"period", exceeded.Period, "budget", exceeded.Limit, "used", exceeded.Used, "retry_after", exceeded.RetryAfter)
+					metrics.RecordTenantPolicyRequest(reqCtx.tenant.Name, tenantBudgetExceeded)
+					reqCtx.record.ResponseStatus = http.StatusTooManyRequests
+					reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+					r.writeDecision(reqCtx)
+					if err := sendResponse(stream, tokenBudgetResponse(exceeded), "tenant token budget rejection"); err != nil {
+						return err
+					}
+					return nil
+				}
+				metrics.RecordTenantPolicyRequest(reqCtx.tenant.Name, tenantAdmitted)
+			}
+
+			// Apply the routing overrides the client asked for and the config allows
+			overrides, err := r.requestOverrides(reqCtx.Headers)
+			if err != nil {
+				reqCtx.log.Info("Rejecting request with an invalid routing override", "error", err)
+				reqCtx.record.ResponseStatus = http.StatusBadRequest
+				reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+				r.writeDecision(reqCtx)
+				if err := sendResponse(stream, overrideErrorResponse(err), "routing override rejection"); err != nil {
+					return err
+				}
+				return nil
+			}
+			reqCtx.record.Routing.Overrides = overrides.names()
+
+			// Recognize the application by its system prompt to apply its profile
+			app := r.applications.match(openAIRequest)
+			if app != nil {
+				reqCtx.record.Routing.Application = app.Name
+				if app.RequestsPerMinute > 0 && !reqCtx.canary && r.stageApplies(flags.StageRateLimit, reqCtx.ID, reqCtx.stageCohorts) && !r.appQuotas.admit(app, time.Now()) {
+					reqCtx.log.Info("Rejecting request, application is over its quota", "application", app.Name, "requests_per_minute", app.RequestsPerMinute)
+					metrics.RecordApplicationRequest(app.Name, applicationQuotaExceeded)
+					reqCtx.record.ResponseStatus = http.StatusTooManyRequests
+					reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+					r.writeDecision(reqCtx)
+					if err := sendResponse(stream, applicationQuotaResponse(app), "application quota rejection"); err != nil {
+						return err
+					}
+					return nil
+				}
+				if !reqCtx.canary {
+					metrics.RecordApplicationRequest(app.Name, applicationAdmitted)
+				}
+			}
+
+			// Block or redact PII before the request is cached, classified or routed
+			piiRedacted := false
+			if r.PII != nil && !r.ErrorBudgets.Allow(errorbudget.StagePII) {
+				reqCtx.log.Warn("PII detection over its error budget, letting the request through unscanned")
+			} else if r.PII != nil && r.stageApplies(flags.StagePII, reqCtx.ID, reqCtx.stageCohorts) {
+				outcome, err := r.scanRequestPII(openAIRequest, reqCtx.OriginalBody, reqCtx.record.Routing.Tenant)
+				r.ErrorBudgets.Record(errorbudget.StagePII, err)
+				var response *ext_proc.ProcessingResponse
+				if err != nil && !r.Config.PII.FailOpen {
+					reqCtx.log.Error("Rejecting request, PII detection failed", "error", err)
+					response = piiUnavailableResponse()
+					reqCtx.record.ResponseStatus = http.StatusServiceUnavailable
+				} else if err != nil {
+					reqCtx.log.Error("PII detection failed, letting the request through unscanned", "error", err)
+				} else if len(outcome.blocked) > 0 {
+					reqCtx.log.Info("Blocking request containing PII", "types", outcome.blocked)
+					response = piiBlockResponse(outcome.blocked)
+					reqCtx.record.Routing.PolicyViolation = "request contains " + strings.Join(outcome.blocked, ", ")
+					reqCtx.record.ResponseStatus = http.StatusForbidden
+				} else if outcome.body != nil {
+					reqCtx.log.Info("Redacted PII from request")
+					reqCtx.OriginalBody = outcome.body
+					reqCtx.piiTokens = outcome.tokens
+					piiRedacted = true
+				}
+				if response != nil {
+					reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+					r.writeDecision(reqCtx)
+					if err := sendResponse(stream, response, "PII rejection"); err != nil {
+						return err
+					}
+					return nil
+				}
+			}
 
-			// Get content from messages
-			var userContent string
-			var nonUserMessages []string
+			// Logged after redaction, so redacted PII stays out of the logs
+			if r.Config.Logging.LogPayloads {
+				reqCtx.log.Debug("Request payload", "body", string(reqCtx.OriginalBody))
+			}
+
+			// Reject jailbreak and prompt injection attempts
+			if r.promptGuard != nil && !r.ErrorBudgets.Allow(errorbudget.StagePromptGuard) {
+				reqCtx.log.Warn("Prompt guard over its error budget, letting the request through unchecked")
+			} else if r.promptGuard != nil && r.stageApplies(flags.StagePromptGuard, reqCtx.ID, reqCtx.stageCohorts) {
+				detection, detected, err := r.promptGuard.check(openAIRequest)
+				r.ErrorBudgets.Record(errorbudget.StagePromptGuard, err)
+				var response *ext_proc.ProcessingResponse
+				var statusCode int
+				if err != nil && !r.Config.PromptGuard.FailOpen {
+					reqCtx.log.Error("Rejecting request, prompt guard failed", "error", err)
+					response, statusCode = promptGuardUnavailableResponse.render(blockVariables{RequestID: reqCtx.ID}, promptGuardUnavailableResponse)
+				} else if err != nil {
+					reqCtx.log.Error("Prompt guard failed, letting the request through unchecked", "error", err)
+				} else if detected {
+					reqCtx.log.Info("Rejecting request as a possible prompt attack", "label", detection.Label, "confidence", detection.Confidence)
+					metrics.RecordPromptGuardDetection(detection.Label)
+					response, statusCode = r.promptGuard.response.render(blockVariables{
+						Category:  detection.Label,
+						RequestID: reqCtx.ID,
+						Tenant:    reqCtx.record.Routing.Tenant,
+						Model:     originalModel,
+					}, defaultPromptGuardResponse)
+					reqCtx.record.Routing.PolicyViolation = fmt.Sprintf("prompt guard detected %s (confidence %.4f)", detection.Label, detection.Confidence)
+				}
+				if response != nil {
+					reqCtx.record.ResponseStatus = int32(statusCode)
+					reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+					r.writeDecision(reqCtx)
+					if err := sendResponse(stream, response, "prompt guard rejection"); err != nil {
+						return err
+					}
+					return nil
+				}
+			}
 
-			for _, msg := range openAIRequest.Messages {
-				if msg.Role == "user" {
-					userContent = msg.Content
-				} else if msg.Role != "" {
-					nonUserMessages = append(nonUserMessages, msg.Content)
+			// Detect retries of the same request so they are not double counted;
+			// retries of requests without an ID get a new one each time
+			isRetry := false
+			if !reqCtx.GeneratedID && !reqCtx.canary {
+				reqCtx.attemptKey = reqCtx.ID + ":" + cache.IdempotencyKey(originalModel, reqCtx.OriginalBody)
+				attempt := r.attempts.begin(reqCtx.attemptKey)
+				if envoyAttempt, err := strconv.Atoi(reqCtx.Headers["x-envoy-attempt-count"]); err == nil && envoyAttempt > attempt {
+					attempt = envoyAttempt
 				}
+				reqCtx.record.Attempt = int32(attempt)
+				if attempt > 1 {
+					isRetry = true
+					reqCtx.log.Info("Request is a retry", "attempt", attempt)
+					metrics.RecordRequestRetry(originalModel)
+				}
+			}
+
+			// Record the initial request to this model
+			if !isRetry && !reqCtx.canary {
+				metrics.RecordModelRequest(originalModel)
 			}
 
+			// Get content from messages, classifying a copy of the request without
+			// system prompt boilerplate
+			classificationRequest := r.boilerplate.classificationRequest(openAIRequest)
+			userContent, nonUserMessages := extractMessageContents(classificationRequest)
+			reqCtx.estimatedPromptTokens = estimatePromptTokens(openAIRequest)
+			// Turns returning tool output share the last user message with the turn
+			// that made the tool call, so they must not be answered from the cache
+			reqCtx.toolResultTurn = isToolResultTurn(openAIRequest)
+
 			// Extract the model and query for cache lookup
-			requestModel, requestQuery, err = cache.ExtractQueryFromOpenAIRequest(originalRequestBody)
+			// The body was unmarshalled above, so only these paths are decoded again
+			reqCtx.Model, reqCtx.Query, err = extractCacheQuery(openAIRequest, reqCtx.OriginalBody)
+			// Responses for requests under routing policies are cached apart, so they
+			// are never served a response produced by a model the policies do not allow
+			cacheModel := reqCtx.Model
+			if overrides.pinnedModel != "" {
+				// Pinned requests are cached with requests naming the model themselves
+				cacheModel = overrides.pinnedModel
+			}
+			if policyScope != "" {
+				cacheModel += "@" + policyScope
+			}
+			if app != nil && app.CachePartition != "" {
+				cacheModel += "#" + app.CachePartition
+			}
+			if reqCtx.tenant != nil {
+				// Tenants are never answered with each other's responses
+				cacheModel += "~" + reqCtx.tenant.Name
+			}
+			if openAIRequest.endpoint != "" {
+				// Legacy completions and messages are not answered with chat completions
+				cacheModel = openAIRequest.endpoint + ":" + cacheModel
+			}
 			if err != nil {
-				log.Printf("Error extracting query from request: %v", err)
+				reqCtx.log.Warn("Error extracting query from request", "error", err)
 				// Continue without caching
-			} else if requestQuery != "" && r.Cache.IsEnabled() {
+			} else if reqCtx.toolResultTurn {
+				reqCtx.log.Debug("Request returns tool output, skipping cache")
+			} else if overrides.skipsCache() {
+				reqCtx.log.Debug("Client bypasses the cache, skipping cache")
+			} else if reqCtx.tenant != nil && reqCtx.tenant.DisableCache {
+				reqCtx.log.Debug("Tenant does not use the cache, skipping cache")
+			} else if openAIRequest.Stream && !r.Config.Streaming.ReplayCachedAsSSE {
+				reqCtx.log.Debug("Request asks for a stream, skipping cache")
+			} else if reqCtx.Query != "" && r.Cache.IsEnabled() && reqCtx.Headers[canary.Header] == "" && r.stageApplies(flags.StageCache, reqCtx.ID, reqCtx.stageCohorts) && budget.allows(costCacheLookup, DegradedCacheLookup) {
 				// Try to find a similar cached response
-				cachedResponse, found, err := r.Cache.FindSimilar(requestModel, requestQuery)
+				lookupStart := time.Now()
+				lookupSpan := reqCtx.startSpan(spanCacheLookup, attribute.String("llm.model", cacheModel))
+				cachedEntry, found, err := r.Cache.FindSimilarEntry(cacheModel, reqCtx.Query, reqCtx.embeddings)
+				var cachedResponse []byte
+				if found {
+					cachedResponse = cachedEntry.ResponseBody
+				}
+				if faultErr := r.faults.cacheError(); faultErr != nil {
+					cachedResponse, found, err = nil, false, faultErr
+				}
+				lookupSpan.SetAttributes(attribute.Bool("cache.hit", found))
+				endSpan(lookupSpan, err)
+				r.ErrorBudgets.Record(errorbudget.StageCache, err)
+				contentType := "application/json"
+				if err == nil && found && openAIRequest.Stream {
+					// Replay the cached completion as the stream the client asked for
+					includeUsage := openAIRequest.StreamOptions != nil && openAIRequest.StreamOptions.IncludeUsage
+					if streamed, streamErr := streamCompletion(cachedResponse, includeUsage); streamErr != nil {
+						reqCtx.log.Error("Error replaying cached response as a stream", "error", streamErr)
+						found = false
+					} else {
+						cachedResponse = streamed
+						contentType = eventStreamContentType
+					}
+				}
 				if err != nil {
-					log.Printf("Error searching cache: %v", err)
+					reqCtx.log.Error("Error searching cache", "error", err)
 				} else if found {
-					log.Printf("Cache hit! Returning cached response for query: %s", requestQuery)
+					reqCtx.log.Info("Cache hit, returning cached response")
+					cachedResponse = reqCtx.piiTokens.Detokenize(cachedResponse)
+					budget.observe(costCacheLookup, lookupStart)
 
 					// Return immediate response from cache
 					immediateResponse := &ext_proc.ImmediateResponse{
@@ -241,7 +1841,7 @@ func (r *OpenAIRouter) Process(stream ext_proc.ExternalProcessor_ProcessServer)
 								{
 									Header: &core.HeaderValue{
 										Key:   "content-type",
-										Value: "application/json",
+										Value: contentType,
 									},
 								},
 								{
@@ -261,119 +1861,552 @@ func (r *OpenAIRouter) Process(stream ext_proc.ExternalProcessor_ProcessServer)
 						},
 					}
 
+					metrics.RecordRequestBodySize(reqCtx.Model, len(reqCtx.OriginalBody))
+					reqCtx.record.CacheHit = true
+					reqCtx.record.Routing.SelectedModel = reqCtx.Model
+					reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+					r.writeDecision(reqCtx)
+					r.trackFeedback(reqCtx, cachedEntry.ID)
+					recordStageCohorts(reqCtx.stageCohorts, time.Since(reqCtx.ProcessingStartTime), false)
+
 					if err := sendResponse(stream, response, "immediate response from cache"); err != nil {
 						return err
 					}
 					return nil
 				}
 
-				// Cache miss, store the request for later
-				cacheID, err := r.Cache.AddPendingRequest(requestModel, requestQuery, originalRequestBody)
-				if err != nil {
-					log.Printf("Error adding pending request to cache: %v", err)
-				} else {
-					r.pendingRequestsLock.Lock()
-					r.pendingRequests[requestID] = []byte(cacheID)
-					r.pendingRequestsLock.Unlock()
-					log.Printf("Added pending request with ID: %s, cacheID: %s", requestID, cacheID)
+				// Cache miss, store the request for later
+				cacheID, err := r.Cache.AddPendingRequestWithEmbeddings(cacheModel, reqCtx.Query, reqCtx.OriginalBody, reqCtx.embeddings)
+				if faultErr := r.faults.cacheError(); faultErr != nil && err == nil {
+					r.Cache.RemovePendingRequest(cacheID)
+					err = faultErr
+				}
+				budget.observe(costCacheLookup, lookupStart)
+				if err != nil {
+					reqCtx.log.Error("Error adding pending request to cache", "error", err)
+				} else {
+					reqCtx.CacheID = cacheID
+					r.leaks.track(leakKindCachePending, cacheID)
+					reqCtx.log.Debug("Added pending request to cache", "cache_id", cacheID)
+				}
+			}
+
+			// Mutations applied to the request, if any
+			var headerMutation *ext_proc.HeaderMutation
+			var bodyMutation *ext_proc.BodyMutation
+			clearRouteCache := false
+
+			// Routing decision details exposed to Envoy as dynamic metadata
+			decisionMetadata := make(map[string]interface{})
+
+			// Only change the model if the original model is "auto"
+			actualModel := originalModel
+			if overrides.bypass {
+				reqCtx.log.Info("Client bypasses routing, forwarding the request as sent")
+			} else if originalModel == "auto" && (len(nonUserMessages) > 0 || userContent != "") {
+				// Sample very long text down to the classification budget
+				classificationText, budgetStrategy := applyClassificationBudget(r.Config.ClassificationBudget, classificationRequest, classificationInput(userContent, nonUserMessages))
+				decisionMetadata["classification_strategy"] = budgetStrategy
+				reqCtx.record.Routing.ClassificationStrategy = budgetStrategy
+				if budgetStrategy != BudgetStrategyFull {
+					reqCtx.log.Debug("Classification text sampled", "strategy", budgetStrategy)
+				}
+				// Detect the language picking the utterances and model queries
+				// are matched with
+				if reqCtx.language = langdetect.Detect(classificationText); reqCtx.language != "" {
+					decisionMetadata["language"] = reqCtx.language
+					reqCtx.log.Debug("Detected the request's language", "language", reqCtx.language)
+				}
+
+				if classificationText != "" {
+					// Find the most similar task description or classify, unless
+					// classification is switched off and everything goes to the default model
+					match := categoryMatch{Model: reqCtx.tenant.defaultModel(r.Config.DefaultModel)}
+					if overrides.pinnedModel != "" {
+						reqCtx.log.Info("Routing request to the model the client pinned", "pinned_model", overrides.pinnedModel)
+						match = categoryMatch{Model: overrides.pinnedModel}
+					} else if pinned, pinnedFound := r.pinnedToolCallModel(reqCtx.toolResultTurn, openAIRequest, policies); pinnedFound {
+						reqCtx.log.Info("Request returns tool output, keeping the model that made the tool call", "pinned_model", pinned.Model)
+						match = pinned
+						reqCtx.record.Routing.ToolResultPinned = true
+					} else if model := r.applicationModel(app); model != "" {
+						reqCtx.log.Info("Routing request to its application's model", "application", app.Name, "application_model", model)
+						match = categoryMatch{Model: model}
+					} else if r.stageApplies(flags.StageClassification, reqCtx.ID, reqCtx.stageCohorts) && budget.allows(costClassify, DegradedClassification) {
+						classifySpan := reqCtx.startSpan(spanClassify, attribute.String("routing.strategy", r.Config.GetRoutingStrategy()))
+						match = r.findBestModelMatch(reqCtx.log, classificationText, reqCtx.language, reqCtx.embeddings, budget, reqCtx.canary)
+						match = reqCtx.tenant.match(r.applyTrafficSplit(reqCtx, match), policies)
+						match = r.sessionMatch(reqCtx, openAIRequest, match)
+						classifySpan.SetAttributes(
+							attribute.String("llm.category", match.Category),
+							attribute.Float64("routing.confidence", float64(match.Confidence)))
+						classifySpan.End()
+						if match.Category == "" && !reqCtx.canary {
+							r.Discovery.Observe(classificationText)
+						}
+					}
+					reqCtx.routedMatch = match
+					matchedModel, matchedCategory := match.Model, match.Category
+					reqCtx.record.Routing.Category = matchedCategory
+					reqCtx.record.Routing.Confidence = match.Confidence
+					reqCtx.record.Routing.RunnerUpCategory = match.RunnerUp
+					reqCtx.record.Routing.RunnerUpConfidence = match.RunnerUpConfidence
+					if excerptChars := r.Config.DecisionRecords.PromptExcerptChars; excerptChars > 0 {
+						excerpt := []rune(classificationText)
+						if len(excerpt) > excerptChars {
+							excerpt = excerpt[:excerptChars]
+						}
+						reqCtx.record.PromptExcerpt = string(excerpt)
+					}
+
+					// Answer requests of blocked categories instead of routing them
+					if r.categoryBlocked(matchedCategory, reqCtx.record.Routing.Tenant) {
+						reqCtx.log.Info("Blocking request about a blocked category", "category", matchedCategory)
+						response, statusCode := r.blockResponses.render(blockVariables{
+							Category:  matchedCategory,
+							RequestID: reqCtx.ID,
+							Tenant:    reqCtx.record.Routing.Tenant,
+							Model:     originalModel,
+						})
+						if !reqCtx.canary {
+							metrics.RecordCategoryBlocked(matchedCategory)
+						}
+						reqCtx.record.Routing.PolicyViolation = fmt.Sprintf("category %s is blocked", matchedCategory)
+						reqCtx.record.ResponseStatus = int32(statusCode)
+						reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+						r.writeDecision(reqCtx)
+						r.releasePendingRequest(reqCtx)
+						if err := sendResponse(stream, response, "category block"); err != nil {
+							return err
+						}
+						return nil
+					}
+
+					// Fall back to the best ranked model the request's policies allow
+					if violation := policies.Check(matchedModel); violation != nil {
+						if allowedModel, ok := policies.FirstAllowed(r.Config.GetCandidateModelsForCategory(matchedCategory)); ok {
+							reqCtx.log.Info("Routing to an allowed model instead", "allowed_model", allowedModel, "reason", violation.Reason)
+							policyOutcomes[violation.Policy] = "rerouted"
+							matchedModel = allowedModel
+						}
+					}
+
+					// Fall back from a model whose backend failed an earlier attempt,
+					// or whose circuit is open
+					var failed []string
+					if isRetry {
+						failed = r.attempts.failed(reqCtx.attemptKey)
+					}
+					reason := ""
+					if slices.Contains(failed, matchedModel) {
+						reason = fallbackUpstreamError
+					} else if !r.Breakers.Allow(matchedModel) {
+						reason = fallbackCircuitOpen
+					}
+					if reason != "" {
+						if fallback, ok := r.fallbackModel(matchedCategory, append(failed, matchedModel), policies); ok {
+							reqCtx.log.Info("Falling back to another model", "unavailable_model", matchedModel, "fallback_model", fallback, "reason", reason)
+							if !reqCtx.canary {
+								metrics.RecordModelFallback(matchedModel, fallback, reason)
+							}
+							decisionMetadata["fallback_from"] = matchedModel
+							decisionMetadata["fallback_reason"] = reason
+							matchedModel = fallback
+						}
+					}
+
+					// Send requests exceeding the model's context window to a model they fit
+					if tokens := r.contextTokens(openAIRequest, reqCtx.OriginalBody); tokens > 0 && !r.fitsContext(matchedModel, tokens) {
+						if longContext, ok := r.contextFitModel(matchedModel, matchedCategory, tokens, policies); ok {
+							reqCtx.log.Info("Request exceeds the model's context window, routing to a model it fits",
+								"exceeded_model", matchedModel, "long_context_model", longContext, "tokens", tokens)
+							decisionMetadata["context_redirected_from"] = matchedModel
+							matchedModel = longContext
+						} else {
+							reqCtx.log.Warn("Request exceeds the model's context window and no model is known to fit it",
+								"exceeded_model", matchedModel, "tokens", tokens, "context_window", r.Config.GetModelContextWindow(matchedModel))
+						}
+					}
+
+					if group := r.trafficGroup(matchedCategory, matchedModel); group != "" {
+						decisionMetadata["traffic_group"] = group
+					}
+
+					rerouted := matchedModel != originalModel && matchedModel != ""
+					if rerouted && !r.stageApplies(flags.StageMutation, reqCtx.ID, reqCtx.stageCohorts) {
+						reqCtx.log.Info("Request mutation not applied, not rewriting the model", "original_model", originalModel, "matched_model", matchedModel)
+					} else if rerouted {
+						reqCtx.log.Info("Routing to model", "matched_model", matchedModel, "category", matchedCategory)
+
+						// Track the model routing change
+						if !isRetry && !reqCtx.canary {
+							metrics.RecordModelRouting(originalModel, matchedModel)
+						}
+
+						// Update the actual model that will be used
+						actualModel = matchedModel
+
+						// Modify the model in the request and serialize it
+						modifiedBody, err := r.rewriteForModel(reqCtx, openAIRequest, matchedModel, matchedCategory)
+						if err != nil {
+							return err
+						}
+
+						// Create body mutation with the modified body
+						bodyMutation = &ext_proc.BodyMutation{
+							Mutation: &ext_proc.BodyMutation_Body{
+								Body: modifiedBody,
+							},
+						}
+
+						// Also create a header mutation to remove the original content-length
+						headerMutation = &ext_proc.HeaderMutation{
+							RemoveHeaders: []string{"content-length"},
+						}
+
+					}
+				}
+			}
+
+			reqCtx.record.Routing.BudgetDegraded = budget.Degraded()
+
+			// Move traffic off deprecated models on their schedule, and keep it
+			// off retired ones
+			now := time.Now()
+			if deprecation, deprecated := r.Config.GetModelDeprecation(actualModel, now); deprecated {
+				deprecatedModel := actualModel
+				reqCtx.deprecation = &deprecation
+				retired := deprecation.Retired(now)
+				outcome := DeprecationServed
+				switch {
+				case retired && deprecation.Replacement == "":
+					reqCtx.log.Info("Rejecting request for a retired model", "model", deprecatedModel, "sunset", deprecation.Sunset)
+					if !reqCtx.canary {
+						metrics.RecordModelDeprecation(deprecatedModel, DeprecationRejected)
+					}
+					reqCtx.record.Routing.SelectedModel = deprecatedModel
+					reqCtx.record.ResponseStatus = http.StatusGone
+					reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+					r.writeDecision(reqCtx)
+					r.releasePendingRequest(reqCtx)
+					if err := sendResponse(stream, retiredModelResponse(deprecatedModel, deprecation), "retired model"); err != nil {
+						return err
+					}
+					return nil
+				case (retired || !overrides.bypass) && deprecationBucket(deprecatedModel, reqCtx.ID) < deprecation.ShiftedShare(now) &&
+					r.stageApplies(flags.StageMutation, reqCtx.ID, reqCtx.stageCohorts):
+					reqCtx.log.Info("Moving request off a deprecated model", "deprecated_model", deprecatedModel, "replacement", deprecation.Replacement)
+					outcome = DeprecationShifted
+					actualModel = deprecation.Replacement
+					modifiedBody, err := r.rewriteForModel(reqCtx, openAIRequest, actualModel, reqCtx.record.Routing.Category)
+					if err != nil {
+						return err
+					}
+					bodyMutation = &ext_proc.BodyMutation{
+						Mutation: &ext_proc.BodyMutation_Body{Body: modifiedBody},
+					}
+					if headerMutation == nil {
+						headerMutation = &ext_proc.HeaderMutation{}
+					}
+					if !slices.Contains(headerMutation.RemoveHeaders, "content-length") {
+						headerMutation.RemoveHeaders = append(headerMutation.RemoveHeaders, "content-length")
+					}
+				}
+				if !reqCtx.canary {
+					metrics.RecordModelDeprecation(deprecatedModel, outcome)
+				}
+			}
+
+			// Forward the redacted request even when it is not rerouted
+			if piiRedacted && bodyMutation == nil {
+				bodyMutation = &ext_proc.BodyMutation{
+					Mutation: &ext_proc.BodyMutation_Body{
+						Body: reqCtx.OriginalBody,
+					},
+				}
+				headerMutation = &ext_proc.HeaderMutation{
+					RemoveHeaders: []string{"content-length"},
+				}
+			}
+
+			// Reject requests that no model allowed by their policies can serve
+			if violation := policies.Check(actualModel); violation != nil {
+				reqCtx.log.Info("Denying request by policy", "policy", violation.Policy, "reason", violation.Reason)
+				policyOutcomes[violation.Policy] = "denied"
+				if !reqCtx.canary {
+					recordPolicyOutcomes(policies, policyOutcomes)
+				}
+				reqCtx.record.Routing.SelectedModel = actualModel
+				reqCtx.record.Routing.PolicyViolation = violation.Reason
+				reqCtx.record.ResponseStatus = int32(violation.Status)
+				reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+				r.writeDecision(reqCtx)
+				r.releasePendingRequest(reqCtx)
+				if err := sendResponse(stream, policyDenialResponse(violation.Status, violation.Reason), "policy denial"); err != nil {
+					return err
+				}
+				return nil
+			}
+			if !reqCtx.canary {
+				recordPolicyOutcomes(policies, policyOutcomes)
+			}
+
+			// Keep the tenant's requests from generating past its token cap
+			if limit := r.Residency.PolicyFor(reqCtx.record.Routing.Tenant).TokenLimit(); limit > 0 && openAIRequest.endpoint != apiEndpointEmbeddings {
+				body := reqCtx.OriginalBody
+				if bodyMutation != nil {
+					body = bodyMutation.GetBody()
+				}
+				capped, action, err := capMaxTokens(reqCtx.OriginalBody, body, limit)
+				if err != nil {
+					reqCtx.log.Error("Error capping max_tokens", "error", err)
+				} else if action != "" {
+					reqCtx.log.Info("Capped max_tokens to the tenant's limit", "tenant", reqCtx.record.Routing.Tenant, "max_tokens", limit, "action", action)
+					metrics.RecordMaxTokensCapped(reqCtx.record.Routing.Tenant, action)
+					reqCtx.record.Routing.MaxTokensCap = int32(limit)
+					bodyMutation = &ext_proc.BodyMutation{
+						Mutation: &ext_proc.BodyMutation_Body{Body: capped},
+					}
+					if headerMutation == nil {
+						headerMutation = &ext_proc.HeaderMutation{}
+					}
+					if !slices.Contains(headerMutation.RemoveHeaders, "content-length") {
+						headerMutation.RemoveHeaders = append(headerMutation.RemoveHeaders, "content-length")
+					}
+				}
+			}
+
+			// Translate Messages API requests for backends serving chat completions
+			if openAIRequest.endpoint == apiEndpointMessages && r.translatesMessages(actualModel) {
+				body := reqCtx.OriginalBody
+				if bodyMutation != nil {
+					body = bodyMutation.GetBody()
+				}
+				translated, err := translateMessagesRequest(body)
+				if err != nil {
+					reqCtx.log.Warn("Error translating Messages API request", "error", err)
+					return status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+				}
+				reqCtx.log.Debug("Translated Messages API request to a chat completion", "selected_model", actualModel)
+				reqCtx.messagesTranslated = true
+				bodyMutation = &ext_proc.BodyMutation{
+					Mutation: &ext_proc.BodyMutation_Body{Body: translated},
+				}
+				if headerMutation == nil {
+					headerMutation = &ext_proc.HeaderMutation{}
+				}
+				if !slices.Contains(headerMutation.RemoveHeaders, "content-length") {
+					headerMutation.RemoveHeaders = append(headerMutation.RemoveHeaders, "content-length")
+				}
+				headerMutation.SetHeaders = append(headerMutation.SetHeaders, &core.HeaderValueOption{
+					Header: &core.HeaderValue{Key: ":path", RawValue: []byte(translatedPath(reqCtx.Headers[":path"]))},
+				})
+				clearRouteCache = true
+			}
+
+			// Set the model's parameter overrides and keep parameters the model's
+			// backend rejects or mishandles out of the request
+			if modelParams := r.Config.ModelConfig[actualModel]; len(modelParams.Parameters) > 0 || len(modelParams.ParamOverrides) > 0 {
+				body := reqCtx.OriginalBody
+				if bodyMutation != nil {
+					body = bodyMutation.GetBody()
+				}
+				constrained, adjustments, err := adjustParameters(body, modelParams)
+				if err != nil {
+					reqCtx.log.Error("Error adjusting parameters", "error", err)
+				} else if len(adjustments) > 0 {
+					for _, adjustment := range adjustments {
+						reqCtx.log.Info("Adjusted parameter for the model", "parameter", adjustment.Parameter, "action", adjustment.Action, "selected_model", actualModel)
+						if !reqCtx.canary {
+							metrics.RecordParameterAdjustment(actualModel, adjustment.Parameter, adjustment.Action)
+						}
+					}
+					bodyMutation = &ext_proc.BodyMutation{
+						Mutation: &ext_proc.BodyMutation_Body{Body: constrained},
+					}
+					if headerMutation == nil {
+						headerMutation = &ext_proc.HeaderMutation{}
+					}
+					if !slices.Contains(headerMutation.RemoveHeaders, "content-length") {
+						headerMutation.RemoveHeaders = append(headerMutation.RemoveHeaders, "content-length")
+					}
+				}
+			}
+
+			// Derive the session key so turns of a conversation stick to one replica
+			var sessionKey string
+			if affinity := r.Config.EndpointSelection.SessionAffinity; affinity.Enabled {
+				sessionKey = getSessionKey(reqCtx.Headers, affinity.SessionHeader, openAIRequest)
+				if sessionKey != "" && affinity.HashHeader != "" {
+					if headerMutation == nil {
+						headerMutation = &ext_proc.HeaderMutation{}
+					}
+					headerMutation.SetHeaders = append(headerMutation.SetHeaders, &core.HeaderValueOption{
+						Header: &core.HeaderValue{
+							Key:      affinity.HashHeader,
+							RawValue: []byte(endpoints.SessionHash(sessionKey)),
+						},
+					})
+					clearRouteCache = true
+				}
+			}
+
+			// Pick a backend endpoint for the model, preferring local ones
+			hints := endpoints.Hints{SessionKey: sessionKey}
+			if r.Config.EndpointSelection.PrefixAffinity.Enabled {
+				hints.Prompt = getPromptText(openAIRequest)
+			}
+			if !r.stageApplies(flags.StageEndpointSelection, reqCtx.ID, reqCtx.stageCohorts) {
+				reqCtx.log.Debug("Endpoint selection not applied, leaving the destination to Envoy")
+			} else if selection, ok := r.Endpoints.SelectWithHints(actualModel, hints); ok {
+				reqCtx.selectedEndpoint = &selection
+				if headerMutation == nil {
+					headerMutation = &ext_proc.HeaderMutation{}
+				}
+				headerMutation.SetHeaders = append(headerMutation.SetHeaders, &core.HeaderValueOption{
+					Header: &core.HeaderValue{
+						Key:      destinationEndpointHeader,
+						RawValue: []byte(selection.Endpoint.Address),
+					},
+				})
+				// Let Envoy re-evaluate the route against the new header
+				clearRouteCache = true
+				reqCtx.record.Endpoint.Name = selection.Endpoint.Name
+				reqCtx.record.Endpoint.Address = selection.Endpoint.Address
+				reqCtx.record.Endpoint.Locality = selection.Locality
+				reqCtx.log.Info("Selected endpoint", "endpoint", selection.Endpoint.Name, "locality", selection.Locality, "selected_model", actualModel)
+			}
+
+			// Tell the upstream, and Envoy's access logs, how the request was routed
+			if r.Config.DecisionHeaders.Request {
+				headerMutation = addDecisionHeaders(headerMutation, actualModel, reqCtx.routedMatch)
+			}
+
+			// Sign the routing decision for billing and audit proxies
+			if r.receiptKey != nil {
+				reqCtx.receipt = r.issueReceipt(reqCtx, actualModel)
+				if reqCtx.receipt != "" && r.receiptPlacement() == config.ReceiptPlacementHeader {
+					headerMutation = addReceiptHeader(headerMutation, reqCtx.receipt)
 				}
 			}
 
-			// Create default response with CONTINUE status
 			response := &ext_proc.ProcessingResponse{
 				Response: &ext_proc.ProcessingResponse_RequestBody{
 					RequestBody: &ext_proc.BodyResponse{
 						Response: &ext_proc.CommonResponse{
-							Status: ext_proc.CommonResponse_CONTINUE,
+							Status:          ext_proc.CommonResponse_CONTINUE,
+							HeaderMutation:  headerMutation,
+							BodyMutation:    bodyMutation,
+							ClearRouteCache: clearRouteCache,
 						},
 					},
 				},
+				DynamicMetadata: buildDecisionMetadata(decisionMetadata),
 			}
 
-			// Only change the model if the original model is "auto"
-			actualModel := originalModel
-			if originalModel == "auto" && (len(nonUserMessages) > 0 || userContent != "") {
-				// Determine text to use for classification/similarity
-				var classificationText string
-				if len(userContent) > 0 {
-					classificationText = userContent
-				} else if len(nonUserMessages) > 0 {
-					// Fall back to user content if no system/assistant messages
-					classificationText = strings.Join(nonUserMessages, " ")
+			// Save the actual model that will be used for token tracking
+			reqCtx.Model = actualModel
+			reqCtx.log = reqCtx.log.With("model", actualModel)
+			reqCtx.record.Usage.ProcessingSeconds = time.Since(reqCtx.ProcessingStartTime).Seconds()
+			reqCtx.record.Routing.SelectedModel = actualModel
+			if !reqCtx.canary {
+				metrics.RecordRequestBodySize(actualModel, len(reqCtx.OriginalBody))
+
+				// Track the full origin to destination matrix, including unchanged requests
+				if !isRetry {
+					metrics.RecordRoutingDecision(originalModel, actualModel, reqCtx.record.Routing.Category)
 				}
 
-				if classificationText != "" {
-					// Find the most similar task description or classify
-					matchedModel := r.findBestModelMatch(classificationText)
-					if matchedModel != originalModel && matchedModel != "" {
-						log.Printf("Routing to model: %s", matchedModel)
-
-						// Track the model routing change
-						metrics.RecordModelRouting(originalModel, matchedModel)
-
-						// Update the actual model that will be used
-						actualModel = matchedModel
-
-						// Modify the model in the request
-						openAIRequest.Model = matchedModel
-
-						// Serialize the modified request
-						modifiedBody, err := json.Marshal(openAIRequest)
-						if err != nil {
-							log.Printf("Error serializing modified request: %v", err)
-							return status.Errorf(codes.Internal, "error serializing modified request: %v", err)
-						}
-
-						// Create body mutation with the modified body
-						bodyMutation := &ext_proc.BodyMutation{
-							Mutation: &ext_proc.BodyMutation_Body{
-								Body: modifiedBody,
-							},
-						}
+				// Record the routing latency
+				metrics.RecordModelRoutingLatency(reqCtx.record.Usage.ProcessingSeconds)
+			}
 
-						// Also create a header mutation to remove the original content-length
-						headerMutation := &ext_proc.HeaderMutation{
-							RemoveHeaders: []string{"content-length"},
-						}
+			// Simulate the upstream failing, so circuit breakers and endpoint
+			// health react as they would to a real one
+			if statusCode := r.faults.upstreamError(); statusCode != 0 {
+				reqCtx.log.Info("Injecting upstream error", "status", statusCode)
+				if reqCtx.selectedEndpoint != nil {
+					r.Endpoints.RecordResult(*reqCtx.selectedEndpoint, false)
+				}
+				r.recordUpstreamError(reqCtx, statusCode)
+				r.Breakers.Record(reqCtx.Model, false, 0)
+				r.releasePendingRequest(reqCtx)
+				reqCtx.record.ResponseStatus = int32(statusCode)
+				r.writeDecision(reqCtx)
+				if err := sendResponse(stream, upstreamErrorResponse(statusCode), "injected upstream error"); err != nil {
+					return err
+				}
+				return nil
+			}
 
-						// Set the response with both mutations
-						response = &ext_proc.ProcessingResponse{
-							Response: &ext_proc.ProcessingResponse_RequestBody{
-								RequestBody: &ext_proc.BodyResponse{
-									Response: &ext_proc.CommonResponse{
-										Status:         ext_proc.CommonResponse_CONTINUE,
-										HeaderMutation: headerMutation,
-										BodyMutation:   bodyMutation,
-									},
-								},
-							},
-						}
+			reqCtx.RoutedTime = time.Now()
+			if err := sendResponse(stream, response, "body"); err != nil {
+				return err
+			}
 
-						log.Printf("Use new model: %s", matchedModel)
-					}
+		case *ext_proc.ProcessingRequest_ResponseHeaders:
+			reqCtx.log.Debug("Received response headers")
+			reqCtx.ResponseStartTime = time.Now()
+			reqCtx.responseStreamed = isEventStream(getHeaderValue(v.ResponseHeaders.Headers, "content-type"))
+
+			// Feed the upstream status into passive endpoint health tracking
+			statusCode := getHeaderValue(v.ResponseHeaders.Headers, ":status")
+			if reqCtx.selectedEndpoint != nil {
+				r.Endpoints.RecordResult(*reqCtx.selectedEndpoint, !strings.HasPrefix(statusCode, "5"))
+			}
+			if code, err := strconv.Atoi(statusCode); err == nil {
+				reqCtx.responseStatus = code
+				if reqCtx.record != nil {
+					reqCtx.record.ResponseStatus = int32(code)
+				}
+				if isUpstreamError(code) {
+					r.recordUpstreamError(reqCtx, code)
 				}
 			}
 
-			// Save the actual model that will be used for token tracking
-			requestModel = actualModel
+			// Remove provider-identifying headers if scrubbing is enabled
+			var headerMutation *ext_proc.HeaderMutation
+			if r.Config.ResponseScrubbing.Enabled {
+				if remove := headersToScrub(r.Config.ResponseScrubbing, v.ResponseHeaders.Headers); len(remove) > 0 {
+					headerMutation = &ext_proc.HeaderMutation{RemoveHeaders: remove}
+				}
+			}
 
-			// Record the routing latency
-			routingLatency := time.Since(processingStartTime)
-			metrics.RecordModelRoutingLatency(routingLatency.Seconds())
+			// Tell the client how its request was routed
+			if r.Config.DecisionHeaders.Response && reqCtx.Model != "" {
+				headerMutation = addDecisionHeaders(headerMutation, reqCtx.Model, reqCtx.routedMatch)
+			}
+			if reqCtx.receipt != "" && r.receiptPlacement() == config.ReceiptPlacementHeader {
+				headerMutation = addReceiptHeader(headerMutation, reqCtx.receipt)
+			}
 
-			if err := sendResponse(stream, response, "body"); err != nil {
-				return err
+			// Warn the client that the model it asked for or was routed to is deprecated
+			if reqCtx.deprecation != nil {
+				if headerMutation == nil {
+					headerMutation = &ext_proc.HeaderMutation{}
+				}
+				headerMutation.SetHeaders = append(headerMutation.SetHeaders, deprecationHeaders(*reqCtx.deprecation)...)
 			}
 
-		case *ext_proc.ProcessingRequest_ResponseHeaders:
-			log.Println("Received response headers")
+			// Let the upstream decide how long its response is cached. The TTL
+			// header is meant for the router only and not passed on.
+			if cacheCfg := r.Config.SemanticCache; cacheCfg.HonorUpstreamTTL {
+				reqCtx.upstreamTTL, reqCtx.upstreamTTLSet = upstreamCacheTTL(v.ResponseHeaders.Headers,
+					time.Duration(cacheCfg.MaxUpstreamTTLSeconds)*time.Second)
+				if getHeaderValue(v.ResponseHeaders.Headers, cacheTTLHeader) != "" {
+					if headerMutation == nil {
+						headerMutation = &ext_proc.HeaderMutation{}
+					}
+					headerMutation.RemoveHeaders = append(headerMutation.RemoveHeaders, cacheTTLHeader)
+				}
+			}
 
-			// Allow the response to continue without modification
 			response := &ext_proc.ProcessingResponse{
 				Response: &ext_proc.ProcessingResponse_ResponseHeaders{
 					ResponseHeaders: &ext_proc.HeadersResponse{
 						Response: &ext_proc.CommonResponse{
-							Status: ext_proc.CommonResponse_CONTINUE,
+							Status:         ext_proc.CommonResponse_CONTINUE,
+							HeaderMutation: headerMutation,
 						},
 					},
 				},
@@ -384,64 +2417,109 @@ func (r *OpenAIRouter) Process(stream ext_proc.ExternalProcessor_ProcessServer)
 			}
 
 		case *ext_proc.ProcessingRequest_ResponseBody:
-			completionLatency := time.Since(startTime)
-			log.Println("Received response body")
-
-			// Process the response for caching
-			responseBody := v.ResponseBody.Body
+			reqCtx.log.Debug("Received response body chunk", "bytes", len(v.ResponseBody.Body), "end_of_stream", v.ResponseBody.EndOfStream)
+
+			var headerMutation *ext_proc.HeaderMutation
+			var bodyMutation *ext_proc.BodyMutation
+
+			if reqCtx.responseFinalized {
+				// The response was already accounted for, e.g. a duplicate final message
+				reqCtx.log.Warn("Ignoring response body chunk received after end of stream")
+			} else if reqCtx.apiEndpoint != "" {
+				reqCtx.responseChunks++
+				reqCtx.responseBytes += len(v.ResponseBody.Body)
+				// Only batch objects are needed, to track created batches
+				if reqCtx.apiEndpoint == apiEndpointBatches && len(reqCtx.responseBuffer)+len(v.ResponseBody.Body) <= r.maxResponseBufferBytes() &&
+					r.streamBudget.reserve(reqCtx, len(v.ResponseBody.Body), "response_body") {
+					reqCtx.responseBuffer = append(reqCtx.responseBuffer, v.ResponseBody.Body...)
+				}
+				if v.ResponseBody.EndOfStream {
+					reqCtx.responseFinalized = true
+					r.finalizePassthrough(reqCtx)
+				}
+			} else {
+				reqCtx.responseChunks++
+				reqCtx.responseBytes += len(v.ResponseBody.Body)
+				if !reqCtx.responseOverflow {
+					if limit := r.maxResponseBufferBytes(); len(reqCtx.responseBuffer)+len(v.ResponseBody.Body) > limit {
+						// Pass the rest of the response through and drop the
+						// pending cache entry it can no longer complete
+						reqCtx.log.Info("Response body exceeds the buffer limit, no longer buffering", "limit_bytes", limit)
+						reqCtx.responseOverflow = true
+						reqCtx.responseBuffer = nil
+						metrics.RecordResponseBufferTruncation(reqCtx.Model)
+						r.releasePendingRequest(reqCtx)
+					} else if !r.streamBudget.reserve(reqCtx, len(v.ResponseBody.Body), "response_body") {
+						reqCtx.responseOverflow = true
+						reqCtx.responseBuffer = nil
+						r.releasePendingRequest(reqCtx)
+					} else {
+						reqCtx.responseBuffer = append(reqCtx.responseBuffer, v.ResponseBody.Body...)
+					}
+				}
 
-			// Parse tokens from the response JSON
-			promptTokens, completionTokens, _, err := parseTokensFromResponse(responseBody)
-			if err != nil {
-				log.Printf("Error parsing tokens from response: %v", err)
+				// Only finalize metrics and cache once the whole response has been seen
+				if v.ResponseBody.EndOfStream {
+					reqCtx.responseFinalized = true
+					headerMutation, bodyMutation = r.finalizeResponse(reqCtx)
+				}
 			}
 
-			// Record tokens used with the model that was used
-			if requestModel != "" {
-				metrics.RecordModelTokensDetailed(
-					requestModel,
-					float64(promptTokens),
-					float64(completionTokens),
-				)
-				metrics.RecordModelCompletionLatency(requestModel, completionLatency.Seconds())
+			response := &ext_proc.ProcessingResponse{
+				Response: &ext_proc.ProcessingResponse_ResponseBody{
+					ResponseBody: &ext_proc.BodyResponse{
+						Response: &ext_proc.CommonResponse{
+							Status:         ext_proc.CommonResponse_CONTINUE,
+							HeaderMutation: headerMutation,
+							BodyMutation:   bodyMutation,
+						},
+					},
+				},
 			}
 
-			// Check if this request has a pending cache entry
-			r.pendingRequestsLock.Lock()
-			cacheID, exists := r.pendingRequests[requestID]
-			if exists {
-				delete(r.pendingRequests, requestID)
+			if err := sendResponse(stream, response, "response body"); err != nil {
+				return err
 			}
-			r.pendingRequestsLock.Unlock()
 
-			// If we have a pending request, update the cache
-			if exists && requestQuery != "" && responseBody != nil {
-				err := r.Cache.UpdateWithResponse(string(cacheID), responseBody)
-				if err != nil {
-					log.Printf("Error updating cache: %v", err)
-					// Continue even if cache update fails
+		case *ext_proc.ProcessingRequest_ResponseTrailers:
+			reqCtx.log.Debug("Received response trailers")
+
+			// Responses with trailers end here rather than on a body chunk, or
+			// without any body at all
+			if !reqCtx.responseFinalized {
+				reqCtx.responseFinalized = true
+				if reqCtx.apiEndpoint != "" {
+					r.finalizePassthrough(reqCtx)
 				} else {
-					log.Printf("Cache updated for request ID: %s", requestID)
+					r.finalizeResponse(reqCtx)
 				}
 			}
 
-			// Allow the response to continue without modification
 			response := &ext_proc.ProcessingResponse{
-				Response: &ext_proc.ProcessingResponse_ResponseBody{
-					ResponseBody: &ext_proc.BodyResponse{
-						Response: &ext_proc.CommonResponse{
-							Status: ext_proc.CommonResponse_CONTINUE,
-						},
-					},
+				Response: &ext_proc.ProcessingResponse_ResponseTrailers{
+					ResponseTrailers: &ext_proc.TrailersResponse{},
 				},
 			}
 
-			if err := sendResponse(stream, response, "response body"); err != nil {
+			if err := sendResponse(stream, response, "response trailers"); err != nil {
+				return err
+			}
+
+		case *ext_proc.ProcessingRequest_RequestTrailers:
+			reqCtx.log.Debug("Received request trailers")
+
+			response := &ext_proc.ProcessingResponse{
+				Response: &ext_proc.ProcessingResponse_RequestTrailers{
+					RequestTrailers: &ext_proc.TrailersResponse{},
+				},
+			}
+
+			if err := sendResponse(stream, response, "request trailers"); err != nil {
 				return err
 			}
 
 		default:
-			log.Printf("Unknown request type: %v", v)
+			reqCtx.log.Warn("Unknown request type", "type", fmt.Sprintf("%T", v))
 
 			// For unknown message types, create a body response with CONTINUE status
 			response := &ext_proc.ProcessingResponse{
@@ -461,66 +2539,294 @@ func (r *OpenAIRouter) Process(stream ext_proc.ExternalProcessor_ProcessServer)
 	}
 }
 
-// Find the best model match using classification
-func (r *OpenAIRouter) findBestModelMatch(query string) string {
+// categoryMatch is the outcome of matching a query to a category
+type categoryMatch struct {
+	Model      string
+	Category   string
+	Confidence float32
+	// First ranked model of the category, which the model selection policy
+	// may have picked another model than
+	RankedModel string
+	// Second most likely category and its confidence, when the classifier reports one
+	RunnerUp           string
+	RunnerUpConfidence float32
+}
+
+// Find the best model match using classification, or the category utterances in
+// the query's detected language, returning the model, the matched category name
+// and the classification confidence. A dry run records no routing scores,
+// selection metrics or autoscaling demand.
+func (r *OpenAIRouter) findBestModelMatch(logger *slog.Logger, query, language string, set *embeddings.Set, budget *decisionBudget, dryRun bool) categoryMatch {
+	noMatch := categoryMatch{Model: r.Config.DefaultModel}
 	if len(r.CategoryDescriptions) == 0 {
-		return r.Config.DefaultModel
+		return noMatch
 	}
 
 	if r.CategoryMapping != nil {
 		// Use BERT classifier to get the category index and confidence
-		result, err := candle_binding.ClassifyText(query)
+		result, err := r.classifyText(query, budget)
+		r.ErrorBudgets.Record(errorbudget.StageClassification, err)
 		if err != nil {
-			log.Printf("Classification error: %v, falling back to default model", err)
-			return r.Config.DefaultModel
+			logger.Error("Classification failed, falling back to the default model", "error", err)
+			return noMatch
 		}
 
-		log.Printf("Classification result: class=%d, confidence=%.4f", result.Class, result.Confidence)
-
-		// Check confidence threshold
-		if result.Confidence < r.Config.Classifier.Threshold {
-			log.Printf("Classification confidence (%.4f) below threshold (%.4f), using default model",
-				result.Confidence, r.Config.Classifier.Threshold)
-			return r.Config.DefaultModel
+		logger.Debug("Classification result", "class", result.Class, "confidence", result.Confidence)
+		noMatch.Confidence = result.Confidence
+		if result.RunnerUpClass >= 0 {
+			noMatch.RunnerUp = r.CategoryMapping.IdxToCategory[fmt.Sprintf("%d", result.RunnerUpClass)]
+			noMatch.RunnerUpConfidence = result.RunnerUpConfidence
 		}
 
 		// Convert class index to category name
 		categoryName, ok := r.CategoryMapping.IdxToCategory[fmt.Sprintf("%d", result.Class)]
 		if !ok {
-			log.Printf("Class index %d not found in category mapping, using default model", result.Class)
-			return r.Config.DefaultModel
+			logger.Warn("Class index not found in category mapping, using the default model", "class", result.Class)
+			return noMatch
 		}
 
-		log.Printf("Classified as category: %s", categoryName)
+		logger.Debug("Classified", "category", categoryName)
+		if !dryRun {
+			metrics.RecordRoutingScore(config.RoutingStrategyClassifier, categoryName, result.Confidence)
+		}
 
 		// Find the category index in the config
 		for i, category := range r.Config.Categories {
 			if strings.EqualFold(category.Name, categoryName) {
+				// Check the category's confidence threshold
+				if threshold := r.Feedback.Threshold(category.Name, r.Config.GetClassifierThreshold(category)); result.Confidence < threshold {
+					logger.Info("Classification confidence below the category's threshold, using the default model",
+						"category", category.Name, "confidence", result.Confidence, "threshold", threshold)
+					return noMatch
+				}
+
 				// Get the model for this category
-				model := r.Config.GetModelForCategoryIndex(i)
-				log.Printf("Found matching model via classification: %s", model)
-				return model
+				match := noMatch
+				match.Model, match.RankedModel = r.selectCategoryModel(i, result.Confidence, dryRun)
+				match.Category = category.Name
+				logger.Debug("Found matching model via classification", "matched_model", match.Model)
+				if !dryRun {
+					r.Autoscaler.RecordDecision(category.Name, match.Model)
+				}
+				return match
 			}
 		}
 
 		// If we couldn't find a matching category, use default model
-		log.Printf("Could not find matching category %s in config, using default model", categoryName)
-		return r.Config.DefaultModel
+		logger.Warn("Category not found in config, using the default model", "category", categoryName)
+		return noMatch
+	}
+
+	if r.Config.HasCategoryUtterances() {
+		start := time.Now()
+		defer budget.observe(costClassify, start)
+		return r.matchCategoryUtterances(logger, query, language, set, dryRun)
+	}
+
+	return noMatch
+}
+
+// matchCategoryUtterances routes by the category whose utterances in the
+// query's language are most similar to the query, scored with the language's
+// model when one is configured
+func (r *OpenAIRouter) matchCategoryUtterances(logger *slog.Logger, query, language string, set *embeddings.Set, dryRun bool) categoryMatch {
+	texts, categories := r.Config.GetCategoryUtterances(language)
+	modelLanguage := ""
+	if _, ok := r.Config.GetLanguageModel(language); ok {
+		modelLanguage = language
+	}
+	result := r.findSimilar(set, modelLanguage, query, texts)
+	if result.Index < 0 || result.Index >= len(texts) {
+		logger.Warn("Similarity search failed, using the default model")
+		return categoryMatch{Model: r.Config.DefaultModel}
+	}
+
+	category := r.Config.Categories[categories[result.Index]]
+	logger.Debug("Found most similar utterance", "language", language, "category", category.Name, "similarity", result.Score)
+	if !dryRun {
+		metrics.RecordRoutingScore(config.RoutingStrategySimilarity, category.Name, result.Score)
+	}
+	if threshold := r.Feedback.Threshold(category.Name, r.Config.GetSimilarityThreshold(language)); result.Score < threshold {
+		logger.Info("Similarity below threshold, using the default model", "similarity", result.Score, "threshold", threshold)
+		return categoryMatch{Model: r.Config.DefaultModel, Confidence: result.Score}
+	}
+
+	model, ranked := r.selectCategoryModel(categories[result.Index], result.Score, dryRun)
+	if !dryRun {
+		r.Autoscaler.RecordDecision(category.Name, model)
+	}
+	return categoryMatch{Model: model, Category: category.Name, Confidence: result.Score, RankedModel: ranked}
+}
+
+// stageApplies returns whether a pipeline stage runs for the request, noting the
+// request's cohort for stages that are being gradually rolled out
+func (r *OpenAIRouter) stageApplies(stage, requestID string, cohorts map[string]string) bool {
+	// Stages needing the models are skipped in safe mode
+	if (stage == flags.StageClassification || stage == flags.StageCache) && !r.models.Ready() {
+		return false
+	}
+	if !r.Flags.Enabled(stage) {
+		return false
+	}
+	// Stages over their error budget fail open until their cool-down ends; the
+	// classification, cache, PII and prompt guard flags share the error budget
+	// stage names
+	if !r.ErrorBudgets.Allow(stage) {
+		return false
+	}
+	cohort, rollingOut := r.Flags.Cohort(stage, requestID)
+	if rollingOut {
+		cohorts[stage] = cohort
+	}
+	return cohort == flags.CohortTreated
+}
+
+// recordStageCohorts records the request outcome for each stage rollout it took part in
+func recordStageCohorts(cohorts map[string]string, latency time.Duration, failed bool) {
+	for stage, cohort := range cohorts {
+		metrics.RecordStageCohort(stage, cohort, latency.Seconds(), failed)
+	}
+}
+
+// writeDecision hands the completed decision record of a request to the sink,
+// if any. Records of canary probes are dropped, so they stay out of usage
+// exports and application learning.
+func (r *OpenAIRouter) writeDecision(reqCtx *RequestContext) {
+	if r.Decisions == nil || reqCtx.record == nil || reqCtx.canary {
+		return
+	}
+	r.Decisions.Write(reqCtx.record)
+}
+
+// classifyText classifies the text, splitting text longer than the model's max
+// sequence length into chunks and pooling the per-chunk results. Chunks left
+// when the decision budget runs out are not classified.
+func (r *OpenAIRouter) classifyText(text string, budget *decisionBudget) (candle_binding.ClassResult, error) {
+	options := chunkingOptions(r.Config)
+	chunks := chunking.Split(text, options)
+	results := make([]candle_binding.ClassResult, 0, len(chunks))
+	for i, chunk := range chunks {
+		// Pool the chunks classified so far once the budget runs out
+		if i > 0 && !budget.allows(costClassify, DegradedClassificationChunks) {
+			break
+		}
+		start := time.Now()
+		r.faults.delayClassification()
+		result, err := r.classify(chunk)
+		budget.observe(costClassify, start)
+		if err != nil {
+			return candle_binding.ClassResult{}, err
+		}
+		results = append(results, result)
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	slog.Debug("Classified chunks", "classified", len(results), "chunks", len(chunks), "pooling", options.Pooling)
+	return poolClassResults(results, options.Pooling), nil
+}
+
+// poolClassResults combines per-chunk classifications. Mean pooling picks the class
+// with the highest average confidence across all chunks (chunks voting for other
+// classes count as zero); max pooling picks the single most confident chunk.
+// With mean pooling the runner-up is the class with the next highest average,
+// or the most likely runner-up of the chunks when they all agree. Without
+// results there is no class.
+func poolClassResults(results []candle_binding.ClassResult, pooling string) candle_binding.ClassResult {
+	if len(results) == 0 {
+		return candle_binding.ClassResult{Class: -1, RunnerUpClass: -1}
+	}
+	if pooling == chunking.PoolingMax {
+		best := results[0]
+		for _, result := range results[1:] {
+			if result.Confidence > best.Confidence {
+				best = result
+			}
+		}
+		return best
+	}
+
+	sums := make(map[int]float32)
+	for _, result := range results {
+		sums[result.Class] += result.Confidence
+	}
+	best, runnerUp := topTwoClasses(sums, len(results))
+	if runnerUp.Class < 0 {
+		runnerUpSums := make(map[int]float32)
+		for _, result := range results {
+			if result.RunnerUpClass >= 0 && result.RunnerUpClass != best.Class {
+				runnerUpSums[result.RunnerUpClass] += result.RunnerUpConfidence
+			}
+		}
+		runnerUp, _ = topTwoClasses(runnerUpSums, len(results))
+	}
+	best.RunnerUpClass = runnerUp.Class
+	best.RunnerUpConfidence = runnerUp.Confidence
+	return best
+}
+
+// topTwoClasses returns the classes with the highest and second highest average
+// confidence, breaking ties by class index; missing classes are -1
+func topTwoClasses(sums map[int]float32, count int) (candle_binding.ClassResult, candle_binding.ClassResult) {
+	first := candle_binding.ClassResult{Class: -1}
+	second := candle_binding.ClassResult{Class: -1}
+	better := func(class int, confidence float32, than candle_binding.ClassResult) bool {
+		return than.Class < 0 || confidence > than.Confidence || (confidence == than.Confidence && class < than.Class)
+	}
+	for class, sum := range sums {
+		confidence := sum / float32(count)
+		if better(class, confidence, first) {
+			second = first
+			first = candle_binding.ClassResult{Class: class, Confidence: confidence}
+		} else if better(class, confidence, second) {
+			second = candle_binding.ClassResult{Class: class, Confidence: confidence}
+		}
 	}
+	return first, second
+}
 
-	return r.Config.DefaultModel
+// chunkingOptions converts the text chunking config into chunking options
+func chunkingOptions(cfg *config.RouterConfig) chunking.Options {
+	return chunking.Options{
+		Enabled:      cfg.TextChunking.Enabled,
+		ChunkWords:   cfg.TextChunking.ChunkWords,
+		OverlapWords: cfg.TextChunking.OverlapWords,
+		Pooling:      cfg.TextChunking.Pooling,
+	}
 }
 
 // OpenAIRequest represents an OpenAI API request
 type OpenAIRequest struct {
-	Model    string        `json:"model"`
-	Messages []ChatMessage `json:"messages"`
+	Model         string         `json:"model"`
+	Messages      []ChatMessage  `json:"messages"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// Routed endpoint of legacy completions and embeddings requests, whose
+	// messages stand for their prompts, and of Messages API requests, empty
+	// for chat completions
+	endpoint string
+}
+
+// StreamOptions represents the options of a streaming request
+type StreamOptions struct {
+	// Send a final chunk with the usage of the whole request
+	IncludeUsage bool `json:"include_usage"`
 }
 
-// ChatMessage represents a message in the OpenAI chat format
+// ChatMessage represents a message in the OpenAI chat format. Its content is
+// a string or an array of content parts, see messages.go.
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role string `json:"role"`
+	// Text of the message; of content parts, the text of the text parts
+	Content string `json:"-"`
+	// Content parts of a multimodal message, nil when the content is a string
+	Parts []ContentPart `json:"-"`
+	// Name of the participant, or of the function with the function role
+	Name string `json:"name,omitempty"`
+	// Tool calls made by an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Tool call answered by a message with the tool role
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 // Parse the OpenAI request JSON
@@ -529,20 +2835,120 @@ func parseOpenAIRequest(data []byte) (*OpenAIRequest, error) {
 	if err := json.Unmarshal(data, &req); err != nil {
 		return nil, err
 	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, fmt.Errorf("request body is not a JSON object")
+	}
 	return &req, nil
 }
 
+// extractMessageContents returns the last user message and the contents of all
+// other messages with a role, in order
+func extractMessageContents(req *OpenAIRequest) (string, []string) {
+	var userContent string
+	var nonUserMessages []string
+	for _, msg := range req.Messages {
+		if msg.Role == "user" {
+			userContent = msg.Content
+		} else if msg.Role != "" {
+			nonUserMessages = append(nonUserMessages, msg.Content)
+		}
+	}
+	return userContent, nonUserMessages
+}
+
+// classificationInput returns the text a request is classified by: its last
+// user message, or without one the contents of its other messages
+func classificationInput(userContent string, nonUserMessages []string) string {
+	if userContent != "" {
+		return userContent
+	}
+	return strings.Join(nonUserMessages, " ")
+}
+
+// rewriteRequestModel sets the model of the request and of its body, keeping
+// every other field of the body as sent
+func rewriteRequestModel(req *OpenAIRequest, body []byte, model string) ([]byte, error) {
+	req.Model = model
+	return setRequestModel(body, model)
+}
+
 // OpenAIResponse represents an OpenAI API response
 type OpenAIResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Usage   struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Usage   OpenAIUsage    `json:"usage"`
+	Choices []OpenAIChoice `json:"choices"`
+}
+
+// OpenAIUsage represents the token usage of a response or of one of its choices
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// Tokens as reported by Anthropic Messages API backends
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+}
+
+// OpenAIChoice represents one completion of a response, of which requests with
+// n > 1 get several
+type OpenAIChoice struct {
+	Index int `json:"index"`
+	// Usage of this choice alone, reported by some backends
+	Usage *OpenAIUsage `json:"usage,omitempty"`
+	// Log probabilities when requested, with one content entry per completion token
+	Logprobs *struct {
+		Content []struct{} `json:"content"`
+	} `json:"logprobs,omitempty"`
+}
+
+// rewriteForModel serializes the request for the model it is routed to,
+// applying the model family's field templates, e.g. the reasoning parameters
+// configured for the category or model, and the category's system prompt
+func (r *OpenAIRouter) rewriteForModel(reqCtx *RequestContext, req *OpenAIRequest, model, category string) (body []byte, err error) {
+	span := reqCtx.startSpan(spanMutation, attribute.String("llm.model", model))
+	defer func() { endSpan(span, err) }()
+
+	body, err = rewriteRequestModel(req, reqCtx.OriginalBody, model)
+	if err != nil {
+		reqCtx.log.Error("Error serializing modified request", "error", err)
+		return nil, status.Errorf(codes.Internal, "error serializing modified request: %v", err)
+	}
+	if req.endpoint != "" {
+		// Reasoning parameters and system prompts are for chat completions
+		return body, nil
+	}
+
+	effort := r.Config.GetReasoningEffort(category, model)
+	family := r.Config.GetModelFamily(model)
+	if !r.FamilyTemplates.HasFamily(family) {
+		reqCtx.log.Warn("Model family has no templates, forwarding the request without them", "model", model, "family", family)
+	}
+	body, err = applyFamilyTemplates(r.FamilyTemplates, body, family, effort)
+	if err != nil {
+		reqCtx.log.Error("Error applying model family templates", "error", err)
+		return nil, status.Errorf(codes.Internal, "error applying model family templates: %v", err)
+	}
+	if effort != "" {
+		reqCtx.record.Routing.ReasoningEffort = effort
+		reqCtx.log.Debug("Applied reasoning effort", "effort", effort, "category", category, "family", family)
+	}
+
+	prompt, mode := r.Config.GetSystemPromptForCategory(category)
+	if mode = systemPromptMode(mode, reqCtx.Headers[systemPromptHeader]); prompt != "" && mode != "" {
+		var injected bool
+		body, injected, err = injectSystemPrompt(body, prompt, mode)
+		if err != nil {
+			reqCtx.log.Error("Error injecting the category system prompt", "error", err)
+			return nil, status.Errorf(codes.Internal, "error injecting the category system prompt: %v", err)
+		}
+		if injected {
+			reqCtx.log.Debug("Injected category system prompt", "category", category, "mode", mode)
+		}
+	}
+	return body, nil
 }
 
 // parseTokensFromResponse extracts detailed token counts from the OpenAI schema based response JSON
@@ -556,73 +2962,302 @@ func parseTokensFromResponse(responseBody []byte) (promptTokens, completionToken
 		return 0, 0, 0, fmt.Errorf("failed to parse response JSON: %w", err)
 	}
 
-	// Extract token counts from the usage field
-	promptTokens = response.Usage.PromptTokens
-	completionTokens = response.Usage.CompletionTokens
-	totalTokens = response.Usage.TotalTokens
+	// Count the tokens of every choice, not only what the usage field reports
+	usage, source := responseUsage(&response)
+	promptTokens = usage.PromptTokens
+	completionTokens = usage.CompletionTokens
+	totalTokens = max(usage.TotalTokens, promptTokens+completionTokens)
 
-	log.Printf("Parsed token usage from response: total=%d (prompt=%d, completion=%d)",
-		totalTokens, promptTokens, completionTokens)
+	slog.Debug("Parsed token usage from response", "response_id", source, "total_tokens", totalTokens,
+		"prompt_tokens", promptTokens, "completion_tokens", completionTokens, "choices", len(response.Choices))
 
 	return promptTokens, completionTokens, totalTokens, nil
 }
 
 // Server represents a gRPC server for the Envoy ExtProc
 type Server struct {
+	// Router built at startup, owning the background components
 	router *OpenAIRouter
-	server *grpc.Server
-	port   int
+	// Router of the latest loaded config, serving new streams
+	routers    *reloadingRouter
+	configPath string
+	reloadMu   sync.Mutex
+	// Reloads the config when its files change, nil unless config_reload.watch_files is set
+	watcher *configWatcher
+	server  *grpc.Server
+	admin   *admin.Server
+	// Serves the Prometheus metrics, nil when they are not served
+	metrics *metricsServer
+	canary  *canary.Canary
+	// Elects the replica running singleton background jobs, nil when disabled
+	leader *leader.Elector
+	// Flushes and stops the span exporter, nil when tracing is disabled
+	stopTracing func(context.Context) error
+	// Certificates of the listeners, nil when TLS is disabled
+	certificates *serverCertificates
+	// gRPC health of the server, NOT_SERVING until the router is ready
+	health *servingHealth
+	// Announces the instance to the control plane, nil when disabled
+	registration *registration.Client
+	port         int
 }
 
-// NewServer creates a new ExtProc gRPC server
-func NewServer(configPath string, port int) (*Server, error) {
+// NewServer creates a new ExtProc gRPC server, listening on port when the
+// config has no listeners and serving metrics on metricsPort when it sets no
+// metrics.port
+func NewServer(configPath string, port, metricsPort int) (*Server, error) {
 	router, err := NewOpenAIRouter(configPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Server{
-		router: router,
-		port:   port,
-	}, nil
+	s := &Server{
+		router:     router,
+		routers:    newReloadingRouter(router),
+		configPath: configPath,
+		port:       port,
+		metrics:    newMetricsServer(router.Config.Metrics, metricsPort),
+	}
+	metrics.RecordBuildInfo(fingerprint.BuildVersion(), router.Config.Hash(), router.Config.RoutingHash())
+	if s.certificates, err = newServerCertificates(router.Config.TLS); err != nil {
+		return nil, err
+	}
+	if tracingCfg := router.Config.Tracing; tracingCfg.Enabled {
+		endpoint := tracingCfg.Endpoint
+		if endpoint == "" {
+			endpoint = "localhost:4317"
+		}
+		serviceName := tracingCfg.ServiceName
+		if serviceName == "" {
+			serviceName = "semantic-router"
+		}
+		s.stopTracing, err = tracing.Setup(tracing.Options{
+			Endpoint:    endpoint,
+			Insecure:    tracingCfg.Insecure,
+			SampleRate:  router.Config.GetTracingSampleRate(),
+			ServiceName: serviceName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up tracing: %w", err)
+		}
+		slog.Info("Exporting spans", "endpoint", endpoint)
+	}
+	if router.Config.Admin.Port > 0 {
+		var token string
+		if tokenEnv := router.Config.Admin.TokenEnv; tokenEnv != "" {
+			if token = os.Getenv(tokenEnv); token == "" {
+				return nil, fmt.Errorf("admin.token_env %s is not set", tokenEnv)
+			}
+		}
+		var routingFeedback func(requestID, kind string) error
+		if router.Feedback != nil {
+			routingFeedback = func(requestID, kind string) error {
+				return s.routers.current().submitFeedback(requestID, kind)
+			}
+		}
+		s.admin = admin.NewServer(admin.Options{
+			Port:            router.Config.Admin.Port,
+			Address:         router.Config.Admin.Address,
+			Token:           token,
+			ReusePort:       router.Config.GracefulRestart.ReusePort || router.Config.GracefulRestart.Handoff,
+			Flags:           router.Flags,
+			Fingerprint:     fingerprint.Compute(router.Config),
+			Traces:          router.Traces,
+			Discovery:       router.Discovery,
+			Recommender:     router.Recommender,
+			Cache:           router.Cache,
+			Config:          func() *config.RouterConfig { return s.routers.current().Config },
+			Decisions:       router.RecentDecisions,
+			Circuits:        func() []breaker.Circuit { return s.routers.current().Breakers.Circuits() },
+			UpstreamErrors:  router.UpstreamErrors.recent,
+			RoutingFeedback: routingFeedback,
+			Channelz:        router.Config.Admin.Channelz,
+			Ready:           router.Ready,
+			Classify: func(ctx context.Context, req admin.ClassifyRequest) (admin.Classification, error) {
+				return s.routers.current().classifyForAPI(ctx, req)
+			},
+			Health: map[string]admin.HealthCheck{
+				HealthClassifier:    router.models.Health,
+				HealthModelDownload: router.ModelStore.Health,
+				HealthErrorBudgets:  router.ErrorBudgets.Health,
+			},
+		})
+	}
+	if electionCfg := router.Config.LeaderElection; electionCfg.Enabled {
+		identity := electionCfg.Identity
+		if identity == "" {
+			identity, _ = os.Hostname()
+		}
+		s.leader, err = leader.NewInCluster(leader.Options{
+			Namespace:     electionCfg.Namespace,
+			LeaseName:     electionCfg.LeaseName,
+			Identity:      identity,
+			LeaseDuration: time.Duration(electionCfg.LeaseDurationSeconds) * time.Second,
+			RetryInterval: time.Duration(electionCfg.RetryIntervalSeconds) * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up leader election: %w", err)
+		}
+	}
+	if s.registration, err = newRegistration(router.Config.Registration, port, s.routers.current, router.Ready); err != nil {
+		return nil, fmt.Errorf("invalid registration: %w", err)
+	}
+	if canaryCfg := router.Config.Canary; canaryCfg.Enabled {
+		probes := make([]canary.Probe, 0, len(canaryCfg.Probes))
+		for _, probe := range canaryCfg.Probes {
+			probes = append(probes, canary.Probe{
+				Name:          probe.Name,
+				Prompt:        probe.Prompt,
+				Model:         probe.Model,
+				ExpectedModel: probe.ExpectedModel,
+			})
+		}
+		s.canary = canary.New(canary.Options{
+			Interval:    time.Duration(canaryCfg.IntervalSeconds) * time.Second,
+			Timeout:     time.Duration(canaryCfg.TimeoutSeconds) * time.Second,
+			UpstreamURL: canaryCfg.UpstreamURL,
+			Probes:      probes,
+			Route: func(ctx context.Context, body []byte) (string, error) {
+				return s.routers.current().routeCanary(ctx, body)
+			},
+			ShouldRun: s.leader.IsLeader,
+		})
+	}
+	return s, nil
 }
 
 // Start starts the gRPC server
 func (s *Server) Start() error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	restart := s.router.Config.GracefulRestart
+	specs := listenerSpecs(s.router.Config.Listeners, s.port)
+	listeners, err := inheritedListeners(specs)
 	if err != nil {
-		return fmt.Errorf("failed to listen on port %d: %w", s.port, err)
+		return err
+	}
+	if listeners != nil {
+		slog.Info("Took over listening sockets", "sockets", len(listeners))
+	} else if listeners, err = listen(specs, restart.ReusePort); err != nil {
+		return err
 	}
 
-	s.server = grpc.NewServer()
-	ext_proc.RegisterExternalProcessorServer(s.server, s.router)
+	serverOptions := grpcServerOptions(s.router.Config.GRPC)
+	if s.certificates != nil {
+		if err := s.certificates.watch(0); err != nil {
+			slog.Error("Error watching TLS certificate files, rotated certificates need a restart", "error", err)
+		}
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(s.certificates.serverConfig())))
+		slog.Info("Serving TLS", "cert_file", s.router.Config.TLS.CertFile,
+			"client_ca_file", s.router.Config.TLS.ClientCAFile, "require_client_cert", s.router.Config.TLS.RequireClientCert)
+	}
+	s.server = grpc.NewServer(serverOptions...)
+	ext_proc.RegisterExternalProcessorServer(s.server, s.routers)
+	s.health = newServingHealth(s.router.Ready, readinessInterval)
+	healthpb.RegisterHealthServer(s.server, s.health.server)
+	if s.router.Config.Admin.Channelz {
+		channelzservice.RegisterChannelzServiceToServer(s.server)
+	}
 
-	log.Printf("Starting LLM Router ExtProc server on port %d...", s.port)
+	if s.metrics != nil {
+		s.metrics.start()
+	}
+	if s.admin != nil {
+		if err := s.admin.Start(); err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			return err
+		}
+	}
 
-	// Run the server in a separate goroutine
-	serverErrCh := make(chan error, 1)
-	go func() {
-		if err := s.server.Serve(lis); err != nil && err != grpc.ErrServerStopped {
-			log.Printf("Server error: %v", err)
-			serverErrCh <- err
+	if s.router.models != nil {
+		s.router.models.Start()
+	}
+	if s.router.Coordinator != nil {
+		s.router.Coordinator.Start()
+	}
+	if s.router.Discovery != nil {
+		s.router.Discovery.Start()
+	}
+	if s.router.Batches != nil {
+		s.router.Batches.Start()
+	}
+	if s.router.Load != nil {
+		s.router.Load.Start()
+	}
+	if s.router.Archive != nil {
+		s.router.Archive.Start()
+	}
+	if s.router.janitor != nil {
+		s.router.janitor.Start()
+	}
+	if s.leader != nil {
+		s.leader.Start()
+	}
+	if s.canary != nil {
+		s.canary.Start()
+	}
+	if reloadCfg := s.router.Config.ConfigReload; reloadCfg.WatchFiles {
+		s.watcher, err = newConfigWatcher(s.router.Config.Sources, time.Duration(reloadCfg.DebounceMs)*time.Millisecond, func() {
+			_ = s.reload()
+		})
+		if err != nil {
+			slog.Error("Error watching config files, reloading on SIGHUP only", "error", err)
 		} else {
-			serverErrCh <- nil
+			slog.Info("Watching config files for changes", "files", s.router.Config.Sources)
 		}
-	}()
+	}
+
+	// Serve every listener in a separate goroutine
+	serverErrCh := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		slog.Info("Starting LLM Router ExtProc server", "network", lis.Addr().Network(), "address", lis.Addr().String())
+		go func(lis net.Listener) {
+			if err := s.server.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+				slog.Error("Server error", "address", lis.Addr().String(), "error", err)
+				serverErrCh <- err
+			} else {
+				serverErrCh <- nil
+			}
+		}(lis)
+	}
 
-	// Wait for interrupt signal to gracefully shut down the server
+	// Wait for interrupt signal to gracefully shut down the server, for SIGHUP
+	// to reload the config, or for SIGUSR2 to hand the sockets over to a new process
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+	if restart.Handoff {
+		signals = append(signals, syscall.SIGUSR2)
+	}
+	signal.Notify(signalChan, signals...)
+	notifyReady()
+	if s.registration != nil {
+		s.registration.Start()
+	}
 
 	// Wait for either server error or shutdown signal
-	select {
-	case err := <-serverErrCh:
-		if err != nil {
-			log.Printf("Server exited with error: %v", err)
-			return err
+wait:
+	for {
+		select {
+		case err := <-serverErrCh:
+			if err != nil {
+				slog.Error("Server exited with error", "error", err)
+				return err
+			}
+			break wait
+		case sig := <-signalChan:
+			if sig == syscall.SIGHUP {
+				slog.Info("Received SIGHUP, reloading config")
+				_ = s.reload()
+				continue
+			}
+			if sig != syscall.SIGUSR2 {
+				slog.Info("Received shutdown signal, gracefully stopping server")
+				break wait
+			}
+			if s.handOver(listeners) {
+				break wait
+			}
 		}
-	case <-signalChan:
-		log.Println("Received shutdown signal, gracefully stopping server...")
 	}
 
 	s.Stop()
@@ -631,9 +3266,79 @@ func (s *Server) Start() error {
 
 // Stop stops the gRPC server
 func (s *Server) Stop() {
+	// Leave the control plane's inventory before draining
+	if s.registration != nil {
+		s.registration.Stop()
+	}
+	s.watcher.Close()
+	s.certificates.Close()
+	if s.canary != nil {
+		s.canary.Stop()
+	}
+	if s.leader != nil {
+		s.leader.Stop()
+	}
+	if s.admin != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s.admin.Stop(ctx)
+		cancel()
+	}
 	if s.server != nil {
-		s.server.GracefulStop()
-		log.Println("Server stopped")
+		// Tell health checking clients to stop opening streams while the
+		// open ones drain
+		s.health.shutdown()
+		timeout := time.Duration(s.router.Config.Shutdown.DrainTimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		drained := drain(s.server, timeout, s.routers.streams.Load)
+		metrics.RecordShutdownDrain(drained)
+		slog.Info("Server stopped", "drained", drained)
+	}
+	// Stop what streams depend on only once they drained
+	if s.router.Discovery != nil {
+		s.router.Discovery.Stop()
+	}
+	if s.router.Batches != nil {
+		s.router.Batches.Stop()
+	}
+	if s.router.Load != nil {
+		s.router.Load.Stop()
+	}
+	if s.router.Coordinator != nil {
+		s.router.Coordinator.Stop()
+	}
+	if s.router.models != nil {
+		s.router.models.Stop()
+	}
+	if s.router.janitor != nil {
+		s.router.janitor.Stop()
+	}
+	// Store the responses still queued for the cache and the archive once
+	// streams finished
+	s.router.Cache.Stop()
+	if s.router.Archive != nil {
+		s.router.Archive.Stop()
+	}
+	if path := s.router.Config.Shutdown.FinalMetricsPath; path != "" {
+		if err := writeMetrics(prometheus.DefaultGatherer, path); err != nil {
+			slog.Error("Error writing final metrics", "path", path, "error", err)
+		} else {
+			slog.Info("Wrote final metrics", "path", path)
+		}
+	}
+	// Keep serving metrics until streams drained, for the last scrapes
+	if s.metrics != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s.metrics.stop(ctx)
+		cancel()
+	}
+	if s.stopTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := s.stopTracing(ctx); err != nil {
+			slog.Error("Error flushing spans", "error", err)
+		}
+		cancel()
 	}
 }
 
@@ -0,0 +1,45 @@
+package extproc
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+)
+
+// isUpstreamError returns whether an upstream status is one a retry falls
+// back to another model for: rate limiting or a server error
+func isUpstreamError(status int) bool {
+	return status == http.StatusTooManyRequests || (status >= 500 && status <= 599)
+}
+
+// recordUpstreamError records an upstream error against the model the request
+// was routed to, so retries of the request fall back from it
+func (r *OpenAIRouter) recordUpstreamError(reqCtx *RequestContext, status int) {
+	if reqCtx.Model == "" {
+		return
+	}
+	reqCtx.log.Warn("Upstream returned an error", "status", status)
+	metrics.RecordUpstreamError(reqCtx.Model, status)
+	if reqCtx.attemptKey != "" {
+		r.attempts.fail(reqCtx.attemptKey, reqCtx.Model)
+	}
+}
+
+// Reasons a request falls back from the model it would be routed to
+const (
+	fallbackUpstreamError = "upstream_error"
+	fallbackCircuitOpen   = "circuit_open"
+)
+
+// fallbackModel returns the first model of the category's fallback chain that
+// is not excluded, the policies allow and whose circuit is closed
+func (r *OpenAIRouter) fallbackModel(category string, excluded []string, policies policy.Set) (string, bool) {
+	for _, candidate := range r.Config.GetFallbackModelsForCategory(category) {
+		if !slices.Contains(excluded, candidate) && policies.Check(candidate) == nil && r.Breakers.Allow(candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
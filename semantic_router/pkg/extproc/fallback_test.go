@@ -0,0 +1,108 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tokenbudget"
+)
+
+func TestProcessFallsBackOnUpstreamErrors(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Categories[0].Fallbacks = []string{"backup-model"}
+
+	send := func(status string) string {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-1"),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders(status),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+		return gjson.GetBytes(body, "model").String()
+	}
+
+	// Each retry moves down the chain past the models that failed
+	for i, tt := range []struct{ status, wantModel string }{
+		{"503", "math-model"},
+		{"429", "backup-model"},
+		{"500", "default-model"},
+		{"200", "math-model"},
+	} {
+		if got := send(tt.status); got != tt.wantModel {
+			t.Errorf("attempt %d routed to %q, want %q", i+1, got, tt.wantModel)
+		}
+	}
+}
+
+func TestProcessAccountsForTheRetryThatSucceeds(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Categories[0].Fallbacks = []string{"backup-model"}
+	sink := &recordingSink{}
+	router.Decisions = sink
+	router.Config.TokenBudgets.IdentityHeader = "X-API-Key"
+	router.TokenBudgets = tokenbudget.New(tokenbudget.Options{Default: tokenbudget.Limits{Hourly: 15}})
+
+	for _, tt := range []struct{ status, body string }{
+		{"503", `{"error":{"message":"overloaded","type":"server_error"}}`},
+		{"200", completionBody},
+	} {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-1", "x-api-key", "alice"),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders(tt.status),
+			responseBody(tt.body, true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+	}
+
+	if usage := sink.records[len(sink.records)-1].GetUsage(); usage.GetPromptTokens() != 10 || usage.GetCompletionTokens() != 5 {
+		t.Errorf("usage of the successful retry = %+v, want 10 prompt and 5 completion tokens", usage)
+	}
+	if router.TokenBudgets.Check("alice") == nil {
+		t.Error("expected the successful retry's 15 tokens to use up the budget")
+	}
+}
+
+func TestProcessRoutesAroundOpenCircuits(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Categories[0].Fallbacks = []string{"backup-model"}
+	router.Breakers = breaker.New(breaker.Options{MinRequests: 2})
+
+	send := func(id, status string) string {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", id),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders(status),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+		return gjson.GetBytes(body, "model").String()
+	}
+
+	// Two failed responses open math-model's circuit
+	for _, id := range []string{"req-1", "req-2"} {
+		if got := send(id, "502"); got != "math-model" {
+			t.Fatalf("%s routed to %q, want math-model", id, got)
+		}
+	}
+	if got := send("req-3", "200"); got != "backup-model" {
+		t.Errorf("routed to %q with math-model's circuit open, want backup-model", got)
+	}
+	circuits := router.Breakers.Circuits()
+	if len(circuits) != 2 || circuits[0].Model != "backup-model" || circuits[1].State != breaker.StateOpen {
+		t.Errorf("circuits = %+v", circuits)
+	}
+}
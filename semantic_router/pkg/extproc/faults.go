@@ -0,0 +1,139 @@
+package extproc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Faults the injector injects
+const (
+	faultClassificationLatency = "classification_latency"
+	faultCacheError            = "cache_error"
+	faultUpstreamError         = "upstream_error"
+)
+
+// errInjectedFault is the error of injected cache failures
+var errInjectedFault = errors.New("injected fault")
+
+// faultInjector injects faults into request processing for resilience
+// testing. A nil injector injects none.
+type faultInjector struct {
+	classificationLatency     time.Duration
+	classificationLatencyRate float64
+	cacheErrorRate            float64
+	upstreamErrorRate         float64
+	upstreamErrorStatus       int
+	random                    func() float64
+	sleep                     func(time.Duration)
+}
+
+// newFaultInjector creates the injector of the configured faults, deciding
+// whether each hits with random, nil unless fault injection is enabled
+func newFaultInjector(cfg config.FaultInjectionConfig, random func() float64) (*faultInjector, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	for name, rate := range map[string]float64{
+		"classification_latency_rate": cfg.ClassificationLatencyRate,
+		"cache_error_rate":            cfg.CacheErrorRate,
+		"upstream_error_rate":         cfg.UpstreamErrorRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+	if cfg.ClassificationLatencyMs < 0 {
+		return nil, fmt.Errorf("classification_latency_ms is negative")
+	}
+	f := &faultInjector{
+		classificationLatency:     time.Duration(cfg.ClassificationLatencyMs) * time.Millisecond,
+		classificationLatencyRate: cfg.ClassificationLatencyRate,
+		cacheErrorRate:            cfg.CacheErrorRate,
+		upstreamErrorRate:         cfg.UpstreamErrorRate,
+		upstreamErrorStatus:       cfg.UpstreamErrorStatus,
+		random:                    random,
+		sleep:                     time.Sleep,
+	}
+	if f.classificationLatency > 0 && f.classificationLatencyRate == 0 {
+		f.classificationLatencyRate = 1
+	}
+	if f.upstreamErrorStatus == 0 {
+		f.upstreamErrorStatus = http.StatusServiceUnavailable
+	}
+	if f.upstreamErrorStatus < 500 || f.upstreamErrorStatus > 599 {
+		return nil, fmt.Errorf("upstream_error_status %d is not a 5xx status", f.upstreamErrorStatus)
+	}
+	slog.Warn("Fault injection enabled",
+		"classification_latency", f.classificationLatency, "classification_latency_rate", f.classificationLatencyRate,
+		"cache_error_rate", f.cacheErrorRate, "upstream_error_rate", f.upstreamErrorRate)
+	return f, nil
+}
+
+// inject returns whether a fault injected at the given rate hits, counting it
+func (f *faultInjector) inject(fault string, rate float64) bool {
+	if rate <= 0 || f.random() >= rate {
+		return false
+	}
+	metrics.RecordInjectedFault(fault)
+	return true
+}
+
+// delayClassification delays a classifier call
+func (f *faultInjector) delayClassification() {
+	if f != nil && f.inject(faultClassificationLatency, f.classificationLatencyRate) {
+		f.sleep(f.classificationLatency)
+	}
+}
+
+// cacheError returns the error failing a semantic cache call, nil if none
+func (f *faultInjector) cacheError() error {
+	if f != nil && f.inject(faultCacheError, f.cacheErrorRate) {
+		return errInjectedFault
+	}
+	return nil
+}
+
+// upstreamError returns the status of a simulated upstream error answering a
+// routed request instead of forwarding it, 0 if none
+func (f *faultInjector) upstreamError() int {
+	if f != nil && f.inject(faultUpstreamError, f.upstreamErrorRate) {
+		return f.upstreamErrorStatus
+	}
+	return 0
+}
+
+// upstreamErrorResponse answers a request with a simulated upstream error
+// with an OpenAI style error body
+func upstreamErrorResponse(statusCode int) *ext_proc.ProcessingResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": "injected upstream error",
+			"type":    "server_error",
+			"code":    statusCode,
+		},
+	})
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode(statusCode)},
+				Headers: &ext_proc.HeaderMutation{
+					SetHeaders: []*core.HeaderValueOption{
+						{Header: &core.HeaderValue{Key: "content-type", Value: "application/json"}},
+					},
+				},
+				Body: body,
+			},
+		},
+	}
+}
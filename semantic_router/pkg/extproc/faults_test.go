@@ -0,0 +1,94 @@
+package extproc
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestNewFaultInjector(t *testing.T) {
+	if f, err := newFaultInjector(config.FaultInjectionConfig{CacheErrorRate: 1}, rand.Float64); f != nil || err != nil {
+		t.Errorf("disabled injector = %v, %v, want nil", f, err)
+	}
+
+	f, err := newFaultInjector(config.FaultInjectionConfig{Enabled: true, ClassificationLatencyMs: 200}, rand.Float64)
+	if err != nil {
+		t.Fatalf("newFaultInjector: %v", err)
+	}
+	if f.classificationLatencyRate != 1 || f.upstreamErrorStatus != http.StatusServiceUnavailable {
+		t.Errorf("latency rate %v, upstream status %d, want the defaults", f.classificationLatencyRate, f.upstreamErrorStatus)
+	}
+
+	for _, cfg := range []config.FaultInjectionConfig{
+		{Enabled: true, CacheErrorRate: 1.5},
+		{Enabled: true, UpstreamErrorRate: -0.1},
+		{Enabled: true, ClassificationLatencyMs: -1},
+		{Enabled: true, UpstreamErrorStatus: 429},
+	} {
+		if _, err := newFaultInjector(cfg, rand.Float64); err == nil {
+			t.Errorf("newFaultInjector accepted %+v", cfg)
+		}
+	}
+}
+
+func TestProcessInjectedFaults(t *testing.T) {
+	router := newTestRouter(t, true)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	var slept time.Duration
+	router.faults = &faultInjector{
+		classificationLatency:     50 * time.Millisecond,
+		classificationLatencyRate: 1,
+		cacheErrorRate:            1,
+		upstreamErrorStatus:       http.StatusBadGateway,
+		random:                    func() float64 { return 0 },
+		sleep:                     func(d time.Duration) { slept += d },
+	}
+
+	send := func(id string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", id),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+
+	// Failing cache calls leave nothing to hit on the repeated request
+	send("req-1")
+	stream := send("req-2")
+	if stream.responses[1].GetImmediateResponse() != nil {
+		t.Error("repeated request hit the cache despite injected cache errors")
+	}
+	if slept != 100*time.Millisecond {
+		t.Errorf("slept %v, want a delay per classification", slept)
+	}
+
+	// Routed requests are answered with the simulated upstream error
+	router.faults.upstreamErrorRate = 1
+	stream = send("req-3")
+	immediate := stream.responses[1].GetImmediateResponse()
+	if immediate == nil || immediate.GetStatus().GetCode() != http.StatusBadGateway {
+		t.Fatalf("expected a 502 response, got %v", stream.responses[1])
+	}
+	if got := gjson.GetBytes(immediate.GetBody(), "error.type").String(); got != "server_error" {
+		t.Errorf("error type = %q", got)
+	}
+	if record := sink.records[len(sink.records)-1]; record.GetResponseStatus() != http.StatusBadGateway {
+		t.Errorf("decision record status %d, want 502", record.GetResponseStatus())
+	}
+	if pending := router.Cache.PendingCount(); pending != 0 {
+		t.Errorf("%d pending cache entries left", pending)
+	}
+}
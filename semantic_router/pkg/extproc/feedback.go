@@ -0,0 +1,37 @@
+package extproc
+
+import (
+	"log/slog"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/feedback"
+)
+
+// trackFeedback remembers what was decided for a completed request, so
+// feedback posted on it can find its category and cache entry
+func (r *OpenAIRouter) trackFeedback(reqCtx *RequestContext, cacheEntryID string) {
+	if r.Feedback == nil || reqCtx.shadow {
+		return
+	}
+	r.Feedback.Observe(reqCtx.ID, feedback.Request{
+		Category:     reqCtx.routedMatch.Category,
+		CacheEntryID: cacheEntryID,
+	})
+}
+
+// submitFeedback applies feedback posted on a request, evicting the cache
+// entry it was answered from or stored in when the feedback says the
+// response was wrong
+func (r *OpenAIRouter) submitFeedback(requestID, kind string) error {
+	request, err := r.Feedback.Submit(requestID, kind)
+	if err != nil {
+		return err
+	}
+	if kind == feedback.KindCorrect || request.CacheEntryID == "" {
+		return nil
+	}
+	if err := r.Cache.Evict(request.CacheEntryID); err != nil {
+		return err
+	}
+	slog.Info("Evicted cache entry on feedback", "request_id", requestID, "kind", kind, "entry", request.CacheEntryID)
+	return nil
+}
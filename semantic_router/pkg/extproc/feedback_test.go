@@ -0,0 +1,64 @@
+package extproc
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/feedback"
+)
+
+func TestRoutingFeedback(t *testing.T) {
+	const request = `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`
+	router := newTestRouter(t, true)
+	router.Feedback = feedback.New(feedback.Options{Step: 0.25, MaxDrift: 0.5})
+
+	// process runs a request, returning whether it was answered from the cache
+	process := func(id string) bool {
+		t.Helper()
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", id),
+			requestBody(request),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream.responses[1].GetImmediateResponse() != nil
+	}
+
+	if process("req-1") {
+		t.Fatal("first request answered from the cache")
+	}
+	if !process("req-2") {
+		t.Fatal("repeated request not answered from the cache")
+	}
+
+	// Feedback on the cache hit evicts the entry it was answered from
+	if err := router.submitFeedback("req-2", feedback.KindStaleCache); err != nil {
+		t.Fatalf("submitFeedback returned %v", err)
+	}
+	if process("req-3") {
+		t.Error("request answered from an entry reported stale")
+	}
+
+	// Misroutes raise the category's threshold above the classifier's confidence
+	for _, id := range []string{"req-1", "req-3"} {
+		if err := router.submitFeedback(id, feedback.KindMisrouted); err != nil {
+			t.Fatalf("submitFeedback returned %v", err)
+		}
+	}
+	if entries, _ := router.Cache.Entries(); len(entries) != 0 {
+		t.Errorf("cache kept %d entries of misrouted requests", len(entries))
+	}
+	if match := router.findBestModelMatch(slog.Default(), "What is the derivative of x^2?", "en", nil, nil, false); match.Model != "default-model" {
+		t.Errorf("query routed to %s after misroutes, want default-model", match.Model)
+	}
+
+	if err := router.submitFeedback("req-9", feedback.KindMisrouted); err != feedback.ErrUnknownRequest {
+		t.Errorf("feedback on an unknown request returned %v, want ErrUnknownRequest", err)
+	}
+}
@@ -0,0 +1,108 @@
+package extproc
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// newFixtureRouter creates a router routing by utterances and caching with the
+// embeddings recorded in testdata/embeddings.jsonl, without the embedding model
+func newFixtureRouter(t *testing.T) *OpenAIRouter {
+	t.Helper()
+	threshold := float32(0.9)
+	cfg := &config.RouterConfig{
+		DefaultModel: "default-model",
+		Categories: []config.Category{
+			{Name: "math", Models: []string{"math-model"}, Utterances: map[string][]string{
+				"en": {"What is the derivative of this function?"},
+			}},
+			{Name: "law", Models: []string{"law-model"}},
+		},
+		SemanticCache: config.SemanticCacheConfig{
+			Enabled:             true,
+			SimilarityThreshold: &threshold,
+		},
+		Deterministic: config.DeterministicConfig{
+			Enabled:           true,
+			EmbeddingFixtures: "testdata/embeddings.jsonl",
+		},
+	}
+	cfg.BertModel.Threshold = 0.5
+
+	router, err := newRouter(cfg, nil)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+	// Store completed responses inline, for the next request to find
+	router.Cache.Stop()
+	return router
+}
+
+func TestProcessWithEmbeddingFixtures(t *testing.T) {
+	router := newFixtureRouter(t)
+
+	send := func(i int, content string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", fmt.Sprintf("req-%d", i)),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"` + content + `"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+
+	for i, tc := range []struct {
+		content string
+		model   string
+		hit     bool
+	}{
+		{"What is the derivative of x^2?", "math-model", false},
+		// A paraphrase with a recorded embedding close to the first query's
+		{"Find the derivative of x^2.", "", true},
+		{"Who owns this contract?", "law-model", false},
+	} {
+		stream := send(i, tc.content)
+		if hit := stream.responses[1].GetImmediateResponse() != nil; hit != tc.hit {
+			t.Errorf("%q: cache hit %v, want %v", tc.content, hit, tc.hit)
+		}
+		if tc.hit {
+			continue
+		}
+		body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+		if model := gjson.GetBytes(body, "model").String(); model != tc.model {
+			t.Errorf("%q routed to %q, want %q", tc.content, model, tc.model)
+		}
+	}
+}
+
+func TestProcessEmbedsQueryOnce(t *testing.T) {
+	router := newFixtureRouter(t)
+	reused := testutil.ToFloat64(metrics.RequestEmbeddingsReused)
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+	}}
+	if err := router.Process(stream); err != nil && err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if model := gjson.GetBytes(body, "model").String(); model != "math-model" {
+		t.Errorf("routed to %q, want math-model", model)
+	}
+	// Utterance routing reuses the query embedding of the cache lookup
+	if got := testutil.ToFloat64(metrics.RequestEmbeddingsReused) - reused; got != 1 {
+		t.Errorf("reused embeddings increased by %v, want 1", got)
+	}
+}
@@ -0,0 +1,162 @@
+package extproc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// fuzzSeeds are request bodies covering well-formed, exotic and malformed shapes
+var fuzzSeeds = []string{
+	`{"model":"auto","messages":[{"role":"user","content":"What is 2+2?"}]}`,
+	`{"model":"auto","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"bye"}]}`,
+	`{"model":"auto","messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}]}`,
+	`{"model":"auto","messages":[{"role":"user","content":null}],"temperature":0.2,"tools":[{"type":"function"}]}`,
+	`{"model":"auto","messages":[],"response_format":{"type":"json_object"}}`,
+	`{"model":1,"messages":"nope"}`,
+	`{"model":"auto","messages":[{"role":"","content":"\u0000\ud800"}]}`,
+	`{"model":"auto","messages":[{}]}`,
+	`{"model":`,
+	`null`,
+	`[]`,
+	``,
+}
+
+func FuzzParseOpenAIRequest(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, err := parseOpenAIRequest(data)
+		if err != nil {
+			return
+		}
+		if req == nil {
+			t.Fatal("nil request without error")
+		}
+
+		// The cache and the router must agree on whether a body is a valid request
+		model, query, err := cache.ExtractQueryFromOpenAIRequest(data)
+		if err != nil {
+			t.Fatalf("router parsed the body but the cache rejected it: %v", err)
+		}
+		if m, q, err := cache.ExtractQueryFromValidRequest(data); err != nil || m != model || q != query {
+			t.Errorf("extraction without validation = %q, %q, %v, want %q, %q", m, q, err, model, query)
+		}
+		if model != req.Model {
+			t.Errorf("cache model %q != router model %q", model, req.Model)
+		}
+
+		userContent, _ := extractMessageContents(req)
+		if query != userContent {
+			t.Errorf("cache query %q != router user content %q", query, userContent)
+		}
+	})
+}
+
+func FuzzExtractMessageContents(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, err := parseOpenAIRequest(data)
+		if err != nil {
+			return
+		}
+		userContent, nonUserMessages := extractMessageContents(req)
+
+		roled := 0
+		for _, msg := range req.Messages {
+			if msg.Role != "" && msg.Role != "user" {
+				roled++
+			}
+		}
+		if len(nonUserMessages) != roled {
+			t.Errorf("got %d non-user messages, want %d", len(nonUserMessages), roled)
+		}
+		if userContent != "" {
+			found := false
+			for _, msg := range req.Messages {
+				if msg.Role == "user" && msg.Content == userContent {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("user content %q not taken from a user message", userContent)
+			}
+		}
+
+		// Budget sampling must never panic or grow the text
+		for _, strategy := range []string{BudgetStrategyHeadTail, BudgetStrategySystemAndLastUser} {
+			budget := config.ClassificationBudgetConfig{MaxWords: 4, HeadWords: 2, TailWords: 1, Strategy: strategy}
+			text, _ := applyClassificationBudget(budget, req, userContent)
+			if len(text) > len(userContent)+len(getPromptText(req)) {
+				t.Errorf("%s budget grew the text to %d bytes", strategy, len(text))
+			}
+		}
+	})
+}
+
+func FuzzRewriteRequestModel(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed), "math-model", "high")
+	}
+	templates := NewFamilyTemplates(nil)
+	f.Fuzz(func(t *testing.T, data []byte, model, effort string) {
+		// Target model names come from the config and are always valid UTF-8
+		if !utf8.ValidString(model) {
+			return
+		}
+		req, err := parseOpenAIRequest(data)
+		if err != nil {
+			return
+		}
+		messages := append([]ChatMessage(nil), req.Messages...)
+
+		body, err := rewriteRequestModel(req, data, model)
+		if err != nil {
+			t.Fatalf("failed to serialize a parsed request: %v", err)
+		}
+		for _, family := range []string{"openai", "deepseek", "qwen3"} {
+			mutated, err := applyFamilyTemplates(templates, body, family, effort)
+			if err != nil {
+				t.Fatalf("templates for family %s failed: %v", family, err)
+			}
+
+			var reparsed OpenAIRequest
+			if err := json.Unmarshal(mutated, &reparsed); err != nil {
+				t.Fatalf("mutated body for family %s is not valid JSON: %v", family, err)
+			}
+			if reparsed.Model != model {
+				t.Errorf("model = %q, want %q", reparsed.Model, model)
+			}
+			if len(reparsed.Messages) != len(messages) {
+				t.Fatalf("got %d messages, want %d", len(reparsed.Messages), len(messages))
+			}
+			for i := range messages {
+				if !sameMessage(reparsed.Messages[i], messages[i]) {
+					t.Errorf("message %d changed from %+v to %+v", i, messages[i], reparsed.Messages[i])
+				}
+			}
+		}
+	})
+}
+
+// sameMessage compares messages by what they decode to, ignoring how their
+// content parts were serialized
+func sameMessage(a, b ChatMessage) bool {
+	if a.Role != b.Role || a.Content != b.Content || a.Name != b.Name || a.ToolCallID != b.ToolCallID ||
+		!reflect.DeepEqual(a.ToolCalls, b.ToolCalls) || len(a.Parts) != len(b.Parts) || (a.Parts == nil) != (b.Parts == nil) {
+		return false
+	}
+	for i := range a.Parts {
+		if a.Parts[i].Type != b.Parts[i].Type || a.Parts[i].Text != b.Parts[i].Text {
+			return false
+		}
+	}
+	return true
+}
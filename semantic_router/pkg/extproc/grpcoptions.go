@@ -0,0 +1,41 @@
+package extproc
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// grpcServerOptions returns the options of the gRPC server applying the
+// configured limits, leaving the gRPC default of unset ones
+func grpcServerOptions(cfg config.GRPCServerConfig) []grpc.ServerOption {
+	var options []grpc.ServerOption
+	if cfg.MaxRecvMessageBytes > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(cfg.MaxRecvMessageBytes))
+	}
+	if cfg.MaxSendMessageBytes > 0 {
+		options = append(options, grpc.MaxSendMsgSize(cfg.MaxSendMessageBytes))
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		options = append(options, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+
+	params := keepalive.ServerParameters{
+		Time:                  seconds(cfg.KeepaliveTimeSeconds),
+		Timeout:               seconds(cfg.KeepaliveTimeoutSeconds),
+		MaxConnectionAge:      seconds(cfg.MaxConnectionAgeSeconds),
+		MaxConnectionAgeGrace: seconds(cfg.MaxConnectionAgeGraceSeconds),
+	}
+	if params != (keepalive.ServerParameters{}) {
+		options = append(options, grpc.KeepaliveParams(params))
+	}
+	return options
+}
+
+// seconds converts a configured number of seconds, zero for negative ones
+func seconds(n int) time.Duration {
+	return time.Duration(max(n, 0)) * time.Second
+}
@@ -0,0 +1,72 @@
+package extproc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// receivingProcessor ends each stream with the error of its first message
+type receivingProcessor struct {
+	ext_proc.UnimplementedExternalProcessorServer
+}
+
+func (receivingProcessor) Process(stream ext_proc.ExternalProcessor_ProcessServer) error {
+	_, err := stream.Recv()
+	return err
+}
+
+func TestGRPCServerOptions(t *testing.T) {
+	if got := grpcServerOptions(config.GRPCServerConfig{}); len(got) != 0 {
+		t.Errorf("unset config gave %d options, want none", len(got))
+	}
+	if got := grpcServerOptions(config.GRPCServerConfig{KeepaliveTimeSeconds: 60, MaxConnectionAgeSeconds: 600}); len(got) != 1 {
+		t.Errorf("keepalive config gave %d options, want one", len(got))
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer(grpcServerOptions(config.GRPCServerConfig{MaxRecvMessageBytes: 1024})...)
+	ext_proc.RegisterExternalProcessorServer(server, receivingProcessor{})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	for _, tc := range []struct {
+		name      string
+		size      int
+		exhausted bool
+	}{
+		{"within limit", 100, false},
+		{"over limit", 4096, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stream, err := ext_proc.NewExternalProcessorClient(conn).Process(context.Background())
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if err := stream.Send(requestBody(`{"messages":[{"role":"user","content":"` + strings.Repeat("a", tc.size) + `"}]}`)); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			// The processor ends the stream once it received the message
+			if _, err := stream.Recv(); (status.Code(err) == codes.ResourceExhausted) != tc.exhausted {
+				t.Errorf("stream ended with %v, want exhausted %v", err, tc.exhausted)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package extproc
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// Environment of a process taking over listening sockets. LISTEN_FDS and
+// LISTEN_PID follow the systemd socket activation protocol, so the sockets of
+// a systemd socket unit are taken over the same way.
+const (
+	envListenFDs = "LISTEN_FDS"
+	envListenPID = "LISTEN_PID"
+	// Descriptor the new process writes to once it is serving
+	envReadyFD = "SEMANTIC_ROUTER_READY_FD"
+)
+
+// Handed over sockets start after stdin, stdout and stderr
+const firstInheritedFD = 3
+
+// inheritedListeners returns the listening sockets handed over by a previous
+// process or systemd, one per listener spec in order, or nil if there are none
+func inheritedListeners(specs []config.ListenerConfig) ([]net.Listener, error) {
+	value := os.Getenv(envListenFDs)
+	if value == "" {
+		return nil, nil
+	}
+	// Sockets systemd passed to another process
+	if pid := os.Getenv(envListenPID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	os.Unsetenv(envListenFDs)
+	os.Unsetenv(envListenPID)
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid %s %q", envListenFDs, value)
+	}
+	if count != len(specs) {
+		return nil, fmt.Errorf("%d listening sockets handed over but %d listeners configured", count, len(specs))
+	}
+	listeners := make([]net.Listener, 0, count)
+	for i := range count {
+		file := os.NewFile(uintptr(firstInheritedFD+i), fmt.Sprintf("listener %d", i))
+		lis, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("handed over socket %d is not a listener: %w", i, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// handoff starts the binary at path with the listening sockets handed over and
+// waits until the new process is serving. The new process is killed if it does
+// not start serving within timeout.
+func handoff(listeners []net.Listener, path string, args []string, timeout time.Duration) (*os.Process, error) {
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, lis := range listeners {
+		filer, ok := lis.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("cannot hand over %s listener %s", lis.Addr().Network(), lis.Addr())
+		}
+		file, err := filer.File()
+		if err != nil {
+			return nil, fmt.Errorf("failed to hand over %s: %w", lis.Addr(), err)
+		}
+		files = append(files, file)
+	}
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(environWithout(envListenFDs, envListenPID, envReadyFD),
+		fmt.Sprintf("%s=%d", envListenFDs, len(listeners)),
+		fmt.Sprintf("%s=%d", envReadyFD, firstInheritedFD+len(listeners)))
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", path, err)
+	}
+	// Only the new process holds the writer now, so reading fails if it exits
+	readyWriter.Close()
+
+	if err := ready.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		slog.Warn("Cannot time out the handoff", "error", err)
+	}
+	if _, err := ready.Read(make([]byte, 1)); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("new process did not start serving within %s", timeout)
+		}
+		return nil, fmt.Errorf("new process exited before serving: %s", cmd.ProcessState)
+	}
+	return cmd.Process, nil
+}
+
+// notifyReady tells the process that handed its sockets over that this one is
+// serving, so it can drain and exit
+func notifyReady() {
+	value := os.Getenv(envReadyFD)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(envReadyFD)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Error("Invalid ready file descriptor", "env", envReadyFD, "value", value)
+		return
+	}
+	file := os.NewFile(uintptr(fd), "ready")
+	defer file.Close()
+	if _, err := file.Write([]byte{1}); err != nil {
+		slog.Error("Failed to notify the previous process", "error", err)
+	}
+}
+
+// environWithout returns the environment without the given variables
+func environWithout(names ...string) []string {
+	var env []string
+	for _, entry := range os.Environ() {
+		if name, _, _ := strings.Cut(entry, "="); !slices.Contains(names, name) {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// handOver starts a new process with the listening sockets and reports whether
+// it is serving, in which case this one should drain and exit
+func (s *Server) handOver(listeners []net.Listener) bool {
+	timeout := time.Duration(s.router.Config.GracefulRestart.ReadyTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	slog.Info("Starting a new process with the listening sockets")
+	if _, err := handoff(listeners, os.Args[0], os.Args[1:], timeout); err != nil {
+		slog.Error("Handoff failed, continuing to serve", "error", err)
+		return false
+	}
+	// The new process serves the unix sockets now, keep them on close
+	for _, lis := range listeners {
+		if unix, ok := lis.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+	slog.Info("New process is serving, draining streams")
+	return true
+}
@@ -0,0 +1,93 @@
+package extproc
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// TestHandoffHelper is the new process started by TestHandoff
+func TestHandoffHelper(t *testing.T) {
+	mode := os.Getenv("EXTPROC_HANDOFF_HELPER")
+	if mode == "" {
+		t.Skip("only run by TestHandoff")
+	}
+	if mode == "fail" {
+		os.Exit(1)
+	}
+	listeners, err := inheritedListeners([]config.ListenerConfig{{Network: "tcp"}})
+	if err != nil || len(listeners) != 1 {
+		t.Fatalf("inheritedListeners = %v, %v", listeners, err)
+	}
+	notifyReady()
+	conn, err := listeners[0].Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("new process"))
+	conn.Close()
+}
+
+func TestHandoff(t *testing.T) {
+	lis, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-test.run=^TestHandoffHelper$"}
+
+	// A new process failing to start leaves the sockets with the old one
+	t.Setenv("EXTPROC_HANDOFF_HELPER", "fail")
+	if _, err := handoff([]net.Listener{lis}, os.Args[0], args, 10*time.Second); err == nil || !strings.Contains(err.Error(), "exited before serving") {
+		t.Errorf("handoff to a failing process = %v, want it reported", err)
+	}
+
+	t.Setenv("EXTPROC_HANDOFF_HELPER", "serve")
+	process, err := handoff([]net.Listener{lis}, os.Args[0], args, 10*time.Second)
+	if err != nil {
+		t.Fatalf("handoff: %v", err)
+	}
+	// The old process stops accepting and the new one serves the address
+	lis.Close()
+	conn, err := net.Dial("tcp4", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("dial after handoff: %v", err)
+	}
+	reply, _ := io.ReadAll(conn)
+	conn.Close()
+	if string(reply) != "new process" {
+		t.Errorf("reply after handoff = %q, want it from the new process", reply)
+	}
+	if state, err := process.Wait(); err != nil || !state.Success() {
+		t.Errorf("new process exited with %v, %v", state, err)
+	}
+}
+
+func TestInheritedListeners(t *testing.T) {
+	specs := []config.ListenerConfig{{Network: "tcp", Address: ":50051"}}
+	tests := []struct {
+		name    string
+		fds     string
+		pid     string
+		wantErr bool
+	}{
+		{name: "nothing handed over"},
+		{name: "sockets of another process", fds: "1", pid: "1"},
+		{name: "invalid count", fds: "x", wantErr: true},
+		{name: "count not matching the listeners", fds: "2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envListenFDs, tt.fds)
+			t.Setenv(envListenPID, tt.pid)
+			listeners, err := inheritedListeners(specs)
+			if (err != nil) != tt.wantErr || listeners != nil {
+				t.Errorf("inheritedListeners = %v, %v, want error %v", listeners, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package extproc
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Kinds of cross-stream state swept by the janitor
+const (
+	stateKindCachePending = "cache_pending"
+	stateKindAttempts     = "attempts"
+	stateKindToolCalls    = "tool_calls"
+	stateKindSessions     = "sessions"
+)
+
+// stateJanitor periodically expires the state kept across ext_proc streams.
+// Per-request state lives in each stream's RequestContext and goes with it,
+// but the pending cache entries, retry attempts, tool calls and conversations
+// outlive their stream and are otherwise only pruned as new requests arrive.
+type stateJanitor struct {
+	interval   time.Duration
+	pendingTTL time.Duration
+	sweeps     map[string]func() int
+	started    atomic.Bool
+	stop       chan struct{}
+	done       chan struct{}
+	once       sync.Once
+}
+
+// newStateJanitor creates a janitor sweeping the router's cross-stream state
+func newStateJanitor(r *OpenAIRouter, cfg config.RequestStateConfig) *stateJanitor {
+	j := &stateJanitor{
+		interval:   time.Duration(cfg.SweepIntervalSeconds) * time.Second,
+		pendingTTL: time.Duration(cfg.PendingTTLSeconds) * time.Second,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if j.interval <= 0 {
+		j.interval = time.Minute
+	}
+	if j.pendingTTL <= 0 {
+		j.pendingTTL = 10 * time.Minute
+	}
+	j.sweeps = map[string]func() int{
+		stateKindCachePending: func() int { return r.Cache.ExpirePending(j.pendingTTL) },
+		stateKindAttempts:     func() int { return r.attempts.sweep() },
+		stateKindToolCalls:    func() int { return r.toolCalls.sweep() },
+		stateKindSessions:     func() int { return r.sessions.sweep() },
+	}
+	return j
+}
+
+// Start sweeps the state every interval in the background
+func (j *stateJanitor) Start() {
+	j.started.Store(true)
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				j.sweep()
+			}
+		}
+	}()
+}
+
+// Stop stops sweeping
+func (j *stateJanitor) Stop() {
+	j.once.Do(func() {
+		close(j.stop)
+		if j.started.Load() {
+			<-j.done
+		}
+	})
+}
+
+// sweep expires each kind of state once
+func (j *stateJanitor) sweep() {
+	for kind, sweep := range j.sweeps {
+		if expired := sweep(); expired > 0 {
+			slog.Info("Expired request state", "kind", kind, "entries", expired)
+			metrics.RecordRequestStateExpired(kind, expired)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package extproc
+
+import (
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of per-request state tracked by the leak checker
+const (
+	leakKindCachePending = "cache_pending"
+)
+
+// trackedItem is a piece of per-request state and where it was created
+type trackedItem struct {
+	created time.Time
+	stack   string
+}
+
+// leakChecker asserts that per-request state returns to its baseline whenever
+// the router goes idle, logging any leftover items with their creation stacks.
+// It is only created in debug builds (go build -tags debug); a nil checker is a no-op.
+type leakChecker struct {
+	mu            sync.Mutex
+	activeStreams int
+	baseline      map[string]int
+	items         map[string]map[string]trackedItem
+	// counts reports the current size of each kind of tracked state
+	counts func() map[string]int
+}
+
+// newLeakChecker returns a leak checker, or nil when leak checking is disabled
+func newLeakChecker(enabled bool, counts func() map[string]int) *leakChecker {
+	if !enabled {
+		return nil
+	}
+	slog.Info("Leak checker enabled, per-request state is verified whenever the router is idle")
+	return &leakChecker{
+		items:  make(map[string]map[string]trackedItem),
+		counts: counts,
+	}
+}
+
+// track records the creation of a piece of per-request state
+func (l *leakChecker) track(kind, key string) {
+	if l == nil {
+		return
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.items[kind] == nil {
+		l.items[kind] = make(map[string]trackedItem)
+	}
+	l.items[kind][key] = trackedItem{created: time.Now(), stack: string(buf)}
+}
+
+// release records that a piece of per-request state was cleaned up
+func (l *leakChecker) release(kind, key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.items[kind], key)
+}
+
+// streamStarted records a new ext_proc stream, capturing the baseline when the router was idle
+func (l *leakChecker) streamStarted() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.activeStreams == 0 && l.baseline == nil {
+		l.baseline = l.counts()
+	}
+	l.activeStreams++
+}
+
+// streamEnded records the end of a stream and checks the invariants once no streams remain
+func (l *leakChecker) streamEnded() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.activeStreams--
+	if l.activeStreams < 0 {
+		slog.Error("Leak check: stream counter went negative", "streams", l.activeStreams)
+		l.activeStreams = 0
+	}
+	if l.activeStreams == 0 {
+		l.check()
+	}
+}
+
+// check compares the tracked state to the baseline and logs suspects for kinds
+// that did not return to it. Returns the kinds above baseline. Assumes the caller holds the lock.
+func (l *leakChecker) check() []string {
+	var leaked []string
+	counts := l.counts()
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		count, base := counts[kind], l.baseline[kind]
+		if count <= base {
+			continue
+		}
+		leaked = append(leaked, kind)
+		slog.Error("Leak check: entries left after going idle", "kind", kind, "entries", count, "baseline", base)
+		for key, item := range l.items[kind] {
+			slog.Error("Leak suspect", "kind", kind, "key", key, "age", time.Since(item.created).Round(time.Millisecond),
+				"stack", strings.TrimSpace(item.stack))
+		}
+	}
+	return leaked
+}
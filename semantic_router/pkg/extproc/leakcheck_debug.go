@@ -0,0 +1,6 @@
+//go:build debug
+
+package extproc
+
+// leakCheckEnabled turns on the soak-mode leak checker in debug builds
+const leakCheckEnabled = true
@@ -0,0 +1,67 @@
+package extproc
+
+import (
+	"reflect"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+func TestLeakCheckerDisabledIsNoop(t *testing.T) {
+	l := newLeakChecker(false, nil)
+	if l != nil {
+		t.Fatal("expected a nil checker when disabled")
+	}
+	// Methods on a nil checker must not panic
+	l.streamStarted()
+	l.track(leakKindCachePending, "req-1")
+	l.release(leakKindCachePending, "req-1")
+	l.streamEnded()
+}
+
+func TestLeakCheckerAfterSyntheticTraffic(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests []*ext_proc.ProcessingRequest
+		leaked   []string
+	}{
+		{
+			name: "completed request",
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(`{"model":"phi4","messages":[{"role":"user","content":"Capital of Spain?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			},
+		},
+		{
+			// The pending cache entry is dropped with the stream's request context
+			name: "stream aborted before the response",
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-2"),
+				requestBody(`{"model":"phi4","messages":[{"role":"user","content":"Capital of Spain?"}]}`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			router.leaks = newLeakChecker(true, router.leakCounts)
+
+			router.leaks.streamStarted()
+			_ = router.Process(&fakeStream{requests: tt.requests})
+			router.leaks.mu.Lock()
+			leaked := router.leaks.check()
+			router.leaks.mu.Unlock()
+			router.leaks.streamEnded()
+
+			if !reflect.DeepEqual(leaked, tt.leaked) {
+				t.Errorf("leaked = %v, want %v", leaked, tt.leaked)
+			}
+			if router.leaks.activeStreams != 0 {
+				t.Errorf("active streams = %d, want 0", router.leaks.activeStreams)
+			}
+		})
+	}
+}
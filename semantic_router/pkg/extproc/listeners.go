@@ -0,0 +1,71 @@
+package extproc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/reuseport"
+)
+
+// listenerNetworks are the networks a listener can bind
+var listenerNetworks = map[string]bool{"tcp": true, "tcp4": true, "tcp6": true, "unix": true}
+
+// listenerSpecs returns the configured listeners, or one on every interface at
+// the given port when none are configured
+func listenerSpecs(listeners []config.ListenerConfig, port int) []config.ListenerConfig {
+	if len(listeners) == 0 {
+		return []config.ListenerConfig{{Network: "tcp", Address: fmt.Sprintf(":%d", port)}}
+	}
+	specs := make([]config.ListenerConfig, len(listeners))
+	for i, spec := range listeners {
+		if spec.Network == "" {
+			spec.Network = "tcp"
+		}
+		specs[i] = spec
+	}
+	return specs
+}
+
+// listen binds every listener, closing those already bound if one fails. With
+// reusePort the TCP listeners are bound with SO_REUSEPORT.
+func listen(specs []config.ListenerConfig, reusePort bool) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(specs))
+	for _, spec := range specs {
+		lis, err := listenOne(spec, reusePort)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s %s: %w", spec.Network, spec.Address, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+func listenOne(spec config.ListenerConfig, reusePort bool) (net.Listener, error) {
+	if !listenerNetworks[spec.Network] {
+		return nil, fmt.Errorf("unsupported network %q, expected tcp, tcp4, tcp6 or unix", spec.Network)
+	}
+	if spec.Network == "unix" {
+		// Remove the socket a previous process left behind, but nothing else
+		if info, err := os.Lstat(spec.Address); err == nil {
+			if info.Mode().Type() != fs.ModeSocket {
+				return nil, fmt.Errorf("%s exists and is not a socket", spec.Address)
+			}
+			if err := os.Remove(spec.Address); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if reusePort {
+		return reuseport.Listen(spec.Network, spec.Address)
+	}
+	return net.Listen(spec.Network, spec.Address)
+}
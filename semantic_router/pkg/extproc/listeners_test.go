@@ -0,0 +1,72 @@
+package extproc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestListenerSpecs(t *testing.T) {
+	specs := listenerSpecs(nil, 50051)
+	if len(specs) != 1 || specs[0] != (config.ListenerConfig{Network: "tcp", Address: ":50051"}) {
+		t.Errorf("default specs = %v, want tcp :50051", specs)
+	}
+	specs = listenerSpecs([]config.ListenerConfig{{Address: "127.0.0.1:1"}, {Network: "unix", Address: "/tmp/s"}}, 50051)
+	if specs[0].Network != "tcp" || specs[1].Network != "unix" {
+		t.Errorf("specs = %v, want the network defaulted to tcp", specs)
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "extproc.sock")
+	// A socket left behind by a previous process is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, ok := stale.(*net.UnixListener); ok {
+		l.SetUnlinkOnClose(false)
+	}
+	stale.Close()
+
+	listeners, err := listen([]config.ListenerConfig{
+		{Network: "tcp4", Address: "127.0.0.1:0"},
+		{Network: "unix", Address: socket},
+	}, false)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	for _, lis := range listeners {
+		conn, err := net.Dial(lis.Addr().Network(), lis.Addr().String())
+		if err != nil {
+			t.Errorf("dial %s: %v", lis.Addr(), err)
+			continue
+		}
+		conn.Close()
+		lis.Close()
+	}
+
+	regular := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(regular, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []config.ListenerConfig{
+		{Network: "udp", Address: "127.0.0.1:0"},
+		{Network: "unix", Address: regular},
+	}
+	for _, spec := range tests {
+		if listeners, err := listen([]config.ListenerConfig{{Network: "tcp", Address: "127.0.0.1:0"}, spec}, false); err == nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			t.Errorf("listen accepted %v", spec)
+		}
+	}
+	if _, err := os.Stat(regular); err != nil {
+		t.Errorf("listen removed a regular file at a socket address: %v", err)
+	}
+}
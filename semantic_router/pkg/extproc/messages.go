@@ -0,0 +1,166 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Content part types of multimodal messages
+const (
+	contentPartText = "text"
+)
+
+// ContentPart is a part of a message whose content is an array, such as text,
+// an image_url or an input_audio part
+type ContentPart struct {
+	Type string `json:"type"`
+	// Text of a text part
+	Text string `json:"text,omitempty"`
+
+	// The part as sent and its text, so parts are serialized again with every
+	// field they were sent with
+	raw     json.RawMessage
+	rawText string
+}
+
+// UnmarshalJSON keeps the part as sent besides decoding its type and text
+func (p *ContentPart) UnmarshalJSON(data []byte) error {
+	var part struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &part); err != nil {
+		return err
+	}
+	p.Type, p.Text = part.Type, part.Text
+	p.raw, p.rawText = bytes.Clone(data), part.Text
+	return nil
+}
+
+// MarshalJSON serializes the part as sent, with its text replaced if it changed
+func (p ContentPart) MarshalJSON() ([]byte, error) {
+	if p.raw == nil {
+		type part ContentPart
+		return encodeRequestBody(part(p))
+	}
+	if p.Type != contentPartText || p.Text == p.rawText {
+		return p.raw, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(p.raw, &fields); err != nil {
+		return nil, err
+	}
+	text, err := encodeRequestBody(p.Text)
+	if err != nil {
+		return nil, err
+	}
+	fields["text"] = text
+	return encodeRequestBody(fields)
+}
+
+// ToolCall is a call of a tool made by an assistant message
+type ToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+		// Arguments as a JSON encoded string
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// UnmarshalJSON decodes a message whose content is a string, null, or an
+// array of content parts. Of content parts, Content is the text of the text
+// parts, one per line.
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	type fields ChatMessage
+	var msg struct {
+		fields
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = ChatMessage(msg.fields)
+	content := bytes.TrimSpace(msg.Content)
+	switch {
+	case len(content) == 0 || string(content) == "null":
+	case content[0] == '"':
+		return json.Unmarshal(content, &m.Content)
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &m.Parts); err != nil {
+			return fmt.Errorf("invalid content parts: %w", err)
+		}
+		if m.Parts == nil {
+			m.Parts = []ContentPart{}
+		}
+		m.Content = partsText(m.Parts)
+	default:
+		return fmt.Errorf("message content must be a string or an array of content parts, got %s", gjson.ParseBytes(content).Type)
+	}
+	return nil
+}
+
+// MarshalJSON serializes a message with its content parts if it has any,
+// else with its text content, null for a tool-calling message without text
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	type fields ChatMessage
+	msg := struct {
+		fields
+		Content interface{} `json:"content"`
+	}{fields: fields(m)}
+	switch {
+	case m.Parts != nil:
+		msg.Content = m.Parts
+	case m.Content != "" || len(m.ToolCalls) == 0:
+		msg.Content = m.Content
+	}
+	return encodeRequestBody(msg)
+}
+
+// contentJSON returns the content of the message as it is serialized
+func (m *ChatMessage) contentJSON() (json.RawMessage, error) {
+	if m.Parts != nil {
+		return encodeRequestBody(m.Parts)
+	}
+	return encodeRequestBody(m.Content)
+}
+
+// texts returns the texts of the message, its content or the text of each of
+// its text parts, to be scanned or rewritten in place. Call syncContent after
+// changing them.
+func (m *ChatMessage) texts() []*string {
+	if m.Parts == nil {
+		return []*string{&m.Content}
+	}
+	var texts []*string
+	for i := range m.Parts {
+		if m.Parts[i].Type == contentPartText {
+			texts = append(texts, &m.Parts[i].Text)
+		}
+	}
+	return texts
+}
+
+// syncContent updates the text content of a message with content parts after
+// their texts changed
+func (m *ChatMessage) syncContent() {
+	if m.Parts != nil {
+		m.Content = partsText(m.Parts)
+	}
+}
+
+// partsText joins the text of the text parts, one per line
+func partsText(parts []ContentPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == contentPartText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
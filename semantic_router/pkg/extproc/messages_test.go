@@ -0,0 +1,125 @@
+package extproc
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestChatMessageUnmarshal(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		want      string
+		wantParts int
+	}{
+		{name: "string", message: `{"role":"user","content":"hi"}`, want: "hi"},
+		{name: "null", message: `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]}`},
+		{name: "absent", message: `{"role":"assistant"}`},
+		{name: "text parts", message: `{"role":"user","content":[{"type":"text","text":"what is"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},{"type":"text","text":"in this image?"}]}`, want: "what is\nin this image?", wantParts: 3},
+		{name: "no text parts", message: `{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"AAAA","format":"wav"}}]}`, wantParts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg ChatMessage
+			if err := json.Unmarshal([]byte(tt.message), &msg); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if msg.Content != tt.want || len(msg.Parts) != tt.wantParts {
+				t.Errorf("content %q with %d parts, want %q with %d", msg.Content, len(msg.Parts), tt.want, tt.wantParts)
+			}
+		})
+	}
+
+	for _, message := range []string{`{"content":1}`, `{"content":{}}`, `{"content":["hi"]}`, `{"content":[{"type":"text","text":1}]}`} {
+		var msg ChatMessage
+		if err := json.Unmarshal([]byte(message), &msg); err == nil {
+			t.Errorf("Unmarshal accepted %s", message)
+		}
+	}
+}
+
+func TestChatMessageMarshal(t *testing.T) {
+	var msg ChatMessage
+	sent := `{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png","detail":"high"}},{"type":"text","text":"describe","cache_control":{"type":"ephemeral"}}]}`
+	if err := json.Unmarshal([]byte(sent), &msg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	*msg.texts()[0] = "describe <EMAIL_1>"
+	msg.syncContent()
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if got := gjson.GetBytes(encoded, "content.0.image_url.detail").String(); got != "high" {
+		t.Errorf("image part detail = %q, want it kept", got)
+	}
+	if got := gjson.GetBytes(encoded, "content.1.text").String(); got != "describe <EMAIL_1>" {
+		t.Errorf("text part = %q, want the rewritten text", got)
+	}
+	if !gjson.GetBytes(encoded, "content.1.cache_control").Exists() {
+		t.Error("rewritten text part lost its other fields")
+	}
+	if msg.Content != "describe <EMAIL_1>" {
+		t.Errorf("content = %q, want the rewritten text", msg.Content)
+	}
+
+	call := ChatMessage{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function"}}}
+	encoded, err = json.Marshal(call)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if content := gjson.GetBytes(encoded, "content"); content.Type != gjson.Null || !content.Exists() {
+		t.Errorf("tool-calling message content = %s, want null", content.Raw)
+	}
+}
+
+func TestProcessMultimodalRequest(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.PII = config.PIIConfig{
+		Enabled:  true,
+		Types:    map[string]config.PIITypeConfig{"EMAIL": {Action: "tokenize"}},
+		Patterns: []config.PIIPatternConfig{{Type: "EMAIL"}},
+	}
+	var err error
+	if router.PII, err = newPIIDetector(router.Config.PII, nil); err != nil {
+		t.Fatalf("newPIIDetector: %v", err)
+	}
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","tools":[{"type":"function","function":{"name":"plot","parameters":{"type":"object"}}}],"messages":[` +
+			`{"role":"user","content":[{"type":"text","text":"Plot the derivative of x^2"},{"type":"image_url","image_url":{"url":"https://example.com/graph.png","detail":"low"}}]},` +
+			`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"plot","arguments":"{\"f\":\"2x\"}"}}]},` +
+			`{"role":"tool","tool_call_id":"call_1","content":"done"},` +
+			`{"role":"user","name":"jane","content":[{"type":"text","text":"Now the derivative of x^3, and mail it to jane@example.com"}]}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	forwarded := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	for path, want := range map[string]string{
+		"model":                                 "math-model",
+		"tools.0.function.name":                 "plot",
+		"messages.0.content.1.image_url.url":    "https://example.com/graph.png",
+		"messages.0.content.1.image_url.detail": "low",
+		"messages.1.tool_calls.0.id":            "call_1",
+		"messages.2.tool_call_id":               "call_1",
+		"messages.3.name":                       "jane",
+		"messages.3.content.0.text":             "Now the derivative of x^3, and mail it to <EMAIL_1>",
+	} {
+		if got := gjson.GetBytes(forwarded, path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if content := gjson.GetBytes(forwarded, "messages.1.content"); content.Type != gjson.Null {
+		t.Errorf("tool-calling message content = %s, want null", content.Raw)
+	}
+}
@@ -0,0 +1,73 @@
+package extproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// metricsServer serves the Prometheus metrics over HTTP
+type metricsServer struct {
+	server *http.Server
+}
+
+// newMetricsServer creates the metrics listener of the config, on the default
+// port when it sets none, or nil when the metrics are not served
+func newMetricsServer(cfg config.MetricsServerConfig, defaultPort int) *metricsServer {
+	if !cfg.IsEnabled() {
+		return nil
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.Handler())
+	return &metricsServer{server: &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}}
+}
+
+// start serves the metrics in the background. After a restart the previous
+// process holds the port until it has drained, so binding is retried until
+// the port is released.
+func (m *metricsServer) start() {
+	slog.Info("Starting metrics server", "address", m.server.Addr)
+	go func() {
+		for attempt := 0; ; attempt++ {
+			err := m.server.ListenAndServe()
+			if errors.Is(err, http.ErrServerClosed) {
+				return
+			}
+			if !errors.Is(err, syscall.EADDRINUSE) {
+				slog.Error("Metrics server error", "error", err)
+				return
+			}
+			if attempt == 0 {
+				slog.Warn("Metrics port in use, retrying until it is released", "address", m.server.Addr)
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+}
+
+// stop shuts down the metrics server
+func (m *metricsServer) stop(ctx context.Context) {
+	if err := m.server.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping metrics server", "error", err)
+	}
+}
@@ -0,0 +1,37 @@
+package extproc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestNewMetricsServer(t *testing.T) {
+	disabled := false
+	if server := newMetricsServer(config.MetricsServerConfig{Enabled: &disabled}, 9190); server != nil {
+		t.Error("disabled metrics are served")
+	}
+
+	server := newMetricsServer(config.MetricsServerConfig{}, 9190)
+	if server == nil || server.server.Addr != ":9190" {
+		t.Fatalf("metrics server without a port = %+v, want one on the default port", server)
+	}
+
+	server = newMetricsServer(config.MetricsServerConfig{Port: 9300, Path: "/internal/metrics"}, 9190)
+	if server.server.Addr != ":9300" {
+		t.Errorf("metrics server address = %s, want :9300", server.server.Addr)
+	}
+	for path, want := range map[string]int{"/internal/metrics": http.StatusOK, "/metrics": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+		if want == http.StatusOK && !strings.Contains(rec.Body.String(), "llm_") {
+			t.Errorf("GET %s served no router metrics", path)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Headers clients override routing with for a single request
+const (
+	// true forwards the request as sent, without classification or the semantic cache
+	routerBypassHeader = "x-router-bypass"
+	// Model the request is routed to instead of the one it would be classified to
+	routerModelHeader = "x-router-model"
+	// true skips the semantic cache lookup
+	cacheBypassHeader = "x-cache-bypass"
+)
+
+// Routing overrides, as reported in metrics and decision records
+const (
+	OverrideBypass      = "bypass"
+	OverrideModelPin    = "model_pin"
+	OverrideCacheBypass = "cache_bypass"
+)
+
+// Outcomes of override headers
+const (
+	overrideApplied = "applied"
+	// The header was ignored, as routing.overrides does not allow the override
+	overrideIgnored = "ignored"
+	// The request was rejected, pinning a model not in the allowlist
+	overrideRejected = "rejected"
+)
+
+// routingOverrides are the routing overrides a request asked for and the
+// config allows
+type routingOverrides struct {
+	bypass      bool
+	cacheBypass bool
+	pinnedModel string
+}
+
+// skipsCache returns whether the request is neither looked up in nor stored in the semantic cache
+func (o routingOverrides) skipsCache() bool {
+	return o.bypass || o.cacheBypass
+}
+
+// names returns the applied overrides
+func (o routingOverrides) names() []string {
+	var names []string
+	if o.bypass {
+		names = append(names, OverrideBypass)
+	}
+	if o.pinnedModel != "" {
+		names = append(names, OverrideModelPin)
+	}
+	if o.cacheBypass {
+		names = append(names, OverrideCacheBypass)
+	}
+	return names
+}
+
+// requestOverrides resolves the override headers of a request against
+// routing.overrides. Headers of overrides the config does not allow are
+// ignored, while pins of models outside the allowlist are an error, so
+// clients don't silently get another model than they asked for.
+func (r *OpenAIRouter) requestOverrides(headers map[string]string) (routingOverrides, error) {
+	cfg := r.Config.Routing.Overrides
+	var overrides routingOverrides
+	resolve := func(override string, allowed bool) bool {
+		outcome := overrideIgnored
+		if allowed {
+			outcome = overrideApplied
+		}
+		metrics.RecordRoutingOverride(override, outcome)
+		return allowed
+	}
+
+	if on, _ := strconv.ParseBool(headers[routerBypassHeader]); on {
+		overrides.bypass = resolve(OverrideBypass, cfg.AllowBypass)
+	}
+	if on, _ := strconv.ParseBool(headers[cacheBypassHeader]); on && !overrides.bypass {
+		overrides.cacheBypass = resolve(OverrideCacheBypass, cfg.AllowCacheBypass)
+	}
+	if model := strings.TrimSpace(headers[routerModelHeader]); model != "" && !overrides.bypass {
+		if len(cfg.PinnableModels) == 0 {
+			resolve(OverrideModelPin, false)
+		} else if !slices.Contains(cfg.PinnableModels, model) {
+			metrics.RecordRoutingOverride(OverrideModelPin, overrideRejected)
+			return overrides, fmt.Errorf("model %s may not be pinned with %s", model, routerModelHeader)
+		} else if resolve(OverrideModelPin, true) {
+			overrides.pinnedModel = model
+		}
+	}
+	return overrides, nil
+}
+
+// overrideErrorResponse rejects a request with an invalid routing override
+// with an OpenAI style error body
+func overrideErrorResponse(err error) *ext_proc.ProcessingResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"type":    "invalid_request_error",
+			"code":    http.StatusBadRequest,
+		},
+	})
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode_BadRequest},
+				Headers: &ext_proc.HeaderMutation{
+					SetHeaders: []*core.HeaderValueOption{
+						{Header: &core.HeaderValue{Key: "content-type", Value: "application/json"}},
+					},
+				},
+				Body: body,
+			},
+		},
+	}
+}
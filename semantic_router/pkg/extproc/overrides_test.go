@@ -0,0 +1,140 @@
+package extproc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+)
+
+func TestProcessAppliesRoutingOverrides(t *testing.T) {
+	router := newFixtureRouter(t)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	router.Config.Routing.Overrides = config.RoutingOverridesConfig{
+		AllowBypass:      true,
+		AllowCacheBypass: true,
+		PinnableModels:   []string{"law-model"},
+	}
+
+	send := func(i int, headers ...string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders(append([]string{"x-request-id", fmt.Sprintf("req-%d", i)}, headers...)...),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+	// Caches the response for the requests below
+	send(0)
+
+	for i, tc := range []struct {
+		name      string
+		headers   []string
+		hit       bool
+		model     string
+		overrides []string
+	}{
+		{"no override", nil, true, "", nil},
+		{"cache bypass", []string{"x-cache-bypass", "true"}, false, "math-model", []string{OverrideCacheBypass}},
+		{"routing bypass", []string{"x-router-bypass", "true"}, false, "", []string{OverrideBypass}},
+		// Pinned requests are cached apart, with requests naming the model
+		{"model pin", []string{"x-router-model", "law-model"}, false, "law-model", []string{OverrideModelPin}},
+	} {
+		stream := send(i+1, tc.headers...)
+		if hit := stream.responses[1].GetImmediateResponse() != nil; hit != tc.hit {
+			t.Errorf("%s: cache hit %v, want %v", tc.name, hit, tc.hit)
+		}
+		if !tc.hit {
+			body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+			if model := gjson.GetBytes(body, "model").String(); model != tc.model {
+				t.Errorf("%s: routed to %q, want %q", tc.name, model, tc.model)
+			}
+		}
+		if got := sink.records[len(sink.records)-1].GetRouting().GetOverrides(); !reflect.DeepEqual(got, tc.overrides) {
+			t.Errorf("%s: decision record overrides %v, want %v", tc.name, got, tc.overrides)
+		}
+	}
+
+	rejected := testutil.ToFloat64(metrics.RoutingOverrides.WithLabelValues(OverrideModelPin, overrideRejected))
+	immediate := send(10, "x-router-model", "math-model").responses[1].GetImmediateResponse()
+	if immediate.GetStatus().GetCode() != http.StatusBadRequest {
+		t.Errorf("pin of a model outside the allowlist answered with %v, want 400", immediate)
+	}
+	if got := testutil.ToFloat64(metrics.RoutingOverrides.WithLabelValues(OverrideModelPin, overrideRejected)) - rejected; got != 1 {
+		t.Errorf("rejected pins increased by %v, want 1", got)
+	}
+
+	// Overrides the config does not allow are ignored
+	router.Config.Routing.Overrides = config.RoutingOverridesConfig{}
+	ignored := testutil.ToFloat64(metrics.RoutingOverrides.WithLabelValues(OverrideBypass, overrideIgnored))
+	for i, headers := range [][]string{
+		{"x-router-bypass", "true"},
+		{"x-cache-bypass", "true"},
+		{"x-router-model", "law-model"},
+	} {
+		if send(20+i, headers...).responses[1].GetImmediateResponse() == nil {
+			t.Errorf("%v: not answered from the cache with overrides disallowed", headers)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.RoutingOverrides.WithLabelValues(OverrideBypass, overrideIgnored)) - ignored; got != 1 {
+		t.Errorf("ignored bypasses increased by %v, want 1", got)
+	}
+}
+
+func TestPinnedRequestsCachedApartUnderPolicies(t *testing.T) {
+	router := newTestRouter(t, true)
+	router.Config.Routing.Overrides = config.RoutingOverridesConfig{PinnableModels: []string{"law-model"}}
+	geo, err := policy.NewGeo(policy.GeoOptions{
+		RegionHeader: "x-client-region",
+		Policies:     []config.GeoPolicy{{ClientRegion: "eu", AllowedModelRegions: []string{"eu"}}},
+		ModelRegions: map[string]string{"math-model": "eu", "law-model": "eu", "default-model": "eu"},
+	})
+	if err != nil {
+		t.Fatalf("NewGeo: %v", err)
+	}
+	router.Geo = geo
+
+	send := func(i int, headers ...string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders(append([]string{"x-request-id", fmt.Sprintf("req-%d", i), "x-client-region", "eu"}, headers...)...),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+
+	// Caches the auto-routed response under the region's scope
+	send(0)
+	for i, tc := range []struct {
+		name    string
+		headers []string
+		hit     bool
+	}{
+		{"pinned", []string{"x-router-model", "law-model"}, false},
+		{"pinned again", []string{"x-router-model", "law-model"}, true},
+		{"auto-routed", nil, true},
+	} {
+		stream := send(i+1, tc.headers...)
+		if hit := stream.responses[1].GetImmediateResponse() != nil; hit != tc.hit {
+			t.Errorf("%s: cache hit %v, want %v", tc.name, hit, tc.hit)
+		}
+	}
+}
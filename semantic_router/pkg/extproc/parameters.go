@@ -0,0 +1,239 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// Adjustments made to the generation parameters of a request for its model
+const (
+	parameterClamped  = "clamped"
+	parameterStripped = "stripped"
+	parameterSet      = "set"
+	parameterForced   = "forced"
+	parameterAppended = "appended"
+)
+
+// requiredParameters are fields a request can't be forwarded without
+var requiredParameters = []string{"model", "messages", "prompt", "input"}
+
+// parameterAdjustment is a change made to a parameter of a request
+type parameterAdjustment struct {
+	Parameter string
+	Action    string
+}
+
+// validateParameterConstraints checks the parameter constraints and overrides
+// of the models: a parameter is either stripped or bounded, by bounds in order,
+// an override has a value and is either forced or appended, a string or a
+// list, and required fields can't be constrained or overridden
+func validateParameterConstraints(cfg *config.RouterConfig) error {
+	for model, params := range cfg.ModelConfig {
+		for parameter, override := range params.ParamOverrides {
+			switch {
+			case parameter == "" || slices.Contains(requiredParameters, parameter):
+				return fmt.Errorf("invalid param_overrides for model %s: %q cannot be overridden", model, parameter)
+			case override.Value == nil:
+				return fmt.Errorf("invalid param_overrides for model %s: %s needs a value", model, parameter)
+			case override.Force && override.Append:
+				return fmt.Errorf("invalid param_overrides for model %s: %s cannot be both forced and appended", model, parameter)
+			case override.Append && listItems(override.Value) == nil:
+				return fmt.Errorf("invalid param_overrides for model %s: %s is appended, so its value must be a string or a list", model, parameter)
+			}
+			if _, err := json.Marshal(override.Value); err != nil {
+				return fmt.Errorf("invalid param_overrides for model %s: %s: %w", model, parameter, err)
+			}
+		}
+		for parameter, constraint := range params.Parameters {
+			switch {
+			case parameter == "" || slices.Contains(requiredParameters, parameter):
+				return fmt.Errorf("invalid parameters for model %s: %q cannot be constrained", model, parameter)
+			case constraint.Strip && (constraint.Min != nil || constraint.Max != nil):
+				return fmt.Errorf("invalid parameters for model %s: %s cannot be both stripped and bounded", model, parameter)
+			case !constraint.Strip && constraint.Min == nil && constraint.Max == nil:
+				return fmt.Errorf("invalid parameters for model %s: %s needs strip, min or max", model, parameter)
+			case constraint.Min != nil && constraint.Max != nil && *constraint.Min > *constraint.Max:
+				return fmt.Errorf("invalid parameters for model %s: %s min is above max", model, parameter)
+			}
+		}
+	}
+	return nil
+}
+
+// constrainParameters applies the parameter constraints of a model to the body
+// forwarded to it: stripped parameters are removed and numeric parameters out
+// of bounds are clamped. Bounded parameters that are not numbers are left for
+// the backend to reject. The body is returned unchanged, with no adjustments,
+// when every parameter satisfies its constraint.
+func constrainParameters(body []byte, constraints map[string]config.ParameterConstraintConfig) ([]byte, []parameterAdjustment, error) {
+	parameters := make([]string, 0, len(constraints))
+	for parameter := range constraints {
+		parameters = append(parameters, parameter)
+	}
+	sort.Strings(parameters)
+
+	var adjustments []parameterAdjustment
+	values := make(map[string]float64)
+	for _, parameter := range parameters {
+		constraint := constraints[parameter]
+		value := gjson.GetBytes(body, gjson.Escape(parameter))
+		if !value.Exists() {
+			continue
+		}
+		if constraint.Strip {
+			adjustments = append(adjustments, parameterAdjustment{parameter, parameterStripped})
+			continue
+		}
+		if value.Type != gjson.Number {
+			continue
+		}
+		clamped := value.Float()
+		if constraint.Min != nil && clamped < *constraint.Min {
+			clamped = *constraint.Min
+		}
+		if constraint.Max != nil && clamped > *constraint.Max {
+			clamped = *constraint.Max
+		}
+		if clamped != value.Float() {
+			values[parameter] = clamped
+			adjustments = append(adjustments, parameterAdjustment{parameter, parameterClamped})
+		}
+	}
+	if len(adjustments) == 0 {
+		return body, nil, nil
+	}
+
+	request, err := decodeRequestObject(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+	for _, adjustment := range adjustments {
+		if adjustment.Action == parameterStripped {
+			delete(request, adjustment.Parameter)
+		} else {
+			request[adjustment.Parameter] = values[adjustment.Parameter]
+		}
+	}
+	constrained, err := encodeRequestBody(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	return constrained, adjustments, nil
+}
+
+// adjustParameters applies the parameter overrides and then the parameter
+// constraints of a model to the body forwarded to it
+func adjustParameters(body []byte, params config.ModelParams) ([]byte, []parameterAdjustment, error) {
+	overridden, overrides, err := overrideParameters(body, params.ParamOverrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	constrained, constraints, err := constrainParameters(overridden, params.Parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+	return constrained, append(overrides, constraints...), nil
+}
+
+// overrideParameters applies the parameter overrides of a model to the body
+// forwarded to it: parameters the request doesn't set are set, forced ones are
+// replaced and appended ones extended with the items the request lacks. The
+// body is returned unchanged, with no adjustments, when no override changes it.
+func overrideParameters(body []byte, overrides map[string]config.ParamOverrideConfig) ([]byte, []parameterAdjustment, error) {
+	parameters := make([]string, 0, len(overrides))
+	for parameter := range overrides {
+		parameters = append(parameters, parameter)
+	}
+	sort.Strings(parameters)
+
+	var adjustments []parameterAdjustment
+	values := make(map[string]interface{})
+	for _, parameter := range parameters {
+		override := overrides[parameter]
+		value := gjson.GetBytes(body, gjson.Escape(parameter))
+		switch {
+		case !value.Exists() || value.Type == gjson.Null:
+			values[parameter] = override.Value
+			adjustments = append(adjustments, parameterAdjustment{parameter, parameterSet})
+		case override.Append:
+			current := listItems(value.Value())
+			if current == nil {
+				// Neither a string nor a list, left for the backend to reject
+				continue
+			}
+			merged := current
+			for _, item := range listItems(override.Value) {
+				if !containsValue(merged, item) {
+					merged = append(merged, item)
+				}
+			}
+			if len(merged) > len(current) {
+				values[parameter] = merged
+				adjustments = append(adjustments, parameterAdjustment{parameter, parameterAppended})
+			}
+		case override.Force:
+			if !sameJSON([]byte(value.Raw), override.Value) {
+				values[parameter] = override.Value
+				adjustments = append(adjustments, parameterAdjustment{parameter, parameterForced})
+			}
+		}
+	}
+	if len(adjustments) == 0 {
+		return body, nil, nil
+	}
+
+	request, err := decodeRequestObject(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+	for parameter, value := range values {
+		request[parameter] = value
+	}
+	overridden, err := encodeRequestBody(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	return overridden, adjustments, nil
+}
+
+// listItems returns the items of a list value, a string being a list of one,
+// or nil when the value is neither
+func listItems(value interface{}) []interface{} {
+	switch value := value.(type) {
+	case string:
+		return []interface{}{value}
+	case []interface{}:
+		return append([]interface{}{}, value...)
+	}
+	return nil
+}
+
+// containsValue returns whether a list holds a value equal to the given one
+// once encoded as JSON
+func containsValue(items []interface{}, value interface{}) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(items, func(item interface{}) bool { return sameJSON(encoded, item) })
+}
+
+// sameJSON returns whether raw JSON encodes the same as a value
+func sameJSON(raw []byte, value interface{}) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, raw); err != nil {
+		return false
+	}
+	return bytes.Equal(compacted.Bytes(), encoded)
+}
@@ -0,0 +1,223 @@
+package extproc
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func bound(v float64) *float64 { return &v }
+
+func TestValidateParameterConstraints(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameter  string
+		constraint config.ParameterConstraintConfig
+		wantErr    bool
+	}{
+		{"clamped", "temperature", config.ParameterConstraintConfig{Min: bound(0), Max: bound(2)}, false},
+		{"stripped", "logit_bias", config.ParameterConstraintConfig{Strip: true}, false},
+		{"empty", "temperature", config.ParameterConstraintConfig{}, true},
+		{"stripped and bounded", "temperature", config.ParameterConstraintConfig{Strip: true, Max: bound(1)}, true},
+		{"min above max", "temperature", config.ParameterConstraintConfig{Min: bound(2), Max: bound(1)}, true},
+		{"required field", "messages", config.ParameterConstraintConfig{Strip: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.RouterConfig{ModelConfig: map[string]config.ModelParams{
+				"phi4": {Parameters: map[string]config.ParameterConstraintConfig{tt.parameter: tt.constraint}},
+			}}
+			if err := validateParameterConstraints(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateParameterConstraints = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateParamOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		parameter string
+		override  config.ParamOverrideConfig
+		wantErr   bool
+	}{
+		{"set", "temperature", config.ParamOverrideConfig{Value: 0.2}, false},
+		{"forced", "max_tokens", config.ParamOverrideConfig{Value: 1024, Force: true}, false},
+		{"appended", "stop", config.ParamOverrideConfig{Value: []interface{}{"###"}, Append: true}, false},
+		{"no value", "temperature", config.ParamOverrideConfig{Force: true}, true},
+		{"forced and appended", "stop", config.ParamOverrideConfig{Value: "###", Force: true, Append: true}, true},
+		{"appended number", "max_tokens", config.ParamOverrideConfig{Value: 1024, Append: true}, true},
+		{"required field", "model", config.ParamOverrideConfig{Value: "phi4"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.RouterConfig{ModelConfig: map[string]config.ModelParams{
+				"phi4": {ParamOverrides: map[string]config.ParamOverrideConfig{tt.parameter: tt.override}},
+			}}
+			if err := validateParameterConstraints(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateParameterConstraints = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOverrideParameters(t *testing.T) {
+	overrides := map[string]config.ParamOverrideConfig{
+		"temperature": {Value: 0.2},
+		"max_tokens":  {Value: 512, Force: true},
+		"stop":        {Value: []interface{}{"###", "END"}, Append: true},
+	}
+	tests := []struct {
+		name            string
+		body            string
+		wantBody        string
+		wantAdjustments []parameterAdjustment
+	}{
+		{
+			name:     "unset parameters",
+			body:     `{"model":"phi4"}`,
+			wantBody: `{"max_tokens":512,"model":"phi4","stop":["###","END"],"temperature":0.2}`,
+			wantAdjustments: []parameterAdjustment{
+				{"max_tokens", parameterSet},
+				{"stop", parameterSet},
+				{"temperature", parameterSet},
+			},
+		},
+		{
+			name:     "client values",
+			body:     `{"model":"phi4","temperature":0.9,"max_tokens":4096,"stop":"\n\n"}`,
+			wantBody: `{"max_tokens":512,"model":"phi4","stop":["\n\n","###","END"],"temperature":0.9}`,
+			wantAdjustments: []parameterAdjustment{
+				{"max_tokens", parameterForced},
+				{"stop", parameterAppended},
+			},
+		},
+		{
+			name:     "unchanged",
+			body:     `{"model":"phi4","temperature":1,"max_tokens":512,"stop":["END","###"]}`,
+			wantBody: `{"model":"phi4","temperature":1,"max_tokens":512,"stop":["END","###"]}`,
+		},
+		{
+			name:     "null is unset",
+			body:     `{"model":"phi4","temperature":null,"max_tokens":512,"stop":["END","###"]}`,
+			wantBody: `{"max_tokens":512,"model":"phi4","stop":["END","###"],"temperature":0.2}`,
+			wantAdjustments: []parameterAdjustment{
+				{"temperature", parameterSet},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, adjustments, err := overrideParameters([]byte(tt.body), overrides)
+			if err != nil {
+				t.Fatalf("overrideParameters returned %v", err)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+			if !reflect.DeepEqual(adjustments, tt.wantAdjustments) {
+				t.Errorf("adjustments = %v, want %v", adjustments, tt.wantAdjustments)
+			}
+		})
+	}
+}
+
+func TestConstrainParameters(t *testing.T) {
+	constraints := map[string]config.ParameterConstraintConfig{
+		"temperature": {Min: bound(0), Max: bound(1.5)},
+		"top_p":       {Max: bound(1)},
+		"logit_bias":  {Strip: true},
+	}
+	tests := []struct {
+		name            string
+		body            string
+		wantBody        string
+		wantAdjustments []parameterAdjustment
+	}{
+		{
+			name:     "within bounds",
+			body:     `{"model":"phi4","temperature":0.7,"top_p":1}`,
+			wantBody: `{"model":"phi4","temperature":0.7,"top_p":1}`,
+		},
+		{
+			name:     "clamped and stripped",
+			body:     `{"model":"phi4","temperature":3,"logit_bias":{"50256":-100},"seed":12345678901234567}`,
+			wantBody: `{"model":"phi4","seed":12345678901234567,"temperature":1.5}`,
+			wantAdjustments: []parameterAdjustment{
+				{"logit_bias", parameterStripped},
+				{"temperature", parameterClamped},
+			},
+		},
+		{
+			name:            "clamped up",
+			body:            `{"model":"phi4","temperature":-1}`,
+			wantBody:        `{"model":"phi4","temperature":0}`,
+			wantAdjustments: []parameterAdjustment{{"temperature", parameterClamped}},
+		},
+		{
+			name:     "not a number",
+			body:     `{"model":"phi4","temperature":"hot"}`,
+			wantBody: `{"model":"phi4","temperature":"hot"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, adjustments, err := constrainParameters([]byte(tt.body), constraints)
+			if err != nil {
+				t.Fatalf("constrainParameters returned %v", err)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+			if !reflect.DeepEqual(adjustments, tt.wantAdjustments) {
+				t.Errorf("adjustments = %v, want %v", adjustments, tt.wantAdjustments)
+			}
+		})
+	}
+}
+
+func TestProcessConstrainsParameters(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.ModelConfig = map[string]config.ModelParams{
+		"math-model": {Parameters: map[string]config.ParameterConstraintConfig{"temperature": {Max: bound(1)}}},
+	}
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","temperature":1.8,"messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+	}}
+	if err := router.Process(stream); !errors.Is(err, io.EOF) {
+		t.Fatalf("Process returned %v", err)
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if model, temperature := gjson.GetBytes(body, "model").String(), gjson.GetBytes(body, "temperature").Float(); model != "math-model" || temperature != 1 {
+		t.Errorf("forwarded model %s with temperature %v, want math-model with 1: %s", model, temperature, body)
+	}
+}
+
+func TestProcessOverridesParameters(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.ModelConfig = map[string]config.ModelParams{
+		"math-model": {
+			ParamOverrides: map[string]config.ParamOverrideConfig{"max_tokens": {Value: 4096, Force: true}},
+			// Constraints apply to the overridden request
+			Parameters: map[string]config.ParameterConstraintConfig{"max_tokens": {Max: bound(2048)}},
+		},
+	}
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","max_tokens":100,"messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+	}}
+	if err := router.Process(stream); !errors.Is(err, io.EOF) {
+		t.Fatalf("Process returned %v", err)
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if maxTokens := gjson.GetBytes(body, "max_tokens").Int(); maxTokens != 2048 {
+		t.Errorf("forwarded max_tokens %d, want 2048: %s", maxTokens, body)
+	}
+}
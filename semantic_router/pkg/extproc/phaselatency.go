@@ -0,0 +1,64 @@
+package extproc
+
+import (
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Phases of a stream the router's processing latency is measured by
+const (
+	phaseRequestHeaders   = "request_headers"
+	phaseRequestBody      = "request_body"
+	phaseRequestTrailers  = "request_trailers"
+	phaseResponseHeaders  = "response_headers"
+	phaseResponseBody     = "response_body"
+	phaseResponseTrailers = "response_trailers"
+)
+
+// processingPhase returns the phase of a message
+func processingPhase(req *ext_proc.ProcessingRequest) string {
+	switch req.Request.(type) {
+	case *ext_proc.ProcessingRequest_RequestHeaders:
+		return phaseRequestHeaders
+	case *ext_proc.ProcessingRequest_RequestBody:
+		return phaseRequestBody
+	case *ext_proc.ProcessingRequest_RequestTrailers:
+		return phaseRequestTrailers
+	case *ext_proc.ProcessingRequest_ResponseHeaders:
+		return phaseResponseHeaders
+	case *ext_proc.ProcessingRequest_ResponseBody:
+		return phaseResponseBody
+	case *ext_proc.ProcessingRequest_ResponseTrailers:
+		return phaseResponseTrailers
+	}
+	return ""
+}
+
+// phaseTimedStream records how long the router takes to answer each message
+// of a stream, from receiving it to sending the response
+type phaseTimedStream struct {
+	ext_proc.ExternalProcessor_ProcessServer
+	// Phase of the message waiting for its response, empty when none is
+	phase    string
+	received time.Time
+}
+
+func (s *phaseTimedStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	req, err := s.ExternalProcessor_ProcessServer.Recv()
+	if err == nil {
+		s.phase = processingPhase(req)
+		s.received = time.Now()
+	}
+	return req, err
+}
+
+func (s *phaseTimedStream) Send(resp *ext_proc.ProcessingResponse) error {
+	if s.phase != "" {
+		metrics.RecordProcessingPhaseLatency(s.phase, time.Since(s.received).Seconds())
+		s.phase = ""
+	}
+	return s.ExternalProcessor_ProcessServer.Send(resp)
+}
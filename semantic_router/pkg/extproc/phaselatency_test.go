@@ -0,0 +1,41 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestProcessRecordsPhaseLatencyAndRoutingScore(t *testing.T) {
+	router := newTestRouter(t, false)
+	phases := []string{phaseRequestHeaders, phaseRequestBody, phaseResponseHeaders, phaseResponseBody}
+	before := make(map[string]uint64)
+	for _, phase := range phases {
+		before[phase], _ = histogramState(t, metrics.ProcessingPhaseLatency.WithLabelValues(phase))
+	}
+	scores, scoreSum := histogramState(t, metrics.RoutingScore.WithLabelValues(config.RoutingStrategyClassifier, "math"))
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-phases"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	for _, phase := range phases {
+		if count, _ := histogramState(t, metrics.ProcessingPhaseLatency.WithLabelValues(phase)); count-before[phase] != 1 {
+			t.Errorf("%s latency observations = %d, want 1", phase, count-before[phase])
+		}
+	}
+	count, sum := histogramState(t, metrics.RoutingScore.WithLabelValues(config.RoutingStrategyClassifier, "math"))
+	if count-scores != 1 || sum-scoreSum < 0.89 || sum-scoreSum > 0.91 {
+		t.Errorf("math routing score observations = %d totaling %v, want 1 of 0.9", count-scores, sum-scoreSum)
+	}
+}
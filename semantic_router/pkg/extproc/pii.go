@@ -0,0 +1,233 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/pii"
+)
+
+// piiOutcome is the outcome of scanning a request's messages for PII
+type piiOutcome struct {
+	// The request body with PII redacted, nil when nothing was redacted
+	body []byte
+	// Types of the PII blocking the request, sorted
+	blocked []string
+	// Placeholders of the tokenized PII, nil when nothing was tokenized
+	tokens *pii.Tokens
+}
+
+// scanRequestPII scans the content of every message of a tenant's request for
+// PII, each text part of multimodal messages separately, redacting or
+// tokenizing it in the parsed request and returning the redacted body.
+// Tokenized PII gets the same placeholder across messages.
+func (r *OpenAIRouter) scanRequestPII(req *OpenAIRequest, body []byte, tenant string) (piiOutcome, error) {
+	var outcome piiOutcome
+	redacted := make(map[int]ChatMessage)
+	blocked := make(map[string]bool)
+	tokens := pii.NewTokens()
+	for i, msg := range req.Messages {
+		msg.Parts = slices.Clone(msg.Parts)
+		changed := false
+		for _, text := range msg.texts() {
+			scan, err := r.PII.Scan(*text, tenant, tokens)
+			if err != nil {
+				metrics.RecordPIIDetection("", "error")
+				return outcome, err
+			}
+			for _, entity := range scan.Entities {
+				metrics.RecordPIIDetection(entity.Type, string(entity.Action))
+			}
+			for _, piiType := range scan.Blocked {
+				if !blocked[piiType] {
+					blocked[piiType] = true
+					outcome.blocked = append(outcome.blocked, piiType)
+				}
+			}
+			if scan.Redacted() {
+				*text, changed = scan.Text, true
+			}
+		}
+		if changed {
+			msg.syncContent()
+			redacted[i] = msg
+		}
+	}
+	if len(outcome.blocked) > 0 {
+		sort.Strings(outcome.blocked)
+		return outcome, nil
+	}
+	if len(redacted) == 0 {
+		return outcome, nil
+	}
+
+	var redactedBody []byte
+	var err error
+	if _, ok := promptFields[req.endpoint]; ok {
+		// The messages of legacy completions and embeddings are their prompts
+		texts := make([]string, len(req.Messages))
+		for i, msg := range req.Messages {
+			if redactedMsg, ok := redacted[i]; ok {
+				msg = redactedMsg
+			}
+			texts[i] = msg.Content
+		}
+		redactedBody, err = redactPrompts(body, req.endpoint, texts)
+	} else {
+		contents := make(map[int]json.RawMessage, len(redacted))
+		for i, msg := range redacted {
+			content, err := msg.contentJSON()
+			if err != nil {
+				return outcome, err
+			}
+			contents[i] = content
+		}
+		redactedBody, err = redactMessages(body, contents)
+	}
+	if err != nil {
+		return outcome, err
+	}
+	for i, msg := range redacted {
+		req.Messages[i] = msg
+	}
+	outcome.body = redactedBody
+	if tokens.Len() > 0 {
+		outcome.tokens = tokens
+	}
+	return outcome, nil
+}
+
+// redactMessages replaces the content of messages of a request body by index,
+// keeping every other field of the request
+func redactMessages(body []byte, contents map[int]json.RawMessage) ([]byte, error) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(request["messages"], &messages); err != nil {
+		return nil, fmt.Errorf("failed to parse request messages: %w", err)
+	}
+	for i, content := range contents {
+		if i >= len(messages) {
+			return nil, fmt.Errorf("message %d out of range", i)
+		}
+		messages[i]["content"] = content
+	}
+	encoded, err := encodeRequestBody(messages)
+	if err != nil {
+		return nil, err
+	}
+	request["messages"] = encoded
+	return encodeRequestBody(request)
+}
+
+// piiErrorResponse rejects a request over PII with an OpenAI style error body,
+// listing the PII types that caused it
+func piiErrorResponse(statusCode int, errorType, message string, piiTypes []string) *ext_proc.ProcessingResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message":   message,
+			"type":      errorType,
+			"code":      statusCode,
+			"pii_types": piiTypes,
+		},
+	})
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode(statusCode)},
+				Headers: &ext_proc.HeaderMutation{
+					SetHeaders: []*core.HeaderValueOption{
+						{
+							Header: &core.HeaderValue{
+								Key:   "content-type",
+								Value: "application/json",
+							},
+						},
+					},
+				},
+				Body: body,
+			},
+		},
+	}
+}
+
+// piiBlockResponse rejects a request containing PII of blocked types
+func piiBlockResponse(piiTypes []string) *ext_proc.ProcessingResponse {
+	message := fmt.Sprintf("The request contains personal information that is not allowed: %s", strings.Join(piiTypes, ", "))
+	return piiErrorResponse(http.StatusForbidden, "pii_violation", message, piiTypes)
+}
+
+// piiUnavailableResponse rejects a request that could not be scanned for PII
+func piiUnavailableResponse() *ext_proc.ProcessingResponse {
+	return piiErrorResponse(http.StatusServiceUnavailable, "pii_detection_unavailable",
+		"The request could not be checked for personal information", []string{})
+}
+
+// newPIIDetector builds the PII detector from the config, nil when PII
+// detection is disabled. Without a token classifier PII is only detected by
+// the configured patterns.
+func newPIIDetector(cfg config.PIIConfig, classifyTokens func(text string) ([]candle_binding.TokenLabel, error)) (*pii.Detector, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	actions := make(map[string]pii.Action, len(cfg.Types))
+	for piiType, typeCfg := range cfg.Types {
+		actions[piiType] = pii.Action(typeCfg.Action)
+	}
+	patterns, err := newPIIPatterns(cfg.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	tenantPatterns := make(map[string][]pii.Pattern, len(cfg.TenantPatterns))
+	for tenant, patternCfgs := range cfg.TenantPatterns {
+		if tenantPatterns[tenant], err = newPIIPatterns(patternCfgs); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+	}
+	detector, err := pii.New(pii.Options{
+		ClassifyTokens: classifyTokens,
+		Patterns:       patterns,
+		TenantPatterns: tenantPatterns,
+		Actions:        actions,
+		DefaultAction:  pii.Action(cfg.DefaultAction),
+		Threshold:      cfg.Threshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+	mode := "model"
+	if classifyTokens == nil {
+		mode = "patterns"
+	} else if len(patterns) > 0 || len(tenantPatterns) > 0 {
+		mode = "model and patterns"
+	}
+	slog.Info("PII detection enabled", "mode", mode, "types", len(cfg.Types))
+	return detector, nil
+}
+
+// newPIIPatterns compiles the configured PII patterns
+func newPIIPatterns(cfgs []config.PIIPatternConfig) ([]pii.Pattern, error) {
+	patterns := make([]pii.Pattern, 0, len(cfgs))
+	for _, patternCfg := range cfgs {
+		pattern, err := pii.NewPattern(patternCfg.Type, patternCfg.Regex)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
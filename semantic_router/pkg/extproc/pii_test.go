@@ -0,0 +1,240 @@
+package extproc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/flags"
+)
+
+// fakePIIClassifier labels every occurrence of jane@example.com as an email
+// and of 123-45-6789 as an SSN
+func fakePIIClassifier(text string) ([]candle_binding.TokenLabel, error) {
+	var labels []candle_binding.TokenLabel
+	for word, label := range map[string]string{"jane@example.com": "B-EMAIL", "123-45-6789": "B-SSN"} {
+		if i := strings.Index(text, word); i >= 0 {
+			labels = append(labels, candle_binding.TokenLabel{Label: label, Start: i, End: i + len(word), Confidence: 0.95})
+		}
+	}
+	return labels, nil
+}
+
+func TestProcessPII(t *testing.T) {
+	tests := []struct {
+		name       string
+		classify   func(text string) ([]candle_binding.TokenLabel, error)
+		patterns   []config.PIIPatternConfig
+		failOpen   bool
+		disabled   bool
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "blocked",
+			classify:   fakePIIClassifier,
+			body:       `{"model":"auto","messages":[{"role":"user","content":"My SSN is 123-45-6789"}]}`,
+			wantStatus: 403,
+			wantBody:   `"pii_types":["SSN"]`,
+		},
+		{
+			name:     "redacted without rerouting",
+			classify: fakePIIClassifier,
+			body:     `{"model":"phi4","temperature":0.2,"messages":[{"role":"user","content":"Mail jane@example.com"}]}`,
+			wantBody: `{"messages":[{"content":"Mail [EMAIL]","role":"user"}],"model":"phi4","temperature":0.2}`,
+		},
+		{
+			name:     "redacted and rerouted",
+			classify: fakePIIClassifier,
+			body:     `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2? Mail jane@example.com"}]}`,
+			wantBody: `"content":"What is the derivative of x^2? Mail [EMAIL]"`,
+		},
+		{
+			name:       "blocked by a pattern without a model",
+			patterns:   []config.PIIPatternConfig{{Type: "SSN"}, {Type: "EMAIL"}},
+			body:       `{"model":"auto","messages":[{"role":"user","content":"My SSN is 123-45-6789"}]}`,
+			wantStatus: 403,
+			wantBody:   `"pii_types":["SSN"]`,
+		},
+		{
+			name:     "redacted by a pattern without a model",
+			patterns: []config.PIIPatternConfig{{Type: "SSN"}, {Type: "EMAIL"}},
+			body:     `{"model":"phi4","messages":[{"role":"user","content":"Mail jane@example.com"}]}`,
+			wantBody: `"content":"Mail [EMAIL]"`,
+		},
+		{
+			name:     "stage disabled",
+			classify: fakePIIClassifier,
+			disabled: true,
+			body:     `{"model":"phi4","messages":[{"role":"user","content":"My SSN is 123-45-6789"}]}`,
+		},
+		{
+			name:     "clean",
+			classify: fakePIIClassifier,
+			body:     `{"model":"phi4","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+		},
+		{
+			name:       "detection failure",
+			classify:   func(string) ([]candle_binding.TokenLabel, error) { return nil, errors.New("model not loaded") },
+			body:       `{"model":"phi4","messages":[{"role":"user","content":"Mail jane@example.com"}]}`,
+			wantStatus: 503,
+			wantBody:   `"type":"pii_detection_unavailable"`,
+		},
+		{
+			name:     "detection failure failing open",
+			classify: func(string) ([]candle_binding.TokenLabel, error) { return nil, errors.New("model not loaded") },
+			failOpen: true,
+			body:     `{"model":"phi4","messages":[{"role":"user","content":"Mail jane@example.com"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			router.Config.PII = config.PIIConfig{
+				Enabled:  true,
+				FailOpen: tt.failOpen,
+				Types:    map[string]config.PIITypeConfig{"SSN": {Action: "block"}},
+				Patterns: tt.patterns,
+			}
+			var err error
+			if router.PII, err = newPIIDetector(router.Config.PII, tt.classify); err != nil {
+				t.Fatalf("newPIIDetector: %v", err)
+			}
+			if err := router.Flags.Set(flags.StagePII, !tt.disabled); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(tt.body),
+			}}
+			if err := router.Process(stream); err != nil && err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			response := stream.responses[1]
+			if immediate := response.GetImmediateResponse(); tt.wantStatus != 0 {
+				if got := int(immediate.GetStatus().GetCode()); got != tt.wantStatus {
+					t.Fatalf("status = %d, want %d", got, tt.wantStatus)
+				}
+				if !strings.Contains(string(immediate.GetBody()), tt.wantBody) {
+					t.Errorf("body = %s, want it to contain %s", immediate.GetBody(), tt.wantBody)
+				}
+				if router.Cache.PendingCount() != 0 {
+					t.Errorf("rejected request left %d pending cache entries", router.Cache.PendingCount())
+				}
+				return
+			} else if immediate != nil {
+				t.Fatalf("request rejected with %d: %s", immediate.GetStatus().GetCode(), immediate.GetBody())
+			}
+
+			forwarded := response.GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+			if tt.wantBody == "" {
+				if forwarded != nil && strings.Contains(string(forwarded), "[") {
+					t.Errorf("clean request was rewritten: %s", forwarded)
+				}
+				return
+			}
+			if !strings.Contains(string(forwarded), tt.wantBody) {
+				t.Errorf("forwarded body = %s, want it to contain %s", forwarded, tt.wantBody)
+			}
+			if query := gjson.GetBytes(forwarded, "messages.0.content").String(); strings.Contains(query, "jane@example.com") {
+				t.Errorf("forwarded body still contains the email: %s", forwarded)
+			}
+		})
+	}
+}
+
+func TestProcessPIIRollout(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.PII = config.PIIConfig{
+		Enabled:  true,
+		Types:    map[string]config.PIITypeConfig{"SSN": {Action: "block"}},
+		Patterns: []config.PIIPatternConfig{{Type: "SSN"}},
+	}
+	var err error
+	if router.PII, err = newPIIDetector(router.Config.PII, nil); err != nil {
+		t.Fatalf("newPIIDetector: %v", err)
+	}
+	if err := router.Flags.SetRollout(flags.StagePII, flags.Rollout{StartPercent: 50, TargetPercent: 50}); err != nil {
+		t.Fatalf("SetRollout: %v", err)
+	}
+
+	// Only requests in the treated cohort are scanned
+	blocked := 0
+	for i := 0; i < 40; i++ {
+		id := fmt.Sprintf("req-%d", i)
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", id),
+			requestBody(`{"model":"phi4","messages":[{"role":"user","content":"My SSN is 123-45-6789"}]}`),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		cohort, _ := router.Flags.Cohort(flags.StagePII, id)
+		if rejected := stream.responses[1].GetImmediateResponse() != nil; rejected != (cohort == flags.CohortTreated) {
+			t.Errorf("request %s in the %s cohort rejected = %v", id, cohort, rejected)
+		} else if rejected {
+			blocked++
+		}
+	}
+	if blocked == 0 || blocked == 40 {
+		t.Errorf("blocked %d of 40 requests, want about half", blocked)
+	}
+}
+
+func TestProcessPIITokenization(t *testing.T) {
+	router := newTestRouter(t, true)
+	router.Config.PII = config.PIIConfig{
+		Enabled:  true,
+		Types:    map[string]config.PIITypeConfig{"EMAIL": {Action: "tokenize"}},
+		Patterns: []config.PIIPatternConfig{{Type: "EMAIL"}},
+	}
+	var err error
+	if router.PII, err = newPIIDetector(router.Config.PII, nil); err != nil {
+		t.Fatalf("newPIIDetector: %v", err)
+	}
+	const completion = `{"id":"c1","object":"chat.completion","model":"math-model","choices":[{"message":{"role":"assistant","content":"Sent the derivative to <EMAIL_1>"}}]}`
+	request := func(email string) string {
+		return `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2? Mail ` + email + `"}]}`
+	}
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(request("jane@example.com")),
+		responseHeaders("200"),
+		responseBody(completion, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	forwarded := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if query := gjson.GetBytes(forwarded, "messages.0.content").String(); query != "What is the derivative of x^2? Mail <EMAIL_1>" {
+		t.Errorf("forwarded query = %q, want the email tokenized", query)
+	}
+	restored := stream.responses[3].GetResponseBody().GetResponse().GetBodyMutation().GetBody()
+	if content := gjson.GetBytes(restored, "choices.0.message.content").String(); content != "Sent the derivative to jane@example.com" {
+		t.Errorf("response content = %q, want the email restored", content)
+	}
+
+	// The cached response is restored with the PII of the request it answers
+	stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-2"),
+		requestBody(request("joe@example.com")),
+	}}
+	if err := router.Process(stream); err != nil {
+		t.Fatalf("Process returned %v", err)
+	}
+	cached := stream.responses[1].GetImmediateResponse().GetBody()
+	if content := gjson.GetBytes(cached, "choices.0.message.content").String(); content != "Sent the derivative to joe@example.com" {
+		t.Errorf("cached response content = %q, want the second email restored", content)
+	}
+}
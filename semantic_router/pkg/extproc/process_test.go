@@ -0,0 +1,879 @@
+package extproc
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/embeddings"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/endpoints"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/discovery"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/errorbudget"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/flags"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tokenbudget"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden ProcessingResponse fixtures")
+
+// fakeStream replays a fixed sequence of ProcessingRequests and records the responses
+type fakeStream struct {
+	grpc.ServerStream
+	requests  []*ext_proc.ProcessingRequest
+	responses []*ext_proc.ProcessingResponse
+}
+
+func (s *fakeStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *fakeStream) Send(resp *ext_proc.ProcessingResponse) error {
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+func (s *fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+// goldenFile is the on-disk format of a golden fixture
+type goldenFile struct {
+	Responses []json.RawMessage `json:"responses"`
+	Error     string            `json:"error,omitempty"`
+}
+
+func requestHeaders(pairs ...string) *ext_proc.ProcessingRequest {
+	headers := &core.HeaderMap{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		headers.Headers = append(headers.Headers, &core.HeaderValue{Key: pairs[i], RawValue: []byte(pairs[i+1])})
+	}
+	return &ext_proc.ProcessingRequest{
+		Request: &ext_proc.ProcessingRequest_RequestHeaders{
+			RequestHeaders: &ext_proc.HttpHeaders{Headers: headers},
+		},
+	}
+}
+
+func requestBody(body string) *ext_proc.ProcessingRequest {
+	return &ext_proc.ProcessingRequest{
+		Request: &ext_proc.ProcessingRequest_RequestBody{
+			RequestBody: &ext_proc.HttpBody{Body: []byte(body), EndOfStream: true},
+		},
+	}
+}
+
+func responseHeaders(statusCode string) *ext_proc.ProcessingRequest {
+	return &ext_proc.ProcessingRequest{
+		Request: &ext_proc.ProcessingRequest_ResponseHeaders{
+			ResponseHeaders: &ext_proc.HttpHeaders{Headers: &core.HeaderMap{Headers: []*core.HeaderValue{
+				{Key: ":status", RawValue: []byte(statusCode)},
+				{Key: "content-type", RawValue: []byte("application/json")},
+			}}},
+		},
+	}
+}
+
+func responseBody(body string, endOfStream bool) *ext_proc.ProcessingRequest {
+	return &ext_proc.ProcessingRequest{
+		Request: &ext_proc.ProcessingRequest_ResponseBody{
+			ResponseBody: &ext_proc.HttpBody{Body: []byte(body), EndOfStream: endOfStream},
+		},
+	}
+}
+
+func responseTrailers() *ext_proc.ProcessingRequest {
+	return &ext_proc.ProcessingRequest{
+		Request: &ext_proc.ProcessingRequest_ResponseTrailers{ResponseTrailers: &ext_proc.HttpTrailers{}},
+	}
+}
+
+// fakeEmbedding maps text to a unit vector keyed on its first word, so queries
+// sharing a first word are identical for the cache
+func fakeEmbedding(text string) ([]float32, error) {
+	embedding := make([]float32, 8)
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 0 {
+		return embedding, nil
+	}
+	embedding[len(fields[0])%len(embedding)] = 1
+	return embedding, nil
+}
+
+// fakeClassifier classifies text mentioning "derivative" as math and anything else as law
+func fakeClassifier(text string) (candle_binding.ClassResult, error) {
+	if strings.Contains(text, "derivative") {
+		return candle_binding.ClassResult{Class: 0, Confidence: 0.9, RunnerUpClass: 1, RunnerUpConfidence: 0.1}, nil
+	}
+	return candle_binding.ClassResult{Class: 1, Confidence: 0.8, RunnerUpClass: 0, RunnerUpConfidence: 0.2}, nil
+}
+
+func newTestRouter(t testing.TB, cacheEnabled bool) *OpenAIRouter {
+	t.Helper()
+	threshold := float32(0.9)
+	cfg := &config.RouterConfig{
+		DefaultModel: "default-model",
+		Categories: []config.Category{
+			{Name: "math", Models: []string{"math-model"}},
+			{Name: "law", Models: []string{"law-model"}},
+		},
+		SemanticCache: config.SemanticCacheConfig{
+			Enabled:             cacheEnabled,
+			SimilarityThreshold: &threshold,
+		},
+	}
+	cfg.Classifier.Threshold = 0.5
+
+	mapping := &CategoryMapping{
+		CategoryToIdx: map[string]int{"math": 0, "law": 1},
+		IdxToCategory: map[string]string{"0": "math", "1": "law"},
+	}
+
+	router, err := newRouter(cfg, mapping)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+	router.classify = fakeClassifier
+	router.Cache = cache.NewSemanticCache(cache.SemanticCacheOptions{
+		SimilarityThreshold: threshold,
+		Enabled:             cacheEnabled,
+		EmbedFunc:           fakeEmbedding,
+	})
+	return router
+}
+
+const completionBody = `{"id":"c1","object":"chat.completion","created":1,"model":"math-model","usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+
+func TestProcessGolden(t *testing.T) {
+	tests := []struct {
+		name     string
+		cache    bool
+		setup    func(t *testing.T, r *OpenAIRouter)
+		requests []*ext_proc.ProcessingRequest
+	}{
+		{
+			name: "passthrough",
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(`{"model":"phi4","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			},
+		},
+		{
+			name: "reroute",
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-2"),
+				requestBody(`{"model":"auto","messages":[{"role":"system","content":"You are a tutor"},{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			},
+		},
+		{
+			name: "reroute_below_threshold",
+			setup: func(t *testing.T, r *OpenAIRouter) {
+				r.Config.Classifier.Threshold = 0.95
+			},
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-3"),
+				requestBody(`{"model":"auto","messages":[{"role":"user","content":"Is this contract valid?"}]}`),
+			},
+		},
+		{
+			name:  "cache_hit",
+			cache: true,
+			setup: func(t *testing.T, r *OpenAIRouter) {
+				if err := r.Cache.AddEntry("phi4", "capital of France?", []byte(`{}`), []byte(`{"cached":true}`)); err != nil {
+					t.Fatalf("failed to seed cache: %v", err)
+				}
+			},
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-4"),
+				requestBody(`{"model":"phi4","messages":[{"role":"user","content":"Capital of France, please"}]}`),
+			},
+		},
+		{
+			name:  "cache_miss_then_store",
+			cache: true,
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-5"),
+				requestBody(`{"model":"phi4","messages":[{"role":"user","content":"Capital of Spain?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			},
+		},
+		{
+			name: "streamed_response_chunks",
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-6"),
+				requestBody(`{"model":"phi4","messages":[{"role":"user","content":"hello"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody[:40], false),
+				responseBody(completionBody[40:], true),
+				responseBody(`{}`, true),
+			},
+		},
+		{
+			name: "upstream_error",
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-7"),
+				requestBody(`{"model":"phi4","messages":[{"role":"user","content":"hello"}]}`),
+				responseHeaders("503"),
+				responseBody(`{"error":{"message":"overloaded","type":"server_error"}}`, true),
+			},
+		},
+		{
+			name: "invalid_request_body",
+			requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-8"),
+				requestBody(`{"model":`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, tt.cache)
+			if tt.setup != nil {
+				tt.setup(t, router)
+			}
+
+			stream := &fakeStream{requests: tt.requests}
+			err := router.Process(stream)
+
+			got := goldenFile{}
+			if err != nil && err != io.EOF {
+				got.Error = status.Code(err).String()
+			}
+			for _, resp := range stream.responses {
+				data, merr := protojson.Marshal(resp)
+				if merr != nil {
+					t.Fatalf("failed to marshal response: %v", merr)
+				}
+				got.Responses = append(got.Responses, data)
+			}
+
+			path := filepath.Join("testdata", tt.name+".golden.json")
+			if *updateGolden {
+				data, merr := json.MarshalIndent(got, "", "  ")
+				if merr != nil {
+					t.Fatalf("failed to marshal golden file: %v", merr)
+				}
+				if werr := os.WriteFile(path, append(data, '\n'), 0644); werr != nil {
+					t.Fatalf("failed to write golden file: %v", werr)
+				}
+				return
+			}
+
+			compareGolden(t, path, got)
+		})
+	}
+}
+
+// compareGolden compares responses semantically, since protojson output is not byte-stable
+func compareGolden(t *testing.T, path string, got goldenFile) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	var want goldenFile
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatalf("failed to parse golden file: %v", err)
+	}
+
+	if got.Error != want.Error {
+		t.Errorf("error = %q, want %q", got.Error, want.Error)
+	}
+	if len(got.Responses) != len(want.Responses) {
+		t.Fatalf("got %d responses, want %d", len(got.Responses), len(want.Responses))
+	}
+	for i := range want.Responses {
+		wantResp := &ext_proc.ProcessingResponse{}
+		if err := protojson.Unmarshal(want.Responses[i], wantResp); err != nil {
+			t.Fatalf("failed to parse golden response %d: %v", i, err)
+		}
+		gotResp := &ext_proc.ProcessingResponse{}
+		if err := protojson.Unmarshal(got.Responses[i], gotResp); err != nil {
+			t.Fatalf("failed to parse response %d: %v", i, err)
+		}
+		if !proto.Equal(gotResp, wantResp) {
+			t.Errorf("response %d mismatch:\ngot:  %s\nwant: %s", i, got.Responses[i], want.Responses[i])
+		}
+	}
+}
+
+// recordingSink collects decision records in memory
+type recordingSink struct {
+	records []*decision.DecisionRecord
+}
+
+func (s *recordingSink) Write(record *decision.DecisionRecord) {
+	s.records = append(s.records, record)
+}
+
+func TestProcessWritesDecisionRecord(t *testing.T) {
+	router := newTestRouter(t, false)
+	sink := &recordingSink{}
+	router.Decisions = sink
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d decision records, want 1", len(sink.records))
+	}
+	record := sink.records[0]
+	if record.GetSchemaVersion() != decision.SchemaVersion || record.GetRequestId() != "req-1" || record.GetAttempt() != 1 {
+		t.Errorf("unexpected record identity: %v", record)
+	}
+	routing := record.GetRouting()
+	if routing.GetOriginalModel() != "auto" || routing.GetSelectedModel() != "math-model" || routing.GetCategory() != "math" || routing.GetConfidence() != 0.9 {
+		t.Errorf("unexpected routing: %v", routing)
+	}
+	if routing.GetRunnerUpCategory() != "law" || routing.GetRunnerUpConfidence() != 0.1 {
+		t.Errorf("unexpected runner-up: %v", routing)
+	}
+	if record.GetPromptExcerpt() != "" {
+		t.Errorf("prompt excerpt %q recorded without being enabled", record.GetPromptExcerpt())
+	}
+	if record.GetResponseStatus() != 200 || record.GetUsage().GetPromptTokens() != 10 || record.GetUsage().GetCompletionTokens() != 5 {
+		t.Errorf("unexpected usage: %v", record)
+	}
+}
+
+func TestProcessFinalizesResponseOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  []*ext_proc.ProcessingRequest
+		wantUsage int64
+	}{
+		{"duplicate end of stream", []*ext_proc.ProcessingRequest{responseBody(completionBody, true), responseBody(completionBody, true)}, 15},
+		{"end of stream then trailers", []*ext_proc.ProcessingRequest{responseBody(completionBody, true), responseTrailers()}, 15},
+		{"body then trailers", []*ext_proc.ProcessingRequest{responseBody(completionBody, false), responseTrailers()}, 15},
+		{"only trailers", []*ext_proc.ProcessingRequest{responseTrailers()}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			sink := &recordingSink{}
+			router.Decisions = sink
+			router.Config.TokenBudgets.IdentityHeader = "X-API-Key"
+			// Charged twice, the 15 tokens of the completion would use it up
+			router.TokenBudgets = tokenbudget.New(tokenbudget.Options{Default: tokenbudget.Limits{Hourly: 20}})
+
+			stream := &fakeStream{requests: append([]*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1", "x-api-key", "alice"),
+				requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+			}, tt.response...)}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			if len(sink.records) != 1 {
+				t.Fatalf("got %d decision records, want 1", len(sink.records))
+			}
+			usage := sink.records[0].GetUsage()
+			if total := usage.GetPromptTokens() + usage.GetCompletionTokens(); total != tt.wantUsage {
+				t.Errorf("recorded %d tokens, want %d", total, tt.wantUsage)
+			}
+			if exceeded := router.TokenBudgets.Check("alice"); exceeded != nil {
+				t.Errorf("response charged more than once: %v", exceeded)
+			}
+			if len(router.attempts.attempts) != 1 {
+				t.Fatalf("tracked %d attempts, want 1", len(router.attempts.attempts))
+			}
+			for key, state := range router.attempts.attempts {
+				if !state.completed {
+					t.Errorf("attempt %s was not completed", key)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessDisablesClassificationOverErrorBudget(t *testing.T) {
+	router := newTestRouter(t, false)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	calls := 0
+	router.classify = func(text string) (candle_binding.ClassResult, error) {
+		calls++
+		return candle_binding.ClassResult{}, fmt.Errorf("model not loaded")
+	}
+	var err error
+	router.ErrorBudgets, err = errorbudget.New(errorbudget.Options{
+		Budgets: map[string]errorbudget.Budget{
+			errorbudget.StageClassification: {MinCalls: 2, Cooldown: time.Minute},
+		},
+	})
+	if err != nil {
+		t.Fatalf("errorbudget.New: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_ = router.Process(&fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", fmt.Sprintf("req-%d", i)),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}})
+	}
+	if calls != 2 {
+		t.Errorf("classifier called %d times, want 2 before the stage was disabled", calls)
+	}
+	if model := sink.records[2].GetRouting().GetSelectedModel(); model != "default-model" {
+		t.Errorf("request routed to %s with classification disabled, want default-model", model)
+	}
+	if healthy, _ := router.ErrorBudgets.Health(); healthy {
+		t.Error("expected the error budgets to report degraded health")
+	}
+}
+
+func TestFindBestModelMatchByUtterances(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.CategoryMapping = nil
+	router.Config.BertModel.Threshold = 0.5
+	router.Config.Categories[0].Utterances = map[string][]string{
+		"en": {"What is the derivative of this function?"},
+		"de": {"Was ist die Ableitung dieser Funktion?"},
+	}
+	// Matches candidates sharing the query's first word
+	var searched []string
+	router.findSimilar = func(_ *embeddings.Set, _, query string, candidates []string) candle_binding.SimResult {
+		searched = candidates
+		for i, candidate := range candidates {
+			if strings.Fields(candidate)[0] == strings.Fields(query)[0] {
+				return candle_binding.SimResult{Index: i, Score: 0.9}
+			}
+		}
+		return candle_binding.SimResult{Index: 0, Score: 0.1}
+	}
+
+	match := router.findBestModelMatch(slog.Default(), "Was ist die Ableitung von x hoch zwei?", "de", nil, nil, false)
+	if match.Model != "math-model" || match.Category != "math" {
+		t.Errorf("German query routed to %s (%s), want math-model (math)", match.Model, match.Category)
+	}
+	if want := []string{"Was ist die Ableitung dieser Funktion?", "law"}; !reflect.DeepEqual(searched, want) {
+		t.Errorf("searched %v, want the German utterances and the other descriptions %v", searched, want)
+	}
+
+	match = router.findBestModelMatch(slog.Default(), "Who owns this contract?", "en", nil, nil, false)
+	if match.Model != "default-model" || match.Category != "" {
+		t.Errorf("dissimilar query routed to %s (%s), want the default model", match.Model, match.Category)
+	}
+}
+
+func TestProcessMatchesUtterancesWithLanguageModels(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.CategoryMapping = nil
+	router.Config.BertModel.Threshold = 0.5
+	router.Config.BertModel.LanguageModels = map[string]config.LanguageModel{"de": {ModelID: "german-bert", Threshold: 0.8}}
+	router.Config.Categories[0].Utterances = map[string][]string{"en": {"What is the derivative of this function?"}}
+	router.Config.Categories[0].Descriptions = map[string]string{"de": "Fragen zur Mathematik"}
+	var languages []string
+	var searched [][]string
+	router.findSimilar = func(_ *embeddings.Set, language, _ string, candidates []string) candle_binding.SimResult {
+		languages = append(languages, language)
+		searched = append(searched, candidates)
+		return candle_binding.SimResult{Index: 0, Score: 0.7}
+	}
+
+	tests := []struct {
+		query        string
+		wantLanguage string
+		// Language whose model scores the query, empty for bert_model
+		wantModelLanguage string
+		wantSearched      []string
+		wantModel         string
+	}{
+		// Scored by the German model, whose threshold the similarity misses
+		{"Was ist die Ableitung von x hoch zwei?", "de", "de", []string{"Fragen zur Mathematik", "law"}, "default-model"},
+		{"What is the derivative of x^2?", "en", "", []string{"What is the derivative of this function?", "law"}, "math-model"},
+	}
+	for i, tt := range tests {
+		languages, searched = nil, nil
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", fmt.Sprintf("req-%d", i)),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"` + tt.query + `"}]}`),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+
+		if !reflect.DeepEqual(languages, []string{tt.wantModelLanguage}) || !reflect.DeepEqual(searched, [][]string{tt.wantSearched}) {
+			t.Errorf("query %q searched %v with the models of %q, want %v with %q", tt.query, searched, languages, tt.wantSearched, tt.wantModelLanguage)
+		}
+		response := stream.responses[1]
+		var routed struct{ Model string }
+		if err := json.Unmarshal(response.GetRequestBody().GetResponse().GetBodyMutation().GetBody(), &routed); err != nil || routed.Model != tt.wantModel {
+			t.Errorf("query %q routed to %q (%v), want %s", tt.query, routed.Model, err, tt.wantModel)
+		}
+		fields := response.GetDynamicMetadata().GetFields()[decisionMetadataNamespace].GetStructValue().GetFields()
+		if got := fields["language"].GetStringValue(); got != tt.wantLanguage {
+			t.Errorf("query %q language metadata = %q, want %q", tt.query, got, tt.wantLanguage)
+		}
+	}
+}
+
+func TestProcessObservesUnroutedQueries(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Classifier.Threshold = 0.85
+	router.Discovery = discovery.New(discovery.Options{Embed: fakeEmbedding, MinClusterSize: 1})
+	router.Discovery.Start()
+
+	for i, content := range []string{"What is the derivative of x^2?", "Who owns this contract?"} {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", fmt.Sprintf("req-%d", i)),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"` + content + `"}]}`),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+	}
+	router.Discovery.Stop()
+
+	// Only the law query fell below the classifier threshold
+	candidates := router.Discovery.Candidates()
+	if len(candidates) != 1 || candidates[0].Examples[0] != "Who owns this contract?" {
+		t.Errorf("expected only the unrouted query to be observed, got %+v", candidates)
+	}
+}
+
+// histogramState returns the sample count and sum of a histogram
+func histogramState(t *testing.T, h prometheus.Observer) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := h.(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestProcessRecordsBodySizes(t *testing.T) {
+	router := newTestRouter(t, false)
+	body := `{"model":"auto","messages":[{"role":"user","content":"Who wrote this contract?"}]}`
+	firstChunk, lastChunk := completionBody[:20], completionBody[20:]
+
+	requestCount, requestSum := histogramState(t, metrics.RequestBodyBytes.WithLabelValues("law-model"))
+	responseCount, responseSum := histogramState(t, metrics.ResponseBodyBytes.WithLabelValues("law-model"))
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-sizes"),
+		requestBody(body),
+		responseHeaders("200"),
+		responseBody(firstChunk, false),
+		responseBody(lastChunk, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	// The request is measured as the client sent it, the response across all chunks
+	count, sum := histogramState(t, metrics.RequestBodyBytes.WithLabelValues("law-model"))
+	if count-requestCount != 1 || sum-requestSum != float64(len(body)) {
+		t.Errorf("request size observations = %d totaling %v, want 1 of %d bytes", count-requestCount, sum-requestSum, len(body))
+	}
+	count, sum = histogramState(t, metrics.ResponseBodyBytes.WithLabelValues("law-model"))
+	if count-responseCount != 1 || sum-responseSum != float64(len(completionBody)) {
+		t.Errorf("response size observations = %d totaling %v, want 1 of %d bytes", count-responseCount, sum-responseSum, len(completionBody))
+	}
+}
+
+func TestProcessRespectsStageFlags(t *testing.T) {
+	requests := func() []*ext_proc.ProcessingRequest {
+		return []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-1"),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		}
+	}
+	tests := []struct {
+		stage string
+		// Model in the rewritten body, empty when the body must not be rewritten
+		wantModel string
+	}{
+		{flags.StageClassification, "default-model"},
+		{flags.StageMutation, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stage, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			if err := router.Flags.Set(tt.stage, false); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			stream := &fakeStream{requests: requests()}
+			_ = router.Process(stream)
+
+			body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+			var model string
+			if body != nil {
+				req, err := parseOpenAIRequest(body)
+				if err != nil {
+					t.Fatalf("invalid rewritten body: %v", err)
+				}
+				model = req.Model
+			}
+			if model != tt.wantModel {
+				t.Errorf("rewritten model = %q, want %q", model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestProcessAppliesRoutingPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		body    string
+		// Model in the rewritten body, empty when the body must not be rewritten
+		wantModel  string
+		wantStatus int
+	}{
+		{
+			name:      "client without policy",
+			headers:   []string{"x-forwarded-for", "192.0.2.1"},
+			body:      `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantModel: "math-model",
+		},
+		{
+			name:      "auto request rerouted to allowed model",
+			headers:   []string{"x-forwarded-for", "10.20.0.1"},
+			body:      `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantModel: "math-model-eu",
+		},
+		{
+			name:       "explicit model outside allowed regions",
+			headers:    []string{"x-forwarded-for", "10.20.0.1"},
+			body:       `{"model":"math-model","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantStatus: 451,
+		},
+		{
+			name:       "region header with forbidden status",
+			headers:    []string{"x-client-region", "cn"},
+			body:       `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantStatus: 403,
+		},
+		{
+			name:      "tenant rerouted to compliant model",
+			headers:   []string{"x-tenant-id", "acme-health"},
+			body:      `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantModel: "math-model-eu",
+		},
+		{
+			name:       "tenant and client region without a qualifying model",
+			headers:    []string{"x-tenant-id", "acme-onprem", "x-forwarded-for", "10.20.0.1"},
+			body:       `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantStatus: 451,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			router.Config.Categories[0].Models = []string{"math-model", "math-model-eu"}
+			geo, err := policy.NewGeo(policy.GeoOptions{
+				RegionHeader: "x-client-region",
+				Networks:     []config.GeoNetwork{{CIDR: "10.20.0.0/16", Region: "eu"}},
+				Policies: []config.GeoPolicy{
+					{ClientRegion: "eu", AllowedModelRegions: []string{"eu"}},
+					{ClientRegion: "cn", AllowedModelRegions: []string{"cn"}, DenyStatus: 403},
+				},
+				ModelRegions: map[string]string{"math-model": "us", "math-model-eu": "eu", "default-model": "us"},
+			})
+			if err != nil {
+				t.Fatalf("NewGeo: %v", err)
+			}
+			router.Geo = geo
+			router.Residency, err = policy.NewResidency(policy.ResidencyOptions{
+				Tenants: []config.TenantPolicy{
+					{Name: "acme-health", RequiredAttributes: []string{"hipaa"}},
+					{Name: "acme-onprem", RequiredAttributes: []string{"on-prem"}},
+				},
+				ModelAttributes: map[string][]string{"math-model-eu": {"hipaa"}, "default-model": {"on-prem"}},
+			})
+			if err != nil {
+				t.Fatalf("NewResidency: %v", err)
+			}
+
+			headers := append([]string{"x-request-id", "req-1"}, tt.headers...)
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{requestHeaders(headers...), requestBody(tt.body)}}
+			_ = router.Process(stream)
+
+			if tt.wantStatus != 0 {
+				immediate := stream.responses[1].GetImmediateResponse()
+				if got := int(immediate.GetStatus().GetCode()); got != tt.wantStatus {
+					t.Fatalf("status = %d, want %d", got, tt.wantStatus)
+				}
+				if !strings.Contains(string(immediate.GetBody()), "policy_violation") {
+					t.Errorf("unexpected denial body: %s", immediate.GetBody())
+				}
+				if pending := router.Cache.PendingCount(); pending != 0 {
+					t.Errorf("denied request left %d pending cache entries", pending)
+				}
+				return
+			}
+
+			req, err := parseOpenAIRequest(stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody())
+			if err != nil {
+				t.Fatalf("invalid rewritten body: %v", err)
+			}
+			if req.Model != tt.wantModel {
+				t.Errorf("rewritten model = %q, want %q", req.Model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestProcessResponseBufferLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxBytes  int
+		wantCache bool
+	}{
+		{name: "within the limit", wantCache: true},
+		{name: "over the limit", maxBytes: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			router.Config.ResponseBuffering.MaxBytes = tt.maxBytes
+			truncations := metrics.ResponseBufferTruncations.WithLabelValues("math-model")
+			before := testutil.ToFloat64(truncations)
+
+			half := len(completionBody) / 2
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody[:half], false),
+				responseBody(completionBody[half:], true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			// Every chunk passes through unchanged
+			for _, resp := range stream.responses[3:] {
+				if mutation := resp.GetResponseBody().GetResponse().GetBodyMutation(); mutation != nil {
+					t.Errorf("response chunk mutated: %v", mutation)
+				}
+			}
+			if router.Cache.PendingCount() != 0 {
+				t.Errorf("%d cache entries left pending", router.Cache.PendingCount())
+			}
+			cached, found, err := router.Cache.FindSimilar("auto", "What is the derivative of x^2?")
+			if err != nil || found != tt.wantCache {
+				t.Errorf("FindSimilar = %s, %v, %v, want cached %v", cached, found, err, tt.wantCache)
+			}
+			wantTruncations := 0.0
+			if !tt.wantCache {
+				wantTruncations = 1
+			}
+			if got := testutil.ToFloat64(truncations) - before; got != wantTruncations {
+				t.Errorf("truncations counted %v, want %v", got, wantTruncations)
+			}
+		})
+	}
+}
+
+func TestClassifierCategoryThresholds(t *testing.T) {
+	above, below := float32(0.7), float32(0.85)
+	tests := []struct {
+		name      string
+		query     string
+		threshold *float32
+		wantModel string
+	}{
+		{"global threshold", "Who owns this contract?", nil, "law-model"},
+		{"category threshold met", "Who owns this contract?", &above, "law-model"},
+		{"category threshold missed", "Who owns this contract?", &below, "default-model"},
+		{"other category unaffected", "What is the derivative of x^2?", &below, "math-model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.Config.Categories[1].ConfidenceThreshold = tt.threshold
+			match := router.findBestModelMatch(slog.Default(), tt.query, "en", nil, nil, false)
+			if match.Model != tt.wantModel {
+				t.Errorf("routed to %s, want %s", match.Model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestProcessStripsClientDestinationEndpoint(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Endpoints = endpoints.NewSelector(endpoints.SelectorOptions{
+		ModelEndpoints: map[string][]config.ModelEndpoint{"math-model": {{Name: "math-1", Address: "10.0.0.1:8000"}}},
+	})
+
+	for _, tt := range []struct {
+		query     string
+		wantValue string
+	}{
+		// Routed to a model with endpoints, the selected one is set
+		{"What is the derivative of x^2?", "10.0.0.1:8000"},
+		// No endpoint is selected for models without endpoints
+		{"Who owns this contract?", ""},
+	} {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-1", destinationEndpointHeader, "169.254.169.254:80"),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"` + tt.query + `"}]}`),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		removed := stream.responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders()
+		if !slices.Contains(removed, destinationEndpointHeader) {
+			t.Errorf("%q: client destination endpoint not removed: %v", tt.query, removed)
+		}
+		value := ""
+		for _, header := range stream.responses[1].GetRequestBody().GetResponse().GetHeaderMutation().GetSetHeaders() {
+			if header.GetHeader().GetKey() == destinationEndpointHeader {
+				value = string(header.GetHeader().GetRawValue())
+			}
+		}
+		if value != tt.wantValue {
+			t.Errorf("%q: destination endpoint set to %q, want %q", tt.query, value, tt.wantValue)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package extproc
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/chunking"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// defaultPromptGuardResponse is returned for rejected requests without a
+// prompt_guard.response
+var defaultPromptGuardResponse = mustParsePromptGuardResponse(config.ResponseTemplate{
+	Status:  http.StatusBadRequest,
+	Message: "The request was rejected as a possible {{.Category}} attempt",
+})
+
+// promptGuardUnavailableResponse is returned for requests that could not be
+// classified
+var promptGuardUnavailableResponse = mustParsePromptGuardResponse(config.ResponseTemplate{
+	Status:  http.StatusServiceUnavailable,
+	Message: "The request could not be checked for prompt injection",
+})
+
+func mustParsePromptGuardResponse(tmpl config.ResponseTemplate) *blockResponse {
+	response := mustParseBlockResponse(tmpl)
+	response.errorType = "prompt_guard"
+	return response
+}
+
+// promptGuard rejects requests whose user messages a classifier flags as
+// jailbreak or prompt injection attempts
+type promptGuard struct {
+	classify  func(text string) (candle_binding.ClassResult, error)
+	labels    map[int]string
+	benign    map[string]bool
+	threshold float32
+	chunking  chunking.Options
+	response  *blockResponse
+}
+
+// promptGuardDetection is an attack detected in a request
+type promptGuardDetection struct {
+	Label      string
+	Confidence float32
+}
+
+// newPromptGuard builds the prompt guard from its config and the mapping of
+// the classifier's classes to labels
+func newPromptGuard(cfg config.PromptGuardConfig, mapping *CategoryMapping, chunkingOptions chunking.Options,
+	classify func(text string) (candle_binding.ClassResult, error)) (*promptGuard, error) {
+	g := &promptGuard{
+		classify:  classify,
+		labels:    make(map[int]string, len(mapping.IdxToCategory)),
+		benign:    make(map[string]bool),
+		threshold: cfg.Threshold,
+		chunking:  chunkingOptions,
+		response:  defaultPromptGuardResponse,
+	}
+	for idx, label := range mapping.IdxToCategory {
+		class, err := strconv.Atoi(idx)
+		if err != nil {
+			return nil, fmt.Errorf("invalid class index %q in mapping", idx)
+		}
+		g.labels[class] = label
+	}
+	if g.threshold <= 0 {
+		g.threshold = 0.7
+	}
+	benignLabels := cfg.BenignLabels
+	if len(benignLabels) == 0 {
+		benignLabels = []string{"benign"}
+	}
+	for _, label := range benignLabels {
+		g.benign[label] = true
+	}
+	if cfg.Response != nil {
+		response, err := parseBlockResponse(*cfg.Response)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		response.errorType = "prompt_guard"
+		g.response = response
+	}
+	return g, nil
+}
+
+// check classifies every user message, chunked like classification input, and
+// returns the attack detected with the highest confidence, if any
+func (g *promptGuard) check(req *OpenAIRequest) (promptGuardDetection, bool, error) {
+	var detection promptGuardDetection
+	found := false
+	for _, msg := range req.Messages {
+		if msg.Role != "user" || msg.Content == "" {
+			continue
+		}
+		for _, chunk := range chunking.Split(msg.Content, g.chunking) {
+			result, err := g.classify(chunk)
+			if err != nil {
+				return detection, false, err
+			}
+			label, ok := g.labels[result.Class]
+			if !ok {
+				return detection, false, fmt.Errorf("class %d not in the prompt guard mapping", result.Class)
+			}
+			if g.benign[label] || result.Confidence < g.threshold {
+				continue
+			}
+			if !found || result.Confidence > detection.Confidence {
+				detection = promptGuardDetection{Label: label, Confidence: result.Confidence}
+				found = true
+			}
+		}
+	}
+	if found {
+		slog.Debug("Prompt guard detection", "label", detection.Label, "confidence", detection.Confidence)
+	}
+	return detection, found, nil
+}
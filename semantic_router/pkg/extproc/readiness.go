@@ -0,0 +1,97 @@
+package extproc
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// readinessProbeText is embedded to check that the similarity model works
+const readinessProbeText = "semantic router readiness probe"
+
+// readinessInterval is how often the gRPC health status is rechecked until
+// the router is ready
+const readinessInterval = time.Second
+
+// Ready returns why the router cannot route requests yet, nil once its models
+// are loaded and the similarity model produces an embedding. The embedding
+// bypasses the embedding cache, so the model itself is checked.
+func (r *OpenAIRouter) Ready() error {
+	if !r.models.Ready() {
+		return errors.New("models are not loaded")
+	}
+	embedding, err := r.probeEmbedding(readinessProbeText)
+	if err != nil {
+		return fmt.Errorf("similarity model failed to embed: %w", err)
+	}
+	if len(embedding) == 0 {
+		return errors.New("similarity model produced an empty embedding")
+	}
+	return nil
+}
+
+// servingHealth reports the router's gRPC health: NOT_SERVING until the router
+// is first ready, which also warms the similarity model up before Envoy sends
+// traffic, then SERVING until the server stops
+type servingHealth struct {
+	server *health.Server
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// newServingHealth creates the health service, NOT_SERVING for the whole
+// server and the ext_proc service, and marks it SERVING once ready returns
+// nil, checking it every interval until then
+func newServingHealth(ready func() error, interval time.Duration) *servingHealth {
+	h := &servingHealth{
+		server: health.NewServer(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	h.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	go h.await(ready, interval)
+	return h
+}
+
+func (h *servingHealth) set(status healthpb.HealthCheckResponse_ServingStatus) {
+	h.server.SetServingStatus("", status)
+	h.server.SetServingStatus(ext_proc.ExternalProcessor_ServiceDesc.ServiceName, status)
+}
+
+func (h *servingHealth) await(ready func() error, interval time.Duration) {
+	defer close(h.done)
+	var lastErr string
+	for {
+		err := ready()
+		if err == nil {
+			h.set(healthpb.HealthCheckResponse_SERVING)
+			slog.Info("Router is ready, reporting SERVING")
+			return
+		}
+		if err.Error() != lastErr {
+			lastErr = err.Error()
+			slog.Info("Router not ready yet, reporting NOT_SERVING", "reason", lastErr)
+		}
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// shutdown reports NOT_SERVING from now on, so clients stop sending new
+// streams while the server drains
+func (h *servingHealth) shutdown() {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+	h.server.Shutdown()
+}
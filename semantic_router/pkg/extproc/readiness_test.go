@@ -0,0 +1,76 @@
+package extproc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestRouterReady(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.probeEmbedding = fakeEmbedding
+	if err := router.Ready(); err != nil {
+		t.Errorf("Ready() = %v, want nil", err)
+	}
+
+	router.probeEmbedding = func(string) ([]float32, error) { return nil, errors.New("model not initialized") }
+	if err := router.Ready(); err == nil {
+		t.Error("router ready although the model fails to embed")
+	}
+
+	router.probeEmbedding = fakeEmbedding
+	router.models = newModelLoader(func() error { return errors.New("still failing") }, config.SafeModeConfig{}, errors.New("failed"))
+	if err := router.Ready(); err == nil || err.Error() != "models are not loaded" {
+		t.Errorf("Ready() in safe mode = %v", err)
+	}
+}
+
+func TestServingHealth(t *testing.T) {
+	var ready atomic.Bool
+	h := newServingHealth(func() error {
+		if !ready.Load() {
+			return errors.New("models are not loaded")
+		}
+		return nil
+	}, time.Millisecond)
+
+	status := func() healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		resp, err := h.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: ext_proc.ExternalProcessor_ServiceDesc.ServiceName})
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		return resp.GetStatus()
+	}
+
+	if got := status(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status before ready = %v", got)
+	}
+	ready.Store(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for status() != healthpb.HealthCheckResponse_SERVING {
+		if time.Now().After(deadline) {
+			t.Fatal("never reported SERVING")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	h.shutdown()
+	if got := status(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status after shutdown = %v", got)
+	}
+}
+
+func TestServingHealthShutdownBeforeReady(t *testing.T) {
+	h := newServingHealth(func() error { return errors.New("models are not loaded") }, time.Hour)
+	h.shutdown()
+	var none *servingHealth
+	none.shutdown()
+}
@@ -0,0 +1,101 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/receipt"
+)
+
+const (
+	// receiptHeader carries the routing receipt of a request with the header
+	// placement
+	receiptHeader = "x-semantic-router-receipt"
+	// receiptField carries the routing receipt in JSON responses with the body
+	// placement
+	receiptField = "semantic_router_receipt"
+)
+
+// newReceiptKey loads the key routing receipts are signed with, nil when
+// receipts are disabled
+func newReceiptKey(cfg config.RoutingReceiptsConfig) ([]byte, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	switch cfg.Placement {
+	case "", config.ReceiptPlacementHeader, config.ReceiptPlacementBody:
+	default:
+		return nil, fmt.Errorf("invalid routing_receipts: unknown placement %q", cfg.Placement)
+	}
+	if cfg.SigningKeyEnv == "" {
+		return nil, fmt.Errorf("invalid routing_receipts: signing_key_env is required")
+	}
+	key, err := receipt.LoadKey(cfg.SigningKeyEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing_receipts: %w", err)
+	}
+	return key, nil
+}
+
+// receiptPlacement returns where routing receipts are attached
+func (r *OpenAIRouter) receiptPlacement() string {
+	if placement := r.Config.RoutingReceipts.Placement; placement != "" {
+		return placement
+	}
+	return config.ReceiptPlacementHeader
+}
+
+// issueReceipt signs the receipt of the routing decision of a request, empty
+// when signing fails
+func (r *OpenAIRouter) issueReceipt(reqCtx *RequestContext, model string) string {
+	encoded, err := receipt.Sign(receipt.Receipt{
+		RequestID:     reqCtx.ID,
+		Model:         model,
+		Category:      reqCtx.record.Routing.Category,
+		EstimatedCost: r.Config.GetModelCost(model, reqCtx.estimatedPromptTokens, 0),
+		ReceivedAt:    reqCtx.StartTime.UnixMilli(),
+		RoutedAt:      time.Now().UnixMilli(),
+	}, r.receiptKey)
+	if err != nil {
+		reqCtx.log.Error("Error signing routing receipt", "error", err)
+		return ""
+	}
+	return encoded
+}
+
+// addReceiptHeader sets the receipt header in a header mutation, created when
+// nil, replacing any header of the same name so clients can't forge it
+func addReceiptHeader(mutation *ext_proc.HeaderMutation, encoded string) *ext_proc.HeaderMutation {
+	if mutation == nil {
+		mutation = &ext_proc.HeaderMutation{}
+	}
+	mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+		Header:       &core.HeaderValue{Key: receiptHeader, RawValue: []byte(encoded)},
+		AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	})
+	return mutation
+}
+
+// addReceiptField adds the receipt field to a JSON object response, keeping
+// its other fields as they are, and reports whether it was added
+func addReceiptField(body []byte, encoded string) ([]byte, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' || !json.Valid(trimmed) {
+		return body, false
+	}
+	field, err := json.Marshal(map[string]string{receiptField: encoded})
+	if err != nil {
+		return body, false
+	}
+	withReceipt := append([]byte{}, trimmed[:len(trimmed)-1]...)
+	if len(bytes.TrimSpace(trimmed[1:len(trimmed)-1])) > 0 {
+		withReceipt = append(withReceipt, ',')
+	}
+	return append(withReceipt, field[1:]...), true
+}
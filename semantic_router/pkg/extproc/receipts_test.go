@@ -0,0 +1,81 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/receipt"
+)
+
+// headerValue returns the value a header mutation sets a header to
+func headerValue(mutation *ext_proc.HeaderMutation, key string) string {
+	for _, header := range mutation.GetSetHeaders() {
+		if header.GetHeader().GetKey() == key {
+			return string(header.GetHeader().GetRawValue())
+		}
+	}
+	return ""
+}
+
+func TestProcessRoutingReceipts(t *testing.T) {
+	key := []byte("billing-key")
+	for _, placement := range []string{config.ReceiptPlacementHeader, config.ReceiptPlacementBody} {
+		t.Run(placement, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.receiptKey = key
+			router.Config.RoutingReceipts = config.RoutingReceiptsConfig{Enabled: true, Placement: placement}
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1", receiptHeader, "forged"),
+				requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			upstream := headerValue(stream.responses[1].GetRequestBody().GetResponse().GetHeaderMutation(), receiptHeader)
+			downstream := headerValue(stream.responses[2].GetResponseHeaders().GetResponse().GetHeaderMutation(), receiptHeader)
+			body := stream.responses[3].GetResponseBody().GetResponse().GetBodyMutation().GetBody()
+			field := gjson.GetBytes(body, receiptField).String()
+			encoded := upstream
+			if placement == config.ReceiptPlacementBody {
+				encoded = field
+				if upstream != "" || downstream != "" {
+					t.Errorf("receipt headers set with the body placement")
+				}
+				if gjson.GetBytes(body, "usage.total_tokens").Int() != 15 {
+					t.Errorf("response fields not kept: %s", body)
+				}
+			} else if downstream != upstream || field != "" {
+				t.Errorf("response receipt %q and field %q, want the request's %q", downstream, field, upstream)
+			}
+
+			r, err := receipt.Verify(encoded, key)
+			if err != nil {
+				t.Fatalf("Verify(%q): %v", encoded, err)
+			}
+			if r.RequestID != "req-1" || r.Model != "math-model" || r.Category != "math" || r.RoutedAt < r.ReceivedAt || r.ReceivedAt == 0 {
+				t.Errorf("unexpected receipt %+v", r)
+			}
+		})
+	}
+}
+
+func TestAddReceiptField(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"id":"c1"}`:   `{"id":"c1","semantic_router_receipt":"v1.x.y"}`,
+		" {} \n":        `{"semantic_router_receipt":"v1.x.y"}`,
+		`[{"id":"c1"}]`: "",
+		`{"id":`:        "",
+	} {
+		got, ok := addReceiptField([]byte(body), "v1.x.y")
+		if ok != (want != "") || (ok && string(got) != want) {
+			t.Errorf("addReceiptField(%q) = %q, %v, want %q", body, got, ok, want)
+		}
+	}
+}
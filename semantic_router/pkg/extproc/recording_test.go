@@ -0,0 +1,64 @@
+package extproc
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/replay"
+)
+
+func TestProcessRecordingReplays(t *testing.T) {
+	dir := t.TempDir()
+	router := newTestRouter(t, false)
+	var err error
+	router.Recordings, err = replay.NewRecorder(replay.RecorderOptions{Directory: dir, RedactHeaders: credentialHeaders})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1", "authorization", "Bearer sk-secret"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	paths, err := replay.Paths([]string{dir})
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("recordings %v, %v, want one", paths, err)
+	}
+	rec, err := replay.Load(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Requests) != 4 || len(rec.Responses) != 4 {
+		t.Fatalf("recorded %d requests and %d responses, want 4 each", len(rec.Requests), len(rec.Responses))
+	}
+	if headerValueOf(rec.Requests[0], "authorization") != replay.RedactedValue {
+		t.Error("credential header recorded unredacted")
+	}
+
+	router.Recordings = nil
+	replayed, err := replay.Replay(context.Background(), router, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := replay.Compare(rec.Responses, replayed); diffs != nil {
+		t.Errorf("replay differs from the recording: %v", diffs)
+	}
+}
+
+// headerValueOf returns the value of a header of a request headers message
+func headerValueOf(req *ext_proc.ProcessingRequest, key string) string {
+	for _, header := range req.GetRequestHeaders().GetHeaders().GetHeaders() {
+		if header.GetKey() == key {
+			return string(header.GetRawValue()) + header.GetValue()
+		}
+	}
+	return ""
+}
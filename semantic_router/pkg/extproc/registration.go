@@ -0,0 +1,56 @@
+package extproc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/fingerprint"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/registration"
+)
+
+// newRegistration creates the client announcing the instance to the control
+// plane, nil when no control plane is configured. Announcements describe the
+// router of the latest loaded config.
+func newRegistration(cfg config.RegistrationConfig, port int, current func() *OpenAIRouter, ready func() error) (*registration.Client, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	hostname, _ := os.Hostname()
+	id := cfg.InstanceID
+	if id == "" {
+		id = hostname
+	}
+	address := cfg.AdvertiseAddress
+	if address == "" {
+		address = net.JoinHostPort(hostname, strconv.Itoa(port))
+	}
+	var authorization string
+	if cfg.AuthorizationEnv != "" {
+		if authorization = os.Getenv(cfg.AuthorizationEnv); authorization == "" {
+			return nil, fmt.Errorf("%s is not set", cfg.AuthorizationEnv)
+		}
+	}
+	return registration.New(registration.Options{
+		URL:           cfg.URL,
+		Authorization: authorization,
+		Interval:      time.Duration(cfg.HeartbeatIntervalSeconds) * time.Second,
+		Timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+		Instance: func() registration.Instance {
+			router := current()
+			return registration.Instance{
+				ID:              id,
+				Address:         address,
+				Version:         fingerprint.BuildVersion(),
+				ProtocolVersion: processorProtocolVersion,
+				Capabilities:    router.capabilities(),
+				ConfigHash:      router.Config.Hash(),
+				RoutingHash:     router.Config.RoutingHash(),
+				Ready:           ready() == nil,
+			}
+		},
+	})
+}
@@ -0,0 +1,298 @@
+package extproc
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/fingerprint"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/logging"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// reloadingRouter serves each ext_proc stream with the router of the latest
+// loaded config. Streams keep the router they started with, so a reload never
+// changes the config in the middle of a request.
+type reloadingRouter struct {
+	router atomic.Pointer[OpenAIRouter]
+	// Open streams, reported while draining
+	streams atomic.Int64
+}
+
+// Ensure reloadingRouter implements the ext_proc calls
+var _ ext_proc.ExternalProcessorServer = &reloadingRouter{}
+
+func newReloadingRouter(router *OpenAIRouter) *reloadingRouter {
+	r := &reloadingRouter{}
+	r.router.Store(router)
+	return r
+}
+
+// current returns the router of the latest loaded config
+func (r *reloadingRouter) current() *OpenAIRouter {
+	return r.router.Load()
+}
+
+// Process handles a stream with the router of the latest loaded config
+func (r *reloadingRouter) Process(stream ext_proc.ExternalProcessor_ProcessServer) error {
+	metrics.SetActiveStreams(r.streams.Add(1))
+	defer func() { metrics.SetActiveStreams(r.streams.Add(-1)) }()
+	return r.current().Process(stream)
+}
+
+// withConfig returns a copy of the router applying a reloaded config. The
+// state derived from the config is rebuilt, while long-lived components such
+// as the cache, endpoint selector, flags and background jobs are shared with
+// the current router and keep the settings they were started with. Reloads
+// changing the sections those components are built from are rejected.
+func (r *OpenAIRouter) withConfig(cfg *config.RouterConfig) (*OpenAIRouter, error) {
+	if section := changedRestartSection(r.Config, cfg); section != "" {
+		return nil, fmt.Errorf("%s changed and only applies on restart", section)
+	}
+	if err := validateRouterMode(cfg.Mode); err != nil {
+		return nil, err
+	}
+	blocks, err := newBlockResponses(cfg.Categories)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSystemPrompts(cfg.Categories); err != nil {
+		return nil, err
+	}
+	if err := validateTrafficSplits(cfg.Categories); err != nil {
+		return nil, err
+	}
+	if err := validateReasoningEfforts(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateModelFamilies(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateDeprecations(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateParameterConstraints(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateRequestTags(cfg.RequestTags); err != nil {
+		return nil, err
+	}
+	apiPaths, err := newAPIPathMatcher(cfg.APIPaths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_paths: %w", err)
+	}
+	boilerplate, err := newBoilerplateFilter(cfg.BoilerplateFilter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid boilerplate_filter: %w", err)
+	}
+	applications, err := newApplicationMatcher(cfg.Applications)
+	if err != nil {
+		return nil, fmt.Errorf("invalid applications: %w", err)
+	}
+	tenants, err := newTenantRouter(cfg.Tenants, cfg.Categories, r.tenantTokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenants: %w", err)
+	}
+	countContextTokens, err := newContextTokenCounter(cfg.ContextRouting)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := logging.ParseLevel(cfg.Logging.Level); err != nil {
+		return nil, fmt.Errorf("invalid logging: %w", err)
+	}
+
+	applyTenantMetrics(cfg.TenantMetrics)
+	r.retainUtterances(cfg)
+	next := *r
+	next.Config = cfg
+	next.CategoryDescriptions = cfg.GetCategoryDescriptions()
+	next.FamilyTemplates = NewFamilyTemplates(cfg.ModelFamilyTemplates)
+	next.blockResponses = blocks
+	next.apiPaths = apiPaths
+	next.boilerplate = boilerplate
+	next.applications = applications
+	next.tenants = tenants
+	next.countTokens = countContextTokens
+	return &next, nil
+}
+
+// changedRestartSection returns the first config section that differs between
+// the configs and is only applied on restart, or "" if none does
+func changedRestartSection(current, next *config.RouterConfig) string {
+	sections := []struct {
+		name          string
+		current, next any
+	}{
+		{"endpoint_selection", current.EndpointSelection, next.EndpointSelection},
+		{"model_config endpoints", current.GetModelEndpoints(), next.GetModelEndpoints()},
+		{"geo_routing", current.GeoRouting, next.GeoRouting},
+		{"residency", current.Residency, next.Residency},
+		{"pii", current.PII, next.PII},
+		{"prompt_guard", current.PromptGuard, next.PromptGuard},
+		{"routing_receipts", current.RoutingReceipts, next.RoutingReceipts},
+		{"token_budgets", current.TokenBudgets, next.TokenBudgets},
+	}
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.current, section.next) {
+			return section.name
+		}
+	}
+	return ""
+}
+
+// reload reads the config again and swaps it in for new streams, keeping the
+// current config if the new one is invalid
+func (s *Server) reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := s.routers.current()
+	cfg, err := config.ReloadConfig(s.configPath)
+	var next *OpenAIRouter
+	if err == nil {
+		next, err = current.withConfig(cfg)
+	}
+	if err != nil {
+		metrics.RecordConfigReload(false)
+		slog.Error("Failed to reload config, keeping the current config", "path", s.configPath, "error", err)
+		return err
+	}
+
+	if epoch := cfg.GetCacheEpoch(); epoch != next.Cache.Epoch() {
+		next.Cache.SetEpoch(epoch)
+	}
+	s.routers.router.Store(next)
+	metrics.RecordConfigReload(true)
+	// Validated by withConfig; the format only changes on restart
+	_ = logging.SetLevel(cfg.Logging.Level)
+	metrics.RecordBuildInfo(fingerprint.BuildVersion(), cfg.Hash(), cfg.RoutingHash())
+	slog.Info("Reloaded config", "path", s.configPath, "routing_hash", cfg.RoutingHash(), "categories", len(cfg.Categories))
+
+	// Included files may have been added or removed
+	if err := s.watcher.watch(cfg.Sources); err != nil {
+		slog.Error("Error watching config files", "error", err)
+	}
+	return nil
+}
+
+// configWatcher calls a function when any of a set of files changes, after
+// changes settled for the debounce interval. It watches the files' directories
+// rather than the files, so files replaced by renames, as editors and
+// Kubernetes ConfigMap volumes do, keep being watched.
+type configWatcher struct {
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+	onChange func()
+	mu       sync.Mutex
+	files    map[string]bool
+	dirs     map[string]bool
+	timer    *time.Timer
+	done     chan struct{}
+}
+
+// newConfigWatcher starts watching the given files
+func newConfigWatcher(files []string, debounce time.Duration, onChange func()) (*configWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if debounce <= 0 {
+		debounce = 500 * time.Millisecond
+	}
+	w := &configWatcher{
+		watcher:  watcher,
+		debounce: debounce,
+		onChange: onChange,
+		dirs:     make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+	if err := w.watch(files); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// watch replaces the watched files
+func (w *configWatcher) watch(files []string) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = make(map[string]bool, len(files))
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		w.files[path] = true
+		dir := filepath.Dir(path)
+		if w.dirs[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		w.dirs[dir] = true
+	}
+	return nil
+}
+
+// relevant reports whether an event concerns a watched file
+func (w *configWatcher) relevant(event fsnotify.Event) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	path := filepath.Clean(event.Name)
+	// ConfigMap volumes swap all files at once through the ..data symlink
+	return w.files[path] || (filepath.Base(path) == "..data" && w.dirs[filepath.Dir(path)])
+}
+
+func (w *configWatcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod || !w.relevant(event) {
+				continue
+			}
+			w.mu.Lock()
+			if w.timer != nil {
+				w.timer.Stop()
+			}
+			w.timer = time.AfterFunc(w.debounce, w.onChange)
+			w.mu.Unlock()
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("Error watching config files", "error", err)
+		}
+	}
+}
+
+// Close stops watching the files
+func (w *configWatcher) Close() {
+	if w == nil {
+		return
+	}
+	w.watcher.Close()
+	<-w.done
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+}
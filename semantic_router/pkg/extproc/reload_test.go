@@ -0,0 +1,123 @@
+package extproc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestWithConfig(t *testing.T) {
+	r := newTestRouter(t, true)
+	cfg := *r.Config
+	cfg.Categories = []config.Category{
+		{Name: "math", Description: "algebra and calculus", Models: []string{"math-model-v2"}},
+		{Name: "law", Models: []string{"law-model"}},
+	}
+
+	next, err := r.withConfig(&cfg)
+	if err != nil {
+		t.Fatalf("withConfig: %v", err)
+	}
+	if next.Config != &cfg || r.Config == &cfg {
+		t.Error("expected only the new router to use the reloaded config")
+	}
+	if got := strings.Join(next.CategoryDescriptions, ","); got != "algebra and calculus,law" {
+		t.Errorf("expected re-derived category descriptions, got %q", got)
+	}
+	if next.Cache != r.Cache || next.Endpoints != r.Endpoints || next.Flags != r.Flags {
+		t.Error("expected long-lived components to be shared with the current router")
+	}
+
+	cfg.APIPaths.Rules = []config.APIPathRule{{Pattern: "(", Endpoint: "chat_completions"}}
+	if _, err := r.withConfig(&cfg); err == nil {
+		t.Error("expected an invalid api_paths rule to fail the reload")
+	}
+
+	cfg.APIPaths.Rules = nil
+	budgets := cfg
+	budgets.TokenBudgets.Enabled = true
+	if _, err := r.withConfig(&budgets); err == nil || !strings.Contains(err.Error(), "token_budgets") {
+		t.Errorf("expected changed token_budgets to fail the reload, got %v", err)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := newTestRouter(t, true)
+	s := &Server{router: router, routers: newReloadingRouter(router), configPath: path}
+
+	write("default_model: reloaded-model\nbert_model:\n  model_id: bert\nsemantic_cache:\n  epoch: v2\ncategories:\n  - name: math\n    models: [math-model]\n")
+	if err := s.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	current := s.routers.current()
+	if current == router || current.Config.DefaultModel != "reloaded-model" {
+		t.Fatalf("expected new streams to use the reloaded config, got default model %q", current.Config.DefaultModel)
+	}
+	if router.Config.DefaultModel != "default-model" {
+		t.Error("expected streams in flight to keep their config")
+	}
+	if epoch := router.Cache.Epoch(); epoch != "v2" {
+		t.Errorf("expected the cache to move to the reloaded epoch, got %q", epoch)
+	}
+
+	for _, content := range []string{
+		"categories: [",
+		"default_model: reloaded-model\nbert_model:\n  model_id: bert\ntext_chunking:\n  pooling: median\n",
+	} {
+		write(content)
+		if err := s.reload(); err == nil {
+			t.Fatalf("expected an invalid config to fail the reload: %q", content)
+		}
+		if s.routers.current() != current {
+			t.Error("expected a failed reload to keep the current config")
+		}
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("default_model: a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan struct{}, 10)
+	w, err := newConfigWatcher([]string{path}, 10*time.Millisecond, func() { changes <- struct{}{} })
+	if err != nil {
+		t.Fatalf("newConfigWatcher: %v", err)
+	}
+	defer w.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("expected changes to other files to be ignored")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Replace the file by a rename, as editors and ConfigMap volumes do
+	tmp := filepath.Join(dir, ".config.yaml.tmp")
+	if err := os.WriteFile(tmp, []byte("default_model: b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a change of the config file to be reported")
+	}
+}
@@ -0,0 +1,206 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/tidwall/gjson"
+)
+
+// The router edits request bodies in place where it can, so fields it does
+// not know about, such as tools, response_format or stream_options, reach the
+// backend exactly as the client sent them. Fields at dotted paths are set and
+// removed in place too; edits needing the whole request decode the body into
+// a map, keeping numbers as sent and not escaping HTML characters.
+
+// setRequestModel sets the model of a request body, leaving every other byte
+// of the body as sent. Every model field is replaced, so a body repeating the
+// field cannot carry its own model past routing.
+func setRequestModel(body []byte, model string) ([]byte, error) {
+	parsed := gjson.ParseBytes(body)
+	if !gjson.ValidBytes(body) || !parsed.IsObject() {
+		return nil, fmt.Errorf("request body is not a JSON object")
+	}
+	encoded, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var fields []gjson.Result
+	parsed.ForEach(func(key, value gjson.Result) bool {
+		if key.String() == "model" {
+			fields = append(fields, value)
+		}
+		return true
+	})
+	if len(fields) > 0 {
+		rewritten := bytes.Clone(body)
+		for i := len(fields) - 1; i >= 0; i-- {
+			field := fields[i]
+			rewritten = append(rewritten[:field.Index], append(encoded, rewritten[field.Index+len(field.Raw):]...)...)
+		}
+		return rewritten, nil
+	}
+	// Without a model, add it as the first field
+	start := bytes.IndexByte(body, '{')
+	field := append([]byte(`"model":`), encoded...)
+	if rest := bytes.TrimSpace(body[start+1:]); len(rest) > 0 && rest[0] != '}' {
+		field = append(field, ',')
+	}
+	rewritten := append(bytes.Clone(body[:start+1]), field...)
+	return append(rewritten, body[start+1:]...), nil
+}
+
+// decodeRequestObject decodes a request body into a map to be edited and
+// serialized again with encodeRequestBody. Numbers are kept as sent, so large
+// integers such as seeds don't lose precision.
+func decodeRequestObject(body []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var request map[string]interface{}
+	if err := decoder.Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// encodeRequestBody serializes an edited request body, leaving <, > and &
+// unescaped as clients send them
+func encodeRequestBody(request interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(request); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// setBodyField sets the value at a dotted path of a request body, creating
+// intermediate objects as needed and leaving every other byte as sent. A key
+// repeated in the body has each of its values set.
+func setBodyField(body []byte, path []string, value interface{}) ([]byte, error) {
+	encoded, err := encodeRequestBody(value)
+	if err != nil {
+		return nil, err
+	}
+	return setObjectField(body, path, encoded)
+}
+
+func setObjectField(object []byte, path []string, encoded []byte) ([]byte, error) {
+	parsed := gjson.ParseBytes(object)
+	if !gjson.ValidBytes(object) || !parsed.IsObject() {
+		return nil, fmt.Errorf("request body is not a JSON object")
+	}
+	fields := objectFields(parsed, path[0])
+	if len(fields) == 0 {
+		value := encoded
+		for i := len(path) - 1; i > 0; i-- {
+			key, _ := json.Marshal(path[i])
+			value = slices.Concat([]byte("{"), key, []byte(":"), value, []byte("}"))
+		}
+		return insertObjectField(object, parsed, path[0], value), nil
+	}
+
+	rewritten := object
+	for i := len(fields) - 1; i >= 0; i-- {
+		field := fields[i].value
+		value := encoded
+		if len(path) > 1 {
+			nested := []byte(field.Raw)
+			if !field.IsObject() {
+				nested = []byte("{}")
+			}
+			var err error
+			if value, err = setObjectField(nested, path[1:], encoded); err != nil {
+				return nil, err
+			}
+		}
+		rewritten = splice(rewritten, field.Index, field.Index+len(field.Raw), value)
+	}
+	return rewritten, nil
+}
+
+// removeBodyField deletes the values at a dotted path of a request body, with
+// their keys, leaving every other byte as sent
+func removeBodyField(body []byte, path []string) []byte {
+	parsed := gjson.ParseBytes(body)
+	if !parsed.IsObject() {
+		return body
+	}
+	rewritten := body
+	fields := objectFields(parsed, path[0])
+	for i := len(fields) - 1; i >= 0; i-- {
+		key, value := fields[i].key, fields[i].value
+		if len(path) > 1 {
+			if value.IsObject() {
+				nested := removeBodyField([]byte(value.Raw), path[1:])
+				rewritten = splice(rewritten, value.Index, value.Index+len(value.Raw), nested)
+			}
+			continue
+		}
+		// Remove the field with the comma separating it from the next field,
+		// or from the previous one when it is the last
+		start, end := key.Index, value.Index+len(value.Raw)
+		if next := skipSpace(rewritten, end); next < len(rewritten) && rewritten[next] == ',' {
+			end = skipSpace(rewritten, next+1)
+		} else if previous := bytes.LastIndexFunc(rewritten[:start], func(r rune) bool { return !isSpace(r) }); previous >= 0 && rewritten[previous] == ',' {
+			start = previous
+		}
+		rewritten = splice(rewritten, start, end, nil)
+	}
+	return rewritten
+}
+
+// objectField is a field of a parsed JSON object
+type objectField struct {
+	key, value gjson.Result
+}
+
+// objectFields returns the fields of an object with the key, in order
+func objectFields(object gjson.Result, key string) []objectField {
+	var fields []objectField
+	object.ForEach(func(k, v gjson.Result) bool {
+		if k.String() == key {
+			fields = append(fields, objectField{key: k, value: v})
+		}
+		return true
+	})
+	return fields
+}
+
+// insertObjectField adds a field at the end of an object
+func insertObjectField(object []byte, parsed gjson.Result, key string, value []byte) []byte {
+	encodedKey, _ := json.Marshal(key)
+	field := append(append(encodedKey, ':'), value...)
+	empty := true
+	parsed.ForEach(func(_, _ gjson.Result) bool {
+		empty = false
+		return false
+	})
+	if !empty {
+		field = append([]byte(","), field...)
+	}
+	end := bytes.LastIndexByte(object, '}')
+	return splice(object, end, end, field)
+}
+
+// splice returns a copy of b with b[start:end] replaced by value
+func splice(b []byte, start, end int, value []byte) []byte {
+	out := make([]byte, 0, len(b)-(end-start)+len(value))
+	out = append(out, b[:start]...)
+	out = append(out, value...)
+	return append(out, b[end:]...)
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && isSpace(rune(b[i])) {
+		i++
+	}
+	return i
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
@@ -0,0 +1,173 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+)
+
+// exoticRequest sets fields the router doesn't know, with values re-encoding
+// would change: a seed beyond float64 precision, HTML characters, exponents
+// and spacing
+const exoticRequest = `{"model": "auto",
+  "messages": [{"role": "user", "content": "What is the derivative of x^2 <b>&</b>?"}],
+  "temperature": 0.70, "top_p": 1e0, "seed": 12345678901234567890,
+  "max_completion_tokens": 512, "logit_bias": {"50256": -100},
+  "tools": [{"type": "function", "function": {"name": "plot", "strict": true, "parameters": {"type": "object", "properties": {}}}}],
+  "tool_choice": "auto", "parallel_tool_calls": false,
+  "response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}},
+  "stream": false, "stream_options": null, "metadata": {"model": "kept"}, "x_vendor": {"nested": [1, 2.50]}}`
+
+func TestSetRequestModel(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "replaced", body: `{"model":"auto","messages":[],"tools":[{"type":"function"}]}`, want: `{"model":"math-model","messages":[],"tools":[{"type":"function"}]}`},
+		{name: "spacing kept", body: "{\n  \"model\" : \"auto\" ,\n  \"n\": 1\n}", want: "{\n  \"model\" : \"math-model\" ,\n  \"n\": 1\n}"},
+		{name: "every duplicate", body: `{"model":"a","stream":true,"model":"b"}`, want: `{"model":"math-model","stream":true,"model":"math-model"}`},
+		{name: "nested model untouched", body: `{"metadata":{"model":"x"},"model":null}`, want: `{"metadata":{"model":"x"},"model":"math-model"}`},
+		{name: "added", body: `{"messages":[]}`, want: `{"model":"math-model","messages":[]}`},
+		{name: "added to empty", body: ` { } `, want: ` {"model":"math-model" } `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setRequestModel([]byte(tt.body), "math-model")
+			if err != nil || string(got) != tt.want {
+				t.Errorf("setRequestModel = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+
+	for _, body := range []string{`[]`, `"auto"`, `{"model":`} {
+		if _, err := setRequestModel([]byte(body), "math-model"); err == nil {
+			t.Errorf("setRequestModel accepted %s", body)
+		}
+	}
+}
+
+func TestBodyFieldEdits(t *testing.T) {
+	setTests := []struct {
+		body string
+		path string
+		want string
+	}{
+		{`{"a":1}`, "b", `{"a":1,"b":true}`},
+		{`{ }`, "b.c", `{ "b":{"c":true}}`},
+		{`{"b":{"x":1},"seed":12345678901234567890}`, "b.c", `{"b":{"x":1,"c":true},"seed":12345678901234567890}`},
+		{`{"b":"scalar"}`, "b.c", `{"b":{"c":true}}`},
+		{`{"b":1, "b" : 2}`, "b", `{"b":true, "b" : true}`},
+	}
+	for _, tt := range setTests {
+		got, err := setBodyField([]byte(tt.body), strings.Split(tt.path, "."), true)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("setBodyField(%s, %s) = %s, %v, want %s", tt.body, tt.path, got, err, tt.want)
+		}
+	}
+
+	removeTests := []struct {
+		body string
+		path string
+		want string
+	}{
+		{`{"a":1,"b":2}`, "a", `{"b":2}`},
+		{`{"a": 1, "b": 2}`, "b", `{"a": 1}`},
+		{`{"a":1}`, "a", `{}`},
+		{`{"a":{"x":1,"y":2},"z":3}`, "a.y", `{"a":{"x":1},"z":3}`},
+		{`{"a":1,"a":2,"b":3}`, "a", `{"b":3}`},
+		{`{"a":1}`, "c.d", `{"a":1}`},
+	}
+	for _, tt := range removeTests {
+		if got := removeBodyField([]byte(tt.body), strings.Split(tt.path, ".")); string(got) != tt.want {
+			t.Errorf("removeBodyField(%s, %s) = %s, want %s", tt.body, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestProcessPreservesUnknownFields(t *testing.T) {
+	router := newTestRouter(t, false)
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(exoticRequest),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	forwarded := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	want := strings.Replace(exoticRequest, `"model": "auto"`, `"model": "math-model"`, 1)
+	if string(forwarded) != want {
+		t.Errorf("forwarded body\n%s\nwant only the model changed:\n%s", forwarded, want)
+	}
+}
+
+func TestEditedBodiesKeepValues(t *testing.T) {
+	capped, _, err := capMaxTokens([]byte(exoticRequest), []byte(exoticRequest), 100)
+	if err != nil {
+		t.Fatalf("capMaxTokens: %v", err)
+	}
+	templated, err := applyFamilyTemplates(NewFamilyTemplates(nil), []byte(exoticRequest), "deepseek", "high")
+	if err != nil {
+		t.Fatalf("applyFamilyTemplates: %v", err)
+	}
+	for name, body := range map[string][]byte{"capped": capped, "templated": templated} {
+		for path, want := range map[string]string{
+			"seed":                    "12345678901234567890",
+			"temperature":             "0.70",
+			"logit_bias.50256":        "-100",
+			"x_vendor.nested.1":       "2.50",
+			"messages.0.content":      `"What is the derivative of x^2 <b>&</b>?"`,
+			"tools.0.function.strict": "true",
+			"stream_options":          "null",
+		} {
+			if got := gjson.GetBytes(body, path).Raw; got != want {
+				t.Errorf("%s: %s = %s, want %s", name, path, got, want)
+			}
+		}
+	}
+	if got := gjson.GetBytes(capped, "max_completion_tokens").Int(); got != 100 {
+		t.Errorf("max_completion_tokens = %d, want the cap", got)
+	}
+	if !gjson.GetBytes(templated, "chat_template_kwargs.thinking").Bool() {
+		t.Error("template not applied")
+	}
+}
+
+// BenchmarkProcessChatHistory times the request path of chat completions with
+// long histories, from the request headers to the routing decision, cache
+// lookup included
+func BenchmarkProcessChatHistory(b *testing.B) {
+	content := strings.Repeat("lorem ipsum ", 2048/12)
+	for _, turns := range []int{1, 20, 200} {
+		req := OpenAIRequest{Model: "auto"}
+		for i := range turns {
+			req.Messages = append(req.Messages,
+				ChatMessage{Role: "user", Content: fmt.Sprintf("question %d: %s", i, content)},
+				ChatMessage{Role: "assistant", Content: content})
+		}
+		body, err := json.Marshal(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("turns=%d", turns), func(b *testing.B) {
+			router := newTestRouter(b, true)
+			// Without a response the pending cache entry is dropped, so every
+			// request misses the cache
+			requests := []*ext_proc.ProcessingRequest{requestHeaders("x-request-id", "req-1"), requestBody(string(body))}
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for range b.N {
+				stream := &fakeStream{requests: slices.Clone(requests)}
+				if err := router.Process(stream); err != io.EOF {
+					b.Fatalf("Process returned %v", err)
+				}
+			}
+		})
+	}
+}
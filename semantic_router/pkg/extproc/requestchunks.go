@@ -0,0 +1,111 @@
+package extproc
+
+import (
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// defaultMaxRequestBufferBytes bounds how much of a streamed request body is
+// buffered for reassembly
+const defaultMaxRequestBufferBytes = 16 * 1024 * 1024
+
+// maxRequestBufferBytes returns how much of a streamed request body is buffered
+func (r *OpenAIRouter) maxRequestBufferBytes() int {
+	if limit := r.Config.RequestBuffering.MaxBytes; limit > 0 {
+		return limit
+	}
+	return defaultMaxRequestBufferBytes
+}
+
+// chunkedBodyStream wraps the stream of a request to reassemble request bodies
+// Envoy sends in chunks, with request_body_mode STREAMED. Chunks are held
+// back, answered with an empty body, until the last one; the router then
+// receives the whole body in its place, as in BUFFERED mode, and its response
+// replaces the last chunk with the whole body, rewritten or not. Bodies
+// larger than maxBytes are let through unprocessed.
+type chunkedBodyStream struct {
+	ext_proc.ExternalProcessor_ProcessServer
+	reqCtx   *RequestContext
+	maxBytes int
+	// Chunks held back so far
+	buffer []byte
+	chunks int
+	// The body outgrew maxBytes and its remaining chunks pass through
+	overflow bool
+	// Reassembled body the router is processing, to be sent in its response
+	reassembled []byte
+}
+
+func (s *chunkedBodyStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	for {
+		req, err := s.ExternalProcessor_ProcessServer.Recv()
+		if err != nil {
+			return req, err
+		}
+		v, ok := req.Request.(*ext_proc.ProcessingRequest_RequestBody)
+		if !ok {
+			return req, nil
+		}
+		chunk := v.RequestBody
+		if s.chunks == 0 && !s.overflow && chunk.EndOfStream {
+			// The whole body in one message
+			return req, nil
+		}
+
+		var response *ext_proc.CommonResponse
+		switch {
+		case s.overflow:
+			response = &ext_proc.CommonResponse{Status: ext_proc.CommonResponse_CONTINUE}
+		case len(s.buffer)+len(chunk.Body) > s.maxBytes:
+			// Release the chunks held back along with this one
+			s.reqCtx.log.Info("Request body exceeds the buffer limit, passing it through", "limit_bytes", s.maxBytes)
+			metrics.RecordRequestBufferOverflow()
+			s.overflow = true
+			response = &ext_proc.CommonResponse{Status: ext_proc.CommonResponse_CONTINUE}
+			if len(s.buffer) > 0 {
+				response.BodyMutation = &ext_proc.BodyMutation{
+					Mutation: &ext_proc.BodyMutation_Body{Body: append(s.buffer, chunk.Body...)},
+				}
+			}
+			s.buffer = nil
+		default:
+			s.chunks++
+			s.buffer = append(s.buffer, chunk.Body...)
+			if chunk.EndOfStream {
+				s.reqCtx.log.Debug("Reassembled request body", "chunks", s.chunks, "bytes", len(s.buffer))
+				s.reassembled, chunk.Body = s.buffer, s.buffer
+				s.buffer = nil
+				return req, nil
+			}
+			response = &ext_proc.CommonResponse{
+				Status:       ext_proc.CommonResponse_CONTINUE,
+				BodyMutation: &ext_proc.BodyMutation{Mutation: &ext_proc.BodyMutation_ClearBody{ClearBody: true}},
+			}
+		}
+		if err := sendResponse(s.ExternalProcessor_ProcessServer, &ext_proc.ProcessingResponse{
+			Response: &ext_proc.ProcessingResponse_RequestBody{
+				RequestBody: &ext_proc.BodyResponse{Response: response},
+			},
+		}, "request body chunk"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *chunkedBodyStream) Send(response *ext_proc.ProcessingResponse) error {
+	if v, ok := response.Response.(*ext_proc.ProcessingResponse_RequestBody); ok && s.reassembled != nil {
+		// The chunks held back are only in the reassembled body, sent in
+		// place of the last one unless the router rewrote it
+		if v.RequestBody.Response == nil {
+			v.RequestBody.Response = &ext_proc.CommonResponse{}
+		}
+		if v.RequestBody.Response.BodyMutation == nil {
+			v.RequestBody.Response.BodyMutation = &ext_proc.BodyMutation{
+				Mutation: &ext_proc.BodyMutation_Body{Body: s.reassembled},
+			}
+		}
+		s.reassembled = nil
+	}
+	return s.ExternalProcessor_ProcessServer.Send(response)
+}
@@ -0,0 +1,98 @@
+package extproc
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+)
+
+func requestBodyChunk(body string, endOfStream bool) *ext_proc.ProcessingRequest {
+	return &ext_proc.ProcessingRequest{
+		Request: &ext_proc.ProcessingRequest_RequestBody{
+			RequestBody: &ext_proc.HttpBody{Body: []byte(body), EndOfStream: endOfStream},
+		},
+	}
+}
+
+func TestProcessChunkedRequestBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		maxBytes  int
+		wantModel string
+		// Bytes of the body the chunk responses let through, in order
+		wantForwarded []string
+	}{
+		{
+			name:          "routed",
+			body:          `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantModel:     "math-model",
+			wantForwarded: []string{"", "", "rewritten"},
+		},
+		{
+			name:          "unchanged",
+			body:          `{"model":"phi4","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			wantModel:     "phi4",
+			wantForwarded: []string{"", "", "whole"},
+		},
+		{
+			name:          "too large",
+			body:          `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`,
+			maxBytes:      40,
+			wantModel:     "auto",
+			wantForwarded: []string{"", "held", "chunk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.Config.RequestBuffering.MaxBytes = tt.maxBytes
+			third := len(tt.body) / 3
+			chunks := []string{tt.body[:third], tt.body[third : 2*third], tt.body[2*third:]}
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBodyChunk(chunks[0], false),
+				requestBodyChunk(chunks[1], false),
+				requestBodyChunk(chunks[2], true),
+			}}
+			if err := router.Process(stream); !errors.Is(err, io.EOF) {
+				t.Fatalf("Process returned %v", err)
+			}
+			if len(stream.responses) != 4 {
+				t.Fatalf("got %d responses, want 4", len(stream.responses))
+			}
+
+			var forwarded string
+			for i, want := range tt.wantForwarded {
+				mutation := stream.responses[i+1].GetRequestBody().GetResponse().GetBodyMutation()
+				got := string(mutation.GetBody())
+				switch want {
+				case "":
+					if !mutation.GetClearBody() && got != "" {
+						t.Errorf("chunk %d forwarded %q, want it held back", i, got)
+					}
+				case "held":
+					if got != chunks[0]+chunks[1] {
+						t.Errorf("chunk %d forwarded %q, want the chunks held back", i, got)
+					}
+				case "chunk":
+					if mutation != nil {
+						t.Errorf("chunk %d mutated to %q, want it unchanged", i, got)
+					}
+					got = chunks[i]
+				case "whole":
+					if got != tt.body {
+						t.Errorf("chunk %d forwarded %q, want the whole body", i, got)
+					}
+				}
+				forwarded += got
+			}
+			if model := gjson.Get(forwarded, "model").String(); model != tt.wantModel {
+				t.Errorf("forwarded model %q, want %s: %s", model, tt.wantModel, forwarded)
+			}
+		})
+	}
+}
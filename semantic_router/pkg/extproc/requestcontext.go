@@ -0,0 +1,137 @@
+package extproc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/embeddings"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/endpoints"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/pii"
+)
+
+// RequestContext is the state of a request carried through the phases of its
+// ext_proc stream, from the request headers to the end of the response. It
+// belongs to the stream, so nothing is left behind when a response never
+// arrives.
+type RequestContext struct {
+	// ID of the request, from x-request-id or generated when Envoy sent none
+	ID          string
+	GeneratedID bool
+	// Request headers, keyed by lowercase name
+	Headers map[string]string
+	// Request body as received, with PII redacted if any was
+	OriginalBody []byte
+	// Model the client asked for, and the model the request was sent to
+	ClientModel string
+	Model       string
+	// Query the request is cached under
+	Query string
+	// ID of the request's pending cache entry, empty when it has none
+	CacheID string
+
+	// When the request headers and body arrived, the routed request was sent
+	// upstream and the response started
+	StartTime           time.Time
+	ProcessingStartTime time.Time
+	RoutedTime          time.Time
+	ResponseStartTime   time.Time
+
+	// Logger of the request, tagged with its ID once the request headers
+	// arrive and with its model once routed
+	log *slog.Logger
+
+	// Trace context and span of the stream, nil until the request headers arrive
+	traceCtx context.Context
+	span     trace.Span
+
+	selectedEndpoint *endpoints.Selection
+	attemptKey       string
+	// Whether the request returns tool output, and the routing decision made for it
+	toolResultTurn bool
+	routedMatch    categoryMatch
+	// Language detected in the text the request is classified by, empty when
+	// undetected
+	language string
+	// Endpoint of requests passing through without routing, e.g. image
+	// generation, empty for requests to route
+	apiEndpoint string
+	// Endpoint of requests to route, chat_completions, completions,
+	// embeddings or messages, empty for requests passing through
+	routedEndpoint string
+	// Whether the Anthropic Messages API request was translated to a chat
+	// completion, and its response is to be translated back
+	messagesTranslated bool
+	// Signed receipt of the routing decision, empty when receipts are disabled
+	receipt string
+	// Tags of the request by tag name, from the request_tags headers
+	tags map[string]string
+	// Deprecation of the model the request was routed to, announced to the
+	// client in the response headers; nil unless the model is deprecated
+	deprecation *config.ModelDeprecationConfig
+	// Whether the router runs in shadow mode for the stream, applying none of
+	// its decisions
+	shadow bool
+	// Whether the stream is an in-process canary probe, which is routed but
+	// left out of metrics, decision records and other accounting
+	canary       bool
+	requestBytes int
+	// Prompt tokens estimated before routing, reconciled with the reported usage
+	estimatedPromptTokens int
+	// Embeddings computed for the request, shared by the cache lookup and
+	// store and utterance routing so each text is embedded once
+	embeddings *embeddings.Set
+	// Client the request's tokens are counted against, empty when not budgeted
+	budgetIdentity string
+	// Routing policy of the request's tenant, nil when it has none
+	tenant *tenantPolicy
+	// Decision record for the request, written once it completes
+	record *decision.DecisionRecord
+	// Cohorts of the stages being gradually rolled out, and the upstream status
+	stageCohorts   map[string]string
+	responseStatus int
+
+	// Response body state, accumulated across chunks until end of stream
+	responseBuffer    []byte
+	responseChunks    int
+	responseBytes     int
+	responseOverflow  bool
+	responseFinalized bool
+	// Whether the response is a stream of server-sent events
+	responseStreamed bool
+	// How long the upstream allows the response to be cached, if it says
+	upstreamTTL    time.Duration
+	upstreamTTLSet bool
+
+	// Placeholders of the PII tokenized in the request, restored in the
+	// response; nil when none was
+	piiTokens *pii.Tokens
+
+	// Bytes the stream buffers, accounted against the stream budget, and
+	// whether it exceeded the budget and passes through unprocessed
+	bufferedBytes int64
+	passthrough   bool
+}
+
+func newRequestContext() *RequestContext {
+	return &RequestContext{
+		Headers:      make(map[string]string),
+		stageCohorts: make(map[string]string),
+		log:          slog.Default(),
+	}
+}
+
+// ensureID generates a request ID with newID when the request headers carried
+// none, returning whether it did
+func (c *RequestContext) ensureID(newID func() string) bool {
+	if c.ID != "" {
+		return false
+	}
+	c.ID = newID()
+	c.GeneratedID = true
+	return true
+}
@@ -0,0 +1,148 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/google/uuid"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestProcessGeneratesMissingRequestID(t *testing.T) {
+	router := newTestRouter(t, false)
+	sink := &recordingSink{}
+	router.Decisions = sink
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders(":path", "/v1/chat/completions"),
+		requestBody(`{"model":"phi4","messages":[{"role":"user","content":"Capital of Spain?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	_ = router.Process(stream)
+
+	mutation := stream.responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation()
+	if len(mutation.GetSetHeaders()) != 1 || mutation.GetSetHeaders()[0].GetHeader().GetKey() != "x-request-id" {
+		t.Fatalf("expected the generated x-request-id to be set upstream, got %v", mutation)
+	}
+	id := string(mutation.GetSetHeaders()[0].GetHeader().GetRawValue())
+	if _, err := uuid.Parse(id); err != nil {
+		t.Errorf("generated request ID %q is not a UUID: %v", id, err)
+	}
+	if len(sink.records) != 1 || sink.records[0].GetRequestId() != id {
+		t.Errorf("decision record not written under the generated ID %s", id)
+	}
+
+	// Requests with an ID keep it
+	stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{requestHeaders("x-request-id", "req-1")}}
+	_ = router.Process(stream)
+	if mutation := stream.responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation(); len(mutation.GetSetHeaders()) != 0 {
+		t.Errorf("request ID replaced: %v", mutation)
+	}
+}
+
+func TestProcessDropsPendingEntryWhenStreamEnds(t *testing.T) {
+	router := newTestRouter(t, true)
+	// Concurrent requests without IDs each complete their own entry
+	for _, query := range []string{"Capital of Spain?", "Capital of France?"} {
+		_ = router.Process(&fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders(),
+			requestBody(`{"model":"phi4","messages":[{"role":"user","content":"` + query + `"}]}`),
+		}})
+	}
+	if pending := router.Cache.PendingCount(); pending != 0 {
+		t.Errorf("%d pending cache entries left after the streams ended", pending)
+	}
+}
+
+func TestStateJanitorSweep(t *testing.T) {
+	router := newTestRouter(t, true)
+	router.attempts = newAttemptTracker(time.Millisecond)
+	router.toolCalls = newToolCallTracker(time.Millisecond)
+	janitor := newStateJanitor(router, config.RequestStateConfig{})
+	janitor.pendingTTL = time.Millisecond
+
+	if _, err := router.Cache.AddPendingRequest("phi4", "Capital of Spain?", []byte(`{}`)); err != nil {
+		t.Fatalf("AddPendingRequest: %v", err)
+	}
+	router.attempts.begin("req-1")
+	router.toolCalls.record([]string{"call-1"}, categoryMatch{Model: "math-model"})
+	time.Sleep(5 * time.Millisecond)
+	janitor.sweep()
+
+	if pending := router.Cache.PendingCount(); pending != 0 {
+		t.Errorf("%d pending cache entries left after sweeping", pending)
+	}
+	if len(router.attempts.attempts) != 0 {
+		t.Errorf("%d attempts left after sweeping", len(router.attempts.attempts))
+	}
+	if len(router.toolCalls.calls) != 0 {
+		t.Errorf("%d tool calls left after sweeping", len(router.toolCalls.calls))
+	}
+
+	// Stopping a janitor that never started returns
+	janitor.Stop()
+}
+
+// captureLogs sends the default logger's debug output to a buffer for the
+// rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	defaultLogger, output, flags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		log.SetOutput(output)
+		log.SetFlags(flags)
+	})
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	return &buf
+}
+
+func TestProcessLogsCarryRequestContext(t *testing.T) {
+	for _, payloads := range []bool{false, true} {
+		router := newTestRouter(t, false)
+		router.Config.Logging.LogPayloads = payloads
+		buf := captureLogs(t)
+
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-1"),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+
+		entries := make(map[string]map[string]interface{})
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("invalid log line %q: %v", line, err)
+			}
+			entries[entry["msg"].(string)] = entry
+		}
+		if entry := entries["Routing to model"]; entry == nil || entry["request_id"] != "req-1" || entry["model"] != nil {
+			t.Errorf("routing logged without the request ID, or with a model before routing: %v", entry)
+		}
+		if entry := entries["Received response headers"]; entry == nil || entry["request_id"] != "req-1" || entry["model"] != "math-model" {
+			t.Errorf("response logged without the request ID and model: %v", entry)
+		}
+		request, response := entries["Request payload"], entries["Response payload"]
+		if payloads != (request != nil) || payloads != (response != nil) {
+			t.Errorf("log_payloads %v, logged request payload %v and response payload %v", payloads, request != nil, response != nil)
+		}
+		if payloads && !strings.Contains(request["body"].(string), "derivative") {
+			t.Errorf("request payload = %v", request["body"])
+		}
+	}
+}
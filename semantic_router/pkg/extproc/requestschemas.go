@@ -0,0 +1,100 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/cache"
+)
+
+// promptFields maps the routed endpoints besides chat completions to the field
+// holding their prompt text
+var promptFields = map[string]string{
+	apiEndpointCompletions: "prompt",
+	apiEndpointEmbeddings:  "input",
+}
+
+// parseRoutedRequest parses the body of a request to a routed endpoint. Legacy
+// completions and embeddings requests get a user message per prompt or input
+// text, so they are classified like chat completions; prompts of token IDs
+// have no text and get none. The messages of Messages API requests decode as
+// chat messages, their text blocks as text parts; their system prompt is not
+// a message.
+func parseRoutedRequest(endpoint string, data []byte) (*OpenAIRequest, error) {
+	req, err := parseOpenAIRequest(data)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == apiEndpointMessages {
+		req.endpoint = endpoint
+	}
+	field, ok := promptFields[endpoint]
+	if !ok {
+		return req, nil
+	}
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, err
+	}
+	req.endpoint = endpoint
+	req.Messages = nil
+	for _, text := range promptTexts(request[field]) {
+		req.Messages = append(req.Messages, ChatMessage{Role: "user", Content: text})
+	}
+	return req, nil
+}
+
+// promptTexts returns the texts of a prompt or input field, a string or an
+// array of strings, and nil for token IDs
+func promptTexts(value json.RawMessage) []string {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return []string{text}
+	}
+	var texts []string
+	if err := json.Unmarshal(value, &texts); err == nil {
+		return texts
+	}
+	return nil
+}
+
+// redactPrompts replaces the prompt or input texts of a request body, keeping
+// a string prompt a string and every other field of the request
+func redactPrompts(body []byte, endpoint string, texts []string) ([]byte, error) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+	field := promptFields[endpoint]
+	var value any = texts
+	var text string
+	if len(texts) == 1 && json.Unmarshal(request[field], &text) == nil {
+		value = texts[0]
+	}
+	encoded, err := encodeRequestBody(value)
+	if err != nil {
+		return nil, err
+	}
+	request[field] = encoded
+	return encodeRequestBody(request)
+}
+
+// extractCacheQuery returns the model and query of a request for cache lookup.
+// Embeddings are never cached, completions only with a single prompt, and
+// neither completions nor messages when streamed, since cached responses are
+// replayed as chat completion chunks.
+func extractCacheQuery(req *OpenAIRequest, body []byte) (string, string, error) {
+	switch req.endpoint {
+	case "":
+		return cache.ExtractQueryFromValidRequest(body)
+	case apiEndpointMessages:
+		if !req.Stream {
+			return cache.ExtractQueryFromValidRequest(body)
+		}
+	case apiEndpointCompletions:
+		if len(req.Messages) == 1 && !req.Stream {
+			return req.Model, req.Messages[0].Content, nil
+		}
+	}
+	return req.Model, "", nil
+}
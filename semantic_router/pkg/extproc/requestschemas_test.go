@@ -0,0 +1,112 @@
+package extproc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseRoutedRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		body     string
+		want     []string
+	}{
+		{"chat", apiEndpointChatCompletions, `{"model":"m","messages":[{"role":"user","content":"hi"}]}`, []string{"hi"}},
+		{"completion", apiEndpointCompletions, `{"model":"m","prompt":"Once upon a time"}`, []string{"Once upon a time"}},
+		{"completion prompts", apiEndpointCompletions, `{"model":"m","prompt":["a","b"]}`, []string{"a", "b"}},
+		{"completion tokens", apiEndpointCompletions, `{"model":"m","prompt":[1,2,3]}`, nil},
+		{"embedding", apiEndpointEmbeddings, `{"model":"m","input":"some text"}`, []string{"some text"}},
+		{"embedding without input", apiEndpointEmbeddings, `{"model":"m"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseRoutedRequest(tt.endpoint, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseRoutedRequest: %v", err)
+			}
+			var got []string
+			for _, msg := range req.Messages {
+				got = append(got, msg.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) || req.Model != "m" {
+				t.Errorf("parsed model %q and messages %q, want %q", req.Model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPrompts(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		body     string
+		texts    []string
+		want     string
+	}{
+		{apiEndpointCompletions, `{"model":"m","prompt":"Mail jane@example.com"}`, []string{"Mail [EMAIL]"}, `{"model":"m","prompt":"Mail [EMAIL]"}`},
+		{apiEndpointCompletions, `{"model":"m","prompt":["a","jane@example.com"]}`, []string{"a", "[EMAIL]"}, `{"model":"m","prompt":["a","[EMAIL]"]}`},
+		{apiEndpointEmbeddings, `{"input":["jane@example.com"],"model":"m"}`, []string{"[EMAIL]"}, `{"input":["[EMAIL]"],"model":"m"}`},
+	}
+	for _, tt := range tests {
+		got, err := redactPrompts([]byte(tt.body), tt.endpoint, tt.texts)
+		if err != nil {
+			t.Fatalf("redactPrompts(%s): %v", tt.body, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("redactPrompts(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestProcessLegacyEndpoints(t *testing.T) {
+	router := newFixtureRouter(t)
+	send := func(i int, path, body string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", fmt.Sprintf("req-%d", i), ":method", "POST", ":path", path),
+			requestBody(body),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+	completion := `{"model":"auto","prompt":"What is the derivative of x^2?","max_tokens":16}`
+	embedding := `{"model":"auto","input":"What is the derivative of x^2?"}`
+
+	for i, tc := range []struct {
+		name  string
+		path  string
+		body  string
+		hit   bool
+		field string
+	}{
+		{"completion", "/v1/completions", completion, false, "prompt"},
+		{"cached completion", "/v1/completions", completion, true, ""},
+		// Chat completions are not answered with cached legacy completions
+		{"chat", "/v1/chat/completions", `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`, false, "messages"},
+		{"embedding", "/v1/embeddings", embedding, false, "input"},
+		{"repeated embedding", "/v1/embeddings", embedding, false, "input"},
+	} {
+		stream := send(i, tc.path, tc.body)
+		if hit := stream.responses[1].GetImmediateResponse() != nil; hit != tc.hit {
+			t.Fatalf("%s: cache hit %v, want %v", tc.name, hit, tc.hit)
+		}
+		if tc.hit {
+			continue
+		}
+		body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+		if model := gjson.GetBytes(body, "model").String(); model != "math-model" {
+			t.Errorf("%s: routed to %q, want math-model", tc.name, model)
+		}
+		if !gjson.GetBytes(body, tc.field).Exists() || (tc.field != "messages" && gjson.GetBytes(body, "messages").Exists()) {
+			t.Errorf("%s: unexpected forwarded body %s", tc.name, body)
+		}
+	}
+}
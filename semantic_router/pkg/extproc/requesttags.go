@@ -0,0 +1,58 @@
+package extproc
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// tagNamePattern restricts tag names to what reads well as a metric label value
+// and a decision record label
+var tagNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// validateRequestTags checks the request tags: each has a unique name, a
+// header and the values it may be reported under
+func validateRequestTags(tags []config.RequestTagConfig) error {
+	names := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		switch {
+		case !tagNamePattern.MatchString(tag.Name):
+			return fmt.Errorf("invalid request tag %q: names are lowercase letters, digits and underscores", tag.Name)
+		case names[tag.Name]:
+			return fmt.Errorf("invalid request tag %s: duplicate name", tag.Name)
+		case tag.Header == "":
+			return fmt.Errorf("invalid request tag %s: header is required", tag.Name)
+		case len(tag.AllowedValues) == 0:
+			return fmt.Errorf("invalid request tag %s: allowed_values is required to bound the metrics' cardinality", tag.Name)
+		}
+		names[tag.Name] = true
+	}
+	return nil
+}
+
+// requestTags returns the tags of a request by tag name, values outside a
+// tag's allowed values replaced by its other value; nil when the request
+// carries none of the tag headers
+func requestTags(tags []config.RequestTagConfig, headers map[string]string) map[string]string {
+	var values map[string]string
+	for _, tag := range tags {
+		value := strings.TrimSpace(headers[strings.ToLower(tag.Header)])
+		if value == "" {
+			continue
+		}
+		if !slices.Contains(tag.AllowedValues, value) {
+			value = tag.OtherValue
+			if value == "" {
+				value = "other"
+			}
+		}
+		if values == nil {
+			values = make(map[string]string, len(tags))
+		}
+		values[tag.Name] = value
+	}
+	return values
+}
@@ -0,0 +1,77 @@
+package extproc
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestValidateRequestTags(t *testing.T) {
+	tag := func(name, header string, allowed ...string) config.RequestTagConfig {
+		return config.RequestTagConfig{Name: name, Header: header, AllowedValues: allowed}
+	}
+	tests := []struct {
+		name    string
+		tags    []config.RequestTagConfig
+		wantErr bool
+	}{
+		{"valid", []config.RequestTagConfig{tag("team", "x-team", "search"), tag("feature", "x-feature", "chat")}, false},
+		{"invalid name", []config.RequestTagConfig{tag("Team", "x-team", "search")}, true},
+		{"duplicate name", []config.RequestTagConfig{tag("team", "x-team", "search"), tag("team", "x-group", "search")}, true},
+		{"no header", []config.RequestTagConfig{tag("team", "", "search")}, true},
+		{"no allowed values", []config.RequestTagConfig{tag("team", "x-team")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRequestTags(tt.tags); (err != nil) != tt.wantErr {
+				t.Errorf("validateRequestTags = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestTagsRecorded(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.RequestTags = []config.RequestTagConfig{
+		{Name: "team", Header: "X-Team", AllowedValues: []string{"search"}},
+		{Name: "feature", Header: "x-feature", AllowedValues: []string{"chat"}, OtherValue: "unlisted"},
+		{Name: "env", Header: "x-env", AllowedValues: []string{"prod"}},
+	}
+	sink := &recordingSink{}
+	router.Decisions = sink
+	requests := func(model string) float64 {
+		return testutil.ToFloat64(metrics.TaggedRequests.WithLabelValues("team", "search", model))
+	}
+	before := requests("math-model")
+	beforeOther := testutil.ToFloat64(metrics.TaggedTokens.WithLabelValues("feature", "unlisted", "completion"))
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1", "x-team", "search", "x-feature", "bulk-export"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); !errors.Is(err, io.EOF) {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	if got := requests("math-model") - before; got != 1 {
+		t.Errorf("tagged requests = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.TaggedTokens.WithLabelValues("feature", "unlisted", "completion")) - beforeOther; got == 0 {
+		t.Error("tokens of a value outside allowed_values not reported as the other value")
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d decision records, want 1", len(sink.records))
+	}
+	labels := sink.records[0].GetLabels()
+	if len(labels) != 2 || labels["team"] != "search" || labels["feature"] != "unlisted" {
+		t.Errorf("decision record labels = %v, want team=search and feature=unlisted", labels)
+	}
+}
@@ -0,0 +1,120 @@
+package extproc
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Health dimensions reported by the admin API
+const (
+	// Whether the models are loaded
+	HealthClassifier = "classifier"
+	// Whether the models are downloaded and verified
+	HealthModelDownload = "model_download"
+	// Whether every pipeline stage is within its error budget
+	HealthErrorBudgets = "error_budgets"
+)
+
+// modelLoader retries loading the models in the background after they failed
+// to load at startup. Until they load the router runs in safe mode: requests
+// naming a model pass through, "auto" requests go to the default model and the
+// stages needing the models are skipped.
+type modelLoader struct {
+	load        func() error
+	interval    time.Duration
+	maxInterval time.Duration
+	ready       atomic.Bool
+	stop        chan struct{}
+	done        chan struct{}
+	once        sync.Once
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// newModelLoader creates a loader for models that failed to load with err
+func newModelLoader(load func() error, cfg config.SafeModeConfig, err error) *modelLoader {
+	interval := time.Duration(cfg.RetryIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	maxInterval := time.Duration(cfg.MaxRetryIntervalSeconds) * time.Second
+	if maxInterval <= 0 {
+		maxInterval = 5 * time.Minute
+	}
+	maxInterval = max(maxInterval, interval)
+	metrics.RecordHealth(HealthClassifier, false)
+	return &modelLoader{
+		load:        load,
+		interval:    interval,
+		maxInterval: maxInterval,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		lastErr:     err,
+	}
+}
+
+// Ready returns whether the models are loaded. A nil loader, i.e. models that
+// loaded at startup, is always ready.
+func (l *modelLoader) Ready() bool {
+	return l == nil || l.ready.Load()
+}
+
+// Health returns whether the models are loaded and, if not, why
+func (l *modelLoader) Health() (bool, string) {
+	if l.Ready() {
+		return true, ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return false, "safe mode, models failed to load: " + l.lastErr.Error()
+}
+
+// Start retries loading the models in the background with exponential backoff
+// until they load
+func (l *modelLoader) Start() {
+	slog.Info("Retrying to load models in the background", "interval", l.interval)
+	go func() {
+		defer close(l.done)
+		interval := l.interval
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-time.After(interval):
+			}
+			if l.retry() {
+				return
+			}
+			interval = min(2*interval, l.maxInterval)
+		}
+	}()
+}
+
+// Stop stops retrying
+func (l *modelLoader) Stop() {
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+	})
+}
+
+// retry tries to load the models once and reports whether they are loaded
+func (l *modelLoader) retry() bool {
+	if err := l.load(); err != nil {
+		slog.Warn("Models still failing to load, staying in safe mode", "error", err)
+		l.mu.Lock()
+		l.lastErr = err
+		l.mu.Unlock()
+		return false
+	}
+	l.ready.Store(true)
+	metrics.RecordHealth(HealthClassifier, true)
+	slog.Info("Models loaded, leaving safe mode")
+	return true
+}
@@ -0,0 +1,99 @@
+package extproc
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestModelLoaderRetriesUntilLoaded(t *testing.T) {
+	attempts := 0
+	loaded := make(chan struct{})
+	loader := newModelLoader(func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("no GPU")
+		}
+		close(loaded)
+		return nil
+	}, config.SafeModeConfig{}, errors.New("no GPU"))
+	loader.interval = time.Millisecond
+	loader.maxInterval = 2 * time.Millisecond
+
+	if loader.Ready() {
+		t.Fatal("loader ready before the models loaded")
+	}
+	if healthy, detail := loader.Health(); healthy || detail == "" {
+		t.Errorf("Health() = %v, %q, want degraded with a reason", healthy, detail)
+	}
+
+	loader.Start()
+	defer loader.Stop()
+	select {
+	case <-loaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("models were not retried")
+	}
+	loader.Stop()
+	if !loader.Ready() || attempts != 3 {
+		t.Errorf("Ready() = %v after %d attempts, want ready after 3", loader.Ready(), attempts)
+	}
+	if healthy, _ := loader.Health(); !healthy {
+		t.Error("loader unhealthy after the models loaded")
+	}
+
+	var none *modelLoader
+	if !none.Ready() {
+		t.Error("nil loader not ready")
+	}
+}
+
+func TestProcessInSafeMode(t *testing.T) {
+	router := newTestRouter(t, true)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	router.models = newModelLoader(func() error { return nil }, config.SafeModeConfig{}, errors.New("no GPU"))
+	classified := 0
+	router.classify = func(text string) (candle_binding.ClassResult, error) {
+		classified++
+		return fakeClassifier(text)
+	}
+
+	process := func(model string) string {
+		t.Helper()
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-"+model),
+			requestBody(`{"model":"` + model + `","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return sink.records[len(sink.records)-1].GetRouting().GetSelectedModel()
+	}
+
+	// Auto requests go to the default model and explicit models pass through
+	if got := process("auto"); got != "default-model" {
+		t.Errorf("auto routed to %s in safe mode, want default-model", got)
+	}
+	if got := process("law-model"); got != "law-model" {
+		t.Errorf("explicit model routed to %s in safe mode, want law-model", got)
+	}
+	if classified != 0 || router.Cache.PendingCount() != 0 {
+		t.Errorf("classified %d times and cached %d requests in safe mode, want none", classified, router.Cache.PendingCount())
+	}
+
+	if !router.models.retry() {
+		t.Fatal("retry failed")
+	}
+	if got := process("auto"); got != "math-model" {
+		t.Errorf("auto routed to %s after the models loaded, want math-model", got)
+	}
+}
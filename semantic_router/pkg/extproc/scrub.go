@@ -0,0 +1,64 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// headersToScrub returns the response headers matching the configured names.
+// Names ending in "*" match any header with that prefix.
+func headersToScrub(cfg config.ResponseScrubbingConfig, headers *core.HeaderMap) []string {
+	if headers == nil || len(cfg.RemoveHeaders) == 0 {
+		return nil
+	}
+
+	var remove []string
+	for _, h := range headers.Headers {
+		key := strings.ToLower(h.Key)
+		for _, pattern := range cfg.RemoveHeaders {
+			pattern = strings.ToLower(pattern)
+			if strings.HasSuffix(pattern, "*") {
+				if strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+					remove = append(remove, h.Key)
+					break
+				}
+			} else if key == pattern {
+				remove = append(remove, h.Key)
+				break
+			}
+		}
+	}
+	return remove
+}
+
+// scrubResponseBody removes provider-identifying fields from an OpenAI-style
+// response body and rewrites the model name so clients can't tell which backend
+// answered. The model is set to the configured alias, or else to the model the
+// client requested.
+func scrubResponseBody(cfg config.ResponseScrubbingConfig, body []byte, clientModel string) ([]byte, error) {
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response body: %w", err)
+	}
+
+	for _, field := range cfg.RemoveFields {
+		removePath(response, strings.Split(field, "."))
+	}
+
+	if cfg.RewriteModel {
+		model := cfg.ModelAlias
+		if model == "" {
+			model = clientModel
+		}
+		if _, ok := response["model"]; ok && model != "" {
+			response["model"] = model
+		}
+	}
+
+	return json.Marshal(response)
+}
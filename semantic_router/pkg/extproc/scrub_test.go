@@ -0,0 +1,48 @@
+package extproc
+
+import (
+	"reflect"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestScrubResponseBody(t *testing.T) {
+	cfg := config.ResponseScrubbingConfig{
+		Enabled:      true,
+		RemoveFields: []string{"system_fingerprint", "usage.prompt_tokens_details"},
+		RewriteModel: true,
+	}
+	body := []byte(`{"id":"1","model":"phi4","system_fingerprint":"fp_1","usage":{"total_tokens":3,"prompt_tokens_details":{}}}`)
+
+	out, err := scrubResponseBody(cfg, body, "auto")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"id":"1","model":"auto","usage":{"total_tokens":3}}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+
+	cfg.ModelAlias = "router"
+	out, _ = scrubResponseBody(cfg, body, "auto")
+	if want := `{"id":"1","model":"router","usage":{"total_tokens":3}}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
+
+func TestHeadersToScrub(t *testing.T) {
+	cfg := config.ResponseScrubbingConfig{RemoveHeaders: []string{"server", "x-vllm-*"}}
+	headers := &core.HeaderMap{Headers: []*core.HeaderValue{
+		{Key: "content-type"},
+		{Key: "Server"},
+		{Key: "x-vllm-request-id"},
+		{Key: "x-request-id"},
+	}}
+
+	got := headersToScrub(cfg, headers)
+	if want := []string{"Server", "x-vllm-request-id"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package extproc
+
+import (
+	"fmt"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// validateModelSelection checks the model selection config
+func validateModelSelection(cfg config.ModelSelectionConfig) error {
+	switch cfg.Policy {
+	case "", config.ModelSelectionRanked, config.ModelSelectionCheapestAboveThreshold,
+		config.ModelSelectionBestQuality, config.ModelSelectionBalanced:
+	default:
+		return fmt.Errorf("unknown policy %q, expected ranked, cheapest_above_threshold, best_quality or balanced", cfg.Policy)
+	}
+	if cfg.QualityThreshold < 0 || cfg.QualityThreshold > 1 {
+		return fmt.Errorf("quality_threshold must be between 0 and 1")
+	}
+	if cfg.CostWeight < 0 {
+		return fmt.Errorf("cost_weight is negative")
+	}
+	return nil
+}
+
+// blendedCost returns the mean of a model's prompt and completion prices, per
+// million tokens, which models are compared by
+func blendedCost(cfg *config.RouterConfig, model string) float64 {
+	return cfg.GetModelCost(model, 1_000_000, 1_000_000) / 2
+}
+
+// selectCategoryModel picks a model of the category at the given index by the
+// model selection policy then, with load-aware routing, by load, returning it
+// and the category's first ranked model. A dry run records no selection metrics.
+func (r *OpenAIRouter) selectCategoryModel(index int, confidence float32, dryRun bool) (model, ranked string) {
+	selected, ranked := r.selectByPolicy(index, confidence)
+	model = r.leastLoadedModel(selected, r.Config.GetCandidateModelsForCategoryIndex(index))
+	if !dryRun {
+		if selected != ranked {
+			metrics.RecordModelSelection(r.Config.GetModelSelectionPolicy(), ranked, selected)
+		}
+		if model != selected {
+			metrics.RecordLoadAwareSelection(selected, model)
+		}
+	}
+	return model, ranked
+}
+
+// selectByPolicy picks a model of the category at the given index by the model
+// selection policy, returning it and the category's first ranked model. The
+// balanced policy weighs cost by the confidence of the match, so requests
+// whose category is uncertain lean towards quality.
+func (r *OpenAIRouter) selectByPolicy(index int, confidence float32) (model, ranked string) {
+	candidates := r.Config.GetCandidateModelsForCategoryIndex(index)
+	ranked = candidates[0]
+	policy := r.Config.GetModelSelectionPolicy()
+	// The default model ends the candidates as a last resort, not a choice
+	if len(candidates) > 1 {
+		candidates = candidates[:len(candidates)-1]
+	}
+	if policy == config.ModelSelectionRanked || len(candidates) == 1 {
+		return ranked, ranked
+	}
+
+	selection := r.Config.Routing.ModelSelection
+	quality := func(model string) float64 { return r.Config.GetModelQuality(index, model) }
+	maxCost := 0.0
+	for _, candidate := range candidates {
+		maxCost = max(maxCost, blendedCost(r.Config, candidate))
+	}
+
+	// Ties go to the cheaper model, then to the better ranked one as
+	// candidates are visited in rank order
+	best, bestScore, bestCost := "", 0.0, 0.0
+	consider := func(candidate string, score float64) {
+		cost := blendedCost(r.Config, candidate)
+		if best == "" || score > bestScore || (score == bestScore && cost < bestCost) {
+			best, bestScore, bestCost = candidate, score, cost
+		}
+	}
+	switch policy {
+	case config.ModelSelectionCheapestAboveThreshold:
+		threshold := selection.QualityThreshold
+		if threshold == 0 {
+			threshold = 0.7
+		}
+		for _, candidate := range candidates {
+			if quality(candidate) >= threshold {
+				consider(candidate, -blendedCost(r.Config, candidate))
+			}
+		}
+		if best != "" {
+			break
+		}
+		// No model is good enough, pick the best one
+		fallthrough
+	case config.ModelSelectionBestQuality:
+		for _, candidate := range candidates {
+			consider(candidate, quality(candidate))
+		}
+	case config.ModelSelectionBalanced:
+		weight := selection.CostWeight
+		if weight == 0 {
+			weight = 0.5
+		}
+		for _, candidate := range candidates {
+			score := quality(candidate)
+			if maxCost > 0 {
+				score -= weight * float64(confidence) * blendedCost(r.Config, candidate) / maxCost
+			}
+			consider(candidate, score)
+		}
+	}
+	return best, ranked
+}
+
+// recordSelectionCost records the estimated cost of a completed request
+// routed by a cost-aware policy, and what its category's first ranked model
+// would have cost, their difference being the savings
+func (r *OpenAIRouter) recordSelectionCost(reqCtx *RequestContext, promptTokens, completionTokens int) {
+	match := reqCtx.routedMatch
+	if r.Config.GetModelSelectionPolicy() == config.ModelSelectionRanked || match.Category == "" || match.RankedModel == "" || reqCtx.Model == "" {
+		return
+	}
+	metrics.RecordEstimatedCost(match.Category,
+		r.Config.GetModelCost(reqCtx.Model, promptTokens, completionTokens),
+		r.Config.GetModelCost(match.RankedModel, promptTokens, completionTokens))
+}
+
+// leastLoadedModel returns the least loaded of a category's candidate models,
+// the chosen model unless another's load score is lower by more than the
+// tolerance. Models whose load is unknown don't compete, and the chosen model
+// is kept when its own load is unknown, so routing degrades to the semantic
+// choice when load metrics are unavailable. The default model ending the
+// candidates is a last resort, not a choice.
+func (r *OpenAIRouter) leastLoadedModel(chosen string, candidates []string) string {
+	if r.Load == nil || len(candidates) < 2 {
+		return chosen
+	}
+	chosenScore, ok := r.Load.Score(chosen)
+	if !ok {
+		return chosen
+	}
+	tolerance := r.Config.LoadAwareRouting.Tolerance
+	if tolerance == 0 {
+		tolerance = 1
+	}
+	best, bestScore := chosen, chosenScore-tolerance
+	for _, candidate := range candidates[:len(candidates)-1] {
+		if score, ok := r.Load.Score(candidate); ok && score < bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
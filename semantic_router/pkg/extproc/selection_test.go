@@ -0,0 +1,139 @@
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/load"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestSelectCategoryModel(t *testing.T) {
+	tests := []struct {
+		name       string
+		selection  config.ModelSelectionConfig
+		quality    map[string]float64
+		confidence float32
+		want       string
+	}{
+		{name: "ranked", selection: config.ModelSelectionConfig{}, want: "large"},
+		{name: "best quality", selection: config.ModelSelectionConfig{Policy: "best_quality"}, want: "large"},
+		{name: "cheapest above threshold", selection: config.ModelSelectionConfig{Policy: "cheapest_above_threshold"}, want: "medium"},
+		{name: "none above threshold", selection: config.ModelSelectionConfig{Policy: "cheapest_above_threshold", QualityThreshold: 0.99}, want: "large"},
+		{name: "balanced", selection: config.ModelSelectionConfig{Policy: "balanced"}, confidence: 0.9, want: "medium"},
+		{name: "balanced favoring cost", selection: config.ModelSelectionConfig{Policy: "balanced", CostWeight: 2}, confidence: 1, want: "small"},
+		{name: "balanced when uncertain", selection: config.ModelSelectionConfig{Policy: "balanced", CostWeight: 2}, confidence: 0.05, want: "large"},
+		{name: "quality by rank", selection: config.ModelSelectionConfig{Policy: "cheapest_above_threshold", QualityThreshold: 0.5}, quality: map[string]float64{}, want: "medium"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			quality := map[string]float64{"large": 0.95, "medium": 0.8, "small": 0.6}
+			if tt.quality != nil {
+				quality = tt.quality
+			}
+			router.Config.Categories[0] = config.Category{Name: "math", Models: []string{"large", "medium", "small"}, Quality: quality}
+			router.Config.ModelConfig = map[string]config.ModelParams{
+				"large":  {PromptCostPerMillion: 10, CompletionCostPerMillion: 30},
+				"medium": {PromptCostPerMillion: 2, CompletionCostPerMillion: 6},
+				"small":  {PromptCostPerMillion: 0.5, CompletionCostPerMillion: 1.5},
+			}
+			router.Config.Routing.ModelSelection = tt.selection
+			model, ranked := router.selectCategoryModel(0, tt.confidence, false)
+			if model != tt.want || ranked != "large" {
+				t.Errorf("selected %q (ranked %q), want %q", model, ranked, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateModelSelection(t *testing.T) {
+	for _, cfg := range []config.ModelSelectionConfig{
+		{Policy: "cheapest"},
+		{QualityThreshold: 1.5},
+		{CostWeight: -1},
+	} {
+		if err := validateModelSelection(cfg); err == nil {
+			t.Errorf("validateModelSelection accepted %+v", cfg)
+		}
+	}
+}
+
+func TestProcessRecordsSelectionCost(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Categories[0].Models = []string{"math-model", "cheap-model"}
+	router.Config.Categories[0].Quality = map[string]float64{"math-model": 0.9, "cheap-model": 0.8}
+	router.Config.ModelConfig = map[string]config.ModelParams{
+		"math-model":  {PromptCostPerMillion: 10, CompletionCostPerMillion: 30},
+		"cheap-model": {PromptCostPerMillion: 1, CompletionCostPerMillion: 2},
+	}
+	router.Config.Routing.ModelSelection.Policy = config.ModelSelectionCheapestAboveThreshold
+	costBefore := testutil.ToFloat64(metrics.EstimatedCost.WithLabelValues("math"))
+	rankedBefore := testutil.ToFloat64(metrics.EstimatedRankedCost.WithLabelValues("math"))
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if model := gjson.GetBytes(body, "model").String(); model != "cheap-model" {
+		t.Errorf("routed to %q, want cheap-model", model)
+	}
+
+	// 10 prompt and 5 completion tokens
+	cost := testutil.ToFloat64(metrics.EstimatedCost.WithLabelValues("math")) - costBefore
+	ranked := testutil.ToFloat64(metrics.EstimatedRankedCost.WithLabelValues("math")) - rankedBefore
+	if math.Abs(cost-20e-6) > 1e-12 || math.Abs(ranked-250e-6) > 1e-12 {
+		t.Errorf("estimated cost %g, ranked %g, want 2e-05 and 0.00025", cost, ranked)
+	}
+}
+
+func TestLeastLoadedModel(t *testing.T) {
+	loads := map[string]string{"large": "5", "medium": "0.5", "small": "3"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "vllm:num_requests_waiting %s\n", loads[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/metrics")])
+	}))
+	defer server.Close()
+	endpoints := map[string][]config.ModelEndpoint{}
+	for model := range loads {
+		endpoints[model] = []config.ModelEndpoint{{Name: model, Address: server.URL + "/" + model}}
+	}
+	endpoints["unknown"] = []config.ModelEndpoint{{Name: "unknown", Address: server.URL + "/unknown"}}
+
+	router := newTestRouter(t, false)
+	router.Load = load.New(load.Options{ModelEndpoints: endpoints, QueueWeight: 1})
+	router.Load.RunOnce(context.Background())
+	for _, tc := range []struct {
+		chosen     string
+		candidates []string
+		tolerance  float64
+		want       string
+	}{
+		{"large", []string{"large", "medium", "small", "default-model"}, 0, "medium"},
+		{"small", []string{"large", "small", "default-model"}, 0, "small"},
+		{"small", []string{"small", "medium", "default-model"}, 3, "small"},
+		{"unknown", []string{"unknown", "medium", "default-model"}, 0, "unknown"},
+		{"large", []string{"large", "default-model"}, 0, "large"},
+	} {
+		router.Config.LoadAwareRouting.Tolerance = tc.tolerance
+		if got := router.leastLoadedModel(tc.chosen, tc.candidates); got != tc.want {
+			t.Errorf("leastLoadedModel(%s, %v) = %s, want %s", tc.chosen, tc.candidates, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package extproc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// serverCertificates holds the TLS config of the listeners, rebuilt from the
+// certificate files whenever they are reloaded. Handshakes use the config
+// loaded last, so a rotated certificate applies to new connections while
+// established ones keep theirs.
+type serverCertificates struct {
+	cfg     config.ServerTLSConfig
+	current atomic.Pointer[tls.Config]
+	watcher *configWatcher
+}
+
+// newServerCertificates loads the configured certificate files, nil when TLS
+// is disabled
+func newServerCertificates(cfg config.ServerTLSConfig) (*serverCertificates, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls requires cert_file and key_file")
+	}
+	if cfg.RequireClientCert && cfg.ClientCAFile == "" {
+		return nil, errors.New("tls.require_client_cert requires client_ca_file")
+	}
+	c := &serverCertificates{cfg: cfg}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the certificate files, keeping the previous config if they are
+// invalid, e.g. caught in the middle of a rotation
+func (c *serverCertificates) reload() error {
+	tlsConfig, notAfter, err := loadServerTLS(c.cfg)
+	if err != nil {
+		metrics.RecordTLSCertificateReload(false, notAfter)
+		return err
+	}
+	c.current.Store(tlsConfig)
+	metrics.RecordTLSCertificateReload(true, notAfter)
+	return nil
+}
+
+// loadServerTLS builds a TLS config from the certificate files, returning when
+// the server certificate expires
+func loadServerTLS(cfg config.ServerTLSConfig) (*tls.Config, time.Time, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse TLS certificate: %w", err)
+	}
+	cert.Leaf = leaf
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		// gRPC requires HTTP/2 to be negotiated
+		NextProtos: []string{"h2"},
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, time.Time{}, fmt.Errorf("no certificates in client CA %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, leaf.NotAfter, nil
+}
+
+// files returns the certificate files to watch
+func (c *serverCertificates) files() []string {
+	files := []string{c.cfg.CertFile, c.cfg.KeyFile}
+	if c.cfg.ClientCAFile != "" {
+		files = append(files, c.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// watch reloads the certificate files whenever they change
+func (c *serverCertificates) watch(debounce time.Duration) error {
+	watcher, err := newConfigWatcher(c.files(), debounce, func() {
+		if err := c.reload(); err != nil {
+			slog.Error("Error reloading TLS certificates, keeping the previous ones", "error", err)
+			return
+		}
+		slog.Info("Reloaded TLS certificates", "cert_file", c.cfg.CertFile)
+	})
+	if err != nil {
+		return err
+	}
+	c.watcher = watcher
+	return nil
+}
+
+// serverConfig returns the TLS config of the listeners, deferring to the
+// config loaded last on every handshake
+func (c *serverCertificates) serverConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.current.Load(), nil
+		},
+	}
+}
+
+// Close stops watching the certificate files
+func (c *serverCertificates) Close() {
+	if c == nil {
+		return
+	}
+	c.watcher.Close()
+}
@@ -0,0 +1,213 @@
+package extproc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key with the given serial number
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects to a TLS listener of the certificates and returns the
+// serial number of the server certificate
+func handshake(t *testing.T, certificates *serverCertificates, ca *testCA, clientCert *tls.Certificate) (int64, error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis = tls.NewListener(lis, certificates.serverConfig())
+	defer lis.Close()
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		_ = conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+
+	clientConfig := &tls.Config{
+		RootCAs:    ca.pool,
+		ServerName: "localhost",
+		NextProtos: []string{"h2"},
+		// TLS 1.2 fails the handshake itself when the client certificate is rejected
+		MaxVersion: tls.VersionTLS12,
+	}
+	if clientCert != nil {
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+	conn, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestServerCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := config.ServerTLSConfig{
+		Enabled:           true,
+		CertFile:          filepath.Join(dir, "tls.crt"),
+		KeyFile:           filepath.Join(dir, "tls.key"),
+		ClientCAFile:      filepath.Join(dir, "ca.crt"),
+		RequireClientCert: true,
+	}
+	certPEM, keyPEM := ca.issue(t, 100, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+	writeFile(t, cfg.ClientCAFile, ca.pem)
+	clientCertPEM, clientKeyPEM := ca.issue(t, 200, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificates, err := newServerCertificates(cfg)
+	if err != nil {
+		t.Fatalf("newServerCertificates: %v", err)
+	}
+	if serial, err := handshake(t, certificates, ca, &clientCert); err != nil || serial != 100 {
+		t.Fatalf("handshake with a client certificate: serial %d, %v", serial, err)
+	}
+	if _, err := handshake(t, certificates, ca, nil); err == nil {
+		t.Error("client without a certificate was accepted")
+	}
+
+	// A rotated certificate applies to new connections
+	certPEM, keyPEM = ca.issue(t, 101, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+	if err := certificates.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if serial, err := handshake(t, certificates, ca, &clientCert); err != nil || serial != 101 {
+		t.Errorf("handshake after rotation: serial %d, %v", serial, err)
+	}
+
+	// A certificate caught in the middle of a rotation keeps the previous one
+	writeFile(t, cfg.KeyFile, []byte("not a key"))
+	if err := certificates.reload(); err == nil {
+		t.Error("reload of an invalid key succeeded")
+	}
+	if serial, err := handshake(t, certificates, ca, &clientCert); err != nil || serial != 101 {
+		t.Errorf("handshake after a failed reload: serial %d, %v", serial, err)
+	}
+}
+
+func TestServerCertificatesOptionalClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := config.ServerTLSConfig{
+		Enabled:  true,
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	}
+	certPEM, keyPEM := ca.issue(t, 100, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+
+	certificates, err := newServerCertificates(cfg)
+	if err != nil {
+		t.Fatalf("newServerCertificates: %v", err)
+	}
+	if _, err := handshake(t, certificates, ca, nil); err != nil {
+		t.Errorf("handshake without client CA: %v", err)
+	}
+}
+
+func TestNewServerCertificatesRejects(t *testing.T) {
+	tests := map[string]config.ServerTLSConfig{
+		"no key":            {Enabled: true, CertFile: "tls.crt"},
+		"client CA missing": {Enabled: true, CertFile: "tls.crt", KeyFile: "tls.key", RequireClientCert: true},
+		"missing files":     {Enabled: true, CertFile: "missing.crt", KeyFile: "missing.key"},
+	}
+	for name, cfg := range tests {
+		if _, err := newServerCertificates(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if certificates, err := newServerCertificates(config.ServerTLSConfig{CertFile: "tls.crt"}); certificates != nil || err != nil {
+		t.Errorf("disabled TLS: %v, %v", certificates, err)
+	}
+}
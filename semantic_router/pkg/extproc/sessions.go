@@ -0,0 +1,134 @@
+package extproc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/endpoints"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Outcomes of routing a classified turn of a conversation
+const (
+	sessionNew      = "new"
+	sessionSticky   = "sticky"
+	sessionRerouted = "rerouted"
+)
+
+// sessionEntry is the routing decision a conversation sticks to
+type sessionEntry struct {
+	match    categoryMatch
+	lastSeen time.Time
+}
+
+// sessionTracker remembers the model each conversation was routed to, so its
+// later turns go to the same model
+type sessionTracker struct {
+	mu                sync.Mutex
+	ttl               time.Duration
+	rerouteConfidence float32
+	lastPrune         time.Time
+	sessions          map[string]*sessionEntry
+}
+
+// newSessionTracker creates the tracker of conversations, nil when session
+// routing is disabled
+func newSessionTracker(cfg config.SessionRoutingConfig) *sessionTracker {
+	if !cfg.Enabled {
+		return nil
+	}
+	ttl := 30 * time.Minute
+	if cfg.TTLSeconds > 0 {
+		ttl = time.Duration(cfg.TTLSeconds) * time.Second
+	}
+	rerouteConfidence := float32(0.9)
+	if cfg.RerouteConfidence > 0 {
+		rerouteConfidence = cfg.RerouteConfidence
+	}
+	return &sessionTracker{
+		ttl:               ttl,
+		rerouteConfidence: rerouteConfidence,
+		lastPrune:         time.Now(),
+		sessions:          make(map[string]*sessionEntry),
+	}
+}
+
+// route returns the routing decision for a classified turn of a conversation:
+// the conversation's own, unless the turn was classified in another category
+// with at least the reroute confidence, in which case the conversation sticks
+// to the turn's decision from then on
+func (t *sessionTracker) route(key string, match categoryMatch) (categoryMatch, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+	entry, ok := t.sessions[key]
+	switch {
+	case !ok:
+		t.sessions[key] = &sessionEntry{match: match, lastSeen: now}
+		return match, sessionNew
+	case match.Category != "" && match.Category != entry.match.Category && match.Confidence >= t.rerouteConfidence:
+		entry.match, entry.lastSeen = match, now
+		return match, sessionRerouted
+	default:
+		entry.lastSeen = now
+		return entry.match, sessionSticky
+	}
+}
+
+// prune removes conversations not seen within the TTL, at most twice per TTL.
+// Assumes the caller holds the lock
+func (t *sessionTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.ttl/2 {
+		return
+	}
+	t.expire(now)
+}
+
+// expire removes conversations not seen within the TTL, returning how many
+// were removed. Assumes the caller holds the lock
+func (t *sessionTracker) expire(now time.Time) int {
+	expired := 0
+	for key, entry := range t.sessions {
+		if now.Sub(entry.lastSeen) > t.ttl {
+			delete(t.sessions, key)
+			expired++
+		}
+	}
+	t.lastPrune = now
+	return expired
+}
+
+// sweep removes expired conversations for the janitor; a nil tracker has none
+func (t *sessionTracker) sweep() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.expire(time.Now())
+}
+
+// sessionMatch routes a classified turn of a conversation with the model the
+// conversation was routed to, returning the classified match when session
+// routing is disabled or the conversation can't be identified. Conversations
+// are keyed by tenant and a hash of their ID, so prompts are not kept. Canary
+// probes are never sticky, so each run exercises classification.
+func (r *OpenAIRouter) sessionMatch(reqCtx *RequestContext, req *OpenAIRequest, match categoryMatch) categoryMatch {
+	if r.sessions == nil || match.Model == "" || reqCtx.canary {
+		return match
+	}
+	key := getSessionKey(reqCtx.Headers, r.Config.SessionRouting.SessionHeader, req)
+	if key == "" {
+		return match
+	}
+	routed, outcome := r.sessions.route(reqCtx.record.Routing.Tenant+"/"+endpoints.SessionHash(key), match)
+	metrics.RecordSessionRouting(outcome)
+	if outcome == sessionSticky && routed.Model != match.Model {
+		reqCtx.log.Info("Keeping the model of the conversation", "session_model", routed.Model,
+			"classified_model", match.Model, "category", match.Category, "confidence", match.Confidence)
+	}
+	return routed
+}
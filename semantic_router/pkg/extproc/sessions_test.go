@@ -0,0 +1,78 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestSessionTrackerRoute(t *testing.T) {
+	tracker := newSessionTracker(config.SessionRoutingConfig{Enabled: true, TTLSeconds: 60})
+	math := categoryMatch{Model: "math-model", Category: "math", Confidence: 0.7}
+	for _, tc := range []struct {
+		match       categoryMatch
+		wantModel   string
+		wantOutcome string
+	}{
+		{math, "math-model", sessionNew},
+		{categoryMatch{Model: "law-model", Category: "law", Confidence: 0.8}, "math-model", sessionSticky},
+		{categoryMatch{Model: "default-model"}, "math-model", sessionSticky},
+		{categoryMatch{Model: "law-model", Category: "law", Confidence: 0.95}, "law-model", sessionRerouted},
+		{categoryMatch{Model: "math-model", Category: "math", Confidence: 0.5}, "law-model", sessionSticky},
+	} {
+		if routed, outcome := tracker.route("conversation", tc.match); routed.Model != tc.wantModel || outcome != tc.wantOutcome {
+			t.Errorf("route(%+v) = %s, %s, want %s, %s", tc.match, routed.Model, outcome, tc.wantModel, tc.wantOutcome)
+		}
+	}
+
+	tracker.sessions["conversation"].lastSeen = time.Now().Add(-2 * time.Minute)
+	if expired := tracker.sweep(); expired != 1 {
+		t.Errorf("swept %d conversations, want 1", expired)
+	}
+	if newSessionTracker(config.SessionRoutingConfig{}) != nil {
+		t.Error("a tracker was created with session routing disabled")
+	}
+}
+
+func TestProcessSessionRouting(t *testing.T) {
+	const firstTurn = `{"role":"user","content":"What is the derivative of x^2?"},{"role":"assistant","content":"2x"}`
+	for _, tc := range []struct {
+		name              string
+		rerouteConfidence float32
+		headers           []string
+		wantModel         string
+	}{
+		{"sticky", 0, nil, "math-model"},
+		{"confident reroute", 0.75, nil, "law-model"},
+		{"other conversation", 0, []string{"x-session-id", "s2"}, "law-model"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			router.Config.SessionRouting = config.SessionRoutingConfig{Enabled: true, SessionHeader: "x-session-id", RerouteConfidence: tc.rerouteConfidence}
+			router.sessions = newSessionTracker(router.Config.SessionRouting)
+
+			route := func(body string, headers ...string) string {
+				stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{requestHeaders(headers...), requestBody(body)}}
+				if err := router.Process(stream); err != io.EOF {
+					t.Fatalf("Process returned %v", err)
+				}
+				return gjson.GetBytes(stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody(), "model").String()
+			}
+			if model := route(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`, "x-session-id", "s1"); model != "math-model" {
+				t.Fatalf("first turn routed to %q, want math-model", model)
+			}
+			headers := tc.headers
+			if headers == nil {
+				headers = []string{"x-session-id", "s1"}
+			}
+			if model := route(`{"model":"auto","messages":[`+firstTurn+`,{"role":"user","content":"Is plagiarising it a crime?"}]}`, headers...); model != tc.wantModel {
+				t.Errorf("second turn routed to %q, want %s", model, tc.wantModel)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package extproc
+
+import (
+	"fmt"
+	"slices"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Modes of the router
+const (
+	// Routing decisions are applied
+	RouterModeEnforce = "enforce"
+	// Routing decisions are made and recorded, but requests pass through unchanged
+	RouterModeShadow = "shadow"
+	// Requests are continued as soon as each message arrives, routing decisions
+	// are made asynchronously and recorded as in shadow mode
+	RouterModeSpeculative = "speculative"
+)
+
+// Actions suppressed in shadow mode, recorded in metrics
+const (
+	shadowImmediateResponse = "immediate_response"
+	shadowMutation          = "mutation"
+)
+
+// validateRouterMode checks the configured mode of the router
+func validateRouterMode(mode string) error {
+	switch mode {
+	case "", RouterModeEnforce, RouterModeShadow, RouterModeSpeculative:
+		return nil
+	}
+	return fmt.Errorf("invalid mode %q: must be %s, %s or %s", mode, RouterModeEnforce, RouterModeShadow, RouterModeSpeculative)
+}
+
+// shadowStream wraps the stream of a request in shadow mode. The router
+// processes the request as usual, but each response it sends is replaced by
+// one continuing the phase unchanged: mutations are dropped and immediate
+// responses, cache hits and rejections alike, let the request through.
+// Dynamic metadata is kept for Envoy's access logs.
+type shadowStream struct {
+	ext_proc.ExternalProcessor_ProcessServer
+	router *OpenAIRouter
+	reqCtx *RequestContext
+	// Message the next response answers
+	last *ext_proc.ProcessingRequest
+}
+
+func (s *shadowStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	req, err := s.ExternalProcessor_ProcessServer.Recv()
+	if err == nil {
+		s.last = req
+	}
+	return req, err
+}
+
+func (s *shadowStream) Send(response *ext_proc.ProcessingResponse) error {
+	phase, passthrough := continueUnchanged(s.last, response.GetDynamicMetadata())
+	action := ""
+	switch v := response.Response.(type) {
+	case *ext_proc.ProcessingResponse_ImmediateResponse:
+		action = shadowImmediateResponse
+		s.reqCtx.log.Info("Shadow mode, letting the request through instead of answering it",
+			"phase", phase, "status", v.ImmediateResponse.GetStatus().GetCode().Number())
+	case *ext_proc.ProcessingResponse_RequestHeaders:
+		passthrough.ModeOverride = response.ModeOverride
+		if mutates(withoutDestinationStrip(v.RequestHeaders.GetResponse())) {
+			action = shadowMutation
+		}
+	case *ext_proc.ProcessingResponse_RequestBody:
+		if mutates(v.RequestBody.GetResponse()) {
+			action = shadowMutation
+			s.reqCtx.log.Info("Shadow mode, forwarding the request unchanged", "selected_model", s.reqCtx.Model)
+		}
+		// The response comes from the model the client asked for, so it must
+		// neither complete the would-be model's cache entry nor count against
+		// its circuit or endpoint
+		s.router.releasePendingRequest(s.reqCtx)
+		s.reqCtx.Model = s.reqCtx.ClientModel
+		s.reqCtx.selectedEndpoint = nil
+	case *ext_proc.ProcessingResponse_ResponseHeaders:
+		passthrough.ModeOverride = response.ModeOverride
+		if mutates(v.ResponseHeaders.GetResponse()) {
+			action = shadowMutation
+		}
+	case *ext_proc.ProcessingResponse_ResponseBody:
+		if mutates(v.ResponseBody.GetResponse()) {
+			action = shadowMutation
+		}
+	case *ext_proc.ProcessingResponse_RequestTrailers:
+		if v.RequestTrailers.GetHeaderMutation() != nil {
+			action = shadowMutation
+		}
+	case *ext_proc.ProcessingResponse_ResponseTrailers:
+		if v.ResponseTrailers.GetHeaderMutation() != nil {
+			action = shadowMutation
+		}
+	}
+	if action != "" {
+		metrics.RecordShadowSuppressed(phase, action)
+	}
+	return s.ExternalProcessor_ProcessServer.Send(passthrough)
+}
+
+// mutates reports whether a response changes the message it answers
+func mutates(response *ext_proc.CommonResponse) bool {
+	return response.GetHeaderMutation() != nil || response.GetBodyMutation() != nil ||
+		response.GetClearRouteCache() || response.GetStatus() != ext_proc.CommonResponse_CONTINUE
+}
+
+// withoutDestinationStrip returns the response without the removal of the
+// destination endpoint header every request gets
+func withoutDestinationStrip(response *ext_proc.CommonResponse) *ext_proc.CommonResponse {
+	if response.GetHeaderMutation() == nil {
+		return response
+	}
+	stripped := proto.Clone(response).(*ext_proc.CommonResponse)
+	stripped.HeaderMutation.RemoveHeaders = slices.DeleteFunc(stripped.HeaderMutation.RemoveHeaders, func(header string) bool {
+		return header == destinationEndpointHeader
+	})
+	if len(stripped.HeaderMutation.RemoveHeaders) == 0 && len(stripped.HeaderMutation.SetHeaders) == 0 {
+		stripped.HeaderMutation = nil
+	}
+	return stripped
+}
+
+// continueUnchanged returns the phase of a message and a response continuing
+// it without changes, other than dropping a destination endpoint the client
+// sent
+func continueUnchanged(req *ext_proc.ProcessingRequest, metadata *structpb.Struct) (string, *ext_proc.ProcessingResponse) {
+	passthrough := &ext_proc.ProcessingResponse{DynamicMetadata: metadata}
+	switch req.GetRequest().(type) {
+	case *ext_proc.ProcessingRequest_RequestHeaders:
+		passthrough.Response = &ext_proc.ProcessingResponse_RequestHeaders{RequestHeaders: &ext_proc.HeadersResponse{
+			Response: &ext_proc.CommonResponse{HeaderMutation: stripDestinationEndpoint(nil)},
+		}}
+		return "request_headers", passthrough
+	case *ext_proc.ProcessingRequest_RequestBody:
+		passthrough.Response = &ext_proc.ProcessingResponse_RequestBody{RequestBody: &ext_proc.BodyResponse{}}
+		return "request_body", passthrough
+	case *ext_proc.ProcessingRequest_ResponseHeaders:
+		passthrough.Response = &ext_proc.ProcessingResponse_ResponseHeaders{ResponseHeaders: &ext_proc.HeadersResponse{}}
+		return "response_headers", passthrough
+	case *ext_proc.ProcessingRequest_ResponseBody:
+		passthrough.Response = &ext_proc.ProcessingResponse_ResponseBody{ResponseBody: &ext_proc.BodyResponse{}}
+		return "response_body", passthrough
+	case *ext_proc.ProcessingRequest_RequestTrailers:
+		passthrough.Response = &ext_proc.ProcessingResponse_RequestTrailers{RequestTrailers: &ext_proc.TrailersResponse{}}
+		return "request_trailers", passthrough
+	default:
+		passthrough.Response = &ext_proc.ProcessingResponse_ResponseTrailers{ResponseTrailers: &ext_proc.TrailersResponse{}}
+		return "response_trailers", passthrough
+	}
+}
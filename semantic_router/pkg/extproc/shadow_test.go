@@ -0,0 +1,154 @@
+package extproc
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestValidateRouterMode(t *testing.T) {
+	for _, mode := range []string{"", RouterModeEnforce, RouterModeShadow, RouterModeSpeculative} {
+		if err := validateRouterMode(mode); err != nil {
+			t.Errorf("mode %q rejected: %v", mode, err)
+		}
+	}
+	if validateRouterMode("dry-run") == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+func TestShadowModeRoutesWithoutApplying(t *testing.T) {
+	router := newTestRouter(t, true)
+	router.Config.Mode = RouterModeShadow
+	sink := &recordingSink{}
+	router.Decisions = sink
+	before := testutil.ToFloat64(metrics.ShadowSuppressed.WithLabelValues("request_body", shadowMutation))
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders(),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); !errors.Is(err, io.EOF) {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	if len(stream.responses) != 4 {
+		t.Fatalf("got %d responses, want 4", len(stream.responses))
+	}
+	for i, response := range stream.responses {
+		if response.GetImmediateResponse() != nil {
+			t.Fatalf("response %d answered the request in shadow mode", i)
+		}
+	}
+	// The generated request ID and the rerouted body are not applied, while a
+	// client-sent destination endpoint is still dropped
+	if headers := stream.responses[0].GetRequestHeaders().GetResponse(); withoutDestinationStrip(headers).GetHeaderMutation() != nil ||
+		!slices.Equal(headers.GetHeaderMutation().GetRemoveHeaders(), []string{destinationEndpointHeader}) {
+		t.Errorf("request headers mutated: %v", stream.responses[0])
+	}
+	if body := stream.responses[1].GetRequestBody(); body.GetResponse() != nil {
+		t.Errorf("request body mutated: %v", body)
+	}
+	if got := testutil.ToFloat64(metrics.ShadowSuppressed.WithLabelValues("request_body", shadowMutation)) - before; got != 1 {
+		t.Errorf("suppressed request body mutations = %v, want 1", got)
+	}
+
+	// The decision is still recorded, marked as not applied
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d decision records, want 1", len(sink.records))
+	}
+	record := sink.records[0]
+	if !record.GetShadow() || record.GetRouting().GetSelectedModel() != "math-model" {
+		t.Errorf("unexpected shadow decision record: %v", record)
+	}
+	// The response of the unrouted request is not cached for the would-be model
+	if pending := router.Cache.PendingCount(); pending != 0 {
+		t.Errorf("%d cache entries left pending", pending)
+	}
+}
+
+func TestShadowModeDoesNotServeFromCache(t *testing.T) {
+	router := newTestRouter(t, true)
+	router.Config.Mode = RouterModeShadow
+	sink := &recordingSink{}
+	router.Decisions = sink
+	if err := router.Cache.AddEntry("phi4", "capital of France?", []byte(`{}`), []byte(`{"cached":true}`)); err != nil {
+		t.Fatalf("failed to seed cache: %v", err)
+	}
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"phi4","messages":[{"role":"user","content":"Capital of France, please"}]}`),
+	}}
+	if err := router.Process(stream); err != nil {
+		t.Fatalf("Process returned %v", err)
+	}
+	if len(stream.responses) != 2 || stream.responses[1].GetRequestBody() == nil {
+		t.Fatalf("cache hit not passed through: %v", stream.responses)
+	}
+	if len(sink.records) != 1 || !sink.records[0].GetCacheHit() || !sink.records[0].GetShadow() {
+		t.Errorf("cache hit not recorded: %v", sink.records)
+	}
+}
+
+func TestSpeculativeModeContinuesBeforeRouting(t *testing.T) {
+	router := newTestRouter(t, true)
+	router.Config.Mode = RouterModeSpeculative
+	sink := &recordingSink{}
+	router.Decisions = sink
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders(),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); !errors.Is(err, io.EOF) {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	if len(stream.responses) != 4 {
+		t.Fatalf("got %d responses, want 4", len(stream.responses))
+	}
+	for i, response := range stream.responses {
+		if response.GetImmediateResponse() != nil || mutates(withoutDestinationStrip(response.GetRequestHeaders().GetResponse())) ||
+			response.GetRequestBody().GetResponse() != nil || response.GetResponseBody().GetResponse() != nil {
+			t.Errorf("response %d changed the message in speculative mode: %v", i, response)
+		}
+	}
+	// Process waits for the asynchronous routing before returning
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d decision records, want 1", len(sink.records))
+	}
+	if record := sink.records[0]; !record.GetShadow() || record.GetRouting().GetSelectedModel() != "math-model" {
+		t.Errorf("unexpected speculative decision record: %v", record)
+	}
+	if pending := router.Cache.PendingCount(); pending != 0 {
+		t.Errorf("%d cache entries left pending", pending)
+	}
+}
+
+func TestSpeculativeModeOutlivesRouterErrors(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Mode = RouterModeSpeculative
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders(),
+		requestBody(`{"model":`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); !errors.Is(err, io.EOF) {
+		t.Fatalf("Process returned %v", err)
+	}
+	if len(stream.responses) != 4 {
+		t.Errorf("got %d responses, want every message continued", len(stream.responses))
+	}
+}
@@ -0,0 +1,121 @@
+package extproc
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/debugstore"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Pipeline stages a request's latency is split into for slow request traces
+const (
+	// Client upload, from request headers to the complete request body
+	StageRequest = "request"
+	// Cache lookup, classification and endpoint selection in the router
+	StageRouting = "routing"
+	// Upstream time to first byte, from the routed request to response headers
+	StageUpstream = "upstream"
+	// Response transfer, from response headers to the end of the response body
+	StageResponse = "response"
+)
+
+// redactedValue replaces the value of sensitive headers in traces
+const redactedValue = "[REDACTED]"
+
+// credentialHeaders are always redacted in traces
+var credentialHeaders = []string{"authorization", "proxy-authorization", "cookie", "set-cookie", "x-api-key", "api-key"}
+
+// requestTimings are the points in time a request passes through the pipeline
+type requestTimings struct {
+	headers         time.Time
+	body            time.Time
+	routed          time.Time
+	responseHeaders time.Time
+}
+
+// stageSeconds splits the time up to end into pipeline stages, leaving out
+// stages the request never reached
+func (t requestTimings) stageSeconds(end time.Time) map[string]float64 {
+	stages := make(map[string]float64)
+	points := []struct {
+		stage string
+		start time.Time
+	}{
+		{StageRequest, t.headers},
+		{StageRouting, t.body},
+		{StageUpstream, t.routed},
+		{StageResponse, t.responseHeaders},
+	}
+	for i, point := range points {
+		if point.start.IsZero() {
+			break
+		}
+		stop := end
+		if i+1 < len(points) && !points[i+1].start.IsZero() {
+			stop = points[i+1].start
+		}
+		stages[point.stage] = stop.Sub(point.start).Seconds()
+	}
+	return stages
+}
+
+// captureSlowRequest stores the trace of a request exceeding the latency SLO
+// and counts the breach by the stage that dominated
+func (r *OpenAIRouter) captureSlowRequest(requestID string, timings requestTimings, headers map[string]string, record *decision.DecisionRecord) {
+	tracingCfg := r.Config.SlowRequestTracing
+	if !tracingCfg.Enabled || tracingCfg.SLOMilliseconds <= 0 || timings.headers.IsZero() {
+		return
+	}
+	now := time.Now()
+	total := now.Sub(timings.headers)
+	if total <= time.Duration(tracingCfg.SLOMilliseconds)*time.Millisecond {
+		return
+	}
+
+	stages := timings.stageSeconds(now)
+	dominant := debugstore.DominantStage(stages)
+	metrics.RecordSLOBreach(dominant)
+	slog.Warn("Request exceeded the latency SLO", "request_id", requestID, "total", total, "slo_ms", tracingCfg.SLOMilliseconds, "dominant_stage", dominant)
+
+	trace := &debugstore.Trace{
+		RequestID:     requestID,
+		CapturedAt:    now,
+		Reason:        "slo_breach",
+		TotalSeconds:  total.Seconds(),
+		StageSeconds:  stages,
+		DominantStage: dominant,
+		Headers:       redactHeaders(headers, tracingCfg.RedactHeaders),
+	}
+	if record != nil {
+		data, err := decision.MarshalJSON(record)
+		if err != nil {
+			slog.Error("Error encoding decision record for trace", "request_id", requestID, "error", err)
+		} else {
+			trace.Decision = data
+		}
+	}
+	r.Traces.Add(trace)
+}
+
+// redactHeaders copies request headers, replacing the values of credential
+// headers and the configured extra ones
+func redactHeaders(headers map[string]string, extra []string) map[string]string {
+	sensitive := make(map[string]bool)
+	for _, name := range credentialHeaders {
+		sensitive[name] = true
+	}
+	for _, name := range extra {
+		sensitive[strings.ToLower(name)] = true
+	}
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if sensitive[name] {
+			value = redactedValue
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
@@ -0,0 +1,106 @@
+package extproc
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/debugstore"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestStageSeconds(t *testing.T) {
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	full := requestTimings{headers: at(0), body: at(10), routed: at(60), responseHeaders: at(1060)}.stageSeconds(at(1260))
+	want := map[string]float64{StageRequest: 0.01, StageRouting: 0.05, StageUpstream: 1, StageResponse: 0.2}
+	for stage, seconds := range want {
+		if diff := full[stage] - seconds; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("stage %s = %v, want %v", stage, full[stage], seconds)
+		}
+	}
+
+	// A request that never got a response ends in the upstream stage
+	partial := requestTimings{headers: at(0), body: at(10), routed: at(60)}.stageSeconds(at(560))
+	if len(partial) != 3 || partial[StageUpstream] != 0.5 {
+		t.Errorf("unexpected stages without a response: %v", partial)
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := map[string]string{
+		"authorization": "Bearer secret",
+		"x-tenant-id":   "acme",
+		"x-user-email":  "someone@example.com",
+	}
+	got := redactHeaders(headers, []string{"X-User-Email"})
+	if got["authorization"] != redactedValue || got["x-user-email"] != redactedValue || got["x-tenant-id"] != "acme" {
+		t.Errorf("unexpected redaction: %v", got)
+	}
+	if headers["authorization"] != "Bearer secret" {
+		t.Error("redaction must not modify the request headers")
+	}
+}
+
+func TestProcessCapturesSlowRequests(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.SlowRequestTracing = config.SlowRequestTracingConfig{Enabled: true, SLOMilliseconds: 20}
+	router.Traces, _ = debugstore.New(debugstore.Options{})
+
+	run := func(requestID string, upstreamDelay time.Duration) {
+		stream := &slowStream{fakeStream: fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", requestID, "authorization", "Bearer secret"),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}, delayBefore: 2, delay: upstreamDelay}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+	}
+
+	breaches := metrics.SLOBreaches.WithLabelValues(StageUpstream)
+	before := testutil.ToFloat64(breaches)
+	run("fast", 0)
+	run("slow", 50*time.Millisecond)
+
+	if got := testutil.ToFloat64(breaches) - before; got != 1 {
+		t.Errorf("upstream SLO breaches = %v, want 1", got)
+	}
+	if _, ok := router.Traces.Get("fast"); ok {
+		t.Error("expected no trace for a request within the SLO")
+	}
+	trace, ok := router.Traces.Get("slow")
+	if !ok {
+		t.Fatal("expected a trace for the slow request")
+	}
+	if trace.DominantStage != StageUpstream || trace.Headers["authorization"] != redactedValue {
+		t.Errorf("unexpected trace: %+v", trace)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(trace.Decision, &record); err != nil || record["request_id"] != "slow" {
+		t.Errorf("expected the decision record in the trace, got %s", trace.Decision)
+	}
+}
+
+// slowStream delays the delivery of one request, simulating a slow pipeline stage
+type slowStream struct {
+	fakeStream
+	received    int
+	delayBefore int
+	delay       time.Duration
+}
+
+func (s *slowStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	if s.received == s.delayBefore {
+		time.Sleep(s.delay)
+	}
+	s.received++
+	return s.fakeStream.Recv()
+}
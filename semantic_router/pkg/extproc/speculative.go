@@ -0,0 +1,78 @@
+package extproc
+
+import (
+	"io"
+	"log/slog"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// speculativeQueueSize bounds the messages of a stream waiting for the router
+// in speculative mode, beyond which they are dropped rather than held
+const speculativeQueueSize = 64
+
+// processSpeculatively answers each message of a stream as soon as it arrives,
+// continuing it unchanged, while the router processes the messages
+// asynchronously in shadow mode. Envoy never waits for classification, so
+// routing data can be collected with no added latency before enforcing it.
+func (r *OpenAIRouter) processSpeculatively(stream ext_proc.ExternalProcessor_ProcessServer) error {
+	spec := &speculativeStream{
+		ExternalProcessor_ProcessServer: stream,
+		queue:                           make(chan *ext_proc.ProcessingRequest, speculativeQueueSize),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := r.process(spec, true); err != io.EOF {
+			slog.Debug("Speculative processing ended early", "reason", err)
+		}
+	}()
+	defer func() {
+		close(spec.queue)
+		<-done
+	}()
+
+	dropped := false
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			slog.Debug("Stream ended", "reason", err)
+			return err
+		}
+		_, response := continueUnchanged(req, nil)
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+		select {
+		case <-done:
+			// The router stopped processing the stream, as when it answered
+			// the request, and needs no more messages
+		case spec.queue <- req:
+		default:
+			if !dropped {
+				slog.Warn("Speculative processing fell behind, dropping messages of the stream")
+				dropped = true
+			}
+		}
+	}
+}
+
+// speculativeStream is the stream the router processes in speculative mode:
+// it receives the messages already answered and discards the router's
+// responses
+type speculativeStream struct {
+	ext_proc.ExternalProcessor_ProcessServer
+	queue chan *ext_proc.ProcessingRequest
+}
+
+func (s *speculativeStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	req, ok := <-s.queue
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (s *speculativeStream) Send(*ext_proc.ProcessingResponse) error {
+	return nil
+}
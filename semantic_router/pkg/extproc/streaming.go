@@ -0,0 +1,278 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// eventStreamContentType is the content type of streamed chat completions
+const eventStreamContentType = "text/event-stream"
+
+// sseDone is the payload of the event ending an OpenAI stream
+const sseDone = "[DONE]"
+
+// isEventStream reports whether a content type is that of server-sent events
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == eventStreamContentType
+}
+
+// sseData returns the data payloads of the events in a server-sent event
+// stream, excluding the terminating [DONE] event
+func sseData(body []byte) [][]byte {
+	var payloads [][]byte
+	var event []byte
+	flush := func() {
+		if event != nil && string(event) != sseDone {
+			payloads = append(payloads, event)
+		}
+		event = nil
+	}
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 {
+			flush()
+			continue
+		}
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			// Comments and other fields carry nothing of the completion
+			continue
+		}
+		data = bytes.TrimPrefix(data, []byte(" "))
+		if event != nil {
+			event = append(append(event, '\n'), data...)
+		} else {
+			event = append([]byte{}, data...)
+		}
+	}
+	flush()
+	return payloads
+}
+
+// streamedToolCall is a tool call as streamed in chat.completion.chunk deltas
+type streamedToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// completionChunk is a chat.completion.chunk event of a streamed completion
+type completionChunk struct {
+	ID                string `json:"id"`
+	Created           int64  `json:"created"`
+	Model             string `json:"model"`
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	Choices           []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role      string             `json:"role"`
+			Content   string             `json:"content"`
+			ToolCalls []streamedToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *OpenAIUsage `json:"usage"`
+}
+
+// assembledMessage is the message of a choice reassembled from its deltas
+type assembledMessage struct {
+	Role      string             `json:"role"`
+	Content   string             `json:"content"`
+	ToolCalls []streamedToolCall `json:"tool_calls,omitempty"`
+}
+
+// assembledChoice is a choice of a completion reassembled from a stream
+type assembledChoice struct {
+	Index        int              `json:"index"`
+	Message      assembledMessage `json:"message"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+// assembledCompletion is the chat.completion equivalent to a stream
+type assembledCompletion struct {
+	ID                string            `json:"id"`
+	Object            string            `json:"object"`
+	Created           int64             `json:"created"`
+	Model             string            `json:"model"`
+	SystemFingerprint string            `json:"system_fingerprint,omitempty"`
+	Choices           []assembledChoice `json:"choices"`
+	Usage             *OpenAIUsage      `json:"usage,omitempty"`
+}
+
+// assembleStreamedCompletion reassembles the chat.completion a stream of
+// chat.completion.chunk events amounts to, so streamed responses are
+// accounted for and cached like buffered ones. Usage is only present when the
+// stream reported it, i.e. the request set stream_options.include_usage.
+func assembleStreamedCompletion(body []byte) ([]byte, error) {
+	completion := assembledCompletion{Object: "chat.completion"}
+	choices := make(map[int]*assembledChoice)
+	for _, data := range sseData(body) {
+		var chunk completionChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return nil, fmt.Errorf("invalid stream event: %w", err)
+		}
+		if completion.ID == "" {
+			completion.ID = chunk.ID
+			completion.Created = chunk.Created
+			completion.Model = chunk.Model
+			completion.SystemFingerprint = chunk.SystemFingerprint
+		}
+		if chunk.Usage != nil {
+			completion.Usage = chunk.Usage
+		}
+		for _, delta := range chunk.Choices {
+			choice, ok := choices[delta.Index]
+			if !ok {
+				choice = &assembledChoice{Index: delta.Index}
+				choices[delta.Index] = choice
+			}
+			if delta.Delta.Role != "" {
+				choice.Message.Role = delta.Delta.Role
+			}
+			choice.Message.Content += delta.Delta.Content
+			for _, call := range delta.Delta.ToolCalls {
+				choice.Message.ToolCalls = appendToolCallDelta(choice.Message.ToolCalls, call)
+			}
+			if delta.FinishReason != nil {
+				choice.FinishReason = delta.FinishReason
+			}
+		}
+	}
+	if completion.ID == "" && len(choices) == 0 {
+		return nil, errors.New("stream has no completion chunks")
+	}
+
+	for _, choice := range choices {
+		if choice.Message.Role == "" {
+			choice.Message.Role = "assistant"
+		}
+		completion.Choices = append(completion.Choices, *choice)
+	}
+	sort.Slice(completion.Choices, func(i, j int) bool { return completion.Choices[i].Index < completion.Choices[j].Index })
+	return json.Marshal(completion)
+}
+
+// appendToolCallDelta merges a streamed tool call delta into the tool calls
+// of a choice; the first delta of a call carries its ID and name, later ones
+// fragments of its arguments
+func appendToolCallDelta(calls []streamedToolCall, delta streamedToolCall) []streamedToolCall {
+	for i := range calls {
+		if calls[i].Index == delta.Index {
+			calls[i].Function.Arguments += delta.Function.Arguments
+			return calls
+		}
+	}
+	if delta.Type == "" {
+		delta.Type = "function"
+	}
+	return append(calls, delta)
+}
+
+// streamCompletion replays a chat.completion as the stream of events the
+// upstream would have sent for a streaming request: a chunk with each
+// choice's message, a chunk with the finish reasons, then the usage if the
+// request asked for it.
+func streamCompletion(body []byte, includeUsage bool) ([]byte, error) {
+	var completion assembledCompletion
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, fmt.Errorf("invalid cached completion: %w", err)
+	}
+
+	type chunkChoice struct {
+		Index        int              `json:"index"`
+		Delta        assembledMessage `json:"delta"`
+		FinishReason *string          `json:"finish_reason"`
+	}
+	type chunk struct {
+		ID                string        `json:"id"`
+		Object            string        `json:"object"`
+		Created           int64         `json:"created"`
+		Model             string        `json:"model"`
+		SystemFingerprint string        `json:"system_fingerprint,omitempty"`
+		Choices           []chunkChoice `json:"choices"`
+		Usage             *OpenAIUsage  `json:"usage,omitempty"`
+	}
+	newChunk := func() chunk {
+		return chunk{
+			ID:                completion.ID,
+			Object:            "chat.completion.chunk",
+			Created:           completion.Created,
+			Model:             completion.Model,
+			SystemFingerprint: completion.SystemFingerprint,
+			Choices:           []chunkChoice{},
+		}
+	}
+
+	content, finish := newChunk(), newChunk()
+	for _, choice := range completion.Choices {
+		delta := choice.Message
+		if delta.Role == "" {
+			delta.Role = "assistant"
+		}
+		for j := range delta.ToolCalls {
+			delta.ToolCalls[j].Index = j
+		}
+		content.Choices = append(content.Choices, chunkChoice{Index: choice.Index, Delta: delta})
+		finishReason := choice.FinishReason
+		if finishReason == nil {
+			stop := "stop"
+			finishReason = &stop
+		}
+		finish.Choices = append(finish.Choices, chunkChoice{Index: choice.Index, FinishReason: finishReason})
+	}
+	chunks := []chunk{content, finish}
+	if includeUsage && completion.Usage != nil {
+		usage := newChunk()
+		usage.Usage = completion.Usage
+		chunks = append(chunks, usage)
+	}
+
+	var stream bytes.Buffer
+	for _, c := range chunks {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		stream.WriteString("data: ")
+		stream.Write(data)
+		stream.WriteString("\n\n")
+	}
+	stream.WriteString("data: " + sseDone + "\n\n")
+	return stream.Bytes(), nil
+}
+
+// scrubEventStream scrubs the JSON payload of every event of a streamed
+// response, leaving the framing and the [DONE] event untouched
+func scrubEventStream(cfg config.ResponseScrubbingConfig, body []byte, clientModel string) ([]byte, error) {
+	lines := strings.SplitAfter(string(body), "\n")
+	var scrubbed strings.Builder
+	for _, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+		data, ok := strings.CutPrefix(content, "data:")
+		data = strings.TrimPrefix(data, " ")
+		if !ok || data == sseDone || data == "" {
+			scrubbed.WriteString(line)
+			continue
+		}
+		event, err := scrubResponseBody(cfg, []byte(data), clientModel)
+		if err != nil {
+			return nil, err
+		}
+		scrubbed.WriteString("data: ")
+		scrubbed.Write(event)
+		scrubbed.WriteString(line[len(content):])
+	}
+	return []byte(scrubbed.String()), nil
+}
@@ -0,0 +1,217 @@
+package extproc
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+const streamedResponse = "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"math-model\",\"system_fingerprint\":\"fp_1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"\"},\"finish_reason\":null}]}\n\n" +
+	"data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"math-model\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"It is \"},\"finish_reason\":null}]}\n\n" +
+	": keep-alive\n\n" +
+	"data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"math-model\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"2x.\"},\"finish_reason\":\"stop\"}]}\n\n" +
+	"data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"math-model\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":3,\"total_tokens\":13}}\n\n" +
+	"data: [DONE]\n\n"
+
+func TestAssembleStreamedCompletion(t *testing.T) {
+	assembled, err := assembleStreamedCompletion([]byte(streamedResponse))
+	if err != nil {
+		t.Fatalf("assembleStreamedCompletion: %v", err)
+	}
+	for path, want := range map[string]string{
+		"object":                       "chat.completion",
+		"model":                        "math-model",
+		"system_fingerprint":           "fp_1",
+		"choices.0.message.role":       "assistant",
+		"choices.0.message.content":    "It is 2x.",
+		"choices.0.finish_reason":      "stop",
+		"usage.completion_tokens":      "3",
+		"usage.prompt_tokens":          "10",
+		"choices.0.message.tool_calls": "",
+	} {
+		if got := gjson.GetBytes(assembled, path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	prompt, completion, _, err := parseTokensFromResponse(assembled)
+	if err != nil || prompt != 10 || completion != 3 {
+		t.Errorf("parseTokensFromResponse = %d, %d, %v, want 10, 3", prompt, completion, err)
+	}
+
+	if _, err := assembleStreamedCompletion([]byte("data: [DONE]\n\n")); err == nil {
+		t.Error("expected an error for a stream without chunks")
+	}
+	if _, err := assembleStreamedCompletion([]byte("data: {\"id\":\n\n")); err == nil {
+		t.Error("expected an error for a malformed event")
+	}
+}
+
+func TestAssembleStreamedToolCalls(t *testing.T) {
+	stream := "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"plot\",\"arguments\":\"\"}}]}}]}\n\n" +
+		"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"f\\\":\"}}]}}]}\n\n" +
+		"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"x^2\\\"}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+		"data: [DONE]\n\n"
+	assembled, err := assembleStreamedCompletion([]byte(stream))
+	if err != nil {
+		t.Fatalf("assembleStreamedCompletion: %v", err)
+	}
+	call := gjson.GetBytes(assembled, "choices.0.message.tool_calls.0")
+	if call.Get("id").String() != "call_1" || call.Get("function.name").String() != "plot" || call.Get("function.arguments").String() != `{"f":"x^2"}` {
+		t.Errorf("unexpected tool call %s", call.Raw)
+	}
+	if got := responseToolCallIDs(assembled); !reflect.DeepEqual(got, []string{"call_1"}) {
+		t.Errorf("responseToolCallIDs = %v, want [call_1]", got)
+	}
+}
+
+func TestStreamCompletionRoundTrip(t *testing.T) {
+	assembled, err := assembleStreamedCompletion([]byte(streamedResponse))
+	if err != nil {
+		t.Fatalf("assembleStreamedCompletion: %v", err)
+	}
+	for _, includeUsage := range []bool{true, false} {
+		stream, err := streamCompletion(assembled, includeUsage)
+		if err != nil {
+			t.Fatalf("streamCompletion: %v", err)
+		}
+		if !strings.HasSuffix(string(stream), "data: [DONE]\n\n") {
+			t.Errorf("stream does not end with [DONE]: %s", stream)
+		}
+		replayed, err := assembleStreamedCompletion(stream)
+		if err != nil {
+			t.Fatalf("assembleStreamedCompletion of the replay: %v", err)
+		}
+		want := assembled
+		if !includeUsage {
+			var completion map[string]interface{}
+			_ = json.Unmarshal(assembled, &completion)
+			delete(completion, "usage")
+			want, _ = json.Marshal(completion)
+		}
+		var got, expected interface{}
+		_ = json.Unmarshal(replayed, &got)
+		_ = json.Unmarshal(want, &expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("replay with include_usage=%v assembles to %s, want %s", includeUsage, replayed, want)
+		}
+	}
+
+	// Cached completions from non-streaming requests replay too
+	stream, err := streamCompletion([]byte(`{"id":"c2","object":"chat.completion","model":"law-model","choices":[{"index":0,"message":{"role":"assistant","content":"Yes."}}]}`), false)
+	if err != nil {
+		t.Fatalf("streamCompletion: %v", err)
+	}
+	if !strings.Contains(string(stream), `"delta":{"role":"assistant","content":"Yes."}`) || !strings.Contains(string(stream), `"finish_reason":"stop"`) {
+		t.Errorf("unexpected stream %s", stream)
+	}
+}
+
+func TestScrubEventStream(t *testing.T) {
+	cfg := config.ResponseScrubbingConfig{RemoveFields: []string{"system_fingerprint"}, RewriteModel: true}
+	scrubbed, err := scrubEventStream(cfg, []byte(streamedResponse), "auto")
+	if err != nil {
+		t.Fatalf("scrubEventStream: %v", err)
+	}
+	if strings.Contains(string(scrubbed), "fp_1") || strings.Contains(string(scrubbed), "math-model") {
+		t.Errorf("stream not scrubbed: %s", scrubbed)
+	}
+	if !strings.Contains(string(scrubbed), ": keep-alive\n\n") || !strings.HasSuffix(string(scrubbed), "data: [DONE]\n\n") {
+		t.Errorf("stream framing not preserved: %s", scrubbed)
+	}
+	if len(sseData(scrubbed)) != len(sseData([]byte(streamedResponse))) {
+		t.Errorf("scrubbing changed the number of events")
+	}
+}
+
+// streamResponseHeaders are the headers of a successful streamed response
+func streamResponseHeaders() *ext_proc.ProcessingRequest {
+	return &ext_proc.ProcessingRequest{
+		Request: &ext_proc.ProcessingRequest_ResponseHeaders{
+			ResponseHeaders: &ext_proc.HttpHeaders{Headers: &core.HeaderMap{Headers: []*core.HeaderValue{
+				{Key: ":status", RawValue: []byte("200")},
+				{Key: "content-type", RawValue: []byte("text/event-stream; charset=utf-8")},
+			}}},
+		},
+	}
+}
+
+func TestProcessStreamingResponse(t *testing.T) {
+	const streamingRequest = `{"model":"auto","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`
+
+	for _, replay := range []bool{true, false} {
+		router := newTestRouter(t, true)
+		router.Config.Streaming.ReplayCachedAsSSE = replay
+		sink := &recordingSink{}
+		router.Decisions = sink
+
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-1"),
+			requestBody(streamingRequest),
+			streamResponseHeaders(),
+			responseBody(streamedResponse[:200], false),
+			responseBody(streamedResponse[200:], true),
+		}}
+		if err := router.Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		// The rewritten request keeps asking for a stream
+		body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+		if !gjson.GetBytes(body, "stream").Bool() || !gjson.GetBytes(body, "stream_options.include_usage").Bool() {
+			t.Errorf("rewritten request lost its stream options: %s", body)
+		}
+		if len(sink.records) != 1 || sink.records[0].GetUsage().GetPromptTokens() != 10 || sink.records[0].GetUsage().GetCompletionTokens() != 3 {
+			t.Fatalf("unexpected records %v", sink.records)
+		}
+
+		// A streaming repeat is replayed from the cache as a stream, or goes upstream
+		stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-2"),
+			requestBody(streamingRequest),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		immediate := stream.responses[1].GetImmediateResponse()
+		if !replay {
+			if immediate != nil {
+				t.Errorf("expected the streaming request to bypass the cache")
+			}
+			continue
+		}
+		if immediate == nil {
+			t.Fatalf("expected a cache hit, got %v", stream.responses[1])
+		}
+		headers := make(map[string]string)
+		for _, h := range immediate.GetHeaders().GetSetHeaders() {
+			headers[h.GetHeader().GetKey()] = h.GetHeader().GetValue()
+		}
+		if headers["content-type"] != eventStreamContentType {
+			t.Errorf("content-type = %q, want %q", headers["content-type"], eventStreamContentType)
+		}
+		replayed, err := assembleStreamedCompletion(immediate.GetBody())
+		if err != nil || gjson.GetBytes(replayed, "choices.0.message.content").String() != "It is 2x." {
+			t.Errorf("unexpected replayed stream %s: %v", immediate.GetBody(), err)
+		}
+
+		// A non-streaming repeat gets the cached completion as JSON
+		stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", "req-3"),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		if got := gjson.GetBytes(stream.responses[1].GetImmediateResponse().GetBody(), "choices.0.message.content").String(); got != "It is 2x." {
+			t.Errorf("cached completion content = %q", got)
+		}
+	}
+}
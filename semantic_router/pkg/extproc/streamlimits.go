@@ -0,0 +1,98 @@
+package extproc
+
+import (
+	"sync/atomic"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Limits a stream can exceed
+const (
+	streamLimitStream = "stream"
+	streamLimitServer = "server"
+)
+
+// Defaults of the stream byte limits
+const (
+	defaultMaxStreamBytes = 32 * 1024 * 1024
+	defaultMaxTotalBytes  = 512 * 1024 * 1024
+)
+
+// streamBudget accounts the bytes each ext_proc stream buffers, its request
+// headers, request body and response body, against a per-stream limit and a
+// budget shared by every stream. A stream that would exceed either stops
+// buffering and passes the rest of its request and response through
+// unprocessed, so a few giant requests can't exhaust the router's memory. A
+// nil budget never limits a stream.
+type streamBudget struct {
+	maxStreamBytes int64
+	maxTotalBytes  int64
+	total          atomic.Int64
+}
+
+// newStreamBudget creates the stream budget from its config, nil when disabled
+func newStreamBudget(cfg config.StreamLimitsConfig) *streamBudget {
+	if !cfg.Enabled {
+		return nil
+	}
+	b := &streamBudget{
+		maxStreamBytes: int64(cfg.MaxStreamBytes),
+		maxTotalBytes:  int64(cfg.MaxTotalBytes),
+	}
+	if b.maxStreamBytes <= 0 {
+		b.maxStreamBytes = defaultMaxStreamBytes
+	}
+	if b.maxTotalBytes <= 0 {
+		b.maxTotalBytes = defaultMaxTotalBytes
+	}
+	return b
+}
+
+// reserve accounts n more bytes buffered by the stream of the request. When
+// they would exceed the stream's limit or the server's budget, nothing is
+// accounted, the stream switches to passthrough and reserve returns false.
+func (b *streamBudget) reserve(reqCtx *RequestContext, n int, phase string) bool {
+	if b == nil {
+		return true
+	}
+	if reqCtx.passthrough {
+		return false
+	}
+	limit := ""
+	if reqCtx.bufferedBytes+int64(n) > b.maxStreamBytes {
+		limit = streamLimitStream
+	} else if total := b.total.Add(int64(n)); total > b.maxTotalBytes {
+		b.total.Add(-int64(n))
+		limit = streamLimitServer
+	} else {
+		reqCtx.bufferedBytes += int64(n)
+		metrics.SetStreamBufferedBytes(total)
+		return true
+	}
+	reqCtx.passthrough = true
+	metrics.RecordStreamLimitExceeded(phase, limit)
+	reqCtx.log.Warn("Request would buffer over the byte limit, passing the rest of it through", "limit", limit, "phase", phase)
+	return false
+}
+
+// release returns the bytes buffered by the stream of the request to the
+// server's budget
+func (b *streamBudget) release(reqCtx *RequestContext) {
+	if b == nil || reqCtx.bufferedBytes == 0 {
+		return
+	}
+	metrics.SetStreamBufferedBytes(b.total.Add(-reqCtx.bufferedBytes))
+	reqCtx.bufferedBytes = 0
+}
+
+// headerBytes returns the size of the names and values of headers
+func headerBytes(headers []*core.HeaderValue) int {
+	size := 0
+	for _, h := range headers {
+		size += len(h.Key) + len(h.Value) + len(h.RawValue)
+	}
+	return size
+}
@@ -0,0 +1,103 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestStreamBudgetReserve(t *testing.T) {
+	budget := newStreamBudget(config.StreamLimitsConfig{Enabled: true, MaxStreamBytes: 100, MaxTotalBytes: 150})
+	first, second := newRequestContext(), newRequestContext()
+
+	if !budget.reserve(first, 60, "request_body") || !budget.reserve(first, 40, "response_body") {
+		t.Fatal("reservations within the limits refused")
+	}
+	if budget.reserve(first, 1, "response_body") || !first.passthrough {
+		t.Error("reservation over the stream limit accepted")
+	}
+	if budget.reserve(second, 60, "request_body") || !second.passthrough {
+		t.Error("reservation over the server budget accepted")
+	}
+	if got := budget.total.Load(); got != 100 {
+		t.Errorf("total = %d, want 100", got)
+	}
+
+	// Bytes released by a stream are available to the others
+	budget.release(first)
+	third := newRequestContext()
+	if !budget.reserve(third, 100, "request_body") {
+		t.Error("reservation refused after release")
+	}
+	budget.release(third)
+	if got := budget.total.Load(); got != 0 {
+		t.Errorf("total = %d after releasing every stream, want 0", got)
+	}
+
+	var disabled *streamBudget
+	if !disabled.reserve(newRequestContext(), 1<<40, "request_body") {
+		t.Error("a nil budget limited a stream")
+	}
+}
+
+func TestProcessStreamLimits(t *testing.T) {
+	const query = "What is the derivative of x^2?"
+	body := `{"model":"auto","messages":[{"role":"user","content":"` + query + `"}]}`
+	tests := []struct {
+		name           string
+		maxStreamBytes int
+		wantRouted     bool
+		wantCache      bool
+		wantExceeded   string
+	}{
+		{name: "within the limit", maxStreamBytes: 4096, wantRouted: true, wantCache: true},
+		{name: "request over the limit", maxStreamBytes: len(body), wantExceeded: "request_body"},
+		{name: "response over the limit", maxStreamBytes: len(body) + 64, wantRouted: true, wantExceeded: "response_body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			router.streamBudget = newStreamBudget(config.StreamLimitsConfig{Enabled: true, MaxStreamBytes: tt.maxStreamBytes})
+			var exceeded float64
+			if tt.wantExceeded != "" {
+				exceeded = testutil.ToFloat64(metrics.StreamLimitExceeded.WithLabelValues(tt.wantExceeded, streamLimitStream))
+			}
+
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(body),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			routed := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation() != nil
+			if routed != tt.wantRouted {
+				t.Errorf("request routed = %v, want %v", routed, tt.wantRouted)
+			}
+			_, found, err := router.Cache.FindSimilar("auto", query)
+			if err != nil || found != tt.wantCache {
+				t.Errorf("FindSimilar found = %v (err=%v), want %v", found, err, tt.wantCache)
+			}
+			if router.Cache.PendingCount() != 0 {
+				t.Errorf("%d cache entries left pending", router.Cache.PendingCount())
+			}
+			if tt.wantExceeded != "" {
+				counter := metrics.StreamLimitExceeded.WithLabelValues(tt.wantExceeded, streamLimitStream)
+				if got := testutil.ToFloat64(counter) - exceeded; got != 1 {
+					t.Errorf("limit exceeded in %s counted %v times, want 1", tt.wantExceeded, got)
+				}
+			}
+			if got := router.streamBudget.total.Load(); got != 0 {
+				t.Errorf("%d bytes still accounted after the stream ended", got)
+			}
+		})
+	}
+}
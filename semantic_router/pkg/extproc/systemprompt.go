@@ -0,0 +1,78 @@
+package extproc
+
+import (
+	"fmt"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// Ways a category's system prompt is injected into requests
+const (
+	// Prepend the prompt, keeping the client's system messages after it
+	SystemPromptInsert = "insert"
+	// Replace the client's system messages with the prompt
+	SystemPromptReplace = "replace"
+	// Leave the request as sent, only valid in the request header
+	SystemPromptOff = "off"
+)
+
+// systemPromptHeader lets clients choose per request how the system prompt of
+// the selected category is injected: off, insert or replace. Other values are
+// ignored.
+const systemPromptHeader = "x-semantic-router-system-prompt"
+
+// validateSystemPrompts checks the system prompt settings of the categories
+func validateSystemPrompts(categories []config.Category) error {
+	for _, category := range categories {
+		switch category.SystemPromptMode {
+		case "", SystemPromptInsert, SystemPromptReplace:
+		default:
+			return fmt.Errorf("invalid system_prompt_mode for category %s: %q, expected insert or replace", category.Name, category.SystemPromptMode)
+		}
+	}
+	return nil
+}
+
+// systemPromptMode returns how a category's system prompt is injected given
+// its configured mode and the request's header, "" when it is not
+func systemPromptMode(configured, header string) string {
+	switch header {
+	case SystemPromptOff:
+		return ""
+	case SystemPromptInsert, SystemPromptReplace:
+		return header
+	}
+	if configured == "" {
+		return SystemPromptInsert
+	}
+	return configured
+}
+
+// injectSystemPrompt adds a system prompt to the messages of a chat request,
+// either before the client's messages or in place of its system messages.
+// Requests without messages are returned as they are.
+func injectSystemPrompt(body []byte, prompt, mode string) ([]byte, bool, error) {
+	request, err := decodeRequestObject(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse request body: %w", err)
+	}
+	messages, ok := request["messages"].([]interface{})
+	if !ok {
+		return body, false, nil
+	}
+
+	injected := make([]interface{}, 0, len(messages)+1)
+	injected = append(injected, map[string]interface{}{"role": "system", "content": prompt})
+	for _, message := range messages {
+		if mode == SystemPromptReplace {
+			// Newer OpenAI models take system instructions in the developer role
+			if m, ok := message.(map[string]interface{}); ok && (m["role"] == "system" || m["role"] == "developer") {
+				continue
+			}
+		}
+		injected = append(injected, message)
+	}
+	request["messages"] = injected
+	body, err = encodeRequestBody(request)
+	return body, err == nil, err
+}
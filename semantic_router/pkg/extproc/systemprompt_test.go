@@ -0,0 +1,117 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestValidateSystemPrompts(t *testing.T) {
+	valid := []config.Category{{Name: "math", SystemPrompt: "Show your work."}, {Name: "law", SystemPromptMode: SystemPromptReplace}}
+	if err := validateSystemPrompts(valid); err != nil {
+		t.Errorf("validateSystemPrompts: %v", err)
+	}
+	// off is only meaningful per request
+	for _, mode := range []string{SystemPromptOff, "prepend"} {
+		if err := validateSystemPrompts([]config.Category{{Name: "math", SystemPromptMode: mode}}); err == nil {
+			t.Errorf("validateSystemPrompts accepted mode %q", mode)
+		}
+	}
+}
+
+func TestSystemPromptMode(t *testing.T) {
+	for _, tc := range []struct {
+		configured, header, want string
+	}{
+		{"", "", SystemPromptInsert},
+		{SystemPromptReplace, "", SystemPromptReplace},
+		{SystemPromptReplace, SystemPromptInsert, SystemPromptInsert},
+		{"", SystemPromptReplace, SystemPromptReplace},
+		{SystemPromptInsert, SystemPromptOff, ""},
+		{SystemPromptReplace, "bogus", SystemPromptReplace},
+	} {
+		if got := systemPromptMode(tc.configured, tc.header); got != tc.want {
+			t.Errorf("systemPromptMode(%q, %q) = %q, want %q", tc.configured, tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestInjectSystemPrompt(t *testing.T) {
+	body := []byte(`{"model":"m","seed":12345678901234567890,"messages":[{"role":"system","content":"Be brief."},{"role":"developer","content":"Use <b>."},{"role":"user","content":"hi"}]}`)
+	for _, tc := range []struct {
+		mode string
+		want []string
+	}{
+		{SystemPromptInsert, []string{"system:Show your work.", "system:Be brief.", "developer:Use <b>.", "user:hi"}},
+		{SystemPromptReplace, []string{"system:Show your work.", "user:hi"}},
+	} {
+		injected, ok, err := injectSystemPrompt(body, "Show your work.", tc.mode)
+		if err != nil || !ok {
+			t.Fatalf("%s: injectSystemPrompt = %v, %v", tc.mode, ok, err)
+		}
+		if got := messageSummary(t, injected); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: messages = %v, want %v", tc.mode, got, tc.want)
+		}
+		var request map[string]json.RawMessage
+		if err := json.Unmarshal(injected, &request); err != nil || string(request["seed"]) != "12345678901234567890" {
+			t.Errorf("%s: seed = %s, want it kept as sent", tc.mode, request["seed"])
+		}
+	}
+
+	prompt := []byte(`{"model":"m","prompt":"hi"}`)
+	if injected, ok, err := injectSystemPrompt(prompt, "Show your work.", SystemPromptInsert); err != nil || ok || string(injected) != string(prompt) {
+		t.Errorf("request without messages = %s, %v, %v, want it unchanged", injected, ok, err)
+	}
+}
+
+// messageSummary returns the role:content of each message of a request body
+func messageSummary(t *testing.T, body []byte) []string {
+	t.Helper()
+	var request struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("invalid request body %s: %v", body, err)
+	}
+	summary := make([]string, len(request.Messages))
+	for i, message := range request.Messages {
+		summary[i] = message.Role + ":" + message.Content
+	}
+	return summary
+}
+
+func TestProcessInjectsCategorySystemPrompt(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Categories[0].SystemPrompt = "Show your work."
+
+	route := func(i int, headers ...string) []string {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders(append([]string{"x-request-id", fmt.Sprintf("req-%d", i)}, headers...)...),
+			requestBody(`{"model":"auto","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return messageSummary(t, stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody())
+	}
+
+	query := "user:What is the derivative of x^2?"
+	if got, want := route(0), []string{"system:Show your work.", "system:Be brief.", query}; !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %v, want %v", got, want)
+	}
+	if got, want := route(1, systemPromptHeader, "replace"), []string{"system:Show your work.", query}; !reflect.DeepEqual(got, want) {
+		t.Errorf("messages with replace header = %v, want %v", got, want)
+	}
+	if got, want := route(2, systemPromptHeader, "off"), []string{"system:Be brief.", query}; !reflect.DeepEqual(got, want) {
+		t.Errorf("messages with off header = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package extproc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// Reasoning effort levels supported in category config
+const (
+	ReasoningEffortNone   = "none"
+	ReasoningEffortLow    = "low"
+	ReasoningEffortMedium = "medium"
+	ReasoningEffortHigh   = "high"
+)
+
+// validateReasoningEfforts checks the reasoning efforts of the categories and models
+func validateReasoningEfforts(cfg *config.RouterConfig) error {
+	valid := func(effort string) bool {
+		switch effort {
+		case "", ReasoningEffortNone, ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+			return true
+		}
+		return false
+	}
+	for _, category := range cfg.Categories {
+		if !valid(category.ReasoningEffort) {
+			return fmt.Errorf("invalid reasoning_effort for category %s: %q, expected none, low, medium or high", category.Name, category.ReasoningEffort)
+		}
+	}
+	for model, params := range cfg.ModelConfig {
+		if !valid(params.Reasoning.Effort) {
+			return fmt.Errorf("invalid reasoning.effort for model %s: %q, expected none, low, medium or high", model, params.Reasoning.Effort)
+		}
+	}
+	return nil
+}
+
+// Features with family-specific request fields
+const (
+	FeatureReasoningOn  = "reasoning_on"
+	FeatureReasoningOff = "reasoning_off"
+	FeatureJSONMode     = "json_mode"
+)
+
+// defaultFamilyTemplates holds the built-in field edits for each model family.
+// OpenAI-style models take reasoning_effort directly, while DeepSeek- and
+// Qwen3-style models toggle thinking through chat_template_kwargs.
+var defaultFamilyTemplates = map[string]map[string]config.MutationTemplate{
+	"openai": {
+		FeatureReasoningOn:  {Set: map[string]interface{}{"reasoning_effort": "{{effort}}"}},
+		FeatureReasoningOff: {Remove: []string{"reasoning_effort"}},
+	},
+	"deepseek": {
+		FeatureReasoningOn:  {Set: map[string]interface{}{"chat_template_kwargs.thinking": true}},
+		FeatureReasoningOff: {Set: map[string]interface{}{"chat_template_kwargs.thinking": false}},
+	},
+	"qwen3": {
+		FeatureReasoningOn:  {Set: map[string]interface{}{"chat_template_kwargs.enable_thinking": true}},
+		FeatureReasoningOff: {Set: map[string]interface{}{"chat_template_kwargs.enable_thinking": false}},
+	},
+}
+
+// FamilyTemplates resolves body mutation templates by model family and feature
+type FamilyTemplates struct {
+	templates map[string]map[string]config.MutationTemplate
+}
+
+// NewFamilyTemplates creates the template set from the built-in defaults,
+// with templates from config replacing defaults for the same family and feature
+func NewFamilyTemplates(overrides map[string]map[string]config.MutationTemplate) *FamilyTemplates {
+	templates := make(map[string]map[string]config.MutationTemplate)
+	for _, source := range []map[string]map[string]config.MutationTemplate{defaultFamilyTemplates, overrides} {
+		for family, features := range source {
+			if templates[family] == nil {
+				templates[family] = make(map[string]config.MutationTemplate)
+			}
+			for feature, tmpl := range features {
+				templates[family][feature] = tmpl
+			}
+		}
+	}
+	return &FamilyTemplates{templates: templates}
+}
+
+// HasFamily returns whether any templates exist for the model family
+func (t *FamilyTemplates) HasFamily(family string) bool {
+	_, ok := t.templates[family]
+	return ok
+}
+
+// Apply applies the family's template for a feature to the request body in
+// place, substituting {{name}} placeholders in string values from vars. The
+// body is returned unchanged if the family has no template for the feature.
+func (t *FamilyTemplates) Apply(body []byte, family, feature string, vars map[string]string) ([]byte, error) {
+	tmpl, ok := t.templates[family][feature]
+	if !ok {
+		return body, nil
+	}
+
+	for _, path := range tmpl.Remove {
+		body = removeBodyField(body, strings.Split(path, "."))
+	}
+	paths := make([]string, 0, len(tmpl.Set))
+	for path := range tmpl.Set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		var err error
+		if body, err = setBodyField(body, strings.Split(path, "."), substituteVars(tmpl.Set[path], vars)); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// applyFamilyTemplates applies the model family's templates to the request body:
+// the reasoning fields for the given effort (if any) and the JSON mode fields when
+// the request asks for JSON output. The body is returned unchanged if no template
+// applies, including for families without templates.
+func applyFamilyTemplates(templates *FamilyTemplates, body []byte, family, effort string) ([]byte, error) {
+	if !gjson.ValidBytes(body) || !gjson.ParseBytes(body).IsObject() {
+		return nil, fmt.Errorf("request body is not a JSON object")
+	}
+
+	var err error
+	if effort != "" {
+		feature := FeatureReasoningOn
+		if effort == ReasoningEffortNone {
+			feature = FeatureReasoningOff
+		}
+		if body, err = templates.Apply(body, family, feature, map[string]string{"effort": effort}); err != nil {
+			return nil, err
+		}
+	}
+
+	// JSON mode has no common field across families, translate it if the family needs to
+	if isJSONModeRequest(body) {
+		if body, err = templates.Apply(body, family, FeatureJSONMode, nil); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// validateModelFamilies checks that the family of every configured model has
+// templates, built in or from model_family_templates
+func validateModelFamilies(cfg *config.RouterConfig) error {
+	templates := NewFamilyTemplates(cfg.ModelFamilyTemplates)
+	for model, params := range cfg.ModelConfig {
+		if params.Family != "" && !templates.HasFamily(params.Family) {
+			return fmt.Errorf("invalid family for model %s: %q has no templates", model, params.Family)
+		}
+	}
+	return nil
+}
+
+// isJSONModeRequest returns whether the request asks for JSON output via response_format
+func isJSONModeRequest(body []byte) bool {
+	formatType := gjson.GetBytes(body, "response_format.type").String()
+	return formatType == "json_object" || formatType == "json_schema"
+}
+
+// removePath deletes the value at a dotted path if it exists
+func removePath(obj map[string]interface{}, path []string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := obj[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		obj = next
+	}
+	delete(obj, path[len(path)-1])
+}
+
+// substituteVars replaces {{name}} placeholders in string values, recursing into objects and arrays
+func substituteVars(value interface{}, vars map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		for name, replacement := range vars {
+			v = strings.ReplaceAll(v, "{{"+name+"}}", replacement)
+		}
+		return v
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = substituteVars(item, vars)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = substituteVars(item, vars)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,190 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestApplyFamilyTemplatesReasoning(t *testing.T) {
+	templates := NewFamilyTemplates(nil)
+	body := []byte(`{"model":"m","messages":[],"chat_template_kwargs":{"foo":"bar"}}`)
+
+	tests := []struct {
+		family string
+		effort string
+		want   map[string]interface{}
+	}{
+		{"openai", "high", map[string]interface{}{"reasoning_effort": "high"}},
+		{"openai", "low", map[string]interface{}{"reasoning_effort": "low"}},
+		{"openai", "none", map[string]interface{}{}},
+		{"deepseek", "high", map[string]interface{}{"chat_template_kwargs": map[string]interface{}{"foo": "bar", "thinking": true}}},
+		{"deepseek", "none", map[string]interface{}{"chat_template_kwargs": map[string]interface{}{"foo": "bar", "thinking": false}}},
+		{"qwen3", "medium", map[string]interface{}{"chat_template_kwargs": map[string]interface{}{"foo": "bar", "enable_thinking": true}}},
+		{"qwen3", "none", map[string]interface{}{"chat_template_kwargs": map[string]interface{}{"foo": "bar", "enable_thinking": false}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.family+"/"+tt.effort, func(t *testing.T) {
+			out, err := applyFamilyTemplates(templates, body, tt.family, tt.effort)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			for key, want := range tt.want {
+				if !reflect.DeepEqual(got[key], want) {
+					t.Errorf("%s = %v, want %v", key, got[key], want)
+				}
+			}
+			if tt.family == "openai" && tt.effort == "none" {
+				if _, ok := got["reasoning_effort"]; ok {
+					t.Error("expected reasoning_effort to be removed")
+				}
+			}
+		})
+	}
+
+	// Families without templates pass the body through
+	if out, err := applyFamilyTemplates(templates, body, "llama", "high"); err != nil || string(out) != string(body) {
+		t.Errorf("unknown family returned %s, %v; want the body unchanged", out, err)
+	}
+}
+
+func TestApplyFamilyTemplatesFromConfig(t *testing.T) {
+	templates := NewFamilyTemplates(map[string]map[string]config.MutationTemplate{
+		"ollama": {
+			FeatureJSONMode: {
+				Set:    map[string]interface{}{"format": "json"},
+				Remove: []string{"response_format"},
+			},
+		},
+		"openai": {
+			FeatureReasoningOn: {Set: map[string]interface{}{"reasoning": map[string]interface{}{"effort": "{{effort}}"}}},
+		},
+	})
+
+	out, err := applyFamilyTemplates(templates, []byte(`{"model":"m","response_format":{"type":"json_object"}}`), "ollama", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(out) != `{"model":"m","format":"json"}` {
+		t.Errorf("unexpected JSON mode body: %s", out)
+	}
+
+	out, err = applyFamilyTemplates(templates, []byte(`{"model":"m"}`), "openai", "low")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(out) != `{"model":"m","reasoning":{"effort":"low"}}` {
+		t.Errorf("unexpected reasoning body: %s", out)
+	}
+
+	// Bodies are untouched when no template applies
+	body := []byte(`{"model": "m"}`)
+	out, _ = applyFamilyTemplates(templates, body, "openai", "")
+	if string(out) != string(body) {
+		t.Errorf("expected unchanged body, got %s", out)
+	}
+}
+
+func TestValidateReasoningEfforts(t *testing.T) {
+	valid := &config.RouterConfig{
+		Categories:  []config.Category{{Name: "math", ReasoningEffort: "high"}},
+		ModelConfig: map[string]config.ModelParams{"r1": {Reasoning: config.ModelReasoningConfig{Effort: "none"}}},
+	}
+	if err := validateReasoningEfforts(valid); err != nil {
+		t.Errorf("validateReasoningEfforts: %v", err)
+	}
+	for _, cfg := range []*config.RouterConfig{
+		{Categories: []config.Category{{Name: "math", ReasoningEffort: "max"}}},
+		{ModelConfig: map[string]config.ModelParams{"r1": {Reasoning: config.ModelReasoningConfig{Effort: "on"}}}},
+	} {
+		if err := validateReasoningEfforts(cfg); err == nil {
+			t.Errorf("validateReasoningEfforts accepted %+v", cfg)
+		}
+	}
+}
+
+func TestValidateModelFamilies(t *testing.T) {
+	if !reflect.DeepEqual(slices.Sorted(maps.Keys(defaultFamilyTemplates)), slices.Sorted(slices.Values(config.BuiltinModelFamilies))) {
+		t.Errorf("built-in templates for %v, config knows %v", slices.Sorted(maps.Keys(defaultFamilyTemplates)), config.BuiltinModelFamilies)
+	}
+
+	cfg := &config.RouterConfig{ModelConfig: map[string]config.ModelParams{"llama-3": {Family: "llama"}}}
+	if err := validateModelFamilies(cfg); err == nil {
+		t.Error("validateModelFamilies accepted a family without templates")
+	}
+	cfg.ModelFamilyTemplates = map[string]map[string]config.MutationTemplate{
+		"llama": {FeatureReasoningOn: {Set: map[string]interface{}{"think": true}}},
+	}
+	if err := validateModelFamilies(cfg); err != nil {
+		t.Errorf("validateModelFamilies: %v", err)
+	}
+}
+
+func TestProcessInjectsModelReasoning(t *testing.T) {
+	router := newTestRouter(t, false)
+	// math sets no effort, so the model's applies; law's is not sent to a model that can't reason
+	router.Config.ModelConfig = map[string]config.ModelParams{
+		"math-model": {Family: "qwen3", Reasoning: config.ModelReasoningConfig{Effort: "low"}},
+		"law-model":  {Reasoning: config.ModelReasoningConfig{Disabled: true}},
+	}
+	router.Config.Categories[1].ReasoningEffort = "high"
+
+	route := func(i int, query string) map[string]interface{} {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", fmt.Sprintf("req-%d", i)),
+			requestBody(fmt.Sprintf(`{"model":"auto","messages":[{"role":"user","content":%q}]}`, query)),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		var request map[string]interface{}
+		if err := json.Unmarshal(stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody(), &request); err != nil {
+			t.Fatalf("invalid routed body: %v", err)
+		}
+		return request
+	}
+
+	math := route(0, "What is the derivative of x^2?")
+	if want := map[string]interface{}{"enable_thinking": true}; !reflect.DeepEqual(math["chat_template_kwargs"], want) {
+		t.Errorf("math chat_template_kwargs = %v, want %v", math["chat_template_kwargs"], want)
+	}
+	law := route(1, "Is a verbal contract binding?")
+	if _, ok := law["reasoning_effort"]; ok {
+		t.Errorf("reasoning_effort sent to a model that cannot reason: %v", law)
+	}
+	if law["model"] != "law-model" {
+		t.Errorf("law request routed to %v, want law-model", law["model"])
+	}
+}
+
+func TestProcessForwardsUnknownFamilies(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.ModelConfig = map[string]config.ModelParams{
+		"math-model": {Family: "llama", Reasoning: config.ModelReasoningConfig{Effort: "high"}},
+	}
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","seed":12345678901234567890,"messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if want := `{"model":"math-model","seed":12345678901234567890,"messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`; string(body) != want {
+		t.Errorf("forwarded %s, want only the model changed: %s", body, want)
+	}
+}
@@ -0,0 +1,41 @@
+package extproc
+
+import (
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// defaultTenantHeader identifies the tenant of requests for metrics when
+// neither tenant_metrics nor residency name a header, and for tenant policies
+// when tenants names none
+const defaultTenantHeader = "x-tenant-id"
+
+// applyTenantMetrics scopes the tenant label of metrics to the configured tenants
+func applyTenantMetrics(cfg config.TenantMetricsConfig) {
+	other := cfg.OtherLabel
+	if other == "" {
+		other = "other"
+	}
+	metrics.SetTenantLabels(cfg.LabeledTenants, cfg.ExcludedTenants, other)
+}
+
+// metricsTenant returns the tenant a request is reported under in per-tenant
+// metrics, "" when per-tenant metrics are disabled or it has no tenant
+func (r *OpenAIRouter) metricsTenant(reqCtx *RequestContext) string {
+	cfg := r.Config.TenantMetrics
+	if !cfg.Enabled {
+		return ""
+	}
+	header := cfg.TenantHeader
+	if header == "" {
+		// The residency and tenant policy tenants are resolved with the
+		// routing policies
+		if (r.Residency != nil || r.tenants != nil) && reqCtx.record != nil {
+			return reqCtx.record.Routing.Tenant
+		}
+		header = defaultTenantHeader
+	}
+	return strings.TrimSpace(reqCtx.Headers[strings.ToLower(header)])
+}
@@ -0,0 +1,46 @@
+package extproc
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestProcessRecordsTenantMetrics(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.TenantMetrics = config.TenantMetricsConfig{Enabled: true, LabeledTenants: []string{"acme-metrics"}, OtherLabel: "rest-metrics"}
+	applyTenantMetrics(router.Config.TenantMetrics)
+	defer applyTenantMetrics(config.TenantMetricsConfig{})
+
+	requests := func(tenant string) float64 {
+		return testutil.ToFloat64(metrics.TenantRequests.WithLabelValues(tenant))
+	}
+	before := map[string]float64{"acme-metrics": requests("acme-metrics"), "rest-metrics": requests("rest-metrics")}
+	for i, tenant := range []string{"acme-metrics", "initech", "umbrella", ""} {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders("x-request-id", fmt.Sprintf("req-%d", i), "X-Tenant-ID", tenant),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+	}
+
+	if got := requests("acme-metrics") - before["acme-metrics"]; got != 1 {
+		t.Errorf("labeled tenant requests = %v, want 1", got)
+	}
+	if got := requests("rest-metrics") - before["rest-metrics"]; got != 2 {
+		t.Errorf("aggregated tenant requests = %v, want 2", got)
+	}
+	if got := requests("initech"); got != 0 {
+		t.Errorf("unlabeled tenant reported on its own: %v requests", got)
+	}
+}
@@ -0,0 +1,169 @@
+package extproc
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tokenbudget"
+)
+
+// Outcomes of requests of tenants with a routing policy
+const (
+	tenantAdmitted       = "admitted"
+	tenantBudgetExceeded = "budget_exceeded"
+)
+
+// tenantPolicy is the routing policy of a tenant
+type tenantPolicy struct {
+	*config.TenantRoutingPolicy
+	// Models by lower-cased category name
+	categoryModels map[string][]string
+}
+
+// tenantRouter resolves the routing policy of the tenant of a request
+type tenantRouter struct {
+	header     string
+	hashedKeys bool
+	// Policies by tenant name, or by API key hash with hashed keys
+	policies map[string]*tenantPolicy
+	// Token budgets of the tenants by name
+	budgets *tokenbudget.Budgets
+}
+
+// newTenantRouter creates the resolver of the configured tenant policies, nil
+// when there are none. Tenant budgets are counted in counter, so usage
+// survives config reloads.
+func newTenantRouter(cfg config.TenantsConfig, categories []config.Category, counter tokenbudget.Counter) (*tenantRouter, error) {
+	if len(cfg.Policies) == 0 {
+		return nil, nil
+	}
+	t := &tenantRouter{
+		header:     strings.ToLower(cmp.Or(cfg.Header, defaultTenantHeader)),
+		hashedKeys: cfg.HashedKeys,
+		policies:   make(map[string]*tenantPolicy),
+	}
+	names := make(map[string]bool, len(cfg.Policies))
+	limits := make(map[string]tokenbudget.Limits)
+	for i := range cfg.Policies {
+		p := &cfg.Policies[i]
+		if p.Name == "" {
+			return nil, fmt.Errorf("tenant %d has no name", i)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("tenant %s is configured twice", p.Name)
+		}
+		names[p.Name] = true
+		if p.HourlyTokens < 0 || p.DailyTokens < 0 {
+			return nil, fmt.Errorf("tenant %s has a negative token budget", p.Name)
+		}
+		if p.HourlyTokens > 0 || p.DailyTokens > 0 {
+			limits[p.Name] = tokenbudget.Limits{Hourly: p.HourlyTokens, Daily: p.DailyTokens}
+		}
+
+		resolved := &tenantPolicy{TenantRoutingPolicy: p, categoryModels: make(map[string][]string, len(p.CategoryModels))}
+		for name, models := range p.CategoryModels {
+			if !slices.ContainsFunc(categories, func(c config.Category) bool { return strings.EqualFold(c.Name, name) }) {
+				return nil, fmt.Errorf("tenant %s sets the models of unknown category %s", p.Name, name)
+			}
+			if len(models) == 0 || slices.Contains(models, "") {
+				return nil, fmt.Errorf("tenant %s has an empty model for category %s", p.Name, name)
+			}
+			resolved.categoryModels[strings.ToLower(name)] = models
+		}
+
+		if !cfg.HashedKeys {
+			if len(p.APIKeySHA256) > 0 {
+				return nil, fmt.Errorf("tenant %s sets api_key_sha256 without hashed_keys", p.Name)
+			}
+			t.policies[p.Name] = resolved
+			continue
+		}
+		if len(p.APIKeySHA256) == 0 {
+			return nil, fmt.Errorf("tenant %s has no api_key_sha256", p.Name)
+		}
+		for _, hash := range p.APIKeySHA256 {
+			hash = strings.ToLower(hash)
+			if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("tenant %s: api_key_sha256 %q is not a hex SHA-256", p.Name, hash)
+			}
+			if other, ok := t.policies[hash]; ok {
+				return nil, fmt.Errorf("tenants %s and %s share an API key", other.Name, p.Name)
+			}
+			t.policies[hash] = resolved
+		}
+	}
+	if len(limits) > 0 {
+		t.budgets = tokenbudget.New(tokenbudget.Options{Identities: limits, Counter: counter})
+	}
+	return t, nil
+}
+
+// resolve returns the policy of the tenant of a request, nil when it has none
+func (t *tenantRouter) resolve(headers map[string]string) *tenantPolicy {
+	if t == nil {
+		return nil
+	}
+	value := strings.TrimSpace(headers[t.header])
+	if value == "" {
+		return nil
+	}
+	if !t.hashedKeys {
+		return t.policies[value]
+	}
+	if len(value) > len("bearer ") && strings.EqualFold(value[:len("bearer ")], "bearer ") {
+		value = strings.TrimSpace(value[len("bearer "):])
+	}
+	sum := sha256.Sum256([]byte(value))
+	return t.policies[hex.EncodeToString(sum[:])]
+}
+
+// checkBudget returns the token budget the tenant used up, nil while it has
+// tokens left
+func (t *tenantRouter) checkBudget(tenant *tenantPolicy) *tokenbudget.Exceeded {
+	if t == nil || tenant == nil {
+		return nil
+	}
+	return t.budgets.Check(tenant.Name)
+}
+
+// recordTokens counts tokens used by the tenant against its budgets
+func (t *tenantRouter) recordTokens(tenant *tenantPolicy, tokens int64) {
+	if t == nil || tenant == nil {
+		return
+	}
+	t.budgets.Record(tenant.Name, tokens)
+}
+
+// defaultModel returns the model of requests of the tenant matching no
+// category
+func (p *tenantPolicy) defaultModel(fallback string) string {
+	if p == nil {
+		return fallback
+	}
+	return cmp.Or(p.DefaultModel, fallback)
+}
+
+// match applies the tenant's models to a routing decision: its first allowed
+// model for the matched category, or its default model when no category
+// matched. Decisions are kept when the tenant has no model allowed for them.
+func (p *tenantPolicy) match(match categoryMatch, policies policy.Set) categoryMatch {
+	if p == nil {
+		return match
+	}
+	if match.Category == "" {
+		if p.DefaultModel != "" && policies.Check(p.DefaultModel) == nil {
+			match.Model = p.DefaultModel
+		}
+		return match
+	}
+	if model, ok := policies.FirstAllowed(p.categoryModels[strings.ToLower(match.Category)]); ok {
+		match.Model = model
+	}
+	return match
+}
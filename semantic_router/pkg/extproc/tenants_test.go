@@ -0,0 +1,111 @@
+package extproc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestNewTenantRouter(t *testing.T) {
+	categories := []config.Category{{Name: "math"}}
+	keyHash := sha256.Sum256([]byte("sk-research"))
+	for _, tc := range []struct {
+		name    string
+		cfg     config.TenantsConfig
+		wantErr bool
+	}{
+		{"none", config.TenantsConfig{}, false},
+		{"named", config.TenantsConfig{Policies: []config.TenantRoutingPolicy{{Name: "research", CategoryModels: map[string][]string{"Math": {"law-model"}}}}}, false},
+		{"no name", config.TenantsConfig{Policies: []config.TenantRoutingPolicy{{}}}, true},
+		{"twice", config.TenantsConfig{Policies: []config.TenantRoutingPolicy{{Name: "a"}, {Name: "a"}}}, true},
+		{"unknown category", config.TenantsConfig{Policies: []config.TenantRoutingPolicy{{Name: "a", CategoryModels: map[string][]string{"law": {"law-model"}}}}}, true},
+		{"negative budget", config.TenantsConfig{Policies: []config.TenantRoutingPolicy{{Name: "a", DailyTokens: -1}}}, true},
+		{"keys without hashed_keys", config.TenantsConfig{Policies: []config.TenantRoutingPolicy{{Name: "a", APIKeySHA256: []string{hex.EncodeToString(keyHash[:])}}}}, true},
+		{"hashed without keys", config.TenantsConfig{HashedKeys: true, Policies: []config.TenantRoutingPolicy{{Name: "a"}}}, true},
+		{"bad hash", config.TenantsConfig{HashedKeys: true, Policies: []config.TenantRoutingPolicy{{Name: "a", APIKeySHA256: []string{"abc"}}}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newTenantRouter(tc.cfg, categories, nil); (err != nil) != tc.wantErr {
+				t.Errorf("newTenantRouter error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestTenantRouterResolveHashedKeys(t *testing.T) {
+	keyHash := sha256.Sum256([]byte("sk-research"))
+	tenants, err := newTenantRouter(config.TenantsConfig{
+		Header:     "Authorization",
+		HashedKeys: true,
+		Policies:   []config.TenantRoutingPolicy{{Name: "research", APIKeySHA256: []string{hex.EncodeToString(keyHash[:])}}},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, want := range map[string]string{
+		"Bearer sk-research": "research",
+		"sk-research":        "research",
+		"Bearer sk-other":    "",
+		"":                   "",
+	} {
+		name := ""
+		if tenant := tenants.resolve(map[string]string{"authorization": value}); tenant != nil {
+			name = tenant.Name
+		}
+		if name != want {
+			t.Errorf("resolve(%q) = %q, want %q", value, name, want)
+		}
+	}
+}
+
+func TestProcessTenantPolicies(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Tenants = config.TenantsConfig{Policies: []config.TenantRoutingPolicy{{
+		Name:           "research",
+		DefaultModel:   "math-model",
+		CategoryModels: map[string][]string{"math": {"law-model"}},
+		HourlyTokens:   15,
+	}}}
+	router, err := router.withConfig(router.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route := func(content string, headers ...string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders(headers...),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"` + content + `"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		// Rejected requests end the stream early
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+	model := func(stream *fakeStream) string {
+		return gjson.GetBytes(stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody(), "model").String()
+	}
+
+	if got := model(route("What is the derivative of x^2?")); got != "math-model" {
+		t.Errorf("request without tenant routed to %q, want math-model", got)
+	}
+	if got := model(route("What is the derivative of x^2?", "x-tenant-id", "other")); got != "math-model" {
+		t.Errorf("request of an unknown tenant routed to %q, want math-model", got)
+	}
+	// The completion's 15 tokens use up the tenant's hourly budget
+	if got := model(route("What is the derivative of x^2?", "x-tenant-id", "research")); got != "law-model" {
+		t.Errorf("tenant's math request routed to %q, want its law-model", got)
+	}
+	stream := route("What is the derivative of x^2?", "x-tenant-id", "research")
+	if status := stream.responses[1].GetImmediateResponse().GetStatus().GetCode(); status != 429 {
+		t.Errorf("tenant over its budget answered with status %d, want 429", status)
+	}
+}
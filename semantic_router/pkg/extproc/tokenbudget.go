@@ -0,0 +1,101 @@
+package extproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tokenbudget"
+)
+
+// newTokenBudgets creates the token budgets of clients, nil unless enabled
+func newTokenBudgets(cfg config.TokenBudgetsConfig) (*tokenbudget.Budgets, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.IdentityHeader == "" {
+		return nil, fmt.Errorf("identity_header is required")
+	}
+	if cfg.HourlyTokens < 0 || cfg.DailyTokens < 0 {
+		return nil, fmt.Errorf("budgets must not be negative")
+	}
+	identities := make(map[string]tokenbudget.Limits, len(cfg.Identities))
+	for i, identity := range cfg.Identities {
+		if identity.Identity == "" {
+			return nil, fmt.Errorf("identity %d has no identity", i)
+		}
+		if _, ok := identities[identity.Identity]; ok {
+			return nil, fmt.Errorf("identity %d is configured twice", i)
+		}
+		if identity.HourlyTokens < 0 || identity.DailyTokens < 0 {
+			return nil, fmt.Errorf("identity %d has a negative budget", i)
+		}
+		identities[identity.Identity] = tokenbudget.Limits{Hourly: identity.HourlyTokens, Daily: identity.DailyTokens}
+	}
+
+	options := tokenbudget.Options{
+		Default:    tokenbudget.Limits{Hourly: cfg.HourlyTokens, Daily: cfg.DailyTokens},
+		Identities: identities,
+	}
+	if redisCfg := cfg.Redis; redisCfg.Address != "" {
+		var password string
+		if redisCfg.PasswordEnv != "" {
+			password = os.Getenv(redisCfg.PasswordEnv)
+			if password == "" {
+				return nil, fmt.Errorf("%s is not set", redisCfg.PasswordEnv)
+			}
+		}
+		counter := tokenbudget.NewRedisCounter(tokenbudget.RedisOptions{
+			Address:   redisCfg.Address,
+			Password:  password,
+			DB:        redisCfg.DB,
+			KeyPrefix: redisCfg.KeyPrefix,
+			Timeout:   time.Duration(redisCfg.TimeoutMs) * time.Millisecond,
+		})
+		// Unreadable counters let requests through, so an unreachable server is not fatal
+		if err := counter.Ping(); err != nil {
+			slog.Warn("Token budget Redis server is unreachable", "address", redisCfg.Address, "error", err)
+		}
+		options.Counter = counter
+	}
+	slog.Info("Token budgets enabled", "identity_header", cfg.IdentityHeader, "hourly_tokens", cfg.HourlyTokens,
+		"daily_tokens", cfg.DailyTokens, "identities", len(identities), "shared", cfg.Redis.Address != "")
+	return tokenbudget.New(options), nil
+}
+
+// tokenBudgetResponse rejects a request of a client over its token budget
+// with an OpenAI style rate limit error, telling it when to retry
+func tokenBudgetResponse(exceeded *tokenbudget.Exceeded) *ext_proc.ProcessingResponse {
+	retryAfter := int(math.Ceil(exceeded.RetryAfter.Seconds()))
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("token budget exhausted: %v, retry in %ds", exceeded, retryAfter),
+			"type":    "rate_limit_exceeded",
+			"code":    http.StatusTooManyRequests,
+		},
+	})
+	return &ext_proc.ProcessingResponse{
+		Response: &ext_proc.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode_TooManyRequests},
+				Headers: &ext_proc.HeaderMutation{
+					SetHeaders: []*core.HeaderValueOption{
+						{Header: &core.HeaderValue{Key: "content-type", Value: "application/json"}},
+						{Header: &core.HeaderValue{Key: "retry-after", Value: strconv.Itoa(retryAfter)}},
+					},
+				},
+				Body: body,
+			},
+		},
+	}
+}
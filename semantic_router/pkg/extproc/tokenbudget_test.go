@@ -0,0 +1,91 @@
+package extproc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/flags"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tokenbudget"
+)
+
+func TestNewTokenBudgets(t *testing.T) {
+	if budgets, err := newTokenBudgets(config.TokenBudgetsConfig{HourlyTokens: 10}); budgets != nil || err != nil {
+		t.Errorf("disabled budgets = %v, %v, want nil", budgets, err)
+	}
+	for _, cfg := range []config.TokenBudgetsConfig{
+		{Enabled: true, HourlyTokens: 10},
+		{Enabled: true, IdentityHeader: "x-api-key", DailyTokens: -1},
+		{Enabled: true, IdentityHeader: "x-api-key", Identities: []config.TokenBudgetIdentityConfig{{HourlyTokens: 5}}},
+		{Enabled: true, IdentityHeader: "x-api-key", Identities: []config.TokenBudgetIdentityConfig{{Identity: "a"}, {Identity: "a"}}},
+	} {
+		if _, err := newTokenBudgets(cfg); err == nil {
+			t.Errorf("newTokenBudgets accepted %+v", cfg)
+		}
+	}
+}
+
+func TestProcessEnforcesTokenBudgets(t *testing.T) {
+	router := newTestRouter(t, false)
+	sink := &recordingSink{}
+	router.Decisions = sink
+	router.Config.TokenBudgets.IdentityHeader = "X-API-Key"
+	router.TokenBudgets = tokenbudget.New(tokenbudget.Options{Default: tokenbudget.Limits{Hourly: 20}})
+
+	send := func(i int, headers ...string) *fakeStream {
+		stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+			requestHeaders(append([]string{"x-request-id", fmt.Sprintf("req-%d", i)}, headers...)...),
+			requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+			responseHeaders("200"),
+			responseBody(completionBody, true),
+		}}
+		if err := router.Process(stream); err != nil && err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		return stream
+	}
+
+	// Each completion uses 15 tokens, so the budget of 20 runs out on the second
+	for i := 0; i < 2; i++ {
+		if immediate := send(i, "x-api-key", "alice").responses[1].GetImmediateResponse(); immediate != nil {
+			t.Fatalf("request %d rejected within the budget: %v", i, immediate)
+		}
+	}
+	immediate := send(2, "x-api-key", "alice").responses[1].GetImmediateResponse()
+	if immediate == nil || immediate.GetStatus().GetCode() != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429 once the budget is used up, got %v", immediate)
+	}
+	retryAfter := ""
+	for _, header := range immediate.GetHeaders().GetSetHeaders() {
+		if header.GetHeader().GetKey() == "retry-after" {
+			retryAfter = header.GetHeader().GetValue()
+		}
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err != nil || seconds <= 0 || seconds > 3600 {
+		t.Errorf("retry-after = %q, want the seconds until the hour ends", retryAfter)
+	}
+	if record := sink.records[len(sink.records)-1]; record.GetResponseStatus() != http.StatusTooManyRequests {
+		t.Errorf("decision record status %d, want 429", record.GetResponseStatus())
+	}
+
+	// Other clients and requests without the header are not affected
+	if send(3, "x-api-key", "bob").responses[1].GetImmediateResponse() != nil {
+		t.Error("another client was rejected")
+	}
+	if send(4).responses[1].GetImmediateResponse() != nil {
+		t.Error("request without an identity was rejected")
+	}
+
+	// Budgets are not enforced while the rate limit stage is off
+	if err := router.Flags.Set(flags.StageRateLimit, false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if send(5, "x-api-key", "alice").responses[1].GetImmediateResponse() != nil {
+		t.Error("client over its budget was rejected with the rate limit stage off")
+	}
+}
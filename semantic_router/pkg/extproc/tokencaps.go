@@ -0,0 +1,54 @@
+package extproc
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// Actions taken on the generation limit of a request over its tenant's cap
+const (
+	maxTokensLowered = "lowered"
+	maxTokensSet     = "set"
+)
+
+// Fields of a chat completion request limiting its generated tokens. Newer
+// clients send max_completion_tokens, which takes precedence.
+var maxTokensFields = []string{"max_completion_tokens", "max_tokens"}
+
+// requestedMaxTokens returns the generation limit field a request body sets
+// and its value, or empty and 0 when it sets none
+func requestedMaxTokens(body []byte) (string, int64) {
+	for _, field := range maxTokensFields {
+		if value := gjson.GetBytes(body, field); value.Exists() && value.Type == gjson.Number {
+			return field, value.Int()
+		}
+	}
+	return "", 0
+}
+
+// capMaxTokens caps the generation limit of the body forwarded upstream. The
+// limit the client asked for is read from its original body, since rerouted
+// requests are rewritten. Requests asking for more than the cap, or for no
+// limit, get the cap, returning the action taken; others are left unchanged.
+func capMaxTokens(original, body []byte, limit int) ([]byte, string, error) {
+	field, requested := requestedMaxTokens(original)
+	if field != "" && requested > 0 && requested <= int64(limit) {
+		return body, "", nil
+	}
+	action := maxTokensLowered
+	if field == "" {
+		field, action = "max_tokens", maxTokensSet
+	}
+
+	request, err := decodeRequestObject(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse request body: %w", err)
+	}
+	request[field] = limit
+	capped, err := encodeRequestBody(request)
+	if err != nil {
+		return nil, "", err
+	}
+	return capped, action, nil
+}
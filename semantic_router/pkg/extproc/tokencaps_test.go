@@ -0,0 +1,122 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+)
+
+func TestCapMaxTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantAction string
+		wantField  string
+	}{
+		{name: "under the cap", body: `{"model":"m","max_tokens":100}`},
+		{name: "at the cap", body: `{"model":"m","max_tokens":512}`},
+		{name: "over the cap", body: `{"model":"m","max_tokens":4096}`, wantAction: maxTokensLowered, wantField: "max_tokens"},
+		{name: "max_completion_tokens", body: `{"model":"m","max_completion_tokens":4096,"max_tokens":10}`, wantAction: maxTokensLowered, wantField: "max_completion_tokens"},
+		{name: "no limit", body: `{"model":"m"}`, wantAction: maxTokensSet, wantField: "max_tokens"},
+		{name: "invalid limit", body: `{"model":"m","max_tokens":"lots"}`, wantAction: maxTokensSet, wantField: "max_tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capped, action, err := capMaxTokens([]byte(tt.body), []byte(tt.body), 512)
+			if err != nil {
+				t.Fatalf("capMaxTokens: %v", err)
+			}
+			if action != tt.wantAction {
+				t.Errorf("action = %q, want %q", action, tt.wantAction)
+			}
+			if tt.wantAction == "" {
+				if string(capped) != tt.body {
+					t.Errorf("body changed to %s", capped)
+				}
+				return
+			}
+			if got := gjson.GetBytes(capped, tt.wantField).Int(); got != 512 {
+				t.Errorf("%s = %d, want 512 in %s", tt.wantField, got, capped)
+			}
+			if gjson.GetBytes(capped, "model").String() != "m" {
+				t.Errorf("other fields lost: %s", capped)
+			}
+		})
+	}
+
+	// The client's limit counts, not the one left in a rewritten body
+	capped, action, err := capMaxTokens([]byte(`{"model":"auto","max_tokens":100}`), []byte(`{"model":"m"}`), 512)
+	if err != nil || action != "" || string(capped) != `{"model":"m"}` {
+		t.Errorf("request under the cap was capped: %s, %q, %v", capped, action, err)
+	}
+}
+
+func TestProcessCapsTenantMaxTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		tenant    string
+		model     string
+		wantLimit int64
+	}{
+		{name: "rerouted request over the cap", tenant: "free-tier", model: "auto", wantLimit: 256},
+		{name: "unrouted request over the cap", tenant: "free-tier", model: "phi4", wantLimit: 256},
+		{name: "tenant without a cap", tenant: "acme", model: "phi4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, false)
+			sink := &recordingSink{}
+			router.Decisions = sink
+			var err error
+			router.Residency, err = policy.NewResidency(policy.ResidencyOptions{
+				Tenants: []config.TenantPolicy{{Name: "free-tier", MaxTokens: 256}},
+			})
+			if err != nil {
+				t.Fatalf("NewResidency: %v", err)
+			}
+			before := testutil.ToFloat64(metrics.MaxTokensCapped.WithLabelValues("free-tier", maxTokensLowered))
+
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1", "x-tenant-id", tt.tenant),
+				requestBody(`{"model":"` + tt.model + `","max_tokens":8192,"messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			common := stream.responses[1].GetRequestBody().GetResponse()
+			if got := sink.records[0].GetRouting().GetMaxTokensCap(); got != int32(tt.wantLimit) {
+				t.Errorf("decision record max_tokens_cap = %d, want %d", got, tt.wantLimit)
+			}
+			if tt.wantLimit == 0 {
+				if body := common.GetBodyMutation().GetBody(); body != nil && gjson.GetBytes(body, "max_tokens").Int() != 8192 {
+					t.Errorf("uncapped tenant's max_tokens rewritten: %s", body)
+				}
+				return
+			}
+			body := common.GetBodyMutation().GetBody()
+			if got := gjson.GetBytes(body, "max_tokens").Int(); got != tt.wantLimit {
+				t.Errorf("max_tokens = %d, want %d in %s", got, tt.wantLimit, body)
+			}
+			removed := false
+			for _, name := range common.GetHeaderMutation().GetRemoveHeaders() {
+				removed = removed || name == "content-length"
+			}
+			if !removed {
+				t.Error("content-length not removed from the capped request")
+			}
+			if got := testutil.ToFloat64(metrics.MaxTokensCapped.WithLabelValues("free-tier", maxTokensLowered)) - before; got != 1 {
+				t.Errorf("llm_max_tokens_capped_total increased by %v, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package extproc
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/policy"
+	"github.com/tidwall/gjson"
+)
+
+// Outcomes of routing a turn returning tool output
+const (
+	toolResultPinned      = "pinned"
+	toolResultUnknownCall = "unknown_call"
+	toolResultDisallowed  = "disallowed"
+)
+
+// toolCallEntry is the routing decision of a response that made a tool call
+type toolCallEntry struct {
+	match    categoryMatch
+	lastSeen time.Time
+}
+
+// toolCallTracker remembers the model that made each tool call, so the turn
+// returning the tool's output goes back to the same model instead of being
+// classified again
+type toolCallTracker struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	lastPrune time.Time
+	calls     map[string]*toolCallEntry
+}
+
+func newToolCallTracker(ttl time.Duration) *toolCallTracker {
+	return &toolCallTracker{
+		ttl:       ttl,
+		lastPrune: time.Now(),
+		calls:     make(map[string]*toolCallEntry),
+	}
+}
+
+// record remembers the routing decision for the tool calls made by a response
+func (t *toolCallTracker) record(callIDs []string, match categoryMatch) {
+	if t == nil || len(callIDs) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+	for _, id := range callIDs {
+		t.calls[id] = &toolCallEntry{match: match, lastSeen: now}
+	}
+}
+
+// lookup returns the routing decision of the response that made the first of
+// the tool calls it knows about
+func (t *toolCallTracker) lookup(callIDs []string) (categoryMatch, bool) {
+	if t == nil {
+		return categoryMatch{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+	for _, id := range callIDs {
+		if entry, ok := t.calls[id]; ok {
+			entry.lastSeen = now
+			return entry.match, true
+		}
+	}
+	return categoryMatch{}, false
+}
+
+// prune removes tool calls not seen within the TTL, at most twice per TTL.
+// Assumes the caller holds the lock
+func (t *toolCallTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.ttl/2 {
+		return
+	}
+	t.expire(now)
+}
+
+// expire removes tool calls not seen within the TTL, returning how many were
+// removed. Assumes the caller holds the lock
+func (t *toolCallTracker) expire(now time.Time) int {
+	expired := 0
+	for id, entry := range t.calls {
+		if now.Sub(entry.lastSeen) > t.ttl {
+			delete(t.calls, id)
+			expired++
+		}
+	}
+	t.lastPrune = now
+	return expired
+}
+
+// sweep removes expired tool calls for the janitor; a nil tracker has none
+func (t *toolCallTracker) sweep() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.expire(time.Now())
+}
+
+// pinnedToolCallModel returns the routing decision of the response that made
+// the tool calls a tool-result turn answers, unless the tool calls are unknown
+// or the request's policies no longer allow the model
+func (r *OpenAIRouter) pinnedToolCallModel(toolResultTurn bool, req *OpenAIRequest, policies policy.Set) (categoryMatch, bool) {
+	if !toolResultTurn || r.toolCalls == nil {
+		return categoryMatch{}, false
+	}
+	match, ok := r.toolCalls.lookup(toolResultCallIDs(req))
+	if !ok {
+		metrics.RecordToolResultRouting(toolResultUnknownCall)
+		return categoryMatch{}, false
+	}
+	if violation := policies.Check(match.Model); violation != nil {
+		slog.Info("Not keeping the model that made the tool call for its output", "pinned_model", match.Model, "reason", violation.Reason)
+		metrics.RecordToolResultRouting(toolResultDisallowed)
+		return categoryMatch{}, false
+	}
+	metrics.RecordToolResultRouting(toolResultPinned)
+	return match, true
+}
+
+// isToolResultTurn reports whether the request returns tool output to the
+// model, i.e. its last message has the tool role
+func isToolResultTurn(req *OpenAIRequest) bool {
+	return len(req.Messages) > 0 && req.Messages[len(req.Messages)-1].Role == "tool"
+}
+
+// toolResultCallIDs returns the IDs of the tool calls answered by the tool
+// messages ending the request
+func toolResultCallIDs(req *OpenAIRequest) []string {
+	var ids []string
+	for i := len(req.Messages) - 1; i >= 0 && req.Messages[i].Role == "tool"; i-- {
+		if id := req.Messages[i].ToolCallID; id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// responseToolCallIDs returns the IDs of the tool calls made by a chat
+// completion, either a JSON response or a stream of server-sent events
+func responseToolCallIDs(body []byte) []string {
+	var ids []string
+	collect := func(calls gjson.Result) {
+		for _, choice := range calls.Array() {
+			for _, id := range choice.Array() {
+				if id.String() != "" {
+					ids = append(ids, id.String())
+				}
+			}
+		}
+	}
+
+	if gjson.ValidBytes(body) {
+		collect(gjson.GetBytes(body, "choices.#.message.tool_calls.#.id"))
+		return ids
+	}
+	// Streamed tool calls carry their ID in the first delta of each call
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if gjson.ValidBytes(data) {
+			collect(gjson.GetBytes(data, "choices.#.delta.tool_calls.#.id"))
+		}
+	}
+	return ids
+}
@@ -0,0 +1,161 @@
+package extproc
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/tidwall/gjson"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+)
+
+func TestResponseToolCallIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "json response",
+			body: `{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[
+				{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{}"}},
+				{"id":"call_2","type":"function","function":{"name":"time","arguments":"{}"}}]}}]}`,
+			want: []string{"call_1", "call_2"},
+		},
+		{
+			name: "stream",
+			body: "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"weather\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{}\"}}]}}]}\n\n" +
+				"data: [DONE]\n\n",
+			want: []string{"call_1"},
+		},
+		{name: "no tool calls", body: completionBody},
+		{name: "not json", body: "upstream error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseToolCallIDs([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("responseToolCallIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolResultCallIDs(t *testing.T) {
+	req, err := parseOpenAIRequest([]byte(`{"model":"auto","messages":[
+		{"role":"user","content":"Weather and time in Paris?"},
+		{"role":"assistant","content":""},
+		{"role":"tool","tool_call_id":"call_1","content":"sunny"},
+		{"role":"tool","tool_call_id":"call_2","content":"noon"}]}`))
+	if err != nil {
+		t.Fatalf("parseOpenAIRequest: %v", err)
+	}
+	if !isToolResultTurn(req) {
+		t.Error("expected a tool-result turn")
+	}
+	if got, want := toolResultCallIDs(req), []string{"call_2", "call_1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("toolResultCallIDs = %v, want %v", got, want)
+	}
+
+	req.Messages = req.Messages[:1]
+	if isToolResultTurn(req) || toolResultCallIDs(req) != nil {
+		t.Error("a user turn is not a tool-result turn")
+	}
+}
+
+func TestToolCallTrackerExpires(t *testing.T) {
+	tracker := newToolCallTracker(time.Minute)
+	tracker.record([]string{"call_1"}, categoryMatch{Model: "math-model", Category: "math"})
+	if match, ok := tracker.lookup([]string{"call_0", "call_1"}); !ok || match.Model != "math-model" {
+		t.Fatalf("lookup = %+v, %v, want math-model", match, ok)
+	}
+
+	tracker.calls["call_1"].lastSeen = time.Now().Add(-2 * time.Minute)
+	tracker.lastPrune = time.Now().Add(-time.Minute)
+	if _, ok := tracker.lookup([]string{"call_1"}); ok {
+		t.Error("expected the tool call to expire")
+	}
+
+	var disabled *toolCallTracker
+	disabled.record([]string{"call_1"}, categoryMatch{Model: "math-model"})
+	if _, ok := disabled.lookup([]string{"call_1"}); ok {
+		t.Error("a nil tracker knows no tool calls")
+	}
+}
+
+func TestProcessToolResultTurn(t *testing.T) {
+	const toolCallResponse = `{"id":"c1","object":"chat.completion","model":"math-model",
+		"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"plot","arguments":"{}"}}]}}],
+		"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+	const question = `{"role":"user","content":"What is the derivative of x^2? Plot it."}`
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		toolCallID string
+		wantModel  string
+		wantPinned bool
+	}{
+		{name: "pinned to the model that made the call", enabled: true, toolCallID: "call_1", wantModel: "math-model", wantPinned: true},
+		{name: "unknown call is classified", enabled: true, toolCallID: "call_9", wantModel: "law-model"},
+		{name: "disabled", toolCallID: "call_1", wantModel: "law-model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, true)
+			sink := &recordingSink{}
+			router.Decisions = sink
+			if tt.enabled {
+				router.toolCalls = newToolCallTracker(time.Minute)
+			}
+
+			stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-1"),
+				requestBody(`{"model":"auto","messages":[` + question + `]}`),
+				responseHeaders("200"),
+				responseBody(toolCallResponse, true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			// The classifier would now pick another category for the conversation
+			router.classify = func(string) (candle_binding.ClassResult, error) {
+				return candle_binding.ClassResult{Class: 1, Confidence: 0.8}, nil
+			}
+			stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{
+				requestHeaders("x-request-id", "req-2"),
+				requestBody(`{"model":"auto","messages":[` + question + `,
+					{"role":"assistant","content":""},
+					{"role":"tool","tool_call_id":"` + tt.toolCallID + `","content":"plotted"}]}`),
+				responseHeaders("200"),
+				responseBody(completionBody, true),
+			}}
+			if err := router.Process(stream); err != io.EOF {
+				t.Fatalf("Process returned %v", err)
+			}
+
+			// The turn shares its user message with the cached tool call response
+			// and must not be answered from the cache
+			if len(stream.responses) != 4 || stream.responses[1].GetImmediateResponse() != nil {
+				t.Fatalf("expected the tool-result turn to be forwarded, got %v", stream.responses)
+			}
+			body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+			if model := gjson.GetBytes(body, "model").String(); model != tt.wantModel {
+				t.Errorf("routed to %q, want %q", model, tt.wantModel)
+			}
+			if got := gjson.GetBytes(body, "messages.2.tool_call_id").String(); got != tt.toolCallID {
+				t.Errorf("tool_call_id = %q, want %q", got, tt.toolCallID)
+			}
+			if len(sink.records) != 2 {
+				t.Fatalf("got %d decision records, want 2", len(sink.records))
+			}
+			if pinned := sink.records[1].GetRouting().GetToolResultPinned(); pinned != tt.wantPinned {
+				t.Errorf("tool_result_pinned = %v, want %v", pinned, tt.wantPinned)
+			}
+		})
+	}
+}
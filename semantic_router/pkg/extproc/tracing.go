@@ -0,0 +1,64 @@
+package extproc
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/tracing"
+)
+
+// Names of the spans of a request
+const (
+	spanStream         = "semantic_router.stream"
+	spanRequestHeaders = "semantic_router.request_headers"
+	spanParseBody      = "semantic_router.parse_body"
+	spanCacheLookup    = "semantic_router.cache_lookup"
+	spanClassify       = "semantic_router.classify"
+	spanMutation       = "semantic_router.build_mutation"
+)
+
+// startTrace starts the span of the stream as a child of the span Envoy
+// propagated in the request headers, if any
+func (c *RequestContext) startTrace(ctx context.Context) {
+	c.traceCtx, c.span = tracing.Tracer().Start(tracing.Extract(ctx, c.Headers), spanStream,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithTimestamp(c.StartTime),
+		trace.WithAttributes(attribute.String("request.id", c.ID)))
+}
+
+// endTrace ends the span of the stream once it is done, recording how the
+// request was routed
+func (c *RequestContext) endTrace() {
+	if c.span == nil {
+		return
+	}
+	if c.Model != "" {
+		c.span.SetAttributes(attribute.String("llm.model", c.Model))
+	}
+	if c.record != nil && c.record.Routing.Category != "" {
+		c.span.SetAttributes(attribute.String("llm.category", c.record.Routing.Category))
+	}
+	c.span.End()
+}
+
+// startSpan starts a span of a step of the request under the span of its stream
+func (c *RequestContext) startSpan(name string, attributes ...attribute.KeyValue) trace.Span {
+	ctx := c.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracing.Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+	return span
+}
+
+// endSpan ends a span, marking it failed when err is not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
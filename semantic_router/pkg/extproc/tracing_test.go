@@ -0,0 +1,61 @@
+package extproc
+
+import (
+	"io"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestProcessSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	router := newTestRouter(t, true)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1", "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{spanStream, spanRequestHeaders, spanParseBody, spanCacheLookup, spanClassify, spanMutation} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		// Every span belongs to the trace Envoy propagated
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("%s span in trace %s, want %s", name, got, traceID)
+		}
+	}
+	streamSpan := spans[spanStream]
+	if streamSpan == nil {
+		t.FailNow()
+	}
+	if got := streamSpan.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("stream span parent = %s, want Envoy's span", got)
+	}
+	if classify := spans[spanClassify]; classify != nil && classify.Parent().SpanID() != streamSpan.SpanContext().SpanID() {
+		t.Error("classify span is not a child of the stream span")
+	}
+	attributes := make(map[string]string)
+	for _, attribute := range streamSpan.Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["llm.model"] != "math-model" || attributes["llm.category"] != "math" {
+		t.Errorf("stream span attributes = %v, want the routed model and category", attributes)
+	}
+}
@@ -0,0 +1,107 @@
+package extproc
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// validateTrafficSplits checks the traffic splits of the categories
+func validateTrafficSplits(categories []config.Category) error {
+	for _, category := range categories {
+		if len(category.TrafficSplit) == 0 {
+			continue
+		}
+		total := 0.0
+		for _, split := range category.TrafficSplit {
+			if split.Model == "" {
+				return fmt.Errorf("invalid traffic_split for category %s: model is required", category.Name)
+			}
+			if split.Weight < 0 {
+				return fmt.Errorf("invalid traffic_split for category %s: negative weight for %s", category.Name, split.Model)
+			}
+			total += split.Weight
+		}
+		if total <= 0 {
+			return fmt.Errorf("invalid traffic_split for category %s: weights add up to 0", category.Name)
+		}
+	}
+	return nil
+}
+
+// trafficSplit returns the traffic split of the named category, nil without one
+func (r *OpenAIRouter) trafficSplit(categoryName string) []config.WeightedModel {
+	if categoryName == "" {
+		return nil
+	}
+	for _, category := range r.Config.Categories {
+		if strings.EqualFold(category.Name, categoryName) {
+			return category.TrafficSplit
+		}
+	}
+	return nil
+}
+
+// splitModel assigns a request of a category with a traffic split to one of
+// its models by weight. The assignment hashes the request ID, so it is stable
+// across retries, and the category name, so splits of different categories
+// are independent.
+func splitModel(split []config.WeightedModel, category, requestID string) (config.WeightedModel, bool) {
+	total := 0.0
+	for _, variant := range split {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return config.WeightedModel{}, false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(category))
+	h.Write([]byte{0})
+	h.Write([]byte(requestID))
+	point := float64(h.Sum64()%10000) / 10000 * total
+	for _, variant := range split {
+		if point < variant.Weight {
+			return variant, true
+		}
+		point -= variant.Weight
+	}
+	// Rounding left the point past the last weight
+	for i := len(split) - 1; i >= 0; i-- {
+		if split[i].Weight > 0 {
+			return split[i], true
+		}
+	}
+	return config.WeightedModel{}, false
+}
+
+// trafficGroup returns the group of a model in the traffic split of a
+// category, empty when the category has no split or the model is not part of
+// it, as when a request fell back to another model
+func (r *OpenAIRouter) trafficGroup(category, model string) string {
+	for _, variant := range r.trafficSplit(category) {
+		if variant.Model == model {
+			if variant.Group != "" {
+				return variant.Group
+			}
+			return variant.Model
+		}
+	}
+	return ""
+}
+
+// applyTrafficSplit routes a request matched to a category with a traffic
+// split to the model the split assigns it
+func (r *OpenAIRouter) applyTrafficSplit(reqCtx *RequestContext, match categoryMatch) categoryMatch {
+	variant, ok := splitModel(r.trafficSplit(match.Category), match.Category, reqCtx.ID)
+	if !ok {
+		return match
+	}
+	if variant.Model != match.Model {
+		reqCtx.log.Debug("Traffic split assigned the request to another model",
+			"category", match.Category, "split_model", variant.Model, "selected_model", match.Model)
+	}
+	match.Model = variant.Model
+	return match
+}
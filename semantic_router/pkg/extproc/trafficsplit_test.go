@@ -0,0 +1,80 @@
+package extproc
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tidwall/gjson"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestSplitModel(t *testing.T) {
+	split := []config.WeightedModel{
+		{Model: "stable-model", Weight: 95, Group: "stable"},
+		{Model: "canary-model", Weight: 5, Group: "canary"},
+		{Model: "retired-model", Weight: 0},
+	}
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		variant, ok := splitModel(split, "coding", fmt.Sprintf("req-%d", i))
+		if !ok {
+			t.Fatal("no model assigned")
+		}
+		counts[variant.Model]++
+	}
+	if share := float64(counts["canary-model"]) / 10000; math.Abs(share-0.05) > 0.01 {
+		t.Errorf("canary share %.3f, want about 0.05", share)
+	}
+	if counts["retired-model"] != 0 {
+		t.Errorf("%d requests assigned a model without weight", counts["retired-model"])
+	}
+
+	first, _ := splitModel(split, "coding", "req-1")
+	if again, _ := splitModel(split, "coding", "req-1"); again != first {
+		t.Error("assignment of a request is not stable")
+	}
+}
+
+func TestValidateTrafficSplits(t *testing.T) {
+	for _, split := range [][]config.WeightedModel{
+		{{Model: "", Weight: 1}},
+		{{Model: "a", Weight: -1}, {Model: "b", Weight: 2}},
+		{{Model: "a", Weight: 0}},
+	} {
+		if validateTrafficSplits([]config.Category{{Name: "coding", TrafficSplit: split}}) == nil {
+			t.Errorf("invalid traffic split %+v accepted", split)
+		}
+	}
+	if err := validateTrafficSplits([]config.Category{{Name: "coding"}}); err != nil {
+		t.Errorf("category without a split rejected: %v", err)
+	}
+}
+
+func TestProcessTrafficSplit(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Config.Categories[0].TrafficSplit = []config.WeightedModel{{Model: "canary-model", Weight: 1, Group: "canary"}}
+	requests := testutil.ToFloat64(metrics.TrafficSplitRequests.WithLabelValues("math", "canary", "canary-model"))
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(`{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`),
+		responseHeaders("200"),
+		responseBody(completionBody, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	body := stream.responses[1].GetRequestBody().GetResponse().GetBodyMutation().GetBody()
+	if model := gjson.GetBytes(body, "model").String(); model != "canary-model" {
+		t.Errorf("routed to %q, want canary-model", model)
+	}
+	if got := testutil.ToFloat64(metrics.TrafficSplitRequests.WithLabelValues("math", "canary", "canary-model")) - requests; got != 1 {
+		t.Errorf("recorded %v canary requests, want 1", got)
+	}
+}
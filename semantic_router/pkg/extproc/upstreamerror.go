@@ -0,0 +1,211 @@
+package extproc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/admin"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Types error responses are counted by, whatever the upstream names them
+const (
+	errorTypeContextLength  = "context_length_exceeded"
+	errorTypeRateLimit      = "rate_limit"
+	errorTypeQuota          = "insufficient_quota"
+	errorTypeOverloaded     = "overloaded"
+	errorTypeAuthentication = "authentication"
+	errorTypePermission     = "permission"
+	errorTypeNotFound       = "not_found"
+	errorTypeInvalidRequest = "invalid_request"
+	errorTypeServer         = "server"
+	errorTypeOther          = "other"
+)
+
+// maxErrorMessageLength is the longest error message kept for the admin API
+const maxErrorMessageLength = 512
+
+// upstreamError is an error response of a model's backend
+type upstreamError struct {
+	status int
+	// One of the errorType constants
+	kind string
+	// Type, code and message of the error envelope, empty without one
+	errType string
+	code    string
+	message string
+}
+
+// errorEnvelope holds the error of an OpenAI error response,
+// {"error": {"message": ..., "type": ..., "code": ...}}, and of the flat
+// errors some servers such as vLLM return, {"object": "error", "message": ...}
+type errorEnvelope struct {
+	Error   json.RawMessage `json:"error"`
+	Object  string          `json:"object"`
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"`
+}
+
+// errorDetails is the error object of an OpenAI error response
+type errorDetails struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"`
+}
+
+// parseUpstreamError returns the error of a response with an error status or
+// an error envelope. Bodies that are not an error envelope, including event
+// streams, only count as errors by their status.
+func parseUpstreamError(status int, body []byte) (upstreamError, bool) {
+	upstreamErr := upstreamError{status: status}
+	var envelope errorEnvelope
+	enveloped := false
+	if json.Unmarshal(body, &envelope) == nil {
+		var details errorDetails
+		switch {
+		case len(envelope.Error) > 0 && json.Unmarshal(envelope.Error, &details) == nil:
+			upstreamErr.errType, upstreamErr.code, upstreamErr.message = details.Type, errorCode(details.Code), details.Message
+			enveloped = true
+		case len(envelope.Error) > 0 && envelope.Error[0] == '"':
+			json.Unmarshal(envelope.Error, &upstreamErr.message)
+			enveloped = true
+		case envelope.Object == "error":
+			upstreamErr.errType, upstreamErr.code, upstreamErr.message = envelope.Type, errorCode(envelope.Code), envelope.Message
+			enveloped = true
+		}
+	}
+	if status < http.StatusBadRequest && !enveloped {
+		return upstreamError{}, false
+	}
+	if len(upstreamErr.message) > maxErrorMessageLength {
+		upstreamErr.message = upstreamErr.message[:maxErrorMessageLength]
+	}
+	upstreamErr.kind = classifyUpstreamError(upstreamErr)
+	return upstreamErr, true
+}
+
+// errorCode returns the code of an error envelope, which is a string, a
+// number or null
+func errorCode(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var code string
+	if json.Unmarshal(raw, &code) == nil {
+		return code
+	}
+	return string(raw)
+}
+
+// classifyUpstreamError returns the type of an error response, by the code
+// and type of its envelope and then by its status
+func classifyUpstreamError(upstreamErr upstreamError) string {
+	reported := strings.ToLower(upstreamErr.code + " " + upstreamErr.errType)
+	switch {
+	case strings.Contains(reported, "context_length"), strings.Contains(strings.ToLower(upstreamErr.message), "maximum context length"):
+		return errorTypeContextLength
+	case strings.Contains(reported, "insufficient_quota"):
+		return errorTypeQuota
+	case strings.Contains(reported, "rate_limit"):
+		return errorTypeRateLimit
+	case strings.Contains(reported, "overloaded"), strings.Contains(reported, "capacity"):
+		return errorTypeOverloaded
+	case strings.Contains(reported, "authentication"), strings.Contains(reported, "invalid_api_key"):
+		return errorTypeAuthentication
+	case strings.Contains(reported, "permission"):
+		return errorTypePermission
+	case strings.Contains(reported, "not_found"):
+		return errorTypeNotFound
+	}
+	switch status := upstreamErr.status; {
+	case status == http.StatusUnauthorized:
+		return errorTypeAuthentication
+	case status == http.StatusForbidden:
+		return errorTypePermission
+	case status == http.StatusNotFound:
+		return errorTypeNotFound
+	case status == http.StatusTooManyRequests:
+		return errorTypeRateLimit
+	case status == http.StatusServiceUnavailable, status == 529:
+		return errorTypeOverloaded
+	case status >= 500:
+		return errorTypeServer
+	case status >= 400, strings.Contains(reported, "invalid_request"):
+		return errorTypeInvalidRequest
+	}
+	return errorTypeOther
+}
+
+// observeUpstreamError counts an error response against the model the request
+// was routed to and keeps it for the admin API
+func (r *OpenAIRouter) observeUpstreamError(reqCtx *RequestContext, upstreamErr upstreamError) {
+	reqCtx.log.Info("Upstream returned an error response", "status", upstreamErr.status, "type", upstreamErr.kind, "code", upstreamErr.code, "message", upstreamErr.message)
+	if reqCtx.Model != "" {
+		metrics.RecordUpstreamErrorType(reqCtx.Model, upstreamErr.kind)
+	}
+	r.UpstreamErrors.add(admin.UpstreamError{
+		Time:         time.Now(),
+		RequestID:    reqCtx.ID,
+		Model:        reqCtx.Model,
+		Status:       upstreamErr.status,
+		Type:         upstreamErr.kind,
+		UpstreamType: upstreamErr.errType,
+		Code:         upstreamErr.code,
+		Message:      upstreamErr.message,
+	})
+}
+
+// upstreamErrorLog keeps the most recent error responses
+type upstreamErrorLog struct {
+	mu     sync.Mutex
+	errors []admin.UpstreamError
+	next   int
+	full   bool
+}
+
+// newUpstreamErrorLog creates a log keeping the last size errors
+func newUpstreamErrorLog(size int) *upstreamErrorLog {
+	return &upstreamErrorLog{errors: make([]admin.UpstreamError, max(size, 1))}
+}
+
+// add keeps an error, replacing the oldest once full. Safe to call on a nil log.
+func (l *upstreamErrorLog) add(upstreamErr admin.UpstreamError) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors[l.next] = upstreamErr
+	l.next = (l.next + 1) % len(l.errors)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns up to limit of the kept errors, newest first; limit <= 0
+// returns all of them. A nil log returns nil.
+func (l *upstreamErrorLog) recent(limit int) []admin.UpstreamError {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.errors)
+	}
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	recent := make([]admin.UpstreamError, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, l.errors[(l.next-i+len(l.errors))%len(l.errors)])
+	}
+	return recent
+}
@@ -0,0 +1,107 @@
+package extproc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/admin"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestParseUpstreamError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantOK   bool
+		wantKind string
+		wantCode string
+	}{
+		{"success", 200, completionBody, false, "", ""},
+		{"context length", 400, `{"error":{"message":"This model's maximum context length is 8192 tokens","type":"invalid_request_error","code":"context_length_exceeded"}}`, true, errorTypeContextLength, "context_length_exceeded"},
+		{"context length in the message", 400, `{"object":"error","message":"This model's maximum context length is 4096 tokens","type":"BadRequestError","code":400}`, true, errorTypeContextLength, "400"},
+		{"quota", 429, `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`, true, errorTypeQuota, "insufficient_quota"},
+		{"rate limit", 429, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, true, errorTypeRateLimit, "rate_limit_exceeded"},
+		{"capacity", 503, `{"error":{"message":"insufficient capacity","type":"insufficient_capacity","code":null}}`, true, errorTypeOverloaded, ""},
+		{"auth", 401, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`, true, errorTypeAuthentication, "invalid_api_key"},
+		{"string error", 500, `{"error":"backend crashed"}`, true, errorTypeServer, ""},
+		{"no envelope", 502, `<html>Bad Gateway</html>`, true, errorTypeServer, ""},
+		{"status only", 404, ``, true, errorTypeNotFound, ""},
+		{"envelope with success status", 200, `{"error":{"message":"model is overloaded","type":"overloaded_error"}}`, true, errorTypeOverloaded, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamErr, ok := parseUpstreamError(tt.status, []byte(tt.body))
+			if ok != tt.wantOK || upstreamErr.kind != tt.wantKind || upstreamErr.code != tt.wantCode {
+				t.Errorf("parseUpstreamError = %+v, %v, want kind %q, code %q, %v", upstreamErr, ok, tt.wantKind, tt.wantCode, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorLog(t *testing.T) {
+	log := newUpstreamErrorLog(2)
+	for i := 1; i <= 3; i++ {
+		log.add(admin.UpstreamError{RequestID: fmt.Sprint(i)})
+	}
+	recent := log.recent(0)
+	if len(recent) != 2 || recent[0].RequestID != "3" || recent[1].RequestID != "2" {
+		t.Errorf("recent = %+v, want requests 3 and 2", recent)
+	}
+	if recent := log.recent(1); len(recent) != 1 || recent[0].RequestID != "3" {
+		t.Errorf("recent(1) = %+v, want request 3", recent)
+	}
+
+	var disabled *upstreamErrorLog
+	disabled.add(admin.UpstreamError{})
+	if recent := disabled.recent(0); recent != nil {
+		t.Errorf("nil log returned %+v", recent)
+	}
+}
+
+func TestProcessObservesUpstreamErrors(t *testing.T) {
+	const request = `{"model":"auto","messages":[{"role":"user","content":"What is the derivative of x^2?"}]}`
+	const errorBody = `{"error":{"message":"This model's maximum context length is 8192 tokens","type":"invalid_request_error","code":"context_length_exceeded"}}`
+	router := newTestRouter(t, true)
+	router.UpstreamErrors = newUpstreamErrorLog(10)
+	counter := metrics.UpstreamErrorTypes.WithLabelValues("math-model", errorTypeContextLength)
+	before := testutil.ToFloat64(counter)
+
+	stream := &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-1"),
+		requestBody(request),
+		responseHeaders("400"),
+		responseBody(errorBody, true),
+	}}
+	if err := router.Process(stream); err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("counted %v context length errors, want 1", got)
+	}
+	recent := router.UpstreamErrors.recent(0)
+	if len(recent) != 1 || recent[0].RequestID != "req-1" || recent[0].Model != "math-model" || recent[0].Status != 400 ||
+		!strings.Contains(recent[0].Message, "maximum context length") {
+		t.Errorf("recent errors = %+v, want the context length error of req-1", recent)
+	}
+	if pending := router.Cache.PendingCount(); pending != 0 {
+		t.Errorf("expected no pending cache entry, got %d", pending)
+	}
+
+	// The error was not cached, so the same request goes upstream again
+	stream = &fakeStream{requests: []*ext_proc.ProcessingRequest{
+		requestHeaders("x-request-id", "req-2"),
+		requestBody(request),
+	}}
+	if err := router.Process(stream); err != nil && err != io.EOF {
+		t.Fatalf("Process returned %v", err)
+	}
+	if stream.responses[1].GetImmediateResponse() != nil {
+		t.Error("error response was served from the cache")
+	}
+}
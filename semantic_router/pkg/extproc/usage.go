@@ -0,0 +1,95 @@
+package extproc
+
+import (
+	"log/slog"
+	"unicode/utf8"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+const (
+	// charsPerToken approximates the characters per token of common LLM tokenizers on English text
+	charsPerToken = 4
+	// messageOverheadTokens approximates the tokens a chat template adds per message
+	messageOverheadTokens = 4
+	// tokenDriftLogRatio is how far reported usage may drift from the estimate,
+	// in either direction, before it is logged
+	tokenDriftLogRatio = 2.0
+)
+
+// estimatePromptTokens estimates the prompt tokens of a request before it is routed,
+// without knowing the tokenizer of the model it will be sent to
+func estimatePromptTokens(req *OpenAIRequest) int {
+	tokens := 0
+	for _, msg := range req.Messages {
+		chars := utf8.RuneCountInString(msg.Role) + utf8.RuneCountInString(msg.Content)
+		tokens += (chars+charsPerToken-1)/charsPerToken + messageOverheadTokens
+	}
+	return tokens
+}
+
+// reconcileTokenUsage compares the estimated prompt tokens of a request with the
+// usage reported by the upstream. Sustained drift points at a tokenizer mismatch,
+// and missing usage at upstreams that do not report it.
+func reconcileTokenUsage(model string, estimated, reported int) {
+	if estimated <= 0 {
+		return
+	}
+	if reported <= 0 {
+		metrics.RecordTokenUsageUnreported(model)
+		return
+	}
+	ratio := float64(reported) / float64(estimated)
+	metrics.RecordTokenEstimateRatio(model, ratio)
+	if ratio > tokenDriftLogRatio || ratio < 1/tokenDriftLogRatio {
+		slog.Debug("Prompt token estimate off", "model", model, "reported", reported, "estimated", estimated, "ratio", ratio)
+	}
+}
+
+// Where the token counts of a response were taken from
+const (
+	usageSourceResponse = "usage"
+	usageSourceChoices  = "per-choice usage"
+	usageSourceLogprobs = "logprobs"
+)
+
+// responseUsage returns the token usage of a response across all its choices.
+// The usage field of a response with several choices (n > 1) covers all of
+// them, but some backends report usage per choice instead, or only count the
+// first choice in the usage field, so per-choice usage is used when it adds up
+// to more. Without any usage the completion tokens are counted from the
+// choices' logprobs, which hold one entry per token.
+func responseUsage(response *OpenAIResponse) (OpenAIUsage, string) {
+	usage := response.Usage
+	source := usageSourceResponse
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		usage.PromptTokens, usage.CompletionTokens = usage.InputTokens, usage.OutputTokens
+	}
+
+	var perChoice OpenAIUsage
+	var logprobTokens int
+	allLogprobs := len(response.Choices) > 0
+	for _, choice := range response.Choices {
+		if choice.Usage != nil {
+			// Every choice completes the same prompt
+			perChoice.PromptTokens = max(perChoice.PromptTokens, choice.Usage.PromptTokens)
+			perChoice.CompletionTokens += choice.Usage.CompletionTokens
+		}
+		if choice.Logprobs != nil {
+			logprobTokens += len(choice.Logprobs.Content)
+		} else {
+			allLogprobs = false
+		}
+	}
+
+	if perChoice.CompletionTokens > usage.CompletionTokens {
+		usage.CompletionTokens = perChoice.CompletionTokens
+		usage.PromptTokens = max(usage.PromptTokens, perChoice.PromptTokens)
+		source = usageSourceChoices
+	} else if usage.CompletionTokens == 0 && allLogprobs && logprobTokens > 0 {
+		usage.CompletionTokens = logprobTokens
+		source = usageSourceLogprobs
+	}
+	usage.TotalTokens = max(usage.TotalTokens, usage.PromptTokens+usage.CompletionTokens)
+	return usage, source
+}
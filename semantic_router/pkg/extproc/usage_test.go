@@ -0,0 +1,119 @@
+package extproc
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestEstimatePromptTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []ChatMessage
+		want     int
+	}{
+		{name: "no messages", want: 0},
+		{name: "single message", messages: []ChatMessage{{Role: "user", Content: "What is 2+2?"}}, want: 4 + 4},
+		{name: "rounds up", messages: []ChatMessage{{Role: "user", Content: "a"}}, want: 2 + 4},
+		{name: "counts runes", messages: []ChatMessage{{Role: "user", Content: "日本語で"}}, want: 2 + 4},
+		{
+			name: "multiple messages",
+			messages: []ChatMessage{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Hi"},
+			},
+			want: 4 + 4 + 2 + 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimatePromptTokens(&OpenAIRequest{Messages: tt.messages}); got != tt.want {
+				t.Errorf("estimatePromptTokens() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileTokenUsage(t *testing.T) {
+	model := "reconcile-test-model"
+	unreported := metrics.TokenUsageUnreported.WithLabelValues(model)
+	before := testutil.ToFloat64(unreported)
+
+	reconcileTokenUsage(model, 100, 0)
+	reconcileTokenUsage(model, 0, 0)
+	if got := testutil.ToFloat64(unreported) - before; got != 1 {
+		t.Errorf("unreported usage count = %v, want 1", got)
+	}
+
+	reconcileTokenUsage(model, 100, 120)
+	reconcileTokenUsage(model, 100, 400)
+	if got := testutil.CollectAndCount(metrics.TokenEstimateRatio, "llm_token_estimate_ratio"); got == 0 {
+		t.Error("expected estimate ratio observations")
+	}
+}
+
+func TestParseTokensFromResponseChoices(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		wantPrompt     int
+		wantCompletion int
+		wantTotal      int
+	}{
+		{
+			name:           "usage covering every choice",
+			body:           `{"choices":[{"index":0},{"index":1}],"usage":{"prompt_tokens":10,"completion_tokens":40,"total_tokens":50}}`,
+			wantPrompt:     10,
+			wantCompletion: 40,
+			wantTotal:      50,
+		},
+		{
+			name: "per-choice usage without response usage",
+			body: `{"choices":[{"index":0,"usage":{"prompt_tokens":10,"completion_tokens":15}},
+				{"index":1,"usage":{"prompt_tokens":10,"completion_tokens":25}}]}`,
+			wantPrompt:     10,
+			wantCompletion: 40,
+			wantTotal:      50,
+		},
+		{
+			name: "response usage counting only the first choice",
+			body: `{"choices":[{"index":0,"usage":{"prompt_tokens":10,"completion_tokens":15}},
+				{"index":1,"usage":{"prompt_tokens":10,"completion_tokens":25}}],
+				"usage":{"prompt_tokens":10,"completion_tokens":15,"total_tokens":25}}`,
+			wantPrompt:     10,
+			wantCompletion: 40,
+			wantTotal:      50,
+		},
+		{
+			name: "logprobs without usage",
+			body: `{"choices":[{"index":0,"logprobs":{"content":[{"token":"a","logprob":-0.1},{"token":"b","logprob":-0.2}]}},
+				{"index":1,"logprobs":{"content":[{"token":"c","logprob":-0.3}]}}]}`,
+			wantCompletion: 3,
+			wantTotal:      3,
+		},
+		{
+			name:           "logprobs with usage",
+			body:           `{"choices":[{"index":0,"logprobs":{"content":[{"token":"a","logprob":-0.1}]}}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`,
+			wantPrompt:     5,
+			wantCompletion: 1,
+			wantTotal:      6,
+		},
+		{
+			name: "logprobs on some choices only",
+			body: `{"choices":[{"index":0,"logprobs":{"content":[{"token":"a","logprob":-0.1}]}},{"index":1}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, completion, total, err := parseTokensFromResponse([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseTokensFromResponse: %v", err)
+			}
+			if prompt != tt.wantPrompt || completion != tt.wantCompletion || total != tt.wantTotal {
+				t.Errorf("tokens = %d/%d/%d, want %d/%d/%d", prompt, completion, total, tt.wantPrompt, tt.wantCompletion, tt.wantTotal)
+			}
+		})
+	}
+}
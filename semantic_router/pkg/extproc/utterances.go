@@ -0,0 +1,186 @@
+package extproc
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// utteranceEmbeddings keeps the embeddings of the lists of category
+// utterances queries are matched against, computed in a single batch per list
+// at startup and reload, so matching a query only embeds the query and scores
+// every utterance with one matrix product
+type utteranceEmbeddings struct {
+	// Language whose model of the model pool embeds the lists, empty for the
+	// BERT model
+	language string
+
+	mu    sync.Mutex
+	lists map[string]*candle_binding.CandidateEmbeddings
+	// Embed a list of candidates and search them, and report whether the model
+	// is loaded, replaceable in tests
+	embed   func(candidates []string) (*candle_binding.CandidateEmbeddings, error)
+	search  func(query string, candidates *candle_binding.CandidateEmbeddings) candle_binding.SimResult
+	perCall func(query string, candidates []string) candle_binding.SimResult
+	loaded  func() bool
+}
+
+func newUtteranceEmbeddings() *utteranceEmbeddings {
+	return &utteranceEmbeddings{
+		lists: make(map[string]*candle_binding.CandidateEmbeddings),
+		embed: func(candidates []string) (*candle_binding.CandidateEmbeddings, error) {
+			return candle_binding.NewCandidateEmbeddings(candidates, 512)
+		},
+		search:  searchEmbedded,
+		perCall: candle_binding.FindMostSimilarDefault,
+		loaded:  candle_binding.IsModelInitialized,
+	}
+}
+
+// newLanguageUtteranceEmbeddings keeps the embeddings of the utterances
+// matched against queries in the language, embedded with its model of the
+// model pool
+func newLanguageUtteranceEmbeddings(language string) *utteranceEmbeddings {
+	model := languageModelName(language)
+	return &utteranceEmbeddings{
+		language: language,
+		lists:    make(map[string]*candle_binding.CandidateEmbeddings),
+		embed: func(candidates []string) (*candle_binding.CandidateEmbeddings, error) {
+			return candle_binding.NewPoolCandidateEmbeddings(model, candidates, 512)
+		},
+		search: searchEmbedded,
+		perCall: func(query string, candidates []string) candle_binding.SimResult {
+			return candle_binding.FindMostSimilarInPool(model, query, candidates, 512)
+		},
+		loaded: func() bool {
+			return candle_binding.IsPoolModelInitialized(model)
+		},
+	}
+}
+
+// languageModelName names the model of the model pool scoring queries in the
+// language
+func languageModelName(language string) string {
+	return "bert_model." + language
+}
+
+// searchEmbedded scores the query against candidates with the model that
+// embedded them
+func searchEmbedded(query string, candidates *candle_binding.CandidateEmbeddings) candle_binding.SimResult {
+	return candle_binding.FindMostSimilarEmbedded(query, candidates, 512)
+}
+
+// utteranceListKey identifies a list of candidates
+func utteranceListKey(candidates []string) string {
+	return strings.Join(candidates, "\x00")
+}
+
+// findMostSimilar finds the candidate most similar to the query, embedding
+// the candidates the first time the list is seen. Lists failing to embed are
+// searched by embedding every candidate with the query.
+func (u *utteranceEmbeddings) findMostSimilar(query string, candidates []string) candle_binding.SimResult {
+	embedded, err := u.list(candidates)
+	if err != nil {
+		slog.Warn("Error embedding category utterances, embedding them with the query", "error", err)
+		return u.perCall(query, candidates)
+	}
+	return u.search(query, embedded)
+}
+
+// list returns the embeddings of a list of candidates, computing them once
+func (u *utteranceEmbeddings) list(candidates []string) (*candle_binding.CandidateEmbeddings, error) {
+	key := utteranceListKey(candidates)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if embedded, ok := u.lists[key]; ok {
+		return embedded, nil
+	}
+	embedded, err := u.embed(candidates)
+	if err != nil {
+		return nil, err
+	}
+	u.lists[key] = embedded
+	return embedded, nil
+}
+
+// retain keeps the embeddings of the utterance lists of the config, dropping
+// those of lists it no longer has, and embeds its new lists once the
+// similarity model is loaded
+func (u *utteranceEmbeddings) retain(cfg *config.RouterConfig) {
+	lists := utteranceLists(cfg)
+	if u.language != "" {
+		lists = nil
+		if _, ok := cfg.GetLanguageModel(u.language); ok && cfg.HasCategoryUtterances() {
+			texts, _ := cfg.GetCategoryUtterances(u.language)
+			lists = [][]string{texts}
+		}
+	}
+	keep := make(map[string]bool, len(lists))
+	for _, candidates := range lists {
+		keep[utteranceListKey(candidates)] = true
+	}
+	u.mu.Lock()
+	for key := range u.lists {
+		if !keep[key] {
+			delete(u.lists, key)
+		}
+	}
+	u.mu.Unlock()
+
+	if !u.loaded() {
+		return
+	}
+	for _, candidates := range lists {
+		if _, err := u.list(candidates); err != nil {
+			slog.Warn("Error embedding category utterances", "language", u.language, "utterances", len(candidates), "error", err)
+		}
+	}
+}
+
+// utteranceLists returns the lists of texts queries are matched against: one
+// per language of utterances or descriptions, and the descriptions of queries
+// in other languages
+func utteranceLists(cfg *config.RouterConfig) [][]string {
+	if !cfg.HasCategoryUtterances() {
+		return nil
+	}
+	if cfg.BertModel.Multilingual {
+		texts, _ := cfg.GetCategoryUtterances("")
+		return [][]string{texts}
+	}
+	languages := map[string]bool{"": true}
+	for _, category := range cfg.Categories {
+		for language := range category.Utterances {
+			languages[language] = true
+		}
+		for language := range category.Descriptions {
+			languages[language] = true
+		}
+	}
+	sorted := make([]string, 0, len(languages))
+	for language := range languages {
+		sorted = append(sorted, language)
+	}
+	sort.Strings(sorted)
+	lists := make([][]string, 0, len(sorted))
+	for _, language := range sorted {
+		texts, _ := cfg.GetCategoryUtterances(language)
+		lists = append(lists, texts)
+	}
+	return lists
+}
+
+// retainUtterances keeps the utterance embeddings of every model in step with
+// the config
+func (r *OpenAIRouter) retainUtterances(cfg *config.RouterConfig) {
+	if r.utterances != nil {
+		r.utterances.retain(cfg)
+	}
+	for _, u := range r.languageUtterances {
+		u.retain(cfg)
+	}
+}
@@ -0,0 +1,84 @@
+package extproc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestUtteranceEmbeddings(t *testing.T) {
+	u := newUtteranceEmbeddings()
+	embedded := 0
+	u.embed = func(candidates []string) (*candle_binding.CandidateEmbeddings, error) {
+		embedded++
+		if candidates[0] == "broken" {
+			return nil, errors.New("embedding failed")
+		}
+		return &candle_binding.CandidateEmbeddings{}, nil
+	}
+	u.search = func(string, *candle_binding.CandidateEmbeddings) candle_binding.SimResult {
+		return candle_binding.SimResult{Index: 1, Score: 0.9}
+	}
+	u.perCall = func(string, []string) candle_binding.SimResult {
+		return candle_binding.SimResult{Index: 0, Score: 0.5}
+	}
+
+	candidates := []string{"write code", "solve equations"}
+	for range 3 {
+		if result := u.findMostSimilar("sort a list", candidates); result.Index != 1 {
+			t.Fatalf("findMostSimilar = %+v, want the precomputed match", result)
+		}
+	}
+	if embedded != 1 {
+		t.Errorf("candidates embedded %d times, want once", embedded)
+	}
+	if result := u.findMostSimilar("sort a list", []string{"broken"}); result.Index != 0 {
+		t.Errorf("findMostSimilar = %+v, want the per-call fallback", result)
+	}
+}
+
+func TestLanguageUtteranceEmbeddings(t *testing.T) {
+	cfg := &config.RouterConfig{Categories: []config.Category{
+		{Name: "math", Utterances: map[string][]string{"en": {"solve this equation"}}, Descriptions: map[string]string{"de": "Mathematik"}},
+		{Name: "law"},
+	}}
+	cfg.BertModel.LanguageModels = map[string]config.LanguageModel{"de": {ModelID: "german-bert"}}
+
+	u := newLanguageUtteranceEmbeddings("de")
+	var embedded [][]string
+	u.embed = func(candidates []string) (*candle_binding.CandidateEmbeddings, error) {
+		embedded = append(embedded, candidates)
+		return &candle_binding.CandidateEmbeddings{}, nil
+	}
+	u.loaded = func() bool { return true }
+
+	// Only the list matched against German queries is embedded
+	u.retain(cfg)
+	if want := [][]string{{"Mathematik", "law"}}; !reflect.DeepEqual(embedded, want) {
+		t.Errorf("embedded %v, want %v", embedded, want)
+	}
+	if len(u.lists) != 1 {
+		t.Errorf("kept %d lists, want 1", len(u.lists))
+	}
+
+	// Lists are dropped with the language's model
+	cfg.BertModel.LanguageModels = nil
+	u.retain(cfg)
+	if len(u.lists) != 0 {
+		t.Errorf("kept %d lists after the language model was removed, want none", len(u.lists))
+	}
+}
+
+func TestUtteranceListsIncludeDescriptionLanguages(t *testing.T) {
+	cfg := &config.RouterConfig{Categories: []config.Category{
+		{Name: "math", Descriptions: map[string]string{"ja": "数学"}},
+		{Name: "law", Description: "legal questions"},
+	}}
+	want := [][]string{{"math", "legal questions"}, {"数学", "legal questions"}}
+	if lists := utteranceLists(cfg); !reflect.DeepEqual(lists, want) {
+		t.Errorf("utteranceLists = %v, want %v", lists, want)
+	}
+}
@@ -0,0 +1,96 @@
+package extproc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+)
+
+// warmStart replays the decision records logged by earlier replicas, oldest
+// first, into the circuit breakers, the application recommender and the
+// recent decisions, so a restarted router does not route naively until it has
+// seen enough traffic of its own
+func (r *OpenAIRouter) warmStart(cfg config.WarmStartConfig, recordsCfg config.DecisionRecordsConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	var sealer *decision.Sealer
+	if recordsCfg.EncryptionKeyEnv != "" || recordsCfg.SigningKeyEnv != "" {
+		keys, err := decision.LoadKeys(recordsCfg.EncryptionKeyEnv, recordsCfg.SigningKeyEnv)
+		if err != nil {
+			return err
+		}
+		if sealer, err = decision.NewSealer(keys); err != nil {
+			return err
+		}
+	}
+	maxAge := time.Duration(cfg.MaxAgeHours * float64(time.Hour))
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+	maxRecords := cfg.MaxRecords
+	if maxRecords <= 0 {
+		maxRecords = 100000
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var records []*decision.DecisionRecord
+	for _, path := range cfg.Paths {
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Warm start decision records not found", "path", path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		read, skipped, err := decision.ReadLog(f, sealer)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if skipped > 0 {
+			slog.Warn("Skipped unreadable warm start decision records", "path", path, "skipped", skipped)
+		}
+		for _, record := range read {
+			if ts := record.GetTimestamp(); ts != nil && ts.AsTime().After(cutoff) {
+				records = append(records, record)
+			}
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].GetTimestamp().AsTime().Before(records[j].GetTimestamp().AsTime())
+	})
+	if len(records) > maxRecords {
+		records = records[len(records)-maxRecords:]
+	}
+
+	for _, record := range records {
+		r.replay(record)
+	}
+	slog.Info("Warm started from decision records", "records", len(records), "max_age", maxAge)
+	return nil
+}
+
+// replay feeds a logged decision record to the state learned from traffic
+func (r *OpenAIRouter) replay(record *decision.DecisionRecord) {
+	model, status := record.GetRouting().GetSelectedModel(), int(record.GetResponseStatus())
+	if model != "" && status != 0 && !record.GetCacheHit() && !record.GetShadow() {
+		// Records time the whole completion rather than the response headers,
+		// so replayed responses never count as slow
+		r.Breakers.RecordAt(model, !isUpstreamError(status), 0, record.GetTimestamp().AsTime())
+	}
+	if r.Recommender != nil {
+		r.Recommender.Replay(record)
+	}
+	if r.RecentDecisions != nil {
+		r.RecentDecisions.Write(record)
+	}
+}
@@ -0,0 +1,78 @@
+package extproc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/breaker"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/recommend"
+)
+
+func TestWarmStart(t *testing.T) {
+	router := newTestRouter(t, false)
+	router.Breakers = breaker.New(breaker.Options{Window: time.Minute, MinRequests: 4})
+	router.Recommender = recommend.New(recommend.Options{MinRequests: 2})
+	router.RecentDecisions = decision.NewRingSink(10)
+
+	var log strings.Builder
+	write := func(id, model string, status int32, age time.Duration) {
+		record := decision.New(id)
+		record.Timestamp = timestamppb.New(time.Now().Add(-age))
+		record.Routing.Application = "coder"
+		record.Routing.SelectedModel = model
+		record.ResponseStatus = status
+		data, err := decision.MarshalJSON(record)
+		if err != nil {
+			t.Fatalf("MarshalJSON: %v", err)
+		}
+		fmt.Fprintf(&log, "2026/10/17 10:00:00 %s%s\n", decision.LogPrefix, data)
+	}
+	for i := 0; i < 4; i++ {
+		write(fmt.Sprintf("failed-%d", i), "math-model", 503, 10*time.Second)
+		write(fmt.Sprintf("served-%d", i), "law-model", 200, time.Hour)
+		write(fmt.Sprintf("expired-%d", i), "default-model", 200, 48*time.Hour)
+	}
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	if err := os.WriteFile(path, []byte(log.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := router.warmStart(config.WarmStartConfig{
+		Enabled:    true,
+		Paths:      []string{path, filepath.Join(t.TempDir(), "missing.log")},
+		MaxRecords: 6,
+	}, config.DecisionRecordsConfig{})
+	if err != nil {
+		t.Fatalf("warmStart: %v", err)
+	}
+
+	// Failures within the breaker window open the circuit
+	if router.Breakers.Allow("math-model") {
+		t.Error("circuit of math-model closed after replaying recent failures")
+	}
+	if !router.Breakers.Allow("law-model") {
+		t.Error("circuit of law-model opened by responses outside the window")
+	}
+	// Only the most recent records within the maximum age are replayed
+	recent := router.RecentDecisions.Recent(0)
+	if len(recent) != 6 {
+		t.Fatalf("replayed %d records, want 6", len(recent))
+	}
+	for _, record := range recent {
+		if record.GetRouting().GetSelectedModel() == "default-model" {
+			t.Errorf("replayed record %s older than the maximum age", record.GetRequestId())
+		}
+	}
+	recommendations := router.Recommender.Recommendations([]config.ApplicationConfig{{Name: "coder"}})
+	if len(recommendations) != 1 || len(recommendations[0].Models) != 2 {
+		t.Errorf("recommender not seeded with both models: %+v", recommendations)
+	}
+}
@@ -0,0 +1,171 @@
+// Package feedback tunes the routing thresholds of categories online from the
+// feedback downstream systems post on the requests they were sent, and tells
+// the router which cache entries the feedback invalidates.
+package feedback
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Kinds of feedback on a request
+const (
+	// The request was routed to the wrong category
+	KindMisrouted = "misrouted"
+	// The response served from or stored in the cache was stale or incorrect
+	KindStaleCache = "stale_cache"
+	// The request was routed to the right category
+	KindCorrect = "correct"
+)
+
+// ErrUnknownRequest is returned for feedback on a request that is not among
+// the recently tracked requests
+var ErrUnknownRequest = errors.New("request not among recent requests")
+
+// ErrUnknownKind is returned for feedback of a kind other than the Kind
+// constants
+var ErrUnknownKind = errors.New("unknown feedback kind")
+
+// Options holds options for creating a new tuner
+type Options struct {
+	// Threshold change of a category per feedback on its requests, defaults
+	// to 0.01
+	Step float32
+	// Most a category's threshold drifts from its configured one either way,
+	// defaults to 0.1
+	MaxDrift float32
+	// Recent requests remembered for feedback, oldest forgotten first,
+	// defaults to 10000
+	MaxTrackedRequests int
+}
+
+// Request is what the router decided for a tracked request
+type Request struct {
+	// Category the request was routed by, empty when it matched none
+	Category string
+	// ID of the cache entry the response was served from or stored in, empty
+	// when the request did not use the cache
+	CacheEntryID string
+}
+
+// tracked is a tracked request and the feedback kinds received for it
+type tracked struct {
+	request  Request
+	received map[string]bool
+}
+
+// Tuner tracks recent requests and adjusts the routing threshold of their
+// categories by the feedback posted on them. Misrouted requests raise their
+// category's threshold, so fewer borderline queries are routed to it, and
+// correctly routed ones lower it, within the maximum drift. A nil Tuner
+// tracks nothing and leaves thresholds as configured.
+type Tuner struct {
+	options Options
+
+	mu sync.Mutex
+	// Recent requests by ID, and their IDs oldest first
+	requests map[string]*tracked
+	order    []string
+	// Threshold adjustments by category
+	drift map[string]float32
+}
+
+// New creates a new tuner with the given options
+func New(options Options) *Tuner {
+	if options.Step <= 0 {
+		options.Step = 0.01
+	}
+	if options.MaxDrift <= 0 {
+		options.MaxDrift = 0.1
+	}
+	if options.MaxTrackedRequests <= 0 {
+		options.MaxTrackedRequests = 10000
+	}
+	return &Tuner{
+		options:  options,
+		requests: make(map[string]*tracked),
+		drift:    make(map[string]float32),
+	}
+}
+
+// Observe tracks a request for feedback, replacing what was tracked for a
+// retry of the request. Safe to call on a nil Tuner.
+func (t *Tuner) Observe(requestID string, request Request) {
+	if t == nil || requestID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.requests[requestID]; !ok {
+		t.order = append(t.order, requestID)
+	}
+	t.requests[requestID] = &tracked{request: request}
+	if len(t.order) > t.options.MaxTrackedRequests {
+		delete(t.requests, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// Submit applies feedback on a tracked request, returning what was decided
+// for it so the router can invalidate its cache entry. Feedback of a kind the
+// request already received changes nothing.
+func (t *Tuner) Submit(requestID, kind string) (Request, error) {
+	switch kind {
+	case KindMisrouted, KindStaleCache, KindCorrect:
+	default:
+		return Request{}, ErrUnknownKind
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	req, ok := t.requests[requestID]
+	if !ok {
+		metrics.RecordRoutingFeedback(kind, "unknown_request")
+		return Request{}, ErrUnknownRequest
+	}
+	metrics.RecordRoutingFeedback(kind, "accepted")
+	if req.received[kind] {
+		return req.request, nil
+	}
+	if req.received == nil {
+		req.received = make(map[string]bool)
+	}
+	req.received[kind] = true
+
+	category := req.request.Category
+	if category == "" {
+		return req.request, nil
+	}
+	switch kind {
+	case KindMisrouted:
+		t.adjust(category, t.options.Step)
+	case KindCorrect:
+		t.adjust(category, -t.options.Step)
+	}
+	return req.request, nil
+}
+
+// adjust moves a category's threshold by delta within the maximum drift.
+// t.mu must be held.
+func (t *Tuner) adjust(category string, delta float32) {
+	drift := min(max(t.drift[category]+delta, -t.options.MaxDrift), t.options.MaxDrift)
+	t.drift[category] = drift
+	metrics.SetCategoryThresholdDrift(category, drift)
+}
+
+// Threshold returns a category's threshold adjusted by the feedback on its
+// requests, between 0 and 1. A nil Tuner returns the configured threshold.
+func (t *Tuner) Threshold(category string, configured float32) float32 {
+	if t == nil {
+		return configured
+	}
+	t.mu.Lock()
+	drift := t.drift[category]
+	t.mu.Unlock()
+	if drift == 0 {
+		return configured
+	}
+	return min(max(configured+drift, 0), 1)
+}
@@ -0,0 +1,80 @@
+package feedback
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+func TestSubmitAdjustsThresholds(t *testing.T) {
+	tuner := New(Options{Step: 0.125, MaxDrift: 0.25})
+	for _, id := range []string{"a", "b", "c", "d"} {
+		tuner.Observe(id, Request{Category: "math"})
+	}
+	tuner.Observe("e", Request{})
+
+	if _, err := tuner.Submit("a", KindMisrouted); err != nil {
+		t.Fatalf("Submit returned %v", err)
+	}
+	if got := tuner.Threshold("math", 0.5); got != 0.625 {
+		t.Errorf("threshold after a misroute = %v, want 0.625", got)
+	}
+	// Repeated feedback of a kind changes nothing
+	tuner.Submit("a", KindMisrouted)
+	if got := tuner.Threshold("math", 0.5); got != 0.625 {
+		t.Errorf("threshold after repeated feedback = %v, want 0.625", got)
+	}
+	// The drift is bounded
+	tuner.Submit("b", KindMisrouted)
+	tuner.Submit("c", KindMisrouted)
+	if got := tuner.Threshold("math", 0.5); got != 0.75 {
+		t.Errorf("threshold after three misroutes = %v, want 0.75", got)
+	}
+	if got := testutil.ToFloat64(metrics.CategoryThresholdDrift.WithLabelValues("math")); got != 0.25 {
+		t.Errorf("drift gauge = %v, want 0.25", got)
+	}
+	tuner.Submit("d", KindCorrect)
+	if got := tuner.Threshold("math", 0.5); got != 0.625 {
+		t.Errorf("threshold after a correct routing = %v, want 0.625", got)
+	}
+	// Stale cache feedback and requests without a category leave thresholds be
+	tuner.Submit("d", KindStaleCache)
+	tuner.Submit("e", KindMisrouted)
+	if got := tuner.Threshold("math", 0.5); got != 0.625 {
+		t.Errorf("threshold after other feedback = %v, want 0.625", got)
+	}
+	if got := tuner.Threshold("law", 0.6); got != 0.6 {
+		t.Errorf("threshold of a category without feedback = %v, want 0.6", got)
+	}
+}
+
+func TestSubmitReturnsRequest(t *testing.T) {
+	tuner := New(Options{MaxTrackedRequests: 2})
+	tuner.Observe("a", Request{Category: "math", CacheEntryID: "entry-a"})
+	tuner.Observe("b", Request{})
+	tuner.Observe("c", Request{})
+
+	if _, err := tuner.Submit("a", KindStaleCache); !errors.Is(err, ErrUnknownRequest) {
+		t.Errorf("feedback on a forgotten request returned %v, want ErrUnknownRequest", err)
+	}
+	if _, err := tuner.Submit("b", "great"); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("feedback of an unknown kind returned %v, want ErrUnknownKind", err)
+	}
+
+	tuner.Observe("d", Request{Category: "math", CacheEntryID: "entry-d"})
+	req, err := tuner.Submit("d", KindStaleCache)
+	if err != nil || req.CacheEntryID != "entry-d" {
+		t.Errorf("Submit = %+v, %v, want the cache entry of d", req, err)
+	}
+}
+
+func TestNilTuner(t *testing.T) {
+	var tuner *Tuner
+	tuner.Observe("a", Request{Category: "math"})
+	if got := tuner.Threshold("math", 0.6); got != 0.6 {
+		t.Errorf("nil tuner threshold = %v, want 0.6", got)
+	}
+}
@@ -0,0 +1,175 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// Version is the router build version, set at build time with
+// -ldflags "-X github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/fingerprint.Version=..."
+var Version = ""
+
+// Artifact identifies a model or data file the router loaded
+type Artifact struct {
+	// Config key the artifact is configured under, e.g. classifier
+	Name string `json:"name"`
+	// Model ID or path as configured
+	ID string `json:"id"`
+	// Commit of a Hugging Face Hub model resolved from the local hub cache
+	Revision string `json:"revision,omitempty"`
+	// SHA-256 of a local file, or of every file of a local model directory
+	SHA256 string `json:"sha256,omitempty"`
+	// Why the artifact could not be fingerprinted
+	Error string `json:"error,omitempty"`
+}
+
+// Fingerprint identifies the build, config and artifacts a router replica runs
+// with, so deployment tooling can verify every replica runs the intended ones
+type Fingerprint struct {
+	Version     string     `json:"version"`
+	ConfigHash  string     `json:"config_hash"`
+	RoutingHash string     `json:"routing_hash"`
+	Models      []Artifact `json:"models"`
+	Artifacts   []Artifact `json:"artifacts"`
+}
+
+// Compute fingerprints the given config and the artifacts it references. Local
+// model directories are hashed in full, so this is meant to run once at startup.
+func Compute(cfg *config.RouterConfig) *Fingerprint {
+	f := &Fingerprint{
+		Version:     BuildVersion(),
+		ConfigHash:  cfg.Hash(),
+		RoutingHash: cfg.RoutingHash(),
+		Models: []Artifact{
+			model("bert_model", cfg.BertModel.ModelID),
+			model("classifier", cfg.Classifier.ModelID),
+		},
+		Artifacts: []Artifact{},
+	}
+	if path := cfg.Classifier.CategoryMappingPath; path != "" {
+		a := Artifact{Name: "category_mapping", ID: path}
+		a.SHA256, a.Error = errorString(hashFile(path))
+		f.Artifacts = append(f.Artifacts, a)
+	}
+	return f
+}
+
+// BuildVersion returns the version set at build time, falling back to the VCS
+// revision Go stamps into module builds
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// model fingerprints a model loaded either from a local directory or from the hub
+func model(name, id string) Artifact {
+	a := Artifact{Name: name, ID: id}
+	if id == "" {
+		return a
+	}
+	if info, err := os.Stat(id); err == nil && info.IsDir() {
+		a.SHA256, a.Error = errorString(hashDir(id))
+		return a
+	}
+	a.Revision = hubRevision(id)
+	return a
+}
+
+// hubRevision returns the commit the local Hugging Face Hub cache resolved the
+// main branch of a model to, empty if the model is not cached
+func hubRevision(id string) string {
+	home := os.Getenv("HF_HOME")
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		home = filepath.Join(userHome, ".cache", "huggingface")
+	}
+	ref := filepath.Join(home, "hub", "models--"+strings.ReplaceAll(id, "/", "--"), "refs", "main")
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir hashes the relative paths and contents of every file under dir
+func hashDir(dir string) (string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(h, "%s %s\n", sum, filepath.ToSlash(rel))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func errorString(value string, err error) (string, string) {
+	if err != nil {
+		return "", err.Error()
+	}
+	return value, ""
+}
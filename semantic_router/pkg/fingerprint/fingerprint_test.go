@@ -0,0 +1,76 @@
+package fingerprint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func TestCompute(t *testing.T) {
+	dir := t.TempDir()
+	modelDir := filepath.Join(dir, "classifier")
+	mustWrite(t, filepath.Join(modelDir, "config.json"), `{"labels": 14}`)
+	mustWrite(t, filepath.Join(modelDir, "weights", "model.safetensors"), "weights")
+	mapping := filepath.Join(dir, "category_mapping.json")
+	mustWrite(t, mapping, `{"category_to_idx": {}}`)
+
+	hubHome := filepath.Join(dir, "hf")
+	mustWrite(t, filepath.Join(hubHome, "hub", "models--org--bert", "refs", "main"), "abc123\n")
+	t.Setenv("HF_HOME", hubHome)
+
+	cfg := &config.RouterConfig{DefaultModel: "model-a"}
+	cfg.BertModel.ModelID = "org/bert"
+	cfg.Classifier.ModelID = modelDir
+	cfg.Classifier.CategoryMappingPath = mapping
+
+	Version = "v1.2.3"
+	defer func() { Version = "" }()
+
+	f := Compute(cfg)
+	if f.Version != "v1.2.3" || len(f.ConfigHash) != 64 || f.RoutingHash != cfg.RoutingHash() {
+		t.Errorf("unexpected build and config fields: %+v", f)
+	}
+	if bert := f.Models[0]; bert.Revision != "abc123" || bert.SHA256 != "" {
+		t.Errorf("expected the hub revision of the bert model, got %+v", bert)
+	}
+	classifier := f.Models[1]
+	if len(classifier.SHA256) != 64 || classifier.Error != "" {
+		t.Fatalf("expected a checksum of the classifier directory, got %+v", classifier)
+	}
+	if len(f.Artifacts) != 1 || len(f.Artifacts[0].SHA256) != 64 {
+		t.Errorf("expected a checksum of the category mapping, got %+v", f.Artifacts)
+	}
+
+	// Any change to the model files changes the checksum
+	mustWrite(t, filepath.Join(modelDir, "weights", "model.safetensors"), "retrained weights")
+	if changed := Compute(cfg).Models[1].SHA256; changed == classifier.SHA256 {
+		t.Error("expected the classifier checksum to change with its weights")
+	}
+
+	// The config hash covers settings outside the routing hash
+	cfg.Classifier.Threshold = 0.9
+	if changed := Compute(cfg); changed.ConfigHash == f.ConfigHash || changed.RoutingHash != f.RoutingHash {
+		t.Error("expected only the config hash to change with the classifier threshold")
+	}
+}
+
+func TestComputeMissingArtifact(t *testing.T) {
+	cfg := &config.RouterConfig{}
+	cfg.Classifier.CategoryMappingPath = filepath.Join(t.TempDir(), "missing.json")
+	f := Compute(cfg)
+	if f.Artifacts[0].Error == "" || f.Artifacts[0].SHA256 != "" {
+		t.Errorf("expected an error for a missing artifact, got %+v", f.Artifacts[0])
+	}
+}
+
+func mustWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,44 @@
+package flags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewAppliesInitialState(t *testing.T) {
+	f, err := New(Options{Initial: map[string]bool{StageCache: false}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if f.Enabled(StageCache) {
+		t.Error("expected cache to start disabled")
+	}
+	if !f.Enabled(StageClassification) {
+		t.Error("expected unlisted stages to start enabled")
+	}
+	if got := f.Disabled(); !reflect.DeepEqual(got, []string{StageCache}) {
+		t.Errorf("Disabled() = %v", got)
+	}
+
+	if _, err := New(Options{Initial: map[string]bool{"jailbreak": false}}); err == nil {
+		t.Error("expected an error for an unknown stage")
+	}
+}
+
+func TestSet(t *testing.T) {
+	f, _ := New(Options{})
+	if err := f.Set(StageMutation, false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if f.Enabled(StageMutation) {
+		t.Error("expected mutation to be disabled")
+	}
+	if err := f.Set("unknown", false); err == nil {
+		t.Error("expected an error for an unknown stage")
+	}
+
+	var nilFlags *Flags
+	if !nilFlags.Enabled(StageCache) {
+		t.Error("expected a nil flag set to enable every stage")
+	}
+}
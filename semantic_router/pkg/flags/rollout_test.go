@@ -0,0 +1,88 @@
+package flags
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRolloutPercentAt(t *testing.T) {
+	start := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	rollout := Rollout{StartPercent: 10, TargetPercent: 50, RampStart: start, RampDuration: time.Hour}
+
+	tests := []struct {
+		at   time.Time
+		want float64
+	}{
+		{start.Add(-time.Minute), 10},
+		{start, 10},
+		{start.Add(30 * time.Minute), 30},
+		{start.Add(2 * time.Hour), 50},
+	}
+	for _, tt := range tests {
+		if got := rollout.PercentAt(tt.at); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("PercentAt(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestCohortAssignment(t *testing.T) {
+	f, err := New(Options{Rollouts: map[string]Rollout{StageCache: {StartPercent: 20, TargetPercent: 20}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if _, rollingOut := f.Cohort(StageMutation, "req-1"); rollingOut {
+		t.Error("expected no rollout for mutation")
+	}
+
+	treated := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("req-%d", i)
+		cohort, rollingOut := f.Cohort(StageCache, key)
+		if !rollingOut {
+			t.Fatal("expected a rollout for cache")
+		}
+		if again, _ := f.Cohort(StageCache, key); again != cohort {
+			t.Fatalf("cohort for %s changed from %s to %s", key, cohort, again)
+		}
+		if cohort == CohortTreated {
+			treated++
+		}
+		if f.Applies(StageCache, key) != (cohort == CohortTreated) {
+			t.Fatalf("Applies disagrees with cohort %s for %s", cohort, key)
+		}
+	}
+	if treated < 1800 || treated > 2200 {
+		t.Errorf("treated %d of 10000 requests, want about 2000", treated)
+	}
+
+	if err := f.SetRollout(StageCache, Rollout{TargetPercent: 120}); err == nil {
+		t.Error("expected an error for a percentage over 100")
+	}
+	f.ClearRollout(StageCache)
+	if !f.Applies(StageCache, "req-1") {
+		t.Error("expected the stage to apply to all traffic after clearing the rollout")
+	}
+}
+
+func TestRolloutOfPIIDetection(t *testing.T) {
+	f, err := New(Options{Rollouts: map[string]Rollout{StagePII: {StartPercent: 0, TargetPercent: 0}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if cohort, rollingOut := f.Cohort(StagePII, "req-1"); !rollingOut || cohort != CohortControl {
+		t.Errorf("cohort at 0%% = %s (rolling out %v), want control", cohort, rollingOut)
+	}
+
+	if err := f.SetRollout(StagePII, Rollout{StartPercent: 100, TargetPercent: 100}); err != nil {
+		t.Fatalf("SetRollout: %v", err)
+	}
+	if !f.Applies(StagePII, "req-1") {
+		t.Error("expected PII detection to apply at 100%")
+	}
+	if rollouts := f.Rollouts(); len(rollouts) != 1 || rollouts[StagePII].TargetPercent != 100 {
+		t.Errorf("rollouts = %v, want the PII rollout", rollouts)
+	}
+}
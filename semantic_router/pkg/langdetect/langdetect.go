@@ -0,0 +1,100 @@
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// scripts maps Unicode scripts used by a single major language to its ISO 639-1 code
+var scripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+}
+
+// stopwords are frequent function words of languages written in Latin script
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "what", "how", "with", "for", "this", "that", "it", "you", "can", "i"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "en", "es", "por", "para", "con", "una", "un", "cómo", "qué", "del"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "en", "un", "une", "que", "qui", "pour", "dans", "avec", "comment", "du"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "mit", "den", "von", "wie", "was", "ich", "für", "auf"},
+	"it": {"il", "lo", "la", "gli", "di", "che", "e", "è", "un", "una", "per", "con", "come", "cosa", "sono", "della", "non"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "é", "um", "uma", "para", "com", "não", "como", "do", "da", "em"},
+}
+
+// stopwordLanguages maps each stopword to the languages it belongs to
+var stopwordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range stopwords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// Detect returns the ISO 639-1 code of the language text is most likely written
+// in, or an empty string when it cannot tell. Languages with their own script
+// are detected by script, Latin-script languages by their most frequent words.
+func Detect(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scripts {
+			if unicode.Is(script.table, r) {
+				counts[script.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Japanese mixes kana with Han characters, so any kana decides for Japanese
+	if counts["ja"] > 0 {
+		return "ja"
+	}
+	if language, count := best(counts); count*2 > letters {
+		return language
+	}
+
+	words := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for _, language := range stopwordLanguages[word] {
+			words[language]++
+		}
+	}
+	if language, count := best(words); count > 0 {
+		return language
+	}
+	return ""
+}
+
+// best returns the language with the highest count, breaking ties by code so
+// detection is deterministic
+func best(counts map[string]int) (string, int) {
+	language, max := "", 0
+	for candidate, count := range counts {
+		if count > max || (count == max && count > 0 && candidate < language) {
+			language, max = candidate, count
+		}
+	}
+	return language, max
+}
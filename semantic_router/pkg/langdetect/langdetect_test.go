@@ -0,0 +1,30 @@
+package langdetect
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"1234 + 5678 = ?", ""},
+		{"What is the derivative of x squared?", "en"},
+		{"¿Cuál es la derivada de la función?", "es"},
+		{"Comment calculer la dérivée de cette fonction ?", "fr"},
+		{"Wie berechnet man die Ableitung von x hoch zwei?", "de"},
+		{"Come si calcola la derivata di una funzione?", "it"},
+		{"Como calcular a derivada de uma função?", "pt"},
+		{"函数的导数是什么？", "zh"},
+		{"この関数の導関数は何ですか？", "ja"},
+		{"이 함수의 도함수는 무엇입니까?", "ko"},
+		{"Какова производная этой функции?", "ru"},
+		{"ما هو مشتق هذه الدالة؟", "ar"},
+		{"Explain 导数 in simple words", "en"},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.text); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
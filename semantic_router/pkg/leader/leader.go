@@ -0,0 +1,387 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// DefaultLeaseName is the name of the Lease object when none is configured
+const DefaultLeaseName = "semantic-router"
+
+// serviceAccountDir holds the credentials Kubernetes mounts into every pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// tokenRefreshInterval is how often a token file is read again. Kubelet
+// rotates projected service account tokens well before they expire.
+const tokenRefreshInterval = time.Minute
+
+// Options holds options for creating a new leader elector
+type Options struct {
+	// Base URL of the Kubernetes API server
+	APIServer string
+	// Bearer token used to authenticate with the API server
+	Token string
+	// File the bearer token is read from instead, again every
+	// tokenRefreshInterval so rotated tokens are picked up
+	TokenFile string
+	// HTTP client used for API requests, configured with the cluster CA
+	HTTPClient *http.Client
+	// Namespace and name of the Lease object
+	Namespace string
+	LeaseName string
+	// Identity of this replica, written as the lease holder
+	Identity string
+	// How long a lease is valid without renewal
+	LeaseDuration time.Duration
+	// How often the leader renews and followers try to acquire the lease
+	RetryInterval time.Duration
+}
+
+// Elector elects a single leader among router replicas through a Kubernetes
+// Lease, so singleton background jobs run on exactly one replica
+type Elector struct {
+	options Options
+	leader  atomic.Bool
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	// Time of the last successful renewal while leading
+	renewed time.Time
+	// Source of the bearer token when read from a file
+	token *fileToken
+}
+
+// fileToken is a bearer token read from a file, cached for
+// tokenRefreshInterval
+type fileToken struct {
+	path    string
+	refresh time.Duration
+	mu      sync.Mutex
+	token   string
+	read    time.Time
+}
+
+// get returns the token, reading the file again once the cached one is
+// older than the refresh interval. A read error keeps the cached token, which
+// usually outlives the refresh interval by far.
+func (f *fileToken) get() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && time.Since(f.read) < f.refresh {
+		return f.token, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if f.token != "" {
+			log.Printf("Failed to read token file %s, keeping the previous token: %v", f.path, err)
+			return f.token, nil
+		}
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	f.token, f.read = strings.TrimSpace(string(data)), time.Now()
+	return f.token, nil
+}
+
+// NewInCluster creates an elector authenticated with the pod's service account.
+// The namespace defaults to the pod's own.
+func NewInCluster(options Options) (*Elector, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid cluster CA")
+	}
+	if options.Namespace == "" {
+		namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod namespace: %w", err)
+		}
+		options.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	options.APIServer = "https://" + net.JoinHostPort(host, port)
+	options.TokenFile = serviceAccountDir + "/token"
+	options.HTTPClient = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	return New(options)
+}
+
+// New creates a new leader elector with the given options
+func New(options Options) (*Elector, error) {
+	if options.APIServer == "" || options.Namespace == "" {
+		return nil, fmt.Errorf("API server and namespace are required")
+	}
+	if options.LeaseName == "" {
+		options.LeaseName = DefaultLeaseName
+	}
+	if options.Identity == "" {
+		return nil, fmt.Errorf("identity is required")
+	}
+	if options.LeaseDuration <= 0 {
+		options.LeaseDuration = 15 * time.Second
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = options.LeaseDuration / 3
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	e := &Elector{
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if options.TokenFile != "" {
+		e.token = &fileToken{path: options.TokenFile, refresh: tokenRefreshInterval}
+		if _, err := e.token.get(); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// IsLeader returns whether this replica currently holds the lease. A nil
+// elector, i.e. leader election disabled, always leads.
+func (e *Elector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	return e.leader.Load()
+}
+
+// Start tries to acquire and then keep renewing the lease in the background
+func (e *Elector) Start() {
+	log.Printf("Starting leader election for lease %s/%s as %s", e.options.Namespace, e.options.LeaseName, e.options.Identity)
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.options.RetryInterval)
+		defer ticker.Stop()
+		for {
+			e.tryAcquireOrRenew(context.Background())
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the election and releases the lease if held, so another replica
+// takes over without waiting for it to expire
+func (e *Elector) Stop() {
+	e.once.Do(func() {
+		close(e.stop)
+		<-e.done
+		if e.leader.Load() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := e.release(ctx); err != nil {
+				log.Printf("Error releasing lease: %v", err)
+			}
+			e.setLeader(false)
+		}
+	})
+}
+
+// tryAcquireOrRenew runs one round of the election
+func (e *Elector) tryAcquireOrRenew(ctx context.Context) {
+	now := time.Now()
+	acquired, err := e.acquire(ctx, now)
+	if err != nil {
+		log.Printf("Error updating lease %s/%s: %v", e.options.Namespace, e.options.LeaseName, err)
+		// Keep leading until the lease we last renewed would have expired
+		if e.leader.Load() && now.Sub(e.renewed) < e.options.LeaseDuration {
+			return
+		}
+		acquired = false
+	}
+	if acquired {
+		e.renewed = now
+	}
+	e.setLeader(acquired)
+}
+
+func (e *Elector) setLeader(leader bool) {
+	if e.leader.Swap(leader) != leader {
+		if leader {
+			log.Printf("Became leader for lease %s/%s", e.options.Namespace, e.options.LeaseName)
+		} else {
+			log.Printf("Lost leadership for lease %s/%s", e.options.Namespace, e.options.LeaseName)
+		}
+	}
+	metrics.RecordLeader(leader)
+}
+
+// acquire creates the lease, renews it if held, or takes it over if it
+// expired, and reports whether this replica holds it afterwards
+func (e *Elector) acquire(ctx context.Context, now time.Time) (bool, error) {
+	current, err := e.get(ctx)
+	if errors.Is(err, errNotFound) {
+		l := e.newLease(now, now, 0)
+		err := e.write(ctx, http.MethodPost, e.collectionURL(), l)
+		if errors.Is(err, errConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	spec := current.Spec
+	holder := ""
+	if spec.HolderIdentity != nil {
+		holder = *spec.HolderIdentity
+	}
+	if holder != e.options.Identity && holder != "" && !spec.expired(now) {
+		return false, nil
+	}
+
+	// Renew our own lease, or take over a released or expired one
+	acquireTime, transitions := now, int32(0)
+	if spec.LeaseTransitions != nil {
+		transitions = *spec.LeaseTransitions
+	}
+	if holder == e.options.Identity && spec.AcquireTime != nil {
+		acquireTime = spec.AcquireTime.Time
+	} else {
+		transitions++
+	}
+	l := e.newLease(acquireTime, now, transitions)
+	l.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	err = e.write(ctx, http.MethodPut, e.leaseURL(), l)
+	if errors.Is(err, errConflict) {
+		// Another replica updated the lease first
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// release gives up a held lease by clearing its holder
+func (e *Elector) release(ctx context.Context) error {
+	current, err := e.get(ctx)
+	if err != nil {
+		return err
+	}
+	if current.Spec.HolderIdentity == nil || *current.Spec.HolderIdentity != e.options.Identity {
+		return nil
+	}
+	current.Spec.HolderIdentity = nil
+	current.Spec.RenewTime = nil
+	return e.write(ctx, http.MethodPut, e.leaseURL(), current)
+}
+
+func (e *Elector) newLease(acquireTime, renewTime time.Time, transitions int32) *lease {
+	identity := e.options.Identity
+	duration := int32(e.options.LeaseDuration / time.Second)
+	return &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMetadata{Name: e.options.LeaseName, Namespace: e.options.Namespace},
+		Spec: leaseSpec{
+			HolderIdentity:       &identity,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &microTime{acquireTime},
+			RenewTime:            &microTime{renewTime},
+			LeaseTransitions:     &transitions,
+		},
+	}
+}
+
+func (e *Elector) collectionURL() string {
+	return fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", e.options.APIServer, e.options.Namespace)
+}
+
+func (e *Elector) leaseURL() string {
+	return e.collectionURL() + "/" + e.options.LeaseName
+}
+
+var (
+	errNotFound = errors.New("lease not found")
+	errConflict = errors.New("lease was modified concurrently")
+)
+
+func (e *Elector) get(ctx context.Context) (*lease, error) {
+	resp, err := e.do(ctx, http.MethodGet, e.leaseURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d getting lease", resp.StatusCode)
+	}
+	var l lease
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, fmt.Errorf("invalid lease: %w", err)
+	}
+	return &l, nil
+}
+
+func (e *Elector) write(ctx context.Context, method, url string, l *lease) error {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	resp, err := e.do(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return errConflict
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("unexpected status %d writing lease", resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *Elector) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token := e.options.Token
+	if e.token != nil {
+		if token, err = e.token.get(); err != nil {
+			return nil, err
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return e.options.HTTPClient.Do(req)
+}
@@ -0,0 +1,217 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeases is an in-memory API server for a single Lease with optimistic concurrency
+type fakeLeases struct {
+	mu      sync.Mutex
+	lease   *lease
+	version int
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const collection = "/apis/coordination.k8s.io/v1/namespaces/default/leases"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == collection+"/router":
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+	case r.Method == http.MethodPost && r.URL.Path == collection:
+		if f.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.store(w, r)
+	case r.Method == http.MethodPut && r.URL.Path == collection+"/router":
+		var l lease
+		json.NewDecoder(r.Body).Decode(&l)
+		if f.lease == nil || l.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.lease = &l
+		f.bump()
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (f *fakeLeases) store(w http.ResponseWriter, r *http.Request) {
+	var l lease
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.lease = &l
+	f.bump()
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *fakeLeases) bump() {
+	f.version++
+	f.lease.Metadata.ResourceVersion = strconv.Itoa(f.version)
+}
+
+func (f *fakeLeases) holder() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lease == nil || f.lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *f.lease.Spec.HolderIdentity
+}
+
+func newTestElector(t *testing.T, url, identity string) *Elector {
+	t.Helper()
+	e, err := New(Options{
+		APIServer:     url,
+		Namespace:     "default",
+		LeaseName:     "router",
+		Identity:      identity,
+		LeaseDuration: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return e
+}
+
+func TestSingleLeader(t *testing.T) {
+	leases := &fakeLeases{}
+	server := httptest.NewServer(leases)
+	defer server.Close()
+	ctx := context.Background()
+
+	a := newTestElector(t, server.URL, "a")
+	b := newTestElector(t, server.URL, "b")
+
+	a.tryAcquireOrRenew(ctx)
+	b.tryAcquireOrRenew(ctx)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("expected a to lead, got a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	// Renewals keep the leader
+	a.tryAcquireOrRenew(ctx)
+	b.tryAcquireOrRenew(ctx)
+	if !a.IsLeader() || b.IsLeader() || leases.holder() != "a" {
+		t.Fatalf("expected a to keep leading, holder %q", leases.holder())
+	}
+
+	// Once a stops renewing, b takes over after the lease expires
+	leases.mu.Lock()
+	leases.lease.Spec.RenewTime = &microTime{time.Now().Add(-3 * time.Second)}
+	leases.mu.Unlock()
+	b.tryAcquireOrRenew(ctx)
+	if !b.IsLeader() || leases.holder() != "b" {
+		t.Fatalf("expected b to take over the expired lease, holder %q", leases.holder())
+	}
+	if transitions := *leases.lease.Spec.LeaseTransitions; transitions != 1 {
+		t.Errorf("lease transitions = %d, want 1", transitions)
+	}
+
+	a.tryAcquireOrRenew(ctx)
+	if a.IsLeader() {
+		t.Error("expected a to step down once b holds the lease")
+	}
+}
+
+func TestStopReleasesLease(t *testing.T) {
+	leases := &fakeLeases{}
+	server := httptest.NewServer(leases)
+	defer server.Close()
+
+	a := newTestElector(t, server.URL, "a")
+	a.Start()
+	deadline := time.Now().Add(time.Second)
+	for !a.IsLeader() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !a.IsLeader() {
+		t.Fatal("expected a to become leader")
+	}
+	a.Stop()
+	if a.IsLeader() || leases.holder() != "" {
+		t.Fatalf("expected the lease to be released, holder %q", leases.holder())
+	}
+
+	// The released lease is taken over without waiting for it to expire
+	b := newTestElector(t, server.URL, "b")
+	b.tryAcquireOrRenew(context.Background())
+	if !b.IsLeader() {
+		t.Error("expected b to acquire the released lease")
+	}
+}
+
+func TestTokenFileIsReadAgain(t *testing.T) {
+	var mu sync.Mutex
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(Options{APIServer: server.URL, Namespace: "default", Identity: "a", TokenFile: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	get := func() {
+		t.Helper()
+		resp, err := e.do(context.Background(), http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	get()
+	// Rotated, but cached until the refresh interval passes
+	if err := os.WriteFile(path, []byte("second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	e.token.read = time.Now().Add(-tokenRefreshInterval)
+	get()
+	// A failed read keeps the previous token
+	os.Remove(path)
+	e.token.read = time.Now().Add(-tokenRefreshInterval)
+	get()
+
+	want := []string{"Bearer first", "Bearer first", "Bearer second", "Bearer second"}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(tokens, ",") != strings.Join(want, ",") {
+		t.Errorf("tokens = %v, want %v", tokens, want)
+	}
+}
+
+func TestNilElectorLeads(t *testing.T) {
+	var e *Elector
+	if !e.IsLeader() {
+		t.Error("a nil elector must always lead")
+	}
+}
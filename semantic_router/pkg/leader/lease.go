@@ -0,0 +1,61 @@
+package leader
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// lease is the subset of a coordination.k8s.io/v1 Lease used for leader election
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       *string    `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32     `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *microTime `json:"acquireTime,omitempty"`
+	RenewTime            *microTime `json:"renewTime,omitempty"`
+	LeaseTransitions     *int32     `json:"leaseTransitions,omitempty"`
+}
+
+// expired returns whether the holder failed to renew the lease in time
+func (s leaseSpec) expired(now time.Time) bool {
+	if s.RenewTime == nil || s.LeaseDurationSeconds == nil {
+		return true
+	}
+	return now.After(s.RenewTime.Add(time.Duration(*s.LeaseDurationSeconds) * time.Second))
+}
+
+// microTimeFormat is the RFC 3339 format with microseconds used by Kubernetes MicroTime
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// microTime encodes a time like the Kubernetes MicroTime type
+type microTime struct {
+	time.Time
+}
+
+func (t microTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format(microTimeFormat))
+}
+
+func (t *microTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
@@ -0,0 +1,306 @@
+// Package load polls the Prometheus metrics of vLLM and other
+// OpenAI-compatible backends for how loaded their endpoints are, so routing
+// can prefer the least loaded of the models acceptable for a request.
+//
+// An endpoint's load score weighs its queued requests, running requests and
+// KV-cache usage. Endpoints whose metrics can't be polled, or were last polled
+// too long ago, have no score, and a model without any scored endpoint has no
+// load, leaving its routing to the semantic decision alone.
+package load
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Metrics read from the endpoints, summed across their label sets. KV-cache
+// usage is reported under either name depending on the vLLM version.
+var (
+	waitingMetrics = []string{"vllm:num_requests_waiting"}
+	runningMetrics = []string{"vllm:num_requests_running"}
+	kvCacheMetrics = []string{"vllm:gpu_cache_usage_perc", "vllm:kv_cache_usage_perc"}
+)
+
+// Options holds options for creating a new load monitor
+type Options struct {
+	// Endpoints per model name
+	ModelEndpoints map[string][]config.ModelEndpoint
+	// Path of the endpoints' Prometheus metrics, default /metrics
+	MetricsPath string
+	// Time between polls of every endpoint
+	Interval time.Duration
+	// Timeout of a single poll
+	Timeout time.Duration
+	// Age after which the metrics of an endpoint are no longer used, default
+	// three intervals
+	MaxAge time.Duration
+	// Consecutive failed polls before an endpoint is reported unhealthy
+	FailureThreshold int
+	// Weights of queued requests, running requests and KV-cache usage (0 to 1)
+	// in an endpoint's load score, default 1, 0.1 and 10 when none is set
+	QueueWeight   float64
+	RunningWeight float64
+	KVCacheWeight float64
+}
+
+// Sample is the load an endpoint reported
+type Sample struct {
+	Waiting      float64
+	Running      float64
+	KVCacheUsage float64
+	At           time.Time
+}
+
+// endpointState tracks the latest sample and poll failures of an endpoint
+type endpointState struct {
+	sample   Sample
+	polled   bool
+	failures int
+}
+
+// Monitor polls the load of every model endpoint in the background
+type Monitor struct {
+	options Options
+	client  *http.Client
+	mu      sync.Mutex
+	// State per endpoint address
+	endpoints map[string]*endpointState
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+}
+
+// New creates a new load monitor with the given options
+func New(options Options) *Monitor {
+	if options.MetricsPath == "" {
+		options.MetricsPath = "/metrics"
+	}
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Second
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 2 * time.Second
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = 3 * options.Interval
+	}
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = 3
+	}
+	if options.QueueWeight == 0 && options.RunningWeight == 0 && options.KVCacheWeight == 0 {
+		options.QueueWeight, options.RunningWeight, options.KVCacheWeight = 1, 0.1, 10
+	}
+	return &Monitor{
+		options:   options,
+		client:    &http.Client{Timeout: options.Timeout},
+		endpoints: make(map[string]*endpointState),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start polls the endpoints right away, then every interval in the background
+func (m *Monitor) Start() {
+	log.Printf("Polling the load of model endpoints every %s", m.options.Interval)
+	go func() {
+		defer close(m.done)
+		m.RunOnce(context.Background())
+		ticker := time.NewTicker(m.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.RunOnce(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops the background polls and waits for the current one to finish
+func (m *Monitor) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+	<-m.done
+}
+
+// RunOnce polls every endpoint once, concurrently
+func (m *Monitor) RunOnce(ctx context.Context) {
+	var wg sync.WaitGroup
+	for model, endpoints := range m.options.ModelEndpoints {
+		for _, endpoint := range endpoints {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sample, err := m.poll(ctx, endpoint.Address)
+				m.record(model, endpoint, sample, err)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// poll reads the load metrics of an endpoint
+func (m *Monitor) poll(ctx context.Context, address string) (Sample, error) {
+	url := address + m.options.MetricsPath
+	if !strings.Contains(address, "://") {
+		url = "http://" + url
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Sample{}, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return Sample{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Sample{}, fmt.Errorf("metrics returned status %d", resp.StatusCode)
+	}
+	sample, err := ParseMetrics(resp.Body)
+	if err != nil {
+		return Sample{}, err
+	}
+	sample.At = time.Now()
+	return sample, nil
+}
+
+// record stores the outcome of polling an endpoint, logging when it becomes
+// unhealthy or recovers
+func (m *Monitor) record(model string, endpoint config.ModelEndpoint, sample Sample, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.endpoints[endpoint.Address]
+	if !ok {
+		state = &endpointState{}
+		m.endpoints[endpoint.Address] = state
+	}
+	if err != nil {
+		state.failures++
+		metrics.RecordEndpointLoadPollFailure(model, endpoint.Name)
+		if state.failures == m.options.FailureThreshold {
+			log.Printf("Load metrics of endpoint %s of model %s unavailable after %d polls: %v", endpoint.Name, model, state.failures, err)
+		}
+		return
+	}
+	if state.failures >= m.options.FailureThreshold {
+		log.Printf("Load metrics of endpoint %s of model %s available again", endpoint.Name, model)
+	}
+	state.sample, state.polled, state.failures = sample, true, 0
+	metrics.RecordEndpointLoad(model, endpoint.Name, m.score(sample))
+}
+
+// score returns the load score of a sample, higher being more loaded
+func (m *Monitor) score(sample Sample) float64 {
+	return m.options.QueueWeight*sample.Waiting + m.options.RunningWeight*sample.Running + m.options.KVCacheWeight*sample.KVCacheUsage
+}
+
+// Healthy returns whether the latest polls of an endpoint's metrics succeeded
+func (m *Monitor) Healthy(address string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.endpoints[address]
+	return !ok || state.failures < m.options.FailureThreshold
+}
+
+// Score returns the load score of a model, the mean of the scores of its
+// endpoints with recent metrics, and false when none has any
+func (m *Monitor) Score(model string) (float64, bool) {
+	if m == nil {
+		return 0, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	total, scored := 0.0, 0
+	for _, endpoint := range m.options.ModelEndpoints[model] {
+		state, ok := m.endpoints[endpoint.Address]
+		if !ok || !state.polled || state.failures >= m.options.FailureThreshold || now.Sub(state.sample.At) > m.options.MaxAge {
+			continue
+		}
+		total += m.score(state.sample)
+		scored++
+	}
+	if scored == 0 {
+		return 0, false
+	}
+	return total / float64(scored), true
+}
+
+// ParseMetrics reads the load metrics from the Prometheus text exposition
+// format, failing when the text has none of them
+func ParseMetrics(r io.Reader) (Sample, error) {
+	var sample Sample
+	found := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, value, ok := parseSample(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case slices.Contains(waitingMetrics, name):
+			sample.Waiting += value
+		case slices.Contains(runningMetrics, name):
+			sample.Running += value
+		case slices.Contains(kvCacheMetrics, name):
+			sample.KVCacheUsage = max(sample.KVCacheUsage, value)
+		default:
+			continue
+		}
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return Sample{}, err
+	}
+	if !found {
+		return Sample{}, fmt.Errorf("no load metrics found")
+	}
+	return sample, nil
+}
+
+// parseSample splits a sample line into its metric name and value
+func parseSample(line string) (string, float64, bool) {
+	name, rest := line, ""
+	if i := strings.IndexAny(line, "{ "); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+	if strings.HasPrefix(rest, "{") {
+		end := strings.LastIndexByte(rest, '}')
+		if end < 0 {
+			return "", 0, false
+		}
+		rest = rest[end+1:]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return name, value, true
+}
@@ -0,0 +1,88 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+const vllmMetrics = `# HELP vllm:num_requests_running Number of requests currently running on GPU.
+# TYPE vllm:num_requests_running gauge
+vllm:num_requests_running{model_name="phi4"} 6.0
+vllm:num_requests_waiting{model_name="phi4"} 2.0
+vllm:num_requests_waiting{model_name="phi4-lora"} 1.0
+vllm:gpu_cache_usage_perc{model_name="phi4"} 0.5
+vllm:num_preemptions_total{model_name="phi4"} 7.0
+`
+
+func TestParseMetrics(t *testing.T) {
+	sample, err := ParseMetrics(strings.NewReader(vllmMetrics))
+	if err != nil {
+		t.Fatalf("ParseMetrics: %v", err)
+	}
+	if sample.Waiting != 3 || sample.Running != 6 || sample.KVCacheUsage != 0.5 {
+		t.Errorf("unexpected sample %+v", sample)
+	}
+	if _, err := ParseMetrics(strings.NewReader("go_goroutines 12\n")); err == nil {
+		t.Error("metrics without load metrics parsed")
+	}
+}
+
+func TestMonitorScore(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() || r.URL.Path != "/metrics" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, vllmMetrics)
+	}))
+	defer server.Close()
+
+	monitor := New(Options{
+		ModelEndpoints: map[string][]config.ModelEndpoint{
+			"phi4":  {{Name: "phi4-a", Address: strings.TrimPrefix(server.URL, "http://")}},
+			"other": {{Name: "other-a", Address: server.URL + "/down"}},
+		},
+		FailureThreshold: 2,
+	})
+	monitor.RunOnce(context.Background())
+	// 1*3 waiting + 0.1*6 running + 10*0.5 KV-cache usage
+	if score, ok := monitor.Score("phi4"); !ok || score != 8.6 {
+		t.Errorf("Score(phi4) = %v, %v, want 8.6", score, ok)
+	}
+	if _, ok := monitor.Score("other"); ok {
+		t.Error("a model whose metrics can't be polled has a score")
+	}
+
+	// Metrics are used until the endpoint fails enough polls in a row
+	failing.Store(true)
+	monitor.RunOnce(context.Background())
+	if _, ok := monitor.Score("phi4"); !ok {
+		t.Error("score dropped after a single failed poll")
+	}
+	monitor.RunOnce(context.Background())
+	if _, ok := monitor.Score("phi4"); ok || monitor.Healthy(strings.TrimPrefix(server.URL, "http://")) {
+		t.Error("an endpoint failing its polls is still scored")
+	}
+
+	// and until they get stale
+	failing.Store(false)
+	monitor.RunOnce(context.Background())
+	monitor.endpoints[strings.TrimPrefix(server.URL, "http://")].sample.At = time.Now().Add(-time.Minute)
+	if _, ok := monitor.Score("phi4"); ok {
+		t.Error("stale metrics are still scored")
+	}
+
+	var disabled *Monitor
+	if _, ok := disabled.Score("phi4"); ok {
+		t.Error("a nil monitor has scores")
+	}
+}
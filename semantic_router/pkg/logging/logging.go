@@ -0,0 +1,76 @@
+// Package logging configures the router's structured, leveled logger. Output
+// of the standard log package, still used outside the request path, is
+// written through the same handler at info level.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// level is the minimum level logged, changeable while the router runs
+var level = new(slog.LevelVar)
+
+// Options holds options for setting up logging
+type Options struct {
+	// Minimum level logged: debug, info, warn or error; defaults to info
+	Level string
+	// Output format, text or json; defaults to text
+	Format string
+	// Where logs are written, defaults to stderr
+	Output io.Writer
+}
+
+// Setup installs the default logger with the given options
+func Setup(options Options) error {
+	if err := SetLevel(options.Level); err != nil {
+		return err
+	}
+	output := options.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(options.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(output, handlerOptions)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(output, handlerOptions)
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", options.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the minimum level logged, info when name is empty
+func SetLevel(name string) error {
+	parsed, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(parsed)
+	return nil
+}
+
+// ParseLevel parses a level name, info when empty
+func ParseLevel(name string) (slog.Level, error) {
+	var parsed slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	return parsed, nil
+}
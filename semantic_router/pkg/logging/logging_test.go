@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	defaultLogger := slog.Default()
+	output, flags := log.Writer(), log.Flags()
+	defer func() {
+		slog.SetDefault(defaultLogger)
+		log.SetOutput(output)
+		log.SetFlags(flags)
+		level.Set(slog.LevelInfo)
+	}()
+
+	var buf bytes.Buffer
+	if err := Setup(Options{Level: "warn", Format: FormatJSON, Output: &buf}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	slog.Info("dropped")
+	slog.With("request_id", "req-1").Warn("kept", "model", "phi4")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %v", buf.String(), err)
+	}
+	if entry["msg"] != "kept" || entry["request_id"] != "req-1" || entry["model"] != "phi4" || entry["level"] != "WARN" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+
+	buf.Reset()
+	if err := SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel: %v", err)
+	}
+	log.Printf("from the log package")
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["msg"] != "from the log package" || entry["level"] != "INFO" {
+		t.Errorf("standard log output not written through the handler: %q", buf.String())
+	}
+
+	if err := Setup(Options{Format: "xml"}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
@@ -1,6 +1,10 @@
 package metrics
 
 import (
+	"strconv"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -51,6 +55,25 @@ var (
 		[]string{"source_model", "target_model"},
 	)
 
+	// RoutingDecisions tracks every routing decision as an origin to destination matrix,
+	// including requests that kept their original model
+	RoutingDecisions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_routing_decisions_total",
+			Help: "The total number of routing decisions from the requested model to the selected model, by category",
+		},
+		[]string{"source_model", "target_model", "category"},
+	)
+
+	// CategoryReroutedRatio tracks the share of each category's traffic sent to a different model
+	CategoryReroutedRatio = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_category_rerouted_ratio",
+			Help: "The fraction of requests in each category routed to a different model than requested, since router start",
+		},
+		[]string{"category"},
+	)
+
 	// ModelCompletionLatency tracks the latency of completions by model
 	ModelCompletionLatency = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -70,52 +93,1677 @@ var (
 		},
 	)
 
-	// CacheHits tracks cache hits and misses
-	CacheHits = promauto.NewCounter(
+	// CacheHits tracks cache lookups answered from the cache by model
+	CacheHits = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "llm_cache_hits_total",
-			Help: "The total number of cache hits",
+			Help: "The total number of semantic cache lookups finding an entry similar enough, by model",
 		},
+		[]string{"model"},
 	)
-)
 
-// RecordModelRequest increments the counter for requests to a specific model
-func RecordModelRequest(model string) {
-	ModelRequests.WithLabelValues(model).Inc()
-}
+	// CacheMisses tracks cache lookups finding no entry similar enough by model
+	CacheMisses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cache_misses_total",
+			Help: "The total number of semantic cache lookups finding no entry similar enough, including those skipped by the pre-filter, by model",
+		},
+		[]string{"model"},
+	)
 
-// RecordModelRouting records that a request was routed from one model to another
-func RecordModelRouting(sourceModel, targetModel string) {
-	if sourceModel != targetModel {
-		ModelRoutingModifications.WithLabelValues(sourceModel, targetModel).Inc()
-	}
-}
+	// CacheErrors tracks cache lookups failing by model
+	CacheErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cache_errors_total",
+			Help: "The total number of semantic cache lookups failing to embed the query or search the backend, by model",
+		},
+		[]string{"model"},
+	)
 
-// RecordModelTokens adds the number of tokens used by a specific model
-func RecordModelTokens(model string, tokens float64) {
-	ModelTokens.WithLabelValues(model).Add(tokens)
-}
+	// CacheSimilarity tracks the similarity of the best match of lookups, to
+	// tune the similarity threshold
+	CacheSimilarity = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_cache_similarity",
+			Help:    "The similarity of the most similar entry found by semantic cache lookups, hit or not, by model",
+			Buckets: []float64{0, 0.5, 0.6, 0.7, 0.75, 0.8, 0.85, 0.9, 0.925, 0.95, 0.975, 0.99, 1},
+		},
+		[]string{"model"},
+	)
 
-// RecordModelTokensDetailed records detailed token usage (prompt and completion)
-func RecordModelTokensDetailed(model string, promptTokens, completionTokens float64) {
-	// Record in both the aggregated and detailed metrics
-	totalTokens := promptTokens + completionTokens
-	ModelTokens.WithLabelValues(model).Add(totalTokens)
-	ModelPromptTokens.WithLabelValues(model).Add(promptTokens)
-	ModelCompletionTokens.WithLabelValues(model).Add(completionTokens)
-}
+	// RoutingScore tracks the classifier confidence or utterance similarity of
+	// the best category of routed queries, to tune the category thresholds
+	RoutingScore = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_routing_score",
+			Help:    "The classifier confidence (classifier) or utterance similarity (similarity) of the best matching category of routed queries, above its threshold or not, by strategy and category",
+			Buckets: []float64{0, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.75, 0.8, 0.85, 0.9, 0.95, 0.99, 1},
+		},
+		[]string{"strategy", "category"},
+	)
 
-// RecordModelCompletionLatency records the latency of a model completion
-func RecordModelCompletionLatency(model string, seconds float64) {
-	ModelCompletionLatency.WithLabelValues(model).Observe(seconds)
-}
+	// RoutingFeedback tracks the feedback posted by downstream systems on
+	// routed requests
+	RoutingFeedback = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_routing_feedback_total",
+			Help: "The number of feedback reports on routed requests, by kind (misrouted, stale_cache or correct) and whether the request was still tracked (accepted) or not (unknown_request)",
+		},
+		[]string{"kind", "outcome"},
+	)
 
-// RecordModelRoutingLatency records the latency of model routing
-func RecordModelRoutingLatency(seconds float64) {
-	ModelRoutingLatency.Observe(seconds)
-}
+	// CategoryThresholdDrift tracks how far feedback has moved each
+	// category's routing threshold from its configured one
+	CategoryThresholdDrift = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_category_threshold_drift",
+			Help: "The adjustment made by routing feedback to the classifier confidence or utterance similarity threshold of each category, positive when raised",
+		},
+		[]string{"category"},
+	)
+
+	// ProcessingPhaseLatency tracks the time the router takes to answer each
+	// message of a stream
+	ProcessingPhaseLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_processing_phase_latency_seconds",
+			Help:    "The time the router takes to answer an ext_proc message in seconds, by phase (request_headers, request_body, response_headers, response_body and trailers)",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+		},
+		[]string{"phase"},
+	)
+
+	// CacheLookupLatency tracks the latency of cache lookups by model
+	CacheLookupLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_cache_lookup_latency_seconds",
+			Help:    "The latency of semantic cache lookups in seconds, including embedding the query, by model",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		},
+		[]string{"model"},
+	)
+
+	// CachePrefilterSkips tracks cache lookups skipped as certain misses
+	CachePrefilterSkips = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llm_cache_prefilter_skips_total",
+			Help: "The number of cache lookups the pre-filter skipped, predicting no similar entry",
+		},
+	)
+
+	// CacheWritesDropped tracks completed entries dropped because the write queue was full
+	CacheWritesDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llm_cache_writes_dropped_total",
+			Help: "The number of completed cache entries dropped because the cache write queue was full",
+		},
+	)
+
+	// RequestStateExpired tracks cross-stream request state expired by the janitor
+	RequestStateExpired = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_request_state_expired_total",
+			Help: "The number of entries of request state kept across streams that expired, by kind",
+		},
+		[]string{"kind"},
+	)
+
+	// EmbeddingCacheHits tracks embeddings found memoized
+	EmbeddingCacheHits = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llm_embedding_cache_hits_total",
+			Help: "The total number of text embeddings found memoized instead of computed",
+		},
+	)
+
+	// RequestEmbeddingsReused tracks embeddings reused within a request
+	RequestEmbeddingsReused = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llm_request_embeddings_reused_total",
+			Help: "The total number of embeddings computed for a request by one stage and reused by another, e.g. the cache lookup's by utterance routing",
+		},
+	)
+
+	// EmbeddingCacheMisses tracks embeddings computed
+	EmbeddingCacheMisses = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llm_embedding_cache_misses_total",
+			Help: "The total number of text embeddings computed for lack of a memoized one",
+		},
+	)
+
+	// CacheNormalizationComparisons tracks cache lookups of normalized and raw queries
+	CacheNormalizationComparisons = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cache_normalization_comparisons_total",
+			Help: "The total number of cache lookups compared with and without query normalization, by whether the normalized and the raw query hit",
+		},
+		[]string{"normalized", "raw"},
+	)
+
+	// RemoteEmbeddingRequests tracks the requests to the remote embedding provider
+	RemoteEmbeddingRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_remote_embedding_requests_total",
+			Help: "The total number of requests to the remote embedding endpoint by outcome: success, error, or circuit_open when failed fast",
+		},
+		[]string{"outcome"},
+	)
+
+	// RemoteEmbeddingLatency tracks the latency of remote embedding requests
+	RemoteEmbeddingLatency = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "llm_remote_embedding_latency_seconds",
+			Help:    "The latency of requests to the remote embedding endpoint in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		},
+	)
+
+	// RemoteEmbeddingBatchSize tracks the texts embedded per remote request
+	RemoteEmbeddingBatchSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "llm_remote_embedding_batch_size",
+			Help:    "The number of texts embedded per request to the remote embedding endpoint",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+		},
+	)
+
+	// CacheWriteQueueLength tracks the completed entries waiting to be stored
+	CacheWriteQueueLength = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_cache_write_queue_length",
+			Help: "The number of completed cache entries waiting to be embedded and stored",
+		},
+	)
+
+	// CacheEntries tracks the completed entries of the in-memory cache backend by model
+	CacheEntries = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_cache_entries",
+			Help: "The number of completed entries in the in-memory semantic cache by model",
+		},
+		[]string{"model"},
+	)
+
+	// CachePendingEntries tracks the cache entries waiting for their response
+	CachePendingEntries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_cache_pending_entries",
+			Help: "The number of semantic cache entries waiting for the response to their request",
+		},
+	)
+
+	// CacheMemoryBytes tracks the estimated memory of the in-memory cache entries
+	CacheMemoryBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_cache_memory_bytes",
+			Help: "The estimated memory taken by the entries of the in-memory semantic cache",
+		},
+	)
+
+	// CacheEvictions tracks entries removed from the in-memory cache by reason
+	CacheEvictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cache_evictions_total",
+			Help: "The number of entries removed from the in-memory semantic cache by reason (expired, max_entries, max_memory or epoch)",
+		},
+		[]string{"reason"},
+	)
+
+	// CacheSnapshots tracks snapshots of the semantic cache saved to and
+	// loaded from disk
+	CacheSnapshots = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cache_snapshots_total",
+			Help: "The number of semantic cache snapshots by operation (save or load) and result",
+		},
+		[]string{"operation", "result"},
+	)
+
+	// CacheSnapshotEntries tracks the entries of the last snapshot saved or loaded
+	CacheSnapshotEntries = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_cache_snapshot_entries",
+			Help: "The number of entries in the last semantic cache snapshot saved or loaded, by operation",
+		},
+		[]string{"operation"},
+	)
+
+	// AutoscaleSignals tracks scale-up webhook calls by model and outcome
+	AutoscaleSignals = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_autoscale_signals_total",
+			Help: "The total number of scale-up signals sent for each LLM model backend",
+		},
+		[]string{"model", "status"},
+	)
+
+	// EndpointRequests tracks requests sent to each model endpoint by locality
+	EndpointRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_endpoint_requests_total",
+			Help: "The total number of requests routed to each model endpoint, labeled by locality",
+		},
+		[]string{"model", "endpoint", "locality"},
+	)
+
+	// EndpointHealthy tracks the passive health state of each model endpoint
+	EndpointHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_endpoint_healthy",
+			Help: "Whether a model endpoint is considered healthy (1) or not (0)",
+		},
+		[]string{"model", "endpoint", "locality"},
+	)
+
+	// TrafficSplitRequests tracks requests assigned to a variant of a category's traffic split
+	TrafficSplitRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_traffic_split_requests_total",
+			Help: "The total number of completed requests of a category with a traffic split, by the group and model they were routed to",
+		},
+		[]string{"category", "group", "model"},
+	)
+
+	// TrafficSplitTokens tracks the tokens of each variant of a category's traffic split
+	TrafficSplitTokens = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_traffic_split_tokens_total",
+			Help: "The total number of prompt and completion tokens of requests of a category with a traffic split, by group and model",
+		},
+		[]string{"category", "group", "model", "type"},
+	)
+
+	// TrafficSplitLatency tracks the completion latency of each variant of a category's traffic split
+	TrafficSplitLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_traffic_split_completion_latency_seconds",
+			Help:    "The completion latency of requests of a category with a traffic split, by group and model",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"category", "group", "model"},
+	)
+
+	// EndpointLoad tracks the load score of each model endpoint from its polled metrics
+	EndpointLoad = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_endpoint_load_score",
+			Help: "The load score of a model endpoint from its latest polled metrics, weighing queued and running requests and KV-cache usage",
+		},
+		[]string{"model", "endpoint"},
+	)
+
+	// EndpointLoadPollFailures tracks failed polls of the metrics of model endpoints
+	EndpointLoadPollFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_endpoint_load_poll_failures_total",
+			Help: "The total number of failed polls of the load metrics of model endpoints",
+		},
+		[]string{"model", "endpoint"},
+	)
+
+	// LoadAwareSelections tracks requests routed to a less loaded model of their category
+	LoadAwareSelections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_load_aware_selections_total",
+			Help: "The total number of requests routed to a less loaded model of their category than the one semantic routing chose",
+		},
+		[]string{"from_model", "to_model"},
+	)
+
+	// PrefixAffinitySelections tracks endpoint selections driven by a cached prompt prefix
+	PrefixAffinitySelections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_endpoint_prefix_affinity_selections_total",
+			Help: "The total number of endpoint selections that matched a recently served prompt prefix",
+		},
+		[]string{"model"},
+	)
+
+	// RequestRetries tracks retried attempts of requests already seen by the router
+	RequestRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_request_retries_total",
+			Help: "The total number of retried request attempts detected for each LLM model",
+		},
+		[]string{"model"},
+	)
+
+	// PipelineStageEnabled tracks the runtime flag state of each pipeline stage
+	PipelineStageEnabled = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_pipeline_stage_enabled",
+			Help: "Whether a router pipeline stage is enabled (1) or disabled (0) at runtime",
+		},
+		[]string{"stage"},
+	)
+
+	// StageErrors tracks failures of the pipeline stages with an error budget
+	StageErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_stage_errors_total",
+			Help: "The number of failures of a pipeline stage, e.g. classifier or cache backend errors",
+		},
+		[]string{"stage"},
+	)
+
+	// StageAutoDisabled tracks the stages disabled for exceeding their error budget
+	StageAutoDisabled = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_stage_auto_disabled",
+			Help: "Whether a pipeline stage is disabled (1) for exceeding its error budget",
+		},
+		[]string{"stage"},
+	)
+
+	// StageAutoDisables tracks how often each stage exceeded its error budget
+	StageAutoDisables = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_stage_auto_disables_total",
+			Help: "The number of times a pipeline stage was disabled for exceeding its error budget",
+		},
+		[]string{"stage"},
+	)
+
+	// StageCohortRequests tracks requests inside (treated) and outside (control) a stage's gradual rollout
+	StageCohortRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_stage_cohort_requests_total",
+			Help: "The total number of requests in the treated and control cohorts of a pipeline stage rollout",
+		},
+		[]string{"stage", "cohort"},
+	)
+
+	// StageCohortErrors tracks failed requests per cohort of a stage rollout
+	StageCohortErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_stage_cohort_errors_total",
+			Help: "The total number of failed requests in the treated and control cohorts of a pipeline stage rollout",
+		},
+		[]string{"stage", "cohort"},
+	)
+
+	// StageCohortLatency tracks end-to-end request latency per cohort of a stage rollout
+	StageCohortLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_stage_cohort_latency_seconds",
+			Help:    "End-to-end request latency in seconds in the treated and control cohorts of a pipeline stage rollout",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"stage", "cohort"},
+	)
+
+	// RoutingPolicyDecisions tracks requests subject to a geo or residency routing policy by outcome
+	RoutingPolicyDecisions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_routing_policy_decisions_total",
+			Help: "The total number of requests subject to a routing policy, by policy (geo, residency) and outcome (allowed, rerouted, denied)",
+		},
+		[]string{"policy", "outcome"},
+	)
+
+	// TokenEstimateRatio tracks upstream-reported prompt tokens relative to the pre-routing estimate
+	TokenEstimateRatio = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_token_estimate_ratio",
+			Help:    "Ratio of upstream-reported prompt tokens to the router's pre-routing estimate; drift away from 1 indicates a tokenizer mismatch",
+			Buckets: []float64{0.25, 0.5, 0.67, 0.8, 0.9, 1, 1.1, 1.25, 1.5, 2, 4},
+		},
+		[]string{"model"},
+	)
+
+	// RequestBodyBytes tracks the size of request bodies by the model they were routed to
+	RequestBodyBytes = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_request_body_bytes",
+			Help:    "The size of request bodies in bytes, by the model the request was routed to",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		},
+		[]string{"model"},
+	)
+
+	// ResponseBodyBytes tracks the size of response bodies by model
+	ResponseBodyBytes = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_response_body_bytes",
+			Help:    "The size of response bodies in bytes across all chunks, by the model that produced them",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		},
+		[]string{"model"},
+	)
+
+	// PassthroughRequests tracks requests to API endpoints that are not routed
+	PassthroughRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_passthrough_requests_total",
+			Help: "The total number of requests passed through without routing, by API endpoint (e.g. images/generations, audio/speech, batches) and upstream status code",
+		},
+		[]string{"endpoint", "status"},
+	)
+
+	// PassthroughRequestBodyBytes tracks the size of request bodies to API endpoints that are not routed
+	PassthroughRequestBodyBytes = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_passthrough_request_body_bytes",
+			Help:    "The size of request bodies in bytes of requests passed through without routing, by API endpoint",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 12),
+		},
+		[]string{"endpoint"},
+	)
+
+	// PassthroughResponseBodyBytes tracks the size of response bodies from API endpoints that are not routed
+	PassthroughResponseBodyBytes = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_passthrough_response_body_bytes",
+			Help:    "The size of response bodies in bytes of requests passed through without routing, by API endpoint",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 12),
+		},
+		[]string{"endpoint"},
+	)
+
+	// PassthroughLatency tracks the latency of requests to API endpoints that are not routed
+	PassthroughLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_passthrough_latency_seconds",
+			Help:    "Latency in seconds from request headers to the end of the response of requests passed through without routing, by API endpoint",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		},
+		[]string{"endpoint"},
+	)
+
+	// CategoryBlocked tracks requests answered with a block response
+	CategoryBlocked = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_category_blocked_total",
+			Help: "The number of requests answered with a block response because their category is blocked, by category",
+		},
+		[]string{"category"},
+	)
+
+	// PIIDetections tracks PII found in requests by type and the action taken
+	PIIDetections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_pii_detections_total",
+			Help: "The number of PII entities found in requests, by type and action (block, redact, tokenize, allow or error)",
+		},
+		[]string{"type", "action"},
+	)
+
+	// PromptGuardDetections tracks requests rejected as jailbreak or prompt injection attempts
+	PromptGuardDetections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_prompt_guard_detections_total",
+			Help: "The number of requests rejected by the prompt guard, by detected category such as jailbreak or injection",
+		},
+		[]string{"category"},
+	)
+
+	// DecisionBudgetDegraded tracks steps approximated to stay within the decision budget
+	DecisionBudgetDegraded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_decision_budget_degraded_total",
+			Help: "The number of requests where a pipeline step was skipped or approximated to stay within the decision latency budget",
+		},
+		[]string{"step"},
+	)
 
-// RecordCacheHit records a cache hit
-func RecordCacheHit() {
-	CacheHits.Inc()
+	// ToolResultRouting tracks how turns returning tool output were routed
+	ToolResultRouting = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tool_result_routing_total",
+			Help: "The number of requests returning tool output, by whether they went to the model that made the tool call (pinned) or were classified because the call was unknown (unknown_call) or its model is no longer allowed (disallowed)",
+		},
+		[]string{"outcome"},
+	)
+
+	// ContextLengthRouting tracks requests exceeding the context window of the model they were routed to
+	ContextLengthRouting = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_context_length_routing_total",
+			Help: "The number of requests exceeding the context window of the model they were routed to, by whether they were redirected to a model they fit (redirected) or no model was known to fit them (no_fit)",
+		},
+		[]string{"model", "outcome"},
+	)
+
+	// SessionRouting tracks how the classified turns of conversations were routed
+	SessionRouting = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_session_routing_total",
+			Help: "The number of classified requests of identified conversations, by whether they started a conversation (new), kept its model (sticky) or were confidently classified elsewhere (rerouted)",
+		},
+		[]string{"outcome"},
+	)
+
+	// MaxTokensCapped tracks requests whose generation limit was capped by their tenant's policy
+	MaxTokensCapped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_max_tokens_capped_total",
+			Help: "The number of requests whose max_tokens was lowered (lowered) or set (set, when the client sent none) to their tenant's cap",
+		},
+		[]string{"tenant", "action"},
+	)
+
+	// ParameterAdjustments tracks generation parameters changed for the model a request is forwarded to
+	ParameterAdjustments = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_parameter_adjustments_total",
+			Help: "The number of request parameters clamped to (clamped) or stripped for (stripped) the constraints of the model the request was forwarded to, or set (set), replaced (forced) or extended (appended) by its overrides",
+		},
+		[]string{"model", "parameter", "action"},
+	)
+
+	// ApplicationRequests tracks requests of applications recognized by their system prompt
+	ApplicationRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_application_requests_total",
+			Help: "The number of requests of applications recognized by their system prompt, by application and whether they were admitted (admitted) or over the application's quota (quota_exceeded)",
+		},
+		[]string{"application", "outcome"},
+	)
+
+	// TenantPolicyRequests tracks the requests of tenants with a routing policy
+	TenantPolicyRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tenant_policy_requests_total",
+			Help: "The number of requests of tenants with a routing policy, by tenant and whether they were admitted (admitted) or over the tenant's token budget (budget_exceeded)",
+		},
+		[]string{"tenant", "outcome"},
+	)
+
+	// BatchesPending tracks Batch API batches awaiting usage reconciliation
+	BatchesPending = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_batches_pending",
+			Help: "Number of Batch API batches created through this router replica whose usage has not been reconciled yet",
+		},
+	)
+
+	// BatchesReconciled tracks Batch API batches no longer awaiting reconciliation
+	BatchesReconciled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_batches_reconciled_total",
+			Help: "The number of Batch API batches reconciled, by outcome (their terminal status or abandoned when not reconciled within the maximum age)",
+		},
+		[]string{"outcome"},
+	)
+
+	// ResponseBufferTruncations tracks responses too large to buffer
+	ResponseBufferTruncations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_response_buffer_truncations_total",
+			Help: "The number of responses that exceeded the buffering limit and were passed through without caching, by model",
+		},
+		[]string{"model"},
+	)
+
+	// RequestBufferOverflows tracks streamed request bodies too large to reassemble
+	RequestBufferOverflows = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llm_request_buffer_overflows_total",
+			Help: "The number of request bodies streamed in chunks that exceeded the buffering limit and were passed through unprocessed",
+		},
+	)
+
+	// StreamLimitExceeded tracks streams passed through for exceeding a byte limit
+	StreamLimitExceeded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_stream_limit_exceeded_total",
+			Help: "The number of streams passed through unprocessed for exceeding a byte limit, by the phase that exceeded it and the limit (stream or server)",
+		},
+		[]string{"phase", "limit"},
+	)
+
+	// StreamBufferedBytes tracks the bytes buffered by all streams
+	StreamBufferedBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_stream_buffered_bytes",
+			Help: "The bytes of request headers, request bodies and response bodies currently buffered by all streams",
+		},
+	)
+
+	// ActiveStreams tracks the open ext_proc streams
+	ActiveStreams = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_active_streams",
+			Help: "The number of ext_proc streams currently open",
+		},
+	)
+
+	// ShutdownDrains tracks how draining streams on shutdown ended
+	ShutdownDrains = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_shutdown_drains_total",
+			Help: "The total number of shutdowns by outcome: drained when all streams finished in time, or timeout when open streams were closed",
+		},
+		[]string{"outcome"},
+	)
+
+	// TokenUsageUnreported tracks responses without usage from the upstream
+	TokenUsageUnreported = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_token_usage_unreported_total",
+			Help: "The total number of responses for which the upstream did not report prompt token usage",
+		},
+		[]string{"model"},
+	)
+
+	// CoordinatorSyncs tracks syncs with the fleet coordinator by result
+	CoordinatorSyncs = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_coordinator_syncs_total",
+			Help: "The total number of syncs with the fleet coordinator, by result (success, error)",
+		},
+		[]string{"result"},
+	)
+
+	// CoordinatorLiveReplicas tracks the number of live replicas reported by the coordinator
+	CoordinatorLiveReplicas = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_coordinator_live_replicas",
+			Help: "Number of router replicas live at the fleet coordinator as of the last successful sync",
+		},
+	)
+
+	// Leader tracks whether this replica holds the leader lease for singleton background jobs
+	Leader = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_leader",
+			Help: "Whether this router replica is the elected leader running singleton background jobs (1) or not (0)",
+		},
+	)
+
+	// ModelDownloads tracks attempts at fetching models into the local model cache
+	ModelDownloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_downloads_total",
+			Help: "The total number of attempts at fetching a model into the local model cache, by result (success or failure)",
+		},
+		[]string{"model", "result"},
+	)
+
+	// ModelDownloadedBytes tracks the bytes downloaded so far by the current download of a model
+	ModelDownloadedBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_model_downloaded_bytes",
+			Help: "Bytes of model files downloaded so far by the current or last download of a model",
+		},
+		[]string{"model"},
+	)
+
+	// ModelDownloadSize tracks the total size of the files the current download of a model fetches
+	ModelDownloadSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_model_download_size_bytes",
+			Help: "Total size of the model files fetched by the current or last download of a model",
+		},
+		[]string{"model"},
+	)
+
+	// ModelChecksumFailures tracks downloaded model files not matching their expected checksum
+	ModelChecksumFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_checksum_failures_total",
+			Help: "The total number of downloaded model files not matching their expected SHA-256",
+		},
+		[]string{"model"},
+	)
+
+	// HealthDegraded tracks which health dimensions of the router are degraded
+	HealthDegraded = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_health_degraded",
+			Help: "Whether a health dimension of the router is degraded (1) or healthy (0)",
+		},
+		[]string{"dimension"},
+	)
+
+	// SLOBreaches tracks requests slower than the latency SLO by the stage that took longest
+	SLOBreaches = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_slo_breaches_total",
+			Help: "The total number of requests exceeding the latency SLO, by the pipeline stage that dominated their latency",
+		},
+		[]string{"stage"},
+	)
+
+	// BuildInfo exposes the build version and config hash of this replica
+	BuildInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_build_info",
+			Help: "Always 1, labeled with the build version, config hash and routing hash of this router replica",
+		},
+		[]string{"version", "config_hash", "routing_hash"},
+	)
+
+	// CanarySuccess tracks whether the last run of a canary check succeeded
+	CanarySuccess = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_canary_success",
+			Help: "Whether the last run of a canary probe check succeeded (1) or failed (0)",
+		},
+		[]string{"probe", "check"},
+	)
+
+	// CanaryLatency tracks the duration of the last run of a canary check
+	CanaryLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_canary_latency_seconds",
+			Help: "Duration in seconds of the last run of a canary probe check",
+		},
+		[]string{"probe", "check"},
+	)
+
+	// CanaryLastRun tracks when a canary probe last ran, to alert on a stalled canary
+	CanaryLastRun = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_canary_last_run_timestamp_seconds",
+			Help: "Unix time of the last run of a canary probe",
+		},
+		[]string{"probe"},
+	)
+
+	// ConfigReloads tracks reloads of the config while the server runs
+	ConfigReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_config_reloads_total",
+			Help: "The number of config reloads, by result (success or failure)",
+		},
+		[]string{"result"},
+	)
+
+	// TLSCertificateReloads tracks reloads of the listeners' certificate files
+	TLSCertificateReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tls_certificate_reloads_total",
+			Help: "The number of reloads of the listeners' TLS certificate files, by result (success or failure)",
+		},
+		[]string{"result"},
+	)
+
+	// TLSCertificateExpiry tracks when the served certificate expires, to alert
+	// on a rotation that did not happen
+	TLSCertificateExpiry = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_tls_certificate_expiry_timestamp_seconds",
+			Help: "Unix time the listeners' TLS certificate expires",
+		},
+	)
+
+	// ComplianceArchive tracks exchanges of tenants under a compliance hold
+	// sent to the archive
+	ComplianceArchive = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_compliance_archive_total",
+			Help: "The number of exchanges of tenants under a compliance hold by tenant and outcome (archived, failed or dropped)",
+		},
+		[]string{"tenant", "outcome"},
+	)
+
+	// RegistrationAnnouncements tracks the announcements of the instance to
+	// the control plane
+	RegistrationAnnouncements = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_registration_announcements_total",
+			Help: "The number of announcements of the instance to the control plane by event (register, heartbeat or deregister) and result",
+		},
+		[]string{"event", "result"},
+	)
+
+	// InjectedFaults tracks the faults injected for resilience testing
+	InjectedFaults = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_injected_faults_total",
+			Help: "The number of faults injected for resilience testing by fault (classification_latency, cache_error or upstream_error)",
+		},
+		[]string{"fault"},
+	)
+
+	// UpstreamErrors tracks 429 and 5xx responses of each model's backend
+	UpstreamErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_upstream_errors_total",
+			Help: "The total number of 429 and 5xx upstream responses for each LLM model",
+		},
+		[]string{"model", "status"},
+	)
+
+	// UpstreamErrorTypes tracks error responses of each model's backend by the
+	// type of error they report
+	UpstreamErrorTypes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_upstream_error_types_total",
+			Help: "The total number of error responses for each LLM model by error type (context_length_exceeded, rate_limit, insufficient_quota, overloaded, authentication, permission, not_found, invalid_request, server or other)",
+		},
+		[]string{"model", "type"},
+	)
+
+	// ModelFallbacks tracks requests rerouted away from a model that failed an
+	// earlier attempt or whose circuit is open
+	ModelFallbacks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_fallbacks_total",
+			Help: "The total number of requests rerouted from an unavailable model to a fallback model, by reason",
+		},
+		[]string{"from_model", "to_model", "reason"},
+	)
+
+	// ModelSelections tracks requests a cost-aware selection policy routed to
+	// another model than their category's first ranked one
+	ModelSelections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_selections_total",
+			Help: "The total number of requests routed away from their category's first ranked model by the model selection policy",
+		},
+		[]string{"policy", "ranked_model", "selected_model"},
+	)
+
+	// EstimatedCost tracks the estimated cost of requests routed by a
+	// cost-aware selection policy, at the selected models' prices
+	EstimatedCost = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_estimated_cost_usd_total",
+			Help: "The estimated cost in USD of requests routed by a cost-aware selection policy, for each category",
+		},
+		[]string{"category"},
+	)
+
+	// EstimatedRankedCost tracks what the same requests would have cost at
+	// the prices of their category's first ranked model
+	EstimatedRankedCost = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_estimated_ranked_cost_usd_total",
+			Help: "The estimated cost in USD the same requests would have had with their category's first ranked model; the difference to llm_estimated_cost_usd_total is the savings",
+		},
+		[]string{"category"},
+	)
+
+	// CircuitState tracks the circuit breaker state of each destination model
+	CircuitState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_model_circuit_state",
+			Help: "The circuit breaker state of each LLM model: 0 closed, 1 half-open, 2 open",
+		},
+		[]string{"model"},
+	)
+
+	// CircuitOpens tracks how often the circuit of each destination model opened
+	CircuitOpens = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_circuit_opens_total",
+			Help: "The total number of times the circuit breaker of each LLM model opened",
+		},
+		[]string{"model"},
+	)
+
+	// TokenBudgetRejections tracks requests rejected for clients over a token budget
+	TokenBudgetRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_token_budget_rejections_total",
+			Help: "The total number of requests rejected because the client used up its hourly or daily token budget",
+		},
+		[]string{"period"},
+	)
+
+	// TokenBudgetCounterErrors tracks failures reading or updating token budget counters
+	TokenBudgetCounterErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llm_token_budget_counter_errors_total",
+			Help: "The total number of errors reading or updating token budget counters",
+		},
+	)
+
+	// TenantRequests tracks requests answered by a model per tenant
+	TenantRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tenant_requests_total",
+			Help: "The total number of requests answered by a model, by tenant",
+		},
+		[]string{"tenant"},
+	)
+
+	// TenantTokens tracks the tokens used by each tenant
+	TenantTokens = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tenant_tokens_total",
+			Help: "The total number of tokens used by tenant and type (prompt or completion)",
+		},
+		[]string{"tenant", "type"},
+	)
+
+	// RoutingOverrides tracks the routing override headers of clients
+	RoutingOverrides = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_routing_overrides_total",
+			Help: "The number of requests with a routing override header by override (bypass, model_pin or cache_bypass) and outcome (applied, ignored when not allowed, or rejected)",
+		},
+		[]string{"override", "outcome"},
+	)
+
+	// ShadowSuppressed tracks responses the router would have sent but did not
+	// apply because it runs in shadow mode
+	ShadowSuppressed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_shadow_suppressed_total",
+			Help: "The number of router responses not applied in shadow mode by stream phase and action (immediate_response or mutation)",
+		},
+		[]string{"phase", "action"},
+	)
+
+	// ModelDeprecations tracks requests for deprecated models by outcome
+	ModelDeprecations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_model_deprecation_total",
+			Help: "The number of requests routed to a deprecated model by outcome (served, shifted to the replacement, or rejected after the sunset)",
+		},
+		[]string{"model", "outcome"},
+	)
+
+	// TaggedRequests tracks requests answered by a model by request tag
+	TaggedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tagged_requests_total",
+			Help: "The total number of requests answered by a model by request tag, tag value and model",
+		},
+		[]string{"tag", "value", "model"},
+	)
+
+	// TaggedTokens tracks the tokens used by request tag
+	TaggedTokens = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tagged_tokens_total",
+			Help: "The total number of tokens used by request tag, tag value and type (prompt or completion)",
+		},
+		[]string{"tag", "value", "type"},
+	)
+
+	// TaggedCost tracks the estimated cost of requests by request tag
+	TaggedCost = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tagged_estimated_cost_usd_total",
+			Help: "The estimated cost in USD of requests answered by a model, at the models' configured prices, by request tag and tag value",
+		},
+		[]string{"tag", "value"},
+	)
+
+	// ConfigLastReload tracks when the config was last reloaded successfully
+	ConfigLastReload = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llm_config_last_reload_success_timestamp_seconds",
+			Help: "Unix time of the last successful config reload",
+		},
+	)
+)
+
+// RecordModelRequest increments the counter for requests to a specific model
+func RecordModelRequest(model string) {
+	ModelRequests.WithLabelValues(model).Inc()
+}
+
+// RecordModelRouting records that a request was routed from one model to another
+func RecordModelRouting(sourceModel, targetModel string) {
+	if sourceModel != targetModel {
+		ModelRoutingModifications.WithLabelValues(sourceModel, targetModel).Inc()
+	}
+}
+
+// routingTallies counts decisions and reroutes per category for CategoryReroutedRatio
+var routingTallies = struct {
+	sync.Mutex
+	total    map[string]float64
+	rerouted map[string]float64
+}{total: make(map[string]float64), rerouted: make(map[string]float64)}
+
+// RecordRoutingDecision records the model selected for a request in a category and
+// updates the share of the category's traffic that was rerouted
+func RecordRoutingDecision(sourceModel, targetModel, category string) {
+	if category == "" {
+		category = "unclassified"
+	}
+	RoutingDecisions.WithLabelValues(sourceModel, targetModel, category).Inc()
+
+	routingTallies.Lock()
+	defer routingTallies.Unlock()
+	routingTallies.total[category]++
+	if sourceModel != targetModel {
+		routingTallies.rerouted[category]++
+	}
+	CategoryReroutedRatio.WithLabelValues(category).Set(routingTallies.rerouted[category] / routingTallies.total[category])
+}
+
+// RecordModelTokens adds the number of tokens used by a specific model
+func RecordModelTokens(model string, tokens float64) {
+	ModelTokens.WithLabelValues(model).Add(tokens)
+}
+
+// RecordModelTokensDetailed records detailed token usage (prompt and completion)
+func RecordModelTokensDetailed(model string, promptTokens, completionTokens float64) {
+	// Record in both the aggregated and detailed metrics
+	totalTokens := promptTokens + completionTokens
+	ModelTokens.WithLabelValues(model).Add(totalTokens)
+	ModelPromptTokens.WithLabelValues(model).Add(promptTokens)
+	ModelCompletionTokens.WithLabelValues(model).Add(completionTokens)
+}
+
+// RecordModelCompletionLatency records the latency of a model completion
+func RecordModelCompletionLatency(model string, seconds float64) {
+	ModelCompletionLatency.WithLabelValues(model).Observe(seconds)
+}
+
+// RecordModelRoutingLatency records the latency of model routing
+func RecordModelRoutingLatency(seconds float64) {
+	ModelRoutingLatency.Observe(seconds)
+}
+
+// RecordRoutingScore records the score of the best matching category of a
+// routed query
+func RecordRoutingScore(strategy, category string, score float32) {
+	RoutingScore.WithLabelValues(strategy, category).Observe(float64(score))
+}
+
+// RecordRoutingFeedback records feedback posted on a routed request
+func RecordRoutingFeedback(kind, outcome string) {
+	RoutingFeedback.WithLabelValues(kind, outcome).Inc()
+}
+
+// SetCategoryThresholdDrift sets the adjustment feedback made to a category's
+// routing threshold
+func SetCategoryThresholdDrift(category string, drift float32) {
+	CategoryThresholdDrift.WithLabelValues(category).Set(float64(drift))
+}
+
+// RecordProcessingPhaseLatency records the time taken to answer a message of
+// a stream in the given phase
+func RecordProcessingPhaseLatency(phase string, seconds float64) {
+	ProcessingPhaseLatency.WithLabelValues(phase).Observe(seconds)
+}
+
+// RecordCacheLookup records the outcome and latency of a cache lookup for a model
+func RecordCacheLookup(model string, hit bool, err error, seconds float64) {
+	switch {
+	case err != nil:
+		CacheErrors.WithLabelValues(model).Inc()
+	case hit:
+		CacheHits.WithLabelValues(model).Inc()
+	default:
+		CacheMisses.WithLabelValues(model).Inc()
+	}
+	CacheLookupLatency.WithLabelValues(model).Observe(seconds)
+}
+
+// RecordCacheSimilarity records the similarity of the best match of a cache lookup
+func RecordCacheSimilarity(model string, similarity float32) {
+	CacheSimilarity.WithLabelValues(model).Observe(float64(similarity))
+}
+
+// RecordCacheWriteDropped records a completed entry dropped because the write queue was full
+func RecordCacheWriteDropped() {
+	CacheWritesDropped.Inc()
+}
+
+// RecordRequestStateExpired records entries of cross-stream request state that expired
+func RecordRequestStateExpired(kind string, count int) {
+	RequestStateExpired.WithLabelValues(kind).Add(float64(count))
+}
+
+// RecordEmbeddingCacheHit records an embedding found memoized
+func RecordEmbeddingCacheHit() {
+	EmbeddingCacheHits.Inc()
+}
+
+// RecordRequestEmbeddingReused records an embedding reused within a request
+func RecordRequestEmbeddingReused() {
+	RequestEmbeddingsReused.Inc()
+}
+
+// RecordEmbeddingCacheMiss records an embedding computed for lack of a memoized one
+func RecordEmbeddingCacheMiss() {
+	EmbeddingCacheMisses.Inc()
+}
+
+// RecordCacheNormalizationComparison records whether a cache lookup hit with
+// and without query normalization
+func RecordCacheNormalizationComparison(normalizedHit, rawHit bool) {
+	outcome := func(hit bool) string {
+		if hit {
+			return "hit"
+		}
+		return "miss"
+	}
+	CacheNormalizationComparisons.WithLabelValues(outcome(normalizedHit), outcome(rawHit)).Inc()
+}
+
+// RecordRemoteEmbeddingRequest records a request to the remote embedding
+// endpoint, its batch size and latency when it was sent
+func RecordRemoteEmbeddingRequest(outcome string, texts int, seconds float64) {
+	RemoteEmbeddingRequests.WithLabelValues(outcome).Inc()
+	if outcome != "circuit_open" {
+		RemoteEmbeddingBatchSize.Observe(float64(texts))
+		RemoteEmbeddingLatency.Observe(seconds)
+	}
+}
+
+// SetCacheWriteQueueLength sets the number of completed entries waiting to be stored
+func SetCacheWriteQueueLength(length int) {
+	CacheWriteQueueLength.Set(float64(length))
+}
+
+// SetCachePendingEntries sets the number of cache entries waiting for their response
+func SetCachePendingEntries(count int) {
+	CachePendingEntries.Set(float64(count))
+}
+
+// SetCacheSize sets the number of entries of the in-memory cache by model and
+// their estimated memory
+func SetCacheSize(entries map[string]int, bytes int64) {
+	for model, count := range entries {
+		CacheEntries.WithLabelValues(model).Set(float64(count))
+	}
+	CacheMemoryBytes.Set(float64(bytes))
+}
+
+// RecordCacheEvictions records entries removed from the in-memory cache
+func RecordCacheEvictions(reason string, count int) {
+	if count > 0 {
+		CacheEvictions.WithLabelValues(reason).Add(float64(count))
+	}
+}
+
+// RecordCacheSnapshot records a snapshot of the semantic cache saved or
+// loaded and the entries it held
+func RecordCacheSnapshot(operation string, entries int, err error) {
+	if err != nil {
+		CacheSnapshots.WithLabelValues(operation, "failure").Inc()
+		return
+	}
+	CacheSnapshots.WithLabelValues(operation, "success").Inc()
+	CacheSnapshotEntries.WithLabelValues(operation).Set(float64(entries))
+}
+
+// RecordCachePrefilterSkip records a cache lookup skipped by the pre-filter
+func RecordCachePrefilterSkip() {
+	CachePrefilterSkips.Inc()
+}
+
+// RecordAutoscaleSignal records a scale-up webhook call for a model
+func RecordAutoscaleSignal(model, status string) {
+	AutoscaleSignals.WithLabelValues(model, status).Inc()
+}
+
+// RecordEndpointSelection records that a request was routed to a model endpoint
+func RecordEndpointSelection(model, endpoint, locality string) {
+	EndpointRequests.WithLabelValues(model, endpoint, locality).Inc()
+}
+
+// RecordEndpointHealth records the health state of a model endpoint
+func RecordEndpointHealth(model, endpoint, locality string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	EndpointHealthy.WithLabelValues(model, endpoint, locality).Set(value)
+}
+
+// RecordPrefixAffinitySelection records an endpoint selection driven by prefix affinity
+func RecordPrefixAffinitySelection(model string) {
+	PrefixAffinitySelections.WithLabelValues(model).Inc()
+}
+
+// RecordTrafficSplit records a completed request of a variant of a category's traffic split
+func RecordTrafficSplit(category, group, model string, promptTokens, completionTokens, latencySeconds float64) {
+	TrafficSplitRequests.WithLabelValues(category, group, model).Inc()
+	TrafficSplitTokens.WithLabelValues(category, group, model, "prompt").Add(promptTokens)
+	TrafficSplitTokens.WithLabelValues(category, group, model, "completion").Add(completionTokens)
+	TrafficSplitLatency.WithLabelValues(category, group, model).Observe(latencySeconds)
+}
+
+// RecordEndpointLoad records the load score of a model endpoint
+func RecordEndpointLoad(model, endpoint string, score float64) {
+	EndpointLoad.WithLabelValues(model, endpoint).Set(score)
+}
+
+// RecordEndpointLoadPollFailure records a failed poll of a model endpoint's load metrics
+func RecordEndpointLoadPollFailure(model, endpoint string) {
+	EndpointLoadPollFailures.WithLabelValues(model, endpoint).Inc()
+}
+
+// RecordLoadAwareSelection records a request routed to a less loaded model
+func RecordLoadAwareSelection(fromModel, toModel string) {
+	LoadAwareSelections.WithLabelValues(fromModel, toModel).Inc()
+}
+
+// RecordPipelineStageEnabled records the runtime flag state of a pipeline stage
+func RecordPipelineStageEnabled(stage string, enabled bool) {
+	value := 0.0
+	if enabled {
+		value = 1.0
+	}
+	PipelineStageEnabled.WithLabelValues(stage).Set(value)
+}
+
+// RecordStageError records a failure of a pipeline stage
+func RecordStageError(stage string) {
+	StageErrors.WithLabelValues(stage).Inc()
+}
+
+// RecordStageAutoDisabled records a stage being disabled for exceeding its
+// error budget, or enabled again after the cool-down
+func RecordStageAutoDisabled(stage string, disabled bool) {
+	value := 0.0
+	if disabled {
+		value = 1.0
+		StageAutoDisables.WithLabelValues(stage).Inc()
+	}
+	StageAutoDisabled.WithLabelValues(stage).Set(value)
+}
+
+// RecordStageCohort records the outcome of a request in a cohort of a stage rollout
+func RecordStageCohort(stage, cohort string, seconds float64, failed bool) {
+	StageCohortRequests.WithLabelValues(stage, cohort).Inc()
+	StageCohortLatency.WithLabelValues(stage, cohort).Observe(seconds)
+	if failed {
+		StageCohortErrors.WithLabelValues(stage, cohort).Inc()
+	}
+}
+
+// RecordRequestRetry records a retried attempt of a request
+func RecordRequestRetry(model string) {
+	RequestRetries.WithLabelValues(model).Inc()
+}
+
+// RecordRoutingPolicyDecision records the outcome of a routing policy for a request
+func RecordRoutingPolicyDecision(policy, outcome string) {
+	RoutingPolicyDecisions.WithLabelValues(policy, outcome).Inc()
+}
+
+// RecordTokenEstimateRatio records reported prompt tokens relative to the pre-routing estimate
+func RecordTokenEstimateRatio(model string, ratio float64) {
+	TokenEstimateRatio.WithLabelValues(model).Observe(ratio)
+}
+
+// RecordTokenUsageUnreported records a response without reported usage
+func RecordTokenUsageUnreported(model string) {
+	TokenUsageUnreported.WithLabelValues(model).Inc()
+}
+
+// RecordRequestBodySize records the size of a request body routed to a model
+func RecordRequestBodySize(model string, bytes int) {
+	RequestBodyBytes.WithLabelValues(model).Observe(float64(bytes))
+}
+
+// RecordResponseBodySize records the size of a response body produced by a model
+func RecordResponseBodySize(model string, bytes int) {
+	ResponseBodyBytes.WithLabelValues(model).Observe(float64(bytes))
+}
+
+// RecordCategoryBlocked records a request blocked because of its category
+func RecordCategoryBlocked(category string) {
+	CategoryBlocked.WithLabelValues(category).Inc()
+}
+
+// RecordPIIDetection records a PII entity found in a request and the action
+// taken, or a failed scan with the error action
+func RecordPIIDetection(piiType, action string) {
+	PIIDetections.WithLabelValues(piiType, action).Inc()
+}
+
+// RecordPromptGuardDetection records a request rejected by the prompt guard
+func RecordPromptGuardDetection(category string) {
+	PromptGuardDetections.WithLabelValues(category).Inc()
+}
+
+// RecordDecisionBudgetDegraded records a step approximated to stay within the decision budget
+func RecordDecisionBudgetDegraded(step string) {
+	DecisionBudgetDegraded.WithLabelValues(step).Inc()
+}
+
+// RecordToolResultRouting records how a turn returning tool output was routed
+func RecordToolResultRouting(outcome string) {
+	ToolResultRouting.WithLabelValues(outcome).Inc()
+}
+
+// RecordContextLengthRouting records a request exceeding the context window of its model
+func RecordContextLengthRouting(model, outcome string) {
+	ContextLengthRouting.WithLabelValues(model, outcome).Inc()
+}
+
+// RecordSessionRouting records how a turn of a conversation was routed
+func RecordSessionRouting(outcome string) {
+	SessionRouting.WithLabelValues(outcome).Inc()
+}
+
+// RecordMaxTokensCapped records a request capped to its tenant's max_tokens
+func RecordMaxTokensCapped(tenant, action string) {
+	if label, ok := tenantLabel(tenant); ok {
+		MaxTokensCapped.WithLabelValues(label, action).Inc()
+	}
+}
+
+// RecordParameterAdjustment records a request parameter adjusted for a model's
+// constraints or overrides
+func RecordParameterAdjustment(model, parameter, action string) {
+	ParameterAdjustments.WithLabelValues(model, parameter, action).Inc()
+}
+
+// RecordApplicationRequest records a request of a recognized application
+func RecordApplicationRequest(application, outcome string) {
+	ApplicationRequests.WithLabelValues(application, outcome).Inc()
+}
+
+// RecordTenantPolicyRequest records a request of a tenant with a routing policy
+func RecordTenantPolicyRequest(tenant, outcome string) {
+	TenantPolicyRequests.WithLabelValues(tenant, outcome).Inc()
+}
+
+// RecordBatchesPending records the number of batches awaiting reconciliation
+func RecordBatchesPending(count int) {
+	BatchesPending.Set(float64(count))
+}
+
+// RecordBatchReconciled records a batch that is no longer awaiting reconciliation
+func RecordBatchReconciled(outcome string) {
+	BatchesReconciled.WithLabelValues(outcome).Inc()
+}
+
+// RecordPassthroughRequest records a completed request that passed through without routing
+func RecordPassthroughRequest(endpoint string, status int, requestBytes, responseBytes int, seconds float64) {
+	PassthroughRequests.WithLabelValues(endpoint, strconv.Itoa(status)).Inc()
+	PassthroughRequestBodyBytes.WithLabelValues(endpoint).Observe(float64(requestBytes))
+	PassthroughResponseBodyBytes.WithLabelValues(endpoint).Observe(float64(responseBytes))
+	PassthroughLatency.WithLabelValues(endpoint).Observe(seconds)
+}
+
+// RecordResponseBufferTruncation records a response that exceeded the buffering limit
+func RecordResponseBufferTruncation(model string) {
+	ResponseBufferTruncations.WithLabelValues(model).Inc()
+}
+
+// RecordRequestBufferOverflow records a streamed request body that exceeded the buffering limit
+func RecordRequestBufferOverflow() {
+	RequestBufferOverflows.Inc()
+}
+
+// RecordStreamLimitExceeded records a stream passed through for exceeding a byte limit
+func RecordStreamLimitExceeded(phase, limit string) {
+	StreamLimitExceeded.WithLabelValues(phase, limit).Inc()
+}
+
+// SetStreamBufferedBytes sets the bytes buffered by all streams
+func SetStreamBufferedBytes(bytes int64) {
+	StreamBufferedBytes.Set(float64(bytes))
+}
+
+// SetActiveStreams sets the number of open ext_proc streams
+func SetActiveStreams(streams int64) {
+	ActiveStreams.Set(float64(streams))
+}
+
+// RecordShutdownDrain records how draining streams on shutdown ended
+func RecordShutdownDrain(drained bool) {
+	outcome := "drained"
+	if !drained {
+		outcome = "timeout"
+	}
+	ShutdownDrains.WithLabelValues(outcome).Inc()
+}
+
+// RecordCanaryCheck records the outcome of a canary probe check
+func RecordCanaryCheck(probe, check string, success bool, seconds float64) {
+	value := 0.0
+	if success {
+		value = 1.0
+	}
+	CanarySuccess.WithLabelValues(probe, check).Set(value)
+	CanaryLatency.WithLabelValues(probe, check).Set(seconds)
+}
+
+// RecordCanaryRun records that a canary probe ran
+func RecordCanaryRun(probe string) {
+	CanaryLastRun.WithLabelValues(probe).SetToCurrentTime()
+}
+
+// RecordCoordinatorSync records a sync with the fleet coordinator
+func RecordCoordinatorSync(success bool, liveReplicas int) {
+	if !success {
+		CoordinatorSyncs.WithLabelValues("error").Inc()
+		return
+	}
+	CoordinatorSyncs.WithLabelValues("success").Inc()
+	CoordinatorLiveReplicas.Set(float64(liveReplicas))
+}
+
+// RecordLeader records whether this replica is the elected leader
+func RecordLeader(leader bool) {
+	value := 0.0
+	if leader {
+		value = 1.0
+	}
+	Leader.Set(value)
+}
+
+// RecordModelDownload records an attempt at fetching a model
+func RecordModelDownload(model string, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	ModelDownloads.WithLabelValues(model, result).Inc()
+}
+
+// RecordModelDownloadProgress records the progress of a model download
+func RecordModelDownloadProgress(model string, downloaded, total int64) {
+	ModelDownloadedBytes.WithLabelValues(model).Set(float64(downloaded))
+	ModelDownloadSize.WithLabelValues(model).Set(float64(total))
+}
+
+// RecordModelChecksumFailure records a downloaded model file with an unexpected checksum
+func RecordModelChecksumFailure(model string) {
+	ModelChecksumFailures.WithLabelValues(model).Inc()
+}
+
+// RecordHealth records whether a health dimension is healthy
+func RecordHealth(dimension string, healthy bool) {
+	value := 1.0
+	if healthy {
+		value = 0.0
+	}
+	HealthDegraded.WithLabelValues(dimension).Set(value)
+}
+
+// RecordSLOBreach records a request exceeding the latency SLO
+func RecordSLOBreach(stage string) {
+	SLOBreaches.WithLabelValues(stage).Inc()
+}
+
+// RecordBuildInfo records the build version and config hashes of this
+// replica, replacing those of a config it reloaded
+func RecordBuildInfo(version, configHash, routingHash string) {
+	BuildInfo.Reset()
+	BuildInfo.WithLabelValues(version, configHash, routingHash).Set(1)
+}
+
+// RecordTLSCertificateReload records a reload of the listeners' certificate
+// files, and when the loaded certificate expires if it succeeded
+func RecordTLSCertificateReload(success bool, notAfter time.Time) {
+	if !success {
+		TLSCertificateReloads.WithLabelValues("failure").Inc()
+		return
+	}
+	TLSCertificateReloads.WithLabelValues("success").Inc()
+	TLSCertificateExpiry.Set(float64(notAfter.Unix()))
+}
+
+// RecordComplianceArchive records the outcome of archiving an exchange of a
+// tenant under a compliance hold
+func RecordComplianceArchive(tenant, outcome string) {
+	if label, ok := tenantLabel(tenant); ok {
+		ComplianceArchive.WithLabelValues(label, outcome).Inc()
+	}
+}
+
+// RecordRegistrationAnnouncement records an announcement of the instance to
+// the control plane and whether it was accepted
+func RecordRegistrationAnnouncement(event string, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	RegistrationAnnouncements.WithLabelValues(event, result).Inc()
+}
+
+// RecordInjectedFault records a fault injected for resilience testing
+func RecordInjectedFault(fault string) {
+	InjectedFaults.WithLabelValues(fault).Inc()
+}
+
+// RecordUpstreamError records a 429 or 5xx response of a model's backend
+func RecordUpstreamError(model string, status int) {
+	UpstreamErrors.WithLabelValues(model, strconv.Itoa(status)).Inc()
+}
+
+// RecordUpstreamErrorType records an error response of a model's backend by
+// its error type
+func RecordUpstreamErrorType(model, errorType string) {
+	UpstreamErrorTypes.WithLabelValues(model, errorType).Inc()
+}
+
+// RecordModelFallback records a request rerouted from an unavailable model
+func RecordModelFallback(fromModel, toModel, reason string) {
+	ModelFallbacks.WithLabelValues(fromModel, toModel, reason).Inc()
+}
+
+// RecordModelSelection records a request routed away from its category's first
+// ranked model by the model selection policy
+func RecordModelSelection(policy, rankedModel, selectedModel string) {
+	ModelSelections.WithLabelValues(policy, rankedModel, selectedModel).Inc()
+}
+
+// RecordEstimatedCost records the estimated cost of a request routed by a
+// cost-aware selection policy, and the cost with its first ranked model
+func RecordEstimatedCost(category string, cost, rankedCost float64) {
+	EstimatedCost.WithLabelValues(category).Add(cost)
+	EstimatedRankedCost.WithLabelValues(category).Add(rankedCost)
+}
+
+// RecordCircuitState records the circuit breaker state of a model: closed,
+// half_open or open
+func RecordCircuitState(model, state string) {
+	value := 0.0
+	switch state {
+	case "half_open":
+		value = 1
+	case "open":
+		value = 2
+	}
+	CircuitState.WithLabelValues(model).Set(value)
+}
+
+// RecordCircuitOpened records the circuit breaker of a model opening
+func RecordCircuitOpened(model string) {
+	CircuitOpens.WithLabelValues(model).Inc()
+}
+
+// RecordTokenBudgetRejection records a request rejected for a client over its
+// token budget of the given period
+func RecordTokenBudgetRejection(period string) {
+	TokenBudgetRejections.WithLabelValues(period).Inc()
+}
+
+// RecordTokenBudgetCounterError records a failure reading or updating a token budget counter
+func RecordTokenBudgetCounterError() {
+	TokenBudgetCounterErrors.Inc()
+}
+
+// tenantScope decides the tenant label metrics are reported under, keeping
+// their cardinality bounded when there are many tenants
+var tenantScope = struct {
+	sync.RWMutex
+	// Tenants reported under their own label, every tenant when nil
+	labeled map[string]bool
+	// Tenants left out of tenant-labeled metrics
+	excluded map[string]bool
+	// Label of the tenants not labeled individually
+	other string
+}{}
+
+// SetTenantLabels scopes the tenant label of metrics: the labeled tenants are
+// reported under their own name and the others together under other, or
+// every tenant under its own name when labeled is empty. Excluded tenants are
+// not reported in tenant-labeled metrics at all.
+func SetTenantLabels(labeled, excluded []string, other string) {
+	toSet := func(tenants []string) map[string]bool {
+		if len(tenants) == 0 {
+			return nil
+		}
+		set := make(map[string]bool, len(tenants))
+		for _, tenant := range tenants {
+			set[tenant] = true
+		}
+		return set
+	}
+	tenantScope.Lock()
+	defer tenantScope.Unlock()
+	tenantScope.labeled = toSet(labeled)
+	tenantScope.excluded = toSet(excluded)
+	tenantScope.other = other
+}
+
+// tenantLabel returns the label a tenant is reported under, false when it is excluded
+func tenantLabel(tenant string) (string, bool) {
+	tenantScope.RLock()
+	defer tenantScope.RUnlock()
+	if tenantScope.excluded[tenant] {
+		return "", false
+	}
+	if tenantScope.labeled == nil || tenantScope.labeled[tenant] {
+		return tenant, true
+	}
+	return tenantScope.other, true
+}
+
+// RecordTenantUsage records a request of a tenant answered by a model and the
+// tokens it used
+func RecordTenantUsage(tenant string, promptTokens, completionTokens float64) {
+	label, ok := tenantLabel(tenant)
+	if !ok {
+		return
+	}
+	TenantRequests.WithLabelValues(label).Inc()
+	TenantTokens.WithLabelValues(label, "prompt").Add(promptTokens)
+	TenantTokens.WithLabelValues(label, "completion").Add(completionTokens)
+}
+
+// RecordRoutingOverride records a routing override header of a request and its outcome
+func RecordRoutingOverride(override, outcome string) {
+	RoutingOverrides.WithLabelValues(override, outcome).Inc()
+}
+
+// RecordShadowSuppressed records a response not applied in shadow mode
+func RecordShadowSuppressed(phase, action string) {
+	ShadowSuppressed.WithLabelValues(phase, action).Inc()
+}
+
+// RecordModelDeprecation records a request routed to a deprecated model and its outcome
+func RecordModelDeprecation(model, outcome string) {
+	ModelDeprecations.WithLabelValues(model, outcome).Inc()
+}
+
+// RecordTaggedUsage records a request answered by a model under each of its
+// tags, with the tokens it used and their estimated cost
+func RecordTaggedUsage(tags map[string]string, model string, promptTokens, completionTokens, cost float64) {
+	for tag, value := range tags {
+		TaggedRequests.WithLabelValues(tag, value, model).Inc()
+		TaggedTokens.WithLabelValues(tag, value, "prompt").Add(promptTokens)
+		TaggedTokens.WithLabelValues(tag, value, "completion").Add(completionTokens)
+		TaggedCost.WithLabelValues(tag, value).Add(cost)
+	}
+}
+
+// RecordConfigReload records a config reload and whether it succeeded
+func RecordConfigReload(success bool) {
+	if !success {
+		ConfigReloads.WithLabelValues("failure").Inc()
+		return
+	}
+	ConfigReloads.WithLabelValues("success").Inc()
+	ConfigLastReload.SetToCurrentTime()
 }
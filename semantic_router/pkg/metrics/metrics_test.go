@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordRoutingDecision(t *testing.T) {
+	RecordRoutingDecision("auto", "phi4", "math")
+	RecordRoutingDecision("auto", "phi4", "math")
+	RecordRoutingDecision("phi4", "phi4", "math")
+	RecordRoutingDecision("phi4", "phi4", "")
+
+	if got := testutil.ToFloat64(RoutingDecisions.WithLabelValues("auto", "phi4", "math")); got != 2 {
+		t.Errorf("auto->phi4 decisions = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(RoutingDecisions.WithLabelValues("phi4", "phi4", "unclassified")); got != 1 {
+		t.Errorf("unclassified decisions = %v, want 1", got)
+	}
+
+	tests := []struct {
+		category string
+		want     float64
+	}{
+		{"math", 2.0 / 3.0},
+		{"unclassified", 0},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(CategoryReroutedRatio.WithLabelValues(tt.category)); got != tt.want {
+			t.Errorf("rerouted ratio for %s = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestTenantLabels(t *testing.T) {
+	defer SetTenantLabels(nil, nil, "")
+
+	RecordTenantUsage("unscoped", 10, 5)
+	if got := testutil.ToFloat64(TenantRequests.WithLabelValues("unscoped")); got != 1 {
+		t.Errorf("unscoped tenant requests = %v, want 1 while every tenant is labeled", got)
+	}
+
+	SetTenantLabels([]string{"premium"}, []string{"probe"}, "other")
+	RecordTenantUsage("premium", 10, 5)
+	RecordTenantUsage("small-1", 3, 1)
+	RecordTenantUsage("small-2", 4, 2)
+	RecordTenantUsage("probe", 100, 100)
+	RecordMaxTokensCapped("small-1", "lowered")
+
+	for _, tt := range []struct {
+		tenant           string
+		requests, tokens float64
+	}{
+		{"premium", 1, 10},
+		{"other", 2, 7},
+		{"small-1", 0, 0},
+		{"probe", 0, 0},
+	} {
+		if got := testutil.ToFloat64(TenantRequests.WithLabelValues(tt.tenant)); got != tt.requests {
+			t.Errorf("%s requests = %v, want %v", tt.tenant, got, tt.requests)
+		}
+		if got := testutil.ToFloat64(TenantTokens.WithLabelValues(tt.tenant, "prompt")); got != tt.tokens {
+			t.Errorf("%s prompt tokens = %v, want %v", tt.tenant, got, tt.tokens)
+		}
+	}
+	if got := testutil.ToFloat64(MaxTokensCapped.WithLabelValues("other", "lowered")); got != 1 {
+		t.Errorf("capped requests of aggregated tenants = %v, want 1", got)
+	}
+}
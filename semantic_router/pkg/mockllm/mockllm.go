@@ -0,0 +1,294 @@
+// Package mockllm emulates an OpenAI chat completions server, streamed and not,
+// with usage, configurable latency and injected errors, so tests, load tests
+// and local development don't need a real model backend.
+package mockllm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers a request can override the server's behavior with, passed through
+// proxies like any other header
+const (
+	// Answer with this status and an OpenAI error body
+	StatusHeader = "x-mockllm-status"
+	// Wait this long, e.g. 250ms, before answering
+	LatencyHeader = "x-mockllm-latency"
+)
+
+// Options holds options for creating new mock servers
+type Options struct {
+	// Models served, listed by /v1/models; requests for others are answered
+	// with a 404. Any model is served when empty.
+	Models []string
+	// Time before a response starts
+	Latency time.Duration
+	// Random extra latency, up to this long
+	Jitter time.Duration
+	// Time between the chunks of streamed responses
+	ChunkInterval time.Duration
+	// Fraction of requests answered with ErrorStatus
+	ErrorRate float64
+	// Status of injected errors, default 503
+	ErrorStatus int
+	// Content of every answer; by default answers echo the last user message
+	// as "Answer to: <message>"
+	Response string
+	// Seed of the injected errors and jitter, random when 0
+	Seed uint64
+}
+
+// Request is a chat completion request the server received
+type Request struct {
+	Header http.Header
+	Model  string
+	Stream bool
+	Body   []byte
+}
+
+// Server is an http.Handler serving POST /v1/chat/completions and
+// GET /v1/models
+type Server struct {
+	options Options
+	mux     *http.ServeMux
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	requests []Request
+}
+
+// New creates a mock server
+func New(options Options) *Server {
+	if options.ErrorStatus == 0 {
+		options.ErrorStatus = http.StatusServiceUnavailable
+	}
+	seed := options.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	s := &Server{options: options, rand: rand.New(rand.NewPCG(seed, seed))}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	s.mux.HandleFunc("GET /v1/models", s.models)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Requests returns the chat completion requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// RequestsWithHeader returns the chat completion requests received with a
+// header value, e.g. an x-request-id
+func (s *Server) RequestsWithHeader(name, value string) []Request {
+	var matched []Request
+	for _, request := range s.Requests() {
+		if request.Header.Get(name) == value {
+			matched = append(matched, request)
+		}
+	}
+	return matched
+}
+
+// Reset forgets the requests received
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+type chatRequest struct {
+	Model    string `json:"model"`
+	Stream   bool   `json:"stream"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "failed to read the body")
+		return
+	}
+	var request chatRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body")
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Header: r.Header.Clone(), Model: request.Model, Stream: request.Stream, Body: body})
+	id := fmt.Sprintf("chatcmpl-mock-%d", len(s.requests))
+	latency := s.options.Latency
+	if s.options.Jitter > 0 {
+		latency += time.Duration(s.rand.Int64N(int64(s.options.Jitter)))
+	}
+	status := 0
+	if s.options.ErrorRate > 0 && s.rand.Float64() < s.options.ErrorRate {
+		status = s.options.ErrorStatus
+	}
+	s.mu.Unlock()
+
+	if value := r.Header.Get(LatencyHeader); value != "" {
+		if latency, err = time.ParseDuration(value); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid "+LatencyHeader)
+			return
+		}
+	}
+	if value := r.Header.Get(StatusHeader); value != "" {
+		if status, err = strconv.Atoi(value); err != nil || status < 100 || status > 599 {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid "+StatusHeader)
+			return
+		}
+	}
+	if !sleep(r, latency) {
+		return
+	}
+	if status != 0 && status != http.StatusOK {
+		writeError(w, status, errorType(status), "injected error")
+		return
+	}
+	if len(s.options.Models) > 0 && !slices.Contains(s.options.Models, request.Model) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("the model %q does not exist", request.Model))
+		return
+	}
+
+	var prompt []string
+	answer := s.options.Response
+	for _, message := range request.Messages {
+		prompt = append(prompt, message.Content)
+		if message.Role == "user" && s.options.Response == "" {
+			answer = "Answer to: " + message.Content
+		}
+	}
+	tokens := usage{PromptTokens: countTokens(strings.Join(prompt, " ")), CompletionTokens: countTokens(answer)}
+	tokens.TotalTokens = tokens.PromptTokens + tokens.CompletionTokens
+
+	if request.Stream {
+		s.stream(w, r, id, request, answer, tokens)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   request.Model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": answer},
+			"finish_reason": "stop",
+		}},
+		"usage": tokens,
+	})
+}
+
+// stream answers with server-sent events, the content a word per chunk and
+// the usage in a last chunk when the request asks for it
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, id string, request chatRequest, answer string, tokens usage) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	created := time.Now().Unix()
+	send := func(choices []map[string]any, usage *usage) {
+		chunk := map[string]any{"id": id, "object": "chat.completion.chunk", "created": created, "model": request.Model, "choices": choices}
+		if usage != nil {
+			chunk["usage"] = usage
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send([]map[string]any{{"index": 0, "delta": map[string]string{"role": "assistant"}}}, nil)
+	words := strings.SplitAfter(answer, " ")
+	for _, word := range words {
+		if !sleep(r, s.options.ChunkInterval) {
+			return
+		}
+		send([]map[string]any{{"index": 0, "delta": map[string]string{"content": word}}}, nil)
+	}
+	send([]map[string]any{{"index": 0, "delta": map[string]string{}, "finish_reason": "stop"}}, nil)
+	if request.StreamOptions.IncludeUsage {
+		send([]map[string]any{}, &tokens)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (s *Server) models(w http.ResponseWriter, r *http.Request) {
+	data := make([]map[string]any, 0, len(s.options.Models))
+	for _, model := range s.options.Models {
+		data = append(data, map[string]any{"id": model, "object": "model", "created": 0, "owned_by": "mockllm"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
+
+// sleep waits unless the request is canceled first, reporting whether it waited
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// countTokens approximates the tokens of a text by its words
+func countTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+// errorType returns the OpenAI error type of a status
+func errorType(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status >= 500:
+		return "server_error"
+	}
+	return "invalid_request_error"
+}
+
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]any{"type": errorType, "message": message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
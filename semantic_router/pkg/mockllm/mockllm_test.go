@@ -0,0 +1,139 @@
+package mockllm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, server *httptest.Server, body string, headers ...string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func TestChatCompletion(t *testing.T) {
+	mock := New(Options{})
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	resp, body := post(t, server, `{"model":"m1","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"What is two plus two?"}]}`, "x-request-id", "r1")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	var completion struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct{ Content string } `json:"message"`
+		} `json:"choices"`
+		Usage usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		t.Fatal(err)
+	}
+	if completion.Model != "m1" || completion.Choices[0].Message.Content != "Answer to: What is two plus two?" {
+		t.Errorf("unexpected completion: %s", body)
+	}
+	if completion.Usage != (usage{PromptTokens: 7, CompletionTokens: 7, TotalTokens: 14}) {
+		t.Errorf("usage = %+v", completion.Usage)
+	}
+	if requests := mock.RequestsWithHeader("x-request-id", "r1"); len(requests) != 1 || requests[0].Model != "m1" {
+		t.Errorf("recorded requests = %+v", requests)
+	}
+}
+
+func TestStreamedChatCompletion(t *testing.T) {
+	server := httptest.NewServer(New(Options{Response: "one two three"}))
+	defer server.Close()
+
+	resp, body := post(t, server, `{"model":"m1","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"count"}]}`)
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("content type %q", resp.Header.Get("Content-Type"))
+	}
+	var content strings.Builder
+	var tokens *usage
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	if events[len(events)-1] != "data: [DONE]" {
+		t.Fatalf("stream does not end with [DONE]:\n%s", body)
+	}
+	for _, event := range events[:len(events)-1] {
+		var chunk struct {
+			Choices []struct {
+				Delta struct{ Content string } `json:"delta"`
+			} `json:"choices"`
+			Usage *usage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk); err != nil {
+			t.Fatalf("bad event %q: %v", event, err)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+		if chunk.Usage != nil {
+			tokens = chunk.Usage
+		}
+	}
+	if content.String() != "one two three" {
+		t.Errorf("streamed content %q", content.String())
+	}
+	if tokens == nil || tokens.CompletionTokens != 3 {
+		t.Errorf("streamed usage %+v", tokens)
+	}
+}
+
+func TestInjectedErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    Options
+		headers    []string
+		model      string
+		wantStatus int
+	}{
+		{"always failing", Options{ErrorRate: 1}, nil, "m1", http.StatusServiceUnavailable},
+		{"custom status", Options{ErrorRate: 1, ErrorStatus: http.StatusTooManyRequests}, nil, "m1", http.StatusTooManyRequests},
+		{"status header", Options{}, []string{StatusHeader, "500"}, "m1", http.StatusInternalServerError},
+		{"status header succeeds", Options{ErrorRate: 1}, []string{StatusHeader, "200"}, "m1", http.StatusOK},
+		{"unknown model", Options{Models: []string{"m1"}}, nil, "m2", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(New(tt.options))
+			defer server.Close()
+			resp, body := post(t, server, `{"model":"`+tt.model+`","messages":[{"role":"user","content":"hi"}]}`, tt.headers...)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	server := httptest.NewServer(New(Options{Latency: time.Hour}))
+	defer server.Close()
+
+	start := time.Now()
+	resp, body := post(t, server, `{"model":"m1","messages":[]}`, LatencyHeader, "20ms")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Minute {
+		t.Errorf("answered after %s, want 20ms", elapsed)
+	}
+}
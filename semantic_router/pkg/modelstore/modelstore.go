@@ -0,0 +1,525 @@
+package modelstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// DefaultEndpoint is the Hugging Face Hub used when none is configured
+const DefaultEndpoint = "https://huggingface.co"
+
+// DefaultFiles are the patterns of the repository files downloaded when none
+// are configured: the configs, tokenizer and safetensors weights the candle
+// loader reads, including those of sentence-transformers modules
+var DefaultFiles = []string{"*.json", "*.txt", "*.safetensors", "*/*.json", "*/*.safetensors"}
+
+// manifestFile lists the verified checksums of a downloaded revision
+const manifestFile = ".manifest.json"
+
+// commitPattern matches a full commit hash, which pins a revision
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Options holds options for creating a new model store
+type Options struct {
+	// Directory models are downloaded into
+	CacheDir string
+	// Base URL of the Hugging Face Hub, defaults to DefaultEndpoint
+	Endpoint string
+	// Access token for gated or private models, optional
+	Token string
+	// Patterns of the repository files to download, defaults to DefaultFiles
+	Files []string
+	// Download attempts per model before giving up
+	MaxAttempts int
+	// Wait before the first retry, doubled after every failed attempt
+	RetryInterval time.Duration
+	// HTTP client used for downloads
+	HTTPClient *http.Client
+	// Credentials for OCI registries, anonymous access when empty
+	RegistryUsername string
+	RegistryPassword string
+	// OCI registries served over plain HTTP, e.g. registry.local:5000
+	PlainHTTPRegistries []string
+}
+
+// Sources a model is fetched from
+const (
+	// Hugging Face Hub repository, or a local directory if one exists at the ID
+	SourceHub = "hub"
+	// Local directory only, never falling back to the hub
+	SourceLocal = "local"
+	// OCI registry artifact pushed with ORAS, one layer per file or directory
+	SourceOCI = "oci"
+)
+
+// Model is a model to fetch
+type Model struct {
+	// Config key of the model, e.g. classifier, used in metrics and health
+	Name string
+	// Source of the model, defaults to SourceHub
+	Source string
+	// Hub repository, e.g. sentence-transformers/all-MiniLM-L12-v2, local
+	// directory, or OCI reference, e.g. registry.example.com/models/classifier:v1
+	ID string
+	// Hub branch, tag or commit; a full commit hash pins the model and lets it
+	// load from the cache without contacting the hub. Defaults to main. OCI
+	// models are pinned with a digest reference instead.
+	Revision string
+	// Expected SHA-256 of files by path in the repository, verified in
+	// addition to the checksums the hub reports for large files
+	Checksums map[string]string
+}
+
+// Progress describes the download of a model
+type Progress struct {
+	Model    string `json:"model"`
+	Revision string `json:"revision,omitempty"`
+	// Bytes downloaded so far out of the total size of the missing files
+	DownloadedBytes int64 `json:"downloaded_bytes"`
+	TotalBytes      int64 `json:"total_bytes"`
+	Done            bool  `json:"done"`
+	// Error of the last failed attempt
+	Error string `json:"error,omitempty"`
+}
+
+// Store downloads models from the Hugging Face Hub or OCI registries into a
+// local cache and verifies their checksums, so the router loads reproducible
+// model files
+type Store struct {
+	options Options
+
+	mu       sync.Mutex
+	progress map[string]*Progress
+	// Authorization header per OCI repository, from the last auth challenge
+	registryAuth map[string]string
+}
+
+// New creates a new model store with the given options
+func New(options Options) (*Store, error) {
+	if options.CacheDir == "" {
+		return nil, fmt.Errorf("cache directory is required")
+	}
+	if options.Endpoint == "" {
+		options.Endpoint = DefaultEndpoint
+	}
+	options.Endpoint = strings.TrimSuffix(options.Endpoint, "/")
+	if len(options.Files) == 0 {
+		options.Files = DefaultFiles
+	}
+	for _, pattern := range options.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 5
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = 2 * time.Second
+	}
+	if options.HTTPClient == nil {
+		// No overall timeout, model weights take a while to download
+		options.HTTPClient = &http.Client{}
+	}
+	return &Store{
+		options:      options,
+		progress:     make(map[string]*Progress),
+		registryAuth: make(map[string]string),
+	}, nil
+}
+
+// Fetch returns the local directory of a model, downloading and verifying it
+// first unless a verified copy is cached. Hub model IDs that are existing local
+// paths are returned as they are. Failed downloads are retried with backoff.
+// A nil store leaves hub models to the model loader and cannot fetch OCI models.
+func (s *Store) Fetch(ctx context.Context, model Model) (string, error) {
+	switch model.Source {
+	case SourceLocal:
+		if _, err := os.Stat(model.ID); err != nil {
+			return "", fmt.Errorf("local model %s: %w", model.Name, err)
+		}
+		return model.ID, nil
+	case SourceOCI:
+		if s == nil {
+			return "", fmt.Errorf("%s model from an OCI registry requires model_download", model.Name)
+		}
+	case SourceHub, "":
+		if _, err := os.Stat(model.ID); err == nil || s == nil {
+			return model.ID, nil
+		}
+		if model.Revision == "" {
+			model.Revision = "main"
+		}
+	default:
+		return "", fmt.Errorf("unknown source %q of %s model", model.Source, model.Name)
+	}
+
+	interval := s.options.RetryInterval
+	var err error
+	for attempt := 1; attempt <= s.options.MaxAttempts; attempt++ {
+		var dir string
+		if model.Source == SourceOCI {
+			dir, err = s.fetchOCI(ctx, model)
+		} else {
+			dir, err = s.fetchHub(ctx, model)
+		}
+		if err == nil {
+			metrics.RecordModelDownload(model.Name, true)
+			s.update(model, func(p *Progress) { p.Done, p.Error = true, "" })
+			return dir, nil
+		}
+		metrics.RecordModelDownload(model.Name, false)
+		s.update(model, func(p *Progress) { p.Error = err.Error() })
+		if attempt == s.options.MaxAttempts {
+			break
+		}
+		log.Printf("Error fetching model %s (attempt %d/%d), retrying in %s: %v", model.ID, attempt, s.options.MaxAttempts, interval, err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+	return "", fmt.Errorf("failed to fetch model %s after %d attempts: %w", model.ID, s.options.MaxAttempts, err)
+}
+
+// Progress returns the download progress of every model fetched so far
+func (s *Store) Progress() []Progress {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	progress := make([]Progress, 0, len(s.progress))
+	for _, p := range s.progress {
+		progress = append(progress, *p)
+	}
+	sort.Slice(progress, func(i, j int) bool { return progress[i].Model < progress[j].Model })
+	return progress
+}
+
+// Health reports whether every model fetched so far is downloaded and, if not,
+// the progress or error of the others. A nil store is always healthy.
+func (s *Store) Health() (bool, string) {
+	var pending []string
+	for _, p := range s.Progress() {
+		switch {
+		case p.Done:
+		case p.Error != "":
+			pending = append(pending, fmt.Sprintf("%s failed: %s", p.Model, p.Error))
+		default:
+			pending = append(pending, fmt.Sprintf("%s downloading %d/%d bytes", p.Model, p.DownloadedBytes, p.TotalBytes))
+		}
+	}
+	return len(pending) == 0, strings.Join(pending, "; ")
+}
+
+func (s *Store) update(model Model, f func(p *Progress)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.progress[model.Name]
+	if !ok {
+		p = &Progress{Model: model.Name}
+		s.progress[model.Name] = p
+	}
+	f(p)
+}
+
+// repoFile is a file of a hub repository as listed by the model API
+type repoFile struct {
+	Path string `json:"rfilename"`
+	Size int64  `json:"size"`
+	LFS  *struct {
+		SHA256 string `json:"sha256"`
+	} `json:"lfs"`
+}
+
+// repoInfo is the subset of the hub model API response used here
+type repoInfo struct {
+	Commit string     `json:"sha"`
+	Files  []repoFile `json:"siblings"`
+}
+
+// fetchHub makes one attempt at fetching a hub model
+func (s *Store) fetchHub(ctx context.Context, model Model) (string, error) {
+	repoDir := filepath.Join(s.options.CacheDir, strings.ReplaceAll(model.ID, "/", "--"))
+
+	// A pinned revision that was already verified loads without the hub
+	if commitPattern.MatchString(model.Revision) {
+		dir := filepath.Join(repoDir, model.Revision)
+		if err := verify(dir, model.Checksums); err == nil {
+			return dir, nil
+		}
+	}
+
+	info, err := s.repoInfo(ctx, model)
+	if err != nil {
+		// Fall back to the commit the revision last resolved to
+		if commit, refErr := os.ReadFile(filepath.Join(repoDir, "refs", url.PathEscape(model.Revision))); refErr == nil {
+			dir := filepath.Join(repoDir, strings.TrimSpace(string(commit)))
+			if verify(dir, model.Checksums) == nil {
+				log.Printf("Hub unreachable, using cached model %s at %s: %v", model.ID, filepath.Base(dir), err)
+				return dir, nil
+			}
+		}
+		return "", err
+	}
+	if !commitPattern.MatchString(info.Commit) {
+		return "", fmt.Errorf("hub returned invalid commit %q", info.Commit)
+	}
+	dir := filepath.Join(repoDir, info.Commit)
+	s.update(model, func(p *Progress) { p.Revision = info.Commit })
+
+	manifest := readManifest(dir)
+	var missing []repoFile
+	var total int64
+	for _, file := range info.Files {
+		if !s.wanted(file.Path) {
+			continue
+		}
+		expected := expectedSum(model, file)
+		// Re-download files that are missing or no longer match
+		if sum, ok := manifest[file.Path]; ok && (expected == "" || sum == expected) && fileMatches(filepath.Join(dir, file.Path), sum) {
+			continue
+		}
+		delete(manifest, file.Path)
+		missing = append(missing, file)
+		total += file.Size
+	}
+	for name := range model.Checksums {
+		if !listed(info.Files, name) || !s.wanted(name) {
+			return "", fmt.Errorf("checksum configured for %s, which is not downloaded", name)
+		}
+	}
+
+	if len(missing) > 0 {
+		log.Printf("Downloading %d files (%d bytes) of model %s at %s", len(missing), total, model.ID, info.Commit)
+	}
+	var downloaded int64
+	s.update(model, func(p *Progress) { p.DownloadedBytes, p.TotalBytes, p.Done = 0, total, false })
+	metrics.RecordModelDownloadProgress(model.Name, 0, total)
+	for _, file := range missing {
+		expected := expectedSum(model, file)
+		sum, err := s.download(ctx, model, info.Commit, file.Path, filepath.Join(dir, file.Path), func(n int64) {
+			downloaded += n
+			s.update(model, func(p *Progress) { p.DownloadedBytes = downloaded })
+			metrics.RecordModelDownloadProgress(model.Name, downloaded, total)
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to download %s: %w", file.Path, err)
+		}
+		if expected != "" && sum != expected {
+			metrics.RecordModelChecksumFailure(model.Name)
+			return "", fmt.Errorf("checksum mismatch for %s: got %s, want %s", file.Path, sum, expected)
+		}
+		manifest[file.Path] = sum
+		// Record progress so an interrupted download resumes with the next file
+		if err := writeManifest(dir, manifest); err != nil {
+			return "", err
+		}
+	}
+	if err := writeManifest(dir, manifest); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Join(repoDir, "refs"), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "refs", url.PathEscape(model.Revision)), []byte(info.Commit), 0o644); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// wanted returns whether a repository file matches the download patterns
+func (s *Store) wanted(name string) bool {
+	for _, pattern := range s.options.Files {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) repoInfo(ctx context.Context, model Model) (*repoInfo, error) {
+	u := fmt.Sprintf("%s/api/models/%s/revision/%s?blobs=true", s.options.Endpoint, model.ID, url.PathEscape(model.Revision))
+	resp, err := s.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var info repoInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("invalid model info: %w", err)
+	}
+	return &info, nil
+}
+
+// download writes a repository file to dest and returns its SHA-256
+func (s *Store) download(ctx context.Context, model Model, commit, name, dest string, progress func(n int64)) (string, error) {
+	resp, err := s.get(ctx, fmt.Sprintf("%s/%s/resolve/%s/%s", s.options.Endpoint, model.ID, commit, name))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return save(resp.Body, dest, progress)
+}
+
+// save writes r to dest through a temporary file and returns its SHA-256,
+// reporting the bytes read as they arrive
+func save(r io.Reader, dest string, progress func(n int64)) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), &progressReader{r: r, progress: progress})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *Store) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.options.Token)
+	}
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+	return resp, nil
+}
+
+// progressReader reports the bytes read through it
+type progressReader struct {
+	r        io.Reader
+	progress func(n int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.progress(int64(n))
+	}
+	return n, err
+}
+
+// expectedSum returns the configured checksum of a file, or the one the hub
+// reports for large files, empty if neither is known
+func expectedSum(model Model, file repoFile) string {
+	if sum, ok := model.Checksums[file.Path]; ok {
+		return sum
+	}
+	if file.LFS != nil {
+		return file.LFS.SHA256
+	}
+	return ""
+}
+
+func listed(files []repoFile, name string) bool {
+	for _, file := range files {
+		if file.Path == name {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks every file in the manifest of a downloaded revision against
+// its recorded checksum and the configured ones
+func verify(dir string, checksums map[string]string) error {
+	manifest := readManifest(dir)
+	if len(manifest) == 0 {
+		return fmt.Errorf("no verified download in %s", dir)
+	}
+	for name, expected := range checksums {
+		if manifest[name] != expected {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+	for name, sum := range manifest {
+		// Directory entries map to the digest of the layer they were unpacked from
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if !fileMatches(filepath.Join(dir, name), sum) {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+	return nil
+}
+
+// fileMatches returns whether a file exists with the given SHA-256
+func fileMatches(name, sum string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(h.Sum(nil)) == sum
+}
+
+func readManifest(dir string) map[string]string {
+	manifest := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return manifest
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		log.Printf("Ignoring invalid model manifest in %s: %v", dir, err)
+		return make(map[string]string)
+	}
+	return manifest
+}
+
+func writeManifest(dir string, manifest map[string]string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFile), data, 0o644)
+}
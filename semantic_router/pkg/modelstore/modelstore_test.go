@@ -0,0 +1,190 @@
+package modelstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+func sha(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeHub serves a single model repository like the Hugging Face Hub
+type fakeHub struct {
+	files map[string]string
+	// Files served with different content than listed, simulating corruption
+	corrupt map[string]bool
+
+	mu        sync.Mutex
+	downloads map[string]int
+}
+
+func (h *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/models/org/model/revision/"):
+		info := map[string]interface{}{"sha": testCommit}
+		var siblings []map[string]interface{}
+		for name, content := range h.files {
+			sibling := map[string]interface{}{"rfilename": name, "size": len(content)}
+			if strings.HasSuffix(name, ".safetensors") {
+				sibling["lfs"] = map[string]string{"sha256": sha(content)}
+			}
+			siblings = append(siblings, sibling)
+		}
+		info["siblings"] = siblings
+		_ = json.NewEncoder(w).Encode(info)
+	case strings.HasPrefix(r.URL.Path, "/org/model/resolve/"+testCommit+"/"):
+		name := strings.TrimPrefix(r.URL.Path, "/org/model/resolve/"+testCommit+"/")
+		content, ok := h.files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		h.mu.Lock()
+		h.downloads[name]++
+		h.mu.Unlock()
+		if h.corrupt[name] {
+			content = "corrupted"
+		}
+		_, _ = w.Write([]byte(content))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeHub() *fakeHub {
+	return &fakeHub{
+		files: map[string]string{
+			"config.json":                     `{"hidden_size": 8}`,
+			"tokenizer.json":                  `{}`,
+			"model.safetensors":               "weights",
+			"1_Pooling/config.json":           `{}`,
+			"onnx/model.onnx":                 "unused",
+			"README.md":                       "unused",
+			"0_Transformer/sub/deep.json":     "too deep",
+			"0_Transformer/model.safetensors": "module weights",
+		},
+		corrupt:   make(map[string]bool),
+		downloads: make(map[string]int),
+	}
+}
+
+func newTestStore(t *testing.T, endpoint, cacheDir string) *Store {
+	t.Helper()
+	store, err := New(Options{CacheDir: cacheDir, Endpoint: endpoint, MaxAttempts: 2, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return store
+}
+
+func TestFetch(t *testing.T) {
+	hub := newFakeHub()
+	server := httptest.NewServer(hub)
+	defer server.Close()
+	cacheDir := t.TempDir()
+	store := newTestStore(t, server.URL, cacheDir)
+
+	dir, err := store.Fetch(context.Background(), Model{Name: "bert_model", ID: "org/model"})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if want := filepath.Join(cacheDir, "org--model", testCommit); dir != want {
+		t.Errorf("Fetch returned %s, want %s", dir, want)
+	}
+	for _, name := range []string{"config.json", "tokenizer.json", "model.safetensors", "1_Pooling/config.json", "0_Transformer/model.safetensors"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != hub.files[name] {
+			t.Errorf("%s not downloaded: %q, %v", name, data, err)
+		}
+	}
+	for _, name := range []string{"onnx/model.onnx", "README.md", "0_Transformer/sub/deep.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s downloaded, want it skipped", name)
+		}
+	}
+	if healthy, detail := store.Health(); !healthy {
+		t.Errorf("store unhealthy after download: %s", detail)
+	}
+
+	// Verified files are not downloaded again, corrupted ones are
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer.json"), []byte("tampered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Fetch(context.Background(), Model{Name: "bert_model", ID: "org/model"}); err != nil {
+		t.Fatalf("second Fetch: %v", err)
+	}
+	if hub.downloads["config.json"] != 1 || hub.downloads["tokenizer.json"] != 2 {
+		t.Errorf("downloads = %v, want only the tampered tokenizer downloaded again", hub.downloads)
+	}
+
+	// A pinned revision loads from the cache without the hub
+	server.Close()
+	pinned, err := store.Fetch(context.Background(), Model{Name: "bert_model", ID: "org/model", Revision: testCommit})
+	if err != nil || pinned != dir {
+		t.Errorf("pinned Fetch without hub = %s, %v, want %s", pinned, err, dir)
+	}
+	// So does a branch it resolved before
+	if cached, err := store.Fetch(context.Background(), Model{Name: "bert_model", ID: "org/model"}); err != nil || cached != dir {
+		t.Errorf("Fetch of main without hub = %s, %v, want %s", cached, err, dir)
+	}
+}
+
+func TestFetchVerifiesChecksums(t *testing.T) {
+	tests := []struct {
+		name      string
+		corrupt   string
+		checksums map[string]string
+		wantErr   string
+	}{
+		{name: "hub checksum", corrupt: "model.safetensors", wantErr: "checksum mismatch for model.safetensors"},
+		{name: "configured checksum", checksums: map[string]string{"config.json": sha("other")}, wantErr: "checksum mismatch for config.json"},
+		{name: "matching configured checksum", checksums: map[string]string{"config.json": sha(`{"hidden_size": 8}`)}},
+		{name: "checksum of skipped file", checksums: map[string]string{"README.md": sha("unused")}, wantErr: "not downloaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := newFakeHub()
+			if tt.corrupt != "" {
+				hub.corrupt[tt.corrupt] = true
+			}
+			server := httptest.NewServer(hub)
+			defer server.Close()
+			store := newTestStore(t, server.URL, t.TempDir())
+
+			_, err := store.Fetch(context.Background(), Model{Name: "classifier", ID: "org/model", Checksums: tt.checksums})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Fetch: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Fetch error = %v, want %q", err, tt.wantErr)
+			}
+			if healthy, detail := store.Health(); healthy || !strings.Contains(detail, "classifier failed") {
+				t.Errorf("Health() = %v, %q, want the failure reported", healthy, detail)
+			}
+		})
+	}
+}
+
+func TestFetchLocalPath(t *testing.T) {
+	store := newTestStore(t, "http://127.0.0.1:0", t.TempDir())
+	local := t.TempDir()
+	if dir, err := store.Fetch(context.Background(), Model{Name: "classifier", ID: local}); err != nil || dir != local {
+		t.Errorf("Fetch of local path = %s, %v, want %s", dir, err, local)
+	}
+}
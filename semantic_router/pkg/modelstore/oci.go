@@ -0,0 +1,513 @@
+package modelstore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Annotations ORAS sets on the layers of pushed files and directories
+const (
+	annotationTitle  = "org.opencontainers.image.title"
+	annotationUnpack = "io.deis.oras.content.unpack"
+)
+
+// errChecksumMismatch is returned for layers not matching their digest
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// manifestMediaTypes are the manifest formats accepted from registries
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociReference is a parsed artifact reference, host/repository[:tag|@digest]
+type ociReference struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseReference parses an OCI reference. The registry host is required, there
+// is no default registry in air-gapped environments.
+func parseReference(ref string) (ociReference, error) {
+	var r ociReference
+	host, rest, ok := strings.Cut(ref, "/")
+	if !ok || rest == "" || !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return r, fmt.Errorf("invalid OCI reference %q, expected registry/repository[:tag|@digest]", ref)
+	}
+	r.Host = host
+	if repository, digest, ok := strings.Cut(rest, "@"); ok {
+		if !strings.HasPrefix(digest, "sha256:") || !isHex(strings.TrimPrefix(digest, "sha256:"), 64) {
+			return r, fmt.Errorf("invalid digest in OCI reference %q", ref)
+		}
+		r.Repository, r.Digest = repository, digest
+	} else if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		r.Repository, r.Tag = rest[:i], rest[i+1:]
+	} else {
+		r.Repository, r.Tag = rest, "latest"
+	}
+	if r.Repository == "" || (r.Digest == "" && r.Tag == "") {
+		return r, fmt.Errorf("invalid OCI reference %q", ref)
+	}
+	return r, nil
+}
+
+// reference returns the tag or digest the manifest is fetched by
+func (r ociReference) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// isHex returns whether s is a hex string of the given length
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// ociDescriptor is a layer of an artifact manifest
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// ociManifest is the subset of an image manifest used here
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// fetchOCI makes one attempt at fetching a model pushed to an OCI registry
+// with ORAS. Every layer titled with a file name becomes a file of the model
+// directory; directory layers ORAS pushes as gzipped tarballs are unpacked.
+func (s *Store) fetchOCI(ctx context.Context, model Model) (string, error) {
+	ref, err := parseReference(model.ID)
+	if err != nil {
+		return "", err
+	}
+	repoDir := filepath.Join(s.options.CacheDir, "oci", strings.ReplaceAll(ref.Host, ":", "_"), strings.ReplaceAll(ref.Repository, "/", "--"))
+
+	// A digest reference that was already verified loads without the registry
+	if ref.Digest != "" {
+		dir := filepath.Join(repoDir, strings.TrimPrefix(ref.Digest, "sha256:"))
+		if verify(dir, model.Checksums) == nil {
+			return dir, nil
+		}
+	}
+
+	manifest, digest, err := s.ociManifest(ctx, ref)
+	if err != nil {
+		// Fall back to the digest the tag last resolved to
+		if ref.Tag != "" {
+			if cached, refErr := os.ReadFile(filepath.Join(repoDir, "refs", url.PathEscape(ref.Tag))); refErr == nil {
+				dir := filepath.Join(repoDir, strings.TrimSpace(string(cached)))
+				if verify(dir, model.Checksums) == nil {
+					log.Printf("Registry unreachable, using cached model %s at %s: %v", model.ID, filepath.Base(dir), err)
+					return dir, nil
+				}
+			}
+		}
+		return "", err
+	}
+	dir := filepath.Join(repoDir, strings.TrimPrefix(digest, "sha256:"))
+	s.update(model, func(p *Progress) { p.Revision = digest })
+
+	files := readManifest(dir)
+	var missing []ociDescriptor
+	var total int64
+	for _, layer := range manifest.Layers {
+		title := layer.Annotations[annotationTitle]
+		if title == "" {
+			continue
+		}
+		if !safePath(title) {
+			return "", fmt.Errorf("layer %s has unsafe title %q", layer.Digest, title)
+		}
+		if !strings.HasPrefix(layer.Digest, "sha256:") {
+			return "", fmt.Errorf("layer %s has an unsupported digest", title)
+		}
+		if s.layerCached(dir, files, layer) {
+			continue
+		}
+		missing = append(missing, layer)
+		total += layer.Size
+	}
+
+	if len(missing) > 0 {
+		log.Printf("Downloading %d layers (%d bytes) of model %s at %s", len(missing), total, model.ID, digest)
+	}
+	var downloaded int64
+	s.update(model, func(p *Progress) { p.DownloadedBytes, p.TotalBytes, p.Done = 0, total, false })
+	metrics.RecordModelDownloadProgress(model.Name, 0, total)
+	progress := func(n int64) {
+		downloaded += n
+		s.update(model, func(p *Progress) { p.DownloadedBytes = downloaded })
+		metrics.RecordModelDownloadProgress(model.Name, downloaded, total)
+	}
+	for _, layer := range missing {
+		if err := s.downloadLayer(ctx, ref, dir, layer, files, progress); err != nil {
+			if errors.Is(err, errChecksumMismatch) {
+				metrics.RecordModelChecksumFailure(model.Name)
+			}
+			return "", err
+		}
+		if err := writeManifest(dir, files); err != nil {
+			return "", err
+		}
+	}
+	for name, expected := range model.Checksums {
+		if files[name] != expected {
+			metrics.RecordModelChecksumFailure(model.Name)
+			return "", fmt.Errorf("checksum mismatch for %s: got %q, want %s", name, files[name], expected)
+		}
+	}
+	if err := writeManifest(dir, files); err != nil {
+		return "", err
+	}
+	if ref.Tag != "" {
+		if err := os.MkdirAll(filepath.Join(repoDir, "refs"), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(repoDir, "refs", url.PathEscape(ref.Tag)), []byte(filepath.Base(dir)), 0o644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// layerCached returns whether a layer was downloaded before and its files
+// still match. Directory layers are recorded under their title with a
+// trailing slash, mapped to the layer digest.
+func (s *Store) layerCached(dir string, files map[string]string, layer ociDescriptor) bool {
+	title := layer.Annotations[annotationTitle]
+	sum := strings.TrimPrefix(layer.Digest, "sha256:")
+	if layer.Annotations[annotationUnpack] != "true" {
+		return files[title] == sum && fileMatches(filepath.Join(dir, title), sum)
+	}
+	if files[title+"/"] != sum {
+		return false
+	}
+	for name, fileSum := range files {
+		if strings.HasPrefix(name, title+"/") && name != title+"/" && !fileMatches(filepath.Join(dir, name), fileSum) {
+			return false
+		}
+	}
+	return true
+}
+
+// downloadLayer downloads a layer into the model directory, verifying it
+// against its digest, and records its files
+func (s *Store) downloadLayer(ctx context.Context, ref ociReference, dir string, layer ociDescriptor, files map[string]string, progress func(n int64)) error {
+	title := layer.Annotations[annotationTitle]
+	want := strings.TrimPrefix(layer.Digest, "sha256:")
+	resp, err := s.registryGet(ctx, ref, "/blobs/"+layer.Digest, "")
+	if err != nil {
+		return fmt.Errorf("failed to download layer %s: %w", title, err)
+	}
+	defer resp.Body.Close()
+
+	if layer.Annotations[annotationUnpack] != "true" {
+		sum, err := save(resp.Body, filepath.Join(dir, title), progress)
+		if err != nil {
+			return fmt.Errorf("failed to download layer %s: %w", title, err)
+		}
+		if sum != want {
+			delete(files, title)
+			return fmt.Errorf("%w for %s: got %s, want %s", errChecksumMismatch, title, sum, want)
+		}
+		files[title] = sum
+		return nil
+	}
+
+	// Unpack a directory layer into a staging directory before replacing the old one
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(dir, ".unpack-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	h := sha256.New()
+	extracted, err := unpack(io.TeeReader(&progressReader{r: resp.Body, progress: progress}, h), staging)
+	if err != nil {
+		return fmt.Errorf("failed to unpack layer %s: %w", title, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != want {
+		return fmt.Errorf("%w for %s: got %s, want %s", errChecksumMismatch, title, sum, want)
+	}
+
+	// ORAS tarballs contain the directory itself
+	src := filepath.Join(staging, title)
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("layer %s does not contain directory %s", layer.Digest, title)
+	}
+	target := filepath.Join(dir, title)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, target); err != nil {
+		return err
+	}
+	for name := range files {
+		if strings.HasPrefix(name, title+"/") {
+			delete(files, name)
+		}
+	}
+	for name, sum := range extracted {
+		if strings.HasPrefix(name, title+"/") {
+			files[name] = sum
+		}
+	}
+	files[title+"/"] = want
+	return nil
+}
+
+// unpack extracts a gzipped tarball of regular files and directories into dir
+// and returns the SHA-256 of every file by its path
+func unpack(r io.Reader, dir string) (map[string]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	sums := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(header.Name)
+		if name == "." {
+			continue
+		}
+		if !safePath(name) {
+			return nil, fmt.Errorf("unsafe path %q in layer", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			sum, err := save(tr, target, func(int64) {})
+			if err != nil {
+				return nil, err
+			}
+			sums[name] = sum
+		default:
+			// Links could point outside the model directory
+			return nil, fmt.Errorf("unsupported entry %q of type %c in layer", header.Name, header.Typeflag)
+		}
+	}
+	// Drain the rest of the stream so the digest covers the whole layer
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// safePath returns whether a relative slash-separated path stays inside the
+// directory it is joined to
+func safePath(name string) bool {
+	if name == "" || name == "." || path.IsAbs(name) || strings.Contains(name, `\`) {
+		return false
+	}
+	return path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// ociManifest fetches the manifest of a reference and returns it with its digest
+func (s *Store) ociManifest(ctx context.Context, ref ociReference) (*ociManifest, string, error) {
+	resp, err := s.registryGet(ctx, ref, "/manifests/"+ref.reference(), strings.Join(manifestMediaTypes, ", "))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if ref.Digest != "" && digest != ref.Digest {
+		return nil, "", fmt.Errorf("manifest digest %s does not match reference %s", digest, ref.Digest)
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, "", fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &manifest, digest, nil
+}
+
+// registryGet requests a path under the repository from its registry,
+// answering bearer token and basic auth challenges
+func (s *Store) registryGet(ctx context.Context, ref ociReference, p, accept string) (*http.Response, error) {
+	scheme := "https"
+	for _, host := range s.options.PlainHTTPRegistries {
+		if host == ref.Host {
+			scheme = "http"
+		}
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s%s", scheme, ref.Host, ref.Repository, p)
+
+	do := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return s.options.HTTPClient.Do(req)
+	}
+
+	resp, err := do(s.registryAuthorization(ref))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err := s.authorize(ctx, ref, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate with registry %s: %w", ref.Host, err)
+		}
+		if resp, err = do(authorization); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+	return resp, nil
+}
+
+// registryAuthorization returns the authorization last obtained for a repository
+func (s *Store) registryAuthorization(ref ociReference) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.registryAuth[ref.Host+"/"+ref.Repository]
+}
+
+func (s *Store) setRegistryAuthorization(ref ociReference, authorization string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registryAuth[ref.Host+"/"+ref.Repository] = authorization
+}
+
+// authorize answers a registry's authentication challenge with the configured
+// credentials, anonymously if there are none
+func (s *Store) authorize(ctx context.Context, ref ociReference, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if s.options.RegistryUsername == "" {
+			return "", fmt.Errorf("registry requires credentials")
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(s.options.RegistryUsername, s.options.RegistryPassword)
+		authorization := req.Header.Get("Authorization")
+		s.setRegistryAuthorization(ref, authorization)
+		return authorization, nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported challenge %q", challenge)
+	}
+
+	values := parseChallenge(params)
+	realm, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return "", fmt.Errorf("invalid token realm %q", values["realm"])
+	}
+	query := realm.Query()
+	if service := values["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", ref.Repository))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if s.options.RegistryUsername != "" {
+		req.SetBasicAuth(s.options.RegistryUsername, s.options.RegistryPassword)
+	}
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d from token service", resp.StatusCode)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("token service returned no token")
+	}
+	authorization := "Bearer " + token.Token
+	s.setRegistryAuthorization(ref, authorization)
+	return authorization, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a
+// WWW-Authenticate challenge
+func parseChallenge(params string) map[string]string {
+	values := make(map[string]string)
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(params, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(params, `"`) {
+			value, params, _ = strings.Cut(params[1:], `"`)
+			params = strings.TrimPrefix(strings.TrimSpace(params), ",")
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	return values
+}
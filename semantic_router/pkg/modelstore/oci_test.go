@@ -0,0 +1,204 @@
+package modelstore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	tests := []struct {
+		ref     string
+		want    ociReference
+		wantErr bool
+	}{
+		{ref: "registry.example.com/models/classifier:v1", want: ociReference{Host: "registry.example.com", Repository: "models/classifier", Tag: "v1"}},
+		{ref: "registry.local:5000/classifier", want: ociReference{Host: "registry.local:5000", Repository: "classifier", Tag: "latest"}},
+		{ref: "localhost/models/classifier@" + digest, want: ociReference{Host: "localhost", Repository: "models/classifier", Digest: digest}},
+		{ref: "models/classifier:v1", wantErr: true},
+		{ref: "registry.example.com/classifier@sha256:abc", wantErr: true},
+		{ref: "registry.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseReference(tt.ref)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("parseReference(%q) = %+v, %v, want %+v (error %v)", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// fakeRegistry serves a single artifact pushed with ORAS behind token auth
+type fakeRegistry struct {
+	manifest []byte
+	blobs    map[string][]byte
+	pulls    map[string]int
+}
+
+func newFakeRegistry(t *testing.T, files map[string]string, dirs map[string]map[string]string) *fakeRegistry {
+	t.Helper()
+	r := &fakeRegistry{blobs: make(map[string][]byte), pulls: make(map[string]int)}
+	var layers []ociDescriptor
+	add := func(title string, data []byte, annotations map[string]string) {
+		digest := "sha256:" + sha(string(data))
+		r.blobs[digest] = data
+		annotations[annotationTitle] = title
+		layers = append(layers, ociDescriptor{MediaType: "application/octet-stream", Digest: digest, Size: int64(len(data)), Annotations: annotations})
+	}
+	for name, content := range files {
+		add(name, []byte(content), map[string]string{})
+	}
+	for dir, contents := range dirs {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		_ = tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0o755})
+		for name, content := range contents {
+			_ = tw.WriteHeader(&tar.Header{Name: dir + "/" + name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))})
+			_, _ = tw.Write([]byte(content))
+		}
+		_ = tw.Close()
+		_ = gz.Close()
+		add(dir, buf.Bytes(), map[string]string{annotationUnpack: "true"})
+	}
+	r.manifest, _ = json.Marshal(map[string]interface{}{"schemaVersion": 2, "layers": layers})
+	return r
+}
+
+func (r *fakeRegistry) digest() string {
+	return "sha256:" + sha(string(r.manifest))
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if req.URL.Query().Get("scope") != "repository:models/classifier:pull" {
+			http.Error(w, "bad scope", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+req.Host+`/token",service="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case req.URL.Path == "/v2/models/classifier/manifests/v1" || req.URL.Path == "/v2/models/classifier/manifests/"+r.digest():
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		_, _ = w.Write(r.manifest)
+	case strings.HasPrefix(req.URL.Path, "/v2/models/classifier/blobs/"):
+		digest := strings.TrimPrefix(req.URL.Path, "/v2/models/classifier/blobs/")
+		data, ok := r.blobs[digest]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		r.pulls[digest]++
+		_, _ = w.Write(data)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestFetchOCI(t *testing.T) {
+	registry := newFakeRegistry(t,
+		map[string]string{"config.json": `{"hidden_size": 8}`, "model.safetensors": "weights"},
+		map[string]map[string]string{"tokenizer": {"tokenizer.json": "{}", "vocab.txt": "a b c"}},
+	)
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	store, err := New(Options{CacheDir: t.TempDir(), PlainHTTPRegistries: []string{host}, MaxAttempts: 1})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	model := Model{Name: "classifier", Source: SourceOCI, ID: host + "/models/classifier:v1"}
+	dir, err := store.Fetch(context.Background(), model)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	want := map[string]string{
+		"config.json":              `{"hidden_size": 8}`,
+		"model.safetensors":        "weights",
+		"tokenizer/tokenizer.json": "{}",
+		"tokenizer/vocab.txt":      "a b c",
+	}
+	for name, content := range want {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, content)
+		}
+	}
+
+	// Unchanged layers are not pulled again, tampered ones are
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer", "vocab.txt"), []byte("tampered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Fetch(context.Background(), model); err != nil {
+		t.Fatalf("second Fetch: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "tokenizer", "vocab.txt")); string(data) != "a b c" {
+		t.Errorf("tampered file not restored: %q", data)
+	}
+	configDigest := "sha256:" + sha(`{"hidden_size": 8}`)
+	if registry.pulls[configDigest] != 1 {
+		t.Errorf("config.json pulled %d times, want once", registry.pulls[configDigest])
+	}
+
+	// Digest references and resolved tags load from the cache without the registry
+	server.Close()
+	pinned := Model{Name: "classifier", Source: SourceOCI, ID: host + "/models/classifier@" + registry.digest()}
+	if got, err := store.Fetch(context.Background(), pinned); err != nil || got != dir {
+		t.Errorf("pinned Fetch without registry = %s, %v, want %s", got, err, dir)
+	}
+	if got, err := store.Fetch(context.Background(), model); err != nil || got != dir {
+		t.Errorf("tag Fetch without registry = %s, %v, want %s", got, err, dir)
+	}
+}
+
+func TestUnpackRejectsUnsafePaths(t *testing.T) {
+	for _, header := range []*tar.Header{
+		{Name: "../escape", Typeflag: tar.TypeReg},
+		{Name: "/etc/passwd", Typeflag: tar.TypeReg},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+	} {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		_ = tw.WriteHeader(header)
+		_ = tw.Close()
+		_ = gz.Close()
+		if _, err := unpack(&buf, t.TempDir()); err == nil {
+			t.Errorf("unpack accepted entry %q", header.Name)
+		}
+	}
+}
+
+func TestFetchSources(t *testing.T) {
+	local := t.TempDir()
+	var store *Store
+	if dir, err := store.Fetch(context.Background(), Model{Name: "classifier", Source: SourceLocal, ID: local}); err != nil || dir != local {
+		t.Errorf("local Fetch = %s, %v, want %s", dir, err, local)
+	}
+	if _, err := store.Fetch(context.Background(), Model{Name: "classifier", Source: SourceLocal, ID: filepath.Join(local, "missing")}); err == nil {
+		t.Error("local Fetch of a missing directory succeeded")
+	}
+	if dir, err := store.Fetch(context.Background(), Model{Name: "bert_model", ID: "org/model"}); err != nil || dir != "org/model" {
+		t.Errorf("hub Fetch without store = %s, %v, want the ID for the model loader", dir, err)
+	}
+	if _, err := store.Fetch(context.Background(), Model{Name: "classifier", Source: SourceOCI, ID: "registry.example.com/classifier:v1"}); err == nil {
+		t.Error("OCI Fetch without store succeeded")
+	}
+	if _, err := store.Fetch(context.Background(), Model{Name: "classifier", Source: "s3", ID: "bucket/model"}); err == nil {
+		t.Error("Fetch from an unknown source succeeded")
+	}
+}
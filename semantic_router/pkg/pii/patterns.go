@@ -0,0 +1,97 @@
+package pii
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pattern detects a type of PII by regular expression
+type Pattern struct {
+	Type   string
+	regexp *regexp.Regexp
+	// Checks a match beyond its shape, e.g. a checksum; nil accepts every match
+	validate func(match string) bool
+}
+
+// builtinPattern is a pattern used for a type configured without a regex
+type builtinPattern struct {
+	expr     string
+	validate func(match string) bool
+}
+
+// builtinPatterns are the patterns of the types with a built-in one
+var builtinPatterns = map[string]builtinPattern{
+	"EMAIL":       {expr: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	"SSN":         {expr: `\b\d{3}-\d{2}-\d{4}\b`},
+	"CREDIT_CARD": {expr: `\b\d(?:[ -]?\d){12,18}\b`, validate: luhnValid},
+	"IP_ADDRESS":  {expr: `\b(?:\d{1,3}\.){3}\d{1,3}\b`, validate: func(match string) bool { return net.ParseIP(match) != nil }},
+}
+
+// BuiltinTypes returns the PII types with a built-in pattern, sorted
+func BuiltinTypes() []string {
+	types := make([]string, 0, len(builtinPatterns))
+	for piiType := range builtinPatterns {
+		types = append(types, piiType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewPattern creates a pattern detecting a type of PII with a regular
+// expression, the type's built-in one when expr is empty
+func NewPattern(piiType, expr string) (Pattern, error) {
+	piiType = strings.ToUpper(piiType)
+	if piiType == "" {
+		return Pattern{}, fmt.Errorf("pattern without a type")
+	}
+	var validate func(string) bool
+	if expr == "" {
+		builtin, ok := builtinPatterns[piiType]
+		if !ok {
+			return Pattern{}, fmt.Errorf("no built-in pattern for %s, expected a regex or one of %s",
+				piiType, strings.Join(BuiltinTypes(), ", "))
+		}
+		expr, validate = builtin.expr, builtin.validate
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("invalid regex for %s: %w", piiType, err)
+	}
+	return Pattern{Type: piiType, regexp: re, validate: validate}, nil
+}
+
+// find returns the entities of the pattern's type in a text
+func (p Pattern) find(text string) []Entity {
+	var entities []Entity
+	for _, match := range p.regexp.FindAllStringIndex(text, -1) {
+		if match[0] == match[1] || (p.validate != nil && !p.validate(text[match[0]:match[1]])) {
+			continue
+		}
+		entities = append(entities, Entity{Type: p.Type, Start: match[0], End: match[1], Confidence: 1})
+	}
+	return entities
+}
+
+// luhnValid reports whether the digits of a number pass the Luhn checksum of
+// payment card numbers
+func luhnValid(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits > 0 && sum%10 == 0
+}
@@ -0,0 +1,131 @@
+package pii
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustPattern(t *testing.T, piiType, expr string) Pattern {
+	t.Helper()
+	pattern, err := NewPattern(piiType, expr)
+	if err != nil {
+		t.Fatalf("NewPattern(%s, %q): %v", piiType, expr, err)
+	}
+	return pattern
+}
+
+func TestScanPatterns(t *testing.T) {
+	builtins := []Pattern{
+		mustPattern(t, "EMAIL", ""),
+		mustPattern(t, "SSN", ""),
+		mustPattern(t, "credit_card", ""),
+		mustPattern(t, "IP_ADDRESS", ""),
+	}
+	tests := []struct {
+		name           string
+		words          map[string]string
+		patterns       []Pattern
+		tenantPatterns map[string][]Pattern
+		tenant         string
+		text           string
+		wantText       string
+		wantTypes      []string
+	}{
+		{
+			name:      "patterns without a model",
+			patterns:  builtins,
+			text:      "Mail jane@example.com from 10.0.0.1, SSN 123-45-6789",
+			wantText:  "Mail [EMAIL] from [IP_ADDRESS], SSN [SSN]",
+			wantTypes: []string{"EMAIL", "IP_ADDRESS", "SSN"},
+		},
+		{
+			name:      "card numbers checked",
+			patterns:  builtins,
+			text:      "Charge 4111 1111 1111 1111, not 4111 1111 1111 1112 or 999.1.1.1",
+			wantText:  "Charge [CREDIT_CARD], not 4111 1111 1111 1112 or 999.1.1.1",
+			wantTypes: []string{"CREDIT_CARD"},
+		},
+		{
+			name:      "model and pattern finding the same entity",
+			words:     map[string]string{"jane@example.com": "EMAIL"},
+			patterns:  builtins,
+			text:      "Mail jane@example.com",
+			wantText:  "Mail [EMAIL]",
+			wantTypes: []string{"EMAIL"},
+		},
+		{
+			name:      "model and patterns combined",
+			words:     map[string]string{"Jane Doe": "PERSON"},
+			patterns:  builtins,
+			text:      "Jane Doe, jane@example.com",
+			wantText:  "[PERSON], [EMAIL]",
+			wantTypes: []string{"PERSON", "EMAIL"},
+		},
+		{
+			name:      "overlapping entities redacted together",
+			words:     map[string]string{"ID 123-45": "ACCOUNT"},
+			patterns:  builtins,
+			text:      "ID 123-45-6789 on file",
+			wantText:  "[ACCOUNT] on file",
+			wantTypes: []string{"ACCOUNT", "SSN"},
+		},
+		{
+			name:           "tenant pattern",
+			tenantPatterns: map[string][]Pattern{"acme": {mustPattern(t, "EMPLOYEE_ID", `\bEMP-\d{6}\b`)}},
+			tenant:         "acme",
+			text:           "Look up EMP-123456",
+			wantText:       "Look up [EMPLOYEE_ID]",
+			wantTypes:      []string{"EMPLOYEE_ID"},
+		},
+		{
+			name:           "other tenant's pattern",
+			tenantPatterns: map[string][]Pattern{"acme": {mustPattern(t, "EMPLOYEE_ID", `\bEMP-\d{6}\b`)}},
+			tenant:         "globex",
+			text:           "Look up EMP-123456",
+			wantText:       "Look up EMP-123456",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options{Patterns: tt.patterns, TenantPatterns: tt.tenantPatterns}
+			if tt.words != nil {
+				options.ClassifyTokens = fakeTokenClassifier(tt.words)
+			}
+			d, err := New(options)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			scan, err := d.Scan(tt.text, tt.tenant, nil)
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if scan.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", scan.Text, tt.wantText)
+			}
+			var types []string
+			for _, entity := range scan.Entities {
+				types = append(types, entity.Type)
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("entity types = %v, want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestNewPattern(t *testing.T) {
+	for _, tt := range []struct {
+		piiType, expr string
+	}{
+		{"", `\d+`},
+		{"BADGE", ""},
+		{"BADGE", `(`},
+	} {
+		if _, err := NewPattern(tt.piiType, tt.expr); err == nil {
+			t.Errorf("NewPattern(%q, %q) succeeded", tt.piiType, tt.expr)
+		}
+	}
+	if _, err := New(Options{}); err == nil {
+		t.Error("New succeeded without a classifier or patterns")
+	}
+}
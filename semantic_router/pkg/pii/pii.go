@@ -0,0 +1,255 @@
+package pii
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+)
+
+// Action is what is done with a request containing a type of PII
+type Action string
+
+const (
+	// ActionBlock rejects the request
+	ActionBlock Action = "block"
+	// ActionRedact replaces the PII with a placeholder naming its type
+	ActionRedact Action = "redact"
+	// ActionTokenize replaces the PII with a numbered placeholder, e.g.
+	// <EMAIL_1>, that the response can be detokenized from
+	ActionTokenize Action = "tokenize"
+	// ActionAllow lets the PII through
+	ActionAllow Action = "allow"
+)
+
+// Options holds options for creating a new PII detector
+type Options struct {
+	// Labels the tokens of a text, tokens outside any entity omitted; nil to
+	// detect PII with patterns only
+	ClassifyTokens func(text string) ([]candle_binding.TokenLabel, error)
+	// Patterns detecting PII in every text, alongside the classifier
+	Patterns []Pattern
+	// Additional patterns for the texts of a tenant, by tenant
+	TenantPatterns map[string][]Pattern
+	// Action per PII type, the entity labels of the model without their B-/I- prefix
+	Actions map[string]Action
+	// Action for types without one, defaults to redact
+	DefaultAction Action
+	// Minimum confidence of an entity for it to count as PII, defaults to 0.5
+	Threshold float32
+}
+
+// Entity is an occurrence of PII in a text
+type Entity struct {
+	Type string
+	// Byte offsets of the entity in the text
+	Start, End int
+	// Mean confidence of the entity's tokens
+	Confidence float32
+	Action     Action
+}
+
+// Scan is the outcome of scanning a text for PII
+type Scan struct {
+	// The text with the entities to redact or tokenize replaced by placeholders
+	Text     string
+	Entities []Entity
+	// Types of the entities blocking the text, sorted
+	Blocked []string
+}
+
+// Redacted reports whether the scan changed the text
+func (s Scan) Redacted() bool {
+	for _, entity := range s.Entities {
+		if entity.Action == ActionRedact || entity.Action == ActionTokenize {
+			return true
+		}
+	}
+	return false
+}
+
+// Detector finds PII in texts with a token classification model, regex
+// patterns or both, and decides what to do with it by type
+type Detector struct {
+	options Options
+}
+
+// New creates a new PII detector with the given options
+func New(options Options) (*Detector, error) {
+	if options.ClassifyTokens == nil && len(options.Patterns) == 0 && len(options.TenantPatterns) == 0 {
+		return nil, fmt.Errorf("no token classifier or patterns")
+	}
+	if options.DefaultAction == "" {
+		options.DefaultAction = ActionRedact
+	}
+	if options.Threshold <= 0 {
+		options.Threshold = 0.5
+	}
+	if err := validAction(options.DefaultAction); err != nil {
+		return nil, fmt.Errorf("invalid default action: %w", err)
+	}
+	actions := make(map[string]Action, len(options.Actions))
+	for piiType, action := range options.Actions {
+		if err := validAction(action); err != nil {
+			return nil, fmt.Errorf("invalid action for %s: %w", piiType, err)
+		}
+		actions[strings.ToUpper(piiType)] = action
+	}
+	options.Actions = actions
+	return &Detector{options: options}, nil
+}
+
+func validAction(action Action) error {
+	switch action {
+	case ActionBlock, ActionRedact, ActionTokenize, ActionAllow:
+		return nil
+	}
+	return fmt.Errorf("unknown action %q, expected block, redact, tokenize or allow", action)
+}
+
+// action returns the action for a type of PII
+func (d *Detector) action(piiType string) Action {
+	if action, ok := d.options.Actions[piiType]; ok {
+		return action
+	}
+	return d.options.DefaultAction
+}
+
+// Scan finds the PII in a text of a tenant, empty when unknown, and redacts
+// or tokenizes the entities whose type is to be, adding the placeholders of
+// tokenized ones to tokens. Without tokens they are redacted instead. A nil
+// detector finds nothing.
+func (d *Detector) Scan(text, tenant string, tokens *Tokens) (Scan, error) {
+	scan := Scan{Text: text}
+	if d == nil || strings.TrimSpace(text) == "" {
+		return scan, nil
+	}
+	var entities []Entity
+	if d.options.ClassifyTokens != nil {
+		labels, err := d.options.ClassifyTokens(text)
+		if err != nil {
+			return scan, fmt.Errorf("failed to detect PII: %w", err)
+		}
+		for _, entity := range mergeEntities(labels, len(text)) {
+			if entity.Confidence >= d.options.Threshold {
+				entities = append(entities, entity)
+			}
+		}
+	}
+	entities = addPatternEntities(entities, text, d.options.Patterns)
+	entities = addPatternEntities(entities, text, d.options.TenantPatterns[tenant])
+	sort.SliceStable(entities, func(i, j int) bool { return entities[i].Start < entities[j].Start })
+
+	blocked := make(map[string]bool)
+	for _, entity := range entities {
+		entity.Action = d.action(entity.Type)
+		if entity.Action == ActionTokenize && tokens == nil {
+			entity.Action = ActionRedact
+		}
+		scan.Entities = append(scan.Entities, entity)
+		if entity.Action == ActionBlock {
+			blocked[entity.Type] = true
+		}
+	}
+	for piiType := range blocked {
+		scan.Blocked = append(scan.Blocked, piiType)
+	}
+	sort.Strings(scan.Blocked)
+	scan.Text = redact(text, scan.Entities, tokens)
+	return scan, nil
+}
+
+// addPatternEntities adds the entities the patterns match in a text, except
+// those overlapping an entity of the same type already found
+func addPatternEntities(entities []Entity, text string, patterns []Pattern) []Entity {
+	for _, pattern := range patterns {
+		found := len(entities)
+	matches:
+		for _, match := range pattern.find(text) {
+			for _, entity := range entities[:found] {
+				if entity.Type == match.Type && match.Start < entity.End && entity.Start < match.End {
+					continue matches
+				}
+			}
+			entities = append(entities, match)
+		}
+	}
+	return entities
+}
+
+// mergeEntities groups labelled tokens into entities. A token continues the
+// previous entity when it has the same type and either is labelled I- or
+// directly follows it, as word pieces do; tokens of overlapping windows of
+// long texts are merged into one entity.
+func mergeEntities(labels []candle_binding.TokenLabel, textLen int) []Entity {
+	sorted := append([]candle_binding.TokenLabel(nil), labels...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	var entities []Entity
+	var tokens int
+	var confidence float32
+	flush := func() {
+		if tokens > 0 {
+			entities[len(entities)-1].Confidence = confidence / float32(tokens)
+		}
+		tokens, confidence = 0, 0
+	}
+	for _, label := range sorted {
+		if label.Start < 0 || label.End > textLen || label.Start >= label.End {
+			continue
+		}
+		prefix, piiType := splitLabel(label.Label)
+		if n := len(entities); n > 0 {
+			last := &entities[n-1]
+			if last.Type == piiType && (label.Start <= last.End || prefix == "I") {
+				last.End = max(last.End, label.End)
+				tokens++
+				confidence += label.Confidence
+				continue
+			}
+		}
+		flush()
+		entities = append(entities, Entity{Type: piiType, Start: label.Start, End: label.End})
+		tokens, confidence = 1, label.Confidence
+	}
+	flush()
+	return entities
+}
+
+// splitLabel splits a BIO label such as B-EMAIL into its prefix and type
+func splitLabel(label string) (string, string) {
+	if prefix, piiType, ok := strings.Cut(label, "-"); ok && (prefix == "B" || prefix == "I") {
+		return prefix, strings.ToUpper(piiType)
+	}
+	return "", strings.ToUpper(label)
+}
+
+// redact replaces the entities to redact, sorted by start, with a placeholder
+// naming their type and those to tokenize with their placeholder in tokens;
+// an entity overlapping the previous one extends its placeholder
+func redact(text string, entities []Entity, tokens *Tokens) string {
+	var redacted strings.Builder
+	last := 0
+	for _, entity := range entities {
+		if entity.Action != ActionRedact && entity.Action != ActionTokenize {
+			continue
+		}
+		if entity.Start < last {
+			last = max(last, entity.End)
+			continue
+		}
+		redacted.WriteString(text[last:entity.Start])
+		if entity.Action == ActionTokenize {
+			redacted.WriteString(tokens.token(entity.Type, text[entity.Start:entity.End]))
+		} else {
+			redacted.WriteString("[" + entity.Type + "]")
+		}
+		last = entity.End
+	}
+	if last == 0 {
+		return text
+	}
+	redacted.WriteString(text[last:])
+	return redacted.String()
+}
@@ -0,0 +1,175 @@
+package pii
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	candle_binding "github.com/neuralmagic/semantic_router_poc/candle-binding"
+)
+
+// fakeTokenClassifier labels the tokens of every occurrence of the given
+// words, splitting each word into pieces of at most four bytes like a word
+// piece tokenizer would
+func fakeTokenClassifier(words map[string]string) func(text string) ([]candle_binding.TokenLabel, error) {
+	return func(text string) ([]candle_binding.TokenLabel, error) {
+		var labels []candle_binding.TokenLabel
+		for word, piiType := range words {
+			for offset := 0; ; {
+				i := strings.Index(text[offset:], word)
+				if i < 0 {
+					break
+				}
+				start := offset + i
+				for piece := start; piece < start+len(word); piece += 4 {
+					prefix := "I-"
+					if piece == start {
+						prefix = "B-"
+					}
+					labels = append(labels, candle_binding.TokenLabel{
+						Label:      prefix + piiType,
+						Start:      piece,
+						End:        min(piece+4, start+len(word)),
+						Confidence: 0.9,
+					})
+				}
+				offset = start + len(word)
+			}
+		}
+		return labels, nil
+	}
+}
+
+func TestScan(t *testing.T) {
+	classify := fakeTokenClassifier(map[string]string{
+		"jane@example.com": "EMAIL",
+		"123-45-6789":      "SSN",
+		"555-0100":         "PHONE",
+	})
+	tests := []struct {
+		name        string
+		actions     map[string]Action
+		text        string
+		wantText    string
+		wantBlocked []string
+		wantTypes   []string
+	}{
+		{
+			name:      "redacted by default",
+			text:      "Mail jane@example.com or call 555-0100.",
+			wantText:  "Mail [EMAIL] or call [PHONE].",
+			wantTypes: []string{"EMAIL", "PHONE"},
+		},
+		{
+			name:      "allowed type kept",
+			actions:   map[string]Action{"phone": ActionAllow},
+			text:      "Mail jane@example.com or call 555-0100.",
+			wantText:  "Mail [EMAIL] or call 555-0100.",
+			wantTypes: []string{"EMAIL", "PHONE"},
+		},
+		{
+			name:        "blocked type",
+			actions:     map[string]Action{"SSN": ActionBlock},
+			text:        "My SSN is 123-45-6789, mail jane@example.com",
+			wantText:    "My SSN is 123-45-6789, mail [EMAIL]",
+			wantBlocked: []string{"SSN"},
+			wantTypes:   []string{"SSN", "EMAIL"},
+		},
+		{
+			name:     "no PII",
+			text:     "What is the derivative of x^2?",
+			wantText: "What is the derivative of x^2?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(Options{ClassifyTokens: classify, Actions: tt.actions})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			scan, err := d.Scan(tt.text, "", nil)
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if scan.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", scan.Text, tt.wantText)
+			}
+			if !reflect.DeepEqual(scan.Blocked, tt.wantBlocked) {
+				t.Errorf("blocked = %v, want %v", scan.Blocked, tt.wantBlocked)
+			}
+			var types []string
+			for _, entity := range scan.Entities {
+				types = append(types, entity.Type)
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("entity types = %v, want %v", types, tt.wantTypes)
+			}
+			if scan.Redacted() != (scan.Text != tt.text) {
+				t.Errorf("Redacted() = %v for text %q", scan.Redacted(), scan.Text)
+			}
+		})
+	}
+}
+
+func TestMergeEntities(t *testing.T) {
+	labels := []candle_binding.TokenLabel{
+		// A second window overlapping the first repeats the name's last token
+		{Label: "I-NAME", Start: 5, End: 10, Confidence: 0.8},
+		{Label: "B-NAME", Start: 0, End: 4, Confidence: 0.9},
+		{Label: "I-NAME", Start: 5, End: 10, Confidence: 0.7},
+		// Adjacent word piece of an email labelled B- again
+		{Label: "B-EMAIL", Start: 14, End: 18, Confidence: 0.6},
+		{Label: "B-EMAIL", Start: 18, End: 28, Confidence: 0.4},
+		// A new entity of the same type after a gap
+		{Label: "B-NAME", Start: 33, End: 36, Confidence: 0.9},
+		// Out of range offsets are ignored
+		{Label: "B-NAME", Start: 40, End: 50, Confidence: 0.9},
+	}
+	want := []Entity{
+		{Type: "NAME", Start: 0, End: 10, Confidence: 0.8},
+		{Type: "EMAIL", Start: 14, End: 28, Confidence: 0.5},
+		{Type: "NAME", Start: 33, End: 36, Confidence: 0.9},
+	}
+	got := mergeEntities(labels, 40)
+	if len(got) != len(want) {
+		t.Fatalf("got %d entities %+v, want %+v", len(got), got, want)
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Start != want[i].Start || got[i].End != want[i].End ||
+			got[i].Confidence < want[i].Confidence-0.001 || got[i].Confidence > want[i].Confidence+0.001 {
+			t.Errorf("entity %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScanThresholdAndErrors(t *testing.T) {
+	d, err := New(Options{
+		ClassifyTokens: func(text string) ([]candle_binding.TokenLabel, error) {
+			return []candle_binding.TokenLabel{{Label: "B-EMAIL", Start: 0, End: 4, Confidence: 0.6}}, nil
+		},
+		Threshold: 0.7,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if scan, _ := d.Scan("jane", "", nil); len(scan.Entities) != 0 || scan.Text != "jane" {
+		t.Errorf("entity below the threshold detected: %+v", scan)
+	}
+
+	failing, _ := New(Options{ClassifyTokens: func(string) ([]candle_binding.TokenLabel, error) {
+		return nil, errors.New("model not loaded")
+	}})
+	if _, err := failing.Scan("jane", "", nil); err == nil {
+		t.Error("expected the classifier error")
+	}
+
+	var disabled *Detector
+	if scan, err := disabled.Scan("jane", "", nil); err != nil || scan.Text != "jane" {
+		t.Errorf("nil detector scan = %+v, %v", scan, err)
+	}
+
+	if _, err := New(Options{ClassifyTokens: d.options.ClassifyTokens, Actions: map[string]Action{"EMAIL": "mask"}}); err == nil {
+		t.Error("expected an invalid action to be rejected")
+	}
+}
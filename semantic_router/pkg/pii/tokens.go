@@ -0,0 +1,71 @@
+package pii
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Tokens maps the placeholders PII was tokenized into, such as <EMAIL_1>, back
+// to the PII. The values of each type are numbered in order of appearance, and
+// a value recurring in a request gets the same placeholder every time, so the
+// model can still tell them apart and refer to them.
+type Tokens struct {
+	values  map[string]string
+	byValue map[string]string
+	counts  map[string]int
+	// Placeholders in order of creation, so restoring is deterministic
+	order []string
+}
+
+// NewTokens creates an empty mapping of placeholders, one per request
+func NewTokens() *Tokens {
+	return &Tokens{
+		values:  make(map[string]string),
+		byValue: make(map[string]string),
+		counts:  make(map[string]int),
+	}
+}
+
+// token returns the placeholder of a value of a type of PII
+func (t *Tokens) token(piiType, value string) string {
+	key := piiType + "\x00" + value
+	if placeholder, ok := t.byValue[key]; ok {
+		return placeholder
+	}
+	t.counts[piiType]++
+	placeholder := fmt.Sprintf("<%s_%d>", piiType, t.counts[piiType])
+	t.byValue[key] = placeholder
+	t.values[placeholder] = value
+	t.order = append(t.order, placeholder)
+	return placeholder
+}
+
+// Len returns the number of placeholders
+func (t *Tokens) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.order)
+}
+
+// Detokenize restores the PII in place of its placeholders in a JSON body or
+// a stream of server-sent JSON events. Values are JSON escaped, and
+// placeholders are also found with their angle brackets escaped as \u003c and
+// \u003e, as JSON encoders may write them.
+func (t *Tokens) Detokenize(body []byte) []byte {
+	if t.Len() == 0 {
+		return body
+	}
+	for _, placeholder := range t.order {
+		encoded, err := json.Marshal(t.values[placeholder])
+		if err != nil {
+			continue
+		}
+		value := encoded[1 : len(encoded)-1]
+		body = bytes.ReplaceAll(body, []byte(placeholder), value)
+		escaped := `\u003c` + placeholder[1:len(placeholder)-1] + `\u003e`
+		body = bytes.ReplaceAll(body, []byte(escaped), value)
+	}
+	return body
+}
@@ -0,0 +1,86 @@
+package pii
+
+import "testing"
+
+func TestScanTokenizes(t *testing.T) {
+	d, err := New(Options{
+		ClassifyTokens: fakeTokenClassifier(map[string]string{
+			"jane@example.com": "EMAIL",
+			"joe@example.com":  "EMAIL",
+			"555-0100":         "PHONE",
+		}),
+		DefaultAction: ActionTokenize,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	tokens := NewTokens()
+	first, err := d.Scan("Mail jane@example.com and joe@example.com", "", tokens)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	// A value keeps its placeholder across the texts of a request
+	second, err := d.Scan("Call 555-0100, cc jane@example.com", "", tokens)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if want := "Mail <EMAIL_1> and <EMAIL_2>"; first.Text != want {
+		t.Errorf("first text = %q, want %q", first.Text, want)
+	}
+	if want := "Call <PHONE_1>, cc <EMAIL_1>"; second.Text != want {
+		t.Errorf("second text = %q, want %q", second.Text, want)
+	}
+	if !first.Redacted() || tokens.Len() != 3 {
+		t.Errorf("Redacted() = %v with %d tokens, want true with 3", first.Redacted(), tokens.Len())
+	}
+
+	// Without tokens, tokenized types are redacted
+	scan, err := d.Scan("Mail jane@example.com", "", nil)
+	if err != nil || scan.Text != "Mail [EMAIL]" {
+		t.Errorf("Scan without tokens = %q, %v, want redacted", scan.Text, err)
+	}
+}
+
+func TestDetokenize(t *testing.T) {
+	tokens := NewTokens()
+	tokens.token("EMAIL", "jane@example.com")
+	tokens.token("NAME", `Jane "JD" Doe`)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "placeholders",
+			body: `{"content":"Dear <NAME_1>, I wrote to <EMAIL_1>."}`,
+			want: `{"content":"Dear Jane \"JD\" Doe, I wrote to jane@example.com."}`,
+		},
+		{
+			name: "escaped placeholders",
+			body: `{"content":"Wrote to \u003cEMAIL_1\u003e"}`,
+			want: `{"content":"Wrote to jane@example.com"}`,
+		},
+		{
+			name: "unknown placeholders kept",
+			body: `{"content":"Wrote to <EMAIL_2>"}`,
+			want: `{"content":"Wrote to <EMAIL_2>"}`,
+		},
+		{
+			name: "event stream",
+			body: "data: {\"delta\":{\"content\":\"Hi <NAME_1>\"}}\n\ndata: [DONE]\n\n",
+			want: "data: {\"delta\":{\"content\":\"Hi Jane \\\"JD\\\" Doe\"}}\n\ndata: [DONE]\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tokens.Detokenize([]byte(tt.body))); got != tt.want {
+				t.Errorf("Detokenize = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	var none *Tokens
+	if got := string(none.Detokenize([]byte("<EMAIL_1>"))); got != "<EMAIL_1>" {
+		t.Errorf("nil tokens changed the body: %s", got)
+	}
+}
@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// DefaultClientIPHeader is the header the client IP chain is read from when none is configured
+const DefaultClientIPHeader = "x-forwarded-for"
+
+// GeoOptions holds options for creating a new geo policy resolver
+type GeoOptions struct {
+	// Header carrying the client's region set by a trusted edge, if any
+	RegionHeader string
+	// Header carrying the client IP chain
+	ClientIPHeader string
+	// Number of trusted proxies appending to the end of the IP chain
+	TrustedProxyHops int
+	// Client networks and the region they belong to
+	Networks []config.GeoNetwork
+	// Policies restricting which models clients from a region may use
+	Policies []config.GeoPolicy
+	// Hosting region of each model
+	ModelRegions map[string]string
+}
+
+// Geo resolves the region of a client and the routing policy that applies to it
+type Geo struct {
+	regionHeader     string
+	clientIPHeader   string
+	trustedProxyHops int
+	networks         []geoNetwork
+	policies         map[string]*GeoPolicy
+}
+
+type geoNetwork struct {
+	prefix netip.Prefix
+	region string
+}
+
+// GeoPolicy restricts the models clients from a region may be routed to
+type GeoPolicy struct {
+	// Client region the policy applies to
+	ClientRegion string
+	// HTTP status returned when the request cannot be served by an allowed model
+	DenyStatus int
+
+	allowedRegions map[string]bool
+	modelRegions   map[string]string
+}
+
+// NewGeo creates a geo policy resolver with the given options
+func NewGeo(options GeoOptions) (*Geo, error) {
+	g := &Geo{
+		regionHeader:     strings.ToLower(options.RegionHeader),
+		clientIPHeader:   strings.ToLower(options.ClientIPHeader),
+		trustedProxyHops: options.TrustedProxyHops,
+		policies:         make(map[string]*GeoPolicy, len(options.Policies)),
+	}
+	if g.clientIPHeader == "" {
+		g.clientIPHeader = DefaultClientIPHeader
+	}
+	if g.trustedProxyHops < 0 {
+		return nil, fmt.Errorf("trusted_proxy_hops must not be negative")
+	}
+
+	for _, network := range options.Networks {
+		prefix, err := netip.ParsePrefix(network.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geo network %q: %w", network.CIDR, err)
+		}
+		g.networks = append(g.networks, geoNetwork{prefix: prefix.Masked(), region: strings.ToLower(network.Region)})
+	}
+	// Match the most specific network first
+	sort.SliceStable(g.networks, func(i, j int) bool {
+		return g.networks[i].prefix.Bits() > g.networks[j].prefix.Bits()
+	})
+
+	modelRegions := make(map[string]string, len(options.ModelRegions))
+	for model, region := range options.ModelRegions {
+		modelRegions[model] = strings.ToLower(region)
+	}
+	for _, p := range options.Policies {
+		region := strings.ToLower(p.ClientRegion)
+		if region == "" {
+			return nil, fmt.Errorf("geo policy is missing client_region")
+		}
+		if _, ok := g.policies[region]; ok {
+			return nil, fmt.Errorf("duplicate geo policy for client region %s", region)
+		}
+		denyStatus := p.DenyStatus
+		if denyStatus == 0 {
+			denyStatus = http.StatusUnavailableForLegalReasons
+		}
+		if denyStatus != http.StatusUnavailableForLegalReasons && denyStatus != http.StatusForbidden {
+			return nil, fmt.Errorf("geo policy for client region %s: deny_status must be 451 or 403, got %d", region, denyStatus)
+		}
+		allowed := make(map[string]bool, len(p.AllowedModelRegions))
+		for _, r := range p.AllowedModelRegions {
+			allowed[strings.ToLower(r)] = true
+		}
+		g.policies[region] = &GeoPolicy{
+			ClientRegion:   region,
+			DenyStatus:     denyStatus,
+			allowedRegions: allowed,
+			modelRegions:   modelRegions,
+		}
+	}
+	return g, nil
+}
+
+// ClientIP returns the client address from the IP chain header, skipping the
+// entries appended by trusted proxies, or an invalid address if there is none
+func (g *Geo) ClientIP(headers map[string]string) netip.Addr {
+	value := headers[g.clientIPHeader]
+	if value == "" {
+		return netip.Addr{}
+	}
+	chain := strings.Split(value, ",")
+	index := len(chain) - 1 - g.trustedProxyHops
+	if index < 0 {
+		index = 0
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(chain[index]))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// ClientRegion returns the client's region, preferring the trusted region header
+// over the client IP, or an empty string if it cannot be resolved. A nil
+// resolver resolves no region.
+func (g *Geo) ClientRegion(headers map[string]string) string {
+	if g == nil {
+		return ""
+	}
+	if g.regionHeader != "" {
+		if region := strings.TrimSpace(headers[g.regionHeader]); region != "" {
+			return strings.ToLower(region)
+		}
+	}
+	addr := g.ClientIP(headers)
+	if !addr.IsValid() {
+		return ""
+	}
+	for _, network := range g.networks {
+		if network.prefix.Contains(addr) {
+			return network.region
+		}
+	}
+	return ""
+}
+
+// PolicyFor returns the policy for a client region, or nil if none applies
+func (g *Geo) PolicyFor(region string) *GeoPolicy {
+	if g == nil || region == "" {
+		return nil
+	}
+	return g.policies[region]
+}
+
+// Name implements ModelPolicy
+func (p *GeoPolicy) Name() string {
+	return "geo"
+}
+
+// Check implements ModelPolicy. Models without a configured region are never allowed.
+func (p *GeoPolicy) Check(model string) *Violation {
+	region, ok := p.modelRegions[model]
+	if ok && p.allowedRegions[region] {
+		return nil
+	}
+	if !ok {
+		region = "unknown"
+	}
+	return &Violation{
+		Policy: p.Name(),
+		Status: p.DenyStatus,
+		Reason: fmt.Sprintf("model %s is hosted in region %s, not allowed for clients in region %s", model, region, p.ClientRegion),
+	}
+}
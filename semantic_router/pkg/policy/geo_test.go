@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func newTestGeo(t *testing.T, hops int) *Geo {
+	t.Helper()
+	g, err := NewGeo(GeoOptions{
+		RegionHeader:     "x-client-region",
+		TrustedProxyHops: hops,
+		Networks: []config.GeoNetwork{
+			{CIDR: "10.0.0.0/8", Region: "us"},
+			{CIDR: "10.20.0.0/16", Region: "EU"},
+			{CIDR: "2001:db8::/32", Region: "eu"},
+		},
+		Policies: []config.GeoPolicy{
+			{ClientRegion: "eu", AllowedModelRegions: []string{"eu"}},
+			{ClientRegion: "cn", AllowedModelRegions: []string{"cn"}, DenyStatus: 403},
+		},
+		ModelRegions: map[string]string{"eu-model": "EU", "us-model": "us"},
+	})
+	if err != nil {
+		t.Fatalf("NewGeo: %v", err)
+	}
+	return g
+}
+
+func TestGeoClientRegion(t *testing.T) {
+	tests := []struct {
+		name    string
+		hops    int
+		headers map[string]string
+		want    string
+	}{
+		{name: "no headers", headers: map[string]string{}, want: ""},
+		{name: "region header wins", headers: map[string]string{"x-client-region": "CN", "x-forwarded-for": "10.20.1.1"}, want: "cn"},
+		{name: "most specific network", headers: map[string]string{"x-forwarded-for": "10.20.1.1"}, want: "eu"},
+		{name: "broader network", headers: map[string]string{"x-forwarded-for": "10.1.1.1"}, want: "us"},
+		{name: "ipv6", headers: map[string]string{"x-forwarded-for": "2001:db8::1"}, want: "eu"},
+		{name: "unknown network", headers: map[string]string{"x-forwarded-for": "192.0.2.1"}, want: ""},
+		{name: "invalid address", headers: map[string]string{"x-forwarded-for": "not-an-ip"}, want: ""},
+		{name: "last entry without trusted hops", headers: map[string]string{"x-forwarded-for": "10.20.1.1, 10.1.1.1"}, want: "us"},
+		{name: "skips trusted proxy", hops: 1, headers: map[string]string{"x-forwarded-for": "10.20.1.1, 10.1.1.1"}, want: "eu"},
+		{name: "hops beyond chain", hops: 5, headers: map[string]string{"x-forwarded-for": "10.20.1.1, 10.1.1.1"}, want: "eu"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTestGeo(t, tt.hops).ClientRegion(tt.headers); got != tt.want {
+				t.Errorf("ClientRegion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoPolicy(t *testing.T) {
+	g := newTestGeo(t, 0)
+
+	if p := g.PolicyFor("us"); p != nil {
+		t.Errorf("expected no policy for us, got %+v", p)
+	}
+
+	eu := g.PolicyFor("eu")
+	if eu == nil || eu.DenyStatus != 451 {
+		t.Fatalf("expected eu policy with deny status 451, got %+v", eu)
+	}
+	if eu.Check("eu-model") != nil {
+		t.Error("eu policy must allow models hosted in eu")
+	}
+	for _, model := range []string{"us-model", "untagged-model"} {
+		v := eu.Check(model)
+		if v == nil || v.Policy != "geo" || v.Status != 451 {
+			t.Errorf("Check(%s) = %+v, want a geo violation with status 451", model, v)
+		}
+	}
+
+	if cn := g.PolicyFor("cn"); cn == nil || cn.DenyStatus != 403 {
+		t.Errorf("expected cn policy with deny status 403, got %+v", cn)
+	}
+}
+
+func TestNewGeoRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		options GeoOptions
+	}{
+		{name: "bad cidr", options: GeoOptions{Networks: []config.GeoNetwork{{CIDR: "10.0.0.0/33", Region: "us"}}}},
+		{name: "missing client region", options: GeoOptions{Policies: []config.GeoPolicy{{AllowedModelRegions: []string{"eu"}}}}},
+		{name: "bad deny status", options: GeoOptions{Policies: []config.GeoPolicy{{ClientRegion: "eu", DenyStatus: 500}}}},
+		{name: "duplicate policy", options: GeoOptions{Policies: []config.GeoPolicy{{ClientRegion: "eu"}, {ClientRegion: "EU"}}}},
+		{name: "negative hops", options: GeoOptions{TrustedProxyHops: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGeo(tt.options); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package policy
+
+// ModelPolicy restricts the models a request may be routed to
+type ModelPolicy interface {
+	// Name identifies the kind of policy in logs and metrics
+	Name() string
+	// Check returns a violation if the policy does not allow the model, nil otherwise
+	Check(model string) *Violation
+}
+
+// Violation describes why a policy does not allow a model
+type Violation struct {
+	// Name of the violated policy
+	Policy string
+	// HTTP status to reject the request with
+	Status int
+	// Human readable reason, logged and returned to the client
+	Reason string
+}
+
+// Set holds the policies applying to a request, all of which must allow a model
+type Set []ModelPolicy
+
+// Check returns the first violation of the model among the policies, or nil if all allow it
+func (s Set) Check(model string) *Violation {
+	for _, p := range s {
+		if v := p.Check(model); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// FirstAllowed returns the first candidate model every policy allows
+func (s Set) FirstAllowed(candidates []string) (string, bool) {
+	for _, model := range candidates {
+		if s.Check(model) == nil {
+			return model, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+// DefaultTenantHeader is the header the tenant is read from when none is configured
+const DefaultTenantHeader = "x-tenant-id"
+
+// ResidencyOptions holds options for creating a new residency policy resolver
+type ResidencyOptions struct {
+	// Header identifying the tenant of a request
+	TenantHeader string
+	// Compliance attributes each tenant requires of the models it is routed to
+	Tenants []config.TenantPolicy
+	// Compliance attributes of each model, e.g. eu-only, hipaa or on-prem
+	ModelAttributes map[string][]string
+}
+
+// Residency resolves the data-residency policy of a request's tenant
+type Residency struct {
+	tenantHeader string
+	tenants      map[string]*TenantPolicy
+}
+
+// TenantPolicy restricts a tenant to models carrying all of its required attributes
+type TenantPolicy struct {
+	// Tenant the policy applies to
+	Tenant string
+	// Attributes every model serving the tenant must carry, sorted
+	RequiredAttributes []string
+	// HTTP status returned when no qualifying model can serve the request
+	DenyStatus int
+	// Categories the tenant's requests may not be about
+	BlockedCategories map[string]bool
+	// Most tokens the tenant's requests may generate, 0 when unlimited
+	MaxTokens int
+	// Whether the tenant's conversations are archived
+	ComplianceHold bool
+
+	modelAttributes map[string]map[string]bool
+}
+
+// NewResidency creates a residency policy resolver with the given options
+func NewResidency(options ResidencyOptions) (*Residency, error) {
+	r := &Residency{
+		tenantHeader: strings.ToLower(options.TenantHeader),
+		tenants:      make(map[string]*TenantPolicy, len(options.Tenants)),
+	}
+	if r.tenantHeader == "" {
+		r.tenantHeader = DefaultTenantHeader
+	}
+
+	modelAttributes := make(map[string]map[string]bool, len(options.ModelAttributes))
+	for model, attributes := range options.ModelAttributes {
+		set := make(map[string]bool, len(attributes))
+		for _, attribute := range attributes {
+			set[strings.ToLower(attribute)] = true
+		}
+		modelAttributes[model] = set
+	}
+
+	for _, t := range options.Tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("tenant policy is missing name")
+		}
+		if _, ok := r.tenants[t.Name]; ok {
+			return nil, fmt.Errorf("duplicate policy for tenant %s", t.Name)
+		}
+		if len(t.RequiredAttributes) == 0 && len(t.BlockedCategories) == 0 && t.MaxTokens == 0 && !t.ComplianceHold {
+			return nil, fmt.Errorf("policy for tenant %s requires no attributes, blocks no categories, caps no tokens and holds no conversations", t.Name)
+		}
+		if t.MaxTokens < 0 {
+			return nil, fmt.Errorf("policy for tenant %s: max_tokens must not be negative", t.Name)
+		}
+		denyStatus := t.DenyStatus
+		if denyStatus == 0 {
+			denyStatus = http.StatusForbidden
+		}
+		if denyStatus != http.StatusUnavailableForLegalReasons && denyStatus != http.StatusForbidden {
+			return nil, fmt.Errorf("policy for tenant %s: deny_status must be 451 or 403, got %d", t.Name, denyStatus)
+		}
+		required := make([]string, 0, len(t.RequiredAttributes))
+		for _, attribute := range t.RequiredAttributes {
+			required = append(required, strings.ToLower(attribute))
+		}
+		sort.Strings(required)
+		blocked := make(map[string]bool, len(t.BlockedCategories))
+		for _, category := range t.BlockedCategories {
+			blocked[category] = true
+		}
+		r.tenants[t.Name] = &TenantPolicy{
+			Tenant:             t.Name,
+			RequiredAttributes: required,
+			DenyStatus:         denyStatus,
+			BlockedCategories:  blocked,
+			MaxTokens:          t.MaxTokens,
+			ComplianceHold:     t.ComplianceHold,
+			modelAttributes:    modelAttributes,
+		}
+	}
+	return r, nil
+}
+
+// Tenant returns the tenant of a request, or an empty string if it has none.
+// A nil resolver resolves no tenant.
+func (r *Residency) Tenant(headers map[string]string) string {
+	if r == nil {
+		return ""
+	}
+	return strings.TrimSpace(headers[r.tenantHeader])
+}
+
+// PolicyFor returns the policy for a tenant, or nil if none applies
+func (r *Residency) PolicyFor(tenant string) *TenantPolicy {
+	if r == nil || tenant == "" {
+		return nil
+	}
+	return r.tenants[tenant]
+}
+
+// TokenLimit returns the most tokens the tenant's requests may generate, 0
+// when unlimited. A nil policy is unlimited.
+func (p *TenantPolicy) TokenLimit() int {
+	if p == nil {
+		return 0
+	}
+	return p.MaxTokens
+}
+
+// HoldsConversations returns whether the tenant's conversations are archived.
+// A nil policy holds none.
+func (p *TenantPolicy) HoldsConversations() bool {
+	return p != nil && p.ComplianceHold
+}
+
+// Holds returns whether any tenant's conversations are archived
+func (r *Residency) Holds() bool {
+	if r == nil {
+		return false
+	}
+	for _, t := range r.tenants {
+		if t.ComplianceHold {
+			return true
+		}
+	}
+	return false
+}
+
+// BlocksCategory returns whether the tenant blocks requests of the category. A
+// nil policy blocks nothing.
+func (p *TenantPolicy) BlocksCategory(category string) bool {
+	return p != nil && p.BlockedCategories[category]
+}
+
+// Name implements ModelPolicy
+func (p *TenantPolicy) Name() string {
+	return "residency"
+}
+
+// Check implements ModelPolicy, naming the attributes the model is missing
+func (p *TenantPolicy) Check(model string) *Violation {
+	attributes := p.modelAttributes[model]
+	var missing []string
+	for _, attribute := range p.RequiredAttributes {
+		if !attributes[attribute] {
+			missing = append(missing, attribute)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &Violation{
+		Policy: p.Name(),
+		Status: p.DenyStatus,
+		Reason: fmt.Sprintf("model %s lacks compliance attributes [%s] required by tenant %s", model, strings.Join(missing, ", "), p.Tenant),
+	}
+}
@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+)
+
+func newTestResidency(t *testing.T) *Residency {
+	t.Helper()
+	r, err := NewResidency(ResidencyOptions{
+		Tenants: []config.TenantPolicy{
+			{Name: "acme-health", RequiredAttributes: []string{"HIPAA"}},
+			{Name: "acme-eu", RequiredAttributes: []string{"eu-only", "on-prem"}, DenyStatus: 451},
+		},
+		ModelAttributes: map[string][]string{
+			"hipaa-model":  {"hipaa"},
+			"onprem-model": {"eu-only", "on-prem"},
+			"cloud-model":  {"eu-only"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResidency: %v", err)
+	}
+	return r
+}
+
+func TestResidencyTenantPolicy(t *testing.T) {
+	r := newTestResidency(t)
+
+	if tenant := r.Tenant(map[string]string{"x-tenant-id": " acme-eu "}); tenant != "acme-eu" {
+		t.Errorf("Tenant() = %q, want acme-eu", tenant)
+	}
+	if p := r.PolicyFor("unknown"); p != nil {
+		t.Errorf("expected no policy for an unknown tenant, got %+v", p)
+	}
+
+	tests := []struct {
+		tenant      string
+		model       string
+		wantMissing string
+		wantStatus  int
+	}{
+		{tenant: "acme-health", model: "hipaa-model"},
+		{tenant: "acme-health", model: "cloud-model", wantMissing: "[hipaa]", wantStatus: 403},
+		{tenant: "acme-eu", model: "onprem-model"},
+		{tenant: "acme-eu", model: "cloud-model", wantMissing: "[on-prem]", wantStatus: 451},
+		{tenant: "acme-eu", model: "untagged-model", wantMissing: "[eu-only, on-prem]", wantStatus: 451},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tenant+"/"+tt.model, func(t *testing.T) {
+			v := r.PolicyFor(tt.tenant).Check(tt.model)
+			if tt.wantMissing == "" {
+				if v != nil {
+					t.Errorf("unexpected violation: %+v", v)
+				}
+				return
+			}
+			if v == nil || v.Policy != "residency" || v.Status != tt.wantStatus || !strings.Contains(v.Reason, tt.wantMissing) {
+				t.Errorf("Check() = %+v, want residency violation %d missing %s", v, tt.wantStatus, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestSetFiltersCandidatesByEveryPolicy(t *testing.T) {
+	geo := newTestGeo(t, 0)
+	residency := newTestResidency(t)
+	residency.tenants["acme-eu"].modelAttributes["eu-model"] = map[string]bool{"eu-only": true, "on-prem": true}
+	set := Set{geo.PolicyFor("eu"), residency.PolicyFor("acme-eu")}
+
+	if v := set.Check("onprem-model"); v == nil || v.Policy != "geo" {
+		t.Errorf("expected the geo policy to reject a model without a region, got %+v", v)
+	}
+	if model, ok := set.FirstAllowed([]string{"us-model", "onprem-model", "eu-model"}); !ok || model != "eu-model" {
+		t.Errorf("FirstAllowed() = %q, %v, want eu-model", model, ok)
+	}
+	if _, ok := set.FirstAllowed([]string{"us-model", "cloud-model"}); ok {
+		t.Error("expected no candidate to qualify")
+	}
+	if Set(nil).Check("any-model") != nil {
+		t.Error("an empty set must allow every model")
+	}
+}
+
+func TestNewResidencyRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []config.TenantPolicy
+	}{
+		{name: "missing name", tenants: []config.TenantPolicy{{RequiredAttributes: []string{"hipaa"}}}},
+		{name: "no attributes", tenants: []config.TenantPolicy{{Name: "acme"}}},
+		{name: "duplicate tenant", tenants: []config.TenantPolicy{{Name: "acme", RequiredAttributes: []string{"hipaa"}}, {Name: "acme", RequiredAttributes: []string{"hipaa"}}}},
+		{name: "bad deny status", tenants: []config.TenantPolicy{{Name: "acme", RequiredAttributes: []string{"hipaa"}, DenyStatus: 404}}},
+		{name: "negative max tokens", tenants: []config.TenantPolicy{{Name: "acme", RequiredAttributes: []string{"hipaa"}, MaxTokens: -1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewResidency(ResidencyOptions{Tenants: tt.tenants}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestTenantBlockedCategories(t *testing.T) {
+	r, err := NewResidency(ResidencyOptions{
+		Tenants: []config.TenantPolicy{{Name: "kids-app", BlockedCategories: []string{"law", "health"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewResidency: %v", err)
+	}
+	p := r.PolicyFor("kids-app")
+	if !p.BlocksCategory("law") || p.BlocksCategory("math") {
+		t.Errorf("BlockedCategories = %v, want law blocked and math allowed", p.BlockedCategories)
+	}
+	// A policy that only blocks categories allows every model
+	if v := p.Check("any-model"); v != nil {
+		t.Errorf("Check() = %+v, want no violation", v)
+	}
+	var none *TenantPolicy
+	if none.BlocksCategory("law") {
+		t.Error("nil policy blocked a category")
+	}
+}
+
+func TestTenantComplianceHold(t *testing.T) {
+	r, err := NewResidency(ResidencyOptions{
+		Tenants: []config.TenantPolicy{{Name: "acme-legal", ComplianceHold: true}, {Name: "kids-app", BlockedCategories: []string{"law"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewResidency: %v", err)
+	}
+	if !r.Holds() || !r.PolicyFor("acme-legal").HoldsConversations() || r.PolicyFor("kids-app").HoldsConversations() {
+		t.Error("compliance hold not applied to acme-legal alone")
+	}
+	var none *Residency
+	if none.Holds() || none.PolicyFor("acme-legal").HoldsConversations() {
+		t.Error("nil residency holds conversations")
+	}
+}
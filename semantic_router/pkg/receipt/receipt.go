@@ -0,0 +1,102 @@
+// Package receipt signs and verifies routing receipts: compact records of how
+// the router routed a request, attached to the request sent upstream or to
+// the response, so billing and audit proxies sharing the signing key can
+// trust the model, category and estimated cost without trusting the client.
+//
+// A receipt is encoded as "v1.<payload>.<signature>", the payload the
+// base64url encoded JSON receipt and the signature its HMAC-SHA256 over
+// "v1.<payload>", base64url encoded without padding.
+package receipt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// version prefixes the receipts of the current encoding
+const version = "v1"
+
+var (
+	// ErrMalformed is returned when verifying a receipt that is not encoded as one
+	ErrMalformed = errors.New("malformed routing receipt")
+	// ErrBadSignature is returned when verifying a receipt whose signature does
+	// not match its payload
+	ErrBadSignature = errors.New("routing receipt signature mismatch")
+)
+
+// Receipt is the routing decision of a request
+type Receipt struct {
+	RequestID string `json:"rid"`
+	// Model the request was sent to
+	Model string `json:"model"`
+	// Category it was classified in, empty when it was not classified
+	Category string `json:"cat,omitempty"`
+	// Cost of its estimated prompt tokens at the model's configured prices
+	EstimatedCost float64 `json:"cost"`
+	// Unix milliseconds when the router received the request and routed it
+	ReceivedAt int64 `json:"recv"`
+	RoutedAt   int64 `json:"routed"`
+}
+
+// Sign encodes a receipt signed with key
+func Sign(r Receipt, key []byte) (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	signed := version + "." + base64.RawURLEncoding.EncodeToString(data)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(signed, key)), nil
+}
+
+// Verify checks the signature of an encoded receipt with key and decodes it
+func Verify(encoded string, key []byte) (Receipt, error) {
+	var r Receipt
+	i := strings.LastIndexByte(encoded, '.')
+	if i < 0 || !strings.HasPrefix(encoded, version+".") {
+		return r, ErrMalformed
+	}
+	signed, signature := encoded[:i], encoded[i+1:]
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return r, ErrMalformed
+	}
+	if !hmac.Equal(mac, sign(signed, key)) {
+		return r, ErrBadSignature
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(signed, version+"."))
+	if err != nil {
+		return r, ErrMalformed
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return r, nil
+}
+
+func sign(signed string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// LoadKey reads a base64 encoded signing key from an environment variable
+func LoadKey(env string) ([]byte, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return nil, fmt.Errorf("%s is not set", env)
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64 encoded: %w", env, err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s is empty", env)
+	}
+	return key, nil
+}
@@ -0,0 +1,41 @@
+package receipt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("shared-key")
+	want := Receipt{RequestID: "req-1", Model: "math-model", Category: "math", EstimatedCost: 0.0012, ReceivedAt: 1700000000000, RoutedAt: 1700000000012}
+	encoded, err := Sign(want, key)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "v1.") || strings.Count(encoded, ".") != 2 {
+		t.Fatalf("unexpected encoding %q", encoded)
+	}
+	got, err := Verify(encoded, key)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got != want {
+		t.Errorf("Verify = %+v, want %+v", got, want)
+	}
+
+	if _, err := Verify(encoded, []byte("other-key")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify with another key: %v, want ErrBadSignature", err)
+	}
+	payload := strings.Split(encoded, ".")[1]
+	forged, _ := Sign(Receipt{RequestID: "req-1", Model: "cheap-model"}, []byte("other-key"))
+	tampered := strings.Replace(encoded, payload, strings.Split(forged, ".")[1], 1)
+	if _, err := Verify(tampered, key); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify of a tampered payload: %v, want ErrBadSignature", err)
+	}
+	for _, malformed := range []string{"", "v1", "v2.e30.AAAA", "v1.e30.!!"} {
+		if _, err := Verify(malformed, key); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Verify(%q): %v, want ErrMalformed", malformed, err)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// Package recommend learns which model serves each recognized application best
+// from the outcomes of its requests and client feedback, and recommends it as
+// the application's default model.
+package recommend
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+)
+
+// ErrUnknownRequest is returned for feedback on a request that is not among
+// the recently observed requests of an application
+var ErrUnknownRequest = errors.New("request not among recent application requests")
+
+// Options holds options for creating a new recommender
+type Options struct {
+	// Requests a model must have served an application before it is scored,
+	// defaults to 50
+	MinRequests int
+	// Half-life of observations, so recent behavior outweighs old; 0 keeps
+	// every observation at full weight
+	HalfLife time.Duration
+	// Score penalty per second of mean completion latency, defaults to 0.1
+	LatencyWeight float64
+	// Score bonus of unanimously positive feedback, and penalty of negative,
+	// defaults to 0.5
+	FeedbackWeight float64
+	// Relative score improvement over the current default required to
+	// recommend another model, defaults to 0.05
+	MinImprovement float64
+	// Recent requests remembered for feedback, oldest forgotten first,
+	// defaults to 10000
+	MaxTrackedRequests int
+}
+
+// ModelStats describes how a model served an application. Counts are
+// weighted by age when a half-life is set.
+type ModelStats struct {
+	Model    string  `json:"model"`
+	Requests float64 `json:"requests"`
+	// Requests that failed with a 5xx status
+	Errors    float64 `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	// Mean completion latency of successful requests
+	MeanLatencySeconds float64 `json:"mean_latency_seconds"`
+	PositiveFeedback   float64 `json:"positive_feedback"`
+	NegativeFeedback   float64 `json:"negative_feedback"`
+	// Score the models are ranked by, 0 until the model has enough requests
+	Score float64 `json:"score"`
+}
+
+// Recommendation is the model suggested as an application's default
+type Recommendation struct {
+	Application string `json:"application"`
+	// Configured model of the application, empty when its requests are classified
+	CurrentModel string `json:"current_model,omitempty"`
+	// Best scored model, empty when no model has enough requests or none
+	// improves enough on the current default
+	RecommendedModel string `json:"recommended_model,omitempty"`
+	// Relative score improvement of the recommended model over the current
+	// default, 0 when every request of the current default failed
+	Improvement float64 `json:"improvement,omitempty"`
+	// Models that served the application, best scored first
+	Models []ModelStats `json:"models"`
+}
+
+// stats are the decayed observations of a model serving an application
+type stats struct {
+	requests, errors     float64
+	latencySum, latencyN float64
+	positive, negative   float64
+	updated              time.Time
+}
+
+// decay ages the observations to now
+func (s *stats) decay(now time.Time, halfLife time.Duration) {
+	if halfLife > 0 && !s.updated.IsZero() && now.After(s.updated) {
+		factor := math.Exp2(-float64(now.Sub(s.updated)) / float64(halfLife))
+		s.requests *= factor
+		s.errors *= factor
+		s.latencySum *= factor
+		s.latencyN *= factor
+		s.positive *= factor
+		s.negative *= factor
+	}
+	if now.After(s.updated) {
+		s.updated = now
+	}
+}
+
+// served identifies the application and model that served a request
+type served struct {
+	application, model string
+}
+
+// Recommender learns from the decision records of recognized applications'
+// requests. It is a decision sink, so it observes every routed request.
+type Recommender struct {
+	options Options
+	now     func() time.Time
+
+	mu sync.Mutex
+	// Observations by application, then model
+	apps map[string]map[string]*stats
+	// Recent requests by ID, for feedback, and their IDs oldest first
+	requests map[string]served
+	order    []string
+}
+
+// New creates a new recommender with the given options
+func New(options Options) *Recommender {
+	if options.MinRequests <= 0 {
+		options.MinRequests = 50
+	}
+	if options.LatencyWeight <= 0 {
+		options.LatencyWeight = 0.1
+	}
+	if options.FeedbackWeight <= 0 {
+		options.FeedbackWeight = 0.5
+	}
+	if options.MinImprovement <= 0 {
+		options.MinImprovement = 0.05
+	}
+	if options.MaxTrackedRequests <= 0 {
+		options.MaxTrackedRequests = 10000
+	}
+	return &Recommender{
+		options:  options,
+		now:      time.Now,
+		apps:     make(map[string]map[string]*stats),
+		requests: make(map[string]served),
+	}
+}
+
+// Write observes the outcome of a request of a recognized application.
+// Cache hits, shadow mode requests, requests without a response and requests
+// of no application are ignored.
+func (r *Recommender) Write(record *decision.DecisionRecord) {
+	r.observe(record, r.now())
+}
+
+// Replay observes a request logged before a restart, aged by the time of its
+// record. Records should be replayed oldest first.
+func (r *Recommender) Replay(record *decision.DecisionRecord) {
+	at := r.now()
+	if ts := record.GetTimestamp(); ts != nil && ts.AsTime().Before(at) {
+		at = ts.AsTime()
+	}
+	r.observe(record, at)
+}
+
+// observe counts the outcome of a request at the given time
+func (r *Recommender) observe(record *decision.DecisionRecord, at time.Time) {
+	routing := record.GetRouting()
+	app, model := routing.GetApplication(), routing.GetSelectedModel()
+	status := record.GetResponseStatus()
+	if app == "" || model == "" || record.GetCacheHit() || record.GetShadow() || status == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.statsFor(app, model, at)
+	s.requests++
+	if status >= 500 {
+		s.errors++
+	} else if seconds := record.GetUsage().GetCompletionSeconds(); seconds > 0 && status < 400 {
+		s.latencySum += seconds
+		s.latencyN++
+	}
+
+	if id := record.GetRequestId(); id != "" {
+		if _, ok := r.requests[id]; !ok {
+			r.order = append(r.order, id)
+		}
+		r.requests[id] = served{application: app, model: model}
+		if len(r.order) > r.options.MaxTrackedRequests {
+			delete(r.requests, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+}
+
+// statsFor returns the observations of a model serving an application decayed
+// to now, creating them if needed. r.mu must be held.
+func (r *Recommender) statsFor(app, model string, now time.Time) *stats {
+	models, ok := r.apps[app]
+	if !ok {
+		models = make(map[string]*stats)
+		r.apps[app] = models
+	}
+	s, ok := models[model]
+	if !ok {
+		s = &stats{}
+		models[model] = s
+	}
+	s.decay(now, r.options.HalfLife)
+	return s
+}
+
+// Feedback records whether the client was satisfied with the response to a
+// recent request
+func (r *Recommender) Feedback(requestID string, positive bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	req, ok := r.requests[requestID]
+	if !ok {
+		return ErrUnknownRequest
+	}
+	s := r.statsFor(req.application, req.model, r.now())
+	if positive {
+		s.positive++
+	} else {
+		s.negative++
+	}
+	return nil
+}
+
+// Recommendations returns the recommended default model of each configured
+// application that made requests, in config order
+func (r *Recommender) Recommendations(apps []config.ApplicationConfig) []Recommendation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var recommendations []Recommendation
+	for _, app := range apps {
+		if _, ok := r.apps[app.Name]; ok {
+			recommendations = append(recommendations, r.recommend(app.Name, app.Model))
+		}
+	}
+	return recommendations
+}
+
+// Recommended returns the model recommended over the application's configured
+// model, empty when there is none
+func (r *Recommender) Recommended(app *config.ApplicationConfig) string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.apps[app.Name]; !ok {
+		return ""
+	}
+	return r.recommend(app.Name, app.Model).RecommendedModel
+}
+
+// recommend scores the models that served an application against its current
+// default. Without enough requests of the current model, the baseline is all
+// of the application's requests. r.mu must be held.
+func (r *Recommender) recommend(app, current string) Recommendation {
+	rec := Recommendation{Application: app, CurrentModel: current}
+	var total stats
+	baseline := -1.0
+	for model, s := range r.apps[app] {
+		s.decay(r.now(), r.options.HalfLife)
+		stat := r.modelStats(model, s)
+		rec.Models = append(rec.Models, stat)
+		total.requests += s.requests
+		total.errors += s.errors
+		total.latencySum += s.latencySum
+		total.latencyN += s.latencyN
+		total.positive += s.positive
+		total.negative += s.negative
+		if model == current && r.scored(s) {
+			baseline = stat.Score
+		}
+	}
+	sort.Slice(rec.Models, func(i, j int) bool {
+		if rec.Models[i].Score != rec.Models[j].Score {
+			return rec.Models[i].Score > rec.Models[j].Score
+		}
+		return rec.Models[i].Model < rec.Models[j].Model
+	})
+	if baseline < 0 {
+		if !r.scored(&total) {
+			return rec
+		}
+		baseline = r.modelStats("", &total).Score
+	}
+
+	best := rec.Models[0]
+	if best.Score <= 0 || best.Model == current {
+		return rec
+	}
+	if baseline == 0 {
+		// Every request of the current default failed
+		rec.RecommendedModel = best.Model
+	} else if improvement := best.Score/baseline - 1; improvement >= r.options.MinImprovement {
+		rec.RecommendedModel = best.Model
+		rec.Improvement = improvement
+	}
+	return rec
+}
+
+// scored returns whether observations are numerous enough to be scored
+func (r *Recommender) scored(s *stats) bool {
+	return s.requests >= float64(r.options.MinRequests)
+}
+
+// modelStats describes and scores observations. The score is the success
+// rate, raised by positive and lowered by negative feedback, and discounted
+// by mean latency.
+func (r *Recommender) modelStats(model string, s *stats) ModelStats {
+	stat := ModelStats{
+		Model:            model,
+		Requests:         s.requests,
+		Errors:           s.errors,
+		PositiveFeedback: s.positive,
+		NegativeFeedback: s.negative,
+	}
+	if s.requests > 0 {
+		stat.ErrorRate = s.errors / s.requests
+	}
+	if s.latencyN > 0 {
+		stat.MeanLatencySeconds = s.latencySum / s.latencyN
+	}
+	if !r.scored(s) {
+		return stat
+	}
+	feedback := 0.0
+	if votes := s.positive + s.negative; votes > 0 {
+		feedback = (s.positive - s.negative) / votes
+	}
+	stat.Score = (1 - stat.ErrorRate) * (1 + r.options.FeedbackWeight*feedback) /
+		(1 + r.options.LatencyWeight*stat.MeanLatencySeconds)
+	return stat
+}
@@ -0,0 +1,144 @@
+package recommend
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/config"
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/decision"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// observe writes n records of an application's requests served by the model
+func observe(r *Recommender, app, model string, n int, status int32, seconds float64) {
+	for i := 0; i < n; i++ {
+		record := decision.New(fmt.Sprintf("%s-%s-%d", app, model, i))
+		record.Routing.Application = app
+		record.Routing.SelectedModel = model
+		record.ResponseStatus = status
+		record.Usage.CompletionSeconds = seconds
+		r.Write(record)
+	}
+}
+
+func TestRecommendations(t *testing.T) {
+	r := New(Options{MinRequests: 10})
+	apps := []config.ApplicationConfig{
+		{Name: "coder", Model: "slow-model"},
+		{Name: "idle", Model: "slow-model"},
+		{Name: "chat"},
+	}
+	observe(r, "coder", "slow-model", 20, 200, 8)
+	observe(r, "coder", "fast-model", 20, 200, 1)
+	observe(r, "coder", "new-model", 5, 200, 0.1)
+	observe(r, "chat", "fast-model", 20, 200, 1)
+	observe(r, "chat", "flaky-model", 10, 503, 0)
+	observe(r, "chat", "flaky-model", 10, 200, 1)
+
+	recommendations := r.Recommendations(apps)
+	if len(recommendations) != 2 {
+		t.Fatalf("got %d recommendations, want 2 for the applications with requests", len(recommendations))
+	}
+	coder := recommendations[0]
+	if coder.Application != "coder" || coder.RecommendedModel != "fast-model" || coder.Improvement <= 0 {
+		t.Errorf("unexpected coder recommendation: %+v", coder)
+	}
+	if last := coder.Models[len(coder.Models)-1]; last.Model != "new-model" || last.Score != 0 {
+		t.Errorf("model without enough requests scored: %+v", last)
+	}
+	// Classified requests are compared with the mix of models serving them
+	chat := recommendations[1]
+	if chat.RecommendedModel != "fast-model" || chat.Models[1].ErrorRate != 0.5 {
+		t.Errorf("unexpected chat recommendation: %+v", chat)
+	}
+	if got := r.Recommended(&apps[0]); got != "fast-model" {
+		t.Errorf("Recommended = %q, want fast-model", got)
+	}
+	if got := r.Recommended(&config.ApplicationConfig{Name: "coder", Model: "fast-model"}); got != "" {
+		t.Errorf("recommended %q over the best model", got)
+	}
+
+	var none *Recommender
+	if none.Recommended(&apps[0]) != "" {
+		t.Error("a nil recommender recommended a model")
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	r := New(Options{MinRequests: 10, MaxTrackedRequests: 15})
+	app := config.ApplicationConfig{Name: "coder", Model: "model-a"}
+	observe(r, "coder", "model-a", 10, 200, 1)
+	observe(r, "coder", "model-b", 10, 200, 1)
+	if got := r.Recommended(&app); got != "" {
+		t.Fatalf("recommended %q between equal models", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := r.Feedback(fmt.Sprintf("coder-model-b-%d", i+5), true); err != nil {
+			t.Fatalf("Feedback: %v", err)
+		}
+	}
+	if got := r.Recommended(&app); got != "model-b" {
+		t.Errorf("Recommended = %q after positive feedback, want model-b", got)
+	}
+	// The oldest requests are forgotten past MaxTrackedRequests
+	if err := r.Feedback("coder-model-a-0", false); !errors.Is(err, ErrUnknownRequest) {
+		t.Errorf("feedback on a forgotten request returned %v", err)
+	}
+}
+
+func TestIgnoredRecords(t *testing.T) {
+	r := New(Options{})
+	record := decision.New("hit")
+	record.Routing.Application = "coder"
+	record.Routing.SelectedModel = "model-a"
+	record.ResponseStatus = 200
+	record.CacheHit = true
+	r.Write(record)
+	observe(r, "", "model-a", 1, 200, 1)
+	observe(r, "coder", "model-a", 1, 0, 1)
+	if got := r.Recommendations([]config.ApplicationConfig{{Name: "coder"}}); len(got) != 0 {
+		t.Errorf("cache hits, unknown applications and requests without a response were observed: %+v", got)
+	}
+}
+
+func TestDecay(t *testing.T) {
+	now := time.Now()
+	r := New(Options{HalfLife: time.Hour})
+	r.now = func() time.Time { return now }
+	observe(r, "coder", "model-a", 8, 200, 1)
+	now = now.Add(2 * time.Hour)
+
+	models := r.Recommendations([]config.ApplicationConfig{{Name: "coder"}})[0].Models
+	if got := models[0].Requests; math.Abs(got-2) > 1e-9 {
+		t.Errorf("requests after two half-lives = %v, want 2", got)
+	}
+	if got := models[0].MeanLatencySeconds; math.Abs(got-1) > 1e-9 {
+		t.Errorf("mean latency changed with decay: %v", got)
+	}
+}
+
+func TestReplayAgesRecords(t *testing.T) {
+	now := time.Now()
+	r := New(Options{HalfLife: time.Hour})
+	r.now = func() time.Time { return now }
+	for i := 0; i < 8; i++ {
+		record := decision.New(fmt.Sprintf("old-%d", i))
+		record.Timestamp = timestamppb.New(now.Add(-2 * time.Hour))
+		record.Routing.Application = "coder"
+		record.Routing.SelectedModel = "model-a"
+		record.ResponseStatus = 200
+		r.Replay(record)
+	}
+
+	models := r.Recommendations([]config.ApplicationConfig{{Name: "coder"}})[0].Models
+	if got := models[0].Requests; math.Abs(got-2) > 1e-9 {
+		t.Errorf("requests replayed from two half-lives ago = %v, want 2", got)
+	}
+	if err := r.Feedback("old-0", true); err != nil {
+		t.Errorf("feedback on a replayed request: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Package registration announces a router instance to a control plane on
+// startup and keeps it registered with heartbeats, so operators get an
+// inventory of the fleet without scraping every replica.
+package registration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Events an announcement reports
+const (
+	EventRegister   = "register"
+	EventHeartbeat  = "heartbeat"
+	EventDeregister = "deregister"
+)
+
+// Instance describes a router instance as announced
+type Instance struct {
+	ID string `json:"instance_id"`
+	// ext_proc address, host:port
+	Address string `json:"address"`
+	Version string `json:"version"`
+	// Version of the router's contract with the ext_proc filter
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+	ConfigHash      string   `json:"config_hash"`
+	RoutingHash     string   `json:"routing_hash"`
+	// Whether the instance is ready to process requests
+	Ready bool `json:"ready"`
+}
+
+// Announcement is the body POSTed to the control plane
+type Announcement struct {
+	Instance
+	Event     string    `json:"event"`
+	StartedAt time.Time `json:"started_at"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// Options holds options for creating a new registration client
+type Options struct {
+	// Endpoint announcements are POSTed to
+	URL string
+	// Authorization header value, if any
+	Authorization string
+	// Describes the instance at the time of each announcement, so heartbeats
+	// report reloaded configs and readiness
+	Instance func() Instance
+	// Time between heartbeats, and between retries of a failed registration,
+	// defaults to 30s
+	Interval time.Duration
+	// Timeout of a single announcement, defaults to 5s
+	Timeout time.Duration
+	// HTTP client, defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Client registers the instance with the control plane in the background.
+// A control plane that is down only delays registration, retried every
+// interval, and a heartbeat it answers with 404 or 410 registers the
+// instance again, so the inventory recovers from control plane restarts.
+type Client struct {
+	options   Options
+	startedAt time.Time
+	started   atomic.Bool
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+
+	mu         sync.Mutex
+	registered bool
+}
+
+// New creates a registration client with the given options. It does not
+// contact the control plane until Start.
+func New(options Options) (*Client, error) {
+	if u, err := url.Parse(options.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid control plane URL %q", options.URL)
+	}
+	if options.Instance == nil {
+		return nil, fmt.Errorf("instance description is required")
+	}
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	return &Client{
+		options:   options,
+		startedAt: time.Now(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Start registers the instance and sends heartbeats in the background
+func (c *Client) Start() {
+	log.Printf("Registering with control plane %s, heartbeat every %s", c.options.URL, c.options.Interval)
+	c.started.Store(true)
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.options.Interval)
+		defer ticker.Stop()
+		for {
+			c.announce()
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the heartbeats and deregisters the instance if it was registered
+func (c *Client) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+		if !c.started.Load() {
+			return
+		}
+		<-c.done
+		if c.Registered() {
+			if _, err := c.send(EventDeregister); err != nil {
+				log.Printf("Error deregistering from control plane: %v", err)
+			}
+		}
+	})
+}
+
+// Registered returns whether the control plane accepted the registration
+func (c *Client) Registered() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.registered
+}
+
+// announce registers the instance, or sends a heartbeat once it is registered
+func (c *Client) announce() {
+	event := EventRegister
+	if c.Registered() {
+		event = EventHeartbeat
+	}
+	status, err := c.send(event)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case event == EventHeartbeat && (status == http.StatusNotFound || status == http.StatusGone):
+		log.Printf("Control plane no longer knows this instance, registering again")
+		c.registered = false
+	case err != nil:
+		log.Printf("Error sending %s to control plane: %v", event, err)
+	case event == EventRegister:
+		log.Printf("Registered with control plane %s", c.options.URL)
+		c.registered = true
+	}
+}
+
+// send POSTs an announcement, returning the response status, 0 if none
+func (c *Client) send(event string) (int, error) {
+	body, err := json.Marshal(Announcement{
+		Instance:  c.options.Instance(),
+		Event:     event,
+		StartedAt: c.startedAt,
+		SentAt:    time.Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.options.Authorization != "" {
+		req.Header.Set("Authorization", c.options.Authorization)
+	}
+	resp, err := c.options.Client.Do(req)
+	if err != nil {
+		metrics.RecordRegistrationAnnouncement(event, false)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		metrics.RecordRegistrationAnnouncement(event, false)
+		return resp.StatusCode, fmt.Errorf("control plane returned %s", resp.Status)
+	}
+	metrics.RecordRegistrationAnnouncement(event, true)
+	return resp.StatusCode, nil
+}
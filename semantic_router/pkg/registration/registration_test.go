@@ -0,0 +1,162 @@
+package registration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// controlPlane records announcements, forgetting the instance on demand
+type controlPlane struct {
+	mu            sync.Mutex
+	events        []string
+	announcements []Announcement
+	forget        bool
+}
+
+func (p *controlPlane) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var announcement Announcement
+	if err := json.NewDecoder(r.Body).Decode(&announcement); err != nil || r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, announcement.Event)
+	p.announcements = append(p.announcements, announcement)
+	if p.forget && announcement.Event == EventHeartbeat {
+		p.forget = false
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (p *controlPlane) snapshot() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.events)
+}
+
+func TestClientLifecycle(t *testing.T) {
+	plane := &controlPlane{}
+	server := httptest.NewServer(plane)
+	defer server.Close()
+
+	var mu sync.Mutex
+	configHash := "a"
+	client, err := New(Options{
+		URL:           server.URL,
+		Authorization: "Bearer token",
+		Interval:      10 * time.Millisecond,
+		Instance: func() Instance {
+			mu.Lock()
+			defer mu.Unlock()
+			return Instance{ID: "router-0", Address: "router-0:50051", ProtocolVersion: 1, ConfigHash: configHash, Ready: true}
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	client.Start()
+
+	waitFor := func(what string, done func(events []string) bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done(plane.snapshot()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s, got events %v", what, plane.snapshot())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor("a heartbeat", func(events []string) bool { return slices.Contains(events, EventHeartbeat) })
+	if !client.Registered() {
+		t.Error("client not registered after a heartbeat")
+	}
+
+	// A control plane that forgot the instance gets it registered again,
+	// with its reloaded config
+	mu.Lock()
+	configHash = "b"
+	mu.Unlock()
+	plane.mu.Lock()
+	plane.forget = true
+	seen := len(plane.events)
+	plane.mu.Unlock()
+	waitFor("a new registration", func(events []string) bool {
+		return slices.Contains(events[seen:], EventRegister)
+	})
+
+	client.Stop()
+	client.Stop()
+	events := plane.snapshot()
+	if events[0] != EventRegister || events[len(events)-1] != EventDeregister {
+		t.Errorf("events = %v, want a registration first and a deregistration last", events)
+	}
+	plane.mu.Lock()
+	last := plane.announcements[len(plane.announcements)-1]
+	plane.mu.Unlock()
+	if last.ID != "router-0" || last.ConfigHash != "b" || last.StartedAt.IsZero() {
+		t.Errorf("last announcement = %+v", last)
+	}
+}
+
+func TestClientRetriesRegistration(t *testing.T) {
+	var mu sync.Mutex
+	failures := 2
+	var events []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var announcement Announcement
+		json.NewDecoder(r.Body).Decode(&announcement)
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, announcement.Event)
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Options{URL: server.URL, Interval: 5 * time.Millisecond, Instance: func() Instance { return Instance{ID: "router-0"} }})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	client.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for !client.Registered() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the registration")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	client.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) < 3 || events[0] != EventRegister || events[1] != EventRegister || events[2] != EventRegister {
+		t.Errorf("events = %v, want registrations retried until accepted", events)
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	instance := func() Instance { return Instance{} }
+	for name, options := range map[string]Options{
+		"no URL":      {Instance: instance},
+		"not HTTP":    {URL: "grpc://control-plane:9000", Instance: instance},
+		"no instance": {URL: "http://control-plane:9000/instances"},
+	} {
+		if _, err := New(options); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// A client that never started stops without contacting anyone
+	client, err := New(Options{URL: "http://127.0.0.1:1/instances", Instance: instance})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	client.Stop()
+}
@@ -0,0 +1,167 @@
+package replay
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+// RedactedValue replaces the values of redacted headers
+const RedactedValue = "[REDACTED]"
+
+// RecorderOptions holds options for creating a new recorder
+type RecorderOptions struct {
+	// Directory recordings are written to, one file per stream
+	Directory string
+	// Fraction of streams recorded, default 1
+	SampleRate float64
+	// Most recordings this recorder keeps, removing the oldest past it,
+	// default 1000
+	MaxFiles int
+	// Headers whose values are redacted
+	RedactHeaders []string
+}
+
+// Recorder writes recordings of sampled streams to a directory
+type Recorder struct {
+	options  RecorderOptions
+	redacted map[string]bool
+	sequence atomic.Uint64
+	mu       sync.Mutex
+	// Recordings written, oldest first
+	written []string
+}
+
+// NewRecorder creates a recorder with the given options, creating its
+// directory
+func NewRecorder(options RecorderOptions) (*Recorder, error) {
+	if options.Directory == "" {
+		return nil, fmt.Errorf("directory is required")
+	}
+	if options.SampleRate < 0 || options.SampleRate > 1 {
+		return nil, fmt.Errorf("sample_rate must be between 0 and 1")
+	}
+	if options.SampleRate == 0 {
+		options.SampleRate = 1
+	}
+	if options.MaxFiles <= 0 {
+		options.MaxFiles = 1000
+	}
+	if err := os.MkdirAll(options.Directory, 0o755); err != nil {
+		return nil, err
+	}
+	redacted := make(map[string]bool, len(options.RedactHeaders))
+	for _, name := range options.RedactHeaders {
+		redacted[strings.ToLower(name)] = true
+	}
+	return &Recorder{options: options, redacted: redacted}, nil
+}
+
+// Record returns the stream to process instead of stream, recording its
+// messages when it is sampled, and a function writing the recording once the
+// stream ends. A nil Recorder records nothing.
+func (r *Recorder) Record(stream ext_proc.ExternalProcessor_ProcessServer) (ext_proc.ExternalProcessor_ProcessServer, func()) {
+	if r == nil || rand.Float64() >= r.options.SampleRate {
+		return stream, func() {}
+	}
+	recording := &recordingStream{ExternalProcessor_ProcessServer: stream, recorder: r, rec: &Recording{RecordedAt: time.Now().UTC()}}
+	return recording, recording.finish
+}
+
+// redact returns a copy of a request with the values of redacted headers
+// replaced
+func (r *Recorder) redact(req *ext_proc.ProcessingRequest) *ext_proc.ProcessingRequest {
+	clone := proto.Clone(req).(*ext_proc.ProcessingRequest)
+	var headers *core.HeaderMap
+	switch v := clone.Request.(type) {
+	case *ext_proc.ProcessingRequest_RequestHeaders:
+		headers = v.RequestHeaders.GetHeaders()
+	case *ext_proc.ProcessingRequest_ResponseHeaders:
+		headers = v.ResponseHeaders.GetHeaders()
+	case *ext_proc.ProcessingRequest_RequestTrailers:
+		headers = v.RequestTrailers.GetTrailers()
+	case *ext_proc.ProcessingRequest_ResponseTrailers:
+		headers = v.ResponseTrailers.GetTrailers()
+	}
+	for _, header := range headers.GetHeaders() {
+		if !r.redacted[strings.ToLower(header.GetKey())] {
+			continue
+		}
+		if header.Value != "" {
+			header.Value = RedactedValue
+		}
+		if len(header.RawValue) > 0 {
+			header.RawValue = []byte(RedactedValue)
+		}
+	}
+	return clone
+}
+
+// write writes a recording and removes the oldest past the maximum
+func (r *Recorder) write(rec *Recording) {
+	data, err := Marshal(rec)
+	if err != nil {
+		log.Printf("Error encoding stream recording: %v", err)
+		return
+	}
+	name := fmt.Sprintf("%s-%06d%s", rec.RecordedAt.Format("20060102T150405.000000000"), r.sequence.Add(1), Extension)
+	path := filepath.Join(r.options.Directory, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		log.Printf("Error writing stream recording: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written = append(r.written, path)
+	for len(r.written) > r.options.MaxFiles {
+		if err := os.Remove(r.written[0]); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing old stream recording: %v", err)
+		}
+		r.written = r.written[1:]
+	}
+}
+
+// recordingStream records the messages of a stream
+type recordingStream struct {
+	ext_proc.ExternalProcessor_ProcessServer
+	recorder *Recorder
+	mu       sync.Mutex
+	rec      *Recording
+}
+
+func (s *recordingStream) Recv() (*ext_proc.ProcessingRequest, error) {
+	req, err := s.ExternalProcessor_ProcessServer.Recv()
+	if err == nil {
+		s.mu.Lock()
+		s.rec.Requests = append(s.rec.Requests, s.recorder.redact(req))
+		s.mu.Unlock()
+	}
+	return req, err
+}
+
+func (s *recordingStream) Send(resp *ext_proc.ProcessingResponse) error {
+	s.mu.Lock()
+	s.rec.Responses = append(s.rec.Responses, proto.Clone(resp).(*ext_proc.ProcessingResponse))
+	s.mu.Unlock()
+	return s.ExternalProcessor_ProcessServer.Send(resp)
+}
+
+// finish writes the recording of a stream that received any message
+func (s *recordingStream) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.rec.Requests) > 0 {
+		s.recorder.write(s.rec)
+	}
+}
@@ -0,0 +1,226 @@
+// Package replay records the ext_proc streams Envoy opens with the router and
+// feeds recordings back through a processor in memory, so routing issues can
+// be reproduced from the exact messages Envoy sent, in regression tests and
+// benchmarks without Envoy or an upstream.
+//
+// A recording is a JSON document holding the stream's requests and the
+// responses the router sent, each encoded with protojson. Credential headers
+// are redacted when recording; bodies are kept as sent.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Extension of recording files
+const Extension = ".json"
+
+// Recording is the messages Envoy sent on a stream and the responses the
+// router sent back
+type Recording struct {
+	RecordedAt time.Time
+	Requests   []*ext_proc.ProcessingRequest
+	Responses  []*ext_proc.ProcessingResponse
+}
+
+// encodedRecording is the file format of a recording
+type encodedRecording struct {
+	RecordedAt time.Time         `json:"recorded_at"`
+	Requests   []json.RawMessage `json:"requests"`
+	Responses  []json.RawMessage `json:"responses"`
+}
+
+// Marshal encodes a recording
+func Marshal(rec *Recording) ([]byte, error) {
+	encoded := encodedRecording{
+		RecordedAt: rec.RecordedAt,
+		Requests:   make([]json.RawMessage, 0, len(rec.Requests)),
+		Responses:  make([]json.RawMessage, 0, len(rec.Responses)),
+	}
+	for _, req := range rec.Requests {
+		data, err := protojson.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Requests = append(encoded.Requests, data)
+	}
+	for _, resp := range rec.Responses {
+		data, err := protojson.Marshal(resp)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Responses = append(encoded.Responses, data)
+	}
+	return json.MarshalIndent(encoded, "", "  ")
+}
+
+// Unmarshal decodes a recording
+func Unmarshal(data []byte) (*Recording, error) {
+	var encoded encodedRecording
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	rec := &Recording{RecordedAt: encoded.RecordedAt}
+	for i, data := range encoded.Requests {
+		req := &ext_proc.ProcessingRequest{}
+		if err := protojson.Unmarshal(data, req); err != nil {
+			return nil, fmt.Errorf("request %d: %w", i, err)
+		}
+		rec.Requests = append(rec.Requests, req)
+	}
+	for i, data := range encoded.Responses {
+		resp := &ext_proc.ProcessingResponse{}
+		if err := protojson.Unmarshal(data, resp); err != nil {
+			return nil, fmt.Errorf("response %d: %w", i, err)
+		}
+		rec.Responses = append(rec.Responses, resp)
+	}
+	return rec, nil
+}
+
+// Load reads a recording file
+func Load(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+	}
+	return rec, nil
+}
+
+// Paths returns the recording files among paths, listing the recordings of
+// directories in name order
+func Paths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), Extension) {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+	return files, nil
+}
+
+// Processor processes ext_proc streams, such as the router
+type Processor interface {
+	Process(stream ext_proc.ExternalProcessor_ProcessServer) error
+}
+
+// Replay feeds the requests of a recording through a processor and returns
+// the responses it sent. The stream ending once the requests run out is not
+// an error.
+func Replay(ctx context.Context, processor Processor, rec *Recording) ([]*ext_proc.ProcessingResponse, error) {
+	stream := NewStream(ctx, rec.Requests)
+	if err := processor.Process(stream); err != nil && err != io.EOF {
+		return stream.Responses(), err
+	}
+	return stream.Responses(), nil
+}
+
+// Compare returns the differences between the responses of a recording and
+// those replaying it produced, nil when they match. Dynamic metadata is
+// ignored, as it carries timings that differ between runs.
+func Compare(recorded, replayed []*ext_proc.ProcessingResponse) []string {
+	var diffs []string
+	for i := 0; i < max(len(recorded), len(replayed)); i++ {
+		switch {
+		case i >= len(recorded):
+			diffs = append(diffs, fmt.Sprintf("response %d: unexpected %s", i, describe(replayed[i])))
+		case i >= len(replayed):
+			diffs = append(diffs, fmt.Sprintf("response %d: missing %s", i, describe(recorded[i])))
+		default:
+			want, got := withoutMetadata(recorded[i]), withoutMetadata(replayed[i])
+			if !proto.Equal(want, got) {
+				diffs = append(diffs, fmt.Sprintf("response %d: recorded %s, replayed %s", i, describe(want), describe(got)))
+			}
+		}
+	}
+	return diffs
+}
+
+// withoutMetadata returns a copy of a response without its dynamic metadata
+func withoutMetadata(resp *ext_proc.ProcessingResponse) *ext_proc.ProcessingResponse {
+	clone := proto.Clone(resp).(*ext_proc.ProcessingResponse)
+	clone.DynamicMetadata = nil
+	return clone
+}
+
+// describe summarizes a response in one line
+func describe(resp *ext_proc.ProcessingResponse) string {
+	data, err := protojson.Marshal(resp)
+	if err != nil {
+		return fmt.Sprintf("%T", resp.GetResponse())
+	}
+	return string(data)
+}
+
+// Stream is an in-memory ext_proc stream serving a fixed list of requests and
+// collecting the responses sent on it
+type Stream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	requests  []*ext_proc.ProcessingRequest
+	responses []*ext_proc.ProcessingResponse
+}
+
+// NewStream creates a stream serving requests, then io.EOF
+func NewStream(ctx context.Context, requests []*ext_proc.ProcessingRequest) *Stream {
+	return &Stream{ctx: ctx, requests: requests}
+}
+
+func (s *Stream) Recv() (*ext_proc.ProcessingRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *Stream) Send(resp *ext_proc.ProcessingResponse) error {
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Responses returns the responses sent on the stream
+func (s *Stream) Responses() []*ext_proc.ProcessingResponse {
+	return s.responses
+}
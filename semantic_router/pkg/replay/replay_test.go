@@ -0,0 +1,115 @@
+package replay
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// echoProcessor answers each message with a response naming the body it got
+type echoProcessor struct{}
+
+func (echoProcessor) Process(stream ext_proc.ExternalProcessor_ProcessServer) error {
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		resp := &ext_proc.ProcessingResponse{Response: &ext_proc.ProcessingResponse_RequestHeaders{RequestHeaders: &ext_proc.HeadersResponse{}}}
+		if body := req.GetRequestBody(); body != nil {
+			resp = &ext_proc.ProcessingResponse{Response: &ext_proc.ProcessingResponse_RequestBody{RequestBody: &ext_proc.BodyResponse{
+				Response: &ext_proc.CommonResponse{BodyMutation: &ext_proc.BodyMutation{Mutation: &ext_proc.BodyMutation_Body{Body: body.GetBody()}}},
+			}}}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func requests(body string) []*ext_proc.ProcessingRequest {
+	return []*ext_proc.ProcessingRequest{
+		{Request: &ext_proc.ProcessingRequest_RequestHeaders{RequestHeaders: &ext_proc.HttpHeaders{Headers: &core.HeaderMap{Headers: []*core.HeaderValue{
+			{Key: "Authorization", RawValue: []byte("Bearer sk-secret")},
+			{Key: "x-request-id", RawValue: []byte("req-1")},
+		}}}}},
+		{Request: &ext_proc.ProcessingRequest_RequestBody{RequestBody: &ext_proc.HttpBody{Body: []byte(body), EndOfStream: true}}},
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := NewRecorder(RecorderOptions{Directory: dir, MaxFiles: 2, RedactHeaders: []string{"authorization"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		stream, finish := recorder.Record(NewStream(context.Background(), requests(body)))
+		if err := (echoProcessor{}).Process(stream); err != io.EOF {
+			t.Fatalf("Process returned %v", err)
+		}
+		finish()
+	}
+
+	paths, err := Paths([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("kept %d recordings, want 2", len(paths))
+	}
+	rec, err := Load(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Requests) != 2 || len(rec.Responses) != 2 || rec.RecordedAt.IsZero() {
+		t.Fatalf("unexpected recording %+v", rec)
+	}
+	headers := rec.Requests[0].GetRequestHeaders().GetHeaders().GetHeaders()
+	if string(headers[0].GetRawValue()) != RedactedValue || string(headers[1].GetRawValue()) != "req-1" {
+		t.Errorf("headers not redacted as configured: %v", headers)
+	}
+	if string(rec.Requests[1].GetRequestBody().GetBody()) != `{"n":3}` {
+		t.Errorf("newest recording has body %q", rec.Requests[1].GetRequestBody().GetBody())
+	}
+
+	replayed, err := Replay(context.Background(), echoProcessor{}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := Compare(rec.Responses, replayed); diffs != nil {
+		t.Errorf("replay differs: %v", diffs)
+	}
+	other, _ := Replay(context.Background(), echoProcessor{}, &Recording{Requests: requests(`{"n":4}`)[:1]})
+	if diffs := Compare(rec.Responses, other); len(diffs) != 1 {
+		t.Errorf("Compare found %d differences, want 1: %v", len(diffs), diffs)
+	}
+}
+
+func TestRecorderSampling(t *testing.T) {
+	if _, err := NewRecorder(RecorderOptions{Directory: t.TempDir(), SampleRate: 2}); err == nil {
+		t.Error("sample rate above 1 accepted")
+	}
+	var recorder *Recorder
+	stream := NewStream(context.Background(), nil)
+	if recorded, _ := recorder.Record(stream); recorded != stream {
+		t.Error("a nil recorder wrapped the stream")
+	}
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(RecorderOptions{Directory: filepath.Join(dir, "nested")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Streams closed before any message are not written
+	_, finish := recorder.Record(NewStream(context.Background(), nil))
+	finish()
+	if entries, _ := os.ReadDir(filepath.Join(dir, "nested")); len(entries) != 0 {
+		t.Errorf("wrote %d recordings of an empty stream", len(entries))
+	}
+}
@@ -0,0 +1,20 @@
+// Package reuseport binds listening sockets with SO_REUSEPORT, so that a new
+// router process can bind the addresses of the running one and start accepting
+// before the old process drains and exits.
+package reuseport
+
+import (
+	"context"
+	"net"
+)
+
+// Listen binds a TCP address with SO_REUSEPORT set. Other networks, such as
+// unix sockets, are bound normally.
+func Listen(network, address string) (net.Listener, error) {
+	config := net.ListenConfig{}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		config.Control = control
+	}
+	return config.Listen(context.Background(), network, address)
+}
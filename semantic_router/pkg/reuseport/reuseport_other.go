@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package reuseport
+
+import (
+	"errors"
+	"syscall"
+)
+
+// control fails on platforms without SO_REUSEPORT
+func control(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -0,0 +1,27 @@
+package reuseport
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenSharesAddress(t *testing.T) {
+	first, err := Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer first.Close()
+
+	// A second process, e.g. the new binary during a restart, binds the same address
+	second, err := Listen("tcp4", first.Addr().String())
+	if err != nil {
+		t.Fatalf("second Listen on %s: %v", first.Addr(), err)
+	}
+	defer second.Close()
+
+	// Without SO_REUSEPORT the address stays taken
+	if lis, err := net.Listen("tcp4", first.Addr().String()); err == nil {
+		lis.Close()
+		t.Errorf("plain listen on %s succeeded, want address in use", first.Addr())
+	}
+}
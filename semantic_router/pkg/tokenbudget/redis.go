@@ -0,0 +1,87 @@
+package tokenbudget
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisOptions holds options for creating a new Redis counter
+type RedisOptions struct {
+	// Address of the Redis server, host:port
+	Address  string
+	Password string
+	DB       int
+	// Prefix of every key the counter writes, defaults to "token-budget:"
+	KeyPrefix string
+	// Timeout of a single operation, defaults to 1s
+	Timeout time.Duration
+}
+
+// RedisCounter counts tokens in Redis, so budgets are shared by every replica
+// of the router and survive restarts. Each key is a string incremented by
+// INCRBY, expiring when its window ends.
+type RedisCounter struct {
+	client  *redis.Client
+	options RedisOptions
+}
+
+// NewRedisCounter creates a new Redis counter; it connects lazily, on first use
+func NewRedisCounter(options RedisOptions) *RedisCounter {
+	if options.KeyPrefix == "" {
+		options.KeyPrefix = "token-budget:"
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+	return &RedisCounter{
+		client: redis.NewClient(&redis.Options{
+			Addr:     options.Address,
+			Password: options.Password,
+			DB:       options.DB,
+		}),
+		options: options,
+	}
+}
+
+// Ping checks that the Redis server is reachable
+func (c *RedisCounter) Ping() error {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the connections to the Redis server
+func (c *RedisCounter) Close() error {
+	return c.client.Close()
+}
+
+func (c *RedisCounter) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.options.Timeout)
+}
+
+// Get returns the tokens counted for a key
+func (c *RedisCounter) Get(key string) (int64, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	tokens, err := c.client.Get(ctx, c.options.KeyPrefix+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return tokens, err
+}
+
+// Add counts tokens for a key. Keys are named after their window, which every
+// Add ends them with, so refreshing the expiry keeps it.
+func (c *RedisCounter) Add(key string, tokens int64, ttl time.Duration) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, c.options.KeyPrefix+key, tokens)
+		pipe.Expire(ctx, c.options.KeyPrefix+key, ttl)
+		return nil
+	})
+	return err
+}
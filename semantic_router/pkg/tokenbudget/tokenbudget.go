@@ -0,0 +1,201 @@
+// Package tokenbudget accounts the prompt and completion tokens of each client
+// identity and rejects clients that used up their hourly or daily budget.
+package tokenbudget
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/neuralmagic/semantic_router_poc/semantic_router/pkg/metrics"
+)
+
+// Budget periods, which start at the top of the hour and at midnight UTC
+const (
+	PeriodHour = "hour"
+	PeriodDay  = "day"
+)
+
+// Limits are the token budgets of a client; 0 is unlimited
+type Limits struct {
+	Hourly int64
+	Daily  int64
+}
+
+// Counter counts tokens by key
+type Counter interface {
+	// Get returns the tokens counted for a key, 0 for unknown keys
+	Get(key string) (int64, error)
+	// Add counts tokens for a key, which is forgotten once ttl passes; callers
+	// pass the time left in the key's window
+	Add(key string, tokens int64, ttl time.Duration) error
+}
+
+// Options holds options for creating new token budgets
+type Options struct {
+	// Budgets of clients without their own
+	Default Limits
+	// Budgets of specific client identities
+	Identities map[string]Limits
+	// Counter the tokens of every client are kept in, in memory when nil
+	Counter Counter
+}
+
+// Exceeded describes a budget a client used up
+type Exceeded struct {
+	Period string
+	Limit  int64
+	Used   int64
+	// Time until the period ends and the budget is available again
+	RetryAfter time.Duration
+}
+
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("used %d of the %d tokens budgeted per %s", e.Used, e.Limit, e.Period)
+}
+
+// Budgets enforce the hourly and daily token budgets of client identities. A
+// nil Budgets allows every client.
+type Budgets struct {
+	options Options
+	now     func() time.Time
+}
+
+// New creates token budgets with the given options
+func New(options Options) *Budgets {
+	if options.Counter == nil {
+		options.Counter = NewMemoryCounter()
+	}
+	return &Budgets{options: options, now: time.Now}
+}
+
+// limits returns the budgets of a client
+func (b *Budgets) limits(identity string) Limits {
+	if limits, ok := b.options.Identities[identity]; ok {
+		return limits
+	}
+	return b.options.Default
+}
+
+// window is a period of a client's budget
+type window struct {
+	period string
+	limit  int64
+	start  time.Time
+	end    time.Time
+}
+
+// windows returns the current windows of the client's limited periods
+func (b *Budgets) windows(limits Limits) []window {
+	now := b.now().UTC()
+	var windows []window
+	if limits.Hourly > 0 {
+		start := now.Truncate(time.Hour)
+		windows = append(windows, window{PeriodHour, limits.Hourly, start, start.Add(time.Hour)})
+	}
+	if limits.Daily > 0 {
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		windows = append(windows, window{PeriodDay, limits.Daily, start, start.AddDate(0, 0, 1)})
+	}
+	return windows
+}
+
+// key returns the counter key of a client's window. Identities are hashed, as
+// they may be API keys.
+func key(identity string, w window) string {
+	sum := sha256.Sum256([]byte(identity))
+	return fmt.Sprintf("%s:%d:%s", w.period, w.start.Unix(), hex.EncodeToString(sum[:16]))
+}
+
+// Check returns the budget the client used up, nil while it has tokens left
+// in every budget. Clients whose usage cannot be read are let through.
+func (b *Budgets) Check(identity string) *Exceeded {
+	if b == nil {
+		return nil
+	}
+	now := b.now()
+	var exceeded *Exceeded
+	for _, w := range b.windows(b.limits(identity)) {
+		used, err := b.options.Counter.Get(key(identity, w))
+		if err != nil {
+			metrics.RecordTokenBudgetCounterError()
+			log.Printf("Error reading token budget usage, letting the request through: %v", err)
+			return nil
+		}
+		// The budget that frees up last is the one the client waits for
+		if used >= w.limit && (exceeded == nil || w.end.Sub(now) > exceeded.RetryAfter) {
+			exceeded = &Exceeded{Period: w.period, Limit: w.limit, Used: used, RetryAfter: w.end.Sub(now)}
+		}
+	}
+	return exceeded
+}
+
+// Record counts tokens used by the client against its budgets
+func (b *Budgets) Record(identity string, tokens int64) {
+	if b == nil || tokens <= 0 {
+		return
+	}
+	now := b.now()
+	for _, w := range b.windows(b.limits(identity)) {
+		if err := b.options.Counter.Add(key(identity, w), tokens, w.end.Sub(now)); err != nil {
+			metrics.RecordTokenBudgetCounterError()
+			log.Printf("Error counting %d tokens against the %s budget: %v", tokens, w.period, err)
+		}
+	}
+}
+
+// memoryEntry is the count of a key of a memory counter
+type memoryEntry struct {
+	tokens  int64
+	expires time.Time
+}
+
+// MemoryCounter counts tokens in memory, per replica
+type MemoryCounter struct {
+	mu        sync.Mutex
+	counts    map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryCounter creates an empty memory counter
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{counts: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Get returns the tokens counted for a key
+func (c *MemoryCounter) Get(key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.counts[key]
+	if !ok || !c.now().Before(entry.expires) {
+		return 0, nil
+	}
+	return entry.tokens, nil
+}
+
+// Add counts tokens for a key
+func (c *MemoryCounter) Add(key string, tokens int64, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	entry, ok := c.counts[key]
+	if !ok || !now.Before(entry.expires) {
+		entry = memoryEntry{expires: now.Add(ttl)}
+		// Windows of past periods are dropped as new ones start
+		if now.Sub(c.lastSweep) >= time.Minute {
+			for k, e := range c.counts {
+				if !now.Before(e.expires) {
+					delete(c.counts, k)
+				}
+			}
+			c.lastSweep = now
+		}
+	}
+	entry.tokens += tokens
+	c.counts[key] = entry
+	return nil
+}
@@ -0,0 +1,94 @@
+package tokenbudget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestBudgets(now *time.Time, counter Counter) *Budgets {
+	b := New(Options{
+		Default:    Limits{Hourly: 100, Daily: 150},
+		Identities: map[string]Limits{"batch": {Daily: 1000}},
+		Counter:    counter,
+	})
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func testBudgets(t *testing.T, counter Counter, now *time.Time) {
+	b := newTestBudgets(now, counter)
+
+	b.Record("alice", 60)
+	if exceeded := b.Check("alice"); exceeded != nil {
+		t.Fatalf("alice over budget after 60 tokens: %v", exceeded)
+	}
+	b.Record("alice", 40)
+	exceeded := b.Check("alice")
+	if exceeded == nil || exceeded.Period != PeriodHour || exceeded.Used != 100 || exceeded.RetryAfter != 30*time.Minute {
+		t.Fatalf("Check(alice) = %+v, want the hourly budget used up for 30m", exceeded)
+	}
+	if exceeded := b.Check("bob"); exceeded != nil {
+		t.Errorf("bob over budget: %v", exceeded)
+	}
+	// Clients with their own budgets are only limited by them
+	b.Record("batch", 500)
+	if exceeded := b.Check("batch"); exceeded != nil {
+		t.Errorf("batch over budget: %v", exceeded)
+	}
+
+	// The next hour frees the hourly budget, leaving 50 tokens of the day
+	*now = now.Add(time.Hour)
+	if exceeded := b.Check("alice"); exceeded != nil {
+		t.Fatalf("alice over budget in the next hour: %v", exceeded)
+	}
+	b.Record("alice", 50)
+	exceeded = b.Check("alice")
+	if exceeded == nil || exceeded.Period != PeriodDay || exceeded.Limit != 150 || exceeded.RetryAfter != 10*time.Hour+30*time.Minute {
+		t.Errorf("Check(alice) = %+v, want the daily budget used up until midnight", exceeded)
+	}
+}
+
+func TestBudgets(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		now := time.Date(2025, 1, 15, 12, 30, 0, 0, time.UTC)
+		counter := NewMemoryCounter()
+		counter.now = func() time.Time { return now }
+		testBudgets(t, counter, &now)
+	})
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		now := time.Date(2025, 1, 15, 12, 30, 0, 0, time.UTC)
+		counter := NewRedisCounter(RedisOptions{Address: server.Addr()})
+		t.Cleanup(func() { counter.Close() })
+		testBudgets(t, counter, &now)
+
+		// Keys expire with their window and do not hold raw identities
+		for _, key := range server.Keys() {
+			if ttl := server.TTL(key); ttl <= 0 || ttl > 24*time.Hour {
+				t.Errorf("key %s expires in %v", key, ttl)
+			}
+		}
+		if server.Exists("token-budget:hour:1736944200:alice") {
+			t.Error("identity stored in the clear")
+		}
+	})
+}
+
+func TestUnreadableCounterLetsRequestsThrough(t *testing.T) {
+	server := miniredis.RunT(t)
+	counter := NewRedisCounter(RedisOptions{Address: server.Addr(), Timeout: 100 * time.Millisecond})
+	t.Cleanup(func() { counter.Close() })
+	b := New(Options{Default: Limits{Hourly: 1}, Counter: counter})
+	b.Record("alice", 10)
+	server.Close()
+	if exceeded := b.Check("alice"); exceeded != nil {
+		t.Errorf("Check with the counter down = %+v, want nil", exceeded)
+	}
+	var disabled *Budgets
+	disabled.Record("alice", 10)
+	if exceeded := disabled.Check("alice"); exceeded != nil {
+		t.Errorf("nil budgets rejected a client: %+v", exceeded)
+	}
+}
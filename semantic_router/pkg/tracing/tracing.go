@@ -0,0 +1,66 @@
+// Package tracing exports OpenTelemetry spans of the router's request
+// processing, continuing the traces Envoy propagates in the traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the router's instrumentation
+const tracerName = "github.com/neuralmagic/semantic_router_poc/semantic_router"
+
+// Options holds options for exporting spans
+type Options struct {
+	// OTLP gRPC collector address, host:port
+	Endpoint string
+	// Export without TLS
+	Insecure bool
+	// Share of traces sampled when the caller made no sampling decision, 0 to 1
+	SampleRate float64
+	// Service name the spans are reported under
+	ServiceName string
+}
+
+// Setup installs a tracer provider exporting spans to an OTLP collector and
+// returns a function flushing and stopping it. Until it is called, spans are
+// not recorded.
+func Setup(options Options) (func(context.Context) error, error) {
+	exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(options.Endpoint)}
+	if options.Insecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+	// The exporter connects lazily, so a collector that is down does not
+	// keep the router from starting
+	exporter, err := otlptracegrpc.New(context.Background(), exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create span exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRate))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(options.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the router's spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Extract returns a context carrying the span context of the traceparent and
+// tracestate headers, keyed by lowercase name, if they hold one
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(headers))
+}
@@ -0,0 +1,25 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExtract(t *testing.T) {
+	ctx := Extract(context.Background(), map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	})
+	span := trace.SpanContextFromContext(ctx)
+	if !span.IsValid() || !span.IsRemote() || !span.IsSampled() {
+		t.Fatalf("expected a sampled remote span context, got %+v", span)
+	}
+	if span.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("unexpected span context %s/%s", span.TraceID(), span.SpanID())
+	}
+
+	if span := trace.SpanContextFromContext(Extract(context.Background(), map[string]string{})); span.IsValid() {
+		t.Errorf("expected no span context without traceparent, got %+v", span)
+	}
+}